@@ -1,11 +1,15 @@
 package auth
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
@@ -16,9 +20,32 @@ var (
 	JWTSecret            []byte
 	UseSecureConnections bool
 	AllowedCallbacks     []string
+	// AccessTokenTTL is how long an access JWT is accepted
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is how long a refresh token can be exchanged; every exchange starts it over
+	RefreshTokenTTL = 30 * 24 * time.Hour
+	// CallbackMode is how the sign-in callback hands tokens to the frontend
+	CallbackMode = CallbackModeCode
+	// CookieDomain is the Domain of the cookies set in cookie mode; empty means the backend's host
+	CookieDomain string
 )
 
+// Ways the sign-in callback hands tokens to the frontend, chosen with AUTH_CALLBACK_MODE
+const (
+	// CallbackModeCode redirects with a one-time code, which the frontend exchanges for tokens at
+	// POST /auth/token with its PKCE verifier
+	CallbackModeCode = "code"
+	// CallbackModeCookie keeps the tokens in HttpOnly cookies and requires a CSRF token on
+	// requests that change anything
+	CallbackModeCookie = "cookie"
+)
+
+// providerNamePattern keeps provider names usable in URLs and environment variable names
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9]+$`)
+
 func InitAuthConfig() error {
+	providers = map[string]Provider{}
+
 	GoogleOAuthConfig = &oauth2.Config{
 		ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
 		ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
@@ -30,13 +57,37 @@ func InitAuthConfig() error {
 		},
 		Endpoint: google.Endpoint,
 	}
+	if GoogleOAuthConfig.ClientID != "" {
+		RegisterProvider(googleProvider{})
+	}
+	if err := initOIDCProviders(); err != nil {
+		return err
+	}
+	if len(providers) == 0 {
+		log.Printf("Warning: No identity providers are configured; nobody can sign in")
+	}
 
-	// JWT secret key - MUST be set via environment variable
+	// Access tokens are signed with JWT_PRIVATE_KEY when it is set. JWT_SECRET signs them
+	// otherwise; next to a key it only verifies HMAC tokens until JWT_SECRET_UNTIL.
+	if err := loadJWTKeys(); err != nil {
+		return err
+	}
 	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		return errors.New("JWT_SECRET environment variable is required but not set")
+	if secret == "" && currentJWTKey == nil {
+		return errors.New("JWT_PRIVATE_KEY or JWT_SECRET environment variable is required but not set")
 	}
 	JWTSecret = []byte(secret)
+	jwtSecretUntil = time.Time{}
+	if until := os.Getenv("JWT_SECRET_UNTIL"); until != "" {
+		var err error
+		jwtSecretUntil, err = time.Parse(time.RFC3339, until)
+		if err != nil {
+			return fmt.Errorf("invalid JWT_SECRET_UNTIL: %w", err)
+		}
+	}
+	if secret != "" && currentJWTKey != nil && jwtSecretUntil.IsZero() {
+		log.Printf("Warning: JWT_SECRET is ignored while JWT_PRIVATE_KEY is set; set JWT_SECRET_UNTIL to keep accepting HMAC tokens during the move")
+	}
 
 	// Determine if we should use secure connections (HTTPS/SSL)
 	// Defaults to true for security - explicitly set to false for local development
@@ -64,5 +115,73 @@ func InitAuthConfig() error {
 		AllowedCallbacks = []string{}
 	}
 
+	CallbackMode = os.Getenv("AUTH_CALLBACK_MODE")
+	switch CallbackMode {
+	case "":
+		CallbackMode = CallbackModeCode
+	case CallbackModeCode, CallbackModeCookie:
+	default:
+		return fmt.Errorf("invalid AUTH_CALLBACK_MODE %q: use %s or %s", CallbackMode, CallbackModeCode, CallbackModeCookie)
+	}
+	CookieDomain = os.Getenv("AUTH_COOKIE_DOMAIN")
+
+	AccessTokenTTL = durationFromEnv("ACCESS_TOKEN_TTL", 15*time.Minute)
+	RefreshTokenTTL = durationFromEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+
+	return nil
+}
+
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("Warning: Invalid %s value '%s', defaulting to %s", name, value, fallback)
+		return fallback
+	}
+	return duration
+}
+
+// initOIDCProviders registers the generic OpenID Connect providers listed in OIDC_PROVIDERS. Each
+// is configured by OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET, _REDIRECT_URL and optionally
+// _SCOPES (space-separated).
+func initOIDCProviders() error {
+	names := os.Getenv("OIDC_PROVIDERS")
+	if names == "" {
+		return nil
+	}
+
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if !providerNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid OIDC provider name %q: use lowercase letters and digits", name)
+		}
+		if _, exists := providers[name]; exists {
+			return fmt.Errorf("identity provider %q is configured twice", name)
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		config := OIDCProviderConfig{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+			return fmt.Errorf("OIDC provider %s needs %sISSUER, %sCLIENT_ID and %sREDIRECT_URL", name, prefix, prefix, prefix)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		provider, err := NewOIDCProvider(ctx, config)
+		cancel()
+		if err != nil {
+			return err
+		}
+		RegisterProvider(provider)
+	}
 	return nil
 }
@@ -3,6 +3,7 @@ package auth
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -99,3 +100,40 @@ func TestInitAuthConfig_InvalidSecureConnectionsValue(t *testing.T) {
 	// Should default to true (secure) when value is invalid
 	assert.True(t, UseSecureConnections)
 }
+
+func TestInitAuthConfig_TokenLifetimes(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret")
+	defer os.Unsetenv("JWT_SECRET")
+
+	os.Unsetenv("ACCESS_TOKEN_TTL")
+	os.Unsetenv("REFRESH_TOKEN_TTL")
+	assert.NoError(t, InitAuthConfig())
+	assert.Equal(t, 15*time.Minute, AccessTokenTTL)
+	assert.Equal(t, 30*24*time.Hour, RefreshTokenTTL)
+
+	os.Setenv("ACCESS_TOKEN_TTL", "5m")
+	os.Setenv("REFRESH_TOKEN_TTL", "not-a-duration")
+	defer os.Unsetenv("ACCESS_TOKEN_TTL")
+	defer os.Unsetenv("REFRESH_TOKEN_TTL")
+	assert.NoError(t, InitAuthConfig())
+	assert.Equal(t, 5*time.Minute, AccessTokenTTL)
+	assert.Equal(t, 30*24*time.Hour, RefreshTokenTTL)
+}
+
+func TestInitAuthConfig_CallbackMode(t *testing.T) {
+	t.Cleanup(func() { CallbackMode = CallbackModeCode })
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	t.Setenv("AUTH_CALLBACK_MODE", "")
+	assert.NoError(t, InitAuthConfig())
+	assert.Equal(t, CallbackModeCode, CallbackMode)
+
+	t.Setenv("AUTH_CALLBACK_MODE", "cookie")
+	t.Setenv("AUTH_COOKIE_DOMAIN", "example.com")
+	assert.NoError(t, InitAuthConfig())
+	assert.Equal(t, CallbackModeCookie, CallbackMode)
+	assert.Equal(t, "example.com", CookieDomain)
+
+	t.Setenv("AUTH_CALLBACK_MODE", "query")
+	assert.ErrorContains(t, InitAuthConfig(), `invalid AUTH_CALLBACK_MODE "query"`)
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+)
+
+// Cookies of the cookie callback mode
+const (
+	accessTokenCookie  = "fcm_access_token"
+	refreshTokenCookie = "fcm_refresh_token"
+	// csrfCookie is readable by the frontend, which echoes it in CSRFHeader
+	csrfCookie = "fcm_csrf"
+)
+
+// identityLinkCookie carries an identity link token from the request that created the link to
+// the sign-in callback, so that only the browser of the user who asked for it can use it
+const identityLinkCookie = "oauth_link"
+
+// CSRFHeader must repeat the CSRF cookie on cookie-authenticated requests that change anything
+const CSRFHeader = "X-CSRF-Token"
+
+// setAuthCookies hands a token pair to the browser in HttpOnly cookies, together with a fresh
+// CSRF token the frontend can read
+func setAuthCookies(w http.ResponseWriter, tokens TokenResponse) {
+	refreshMaxAge := int(RefreshTokenTTL / time.Second)
+	setCookie(w, accessTokenCookie, tokens.AccessToken, "/", int(AccessTokenTTL/time.Second), true)
+	// The refresh token is only needed by the refresh and logout endpoints
+	setCookie(w, refreshTokenCookie, tokens.RefreshToken, "/auth", refreshMaxAge, true)
+	setCookie(w, csrfCookie, generateStateToken(), "/", refreshMaxAge, false)
+}
+
+// SetIdentityLinkCookie hands an identity link token to the browser that requested the link. The
+// sign-in pages under /auth read it when the user signs in with the identity to link.
+func SetIdentityLinkCookie(w http.ResponseWriter, token string, expiry time.Duration) {
+	setCookie(w, identityLinkCookie, token, "/auth", int(expiry/time.Second), true)
+}
+
+// clearIdentityLinkCookie ends an identity link in the browser
+func clearIdentityLinkCookie(w http.ResponseWriter) {
+	setCookie(w, identityLinkCookie, "", "/auth", -1, true)
+}
+
+// clearAuthCookies signs the browser out
+func clearAuthCookies(w http.ResponseWriter) {
+	setCookie(w, accessTokenCookie, "", "/", -1, true)
+	setCookie(w, refreshTokenCookie, "", "/auth", -1, true)
+	setCookie(w, csrfCookie, "", "/", -1, false)
+}
+
+func setCookie(w http.ResponseWriter, name, value, path string, maxAge int, httpOnly bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   CookieDomain,
+		MaxAge:   maxAge,
+		HttpOnly: httpOnly,
+		Secure:   UseSecureConnections,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// safeMethod reports whether a request method only reads
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// csrfTokenValid checks the double-submitted CSRF token of a cookie-authenticated request
+func csrfTokenValid(r *http.Request) bool {
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.Header.Get(CSRFHeader))) == 1
+}
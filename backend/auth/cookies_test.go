@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// useCookieMode switches to the cookie callback mode for the duration of a test
+func useCookieMode(t *testing.T) {
+	t.Cleanup(func() { CallbackMode = CallbackModeCode })
+	CallbackMode = CallbackModeCookie
+}
+
+// signInWithCookies goes through the Google sign-in flow with a callback in cookie mode
+func signInWithCookies(t *testing.T) *httptest.ResponseRecorder {
+	originalExchange := exchangeToken
+	originalGetUserInfo := getUserInfo
+	t.Cleanup(func() {
+		exchangeToken = originalExchange
+		getUserInfo = originalGetUserInfo
+	})
+	exchangeToken = func(ctx context.Context, code string) (*oauth2.Token, error) {
+		return &oauth2.Token{AccessToken: "mock-access-token"}, nil
+	}
+	getUserInfo = func(ctx context.Context, token *oauth2.Token) (*GoogleUserInfo, error) {
+		return &GoogleUserInfo{ID: "google-user-123", Email: "test@example.com", GivenName: "Test", FamilyName: "User", VerifiedEmail: true}, nil
+	}
+
+	req := httptest.NewRequest("GET", "/auth/google/callback?state=test-state&code=test-code", nil)
+	req.AddCookie(&http.Cookie{Name: "oauth_state", Value: "test-state"})
+	req.AddCookie(&http.Cookie{Name: "oauth_callback", Value: testCallbackURL})
+	rr := httptest.NewRecorder()
+	CallbackHandler(rr, withProvider(req, "google"))
+	return rr
+}
+
+// authCookies returns the cookies a response sets, by name
+func authCookies(rr *httptest.ResponseRecorder) map[string]*http.Cookie {
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range rr.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	return cookies
+}
+
+// withAuthCookies adds the auth cookies to a request, and the CSRF header when csrf is set
+func withAuthCookies(req *http.Request, cookies map[string]*http.Cookie, csrf bool) *http.Request {
+	for _, name := range []string{accessTokenCookie, refreshTokenCookie, csrfCookie} {
+		req.AddCookie(&http.Cookie{Name: name, Value: cookies[name].Value})
+	}
+	if csrf {
+		req.Header.Set(CSRFHeader, cookies[csrfCookie].Value)
+	}
+	return req
+}
+
+func TestCallbackHandler_CookieMode(t *testing.T) {
+	setupAuthTests()
+	setupAuthTestDB(t)
+	useCookieMode(t)
+
+	rr := signInWithCookies(t)
+
+	// The frontend is sent back without any token in the URL
+	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	assert.Equal(t, testCallbackURL, rr.Header().Get("Location"))
+
+	cookies := authCookies(rr)
+	require.Contains(t, cookies, accessTokenCookie)
+	require.Contains(t, cookies, refreshTokenCookie)
+	require.Contains(t, cookies, csrfCookie)
+	assert.True(t, cookies[accessTokenCookie].HttpOnly)
+	assert.Equal(t, "/", cookies[accessTokenCookie].Path)
+	assert.True(t, cookies[refreshTokenCookie].HttpOnly)
+	assert.Equal(t, "/auth", cookies[refreshTokenCookie].Path)
+	assert.False(t, cookies[csrfCookie].HttpOnly)
+	assert.NotEmpty(t, cookies[csrfCookie].Value)
+	assert.Equal(t, http.SameSiteLaxMode, cookies[accessTokenCookie].SameSite)
+
+	claims, err := ParseFamilyCalendarJWT(cookies[accessTokenCookie].Value)
+	require.NoError(t, err)
+	assert.NotZero(t, claims.UserID)
+}
+
+func TestRequireAuth_CookieMode(t *testing.T) {
+	setupAuthTests()
+	setupAuthTestDB(t)
+	useCookieMode(t)
+	cookies := authCookies(signInWithCookies(t))
+	handler := RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		method string
+		csrf   bool
+		status int
+	}{
+		{"read without CSRF token", "GET", false, http.StatusOK},
+		{"write without CSRF token", "POST", false, http.StatusForbidden},
+		{"write with CSRF token", "DELETE", true, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := withAuthCookies(httptest.NewRequest(tt.method, "/api/calendar-muxes", nil), cookies, tt.csrf)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.status, rr.Code)
+		})
+	}
+
+	// A CSRF header that does not match the cookie is refused
+	req := withAuthCookies(httptest.NewRequest("POST", "/api/calendar-muxes", nil), cookies, false)
+	req.Header.Set(CSRFHeader, "forged")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Missing or invalid CSRF token")
+
+	// Outside cookie mode the cookie is ignored
+	CallbackMode = CallbackModeCode
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, withAuthCookies(httptest.NewRequest("GET", "/api/calendar-muxes", nil), cookies, true))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestRefreshAndLogout_CookieMode(t *testing.T) {
+	setupAuthTests()
+	setupAuthTestDB(t)
+	useCookieMode(t)
+	cookies := authCookies(signInWithCookies(t))
+
+	// Refreshing needs the CSRF token too
+	rr := httptest.NewRecorder()
+	RefreshHandler(rr, withAuthCookies(httptest.NewRequest("POST", "/auth/refresh", nil), cookies, false))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// The new tokens replace the cookies and are not in the response body
+	rr = httptest.NewRecorder()
+	RefreshHandler(rr, withAuthCookies(httptest.NewRequest("POST", "/auth/refresh", nil), cookies, true))
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Empty(t, rr.Body.String())
+	refreshed := authCookies(rr)
+	require.Contains(t, refreshed, refreshTokenCookie)
+	assert.NotEqual(t, cookies[refreshTokenCookie].Value, refreshed[refreshTokenCookie].Value)
+	assert.NotEqual(t, cookies[csrfCookie].Value, refreshed[csrfCookie].Value)
+
+	// Logging out clears the cookies and ends the session
+	rr = httptest.NewRecorder()
+	LogoutHandler(rr, withAuthCookies(httptest.NewRequest("POST", "/auth/logout", nil), refreshed, true))
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	for _, cookie := range authCookies(rr) {
+		assert.Equal(t, -1, cookie.MaxAge, cookie.Name)
+	}
+	rr = httptest.NewRecorder()
+	RefreshHandler(rr, withAuthCookies(httptest.NewRequest("POST", "/auth/refresh", nil), refreshed, true))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, -1, authCookies(rr)[refreshTokenCookie].MaxAge)
+}
@@ -5,12 +5,17 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"html/template"
 	"log"
 	"net/http"
+	"regexp"
+	"time"
 
+	"family-calendar-backend/db/models"
 	"family-calendar-backend/db/services"
 
+	"github.com/go-chi/chi/v5"
 	"golang.org/x/oauth2"
 )
 
@@ -58,8 +63,29 @@ var (
 	}
 )
 
-// LoginHandler initiates the OAuth flow
+// authorizationCodeTTL is how long the frontend has to exchange the code from the callback
+const authorizationCodeTTL = time.Minute
+
+// codeChallengePattern matches S256 PKCE challenges: base64url SHA-256 hashes without padding
+var codeChallengePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{43}$`)
+
+// providerFromRequest looks up the provider named in the route, answering 404 for unknown ones
+func providerFromRequest(w http.ResponseWriter, r *http.Request) (Provider, bool) {
+	provider, ok := GetProvider(chi.URLParam(r, "provider"))
+	if !ok {
+		http.Error(w, "Unknown identity provider", http.StatusNotFound)
+		return nil, false
+	}
+	return provider, true
+}
+
+// LoginHandler initiates the OAuth flow with the provider named in the route
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := providerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
 	// Get callback URL from query parameter (optional)
 	callback := r.URL.Query().Get("callback")
 
@@ -79,6 +105,27 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// In code mode, only whoever holds the PKCE verifier can use the code the callback gets
+	codeChallenge := r.URL.Query().Get("code_challenge")
+	if callback != "" && CallbackMode == CallbackModeCode {
+		if r.URL.Query().Get("code_challenge_method") != "S256" || !codeChallengePattern.MatchString(codeChallenge) {
+			http.Error(w, "code_challenge and code_challenge_method=S256 are required", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Linking another identity takes the link cookie the link endpoint set in this browser. Any
+	// other sign-in drops a leftover one, so it never links by accident.
+	_, linkCookieErr := r.Cookie(identityLinkCookie)
+	linking := r.URL.Query().Has("link")
+	if linking && linkCookieErr != nil {
+		http.Error(w, "No identity link was started in this browser", http.StatusBadRequest)
+		return
+	}
+	if !linking && linkCookieErr == nil {
+		clearIdentityLinkCookie(w)
+	}
+
 	// Generate random state
 	state := generateStateToken()
 
@@ -103,15 +150,30 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 			Secure:   UseSecureConnections,
 			SameSite: http.SameSiteLaxMode,
 		})
+		if CallbackMode == CallbackModeCode {
+			http.SetCookie(w, &http.Cookie{
+				Name:     "oauth_code_challenge",
+				Value:    codeChallenge,
+				MaxAge:   300, // 5 minutes
+				HttpOnly: true,
+				Secure:   UseSecureConnections,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
 	}
 
-	// Redirect to Google's OAuth consent page
-	url := GoogleOAuthConfig.AuthCodeURL(state)
+	// Redirect to the provider's consent page
+	url := provider.AuthCodeURL(state, nonceForState(state))
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
 
-// CallbackHandler handles the OAuth callback from Google
+// CallbackHandler handles the OAuth callback from the provider named in the route
 func CallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := providerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
 	// Verify state token
 	stateCookie, err := r.Cookie("oauth_state")
 	if err != nil {
@@ -130,48 +192,66 @@ func CallbackHandler(w http.ResponseWriter, r *http.Request) {
 	if callbackCookie != nil {
 		callbackURL = callbackCookie.Value
 	}
+	var codeChallenge string
+	if callbackURL != "" && CallbackMode == CallbackModeCode {
+		challengeCookie, err := r.Cookie("oauth_code_challenge")
+		if err != nil {
+			http.Error(w, "Code challenge cookie not found", http.StatusBadRequest)
+			return
+		}
+		codeChallenge = challengeCookie.Value
+	}
 
 	// Exchange authorization code for token
 	code := r.URL.Query().Get("code")
-	token, err := exchangeToken(context.Background(), code)
+	token, err := provider.Exchange(r.Context(), code)
 	if err != nil {
-		log.Printf("Failed to exchange token: %v", err)
+		log.Printf("Failed to exchange token with %s: %v", provider.Name(), err)
 		http.Error(w, "Failed to exchange token", http.StatusInternalServerError)
 		return
 	}
 
-	// Get user info from Google
-	userInfo, err := getUserInfo(context.Background(), token)
+	// Get user info from the provider
+	identity, err := provider.Identify(r.Context(), token, nonceForState(stateCookie.Value))
 	if err != nil {
-		log.Printf("Failed to get user info: %v", err)
+		log.Printf("Failed to get user info from %s: %v", provider.Name(), err)
 		http.Error(w, "Failed to get user info", http.StatusInternalServerError)
 		return
 	}
 
-	// Get the user ID (works with both v2 and v3 API)
-	userID := userInfo.GetUserID()
-
 	// Validate that we have the required user information
-	if userID == "" {
-		log.Printf("Google user info missing ID/Sub field: %+v", userInfo)
-		http.Error(w, "Invalid user info from Google", http.StatusInternalServerError)
+	if identity.Subject == "" {
+		log.Printf("%s user info missing subject: %+v", provider.Name(), identity)
+		http.Error(w, "Invalid user info from identity provider", http.StatusInternalServerError)
 		return
 	}
 
-	// Find or create user in database
-	user, err := services.FindOrCreateUser("google", userID, userInfo.GivenName, userInfo.FamilyName, userInfo.Email)
-	if err != nil {
-		log.Printf("Failed to find or create user: %v", err)
-		http.Error(w, "Failed to process user", http.StatusInternalServerError)
-		return
-	}
+	// Attach the identity to the account that asked for it, or find or create its user
+	var user *models.User
+	if linkCookie, _ := r.Cookie(identityLinkCookie); linkCookie != nil {
+		clearIdentityLinkCookie(w)
 
-	// Generate JWT token with only user ID
-	jwtToken, err := GenerateFamilyCalendarJWT(user.ID)
-	if err != nil {
-		log.Printf("Failed to generate JWT: %v", err)
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
-		return
+		// A merge is only recorded here; the user confirms it through the API
+		user, err = services.LinkIdentity(linkCookie.Value, provider.Name(), identity.Subject, identity.Email, time.Now())
+		switch {
+		case errors.Is(err, services.ErrIdentityLinkInvalid):
+			http.Error(w, "Identity link is invalid or expired", http.StatusBadRequest)
+			return
+		case errors.Is(err, services.ErrIdentityLinkedElsewhere):
+			http.Error(w, "This identity belongs to another account; link it with merge to combine the accounts", http.StatusConflict)
+			return
+		case err != nil:
+			log.Printf("Failed to link identity: %v", err)
+			http.Error(w, "Failed to process user", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		user, err = services.FindOrCreateUser(provider.Name(), identity.Subject, identity.GivenName, identity.FamilyName, identity.Email)
+		if err != nil {
+			log.Printf("Failed to find or create user: %v", err)
+			http.Error(w, "Failed to process user", http.StatusInternalServerError)
+			return
+		}
 	}
 
 	// Clear auth cookies
@@ -193,17 +273,48 @@ func CallbackHandler(w http.ResponseWriter, r *http.Request) {
 			SameSite: http.SameSiteLaxMode,
 		})
 	}
+	if codeChallenge != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     "oauth_code_challenge",
+			Value:    "",
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   UseSecureConnections,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	// In code mode the frontend gets a one-time code rather than tokens, which would end up in
+	// browser history, logs and Referer headers
+	if callbackURL != "" && CallbackMode == CallbackModeCode {
+		code, err := services.CreateAuthorizationCode(user.ID, codeChallenge, callbackURL, time.Now().Add(authorizationCodeTTL))
+		if err != nil {
+			log.Printf("Failed to create authorization code: %v", err)
+			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, callbackURL+"?code="+code, http.StatusTemporaryRedirect)
+		return
+	}
+
+	// Generate a short-lived JWT with only the user ID, and a refresh token to renew it
+	tokens, err := issueTokens(user.ID, r)
+	if err != nil {
+		log.Printf("Failed to issue tokens: %v", err)
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
 
-	// If callback URL is provided, redirect with token; otherwise render template
+	// In cookie mode the tokens go into HttpOnly cookies; without a callback URL they are shown
 	if callbackURL != "" {
-		redirectURL := callbackURL + "?token=" + jwtToken
-		http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
+		setAuthCookies(w, tokens)
+		http.Redirect(w, r, callbackURL, http.StatusTemporaryRedirect)
 	} else {
-		renderTokenPage(w, jwtToken, *userInfo)
+		renderTokenPage(w, tokens, *identity)
 	}
 }
 
-func renderTokenPage(w http.ResponseWriter, token string, userInfo GoogleUserInfo) {
+func renderTokenPage(w http.ResponseWriter, tokens TokenResponse, identity Identity) {
 	t, err := template.ParseFiles("auth/templates/auth_success.html")
 	if err != nil {
 		log.Printf("Failed to parse template: %v", err)
@@ -212,15 +323,19 @@ func renderTokenPage(w http.ResponseWriter, token string, userInfo GoogleUserInf
 	}
 
 	data := struct {
-		Token      string
-		GivenName  string
-		FamilyName string
-		Email      string
+		Token        string
+		RefreshToken string
+		ExpiresIn    time.Duration
+		GivenName    string
+		FamilyName   string
+		Email        string
 	}{
-		Token:      token,
-		GivenName:  userInfo.GivenName,
-		FamilyName: userInfo.FamilyName,
-		Email:      userInfo.Email,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    AccessTokenTTL,
+		GivenName:    identity.GivenName,
+		FamilyName:   identity.FamilyName,
+		Email:        identity.Email,
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -12,11 +12,14 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"family-calendar-backend/db"
 	"family-calendar-backend/db/models"
 	"family-calendar-backend/db/services"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/oauth2"
 )
 
@@ -37,7 +40,7 @@ func TestLoginHandler(t *testing.T) {
 	req := httptest.NewRequest("GET", "/auth/google", nil)
 	rr := httptest.NewRecorder()
 
-	LoginHandler(rr, req)
+	LoginHandler(rr, withProvider(req, "google"))
 
 	// Should redirect to Google OAuth
 	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
@@ -64,18 +67,18 @@ func TestLoginHandler(t *testing.T) {
 func TestLoginHandler_WithValidCallback(t *testing.T) {
 	setupAuthTests()
 
-	req := httptest.NewRequest("GET", "/auth/google?callback=http://localhost:3000/auth/callback", nil)
+	req := httptest.NewRequest("GET", "/auth/google?callback=http://localhost:3000/auth/callback"+testPKCEParams, nil)
 	rr := httptest.NewRecorder()
 
-	LoginHandler(rr, req)
+	LoginHandler(rr, withProvider(req, "google"))
 
 	// Should redirect to Google OAuth
 	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
 	assert.Contains(t, rr.Header().Get("Location"), "accounts.google.com/o/oauth2")
 
-	// Should set both state and callback cookies
+	// Should set the state, callback and code challenge cookies
 	cookies := rr.Result().Cookies()
-	var stateCookie, callbackCookie *http.Cookie
+	var stateCookie, callbackCookie, challengeCookie *http.Cookie
 	for _, cookie := range cookies {
 		if cookie.Name == "oauth_state" {
 			stateCookie = cookie
@@ -83,12 +86,43 @@ func TestLoginHandler_WithValidCallback(t *testing.T) {
 		if cookie.Name == "oauth_callback" {
 			callbackCookie = cookie
 		}
+		if cookie.Name == "oauth_code_challenge" {
+			challengeCookie = cookie
+		}
 	}
 	assert.NotNil(t, stateCookie)
 	assert.NotNil(t, callbackCookie)
 	assert.Equal(t, "http://localhost:3000/auth/callback", callbackCookie.Value)
 	assert.Equal(t, 300, callbackCookie.MaxAge)
 	assert.True(t, callbackCookie.HttpOnly)
+	require.NotNil(t, challengeCookie)
+	assert.Equal(t, testCodeChallenge, challengeCookie.Value)
+	assert.True(t, challengeCookie.HttpOnly)
+}
+
+func TestLoginHandler_WithCallbackRequiresCodeChallenge(t *testing.T) {
+	setupAuthTests()
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"missing", ""},
+		{"plain method", "&code_challenge=" + testCodeChallenge + "&code_challenge_method=plain"},
+		{"malformed challenge", "&code_challenge=short&code_challenge_method=S256"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/auth/google?callback=http://localhost:3000/auth/callback"+tt.query, nil)
+			rr := httptest.NewRecorder()
+
+			LoginHandler(rr, withProvider(req, "google"))
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			assert.Contains(t, rr.Body.String(), "code_challenge_method=S256 are required")
+		})
+	}
 }
 
 func TestLoginHandler_WithInvalidCallback(t *testing.T) {
@@ -97,7 +131,7 @@ func TestLoginHandler_WithInvalidCallback(t *testing.T) {
 	req := httptest.NewRequest("GET", "/auth/google?callback=http://evil.com/steal", nil)
 	rr := httptest.NewRecorder()
 
-	LoginHandler(rr, req)
+	LoginHandler(rr, withProvider(req, "google"))
 
 	assert.Equal(t, http.StatusForbidden, rr.Code)
 	assert.Contains(t, rr.Body.String(), "callback URL is not allowed")
@@ -107,7 +141,7 @@ func TestCallbackHandler_MissingStateCookie(t *testing.T) {
 	req := httptest.NewRequest("GET", "/auth/google/callback?state=test&code=test", nil)
 	rr := httptest.NewRecorder()
 
-	CallbackHandler(rr, req)
+	CallbackHandler(rr, withProvider(req, "google"))
 
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "State cookie not found")
@@ -121,7 +155,7 @@ func TestCallbackHandler_InvalidState(t *testing.T) {
 	})
 	rr := httptest.NewRecorder()
 
-	CallbackHandler(rr, req)
+	CallbackHandler(rr, withProvider(req, "google"))
 
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Invalid state parameter")
@@ -144,7 +178,7 @@ func TestGenerateStateToken(t *testing.T) {
 
 func TestRenderTokenPage_TemplateNotFound(t *testing.T) {
 	rr := httptest.NewRecorder()
-	userInfo := GoogleUserInfo{
+	userInfo := Identity{
 		GivenName:  "John",
 		FamilyName: "Doe",
 		Email:      "john@example.com",
@@ -152,7 +186,7 @@ func TestRenderTokenPage_TemplateNotFound(t *testing.T) {
 
 	// This will fail because the template path won't exist in test environment
 	// But we can test it handles the error gracefully
-	renderTokenPage(rr, "test-token", userInfo)
+	renderTokenPage(rr, TokenResponse{AccessToken: "test-token"}, userInfo)
 
 	// Should return 500 if template fails to load
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
@@ -172,6 +206,7 @@ func TestRenderTokenPage_Success(t *testing.T) {
 <h1>Hello {{.GivenName}} {{.FamilyName}}</h1>
 <p>Email: {{.Email}}</p>
 <p>Token: {{.Token}}</p>
+<p>Refresh token: {{.RefreshToken}}</p>
 </body>
 </html>`
 
@@ -186,19 +221,20 @@ func TestRenderTokenPage_Success(t *testing.T) {
 
 	// Test successful rendering
 	rr := httptest.NewRecorder()
-	userInfo := GoogleUserInfo{
+	userInfo := Identity{
 		GivenName:  "John",
 		FamilyName: "Doe",
 		Email:      "john@example.com",
 	}
 
-	renderTokenPage(rr, "test-jwt-token", userInfo)
+	renderTokenPage(rr, TokenResponse{AccessToken: "test-jwt-token", RefreshToken: "test-refresh-token"}, userInfo)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
 	assert.Contains(t, rr.Body.String(), "Hello John Doe")
 	assert.Contains(t, rr.Body.String(), "john@example.com")
 	assert.Contains(t, rr.Body.String(), "test-jwt-token")
+	assert.Contains(t, rr.Body.String(), "test-refresh-token")
 }
 
 func TestRenderTokenPage_TemplateExecutionError(t *testing.T) {
@@ -219,13 +255,13 @@ func TestRenderTokenPage_TemplateExecutionError(t *testing.T) {
 	os.Chdir(tmpDir)
 
 	rr := httptest.NewRecorder()
-	userInfo := GoogleUserInfo{
+	userInfo := Identity{
 		GivenName:  "Test",
 		FamilyName: "User",
 		Email:      "test@example.com",
 	}
 
-	renderTokenPage(rr, "token", userInfo)
+	renderTokenPage(rr, TokenResponse{AccessToken: "token"}, userInfo)
 
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Failed to render template")
@@ -239,7 +275,7 @@ func TestCallbackHandler_MissingCode(t *testing.T) {
 	})
 	rr := httptest.NewRecorder()
 
-	CallbackHandler(rr, req)
+	CallbackHandler(rr, withProvider(req, "google"))
 
 	// Without code parameter, the OAuth exchange will fail
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
@@ -323,7 +359,7 @@ func TestLoginHandler_StateInURL(t *testing.T) {
 	req := httptest.NewRequest("GET", "/auth/google", nil)
 	rr := httptest.NewRecorder()
 
-	LoginHandler(rr, req)
+	LoginHandler(rr, withProvider(req, "google"))
 
 	// Get the state from cookie
 	cookies := rr.Result().Cookies()
@@ -374,7 +410,7 @@ func TestCallbackHandler_StateValidation(t *testing.T) {
 			})
 			rr := httptest.NewRecorder()
 
-			CallbackHandler(rr, req)
+			CallbackHandler(rr, withProvider(req, "google"))
 
 			assert.Equal(t, tt.expectedStatus, rr.Code)
 			assert.Contains(t, strings.TrimSpace(rr.Body.String()), tt.expectedBody)
@@ -478,6 +514,8 @@ func TestResponseBodyClosure(t *testing.T) {
 }
 
 func TestCallbackHandler_SuccessfulOAuthFlow(t *testing.T) {
+	setupAuthTestDB(t)
+
 	// Save original functions
 	originalExchange := exchangeToken
 	originalGetUserInfo := getUserInfo
@@ -497,21 +535,20 @@ func TestCallbackHandler_SuccessfulOAuthFlow(t *testing.T) {
 	// Mock successful user info retrieval
 	getUserInfo = func(ctx context.Context, token *oauth2.Token) (*GoogleUserInfo, error) {
 		return &GoogleUserInfo{
-			ID:         "google-user-123",
-			Email:      "test@example.com",
-			GivenName:  "Test",
-			FamilyName: "User",
+			ID:            "google-user-123",
+			Email:         "test@example.com",
+			VerifiedEmail: true,
+			GivenName:     "Test",
+			FamilyName:    "User",
 		}, nil
 	}
 
 	// Mock database user creation
 	services.FindOrCreateUser = func(provider, providerID, givenName, familyName, email string) (*models.User, error) {
 		return &models.User{
-			GivenName:      givenName,
-			FamilyName:     familyName,
-			Email:          email,
-			AuthProvider:   provider,
-			AuthProviderID: providerID,
+			GivenName:  givenName,
+			FamilyName: familyName,
+			Email:      email,
 		}, nil
 	}
 
@@ -538,7 +575,7 @@ func TestCallbackHandler_SuccessfulOAuthFlow(t *testing.T) {
 	})
 	rr := httptest.NewRecorder()
 
-	CallbackHandler(rr, req)
+	CallbackHandler(rr, withProvider(req, "google"))
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Token:")
@@ -561,7 +598,7 @@ func TestCallbackHandler_ExchangeTokenError(t *testing.T) {
 	})
 	rr := httptest.NewRecorder()
 
-	CallbackHandler(rr, req)
+	CallbackHandler(rr, withProvider(req, "google"))
 
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Failed to exchange token")
@@ -592,7 +629,7 @@ func TestCallbackHandler_GetUserInfoError(t *testing.T) {
 	})
 	rr := httptest.NewRecorder()
 
-	CallbackHandler(rr, req)
+	CallbackHandler(rr, withProvider(req, "google"))
 
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Failed to get user info")
@@ -616,10 +653,11 @@ func TestCallbackHandler_DatabaseError(t *testing.T) {
 
 	getUserInfo = func(ctx context.Context, token *oauth2.Token) (*GoogleUserInfo, error) {
 		return &GoogleUserInfo{
-			ID:         "google-123",
-			Email:      "test@example.com",
-			GivenName:  "Test",
-			FamilyName: "User",
+			ID:            "google-123",
+			Email:         "test@example.com",
+			VerifiedEmail: true,
+			GivenName:     "Test",
+			FamilyName:    "User",
 		}, nil
 	}
 
@@ -635,7 +673,7 @@ func TestCallbackHandler_DatabaseError(t *testing.T) {
 	})
 	rr := httptest.NewRecorder()
 
-	CallbackHandler(rr, req)
+	CallbackHandler(rr, withProvider(req, "google"))
 
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Failed to process user")
@@ -643,6 +681,7 @@ func TestCallbackHandler_DatabaseError(t *testing.T) {
 
 func TestCallbackHandler_WithCallbackRedirect(t *testing.T) {
 	setupAuthTests()
+	setupAuthTestDB(t)
 
 	// Save original functions
 	originalExchange := exchangeToken
@@ -661,20 +700,19 @@ func TestCallbackHandler_WithCallbackRedirect(t *testing.T) {
 
 	getUserInfo = func(ctx context.Context, token *oauth2.Token) (*GoogleUserInfo, error) {
 		return &GoogleUserInfo{
-			ID:         "google-user-123",
-			Email:      "test@example.com",
-			GivenName:  "Test",
-			FamilyName: "User",
+			ID:            "google-user-123",
+			Email:         "test@example.com",
+			VerifiedEmail: true,
+			GivenName:     "Test",
+			FamilyName:    "User",
 		}, nil
 	}
 
 	services.FindOrCreateUser = func(provider, providerID, givenName, familyName, email string) (*models.User, error) {
 		user := &models.User{
-			GivenName:      givenName,
-			FamilyName:     familyName,
-			Email:          email,
-			AuthProvider:   provider,
-			AuthProviderID: providerID,
+			GivenName:  givenName,
+			FamilyName: familyName,
+			Email:      email,
 		}
 		user.ID = 1
 		return user, nil
@@ -690,19 +728,23 @@ func TestCallbackHandler_WithCallbackRedirect(t *testing.T) {
 		Name:  "oauth_callback",
 		Value: "http://localhost:3000/auth/callback",
 	})
+	req.AddCookie(&http.Cookie{
+		Name:  "oauth_code_challenge",
+		Value: testCodeChallenge,
+	})
 	rr := httptest.NewRecorder()
 
-	CallbackHandler(rr, req)
+	CallbackHandler(rr, withProvider(req, "google"))
 
-	// Should redirect to callback URL with token
+	// Should redirect to callback URL with a code, never with tokens
 	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
 	location := rr.Header().Get("Location")
-	assert.Contains(t, location, "http://localhost:3000/auth/callback?token=")
-	assert.NotContains(t, location, "token=http") // Token shouldn't contain URL
+	assert.Contains(t, location, "http://localhost:3000/auth/callback?code=")
+	assert.NotContains(t, location, "token=")
 
 	// Should clear cookies
 	cookies := rr.Result().Cookies()
-	var stateCookie, callbackCookie *http.Cookie
+	var stateCookie, callbackCookie, challengeCookie *http.Cookie
 	for _, cookie := range cookies {
 		if cookie.Name == "oauth_state" {
 			stateCookie = cookie
@@ -710,11 +752,30 @@ func TestCallbackHandler_WithCallbackRedirect(t *testing.T) {
 		if cookie.Name == "oauth_callback" {
 			callbackCookie = cookie
 		}
+		if cookie.Name == "oauth_code_challenge" {
+			challengeCookie = cookie
+		}
 	}
 	assert.NotNil(t, stateCookie)
 	assert.Equal(t, -1, stateCookie.MaxAge)
 	assert.NotNil(t, callbackCookie)
 	assert.Equal(t, -1, callbackCookie.MaxAge)
+	assert.NotNil(t, challengeCookie)
+	assert.Equal(t, -1, challengeCookie.MaxAge)
+}
+
+func TestCallbackHandler_WithCallbackMissingCodeChallenge(t *testing.T) {
+	setupAuthTests()
+
+	req := httptest.NewRequest("GET", "/auth/google/callback?state=test-state&code=test-code", nil)
+	req.AddCookie(&http.Cookie{Name: "oauth_state", Value: "test-state"})
+	req.AddCookie(&http.Cookie{Name: "oauth_callback", Value: "http://localhost:3000/auth/callback"})
+	rr := httptest.NewRecorder()
+
+	CallbackHandler(rr, withProvider(req, "google"))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Code challenge cookie not found")
 }
 
 func TestCallbackHandler_MissingUserID(t *testing.T) {
@@ -735,11 +796,12 @@ func TestCallbackHandler_MissingUserID(t *testing.T) {
 
 	getUserInfo = func(ctx context.Context, token *oauth2.Token) (*GoogleUserInfo, error) {
 		return &GoogleUserInfo{
-			ID:         "", // Empty ID
-			Sub:        "", // Empty Sub
-			Email:      "test@example.com",
-			GivenName:  "Test",
-			FamilyName: "User",
+			ID:            "", // Empty ID
+			Sub:           "", // Empty Sub
+			Email:         "test@example.com",
+			VerifiedEmail: true,
+			GivenName:     "Test",
+			FamilyName:    "User",
 		}, nil
 	}
 
@@ -750,9 +812,129 @@ func TestCallbackHandler_MissingUserID(t *testing.T) {
 	})
 	rr := httptest.NewRecorder()
 
-	CallbackHandler(rr, req)
+	CallbackHandler(rr, withProvider(req, "google"))
 
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
-	assert.Contains(t, rr.Body.String(), "Invalid user info from Google")
+	assert.Contains(t, rr.Body.String(), "Invalid user info from identity provider")
+}
+
+// createLinkToken starts an identity link from a new sign-in session of the user, as the identity
+// link endpoint does, and returns the token it puts in the link cookie
+func createLinkToken(t *testing.T, userID uint) string {
+	now := time.Now()
+	session, _, err := services.CreateSession(userID, "Laptop", "192.0.2.1", now, now.Add(time.Hour))
+	require.NoError(t, err)
+	_, token, err := services.CreateIdentityLink(userID, session.ID, false, now.Add(time.Hour))
+	require.NoError(t, err)
+	return token
+}
+
+// signInToLink goes through the Google sign-in flow at the URL returned by the identity link
+// endpoint, in a browser holding the given link cookie, and signs in as the given Google user
+func signInToLink(t *testing.T, linkToken, googleID string) *httptest.ResponseRecorder {
+	originalExchange := exchangeToken
+	originalGetUserInfo := getUserInfo
+	t.Cleanup(func() {
+		exchangeToken = originalExchange
+		getUserInfo = originalGetUserInfo
+	})
+	exchangeToken = func(ctx context.Context, code string) (*oauth2.Token, error) {
+		return &oauth2.Token{AccessToken: "mock-access-token"}, nil
+	}
+	getUserInfo = func(ctx context.Context, token *oauth2.Token) (*GoogleUserInfo, error) {
+		return &GoogleUserInfo{ID: googleID, Email: googleID + "@example.com", GivenName: "Test", FamilyName: "User", VerifiedEmail: true}, nil
+	}
+
+	linkCookie := &http.Cookie{Name: identityLinkCookie, Value: linkToken}
+	req := httptest.NewRequest("GET", "/auth/google?callback=http://localhost:3000/auth/callback"+testPKCEParams+"&link=1", nil)
+	req.AddCookie(linkCookie)
+	rr := httptest.NewRecorder()
+	LoginHandler(rr, withProvider(req, "google"))
+	require.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+
+	var state string
+	req = httptest.NewRequest("GET", "/auth/google/callback?code=test-code", nil)
+	req.AddCookie(linkCookie)
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == "oauth_state" {
+			state = cookie.Value
+		}
+		req.AddCookie(cookie)
+	}
+	req.URL.RawQuery += "&state=" + state
+	rr = httptest.NewRecorder()
+	CallbackHandler(rr, withProvider(req, "google"))
+	return rr
 }
 
+func TestCallbackHandler_LinkIdentity(t *testing.T) {
+	setupAuthTests()
+	setupAuthTestDB(t)
+	user, err := services.FindOrCreateUser("google", "work-1", "Test", "User", "work@example.com")
+	require.NoError(t, err)
+	token := createLinkToken(t, user.ID)
+
+	rr := signInToLink(t, token, "personal-1")
+
+	require.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	assert.Contains(t, rr.Header().Get("Location"), "http://localhost:3000/auth/callback?code=")
+	var identity models.UserIdentity
+	require.NoError(t, db.DB.Where("provider = ? AND subject = ?", "google", "personal-1").First(&identity).Error)
+	assert.Equal(t, user.ID, identity.UserID)
+
+	// The link cookie is cleared and the token is used up
+	cleared := false
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == identityLinkCookie {
+			cleared = cookie.MaxAge == -1
+		}
+	}
+	assert.True(t, cleared)
+	rr = signInToLink(t, token, "personal-2")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Identity link is invalid or expired")
+}
+
+func TestCallbackHandler_LinkIdentityOfAnotherAccount(t *testing.T) {
+	setupAuthTests()
+	setupAuthTestDB(t)
+	user, err := services.FindOrCreateUser("google", "work-1", "Test", "User", "work@example.com")
+	require.NoError(t, err)
+	_, err = services.FindOrCreateUser("google", "personal-1", "Test", "User", "personal-1@example.com")
+	require.NoError(t, err)
+	token := createLinkToken(t, user.ID)
+
+	rr := signInToLink(t, token, "personal-1")
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Contains(t, rr.Body.String(), "link it with merge")
+}
+
+func TestLoginHandler_LinkNeedsLinkCookie(t *testing.T) {
+	setupAuthTests()
+	setupAuthTestDB(t)
+	user, err := services.FindOrCreateUser("google", "work-1", "Test", "User", "work@example.com")
+	require.NoError(t, err)
+	token := createLinkToken(t, user.ID)
+
+	// A link URL opened in another browser does nothing, even with the token in the query
+	req := httptest.NewRequest("GET", "/auth/google?link="+token, nil)
+	rr := httptest.NewRecorder()
+	LoginHandler(rr, withProvider(req, "google"))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "No identity link was started in this browser")
+
+	// A plain sign-in drops a leftover link cookie, so it signs in rather than links
+	req = httptest.NewRequest("GET", "/auth/google", nil)
+	req.AddCookie(&http.Cookie{Name: identityLinkCookie, Value: token})
+	rr = httptest.NewRecorder()
+	LoginHandler(rr, withProvider(req, "google"))
+	require.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	cleared := false
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == identityLinkCookie {
+			cleared = cookie.MaxAge == -1
+		}
+	}
+	assert.True(t, cleared)
+}
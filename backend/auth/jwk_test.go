@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWK_PublicKey_RSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	jwk := JWK{
+		Kty: "RSA",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   "AQAB",
+	}
+	publicKey, err := jwk.PublicKey()
+
+	require.NoError(t, err)
+	assert.True(t, key.PublicKey.Equal(publicKey))
+}
+
+func TestJWK_PublicKey_EC(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	jwk := JWK{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(key.X.Bytes()),
+		Y:   base64.RawURLEncoding.EncodeToString(key.Y.Bytes()),
+	}
+	publicKey, err := jwk.PublicKey()
+
+	require.NoError(t, err)
+	assert.True(t, key.PublicKey.Equal(publicKey))
+}
+
+func TestJWK_PublicKey_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		jwk  JWK
+	}{
+		{"unsupported key type", JWK{Kty: "oct"}},
+		{"missing RSA modulus", JWK{Kty: "RSA", E: "AQAB"}},
+		{"bad RSA exponent", JWK{Kty: "RSA", N: "AQAB", E: "!!"}},
+		{"unsupported curve", JWK{Kty: "EC", Crv: "P-192", X: "AQAB", Y: "AQAB"}},
+		{"point not on curve", JWK{Kty: "EC", Crv: "P-256", X: "AQAB", Y: "AQAB"}},
+		{"unsupported OKP curve", JWK{Kty: "OKP", Crv: "X25519", X: "AQAB"}},
+		{"short Ed25519 key", JWK{Kty: "OKP", Crv: "Ed25519", X: "AQAB"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.jwk.PublicKey()
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestNewJWK_RoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	for _, key := range []interface{ Equal(x crypto.PublicKey) bool }{&rsaKey.PublicKey, edKey} {
+		jwk, err := NewJWK(key)
+		require.NoError(t, err)
+		publicKey, err := jwk.PublicKey()
+		require.NoError(t, err)
+		assert.True(t, key.Equal(publicKey))
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, err = NewJWK(&ecKey.PublicKey)
+	assert.Error(t, err)
+}
+
+func TestJWK_Thumbprint(t *testing.T) {
+	// The example of RFC 7638, section 3.1
+	jwk := JWK{
+		Kty: "RSA",
+		Kid: "2011-04-29",
+		Alg: "RS256",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+	}
+
+	thumbprint, err := jwk.Thumbprint()
+
+	require.NoError(t, err)
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", thumbprint)
+
+	_, err = JWK{Kty: "oct"}.Thumbprint()
+	assert.Error(t, err)
+}
@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -8,19 +10,58 @@ import (
 
 type FamilyCalendarClaims struct {
 	UserID uint `json:"user_id"`
+	// SessionID is the sign-in the token was issued for; RequireAuth rejects it once revoked
+	SessionID uint `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func GenerateFamilyCalendarJWT(userID uint) (string, error) {
+// newTokenID returns a random value for the jti claim
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GenerateFamilyCalendarJWT issues a short-lived access token for a session; clients renew it
+// with a refresh token. It is signed with the current asymmetric key, or with JWTSecret when
+// none is configured.
+func GenerateFamilyCalendarJWT(userID, sessionID uint) (string, error) {
+	tokenID, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
 	claims := FamilyCalendarClaims{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "family-calendar-backend",
 		},
 	}
 
+	if currentJWTKey != nil {
+		token := jwt.NewWithClaims(currentJWTKey.method, claims)
+		token.Header["kid"] = currentJWTKey.kid
+		return token.SignedString(currentJWTKey.private)
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(JWTSecret)
 }
+
+// ParseFamilyCalendarJWT verifies an access token and returns its claims
+func ParseFamilyCalendarJWT(tokenString string) (*FamilyCalendarClaims, error) {
+	claims := &FamilyCalendarClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, verificationKey,
+		jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"}),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
@@ -28,7 +28,7 @@ func TestGenerateFamilyCalendarJWT(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			token, err := GenerateFamilyCalendarJWT(tt.userID)
+			token, err := GenerateFamilyCalendarJWT(tt.userID, 7)
 
 			assert.NoError(t, err)
 			assert.NotEmpty(t, token)
@@ -45,12 +45,14 @@ func TestGenerateFamilyCalendarJWT(t *testing.T) {
 			claims, ok := parsedToken.Claims.(*FamilyCalendarClaims)
 			assert.True(t, ok)
 			assert.Equal(t, tt.userID, claims.UserID)
+			assert.Equal(t, uint(7), claims.SessionID)
+			assert.Len(t, claims.ID, 32)
 			assert.Equal(t, "family-calendar-backend", claims.Issuer)
 			assert.NotNil(t, claims.ExpiresAt)
 			assert.NotNil(t, claims.IssuedAt)
 
-			// Check expiration is approximately 24 hours from now
-			expectedExpiry := time.Now().Add(24 * time.Hour)
+			// Check expiration is approximately one access token lifetime from now
+			expectedExpiry := time.Now().Add(AccessTokenTTL)
 			assert.WithinDuration(t, expectedExpiry, claims.ExpiresAt.Time, 2*time.Second)
 		})
 	}
@@ -86,7 +88,7 @@ func TestFamilyCalendarClaims_InvalidSignature(t *testing.T) {
 	JWTSecret = []byte("test-secret-key")
 
 	// Create token with one secret
-	token, err := GenerateFamilyCalendarJWT(1)
+	token, err := GenerateFamilyCalendarJWT(1, 1)
 	assert.NoError(t, err)
 
 	// Try to parse with different secret
@@ -99,3 +101,22 @@ func TestFamilyCalendarClaims_InvalidSignature(t *testing.T) {
 	assert.NotNil(t, parsedToken)
 	assert.False(t, parsedToken.Valid)
 }
+
+func TestGenerateFamilyCalendarJWT_UniqueTokenIDs(t *testing.T) {
+	JWTSecret = []byte("test-secret-key")
+
+	first, err := GenerateFamilyCalendarJWT(1, 1)
+	assert.NoError(t, err)
+	second, err := GenerateFamilyCalendarJWT(1, 1)
+	assert.NoError(t, err)
+
+	parse := func(token string) *FamilyCalendarClaims {
+		claims := &FamilyCalendarClaims{}
+		_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+			return JWTSecret, nil
+		})
+		assert.NoError(t, err)
+		return claims
+	}
+	assert.NotEqual(t, parse(first).ID, parse(second).ID)
+}
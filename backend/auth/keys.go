@@ -0,0 +1,234 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSAKeyBits is the smallest RSA key access tokens may be signed with
+const minRSAKeyBits = 2048
+
+// jwtKey is an asymmetric key access tokens are signed or verified with. Its key ID is the
+// RFC 7638 thumbprint of the public key.
+type jwtKey struct {
+	kid    string
+	method jwt.SigningMethod
+	public crypto.PublicKey
+	// private is nil for keys that only verify
+	private crypto.Signer
+	// notAfter ends the rotation window of a previous key; zero means it has none
+	notAfter time.Time
+}
+
+var (
+	// currentJWTKey signs new access tokens. Without one, tokens are signed with JWTSecret.
+	currentJWTKey *jwtKey
+	// previousJWTKey still verifies access tokens signed before the last rotation
+	previousJWTKey *jwtKey
+	// jwtSecretUntil ends the window in which JWTSecret still verifies HMAC tokens once an
+	// asymmetric key signs them; zero means it verifies none
+	jwtSecretUntil time.Time
+)
+
+func newJWTKey(public crypto.PublicKey, private crypto.Signer) (*jwtKey, error) {
+	var method jwt.SigningMethod
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA keys must have at least %d bits", minRSAKeyBits)
+		}
+		method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T: use RSA or Ed25519", public)
+	}
+
+	jwk, err := NewJWK(public)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := jwk.Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+	return &jwtKey{kid: kid, method: method, public: public, private: private}, nil
+}
+
+// jwk returns the public key as published in the key set
+func (k *jwtKey) jwk() JWK {
+	jwk, _ := NewJWK(k.public)
+	jwk.Kid = k.kid
+	jwk.Use = "sig"
+	jwk.Alg = k.method.Alg()
+	return jwk
+}
+
+// usable reports whether the key may still verify tokens
+func (k *jwtKey) usable(now time.Time) bool {
+	return k.notAfter.IsZero() || now.Before(k.notAfter)
+}
+
+// parsePrivateKeyPEM decodes an RSA or Ed25519 private key in PKCS #8 or PKCS #1 PEM
+func parsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+// parsePublicKeyPEM decodes a public key, or the public half of a private key, from PEM
+func parsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		private, err := parsePrivateKeyPEM(data)
+		if err != nil {
+			return nil, err
+		}
+		return private.Public(), nil
+	}
+}
+
+// pemFromEnv reads a PEM document from an environment variable, or from the file named by the
+// same variable with a _FILE suffix. It returns nil when neither is set.
+func pemFromEnv(name string) ([]byte, error) {
+	if value := os.Getenv(name); value != "" {
+		return []byte(value), nil
+	}
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s_FILE: %w", name, err)
+		}
+		return data, nil
+	}
+	return nil, nil
+}
+
+// loadJWTKeys configures asymmetric signing from JWT_PRIVATE_KEY, and the key it replaced from
+// JWT_PREVIOUS_KEY, optionally accepted only until JWT_PREVIOUS_KEY_UNTIL
+func loadJWTKeys() error {
+	currentJWTKey, previousJWTKey = nil, nil
+
+	data, err := pemFromEnv("JWT_PRIVATE_KEY")
+	if err != nil || data == nil {
+		return err
+	}
+	private, err := parsePrivateKeyPEM(data)
+	if err != nil {
+		return fmt.Errorf("invalid JWT_PRIVATE_KEY: %w", err)
+	}
+	current, err := newJWTKey(private.Public(), private)
+	if err != nil {
+		return fmt.Errorf("invalid JWT_PRIVATE_KEY: %w", err)
+	}
+
+	data, err = pemFromEnv("JWT_PREVIOUS_KEY")
+	if err != nil {
+		return err
+	}
+	var previous *jwtKey
+	if data != nil {
+		public, err := parsePublicKeyPEM(data)
+		if err != nil {
+			return fmt.Errorf("invalid JWT_PREVIOUS_KEY: %w", err)
+		}
+		previous, err = newJWTKey(public, nil)
+		if err != nil {
+			return fmt.Errorf("invalid JWT_PREVIOUS_KEY: %w", err)
+		}
+		if until := os.Getenv("JWT_PREVIOUS_KEY_UNTIL"); until != "" {
+			previous.notAfter, err = time.Parse(time.RFC3339, until)
+			if err != nil {
+				return fmt.Errorf("invalid JWT_PREVIOUS_KEY_UNTIL: %w", err)
+			}
+		}
+		if previous.kid == current.kid {
+			previous = nil
+		}
+	}
+
+	currentJWTKey, previousJWTKey = current, previous
+	return nil
+}
+
+// hmacAccepted reports whether JWTSecret may verify an access token: always while it signs
+// them, and after the move to an asymmetric key only until JWT_SECRET_UNTIL
+func hmacAccepted(now time.Time) bool {
+	if len(JWTSecret) == 0 {
+		return false
+	}
+	return currentJWTKey == nil || now.Before(jwtSecretUntil)
+}
+
+// verificationKey returns the key that verifies an access token, by its kid header
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if !hmacAccepted(time.Now()) {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return JWTSecret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	for _, key := range []*jwtKey{currentJWTKey, previousJWTKey} {
+		if key == nil || key.kid != kid || !key.usable(time.Now()) {
+			continue
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return key.public, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// JWKSHandler publishes the public keys access tokens are signed with, so other services can
+// verify them. The set is empty while tokens are signed with JWT_SECRET.
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range []*jwtKey{currentJWTKey, previousJWTKey} {
+		if key != nil && key.usable(time.Now()) {
+			set.Keys = append(set.Keys, key.jwk())
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(set)
+}
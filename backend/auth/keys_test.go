@@ -0,0 +1,298 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useJWTKeys replaces the signing keys for the duration of a test
+func useJWTKeys(t *testing.T, current, previous *jwtKey) {
+	originalCurrent, originalPrevious, originalUntil := currentJWTKey, previousJWTKey, jwtSecretUntil
+	t.Cleanup(func() {
+		currentJWTKey, previousJWTKey, jwtSecretUntil = originalCurrent, originalPrevious, originalUntil
+	})
+	currentJWTKey, previousJWTKey = current, previous
+}
+
+func newTestJWTKey(t *testing.T, private crypto.Signer) *jwtKey {
+	key, err := newJWTKey(private.Public(), private)
+	require.NoError(t, err)
+	return key
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return key
+}
+
+func newEd25519Key(t *testing.T) ed25519.PrivateKey {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return key
+}
+
+func privateKeyPEM(t *testing.T, key crypto.Signer) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func publicKeyPEM(t *testing.T, key crypto.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func TestLoadJWTKeys(t *testing.T) {
+	useJWTKeys(t, nil, nil)
+	current := newEd25519Key(t)
+	previous := newRSAKey(t)
+	path := filepath.Join(t.TempDir(), "jwt.pem")
+	require.NoError(t, os.WriteFile(path, []byte(privateKeyPEM(t, current)), 0600))
+	t.Setenv("JWT_PRIVATE_KEY_FILE", path)
+	t.Setenv("JWT_PREVIOUS_KEY", publicKeyPEM(t, &previous.PublicKey))
+	t.Setenv("JWT_PREVIOUS_KEY_UNTIL", "2030-01-02T15:04:05Z")
+
+	require.NoError(t, loadJWTKeys())
+
+	require.NotNil(t, currentJWTKey)
+	assert.Equal(t, jwt.SigningMethodEdDSA, currentJWTKey.method)
+	assert.True(t, current.Public().(ed25519.PublicKey).Equal(currentJWTKey.public))
+	require.NotNil(t, previousJWTKey)
+	assert.Equal(t, jwt.SigningMethodRS256, previousJWTKey.method)
+	assert.Nil(t, previousJWTKey.private)
+	assert.Equal(t, time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC), previousJWTKey.notAfter)
+	assert.NotEqual(t, currentJWTKey.kid, previousJWTKey.kid)
+}
+
+func TestLoadJWTKeys_NotConfigured(t *testing.T) {
+	useJWTKeys(t, newTestJWTKey(t, newEd25519Key(t)), nil)
+
+	require.NoError(t, loadJWTKeys())
+
+	assert.Nil(t, currentJWTKey)
+	assert.Nil(t, previousJWTKey)
+}
+
+func TestLoadJWTKeys_Invalid(t *testing.T) {
+	smallKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	valid := privateKeyPEM(t, newEd25519Key(t))
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		contains string
+	}{
+		{"not PEM", map[string]string{"JWT_PRIVATE_KEY": "secret"}, "invalid JWT_PRIVATE_KEY"},
+		{"public key", map[string]string{"JWT_PRIVATE_KEY": publicKeyPEM(t, newEd25519Key(t).Public())}, "invalid JWT_PRIVATE_KEY"},
+		{"small RSA key", map[string]string{"JWT_PRIVATE_KEY": privateKeyPEM(t, smallKey)}, "at least 2048 bits"},
+		{"missing file", map[string]string{"JWT_PRIVATE_KEY_FILE": "/nonexistent/jwt.pem"}, "JWT_PRIVATE_KEY_FILE"},
+		{"bad previous key", map[string]string{"JWT_PRIVATE_KEY": valid, "JWT_PREVIOUS_KEY": "secret"}, "invalid JWT_PREVIOUS_KEY"},
+		{"bad rotation window", map[string]string{"JWT_PRIVATE_KEY": valid, "JWT_PREVIOUS_KEY": publicKeyPEM(t, newEd25519Key(t).Public()), "JWT_PREVIOUS_KEY_UNTIL": "tomorrow"}, "JWT_PREVIOUS_KEY_UNTIL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useJWTKeys(t, nil, nil)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			assert.ErrorContains(t, loadJWTKeys(), tt.contains)
+		})
+	}
+}
+
+func TestGenerateFamilyCalendarJWT_AsymmetricKeys(t *testing.T) {
+	for name, private := range map[string]crypto.Signer{"RS256": newRSAKey(t), "EdDSA": newEd25519Key(t)} {
+		t.Run(name, func(t *testing.T) {
+			key := newTestJWTKey(t, private)
+			useJWTKeys(t, key, nil)
+
+			tokenString, err := GenerateFamilyCalendarJWT(123, 5)
+			require.NoError(t, err)
+
+			token, _, err := jwt.NewParser().ParseUnverified(tokenString, &FamilyCalendarClaims{})
+			require.NoError(t, err)
+			assert.Equal(t, name, token.Method.Alg())
+			assert.Equal(t, key.kid, token.Header["kid"])
+
+			claims, err := ParseFamilyCalendarJWT(tokenString)
+			require.NoError(t, err)
+			assert.Equal(t, uint(123), claims.UserID)
+			assert.Equal(t, uint(5), claims.SessionID)
+		})
+	}
+}
+
+func TestParseFamilyCalendarJWT_KeyRotation(t *testing.T) {
+	JWTSecret = []byte("test-secret-key")
+	oldKey := newTestJWTKey(t, newRSAKey(t))
+	newKey := newTestJWTKey(t, newEd25519Key(t))
+
+	// Tokens issued before, with the secret and with the old key
+	useJWTKeys(t, nil, nil)
+	hmacToken, err := GenerateFamilyCalendarJWT(1, 1)
+	require.NoError(t, err)
+	useJWTKeys(t, oldKey, nil)
+	oldToken, err := GenerateFamilyCalendarJWT(1, 1)
+	require.NoError(t, err)
+
+	// During the rotation windows both keys verify, and the secret verifies HMAC tokens
+	previous := *oldKey
+	previous.private = nil
+	previous.notAfter = time.Now().Add(time.Hour)
+	useJWTKeys(t, newKey, &previous)
+	jwtSecretUntil = time.Now().Add(time.Hour)
+	newToken, err := GenerateFamilyCalendarJWT(1, 1)
+	require.NoError(t, err)
+
+	for _, token := range []string{hmacToken, oldToken, newToken} {
+		_, err := ParseFamilyCalendarJWT(token)
+		assert.NoError(t, err)
+	}
+
+	// Afterwards only the new key does, even with the secret still set
+	previous.notAfter = time.Now().Add(-time.Second)
+	jwtSecretUntil = time.Now().Add(-time.Second)
+	_, err = ParseFamilyCalendarJWT(oldToken)
+	assert.Error(t, err)
+	_, err = ParseFamilyCalendarJWT(hmacToken)
+	assert.Error(t, err)
+	_, err = ParseFamilyCalendarJWT(newToken)
+	assert.NoError(t, err)
+}
+
+func TestParseFamilyCalendarJWT_SecretNextToKey(t *testing.T) {
+	JWTSecret = []byte("test-secret-key")
+	useJWTKeys(t, nil, nil)
+	hmacToken, err := GenerateFamilyCalendarJWT(1, 1)
+	require.NoError(t, err)
+
+	// Without a window a secret left next to a key verifies nothing
+	useJWTKeys(t, newTestJWTKey(t, newEd25519Key(t)), nil)
+	jwtSecretUntil = time.Time{}
+	_, err = ParseFamilyCalendarJWT(hmacToken)
+	assert.Error(t, err)
+
+	jwtSecretUntil = time.Now().Add(time.Hour)
+	_, err = ParseFamilyCalendarJWT(hmacToken)
+	assert.NoError(t, err)
+}
+
+func TestParseFamilyCalendarJWT_RejectsForeignKeys(t *testing.T) {
+	key := newTestJWTKey(t, newEd25519Key(t))
+	useJWTKeys(t, key, nil)
+	JWTSecret = nil
+	claims := FamilyCalendarClaims{
+		UserID: 1,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+
+	// Signed by an unknown key under a known key ID
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = key.kid
+	forged, err := token.SignedString(newEd25519Key(t))
+	require.NoError(t, err)
+	_, err = ParseFamilyCalendarJWT(forged)
+	assert.Error(t, err)
+
+	// Signed with another algorithm under a known key ID
+	token = jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = key.kid
+	forged, err = token.SignedString(newRSAKey(t))
+	require.NoError(t, err)
+	_, err = ParseFamilyCalendarJWT(forged)
+	assert.Error(t, err)
+
+	// HMAC tokens without a secret
+	forged, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte{})
+	require.NoError(t, err)
+	_, err = ParseFamilyCalendarJWT(forged)
+	assert.Error(t, err)
+}
+
+func TestJWKSHandler(t *testing.T) {
+	current := newTestJWTKey(t, newEd25519Key(t))
+	previous := newTestJWTKey(t, newRSAKey(t))
+	previous.private = nil
+	useJWTKeys(t, current, previous)
+
+	rr := httptest.NewRecorder()
+	JWKSHandler(rr, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.NotContains(t, rr.Body.String(), `"d"`)
+	var set JWKSet
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &set))
+	require.Len(t, set.Keys, 2)
+	for i, key := range []*jwtKey{current, previous} {
+		assert.Equal(t, key.kid, set.Keys[i].Kid)
+		assert.Equal(t, key.method.Alg(), set.Keys[i].Alg)
+		assert.Equal(t, "sig", set.Keys[i].Use)
+		publicKey, err := set.Keys[i].PublicKey()
+		require.NoError(t, err)
+		assert.True(t, publicKey.(interface{ Equal(crypto.PublicKey) bool }).Equal(key.public))
+	}
+
+	// A previous key past its rotation window is no longer published
+	previous.notAfter = time.Now().Add(-time.Second)
+	rr = httptest.NewRecorder()
+	JWKSHandler(rr, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &set))
+	assert.Len(t, set.Keys, 1)
+
+	// Nothing is published while tokens are signed with JWT_SECRET
+	useJWTKeys(t, nil, nil)
+	rr = httptest.NewRecorder()
+	JWKSHandler(rr, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	assert.JSONEq(t, `{"keys": []}`, rr.Body.String())
+}
+
+func TestInitAuthConfig_PrivateKeyWithoutSecret(t *testing.T) {
+	useJWTKeys(t, nil, nil)
+	useProviders(t)
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("JWT_PRIVATE_KEY", privateKeyPEM(t, newEd25519Key(t)))
+
+	require.NoError(t, InitAuthConfig())
+
+	assert.NotNil(t, currentJWTKey)
+	assert.Empty(t, JWTSecret)
+}
+
+func TestInitAuthConfig_SecretUntil(t *testing.T) {
+	useJWTKeys(t, nil, nil)
+	useProviders(t)
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("JWT_PRIVATE_KEY", privateKeyPEM(t, newEd25519Key(t)))
+	t.Setenv("JWT_SECRET_UNTIL", "2027-01-01T00:00:00Z")
+
+	require.NoError(t, InitAuthConfig())
+	assert.Equal(t, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), jwtSecretUntil.UTC())
+
+	t.Setenv("JWT_SECRET_UNTIL", "next year")
+	err := InitAuthConfig()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "JWT_SECRET_UNTIL")
+}
@@ -2,64 +2,165 @@ package auth
 
 import (
 	"context"
+	"errors"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
-	"github.com/golang-jwt/jwt/v5"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/services"
 )
 
 // ContextKey is a custom type for context keys to avoid collisions
 type ContextKey string
 
-const UserIDContextKey ContextKey = "user_id"
+const (
+	UserIDContextKey    ContextKey = "user_id"
+	SessionIDContextKey ContextKey = "session_id"
+	ScopesContextKey    ContextKey = "scopes"
+)
+
+// tokenFromRequest returns the bearer token of a request, or in cookie mode the access token
+// cookie, which must come with a CSRF token unless the request only reads
+func tokenFromRequest(w http.ResponseWriter, r *http.Request) (string, bool) {
+	// Get the Authorization header
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		if cookie, err := r.Cookie(accessTokenCookie); err == nil && CallbackMode == CallbackModeCookie {
+			if !safeMethod(r.Method) && !csrfTokenValid(r) {
+				http.Error(w, "Missing or invalid CSRF token", http.StatusForbidden)
+				return "", false
+			}
+			return cookie.Value, true
+		}
+		http.Error(w, "Authorization header required", http.StatusUnauthorized)
+		return "", false
+	}
+
+	// Check if it's a Bearer token
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		http.Error(w, "Invalid authorization header format. Expected: Bearer <token>", http.StatusUnauthorized)
+		return "", false
+	}
+	return parts[1], true
+}
 
-// RequireAuth is a middleware that validates JWT tokens
+// RequireAuth is a middleware that validates JWT tokens and rejects those of revoked sessions.
+// It also accepts personal access tokens, whose scopes RequireScope and RequireSession check.
 func RequireAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Get the Authorization header
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
+		tokenString, ok := tokenFromRequest(w, r)
+		if !ok {
 			return
 		}
 
-		// Check if it's a Bearer token
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, "Invalid authorization header format. Expected: Bearer <token>", http.StatusUnauthorized)
+		if strings.HasPrefix(tokenString, models.PersonalAccessTokenPrefix) {
+			accessToken, err := services.AuthenticatePersonalAccessToken(tokenString, time.Now())
+			if errors.Is(err, services.ErrPersonalAccessTokenInvalid) {
+				http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				log.Printf("Failed to check personal access token: %v", err)
+				http.Error(w, "Failed to check token", http.StatusInternalServerError)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), UserIDContextKey, accessToken.UserID)
+			ctx = context.WithValue(ctx, ScopesContextKey, accessToken.ScopeList())
+			next.ServeHTTP(w, r.WithContext(ctx))
 			return
 		}
 
-		tokenString := parts[1]
-
 		// Parse and validate the token
-		token, err := jwt.ParseWithClaims(tokenString, &FamilyCalendarClaims{}, func(token *jwt.Token) (interface{}, error) {
-			// Verify the signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return JWTSecret, nil
-		})
-
+		claims, err := ParseFamilyCalendarJWT(tokenString)
 		if err != nil {
 			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
 			return
 		}
 
-		// Extract claims and add user ID to context
-		// Note: If ParseWithClaims succeeds, claims are guaranteed to be valid
-		claims := token.Claims.(*FamilyCalendarClaims)
+		active, err := sessionActive(claims, time.Now())
+		if err != nil {
+			log.Printf("Failed to check session: %v", err)
+			http.Error(w, "Failed to check session", http.StatusInternalServerError)
+			return
+		}
+		if !active {
+			http.Error(w, "Session has been revoked", http.StatusUnauthorized)
+			return
+		}
+
 		ctx := context.WithValue(r.Context(), UserIDContextKey, claims.UserID)
+		ctx = context.WithValue(ctx, SessionIDContextKey, claims.SessionID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// RequireScope is a middleware that lets personal access tokens through only when they hold one
+// of the given scopes. Requests made in a sign-in session may do everything.
+func RequireScope(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !HasAnyScope(r.Context(), scopes...) {
+				http.Error(w, "Token lacks the scope this endpoint requires", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession is a middleware that keeps personal access tokens out of endpoints no scope
+// grants, such as managing the tokens themselves
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := GetScopesFromContext(r.Context()); ok {
+			http.Error(w, "Personal access tokens cannot use this endpoint", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HasAnyScope reports whether a request may do what one of the given scopes grants. Requests
+// made in a sign-in session may do everything.
+func HasAnyScope(ctx context.Context, scopes ...string) bool {
+	granted, ok := GetScopesFromContext(ctx)
+	return !ok || hasAnyScope(granted, scopes)
+}
+
+func hasAnyScope(granted, wanted []string) bool {
+	for _, scope := range wanted {
+		for _, g := range granted {
+			if g == scope {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // GetUserIDFromContext extracts the user ID from the request context
 func GetUserIDFromContext(ctx context.Context) (uint, bool) {
 	userID, ok := ctx.Value(UserIDContextKey).(uint)
 	return userID, ok
 }
 
+// GetSessionIDFromContext extracts the ID of the session the request was made in
+func GetSessionIDFromContext(ctx context.Context) (uint, bool) {
+	sessionID, ok := ctx.Value(SessionIDContextKey).(uint)
+	return sessionID, ok
+}
+
+// GetScopesFromContext returns the scopes of the personal access token a request was made with.
+// It reports false for requests made in a sign-in session.
+func GetScopesFromContext(ctx context.Context) ([]string, bool) {
+	scopes, ok := ctx.Value(ScopesContextKey).([]string)
+	return scopes, ok
+}
+
 // SetUserIDInContext adds a user ID to the context (used for testing)
 func SetUserIDInContext(ctx context.Context, userID uint) context.Context {
 	return context.WithValue(ctx, UserIDContextKey, userID)
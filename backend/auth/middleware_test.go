@@ -7,23 +7,30 @@ import (
 	"testing"
 	"time"
 
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/services"
+
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRequireAuth_ValidToken(t *testing.T) {
 	JWTSecret = []byte("test-secret-key")
+	stubSessions(t, &models.Session{ID: 5, UserID: 123, ExpiresAt: time.Now().Add(time.Hour)})
 
 	// Create a valid token
-	token, err := GenerateFamilyCalendarJWT(123)
+	token, err := GenerateFamilyCalendarJWT(123, 5)
 	assert.NoError(t, err)
 
 	// Create test handler
-	var capturedUserID uint
+	var capturedUserID, capturedSessionID uint
 	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userID, ok := GetUserIDFromContext(r.Context())
 		assert.True(t, ok)
 		capturedUserID = userID
+		capturedSessionID, _ = GetSessionIDFromContext(r.Context())
 		w.WriteHeader(http.StatusOK)
 	})
 
@@ -39,6 +46,7 @@ func TestRequireAuth_ValidToken(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Equal(t, uint(123), capturedUserID)
+	assert.Equal(t, uint(5), capturedSessionID)
 }
 
 func TestRequireAuth_MissingAuthHeader(t *testing.T) {
@@ -194,6 +202,92 @@ func TestRequireAuth_WrongSigningMethod(t *testing.T) {
 	assert.Equal(t, http.StatusUnauthorized, rr.Code)
 }
 
+func TestRequireAuth_PersonalAccessToken(t *testing.T) {
+	setupAuthTestDB(t)
+	user := models.User{GivenName: "Test", FamilyName: "User", Email: "test@example.com"}
+	require.NoError(t, db.DB.Create(&user).Error)
+	accessToken, token, err := services.CreatePersonalAccessToken(user.ID, "Kitchen display", []string{models.ScopeEventsRead}, nil)
+	require.NoError(t, err)
+
+	var capturedUserID uint
+	var capturedScopes []string
+	handler := RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		capturedUserID, _ = GetUserIDFromContext(r.Context())
+		capturedScopes, _ = GetScopesFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/api/calendar-mux", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, user.ID, capturedUserID)
+	assert.Equal(t, []string{models.ScopeEventsRead}, capturedScopes)
+	require.NoError(t, db.DB.First(accessToken, accessToken.ID).Error)
+	assert.NotNil(t, accessToken.LastUsedAt)
+
+	// Deleted tokens stop working at once
+	require.NoError(t, services.DeletePersonalAccessToken(accessToken.ID, user.ID))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestRequireScope(t *testing.T) {
+	handler := RequireScope(models.ScopeEventsRead, models.ScopeMuxesManage)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		scopes []string
+		status int
+	}{
+		{"session", nil, http.StatusOK},
+		{"one of the scopes", []string{models.ScopeMuxesManage}, http.StatusOK},
+		{"no matching scope", []string{"other:scope"}, http.StatusForbidden},
+		{"no scopes", []string{}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/calendar-mux", nil)
+			if tt.scopes != nil {
+				req = req.WithContext(context.WithValue(req.Context(), ScopesContextKey, tt.scopes))
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			assert.Equal(t, tt.status, rr.Code)
+		})
+	}
+}
+
+func TestHasAnyScope(t *testing.T) {
+	assert.True(t, HasAnyScope(context.Background(), models.ScopeMuxesManage))
+
+	ctx := context.WithValue(context.Background(), ScopesContextKey, []string{models.ScopeEventsRead})
+	assert.True(t, HasAnyScope(ctx, models.ScopeEventsRead, models.ScopeMuxesManage))
+	assert.False(t, HasAnyScope(ctx, models.ScopeMuxesManage))
+}
+
+func TestRequireSession(t *testing.T) {
+	handler := RequireSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/tokens", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	req := httptest.NewRequest("GET", "/api/tokens", nil)
+	req = req.WithContext(context.WithValue(req.Context(), ScopesContextKey, []string{models.ScopeMuxesManage}))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
 func TestGetUserIDFromContext(t *testing.T) {
 	tests := []struct {
 		name          string
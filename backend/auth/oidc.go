@@ -0,0 +1,304 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// jwksRefreshInterval limits how often an unknown key ID makes a provider's keys be fetched again
+const jwksRefreshInterval = time.Minute
+
+// oidcHTTPClient fetches discovery documents, keys and user info
+var oidcHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// idTokenAlgorithms are the signing algorithms accepted on ID tokens
+var idTokenAlgorithms = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// OIDCProviderConfig configures a generic OpenID Connect provider
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// oidcDiscovery is the part of an issuer's openid-configuration document we use
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// claimBool is a boolean claim, which some providers send as the string "true" or "false"
+type claimBool bool
+
+func (b *claimBool) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case bool:
+		*b = claimBool(v)
+	case string:
+		*b = claimBool(v == "true")
+	default:
+		*b = false
+	}
+	return nil
+}
+
+type idTokenClaims struct {
+	Nonce         string    `json:"nonce"`
+	Email         string    `json:"email"`
+	EmailVerified claimBool `json:"email_verified"`
+	Name          string    `json:"name"`
+	GivenName     string    `json:"given_name"`
+	FamilyName    string    `json:"family_name"`
+	jwt.RegisteredClaims
+}
+
+type oidcUserInfo struct {
+	Sub           string    `json:"sub"`
+	Email         string    `json:"email"`
+	EmailVerified claimBool `json:"email_verified"`
+	Name          string    `json:"name"`
+	GivenName     string    `json:"given_name"`
+	FamilyName    string    `json:"family_name"`
+}
+
+// oidcProvider signs users in with any OpenID Connect issuer. Users are identified by the
+// verified ID token; the userinfo endpoint only fills in profile fields the token lacks.
+type oidcProvider struct {
+	name             string
+	issuer           string
+	oauth            *oauth2.Config
+	userinfoEndpoint string
+	jwksURI          string
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// getJSON fetches a JSON document into v
+func getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	return doJSON(req, v)
+}
+
+func doJSON(req *http.Request, v interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %s", req.URL, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// NewOIDCProvider configures a provider from its issuer's discovery document
+func NewOIDCProvider(ctx context.Context, config OIDCProviderConfig) (Provider, error) {
+	issuer := strings.TrimSuffix(config.Issuer, "/")
+	var discovery oidcDiscovery
+	if err := getJSON(ctx, issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider %s: %w", config.Name, err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("OIDC provider %s reports issuer %q instead of %q", config.Name, discovery.Issuer, config.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC provider %s is missing endpoints in its discovery document", config.Name)
+	}
+
+	scopes := config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	return &oidcProvider{
+		name:   config.Name,
+		issuer: discovery.Issuer,
+		oauth: &oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Scopes:       scopes,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  discovery.AuthorizationEndpoint,
+				TokenURL: discovery.TokenEndpoint,
+			},
+		},
+		userinfoEndpoint: discovery.UserinfoEndpoint,
+		jwksURI:          discovery.JWKSURI,
+	}, nil
+}
+
+func (p *oidcProvider) Name() string {
+	return p.name
+}
+
+func (p *oidcProvider) AuthCodeURL(state, nonce string) string {
+	return p.oauth.AuthCodeURL(state, oauth2.SetAuthURLParam("nonce", nonce))
+}
+
+func (p *oidcProvider) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	return p.oauth.Exchange(ctx, code)
+}
+
+// fetchKeys replaces the cached signing keys with the provider's current ones
+func (p *oidcProvider) fetchKeys(ctx context.Context) error {
+	var set JWKSet
+	if err := getJSON(ctx, p.jwksURI, &set); err != nil {
+		return err
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			// Skip key types we cannot use rather than rejecting the whole set
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	p.keys = keys
+	p.fetchedAt = time.Now()
+	return nil
+}
+
+// signingKey returns the key an ID token names. Keys are fetched again when the name is unknown,
+// as the provider may have rotated them.
+func (p *oidcProvider) signingKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	lookup := func() (crypto.PublicKey, bool) {
+		if key, ok := p.keys[kid]; ok {
+			return key, true
+		}
+		// A token without a key ID can only mean the provider's single key
+		if kid == "" && len(p.keys) == 1 {
+			for _, key := range p.keys {
+				return key, true
+			}
+		}
+		return nil, false
+	}
+
+	if key, ok := lookup(); ok {
+		return key, nil
+	}
+	if time.Since(p.fetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if err := p.fetchKeys(ctx); err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+	if key, ok := lookup(); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// verifyIDToken checks the signature, issuer, audience, expiry and nonce of an ID token
+func (p *oidcProvider) verifyIDToken(ctx context.Context, rawIDToken, nonce string) (*idTokenClaims, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.signingKey(ctx, kid)
+	},
+		jwt.WithValidMethods(idTokenAlgorithms),
+		jwt.WithIssuer(p.issuer),
+		jwt.WithAudience(p.oauth.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("ID token nonce does not match")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("ID token has no subject")
+	}
+	return claims, nil
+}
+
+// fetchUserInfo asks the userinfo endpoint about the user an access token belongs to
+func (p *oidcProvider) fetchUserInfo(ctx context.Context, token *oauth2.Token) (*oidcUserInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.userinfoEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	token.SetAuthHeader(req)
+	var userInfo oidcUserInfo
+	if err := doJSON(req, &userInfo); err != nil {
+		return nil, err
+	}
+	return &userInfo, nil
+}
+
+func (p *oidcProvider) Identify(ctx context.Context, token *oauth2.Token, nonce string) (*Identity, error) {
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return nil, errors.New("token response has no ID token")
+	}
+	claims, err := p.verifyIDToken(ctx, rawIDToken, nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	identity := &Identity{
+		Subject:    claims.Subject,
+		GivenName:  claims.GivenName,
+		FamilyName: claims.FamilyName,
+		Email:      verifiedEmail(claims.Email, bool(claims.EmailVerified)),
+	}
+	if identity.GivenName == "" {
+		identity.GivenName = claims.Name
+	}
+
+	// Many providers keep profile claims out of the ID token
+	if (identity.Email == "" || identity.GivenName == "") && p.userinfoEndpoint != "" {
+		userInfo, err := p.fetchUserInfo(ctx, token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch user info: %w", err)
+		}
+		if userInfo.Sub != claims.Subject {
+			return nil, errors.New("user info subject does not match the ID token")
+		}
+		if identity.Email == "" {
+			identity.Email = verifiedEmail(userInfo.Email, bool(userInfo.EmailVerified))
+		}
+		if identity.GivenName == "" {
+			identity.GivenName = userInfo.GivenName
+			identity.FamilyName = userInfo.FamilyName
+			if identity.GivenName == "" {
+				identity.GivenName = userInfo.Name
+			}
+		}
+	}
+	return identity, nil
+}
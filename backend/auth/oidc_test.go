@@ -0,0 +1,299 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// stubOIDCServer is a minimal OpenID Connect provider. It hands out an ID token for user-1 with
+// the nonce it was last told about, signed with its current key.
+type stubOIDCServer struct {
+	*httptest.Server
+	key   *rsa.PrivateKey
+	kid   string
+	nonce string
+	// claims are merged over the default ID token claims
+	claims jwt.MapClaims
+	// userInfo is what the userinfo endpoint answers
+	userInfo oidcUserInfo
+}
+
+func newStubOIDCServer(t *testing.T) *stubOIDCServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	stub := &stubOIDCServer{key: key, kid: "key-1"}
+	stub.userInfo = oidcUserInfo{Sub: "user-1", Email: "user@example.com", EmailVerified: true, GivenName: "Stub", FamilyName: "User"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                stub.URL,
+			AuthorizationEndpoint: stub.URL + "/authorize",
+			TokenEndpoint:         stub.URL + "/token",
+			UserinfoEndpoint:      stub.URL + "/userinfo",
+			JWKSURI:               stub.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(JWKSet{Keys: []JWK{{
+			Kty: "RSA",
+			Kid: stub.kid,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(stub.key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(stub.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good-code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "stub-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     stub.idToken(t),
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer stub-access-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(stub.userInfo)
+	})
+	stub.Server = httptest.NewServer(mux)
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+func (s *stubOIDCServer) idToken(t *testing.T) string {
+	claims := jwt.MapClaims{
+		"iss":   s.URL,
+		"sub":   "user-1",
+		"aud":   "stub-client",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": s.nonce,
+	}
+	for name, value := range s.claims {
+		claims[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.kid
+	signed, err := token.SignedString(s.key)
+	require.NoError(t, err)
+	return signed
+}
+
+func newStubProvider(t *testing.T, stub *stubOIDCServer) *oidcProvider {
+	provider, err := NewOIDCProvider(context.Background(), OIDCProviderConfig{
+		Name:        "stub",
+		Issuer:      stub.URL,
+		ClientID:    "stub-client",
+		RedirectURL: "http://localhost:8080/auth/stub/callback",
+	})
+	require.NoError(t, err)
+	return provider.(*oidcProvider)
+}
+
+func TestOIDCProvider_SignIn(t *testing.T) {
+	stub := newStubOIDCServer(t)
+	setupAuthTests()
+	t.Setenv("OIDC_PROVIDERS", "stub")
+	t.Setenv("OIDC_STUB_ISSUER", stub.URL)
+	t.Setenv("OIDC_STUB_CLIENT_ID", "stub-client")
+	t.Setenv("OIDC_STUB_CLIENT_SECRET", "stub-secret")
+	t.Setenv("OIDC_STUB_REDIRECT_URL", "http://localhost:8080/auth/stub/callback")
+	useProviders(t)
+	require.NoError(t, InitAuthConfig())
+	setupAuthTestDB(t)
+	assert.Equal(t, []string{"google", "stub"}, ProviderNames())
+
+	// Signing in starts at the provider's authorization endpoint
+	req := httptest.NewRequest("GET", "/auth/stub?callback=http://localhost:3000/auth/callback"+testPKCEParams, nil)
+	rr := httptest.NewRecorder()
+	LoginHandler(rr, withProvider(req, "stub"))
+
+	require.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	location, err := url.Parse(rr.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, stub.URL+"/authorize", location.Scheme+"://"+location.Host+location.Path)
+	assert.Equal(t, "stub-client", location.Query().Get("client_id"))
+	assert.Equal(t, "openid email profile", location.Query().Get("scope"))
+	state := location.Query().Get("state")
+	stub.nonce = location.Query().Get("nonce")
+	assert.Equal(t, nonceForState(state), stub.nonce)
+
+	// The provider redirects back with a code
+	req = httptest.NewRequest("GET", "/auth/stub/callback?state="+url.QueryEscape(state)+"&code=good-code", nil)
+	for _, cookie := range rr.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	rr = httptest.NewRecorder()
+	CallbackHandler(rr, withProvider(req, "stub"))
+
+	require.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	assert.Contains(t, rr.Header().Get("Location"), "http://localhost:3000/auth/callback?code=")
+
+	// The user is keyed by provider and subject, with the profile from the userinfo endpoint
+	var identity models.UserIdentity
+	require.NoError(t, db.DB.Preload("User").Where("provider = ? AND subject = ?", "stub", "user-1").First(&identity).Error)
+	user := identity.User
+	assert.Equal(t, "user@example.com", user.Email)
+	assert.Equal(t, "Stub", user.GivenName)
+	assert.Equal(t, "User", user.FamilyName)
+}
+
+func TestOIDCProvider_ExchangeFails(t *testing.T) {
+	stub := newStubOIDCServer(t)
+	provider := newStubProvider(t, stub)
+
+	_, err := provider.Exchange(context.Background(), "bad-code")
+	assert.Error(t, err)
+}
+
+func TestOIDCProvider_Identify_UsesIDTokenClaims(t *testing.T) {
+	stub := newStubOIDCServer(t)
+	stub.nonce = "nonce"
+	stub.claims = jwt.MapClaims{"email": "token@example.com", "email_verified": true, "name": "Token User"}
+	provider := newStubProvider(t, stub)
+
+	token, err := provider.Exchange(context.Background(), "good-code")
+	require.NoError(t, err)
+	identity, err := provider.Identify(context.Background(), token, "nonce")
+
+	require.NoError(t, err)
+	assert.Equal(t, &Identity{Subject: "user-1", GivenName: "Token User", Email: "token@example.com"}, identity)
+}
+
+func TestOIDCProvider_Identify_LeavesOutUnverifiedEmails(t *testing.T) {
+	stub := newStubOIDCServer(t)
+	stub.nonce = "nonce"
+	stub.claims = jwt.MapClaims{"email": "someone-else@example.com", "name": "Token User"}
+	stub.userInfo.Email = "someone-else@example.com"
+	stub.userInfo.EmailVerified = false
+	provider := newStubProvider(t, stub)
+
+	token, err := provider.Exchange(context.Background(), "good-code")
+	require.NoError(t, err)
+	identity, err := provider.Identify(context.Background(), token, "nonce")
+	require.NoError(t, err)
+	assert.Empty(t, identity.Email)
+
+	// Some providers send the claim as a string
+	stub.claims = jwt.MapClaims{"email": "token@example.com", "email_verified": "true", "name": "Token User"}
+	token, err = provider.Exchange(context.Background(), "good-code")
+	require.NoError(t, err)
+	identity, err = provider.Identify(context.Background(), token, "nonce")
+	require.NoError(t, err)
+	assert.Equal(t, "token@example.com", identity.Email)
+}
+
+func TestOIDCProvider_Identify_RejectsInvalidIDTokens(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		modify func(stub *stubOIDCServer)
+	}{
+		{"wrong nonce", func(stub *stubOIDCServer) { stub.nonce = "other-nonce" }},
+		{"wrong audience", func(stub *stubOIDCServer) { stub.claims = jwt.MapClaims{"aud": "other-client"} }},
+		{"wrong issuer", func(stub *stubOIDCServer) { stub.claims = jwt.MapClaims{"iss": "https://evil.example.com"} }},
+		{"expired", func(stub *stubOIDCServer) { stub.claims = jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()} }},
+		{"missing subject", func(stub *stubOIDCServer) { stub.claims = jwt.MapClaims{"sub": ""} }},
+		{"unknown key", func(stub *stubOIDCServer) { stub.key = otherKey; stub.kid = "key-2" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newStubOIDCServer(t)
+			stub.nonce = "nonce"
+			provider := newStubProvider(t, stub)
+			require.NoError(t, provider.fetchKeys(context.Background()))
+			tt.modify(stub)
+
+			token, err := provider.Exchange(context.Background(), "good-code")
+			require.NoError(t, err)
+			_, err = provider.Identify(context.Background(), token, "nonce")
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestOIDCProvider_Identify_MissingIDToken(t *testing.T) {
+	stub := newStubOIDCServer(t)
+	provider := newStubProvider(t, stub)
+
+	_, err := provider.Identify(context.Background(), &oauth2.Token{AccessToken: "stub-access-token"}, "nonce")
+	assert.ErrorContains(t, err, "no ID token")
+}
+
+func TestOIDCProvider_KeyRotation(t *testing.T) {
+	stub := newStubOIDCServer(t)
+	stub.nonce = "nonce"
+	provider := newStubProvider(t, stub)
+	identify := func() error {
+		token, err := provider.Exchange(context.Background(), "good-code")
+		require.NoError(t, err)
+		_, err = provider.Identify(context.Background(), token, "nonce")
+		return err
+	}
+	require.NoError(t, identify())
+
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	stub.key, stub.kid = newKey, "key-2"
+
+	// Keys were fetched moments ago, so the unknown key is not looked up yet
+	assert.Error(t, identify())
+
+	provider.fetchedAt = time.Now().Add(-jwksRefreshInterval)
+	assert.NoError(t, identify())
+}
+
+func TestNewOIDCProvider_Errors(t *testing.T) {
+	stub := newStubOIDCServer(t)
+
+	_, err := NewOIDCProvider(context.Background(), OIDCProviderConfig{Name: "stub", Issuer: stub.URL + "/other"})
+	assert.Error(t, err)
+
+	// The discovery document must name the configured issuer
+	mismatched := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{Issuer: stub.URL})
+	}))
+	defer mismatched.Close()
+	_, err = NewOIDCProvider(context.Background(), OIDCProviderConfig{Name: "stub", Issuer: mismatched.URL})
+	assert.ErrorContains(t, err, "reports issuer")
+}
+
+func TestInitAuthConfig_InvalidOIDCProviders(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	useProviders(t)
+
+	t.Setenv("OIDC_PROVIDERS", "Bad_Name")
+	assert.ErrorContains(t, InitAuthConfig(), "invalid OIDC provider name")
+
+	t.Setenv("OIDC_PROVIDERS", "microsoft")
+	assert.ErrorContains(t, InitAuthConfig(), "OIDC_MICROSOFT_ISSUER")
+}
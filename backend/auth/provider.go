@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"sort"
+
+	"golang.org/x/oauth2"
+)
+
+// Identity is what a provider tells us about the user who signed in
+type Identity struct {
+	// Subject is the provider's stable, unique ID for the user
+	Subject    string
+	GivenName  string
+	FamilyName string
+	// Email is set only when the provider has verified it, since households find their members
+	// by email address
+	Email string
+}
+
+// verifiedEmail returns an email address a provider has verified, and "" for any other
+func verifiedEmail(email string, verified bool) string {
+	if !verified {
+		return ""
+	}
+	return email
+}
+
+// Provider is an identity provider users can sign in with
+type Provider interface {
+	// Name identifies the provider in /auth/{provider} and on user accounts
+	Name() string
+	// AuthCodeURL is the consent page users are sent to. The state comes back on the callback;
+	// providers that issue ID tokens must also carry the nonce into them.
+	AuthCodeURL(state, nonce string) string
+	// Exchange trades the authorization code from the callback for tokens
+	Exchange(ctx context.Context, code string) (*oauth2.Token, error)
+	// Identify returns the signed-in user. The nonce is the one passed to AuthCodeURL.
+	Identify(ctx context.Context, token *oauth2.Token, nonce string) (*Identity, error)
+}
+
+// providers is the registry of configured providers, filled by InitAuthConfig
+var providers = map[string]Provider{}
+
+// RegisterProvider makes a provider available at /auth/{name}, replacing one of the same name
+func RegisterProvider(provider Provider) {
+	providers[provider.Name()] = provider
+}
+
+// GetProvider looks up a configured provider by name
+func GetProvider(name string) (Provider, bool) {
+	provider, ok := providers[name]
+	return provider, ok
+}
+
+// ProviderNames lists the configured providers in alphabetical order
+func ProviderNames() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// nonceForState derives the nonce of a sign-in from its state, so it needs no cookie of its own
+func nonceForState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// googleProvider signs users in with Google through GoogleOAuthConfig
+type googleProvider struct{}
+
+func (googleProvider) Name() string {
+	return "google"
+}
+
+func (googleProvider) AuthCodeURL(state, nonce string) string {
+	return GoogleOAuthConfig.AuthCodeURL(state)
+}
+
+func (googleProvider) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	return exchangeToken(ctx, code)
+}
+
+func (googleProvider) Identify(ctx context.Context, token *oauth2.Token, nonce string) (*Identity, error) {
+	userInfo, err := getUserInfo(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{
+		// Works with both the v2 and v3 API
+		Subject:    userInfo.GetUserID(),
+		GivenName:  userInfo.GivenName,
+		FamilyName: userInfo.FamilyName,
+		Email:      verifiedEmail(userInfo.Email, userInfo.VerifiedEmail),
+	}, nil
+}
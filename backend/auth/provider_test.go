@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+// withProvider routes a request as if it came in on /auth/{provider}
+func withProvider(req *http.Request, name string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("provider", name)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+// useProviders replaces the registry for the duration of a test
+func useProviders(t *testing.T, registered ...Provider) {
+	original := providers
+	t.Cleanup(func() { providers = original })
+	providers = map[string]Provider{}
+	for _, provider := range registered {
+		RegisterProvider(provider)
+	}
+}
+
+func TestProviderRegistry(t *testing.T) {
+	useProviders(t, googleProvider{})
+
+	provider, ok := GetProvider("google")
+	assert.True(t, ok)
+	assert.Equal(t, "google", provider.Name())
+
+	_, ok = GetProvider("microsoft")
+	assert.False(t, ok)
+
+	assert.Equal(t, []string{"google"}, ProviderNames())
+}
+
+func TestLoginHandler_UnknownProvider(t *testing.T) {
+	useProviders(t, googleProvider{})
+
+	req := httptest.NewRequest("GET", "/auth/microsoft", nil)
+	rr := httptest.NewRecorder()
+	LoginHandler(rr, withProvider(req, "microsoft"))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Unknown identity provider")
+
+	rr = httptest.NewRecorder()
+	CallbackHandler(rr, withProvider(httptest.NewRequest("GET", "/auth/microsoft/callback", nil), "microsoft"))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestNonceForState(t *testing.T) {
+	assert.Equal(t, nonceForState("state"), nonceForState("state"))
+	assert.NotEqual(t, nonceForState("state"), nonceForState("other"))
+	assert.NotContains(t, nonceForState("state"), "state")
+}
+
+func TestGoogleProvider_Identify(t *testing.T) {
+	originalGetUserInfo := getUserInfo
+	defer func() { getUserInfo = originalGetUserInfo }()
+	getUserInfo = func(ctx context.Context, token *oauth2.Token) (*GoogleUserInfo, error) {
+		return &GoogleUserInfo{Sub: "google-sub-456", GivenName: "Test", FamilyName: "User", Email: "test@example.com", VerifiedEmail: true}, nil
+	}
+
+	identity, err := googleProvider{}.Identify(context.Background(), &oauth2.Token{}, "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, &Identity{Subject: "google-sub-456", GivenName: "Test", FamilyName: "User", Email: "test@example.com"}, identity)
+
+	// Unverified addresses are left out
+	getUserInfo = func(ctx context.Context, token *oauth2.Token) (*GoogleUserInfo, error) {
+		return &GoogleUserInfo{Sub: "google-sub-456", GivenName: "Test", FamilyName: "User", Email: "test@example.com"}, nil
+	}
+	identity, err = googleProvider{}.Identify(context.Background(), &oauth2.Token{}, "")
+	assert.NoError(t, err)
+	assert.Empty(t, identity.Email)
+}
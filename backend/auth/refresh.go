@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"family-calendar-backend/db/services"
+)
+
+// TokenResponse is the token pair handed to clients after signing in and on every refresh
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	// ExpiresIn is the lifetime of the access token in seconds
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// newTokenResponse wraps a fresh access token for a session together with a refresh token
+func newTokenResponse(userID, sessionID uint, refreshToken string) (TokenResponse, error) {
+	accessToken, err := GenerateFamilyCalendarJWT(userID, sessionID)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	return TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(AccessTokenTTL / time.Second),
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// clientIP returns the address a request came from, without its port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// issueTokens starts a new session for a user who just signed in
+func issueTokens(userID uint, r *http.Request) (TokenResponse, error) {
+	now := time.Now()
+	session, refreshToken, err := services.CreateSession(userID, r.UserAgent(), clientIP(r), now, now.Add(RefreshTokenTTL))
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	return newTokenResponse(userID, session.ID, refreshToken)
+}
+
+type tokenRequest struct {
+	Code         string `json:"code"`
+	CodeVerifier string `json:"code_verifier"`
+	RedirectURI  string `json:"redirect_uri"`
+}
+
+// writeTokenResponse sends a token pair as JSON; responses with tokens must not be cached
+func writeTokenResponse(w http.ResponseWriter, tokens TokenResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// decodeRefreshTokenRequest reads the refresh token from the refresh cookie in cookie mode, or
+// from a JSON request body. fromCookie tells whether the response should use cookies too.
+func decodeRefreshTokenRequest(w http.ResponseWriter, r *http.Request) (refreshToken string, fromCookie bool, ok bool) {
+	if cookie, err := r.Cookie(refreshTokenCookie); err == nil && CallbackMode == CallbackModeCookie {
+		if !csrfTokenValid(r) {
+			http.Error(w, "Missing or invalid CSRF token", http.StatusForbidden)
+			return "", false, false
+		}
+		return cookie.Value, true, true
+	}
+
+	var req refreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return "", false, false
+	}
+	return req.RefreshToken, false, true
+}
+
+// TokenHandler exchanges the one-time code the sign-in callback received for an access token and
+// a refresh token. The code is only accepted with the PKCE verifier the sign-in was started with.
+func TokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req tokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" || req.CodeVerifier == "" || req.RedirectURI == "" {
+		http.Error(w, "code, code_verifier and redirect_uri are required", http.StatusBadRequest)
+		return
+	}
+
+	authorizationCode, err := services.RedeemAuthorizationCode(req.Code, req.CodeVerifier, req.RedirectURI, time.Now())
+	if err != nil {
+		if errors.Is(err, services.ErrAuthorizationCodeInvalid) {
+			http.Error(w, "Invalid or expired authorization code", http.StatusBadRequest)
+			return
+		}
+		log.Printf("Failed to redeem authorization code: %v", err)
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := issueTokens(authorizationCode.UserID, r)
+	if err != nil {
+		log.Printf("Failed to issue tokens: %v", err)
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	writeTokenResponse(w, tokens)
+}
+
+// RefreshHandler exchanges a refresh token for a new access token and a new refresh token. The
+// presented refresh token stops working; presenting it again revokes the whole session. In cookie
+// mode the new tokens replace the cookies instead of being returned.
+func RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	refreshToken, fromCookie, ok := decodeRefreshTokenRequest(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	next, nextToken, err := services.RotateRefreshToken(refreshToken, now, now.Add(RefreshTokenTTL))
+	if err != nil {
+		// Cookies with a dead refresh token are of no use; after server errors a retry may work
+		if fromCookie && (errors.Is(err, services.ErrRefreshTokenReused) || errors.Is(err, services.ErrRefreshTokenInvalid)) {
+			clearAuthCookies(w)
+		}
+		switch {
+		case errors.Is(err, services.ErrRefreshTokenReused):
+			log.Printf("Refresh token reuse detected; revoked its session")
+			InvalidateSession(next.SessionID)
+			http.Error(w, "Refresh token has already been used", http.StatusUnauthorized)
+		case errors.Is(err, services.ErrRefreshTokenInvalid):
+			http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		default:
+			log.Printf("Failed to rotate refresh token: %v", err)
+			http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// The session's expiry moved, so the cached copy is stale
+	InvalidateSession(next.SessionID)
+
+	response, err := newTokenResponse(next.UserID, next.SessionID, nextToken)
+	if err != nil {
+		log.Printf("Failed to generate JWT: %v", err)
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	if fromCookie {
+		setAuthCookies(w, response)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeTokenResponse(w, response)
+}
+
+// LogoutHandler revokes the session a refresh token belongs to, which also rejects its access
+// tokens. Unknown tokens are accepted, so logging out twice is harmless. In cookie mode the
+// cookies are cleared as well.
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	refreshToken, fromCookie, ok := decodeRefreshTokenRequest(w, r)
+	if !ok {
+		return
+	}
+
+	sessionID, err := services.RevokeRefreshToken(refreshToken, time.Now())
+	if err != nil && !errors.Is(err, services.ErrRefreshTokenInvalid) {
+		log.Printf("Failed to revoke refresh token: %v", err)
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		InvalidateSession(sessionID)
+	}
+
+	if fromCookie {
+		clearAuthCookies(w)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/services"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// PKCE example from RFC 7636, appendix B
+const (
+	testCodeVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testCodeChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	testCallbackURL   = "http://localhost:3000/auth/callback"
+	// testPKCEParams are the query parameters the frontend adds when signing in with a callback
+	testPKCEParams = "&code_challenge=" + testCodeChallenge + "&code_challenge_method=S256"
+)
+
+// setupAuthTestDB points the services at an empty in-memory database
+func setupAuthTestDB(t *testing.T) {
+	originalDB := db.DB
+	t.Cleanup(func() { db.DB = originalDB })
+
+	var err error
+	db.DB, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.DB.AutoMigrate(&models.User{}, &models.Session{}, &models.RefreshToken{}, &models.UserIdentity{}, &models.IdentityLink{}, &models.PersonalAccessToken{}, &models.AuthorizationCode{}))
+	resetSessionCache(t)
+}
+
+func postRefreshToken(handler http.HandlerFunc, target, refreshToken string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(refreshTokenRequest{RefreshToken: refreshToken})
+	req := httptest.NewRequest("POST", target, strings.NewReader(string(body)))
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+// getWithAccessToken makes a request through RequireAuth
+func getWithAccessToken(accessToken string) *httptest.ResponseRecorder {
+	handler := RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest("GET", "/api/users/me", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestIssueTokens(t *testing.T) {
+	setupAuthTestDB(t)
+	JWTSecret = []byte("test-secret-key")
+
+	req := httptest.NewRequest("GET", "/auth/google/callback", nil)
+	req.Header.Set("User-Agent", "Firefox")
+	tokens, err := issueTokens(42, req)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.Equal(t, int(AccessTokenTTL/time.Second), tokens.ExpiresIn)
+	assert.NotEmpty(t, tokens.RefreshToken)
+
+	claims := &FamilyCalendarClaims{}
+	_, err = jwt.ParseWithClaims(tokens.AccessToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return JWTSecret, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint(42), claims.UserID)
+	assert.WithinDuration(t, time.Now().Add(AccessTokenTTL), claims.ExpiresAt.Time, 2*time.Second)
+
+	// The sign-in is recorded as a session
+	var session models.Session
+	require.NoError(t, db.DB.First(&session, claims.SessionID).Error)
+	assert.Equal(t, uint(42), session.UserID)
+	assert.Equal(t, "Firefox", session.UserAgent)
+	assert.Equal(t, "192.0.2.1", session.IPAddress)
+}
+
+// postCode exchanges an authorization code at the token endpoint
+func postCode(code, codeVerifier, redirectURI string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(tokenRequest{Code: code, CodeVerifier: codeVerifier, RedirectURI: redirectURI})
+	req := httptest.NewRequest("POST", "/auth/token", strings.NewReader(string(body)))
+	rr := httptest.NewRecorder()
+	TokenHandler(rr, req)
+	return rr
+}
+
+func TestTokenHandler(t *testing.T) {
+	setupAuthTestDB(t)
+	JWTSecret = []byte("test-secret-key")
+	code, err := services.CreateAuthorizationCode(7, testCodeChallenge, testCallbackURL, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+
+	rr := postCode(code, testCodeVerifier, testCallbackURL)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+	var tokens TokenResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &tokens))
+	assert.NotEmpty(t, tokens.RefreshToken)
+	claims, err := ParseFamilyCalendarJWT(tokens.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, uint(7), claims.UserID)
+
+	// The code works once
+	rr = postCode(code, testCodeVerifier, testCallbackURL)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Invalid or expired authorization code")
+}
+
+func TestTokenHandler_Invalid(t *testing.T) {
+	setupAuthTestDB(t)
+	JWTSecret = []byte("test-secret-key")
+
+	tests := []struct {
+		name        string
+		verifier    string
+		redirectURI string
+		status      int
+	}{
+		{"missing verifier", "", testCallbackURL, http.StatusBadRequest},
+		{"wrong verifier", "wrong-verifier-wrong-verifier-wrong-verifier", testCallbackURL, http.StatusBadRequest},
+		{"wrong redirect URI", testCodeVerifier, "http://localhost:3000/other", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := services.CreateAuthorizationCode(7, testCodeChallenge, testCallbackURL, time.Now().Add(time.Minute))
+			require.NoError(t, err)
+
+			rr := postCode(code, tt.verifier, tt.redirectURI)
+
+			assert.Equal(t, tt.status, rr.Code)
+			assert.NotContains(t, rr.Body.String(), "access_token")
+		})
+	}
+}
+
+func TestRefreshHandler_RotatesTokens(t *testing.T) {
+	setupAuthTestDB(t)
+	JWTSecret = []byte("test-secret-key")
+	tokens, err := issueTokens(7, httptest.NewRequest("GET", "/auth/google/callback", nil))
+	require.NoError(t, err)
+
+	rr := postRefreshToken(RefreshHandler, "/auth/refresh", tokens.RefreshToken)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+	var refreshed TokenResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &refreshed))
+	assert.NotEmpty(t, refreshed.AccessToken)
+	assert.NotEmpty(t, refreshed.RefreshToken)
+	assert.NotEqual(t, tokens.RefreshToken, refreshed.RefreshToken)
+
+	claims := &FamilyCalendarClaims{}
+	_, err = jwt.ParseWithClaims(refreshed.AccessToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return JWTSecret, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint(7), claims.UserID)
+}
+
+func TestRefreshHandler_ReuseSignsOut(t *testing.T) {
+	setupAuthTestDB(t)
+	JWTSecret = []byte("test-secret-key")
+	tokens, err := issueTokens(7, httptest.NewRequest("GET", "/auth/google/callback", nil))
+	require.NoError(t, err)
+
+	rr := postRefreshToken(RefreshHandler, "/auth/refresh", tokens.RefreshToken)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var refreshed TokenResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &refreshed))
+
+	// Replaying the first token is refused and ends the sign-in
+	rr = postRefreshToken(RefreshHandler, "/auth/refresh", tokens.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Refresh token has already been used")
+
+	rr = postRefreshToken(RefreshHandler, "/auth/refresh", refreshed.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Invalid or expired refresh token")
+
+	// Access tokens of the session are rejected as well
+	assert.Equal(t, http.StatusUnauthorized, getWithAccessToken(refreshed.AccessToken).Code)
+}
+
+func TestRefreshHandler_BadRequests(t *testing.T) {
+	setupAuthTestDB(t)
+
+	rr := postRefreshToken(RefreshHandler, "/auth/refresh", "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	req := httptest.NewRequest("POST", "/auth/refresh", strings.NewReader("{"))
+	rr = httptest.NewRecorder()
+	RefreshHandler(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = postRefreshToken(RefreshHandler, "/auth/refresh", "unknown")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestLogoutHandler(t *testing.T) {
+	setupAuthTestDB(t)
+	JWTSecret = []byte("test-secret-key")
+	tokens, err := issueTokens(7, httptest.NewRequest("GET", "/auth/google/callback", nil))
+	require.NoError(t, err)
+
+	// The access token works until the session is signed out
+	assert.Equal(t, http.StatusOK, getWithAccessToken(tokens.AccessToken).Code)
+
+	rr := postRefreshToken(LogoutHandler, "/auth/logout", tokens.RefreshToken)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	rr = postRefreshToken(RefreshHandler, "/auth/refresh", tokens.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	rr = getWithAccessToken(tokens.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Session has been revoked")
+
+	// Logging out again, or with an unknown token, is harmless
+	rr = postRefreshToken(LogoutHandler, "/auth/logout", tokens.RefreshToken)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	rr = postRefreshToken(LogoutHandler, "/auth/logout", "unknown")
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+}
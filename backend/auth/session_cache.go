@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/services"
+)
+
+// sessionCacheTTL is how long RequireAuth trusts a looked-up session before checking the database
+// again. Revocations made on another instance take effect within this period.
+const sessionCacheTTL = 30 * time.Second
+
+// Replaceable in tests
+var (
+	lookupSession = services.GetSession
+	touchSession  = services.TouchSession
+)
+
+type cachedSession struct {
+	userID    uint
+	expiresAt time.Time
+	revoked   bool
+	checkedAt time.Time
+}
+
+// stale reports whether the entry is past its TTL and must be looked up again
+func (e cachedSession) stale(now time.Time) bool {
+	return now.Sub(e.checkedAt) >= sessionCacheTTL
+}
+
+// sessionCache remembers which sessions are active, so authenticating a request does not hit the
+// database every time. Stale entries are swept at most once per TTL, so sessions that expire or
+// stop being used do not stay in memory.
+type sessionCache struct {
+	mu       sync.Mutex
+	sessions map[uint]cachedSession
+	sweptAt  time.Time
+}
+
+var sessions = &sessionCache{sessions: make(map[uint]cachedSession)}
+
+// get returns the cached state of a session, loading it when it is unknown or stale. Loading
+// also records the session as used.
+func (c *sessionCache) get(id uint, now time.Time) (cachedSession, error) {
+	c.mu.Lock()
+	entry, ok := c.sessions[id]
+	if ok && entry.stale(now) {
+		delete(c.sessions, id)
+		ok = false
+	}
+	c.mu.Unlock()
+	if ok {
+		return entry, nil
+	}
+
+	session, err := lookupSession(id)
+	if err != nil {
+		return cachedSession{}, err
+	}
+	entry = newCachedSession(session, now)
+	if !entry.revoked {
+		if err := touchSession(id, now); err != nil {
+			log.Printf("Failed to record session use: %v", err)
+		}
+	}
+
+	c.mu.Lock()
+	c.sweep(now)
+	c.sessions[id] = entry
+	c.mu.Unlock()
+	return entry, nil
+}
+
+// sweep drops stale entries and those of expired sessions when the last sweep is older than the
+// TTL; c.mu must be held
+func (c *sessionCache) sweep(now time.Time) {
+	if now.Sub(c.sweptAt) < sessionCacheTTL {
+		return
+	}
+	for id, entry := range c.sessions {
+		if entry.stale(now) || !now.Before(entry.expiresAt) {
+			delete(c.sessions, id)
+		}
+	}
+	c.sweptAt = now
+}
+
+func newCachedSession(session *models.Session, now time.Time) cachedSession {
+	return cachedSession{
+		userID:    session.UserID,
+		expiresAt: session.ExpiresAt,
+		revoked:   session.RevokedAt != nil,
+		checkedAt: now,
+	}
+}
+
+func (c *sessionCache) invalidate(id uint) {
+	c.mu.Lock()
+	delete(c.sessions, id)
+	c.mu.Unlock()
+}
+
+// InvalidateSession drops a session from the cache, so a revocation takes effect on this instance
+// immediately
+func InvalidateSession(id uint) {
+	sessions.invalidate(id)
+}
+
+// sessionActive reports whether an access token's session still lets it through
+func sessionActive(claims *FamilyCalendarClaims, now time.Time) (bool, error) {
+	if claims.SessionID == 0 {
+		return false, nil
+	}
+	entry, err := sessions.get(claims.SessionID, now)
+	if errors.Is(err, services.ErrSessionNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !entry.revoked && entry.userID == claims.UserID && now.Before(entry.expiresAt), nil
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// resetSessionCache gives a test an empty session cache
+func resetSessionCache(t *testing.T) {
+	original := sessions
+	t.Cleanup(func() { sessions = original })
+	sessions = &sessionCache{sessions: make(map[uint]cachedSession)}
+}
+
+// stubSessions serves session lookups from the given sessions and returns how many were made
+func stubSessions(t *testing.T, stored ...*models.Session) *int {
+	resetSessionCache(t)
+	originalLookup, originalTouch := lookupSession, touchSession
+	t.Cleanup(func() {
+		lookupSession = originalLookup
+		touchSession = originalTouch
+	})
+
+	lookups := 0
+	lookupSession = func(id uint) (*models.Session, error) {
+		lookups++
+		for _, session := range stored {
+			if session.ID == id {
+				return session, nil
+			}
+		}
+		return nil, services.ErrSessionNotFound
+	}
+	touchSession = func(id uint, now time.Time) error { return nil }
+	return &lookups
+}
+
+func TestSessionActive(t *testing.T) {
+	now := time.Now()
+	revokedAt := now.Add(-time.Minute)
+	stubSessions(t,
+		&models.Session{ID: 1, UserID: 10, ExpiresAt: now.Add(time.Hour)},
+		&models.Session{ID: 2, UserID: 10, ExpiresAt: now.Add(time.Hour), RevokedAt: &revokedAt},
+		&models.Session{ID: 3, UserID: 10, ExpiresAt: now.Add(-time.Minute)},
+	)
+
+	tests := []struct {
+		name     string
+		claims   FamilyCalendarClaims
+		expected bool
+	}{
+		{"Active session", FamilyCalendarClaims{UserID: 10, SessionID: 1}, true},
+		{"Revoked session", FamilyCalendarClaims{UserID: 10, SessionID: 2}, false},
+		{"Expired session", FamilyCalendarClaims{UserID: 10, SessionID: 3}, false},
+		{"Unknown session", FamilyCalendarClaims{UserID: 10, SessionID: 4}, false},
+		{"Session of another user", FamilyCalendarClaims{UserID: 11, SessionID: 1}, false},
+		{"Token without session", FamilyCalendarClaims{UserID: 10}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			active, err := sessionActive(&tt.claims, now)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, active)
+		})
+	}
+}
+
+func TestSessionActive_Caches(t *testing.T) {
+	now := time.Now()
+	session := &models.Session{ID: 1, UserID: 10, ExpiresAt: now.Add(time.Hour)}
+	lookups := stubSessions(t, session)
+	claims := &FamilyCalendarClaims{UserID: 10, SessionID: 1}
+
+	for i := 0; i < 3; i++ {
+		active, err := sessionActive(claims, now)
+		require.NoError(t, err)
+		assert.True(t, active)
+	}
+	assert.Equal(t, 1, *lookups)
+
+	// A revocation elsewhere is noticed once the cached entry is stale
+	revokedAt := now
+	session.RevokedAt = &revokedAt
+	active, err := sessionActive(claims, now.Add(sessionCacheTTL/2))
+	require.NoError(t, err)
+	assert.True(t, active)
+	active, err = sessionActive(claims, now.Add(sessionCacheTTL))
+	require.NoError(t, err)
+	assert.False(t, active)
+	assert.Equal(t, 2, *lookups)
+}
+
+func TestSessionCache_EvictsStaleEntries(t *testing.T) {
+	now := time.Now()
+	stubSessions(t,
+		&models.Session{ID: 1, UserID: 10, ExpiresAt: now.Add(time.Hour)},
+		&models.Session{ID: 2, UserID: 10, ExpiresAt: now.Add(time.Second)},
+		&models.Session{ID: 3, UserID: 10, ExpiresAt: now.Add(time.Hour)},
+	)
+
+	for _, id := range []uint{1, 2} {
+		_, err := sessionActive(&FamilyCalendarClaims{UserID: 10, SessionID: id}, now)
+		require.NoError(t, err)
+	}
+	assert.Len(t, sessions.sessions, 2)
+
+	// Using another session after the TTL sweeps out the idle and expired ones
+	_, err := sessionActive(&FamilyCalendarClaims{UserID: 10, SessionID: 3}, now.Add(sessionCacheTTL))
+	require.NoError(t, err)
+	assert.Len(t, sessions.sessions, 1)
+	assert.Contains(t, sessions.sessions, uint(3))
+}
+
+func TestInvalidateSession(t *testing.T) {
+	now := time.Now()
+	session := &models.Session{ID: 1, UserID: 10, ExpiresAt: now.Add(time.Hour)}
+	lookups := stubSessions(t, session)
+	claims := &FamilyCalendarClaims{UserID: 10, SessionID: 1}
+
+	_, err := sessionActive(claims, now)
+	require.NoError(t, err)
+
+	revokedAt := now
+	session.RevokedAt = &revokedAt
+	InvalidateSession(1)
+
+	active, err := sessionActive(claims, now)
+	require.NoError(t, err)
+	assert.False(t, active)
+	assert.Equal(t, 2, *lookups)
+}
+
+func TestRequireAuth_RevokedSession(t *testing.T) {
+	JWTSecret = []byte("test-secret-key")
+	revokedAt := time.Now()
+	stubSessions(t, &models.Session{ID: 5, UserID: 123, ExpiresAt: time.Now().Add(time.Hour), RevokedAt: &revokedAt})
+
+	token, err := GenerateFamilyCalendarJWT(123, 5)
+	require.NoError(t, err)
+
+	handler := RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Handler should not be called")
+	}))
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Session has been revoked")
+}
+
+func TestRequireAuth_SessionLookupFails(t *testing.T) {
+	JWTSecret = []byte("test-secret-key")
+	stubSessions(t)
+	lookupSession = func(id uint) (*models.Session, error) {
+		return nil, errors.New("database is down")
+	}
+
+	token, err := GenerateFamilyCalendarJWT(123, 5)
+	require.NoError(t, err)
+
+	handler := RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Handler should not be called")
+	}))
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
@@ -0,0 +1,73 @@
+package calendar_sync
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config controls how often and how aggressively calendar sources are refreshed
+type Config struct {
+	// Interval is the minimum time between two syncs of the same source
+	Interval time.Duration
+	// PollInterval is how often the engine looks for sources that are due
+	PollInterval time.Duration
+	// Workers bounds the number of sources fetched concurrently
+	Workers int
+	// MaxJitter is the upper bound of the random delay added before each fetch
+	MaxJitter time.Duration
+	// FetchTimeout bounds a single upstream request
+	FetchTimeout time.Duration
+	// Transport is used for upstream requests; nil means ical.NewPublicTransport, which refuses
+	// loopback, private and link-local addresses
+	Transport http.RoundTripper
+}
+
+// DefaultConfig returns the settings used when no environment overrides are present
+func DefaultConfig() Config {
+	return Config{
+		Interval:     15 * time.Minute,
+		PollInterval: time.Minute,
+		Workers:      4,
+		MaxJitter:    30 * time.Second,
+		FetchTimeout: 30 * time.Second,
+	}
+}
+
+// ConfigFromEnv reads SYNC_INTERVAL, SYNC_POLL_INTERVAL, SYNC_WORKERS, SYNC_MAX_JITTER and
+// SYNC_FETCH_TIMEOUT, falling back to the defaults for missing, invalid or non-positive values.
+// SYNC_MAX_JITTER may also be 0, which turns the jitter off.
+func ConfigFromEnv() Config {
+	config := DefaultConfig()
+	config.Interval = durationFromEnv("SYNC_INTERVAL", config.Interval, false)
+	config.PollInterval = durationFromEnv("SYNC_POLL_INTERVAL", config.PollInterval, false)
+	config.MaxJitter = durationFromEnv("SYNC_MAX_JITTER", config.MaxJitter, true)
+	config.FetchTimeout = durationFromEnv("SYNC_FETCH_TIMEOUT", config.FetchTimeout, false)
+
+	if value := os.Getenv("SYNC_WORKERS"); value != "" {
+		workers, err := strconv.Atoi(value)
+		if err != nil || workers < 1 {
+			log.Printf("Warning: Invalid SYNC_WORKERS value '%s', defaulting to %d", value, config.Workers)
+		} else {
+			config.Workers = workers
+		}
+	}
+
+	return config
+}
+
+// durationFromEnv reads a positive duration, or a non-negative one when allowZero is set
+func durationFromEnv(name string, fallback time.Duration, allowZero bool) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 || (duration == 0 && !allowZero) {
+		log.Printf("Warning: Invalid %s value '%s', defaulting to %s", name, value, fallback)
+		return fallback
+	}
+	return duration
+}
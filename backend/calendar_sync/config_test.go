@@ -0,0 +1,58 @@
+package calendar_sync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigFromEnv_Defaults(t *testing.T) {
+	config := ConfigFromEnv()
+
+	assert.Equal(t, DefaultConfig(), config)
+}
+
+func TestConfigFromEnv_Overrides(t *testing.T) {
+	t.Setenv("SYNC_INTERVAL", "1h")
+	t.Setenv("SYNC_POLL_INTERVAL", "30s")
+	t.Setenv("SYNC_WORKERS", "8")
+	t.Setenv("SYNC_MAX_JITTER", "2m")
+	t.Setenv("SYNC_FETCH_TIMEOUT", "10s")
+
+	config := ConfigFromEnv()
+
+	assert.Equal(t, time.Hour, config.Interval)
+	assert.Equal(t, 30*time.Second, config.PollInterval)
+	assert.Equal(t, 8, config.Workers)
+	assert.Equal(t, 2*time.Minute, config.MaxJitter)
+	assert.Equal(t, 10*time.Second, config.FetchTimeout)
+}
+
+func TestConfigFromEnv_InvalidValuesFallBackToDefaults(t *testing.T) {
+	t.Setenv("SYNC_INTERVAL", "soon")
+	t.Setenv("SYNC_MAX_JITTER", "-1s")
+	t.Setenv("SYNC_WORKERS", "0")
+
+	config := ConfigFromEnv()
+
+	assert.Equal(t, DefaultConfig(), config)
+}
+
+func TestConfigFromEnv_ZeroDurationsFallBackToDefaults(t *testing.T) {
+	t.Setenv("SYNC_POLL_INTERVAL", "0")
+	t.Setenv("SYNC_FETCH_TIMEOUT", "0s")
+
+	config := ConfigFromEnv()
+
+	assert.Equal(t, DefaultConfig().PollInterval, config.PollInterval)
+	assert.Equal(t, DefaultConfig().FetchTimeout, config.FetchTimeout)
+}
+
+func TestConfigFromEnv_ZeroJitterTurnsItOff(t *testing.T) {
+	t.Setenv("SYNC_MAX_JITTER", "0")
+
+	config := ConfigFromEnv()
+
+	assert.Equal(t, time.Duration(0), config.MaxJitter)
+}
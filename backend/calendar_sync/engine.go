@@ -0,0 +1,204 @@
+package calendar_sync
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/services"
+	"family-calendar-backend/ical"
+)
+
+// Engine periodically refreshes calendar sources and stores their events in the database
+type Engine struct {
+	config Config
+	client *http.Client
+
+	jobs   chan models.CalendarSource
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	inFlight map[uint]bool
+
+	// now and jitter are replaceable in tests
+	now    func() time.Time
+	jitter func(max time.Duration) time.Duration
+}
+
+// NewEngine creates a sync engine; call Start to begin polling
+func NewEngine(config Config) *Engine {
+	transport := config.Transport
+	if transport == nil {
+		transport = ical.NewPublicTransport()
+	}
+	return &Engine{
+		config:   config,
+		client:   &http.Client{Transport: transport, Timeout: config.FetchTimeout},
+		inFlight: make(map[uint]bool),
+		now:      time.Now,
+		jitter:   randomJitter,
+	}
+}
+
+// scheduledSource is a due source together with its random dispatch delay
+type scheduledSource struct {
+	source models.CalendarSource
+	delay  time.Duration
+}
+
+func randomJitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// Start launches the scheduler and the worker pool. It returns immediately.
+func (e *Engine) Start(ctx context.Context) {
+	ctx, e.cancel = context.WithCancel(ctx)
+	e.jobs = make(chan models.CalendarSource)
+
+	for i := 0; i < e.config.Workers; i++ {
+		e.wg.Add(1)
+		go e.worker(ctx)
+	}
+
+	e.wg.Add(1)
+	go e.schedule(ctx)
+}
+
+// Stop cancels in-flight syncs and waits for the scheduler and all workers to exit
+func (e *Engine) Stop() {
+	if e.cancel == nil {
+		return
+	}
+	e.cancel()
+	e.wg.Wait()
+}
+
+// schedule looks for due sources on every poll tick and hands them to the workers
+func (e *Engine) schedule(ctx context.Context) {
+	defer e.wg.Done()
+	defer close(e.jobs)
+
+	ticker := time.NewTicker(e.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		e.dispatchDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatchDue queues every due source after its own random delay, so that many sources
+// on the same host are not fetched at the same instant
+func (e *Engine) dispatchDue(ctx context.Context) {
+	sources, err := services.GetCalendarSourcesDueForSync(e.now().Add(-e.config.Interval))
+	if err != nil {
+		log.Printf("Failed to load calendar sources due for sync: %v", err)
+		return
+	}
+
+	scheduled := make([]scheduledSource, 0, len(sources))
+	for _, source := range sources {
+		if !e.markInFlight(source.ID) {
+			continue
+		}
+		scheduled = append(scheduled, scheduledSource{source: source, delay: e.jitter(e.config.MaxJitter)})
+	}
+	sort.Slice(scheduled, func(i, j int) bool { return scheduled[i].delay < scheduled[j].delay })
+
+	start := time.Now()
+	for i, s := range scheduled {
+		timer := time.NewTimer(time.Until(start.Add(s.delay)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			e.releaseScheduled(scheduled[i:])
+			return
+		case <-timer.C:
+		}
+
+		select {
+		case <-ctx.Done():
+			e.releaseScheduled(scheduled[i:])
+			return
+		case e.jobs <- s.source:
+		}
+	}
+}
+
+func (e *Engine) worker(ctx context.Context) {
+	defer e.wg.Done()
+	for source := range e.jobs {
+		if err := e.SyncSource(ctx, source); err != nil {
+			log.Printf("Failed to sync calendar source %d: %v", source.ID, err)
+		}
+		e.releaseInFlight(source.ID)
+	}
+}
+
+// markInFlight reserves a source for syncing, returning false if it is already being synced
+func (e *Engine) markInFlight(sourceID uint) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.inFlight[sourceID] {
+		return false
+	}
+	e.inFlight[sourceID] = true
+	return true
+}
+
+func (e *Engine) releaseInFlight(sourceID uint) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.inFlight, sourceID)
+}
+
+// releaseScheduled frees sources that were reserved but never handed to a worker
+func (e *Engine) releaseScheduled(scheduled []scheduledSource) {
+	for _, s := range scheduled {
+		e.releaseInFlight(s.source.ID)
+	}
+}
+
+// SyncSource fetches a single source and stores its events, recording the outcome on the source.
+// The source's stored validators are sent along so unchanged calendars are neither downloaded nor parsed.
+func (e *Engine) SyncSource(ctx context.Context, source models.CalendarSource) error {
+	syncedAt := e.now()
+
+	result, err := ical.FetchConditional(ctx, e.client, source.URL, source.ETag, source.LastModified)
+	if err == nil {
+		if result.NotModified {
+			return services.RecordCalendarSourceNotModified(source.ID, syncedAt, result.ETag, result.LastModified)
+		}
+
+		var data services.CalendarSourceSyncData
+		data.Events, data.Timezones, err = eventsFromCalendar(result.Calendar)
+		if err == nil {
+			data.ETag = result.ETag
+			data.LastModified = result.LastModified
+			return services.RecordCalendarSourceSyncSuccess(source.ID, syncedAt, data)
+		}
+	}
+
+	if ctx.Err() != nil {
+		// Shutting down; do not record the cancellation as a source failure
+		return err
+	}
+	if recordErr := services.RecordCalendarSourceSyncFailure(source.ID, syncedAt, err.Error()); recordErr != nil {
+		log.Printf("Failed to record sync failure for calendar source %d: %v", source.ID, recordErr)
+	}
+	return err
+}
@@ -0,0 +1,286 @@
+package calendar_sync
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const upstreamCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VTIMEZONE\r\nTZID:America/Toronto\r\nEND:VTIMEZONE\r\n" +
+	"BEGIN:VEVENT\r\nUID:practice@example.com\r\nDTSTART;TZID=America/Toronto:20250110T170000\r\nSUMMARY:Soccer practice\r\nEND:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\nUID:practice@example.com\r\nRECURRENCE-ID;TZID=America/Toronto:20250117T170000\r\nSUMMARY:Soccer practice (moved)\r\nEND:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func setupEngineTestDB(t *testing.T) *models.CalendarMux {
+	var err error
+	db.DB, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+
+	// Workers run in their own goroutines; a single connection keeps them on the same in-memory database
+	sqlDB, err := db.DB.DB()
+	assert.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	err = db.DB.AutoMigrate(&models.User{}, &models.CalendarMux{}, &models.CalendarSource{}, &models.CalendarEvent{})
+	assert.NoError(t, err)
+
+	user := &models.User{
+		GivenName:  "Test",
+		FamilyName: "User",
+		Email:      "test@example.com",
+	}
+	db.DB.Create(user)
+
+	calendarMux := &models.CalendarMux{CreatedByID: user.ID, Name: "Family"}
+	db.DB.Create(calendarMux)
+	return calendarMux
+}
+
+func testConfig(transport http.RoundTripper) Config {
+	return Config{
+		Interval:     time.Hour,
+		PollInterval: 10 * time.Millisecond,
+		Workers:      2,
+		MaxJitter:    0,
+		FetchTimeout: time.Second,
+		Transport:    transport,
+	}
+}
+
+func TestEngine_SyncsDueSources(t *testing.T) {
+	calendarMux := setupEngineTestDB(t)
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(upstreamCalendar))
+	}))
+	defer server.Close()
+
+	source := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: server.URL + "/soccer.ics", Label: "Soccer", Enabled: true}
+	db.DB.Create(source)
+
+	engine := NewEngine(testConfig(server.Client().Transport))
+	engine.Start(context.Background())
+
+	assert.Eventually(t, func() bool {
+		var synced models.CalendarSource
+		db.DB.First(&synced, source.ID)
+		return synced.LastSuccessAt != nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	engine.Stop()
+
+	var synced models.CalendarSource
+	db.DB.First(&synced, source.ID)
+	assert.NotNil(t, synced.LastSyncAt)
+	assert.Nil(t, synced.LastErrorAt)
+	assert.Contains(t, synced.Timezones, "TZID:America/Toronto")
+
+	var events []models.CalendarEvent
+	db.DB.Order("id").Find(&events)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "practice@example.com", events[0].UID)
+	assert.Equal(t, "Soccer practice", events[0].Summary)
+	assert.Equal(t, "", events[0].RecurrenceID)
+	assert.Equal(t, "20250117T170000", events[1].RecurrenceID)
+
+	// The source is not due again within the interval, so it was fetched only once
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestEngine_RecordsFailuresAndKeepsEvents(t *testing.T) {
+	calendarMux := setupEngineTestDB(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	source := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: server.URL, Label: "Flaky", Enabled: true}
+	db.DB.Create(source)
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: source.ID, UID: "old", Data: "BEGIN:VEVENT\r\nUID:old\r\nEND:VEVENT\r\n"})
+
+	engine := NewEngine(testConfig(server.Client().Transport))
+	err := engine.SyncSource(context.Background(), *source)
+
+	assert.Error(t, err)
+
+	var synced models.CalendarSource
+	db.DB.First(&synced, source.ID)
+	assert.NotNil(t, synced.LastSyncAt)
+	assert.NotNil(t, synced.LastErrorAt)
+	assert.Nil(t, synced.LastSuccessAt)
+	assert.Contains(t, synced.LastError, "502")
+
+	var count int64
+	db.DB.Model(&models.CalendarEvent{}).Where("calendar_source_id = ?", source.ID).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestEngine_SuccessClearsPreviousError(t *testing.T) {
+	calendarMux := setupEngineTestDB(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(upstreamCalendar))
+	}))
+	defer server.Close()
+
+	failedAt := time.Now().Add(-time.Hour)
+	source := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: server.URL, Label: "Soccer", Enabled: true, LastErrorAt: &failedAt, LastError: "boom"}
+	db.DB.Create(source)
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: source.ID, UID: "stale", Data: "BEGIN:VEVENT\r\nUID:stale\r\nEND:VEVENT\r\n"})
+
+	engine := NewEngine(testConfig(server.Client().Transport))
+	assert.NoError(t, engine.SyncSource(context.Background(), *source))
+
+	var synced models.CalendarSource
+	db.DB.First(&synced, source.ID)
+	assert.Nil(t, synced.LastErrorAt)
+	assert.Equal(t, "", synced.LastError)
+
+	var uids []string
+	db.DB.Model(&models.CalendarEvent{}).Where("calendar_source_id = ?", source.ID).Pluck("uid", &uids)
+	assert.ElementsMatch(t, []string{"practice@example.com", "practice@example.com"}, uids)
+}
+
+func TestEngine_ConditionalFetch(t *testing.T) {
+	calendarMux := setupEngineTestDB(t)
+
+	var fullResponses int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&fullResponses, 1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Wed, 01 Jan 2025 10:00:00 GMT")
+		w.Write([]byte(upstreamCalendar))
+	}))
+	defer server.Close()
+
+	source := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: server.URL, Label: "School", Enabled: true}
+	db.DB.Create(source)
+
+	engine := NewEngine(testConfig(server.Client().Transport))
+	firstSync := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	engine.now = func() time.Time { return firstSync }
+	assert.NoError(t, engine.SyncSource(context.Background(), *source))
+
+	var synced models.CalendarSource
+	db.DB.First(&synced, source.ID)
+	assert.Equal(t, `"v1"`, synced.ETag)
+	assert.Equal(t, "Wed, 01 Jan 2025 10:00:00 GMT", synced.LastModified)
+
+	// The second sync sends the stored validators and gets a 304
+	secondSync := firstSync.Add(time.Hour)
+	engine.now = func() time.Time { return secondSync }
+	assert.NoError(t, engine.SyncSource(context.Background(), synced))
+
+	db.DB.First(&synced, source.ID)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fullResponses))
+	assert.True(t, synced.LastSuccessAt.Equal(secondSync))
+	assert.True(t, synced.UnchangedSince.Equal(firstSync))
+
+	var count int64
+	db.DB.Model(&models.CalendarEvent{}).Where("calendar_source_id = ?", source.ID).Count(&count)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestEngine_SkipsDisabledAndDeletedMuxSources(t *testing.T) {
+	calendarMux := setupEngineTestDB(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected fetch of %s", r.URL.Path)
+	}))
+	defer server.Close()
+
+	disabled := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: server.URL + "/disabled", Label: "Disabled", Enabled: true}
+	db.DB.Create(disabled)
+	db.DB.Model(disabled).Update("enabled", false)
+
+	deletedMux := &models.CalendarMux{CreatedByID: calendarMux.CreatedByID, Name: "Deleted"}
+	db.DB.Create(deletedMux)
+	db.DB.Create(&models.CalendarSource{CalendarMuxID: deletedMux.ID, URL: server.URL + "/deleted", Label: "Deleted", Enabled: true})
+	db.DB.Delete(deletedMux)
+
+	engine := NewEngine(testConfig(server.Client().Transport))
+	engine.jobs = make(chan models.CalendarSource, 10)
+	engine.dispatchDue(context.Background())
+
+	assert.Len(t, engine.jobs, 0)
+}
+
+func TestEngine_DispatchAppliesJitterAndSkipsInFlight(t *testing.T) {
+	calendarMux := setupEngineTestDB(t)
+
+	first := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/a.ics", Label: "A", Enabled: true}
+	db.DB.Create(first)
+	second := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/b.ics", Label: "B", Enabled: true}
+	db.DB.Create(second)
+
+	config := testConfig(nil)
+	config.MaxJitter = time.Minute
+	engine := NewEngine(config)
+	engine.jobs = make(chan models.CalendarSource, 10)
+
+	var jitterCalls int
+	engine.jitter = func(max time.Duration) time.Duration {
+		jitterCalls++
+		assert.Equal(t, time.Minute, max)
+		return 0
+	}
+
+	// The first source is still being synced from a previous cycle
+	engine.markInFlight(first.ID)
+	engine.dispatchDue(context.Background())
+
+	assert.Equal(t, 1, jitterCalls)
+	assert.Len(t, engine.jobs, 1)
+	assert.Equal(t, second.ID, (<-engine.jobs).ID)
+}
+
+func TestEngine_StopReleasesPendingSources(t *testing.T) {
+	calendarMux := setupEngineTestDB(t)
+
+	source := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/a.ics", Label: "A", Enabled: true}
+	db.DB.Create(source)
+
+	engine := NewEngine(testConfig(nil))
+	engine.jobs = make(chan models.CalendarSource)
+	engine.jitter = func(time.Duration) time.Duration { return time.Hour }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	engine.dispatchDue(ctx)
+
+	// The source was reserved, then released when the context was cancelled before dispatch
+	assert.True(t, engine.markInFlight(source.ID))
+}
+
+func TestEngine_StopWithoutStart(t *testing.T) {
+	engine := NewEngine(DefaultConfig())
+	engine.Stop()
+}
+
+func TestRandomJitter(t *testing.T) {
+	assert.Equal(t, time.Duration(0), randomJitter(0))
+	for i := 0; i < 100; i++ {
+		jitter := randomJitter(time.Second)
+		assert.GreaterOrEqual(t, jitter, time.Duration(0))
+		assert.Less(t, jitter, time.Second)
+	}
+}
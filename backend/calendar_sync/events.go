@@ -0,0 +1,57 @@
+package calendar_sync
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"unicode/utf8"
+
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/ical"
+)
+
+// maxSummaryLength matches the size of CalendarEvent.Summary
+const maxSummaryLength = 1000
+
+// eventsFromCalendar converts the VEVENTs of a fetched calendar into storable events and
+// returns its VTIMEZONE definitions wrapped in a VCALENDAR
+func eventsFromCalendar(cal *ical.Component) ([]models.CalendarEvent, string, error) {
+	timezones := ical.NewComponent("VCALENDAR")
+	timezones.Components = cal.Children("VTIMEZONE")
+	var buf bytes.Buffer
+	if err := ical.Encode(&buf, timezones); err != nil {
+		return nil, "", err
+	}
+
+	vevents := cal.Children("VEVENT")
+	events := make([]models.CalendarEvent, 0, len(vevents))
+	for _, vevent := range vevents {
+		var data bytes.Buffer
+		if err := ical.Encode(&data, vevent); err != nil {
+			return nil, "", err
+		}
+
+		uid := vevent.PropValue("UID")
+		if uid == "" {
+			// UID is mandatory, but some publishers omit it; derive a stable one from the content
+			sum := sha256.Sum256(data.Bytes())
+			uid = hex.EncodeToString(sum[:16]) + "@family-calendar-muxer"
+		}
+
+		events = append(events, models.CalendarEvent{
+			UID:          uid,
+			RecurrenceID: vevent.PropValue("RECURRENCE-ID"),
+			Summary:      truncateRunes(ical.UnescapeText(vevent.PropValue("SUMMARY")), maxSummaryLength),
+			Data:         data.String(),
+		})
+	}
+
+	return events, buf.String(), nil
+}
+
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max])
+}
@@ -0,0 +1,47 @@
+package calendar_sync
+
+import (
+	"strings"
+	"testing"
+
+	"family-calendar-backend/ical"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventsFromCalendar(t *testing.T) {
+	cal, err := ical.Parse(strings.NewReader(upstreamCalendar))
+	assert.NoError(t, err)
+
+	events, timezones, err := eventsFromCalendar(cal)
+
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+
+	tzCal, err := ical.Parse(strings.NewReader(timezones))
+	assert.NoError(t, err)
+	assert.Len(t, tzCal.Children("VTIMEZONE"), 1)
+
+	stored, err := ical.Parse(strings.NewReader(events[1].Data))
+	assert.NoError(t, err)
+	assert.Equal(t, "VEVENT", stored.Name)
+	assert.Equal(t, "Soccer practice (moved)", stored.PropValue("SUMMARY"))
+}
+
+func TestEventsFromCalendar_MissingUID(t *testing.T) {
+	cal, err := ical.Parse(strings.NewReader("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:No UID\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"))
+	assert.NoError(t, err)
+
+	first, _, err := eventsFromCalendar(cal)
+	assert.NoError(t, err)
+	second, _, err := eventsFromCalendar(cal)
+	assert.NoError(t, err)
+
+	assert.True(t, strings.HasSuffix(first[0].UID, "@family-calendar-muxer"))
+	assert.Equal(t, first[0].UID, second[0].UID)
+}
+
+func TestTruncateRunes(t *testing.T) {
+	assert.Equal(t, "héllo", truncateRunes("héllo", 10))
+	assert.Equal(t, "hé", truncateRunes("héllo", 2))
+}
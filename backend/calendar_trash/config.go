@@ -0,0 +1,50 @@
+package calendar_trash
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+// Config controls how long deleted calendar muxes stay in the trash
+type Config struct {
+	// Retention is how long a deleted calendar mux can be restored before it is purged; 0 keeps
+	// deleted muxes forever
+	Retention time.Duration
+	// PurgeInterval is how often the purger looks for muxes past their retention
+	PurgeInterval time.Duration
+}
+
+// DefaultConfig returns the settings used when no environment overrides are present
+func DefaultConfig() Config {
+	return Config{
+		Retention:     30 * 24 * time.Hour,
+		PurgeInterval: time.Hour,
+	}
+}
+
+// ConfigFromEnv reads TRASH_RETENTION and TRASH_PURGE_INTERVAL, falling back to the defaults for
+// missing or invalid values
+func ConfigFromEnv() Config {
+	config := DefaultConfig()
+	config.Retention = durationFromEnv("TRASH_RETENTION", config.Retention)
+	config.PurgeInterval = durationFromEnv("TRASH_PURGE_INTERVAL", config.PurgeInterval)
+	if config.PurgeInterval == 0 {
+		log.Printf("Warning: TRASH_PURGE_INTERVAL must be positive, defaulting to %s", DefaultConfig().PurgeInterval)
+		config.PurgeInterval = DefaultConfig().PurgeInterval
+	}
+	return config
+}
+
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		log.Printf("Warning: Invalid %s value '%s', defaulting to %s", name, value, fallback)
+		return fallback
+	}
+	return duration
+}
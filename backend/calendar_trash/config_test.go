@@ -0,0 +1,41 @@
+package calendar_trash
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigFromEnv_Defaults(t *testing.T) {
+	config := ConfigFromEnv()
+
+	assert.Equal(t, DefaultConfig(), config)
+}
+
+func TestConfigFromEnv_Overrides(t *testing.T) {
+	t.Setenv("TRASH_RETENTION", "168h")
+	t.Setenv("TRASH_PURGE_INTERVAL", "10m")
+
+	config := ConfigFromEnv()
+
+	assert.Equal(t, 7*24*time.Hour, config.Retention)
+	assert.Equal(t, 10*time.Minute, config.PurgeInterval)
+}
+
+func TestConfigFromEnv_InvalidValuesFallBackToDefaults(t *testing.T) {
+	t.Setenv("TRASH_RETENTION", "a month")
+	t.Setenv("TRASH_PURGE_INTERVAL", "0s")
+
+	config := ConfigFromEnv()
+
+	assert.Equal(t, DefaultConfig(), config)
+}
+
+func TestConfigFromEnv_ZeroRetentionKeepsTrash(t *testing.T) {
+	t.Setenv("TRASH_RETENTION", "0")
+
+	config := ConfigFromEnv()
+
+	assert.Zero(t, config.Retention)
+}
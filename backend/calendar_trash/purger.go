@@ -0,0 +1,76 @@
+package calendar_trash
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"family-calendar-backend/db/services"
+)
+
+// Purger permanently deletes calendar muxes that have been in the trash longer than the retention
+type Purger struct {
+	config Config
+	muxes  *services.CalendarMuxService
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// now is replaceable in tests
+	now func() time.Time
+}
+
+// NewPurger returns a Purger for the calendar muxes of the given service, which records the
+// deletions in the audit log
+func NewPurger(config Config, muxes *services.CalendarMuxService) *Purger {
+	return &Purger{config: config, muxes: muxes, now: time.Now}
+}
+
+// Start purges now and then on every purge interval until the context ends or Stop is called.
+// It returns immediately, and does nothing when the retention is 0.
+func (p *Purger) Start(ctx context.Context) {
+	if p.config.Retention == 0 {
+		log.Println("Trash retention is 0, deleted calendar muxes are kept")
+		return
+	}
+	ctx, p.cancel = context.WithCancel(ctx)
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(p.config.PurgeInterval)
+		defer ticker.Stop()
+
+		for {
+			p.purge()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends the purge loop and waits for a running purge to finish
+func (p *Purger) Stop() {
+	if p.cancel == nil {
+		return
+	}
+	p.cancel()
+	p.wg.Wait()
+}
+
+// purge deletes the muxes past their retention
+func (p *Purger) purge() {
+	purged, err := p.muxes.Purge(p.now().Add(-p.config.Retention))
+	if err != nil {
+		log.Printf("Failed to purge deleted calendar muxes: %v", err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("Purged %d deleted calendar muxes", purged)
+	}
+}
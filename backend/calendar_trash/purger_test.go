@@ -0,0 +1,76 @@
+package calendar_trash
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/repositories"
+	"family-calendar-backend/db/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurger_PurgesPastRetention(t *testing.T) {
+	t.Parallel()
+	muxes := repositories.NewMemoryCalendarMuxRepository()
+	calendarMux := &models.CalendarMux{CreatedByID: 1, Name: "Family"}
+	require.NoError(t, muxes.Create(calendarMux))
+	require.NoError(t, muxes.Delete(calendarMux.ID))
+	purger := NewPurger(Config{Retention: time.Hour, PurgeInterval: time.Hour}, services.NewCalendarMuxService(muxes))
+
+	// Within the retention the mux can still be restored
+	purger.purge()
+	_, err := muxes.GetDeleted(calendarMux.ID)
+	require.NoError(t, err)
+
+	purger.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	purger.purge()
+	_, err = muxes.GetDeleted(calendarMux.ID)
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+
+	// The server is recorded as having deleted it
+	entries, err := muxes.AuditLog().List(repositories.AuditLogFilter{VisibleTo: models.AuditActorServer})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, models.AuditActionPurge, entries[0].Action)
+	assert.Equal(t, calendarMux.ID, entries[0].EntityID)
+}
+
+func TestPurger_StartPurgesImmediately(t *testing.T) {
+	t.Parallel()
+	muxes := repositories.NewMemoryCalendarMuxRepository()
+	calendarMux := &models.CalendarMux{CreatedByID: 1, Name: "Family"}
+	require.NoError(t, muxes.Create(calendarMux))
+	require.NoError(t, muxes.Delete(calendarMux.ID))
+	purger := NewPurger(Config{Retention: time.Nanosecond, PurgeInterval: time.Hour}, services.NewCalendarMuxService(muxes))
+
+	purger.Start(context.Background())
+	defer purger.Stop()
+
+	assert.Eventually(t, func() bool {
+		_, err := muxes.GetDeleted(calendarMux.ID)
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestPurger_ZeroRetentionKeepsTrash(t *testing.T) {
+	t.Parallel()
+	muxes := repositories.NewMemoryCalendarMuxRepository()
+	calendarMux := &models.CalendarMux{CreatedByID: 1, Name: "Family"}
+	require.NoError(t, muxes.Create(calendarMux))
+	require.NoError(t, muxes.Delete(calendarMux.ID))
+	purger := NewPurger(Config{Retention: 0, PurgeInterval: time.Hour}, services.NewCalendarMuxService(muxes))
+
+	purger.Start(context.Background())
+	purger.Stop()
+
+	_, err := muxes.GetDeleted(calendarMux.ID)
+	assert.NoError(t, err)
+}
+
+func TestPurger_StopWithoutStart(t *testing.T) {
+	NewPurger(DefaultConfig(), services.NewCalendarMuxService(repositories.NewMemoryCalendarMuxRepository())).Stop()
+}
@@ -13,9 +13,63 @@ import (
 
 var DB *gorm.DB
 
-// migrateFunc allows mocking AutoMigrate in tests
-var migrateFunc = func(db *gorm.DB) error {
-	return db.AutoMigrate(&models.User{}, &models.CalendarMux{})
+// migrateFunc allows mocking migrations in tests
+var migrateFunc = Migrate
+
+// migrateUserIdentities moves the identity users signed in with before identities got their own
+// table out of the users table
+func migrateUserIdentities(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasColumn(&legacyUser{}, "auth_provider") {
+		return nil
+	}
+
+	err := db.Exec(`INSERT INTO user_identities (created_at, updated_at, user_id, provider, subject, email)
+		SELECT created_at, updated_at, id, auth_provider, auth_provider_id, email FROM users
+		WHERE NOT EXISTS (SELECT 1 FROM user_identities
+			WHERE user_identities.provider = users.auth_provider AND user_identities.subject = users.auth_provider_id)`).Error
+	if err != nil {
+		return err
+	}
+
+	// SQLite rebuilds the table for each dropped constraint, taking the index along
+	if migrator.HasIndex(&legacyUser{}, "idx_auth_provider_id") {
+		if err := migrator.DropIndex(&legacyUser{}, "idx_auth_provider_id"); err != nil {
+			return err
+		}
+	}
+	for _, constraint := range []string{"chk_users_auth_provider", "chk_users_auth_provider_id"} {
+		if migrator.HasConstraint(&legacyUser{}, constraint) {
+			if err := migrator.DropConstraint(&legacyUser{}, constraint); err != nil {
+				return err
+			}
+		}
+	}
+	for _, column := range []string{"auth_provider", "auth_provider_id"} {
+		if err := migrator.DropColumn(&legacyUser{}, column); err != nil {
+			return err
+		}
+	}
+	// Restore the indexes a rebuild may have dropped
+	return db.AutoMigrate(&legacyUser{})
+}
+
+// backfillFeedTokens assigns feed tokens to calendar muxes created before tokens existed
+func backfillFeedTokens(db *gorm.DB) error {
+	var calendarMuxes []legacyCalendarMux
+	if err := db.Where("feed_token IS NULL OR feed_token = ''").Find(&calendarMuxes).Error; err != nil {
+		return err
+	}
+	for _, cm := range calendarMuxes {
+		token, err := models.NewFeedToken()
+		if err != nil {
+			return err
+		}
+		if err := db.Model(&legacyCalendarMux{}).Where("id = ?", cm.ID).Update("feed_token", token).Error; err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // getSQLitePath returns the appropriate SQLite database path
@@ -29,7 +83,8 @@ var getSQLitePath = func() string {
 	return "family_calendar.db"
 }
 
-func InitDB() error {
+// Open connects to the database configured in the environment, without migrating it
+func Open() error {
 	dbType := os.Getenv("DB_TYPE")
 	if dbType == "" {
 		dbType = "sqlite" // Default to SQLite
@@ -81,15 +136,29 @@ func InitDB() error {
 	}
 
 	DB, err = gorm.Open(dialector, &gorm.Config{})
-	if err != nil {
+	return err
+}
+
+// InitDB connects to the database and applies pending migrations. With DB_MIGRATE_ON_START=false
+// migrations are left to the migrate command, and InitDB only checks that none are pending.
+func InitDB() error {
+	if err := Open(); err != nil {
 		return err
 	}
 
-	// Run migrations
-	err = migrateFunc(DB)
-	if err != nil {
-		return err
+	if os.Getenv("DB_MIGRATE_ON_START") == "false" {
+		statuses, err := MigrationStatuses(DB)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			if status.AppliedAt == nil {
+				return fmt.Errorf("migration %d_%s is pending: run the migrate command first", status.Version, status.Name)
+			}
+		}
+		return nil
 	}
 
-	return nil
+	// Run migrations
+	return migrateFunc(DB)
 }
@@ -7,6 +7,8 @@ import (
 	"family-calendar-backend/db/models"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
@@ -52,7 +54,7 @@ func TestInitDB_Migration(t *testing.T) {
 	hasColumn := DB.Migrator().HasColumn(&models.User{}, "Email")
 	assert.True(t, hasColumn)
 
-	hasColumn = DB.Migrator().HasColumn(&models.User{}, "AuthProviderID")
+	hasColumn = DB.Migrator().HasColumn(&models.UserIdentity{}, "Subject")
 	assert.True(t, hasColumn)
 
 	// Clean up
@@ -260,3 +262,56 @@ func TestInitDB_PostgresWithDefaults(t *testing.T) {
 		assert.NotContains(t, err.Error(), "unsupported database type")
 	}
 }
+
+func TestMigrate_BackfillsFeedTokens(t *testing.T) {
+	// A database AutoMigrate created, with calendar muxes from before feed tokens existed
+	testDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, testDB.AutoMigrate(legacyModels...))
+	testDB.Create(&models.CalendarMux{CreatedByID: 1, Name: "Old"})
+	testDB.Model(&models.CalendarMux{}).Where("1 = 1").Update("feed_token", nil)
+
+	require.NoError(t, Migrate(testDB))
+
+	var calendarMux models.CalendarMux
+	assert.NoError(t, testDB.First(&calendarMux).Error)
+	assert.Len(t, calendarMux.FeedToken, 64)
+}
+
+// preIdentityUser is the users table from before identities got their own table
+type preIdentityUser struct {
+	gorm.Model
+	GivenName      string `gorm:"not null;size:100"`
+	FamilyName     string `gorm:"not null;size:100"`
+	Email          string `gorm:"not null;size:255"`
+	AuthProvider   string `gorm:"not null;size:50;index:idx_auth_provider_id;check:auth_provider <> ''"`
+	AuthProviderID string `gorm:"not null;size:255;index:idx_auth_provider_id;check:auth_provider_id <> ''"`
+}
+
+func (preIdentityUser) TableName() string {
+	return "users"
+}
+
+func TestMigrateUserIdentities(t *testing.T) {
+	testDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, testDB.AutoMigrate(&preIdentityUser{}))
+	legacy := preIdentityUser{GivenName: "Old", FamilyName: "User", Email: "old@example.com", AuthProvider: "google", AuthProviderID: "google-123"}
+	require.NoError(t, testDB.Create(&legacy).Error)
+
+	require.NoError(t, migrateFunc(testDB))
+
+	// The identity moved to its own table and new users no longer need one in theirs
+	var identity models.UserIdentity
+	require.NoError(t, testDB.Where("provider = ? AND subject = ?", "google", "google-123").First(&identity).Error)
+	assert.Equal(t, legacy.ID, identity.UserID)
+	assert.Equal(t, "old@example.com", identity.Email)
+	assert.False(t, testDB.Migrator().HasColumn(&models.User{}, "auth_provider"))
+	assert.NoError(t, testDB.Create(&models.User{GivenName: "New", FamilyName: "User", Email: "new@example.com"}).Error)
+
+	// Migrating again changes nothing
+	require.NoError(t, migrateFunc(testDB))
+	var count int64
+	testDB.Model(&models.UserIdentity{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
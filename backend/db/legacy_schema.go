@@ -0,0 +1,212 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// The structs below freeze the models as they were when versioned migrations replaced
+// AutoMigrate. baselineLegacySchema brings old databases up to them, which leaves them matching
+// the initial migration however the models in db/models change afterwards. Do not edit them;
+// change the schema with a new migration instead.
+
+type legacyUser struct {
+	gorm.Model
+	GivenName  string               `gorm:"not null;size:100"`
+	FamilyName string               `gorm:"not null;size:100"`
+	Email      string               `gorm:"not null;size:255"`
+	Identities []legacyUserIdentity `gorm:"foreignKey:UserID"`
+}
+
+func (legacyUser) TableName() string { return "users" }
+
+type legacyHousehold struct {
+	gorm.Model
+	Name        string     `gorm:"not null;size:200"`
+	CreatedByID uint       `gorm:"not null;index"`
+	CreatedBy   legacyUser `gorm:"foreignKey:CreatedByID;constraint:OnDelete:CASCADE"`
+}
+
+func (legacyHousehold) TableName() string { return "households" }
+
+type legacyHouseholdMember struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	HouseholdID uint            `gorm:"not null;uniqueIndex:idx_household_member"`
+	Household   legacyHousehold `gorm:"foreignKey:HouseholdID;constraint:OnDelete:CASCADE"`
+	UserID      uint            `gorm:"not null;uniqueIndex:idx_household_member;index"`
+	User        legacyUser      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Role        string          `gorm:"not null;size:20"`
+}
+
+func (legacyHouseholdMember) TableName() string { return "household_members" }
+
+type legacyHouseholdInvite struct {
+	ID           uint `gorm:"primarykey"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	HouseholdID  uint            `gorm:"not null;index"`
+	Household    legacyHousehold `gorm:"foreignKey:HouseholdID;constraint:OnDelete:CASCADE"`
+	CreatedByID  uint            `gorm:"not null"`
+	CreatedBy    legacyUser      `gorm:"foreignKey:CreatedByID;constraint:OnDelete:CASCADE"`
+	Role         string          `gorm:"not null;size:20"`
+	TokenHash    string          `gorm:"not null;size:64;uniqueIndex"`
+	ExpiresAt    time.Time       `gorm:"not null"`
+	AcceptedByID *uint
+	AcceptedBy   *legacyUser `gorm:"foreignKey:AcceptedByID;constraint:OnDelete:SET NULL"`
+	AcceptedAt   *time.Time
+	RevokedAt    *time.Time
+}
+
+func (legacyHouseholdInvite) TableName() string { return "household_invites" }
+
+type legacyCalendarMux struct {
+	gorm.Model
+	CreatedByID   uint             `gorm:"not null;index"`
+	CreatedBy     legacyUser       `gorm:"foreignKey:CreatedByID;constraint:OnDelete:CASCADE"`
+	HouseholdID   *uint            `gorm:"index"`
+	Household     *legacyHousehold `gorm:"foreignKey:HouseholdID;constraint:OnDelete:SET NULL"`
+	Name          string           `gorm:"not null;size:200"`
+	Description   string           `gorm:"size:1000"`
+	FeedToken     string           `gorm:"size:64;uniqueIndex"`
+	DedupDisabled bool             `gorm:"not null;default:false"`
+}
+
+func (legacyCalendarMux) TableName() string { return "calendar_muxes" }
+
+type legacyCalendarSource struct {
+	gorm.Model
+	CalendarMuxID  uint              `gorm:"not null;index"`
+	CalendarMux    legacyCalendarMux `gorm:"foreignKey:CalendarMuxID;constraint:OnDelete:CASCADE"`
+	URL            string            `gorm:"not null;size:2048"`
+	Label          string            `gorm:"not null;size:200"`
+	Enabled        bool              `gorm:"not null"`
+	Visibility     string            `gorm:"not null;size:20;default:full"`
+	LastSyncAt     *time.Time
+	LastSuccessAt  *time.Time
+	LastErrorAt    *time.Time
+	LastError      string `gorm:"size:1000"`
+	UnchangedSince *time.Time
+	Timezones      string `gorm:"type:text"`
+	ETag           string `gorm:"column:etag;size:255"`
+	LastModified   string `gorm:"size:64"`
+}
+
+func (legacyCalendarSource) TableName() string { return "calendar_sources" }
+
+type legacyCalendarEvent struct {
+	ID               uint `gorm:"primarykey"`
+	CreatedAt        time.Time
+	CalendarSourceID uint                 `gorm:"not null;index"`
+	CalendarSource   legacyCalendarSource `gorm:"foreignKey:CalendarSourceID;constraint:OnDelete:CASCADE"`
+	UID              string               `gorm:"not null;size:1024"`
+	RecurrenceID     string               `gorm:"size:64"`
+	Summary          string               `gorm:"size:1000"`
+	Data             string               `gorm:"type:text;not null"`
+}
+
+func (legacyCalendarEvent) TableName() string { return "calendar_events" }
+
+type legacyRewriteRule struct {
+	gorm.Model
+	CalendarSourceID uint                 `gorm:"not null;index"`
+	CalendarSource   legacyCalendarSource `gorm:"foreignKey:CalendarSourceID;constraint:OnDelete:CASCADE"`
+	Position         int                  `gorm:"not null"`
+	Action           string               `gorm:"not null;size:20"`
+	Pattern          string               `gorm:"size:500"`
+	Value            string               `gorm:"size:500"`
+}
+
+func (legacyRewriteRule) TableName() string { return "rewrite_rules" }
+
+type legacySession struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uint       `gorm:"not null;index"`
+	User       legacyUser `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	UserAgent  string     `gorm:"size:500"`
+	IPAddress  string     `gorm:"size:45"`
+	LastUsedAt time.Time
+	ExpiresAt  time.Time `gorm:"not null"`
+	RevokedAt  *time.Time
+}
+
+func (legacySession) TableName() string { return "sessions" }
+
+type legacyRefreshToken struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uint          `gorm:"not null;index"`
+	User      legacyUser    `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	TokenHash string        `gorm:"not null;size:64;uniqueIndex"`
+	SessionID uint          `gorm:"not null;index"`
+	Session   legacySession `gorm:"foreignKey:SessionID;constraint:OnDelete:CASCADE"`
+	ExpiresAt time.Time     `gorm:"not null"`
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+func (legacyRefreshToken) TableName() string { return "refresh_tokens" }
+
+type legacyUserIdentity struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uint       `gorm:"not null;index"`
+	User      legacyUser `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Provider  string     `gorm:"not null;size:50;uniqueIndex:idx_identity_provider_subject;check:provider <> ''"`
+	Subject   string     `gorm:"not null;size:255;uniqueIndex:idx_identity_provider_subject;check:subject <> ''"`
+	Email     string     `gorm:"not null;size:255"`
+}
+
+func (legacyUserIdentity) TableName() string { return "user_identities" }
+
+type legacyIdentityLink struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    uint       `gorm:"not null;index"`
+	User      legacyUser `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	TokenHash string     `gorm:"not null;size:64;uniqueIndex"`
+	Merge     bool       `gorm:"not null;default:false"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time
+}
+
+func (legacyIdentityLink) TableName() string { return "identity_links" }
+
+type legacyPersonalAccessToken struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uint       `gorm:"not null;index"`
+	User       legacyUser `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Name       string     `gorm:"not null;size:100"`
+	TokenHash  string     `gorm:"not null;size:64;uniqueIndex"`
+	Scopes     string     `gorm:"not null;size:200"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+}
+
+func (legacyPersonalAccessToken) TableName() string { return "personal_access_tokens" }
+
+type legacyAuthorizationCode struct {
+	ID            uint `gorm:"primarykey"`
+	CreatedAt     time.Time
+	UserID        uint       `gorm:"not null;index"`
+	User          legacyUser `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	CodeHash      string     `gorm:"not null;size:64;uniqueIndex"`
+	CodeChallenge string     `gorm:"not null;size:128"`
+	RedirectURI   string     `gorm:"not null;size:2000"`
+	ExpiresAt     time.Time  `gorm:"not null"`
+	UsedAt        *time.Time
+}
+
+func (legacyAuthorizationCode) TableName() string { return "authorization_codes" }
+
+// legacyModels are the snapshots of the models AutoMigrate kept up to date before versioned
+// migrations. Together they match what the initial migration creates.
+var legacyModels = []interface{}{&legacyUser{}, &legacyHousehold{}, &legacyHouseholdMember{}, &legacyHouseholdInvite{}, &legacyCalendarMux{}, &legacyCalendarSource{}, &legacyCalendarEvent{}, &legacyRewriteRule{}, &legacySession{}, &legacyRefreshToken{}, &legacyUserIdentity{}, &legacyIdentityLink{}, &legacyPersonalAccessToken{}, &legacyAuthorizationCode{}}
@@ -0,0 +1,332 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationFilePattern matches migration scripts such as 0002_add_audit_log.up.sql
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// migrationLockID is the Postgres advisory lock held while migrating, so that replicas starting
+// together apply each migration once
+const migrationLockID = 4721903318
+
+// Migration is one versioned change of the schema, with a script to apply it and one to undo it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is a migration together with when it was applied, if it was
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// schemaMigration is a row of schema_migrations, which records the applied migrations
+type schemaMigration struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// loadMigrations reads the migrations of a database dialect, ordered by version
+func loadMigrations(dialect string) ([]Migration, error) {
+	dir := "migrations/" + dialect
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for database type %s", dialect)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %s/%s", dir, entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		script, err := fs.ReadFile(migrationFiles, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration := byVersion[version]
+		if migration == nil {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(script)
+		} else {
+			migration.Down = string(script)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// withMigrationLock runs fc on a single connection while no other instance migrates the same
+// database. Postgres uses an advisory lock. SQLite has a single writer anyway; a migration that
+// another process applied in the meantime is skipped, or fails to record itself and rolls back.
+func withMigrationLock(db *gorm.DB, fc func(conn *gorm.DB) error) error {
+	return db.Connection(func(conn *gorm.DB) error {
+		// Start every statement afresh on this connection
+		conn = conn.Session(&gorm.Session{NewDB: true})
+		if conn.Dialector.Name() == "postgres" {
+			if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockID).Error; err != nil {
+				return fmt.Errorf("failed to lock migrations: %w", err)
+			}
+			defer conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockID)
+		}
+
+		err := conn.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint PRIMARY KEY,
+			name varchar(255) NOT NULL,
+			applied_at timestamp NOT NULL
+		)`).Error
+		if err != nil {
+			return err
+		}
+		return fc(conn)
+	})
+}
+
+// appliedMigrations returns the applied migrations by version. A database that AutoMigrate
+// created before there were versioned migrations is baselined first.
+func appliedMigrations(conn *gorm.DB, migrations []Migration) (map[int]schemaMigration, error) {
+	var rows []schemaMigration
+	if err := conn.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 && conn.Migrator().HasTable("users") {
+		if err := baselineLegacySchema(conn, migrations); err != nil {
+			return nil, err
+		}
+		if err := conn.Order("version").Find(&rows).Error; err != nil {
+			return nil, err
+		}
+	}
+	applied := make(map[int]schemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// runMigration applies or undoes one migration in a transaction, together with its record
+func runMigration(conn *gorm.DB, migration Migration, up bool) error {
+	return conn.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&schemaMigration{}).Where("version = ?", migration.Version).Count(&count).Error; err != nil {
+			return err
+		}
+		if (count > 0) == up {
+			// Another instance got here first
+			return nil
+		}
+
+		script := migration.Down
+		if up {
+			script = migration.Up
+		}
+		// Scripts hold several statements and must not be parsed for placeholders
+		if _, err := tx.Statement.ConnPool.ExecContext(context.Background(), script); err != nil {
+			direction := "down"
+			if up {
+				direction = "up"
+			}
+			return fmt.Errorf("migration %d_%s %s failed: %w", migration.Version, migration.Name, direction, err)
+		}
+
+		if up {
+			return tx.Create(&schemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now().UTC()}).Error
+		}
+		return tx.Where("version = ?", migration.Version).Delete(&schemaMigration{}).Error
+	})
+}
+
+// Migrate applies all pending migrations
+func Migrate(db *gorm.DB) error {
+	migrations, err := loadMigrations(db.Dialector.Name())
+	if err != nil {
+		return err
+	}
+
+	return withMigrationLock(db, func(conn *gorm.DB) error {
+		applied, err := appliedMigrations(conn, migrations)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := runMigration(conn, migration, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateTo applies or undoes migrations until the given version is the latest one applied.
+// Version 0 undoes all of them.
+func MigrateTo(db *gorm.DB, version int) error {
+	migrations, err := loadMigrations(db.Dialector.Name())
+	if err != nil {
+		return err
+	}
+	known := version == 0
+	for _, migration := range migrations {
+		known = known || migration.Version == version
+	}
+	if !known {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+
+	return withMigrationLock(db, func(conn *gorm.DB) error {
+		applied, err := appliedMigrations(conn, migrations)
+		if err != nil {
+			return err
+		}
+		if err := checkKnownMigrations(applied, migrations); err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0; i-- {
+			if _, ok := applied[migrations[i].Version]; ok && migrations[i].Version > version {
+				if err := runMigration(conn, migrations[i], false); err != nil {
+					return err
+				}
+			}
+		}
+		for _, migration := range migrations {
+			if _, ok := applied[migration.Version]; !ok && migration.Version <= version {
+				if err := runMigration(conn, migration, true); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// RollbackMigrations undoes the given number of most recently applied migrations
+func RollbackMigrations(db *gorm.DB, steps int) error {
+	migrations, err := loadMigrations(db.Dialector.Name())
+	if err != nil {
+		return err
+	}
+
+	return withMigrationLock(db, func(conn *gorm.DB) error {
+		applied, err := appliedMigrations(conn, migrations)
+		if err != nil {
+			return err
+		}
+		if err := checkKnownMigrations(applied, migrations); err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			if _, ok := applied[migrations[i].Version]; !ok {
+				continue
+			}
+			if err := runMigration(conn, migrations[i], false); err != nil {
+				return err
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// checkKnownMigrations refuses to undo migrations of a database that a newer build migrated,
+// since this build does not have their down scripts
+func checkKnownMigrations(applied map[int]schemaMigration, migrations []Migration) error {
+	known := make(map[int]bool, len(migrations))
+	for _, migration := range migrations {
+		known[migration.Version] = true
+	}
+	for version, row := range applied {
+		if !known[version] {
+			return fmt.Errorf("database has migration %d_%s, which this build does not know", version, row.Name)
+		}
+	}
+	return nil
+}
+
+// MigrationStatuses lists the migrations of this build and whether they have been applied
+func MigrationStatuses(db *gorm.DB) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []schemaMigration
+	if db.Migrator().HasTable(&schemaMigration{}) {
+		if err := db.Find(&rows).Error; err != nil {
+			return nil, err
+		}
+	}
+	applied := make(map[int]schemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, migration := range migrations {
+		statuses[i].Migration = migration
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			statuses[i].AppliedAt = &appliedAt
+		}
+	}
+	return statuses, nil
+}
+
+// baselineLegacySchema upgrades a database from before versioned migrations with AutoMigrate of
+// the frozen legacy models and its data fixes, which leaves it matching the initial migration,
+// and records the initial migration as applied. The later migrations then run as usual.
+func baselineLegacySchema(conn *gorm.DB, migrations []Migration) error {
+	if err := conn.AutoMigrate(legacyModels...); err != nil {
+		return err
+	}
+	if err := migrateUserIdentities(conn); err != nil {
+		return err
+	}
+	if err := backfillFeedTokens(conn); err != nil {
+		return err
+	}
+
+	initial := migrations[0]
+	return conn.Create(&schemaMigration{Version: initial.Version, Name: initial.Name, AppliedAt: time.Now().UTC()}).Error
+}
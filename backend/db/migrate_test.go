@@ -0,0 +1,207 @@
+package db
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"family-calendar-backend/db/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	testDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	// Keep the in-memory database on one connection
+	sqlDB, err := testDB.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	return testDB
+}
+
+// statementLogger records the SQL statements a session runs
+type statementLogger struct {
+	logger.Interface
+	statements *[]string
+}
+
+func (l statementLogger) LogMode(logger.LogLevel) logger.Interface {
+	return l
+}
+
+func (l statementLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sql, _ := fc()
+	*l.statements = append(*l.statements, sql)
+}
+
+func TestLoadMigrations_DialectsMatch(t *testing.T) {
+	sqliteMigrations, err := loadMigrations("sqlite")
+	require.NoError(t, err)
+	postgresMigrations, err := loadMigrations("postgres")
+	require.NoError(t, err)
+
+	require.NotEmpty(t, sqliteMigrations)
+	require.Len(t, postgresMigrations, len(sqliteMigrations))
+	for i := range sqliteMigrations {
+		assert.Equal(t, sqliteMigrations[i].Version, postgresMigrations[i].Version)
+		assert.Equal(t, sqliteMigrations[i].Name, postgresMigrations[i].Name)
+		if i > 0 {
+			assert.Greater(t, sqliteMigrations[i].Version, sqliteMigrations[i-1].Version)
+		}
+	}
+
+	_, err = loadMigrations("mysql")
+	assert.ErrorContains(t, err, "no migrations for database type mysql")
+}
+
+// schemaModels are all models. Together they must match what all migrations create.
+var schemaModels = []interface{}{&models.User{}, &models.Household{}, &models.HouseholdMember{}, &models.HouseholdInvite{}, &models.CalendarMux{}, &models.CalendarSource{}, &models.CalendarEvent{}, &models.RewriteRule{}, &models.Session{}, &models.RefreshToken{}, &models.UserIdentity{}, &models.IdentityLink{}, &models.PersonalAccessToken{}, &models.AuthorizationCode{}, &models.AuditLog{}}
+
+func TestMigrate_MatchesModels(t *testing.T) {
+	testDB := openTestDB(t)
+	require.NoError(t, Migrate(testDB))
+
+	// AutoMigrate finds nothing to change once the migrations ran
+	var statements []string
+	session := testDB.Session(&gorm.Session{Logger: statementLogger{statements: &statements}})
+	require.NoError(t, session.AutoMigrate(schemaModels...))
+	for _, statement := range statements {
+		assert.False(t, strings.HasPrefix(statement, "CREATE") || strings.HasPrefix(statement, "ALTER") || strings.HasPrefix(statement, "DROP"),
+			"the migrations differ from the models: AutoMigrate ran %s", statement)
+	}
+}
+
+func TestMigrate_UpDownAndStatus(t *testing.T) {
+	testDB := openTestDB(t)
+	migrations, err := loadMigrations("sqlite")
+	require.NoError(t, err)
+	latest := migrations[len(migrations)-1].Version
+
+	statuses, err := MigrationStatuses(testDB)
+	require.NoError(t, err)
+	for _, status := range statuses {
+		assert.Nil(t, status.AppliedAt)
+	}
+
+	require.NoError(t, Migrate(testDB))
+	// Migrating again changes nothing
+	require.NoError(t, Migrate(testDB))
+
+	statuses, err = MigrationStatuses(testDB)
+	require.NoError(t, err)
+	require.Len(t, statuses, len(migrations))
+	for _, status := range statuses {
+		assert.NotNil(t, status.AppliedAt, "migration %d", status.Version)
+	}
+	assert.True(t, testDB.Migrator().HasTable("users"))
+
+	// Rolling back undoes the latest migration
+	require.NoError(t, RollbackMigrations(testDB, 1))
+	statuses, err = MigrationStatuses(testDB)
+	require.NoError(t, err)
+	assert.Nil(t, statuses[len(statuses)-1].AppliedAt)
+
+	// Down to nothing and back up
+	require.NoError(t, MigrateTo(testDB, 0))
+	assert.False(t, testDB.Migrator().HasTable("users"))
+	require.NoError(t, MigrateTo(testDB, latest))
+	assert.True(t, testDB.Migrator().HasTable("users"))
+
+	assert.ErrorContains(t, MigrateTo(testDB, latest+1), "unknown migration version")
+}
+
+func TestMigrate_RefusesUnknownAppliedMigrations(t *testing.T) {
+	testDB := openTestDB(t)
+	require.NoError(t, Migrate(testDB))
+	require.NoError(t, testDB.Create(&schemaMigration{Version: 9999, Name: "from_a_newer_build", AppliedAt: time.Now()}).Error)
+
+	// A newer schema does not stop older builds from starting, but they cannot undo it
+	assert.NoError(t, Migrate(testDB))
+	assert.ErrorContains(t, RollbackMigrations(testDB, 1), "9999_from_a_newer_build")
+}
+
+func TestRunMigration_FailureRollsBack(t *testing.T) {
+	testDB := openTestDB(t)
+	require.NoError(t, Migrate(testDB))
+	broken := Migration{
+		Version: 9999,
+		Name:    "broken",
+		Up:      "CREATE TABLE half_done (id integer); ALTER TABLE missing ADD COLUMN x integer;",
+		Down:    "DROP TABLE half_done;",
+	}
+
+	err := testDB.Connection(func(conn *gorm.DB) error {
+		return runMigration(conn.Session(&gorm.Session{NewDB: true}), broken, true)
+	})
+
+	assert.ErrorContains(t, err, "migration 9999_broken up failed")
+	assert.False(t, testDB.Migrator().HasTable("half_done"))
+	var count int64
+	testDB.Model(&schemaMigration{}).Where("version = ?", 9999).Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestMigrate_BaselinesLegacyDatabase(t *testing.T) {
+	testDB := openTestDB(t)
+	require.NoError(t, testDB.AutoMigrate(legacyModels...))
+
+	require.NoError(t, Migrate(testDB))
+
+	statuses, err := MigrationStatuses(testDB)
+	require.NoError(t, err)
+	for _, status := range statuses {
+		assert.NotNil(t, status.AppliedAt, "migration %d", status.Version)
+	}
+	// Migrations newer than the legacy schema ran rather than being recorded as applied
+	assert.True(t, testDB.Migrator().HasTable(&models.AuditLog{}))
+}
+
+func TestMigrate_LegacySchemaMatchesInitialMigration(t *testing.T) {
+	migrations, err := loadMigrations("sqlite")
+	require.NoError(t, err)
+	testDB := openTestDB(t)
+	require.NoError(t, MigrateTo(testDB, migrations[0].Version))
+
+	// The frozen legacy models stay what the initial migration created, whatever the models
+	// gain later, so a baseline never creates what a later migration adds
+	var statements []string
+	session := testDB.Session(&gorm.Session{Logger: statementLogger{statements: &statements}})
+	require.NoError(t, session.AutoMigrate(legacyModels...))
+	for _, statement := range statements {
+		assert.False(t, strings.HasPrefix(statement, "CREATE") || strings.HasPrefix(statement, "ALTER") || strings.HasPrefix(statement, "DROP"),
+			"the legacy models differ from the initial migration: AutoMigrate ran %s", statement)
+	}
+}
+
+func TestMigrate_AuditLogIsAppendOnly(t *testing.T) {
+	testDB := openTestDB(t)
+	require.NoError(t, Migrate(testDB))
+	entry := &models.AuditLog{ActorID: 1, Action: models.AuditActionCreate, EntityType: models.AuditEntityCalendarMux, EntityID: 1, Changes: "{}"}
+	require.NoError(t, testDB.Create(entry).Error)
+
+	assert.ErrorContains(t, testDB.Model(entry).Update("action", models.AuditActionDelete).Error, "append-only")
+	assert.ErrorContains(t, testDB.Delete(entry).Error, "append-only")
+	var count int64
+	testDB.Model(&models.AuditLog{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestInitDB_MigrateOnStartDisabled(t *testing.T) {
+	os.Setenv("DB_TYPE", "sqlite")
+	defer os.Unsetenv("DB_TYPE")
+	t.Setenv("DB_MIGRATE_ON_START", "false")
+
+	err := InitDB()
+
+	assert.ErrorContains(t, err, "is pending: run the migrate command first")
+	sqlDB, err := DB.DB()
+	require.NoError(t, err)
+	sqlDB.Close()
+}
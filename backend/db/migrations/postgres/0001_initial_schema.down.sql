@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS "authorization_codes";
+DROP TABLE IF EXISTS "personal_access_tokens";
+DROP TABLE IF EXISTS "identity_links";
+DROP TABLE IF EXISTS "user_identities";
+DROP TABLE IF EXISTS "refresh_tokens";
+DROP TABLE IF EXISTS "sessions";
+DROP TABLE IF EXISTS "rewrite_rules";
+DROP TABLE IF EXISTS "calendar_events";
+DROP TABLE IF EXISTS "calendar_sources";
+DROP TABLE IF EXISTS "calendar_muxes";
+DROP TABLE IF EXISTS "household_invites";
+DROP TABLE IF EXISTS "household_members";
+DROP TABLE IF EXISTS "households";
+DROP TABLE IF EXISTS "users";
@@ -0,0 +1,227 @@
+-- The schema as GORM AutoMigrate left it before versioned migrations
+
+CREATE TABLE "users" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "given_name" varchar(100) NOT NULL,
+    "family_name" varchar(100) NOT NULL,
+    "email" varchar(255) NOT NULL,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users" ("deleted_at");
+
+CREATE TABLE "households" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "name" varchar(200) NOT NULL,
+    "created_by_id" bigint NOT NULL,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_households_created_by" FOREIGN KEY ("created_by_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_households_created_by_id" ON "households" ("created_by_id");
+CREATE INDEX IF NOT EXISTS "idx_households_deleted_at" ON "households" ("deleted_at");
+
+CREATE TABLE "household_members" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "household_id" bigint NOT NULL,
+    "user_id" bigint NOT NULL,
+    "role" varchar(20) NOT NULL,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_household_members_household" FOREIGN KEY ("household_id") REFERENCES "households"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_household_members_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_household_members_user_id" ON "household_members" ("user_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_household_member" ON "household_members" ("household_id","user_id");
+
+CREATE TABLE "household_invites" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "household_id" bigint NOT NULL,
+    "created_by_id" bigint NOT NULL,
+    "role" varchar(20) NOT NULL,
+    "token_hash" varchar(64) NOT NULL,
+    "expires_at" timestamptz NOT NULL,
+    "accepted_by_id" bigint,
+    "accepted_at" timestamptz,
+    "revoked_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_household_invites_household" FOREIGN KEY ("household_id") REFERENCES "households"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_household_invites_created_by" FOREIGN KEY ("created_by_id") REFERENCES "users"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_household_invites_accepted_by" FOREIGN KEY ("accepted_by_id") REFERENCES "users"("id") ON DELETE SET NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_household_invites_token_hash" ON "household_invites" ("token_hash");
+CREATE INDEX IF NOT EXISTS "idx_household_invites_household_id" ON "household_invites" ("household_id");
+
+CREATE TABLE "calendar_muxes" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "created_by_id" bigint NOT NULL,
+    "household_id" bigint,
+    "name" varchar(200) NOT NULL,
+    "description" varchar(1000),
+    "feed_token" varchar(64),
+    "dedup_disabled" boolean NOT NULL DEFAULT false,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_calendar_muxes_created_by" FOREIGN KEY ("created_by_id") REFERENCES "users"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_calendar_muxes_household" FOREIGN KEY ("household_id") REFERENCES "households"("id") ON DELETE SET NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_calendar_muxes_feed_token" ON "calendar_muxes" ("feed_token");
+CREATE INDEX IF NOT EXISTS "idx_calendar_muxes_household_id" ON "calendar_muxes" ("household_id");
+CREATE INDEX IF NOT EXISTS "idx_calendar_muxes_created_by_id" ON "calendar_muxes" ("created_by_id");
+CREATE INDEX IF NOT EXISTS "idx_calendar_muxes_deleted_at" ON "calendar_muxes" ("deleted_at");
+
+CREATE TABLE "calendar_sources" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "calendar_mux_id" bigint NOT NULL,
+    "url" varchar(2048) NOT NULL,
+    "label" varchar(200) NOT NULL,
+    "enabled" boolean NOT NULL,
+    "visibility" varchar(20) NOT NULL DEFAULT 'full',
+    "last_sync_at" timestamptz,
+    "last_success_at" timestamptz,
+    "last_error_at" timestamptz,
+    "last_error" varchar(1000),
+    "unchanged_since" timestamptz,
+    "timezones" text,
+    "etag" varchar(255),
+    "last_modified" varchar(64),
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_calendar_sources_calendar_mux" FOREIGN KEY ("calendar_mux_id") REFERENCES "calendar_muxes"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_calendar_sources_calendar_mux_id" ON "calendar_sources" ("calendar_mux_id");
+CREATE INDEX IF NOT EXISTS "idx_calendar_sources_deleted_at" ON "calendar_sources" ("deleted_at");
+
+CREATE TABLE "calendar_events" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "calendar_source_id" bigint NOT NULL,
+    "uid" varchar(1024) NOT NULL,
+    "recurrence_id" varchar(64),
+    "summary" varchar(1000),
+    "data" text NOT NULL,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_calendar_events_calendar_source" FOREIGN KEY ("calendar_source_id") REFERENCES "calendar_sources"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_calendar_events_calendar_source_id" ON "calendar_events" ("calendar_source_id");
+
+CREATE TABLE "rewrite_rules" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "calendar_source_id" bigint NOT NULL,
+    "position" bigint NOT NULL,
+    "action" varchar(20) NOT NULL,
+    "pattern" varchar(500),
+    "value" varchar(500),
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_rewrite_rules_calendar_source" FOREIGN KEY ("calendar_source_id") REFERENCES "calendar_sources"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_rewrite_rules_calendar_source_id" ON "rewrite_rules" ("calendar_source_id");
+CREATE INDEX IF NOT EXISTS "idx_rewrite_rules_deleted_at" ON "rewrite_rules" ("deleted_at");
+
+CREATE TABLE "sessions" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "user_id" bigint NOT NULL,
+    "user_agent" varchar(500),
+    "ip_address" varchar(45),
+    "last_used_at" timestamptz,
+    "expires_at" timestamptz NOT NULL,
+    "revoked_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_sessions_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_sessions_user_id" ON "sessions" ("user_id");
+
+CREATE TABLE "refresh_tokens" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "user_id" bigint NOT NULL,
+    "token_hash" varchar(64) NOT NULL,
+    "session_id" bigint NOT NULL,
+    "expires_at" timestamptz NOT NULL,
+    "used_at" timestamptz,
+    "revoked_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_refresh_tokens_session" FOREIGN KEY ("session_id") REFERENCES "sessions"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_refresh_tokens_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_refresh_tokens_session_id" ON "refresh_tokens" ("session_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_refresh_tokens_token_hash" ON "refresh_tokens" ("token_hash");
+CREATE INDEX IF NOT EXISTS "idx_refresh_tokens_user_id" ON "refresh_tokens" ("user_id");
+
+CREATE TABLE "user_identities" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "user_id" bigint NOT NULL,
+    "provider" varchar(50) NOT NULL,
+    "subject" varchar(255) NOT NULL,
+    "email" varchar(255) NOT NULL,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_users_identities" FOREIGN KEY ("user_id") REFERENCES "users"("id"),
+    CONSTRAINT "chk_user_identities_subject" CHECK (subject <> ''),
+    CONSTRAINT "chk_user_identities_provider" CHECK (provider <> '')
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_identity_provider_subject" ON "user_identities" ("provider","subject");
+CREATE INDEX IF NOT EXISTS "idx_user_identities_user_id" ON "user_identities" ("user_id");
+
+CREATE TABLE "identity_links" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "user_id" bigint NOT NULL,
+    "token_hash" varchar(64) NOT NULL,
+    "merge" boolean NOT NULL DEFAULT false,
+    "expires_at" timestamptz NOT NULL,
+    "used_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_identity_links_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_identity_links_token_hash" ON "identity_links" ("token_hash");
+CREATE INDEX IF NOT EXISTS "idx_identity_links_user_id" ON "identity_links" ("user_id");
+
+CREATE TABLE "personal_access_tokens" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "user_id" bigint NOT NULL,
+    "name" varchar(100) NOT NULL,
+    "token_hash" varchar(64) NOT NULL,
+    "scopes" varchar(200) NOT NULL,
+    "expires_at" timestamptz,
+    "last_used_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_personal_access_tokens_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_personal_access_tokens_token_hash" ON "personal_access_tokens" ("token_hash");
+CREATE INDEX IF NOT EXISTS "idx_personal_access_tokens_user_id" ON "personal_access_tokens" ("user_id");
+
+CREATE TABLE "authorization_codes" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "user_id" bigint NOT NULL,
+    "code_hash" varchar(64) NOT NULL,
+    "code_challenge" varchar(128) NOT NULL,
+    "redirect_uri" varchar(2000) NOT NULL,
+    "expires_at" timestamptz NOT NULL,
+    "used_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_authorization_codes_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_authorization_codes_code_hash" ON "authorization_codes" ("code_hash");
+CREATE INDEX IF NOT EXISTS "idx_authorization_codes_user_id" ON "authorization_codes" ("user_id");
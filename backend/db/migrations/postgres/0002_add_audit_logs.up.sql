@@ -0,0 +1,28 @@
+-- Append-only audit trail of changes to calendar muxes, sources and household membership
+
+CREATE TABLE "audit_logs" (
+    "id" bigserial,
+    "created_at" timestamptz NOT NULL,
+    "actor_id" bigint NOT NULL,
+    "action" varchar(20) NOT NULL,
+    "entity_type" varchar(50) NOT NULL,
+    "entity_id" bigint NOT NULL,
+    "household_id" bigint,
+    "changes" text NOT NULL,
+    "request_id" varchar(100),
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_audit_logs_actor_id" ON "audit_logs" ("actor_id");
+CREATE INDEX IF NOT EXISTS "idx_audit_logs_entity" ON "audit_logs" ("entity_type","entity_id");
+CREATE INDEX IF NOT EXISTS "idx_audit_logs_household_id" ON "audit_logs" ("household_id");
+
+CREATE FUNCTION "audit_logs_append_only"() RETURNS trigger LANGUAGE plpgsql AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_logs is append-only';
+END;
+$$;
+
+CREATE TRIGGER "audit_logs_no_update_or_delete" BEFORE UPDATE OR DELETE ON "audit_logs"
+    FOR EACH ROW EXECUTE FUNCTION "audit_logs_append_only"();
+CREATE TRIGGER "audit_logs_no_truncate" BEFORE TRUNCATE ON "audit_logs"
+    FOR EACH STATEMENT EXECUTE FUNCTION "audit_logs_append_only"();
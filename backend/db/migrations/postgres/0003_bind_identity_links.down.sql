@@ -0,0 +1,4 @@
+ALTER TABLE "identity_links" DROP CONSTRAINT IF EXISTS "fk_identity_links_merge_user";
+ALTER TABLE "identity_links" DROP CONSTRAINT IF EXISTS "fk_identity_links_session";
+ALTER TABLE "identity_links" DROP COLUMN IF EXISTS "merge_user_id";
+ALTER TABLE "identity_links" DROP COLUMN IF EXISTS "session_id";
@@ -0,0 +1,6 @@
+-- Bind identity links to the session that requested them, and hold merges for confirmation
+
+ALTER TABLE "identity_links" ADD COLUMN "session_id" bigint;
+ALTER TABLE "identity_links" ADD COLUMN "merge_user_id" bigint;
+ALTER TABLE "identity_links" ADD CONSTRAINT "fk_identity_links_session" FOREIGN KEY ("session_id") REFERENCES "sessions"("id") ON DELETE CASCADE;
+ALTER TABLE "identity_links" ADD CONSTRAINT "fk_identity_links_merge_user" FOREIGN KEY ("merge_user_id") REFERENCES "users"("id") ON DELETE SET NULL;
@@ -0,0 +1,213 @@
+-- The schema as GORM AutoMigrate left it before versioned migrations
+
+CREATE TABLE `users` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    `given_name` text NOT NULL,
+    `family_name` text NOT NULL,
+    `email` text NOT NULL
+);
+CREATE INDEX `idx_users_deleted_at` ON `users`(`deleted_at`);
+
+CREATE TABLE `households` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    `name` text NOT NULL,
+    `created_by_id` integer NOT NULL,
+    CONSTRAINT `fk_households_created_by` FOREIGN KEY (`created_by_id`) REFERENCES `users`(`id`) ON DELETE CASCADE
+);
+CREATE INDEX `idx_households_created_by_id` ON `households`(`created_by_id`);
+CREATE INDEX `idx_households_deleted_at` ON `households`(`deleted_at`);
+
+CREATE TABLE `household_members` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `household_id` integer NOT NULL,
+    `user_id` integer NOT NULL,
+    `role` text NOT NULL,
+    CONSTRAINT `fk_household_members_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`) ON DELETE CASCADE,
+    CONSTRAINT `fk_household_members_household` FOREIGN KEY (`household_id`) REFERENCES `households`(`id`) ON DELETE CASCADE
+);
+CREATE INDEX `idx_household_members_user_id` ON `household_members`(`user_id`);
+CREATE UNIQUE INDEX `idx_household_member` ON `household_members`(`household_id`,`user_id`);
+
+CREATE TABLE `household_invites` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `household_id` integer NOT NULL,
+    `created_by_id` integer NOT NULL,
+    `role` text NOT NULL,
+    `token_hash` text NOT NULL,
+    `expires_at` datetime NOT NULL,
+    `accepted_by_id` integer,
+    `accepted_at` datetime,
+    `revoked_at` datetime,
+    CONSTRAINT `fk_household_invites_created_by` FOREIGN KEY (`created_by_id`) REFERENCES `users`(`id`) ON DELETE CASCADE,
+    CONSTRAINT `fk_household_invites_accepted_by` FOREIGN KEY (`accepted_by_id`) REFERENCES `users`(`id`) ON DELETE SET NULL,
+    CONSTRAINT `fk_household_invites_household` FOREIGN KEY (`household_id`) REFERENCES `households`(`id`) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX `idx_household_invites_token_hash` ON `household_invites`(`token_hash`);
+CREATE INDEX `idx_household_invites_household_id` ON `household_invites`(`household_id`);
+
+CREATE TABLE `calendar_muxes` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    `created_by_id` integer NOT NULL,
+    `household_id` integer,
+    `name` text NOT NULL,
+    `description` text,
+    `feed_token` text,
+    `dedup_disabled` numeric NOT NULL DEFAULT false,
+    CONSTRAINT `fk_calendar_muxes_household` FOREIGN KEY (`household_id`) REFERENCES `households`(`id`) ON DELETE SET NULL,
+    CONSTRAINT `fk_calendar_muxes_created_by` FOREIGN KEY (`created_by_id`) REFERENCES `users`(`id`) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX `idx_calendar_muxes_feed_token` ON `calendar_muxes`(`feed_token`);
+CREATE INDEX `idx_calendar_muxes_household_id` ON `calendar_muxes`(`household_id`);
+CREATE INDEX `idx_calendar_muxes_created_by_id` ON `calendar_muxes`(`created_by_id`);
+CREATE INDEX `idx_calendar_muxes_deleted_at` ON `calendar_muxes`(`deleted_at`);
+
+CREATE TABLE `calendar_sources` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    `calendar_mux_id` integer NOT NULL,
+    `url` text NOT NULL,
+    `label` text NOT NULL,
+    `enabled` numeric NOT NULL,
+    `visibility` text NOT NULL DEFAULT "full",
+    `last_sync_at` datetime,
+    `last_success_at` datetime,
+    `last_error_at` datetime,
+    `last_error` text,
+    `unchanged_since` datetime,
+    `timezones` text,
+    `etag` text,
+    `last_modified` text,
+    CONSTRAINT `fk_calendar_sources_calendar_mux` FOREIGN KEY (`calendar_mux_id`) REFERENCES `calendar_muxes`(`id`) ON DELETE CASCADE
+);
+CREATE INDEX `idx_calendar_sources_calendar_mux_id` ON `calendar_sources`(`calendar_mux_id`);
+CREATE INDEX `idx_calendar_sources_deleted_at` ON `calendar_sources`(`deleted_at`);
+
+CREATE TABLE `calendar_events` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `calendar_source_id` integer NOT NULL,
+    `uid` text NOT NULL,
+    `recurrence_id` text,
+    `summary` text,
+    `data` text NOT NULL,
+    CONSTRAINT `fk_calendar_events_calendar_source` FOREIGN KEY (`calendar_source_id`) REFERENCES `calendar_sources`(`id`) ON DELETE CASCADE
+);
+CREATE INDEX `idx_calendar_events_calendar_source_id` ON `calendar_events`(`calendar_source_id`);
+
+CREATE TABLE `rewrite_rules` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    `calendar_source_id` integer NOT NULL,
+    `position` integer NOT NULL,
+    `action` text NOT NULL,
+    `pattern` text,
+    `value` text,
+    CONSTRAINT `fk_rewrite_rules_calendar_source` FOREIGN KEY (`calendar_source_id`) REFERENCES `calendar_sources`(`id`) ON DELETE CASCADE
+);
+CREATE INDEX `idx_rewrite_rules_calendar_source_id` ON `rewrite_rules`(`calendar_source_id`);
+CREATE INDEX `idx_rewrite_rules_deleted_at` ON `rewrite_rules`(`deleted_at`);
+
+CREATE TABLE `sessions` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `user_id` integer NOT NULL,
+    `user_agent` text,
+    `ip_address` text,
+    `last_used_at` datetime,
+    `expires_at` datetime NOT NULL,
+    `revoked_at` datetime,
+    CONSTRAINT `fk_sessions_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`) ON DELETE CASCADE
+);
+CREATE INDEX `idx_sessions_user_id` ON `sessions`(`user_id`);
+
+CREATE TABLE `refresh_tokens` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `user_id` integer NOT NULL,
+    `token_hash` text NOT NULL,
+    `session_id` integer NOT NULL,
+    `expires_at` datetime NOT NULL,
+    `used_at` datetime,
+    `revoked_at` datetime,
+    CONSTRAINT `fk_refresh_tokens_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`) ON DELETE CASCADE,
+    CONSTRAINT `fk_refresh_tokens_session` FOREIGN KEY (`session_id`) REFERENCES `sessions`(`id`) ON DELETE CASCADE
+);
+CREATE INDEX `idx_refresh_tokens_session_id` ON `refresh_tokens`(`session_id`);
+CREATE UNIQUE INDEX `idx_refresh_tokens_token_hash` ON `refresh_tokens`(`token_hash`);
+CREATE INDEX `idx_refresh_tokens_user_id` ON `refresh_tokens`(`user_id`);
+
+CREATE TABLE `user_identities` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `user_id` integer NOT NULL,
+    `provider` text NOT NULL,
+    `subject` text NOT NULL,
+    `email` text NOT NULL,
+    CONSTRAINT `fk_users_identities` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`),
+    CONSTRAINT `chk_user_identities_provider` CHECK (provider <> ''),
+    CONSTRAINT `chk_user_identities_subject` CHECK (subject <> '')
+);
+CREATE UNIQUE INDEX `idx_identity_provider_subject` ON `user_identities`(`provider`,`subject`);
+CREATE INDEX `idx_user_identities_user_id` ON `user_identities`(`user_id`);
+
+CREATE TABLE `identity_links` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `user_id` integer NOT NULL,
+    `token_hash` text NOT NULL,
+    `merge` numeric NOT NULL DEFAULT false,
+    `expires_at` datetime NOT NULL,
+    `used_at` datetime,
+    CONSTRAINT `fk_identity_links_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX `idx_identity_links_token_hash` ON `identity_links`(`token_hash`);
+CREATE INDEX `idx_identity_links_user_id` ON `identity_links`(`user_id`);
+
+CREATE TABLE `personal_access_tokens` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `user_id` integer NOT NULL,
+    `name` text NOT NULL,
+    `token_hash` text NOT NULL,
+    `scopes` text NOT NULL,
+    `expires_at` datetime,
+    `last_used_at` datetime,
+    CONSTRAINT `fk_personal_access_tokens_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX `idx_personal_access_tokens_token_hash` ON `personal_access_tokens`(`token_hash`);
+CREATE INDEX `idx_personal_access_tokens_user_id` ON `personal_access_tokens`(`user_id`);
+
+CREATE TABLE `authorization_codes` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `user_id` integer NOT NULL,
+    `code_hash` text NOT NULL,
+    `code_challenge` text NOT NULL,
+    `redirect_uri` text NOT NULL,
+    `expires_at` datetime NOT NULL,
+    `used_at` datetime,
+    CONSTRAINT `fk_authorization_codes_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX `idx_authorization_codes_code_hash` ON `authorization_codes`(`code_hash`);
+CREATE INDEX `idx_authorization_codes_user_id` ON `authorization_codes`(`user_id`);
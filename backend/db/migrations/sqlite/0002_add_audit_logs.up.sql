@@ -0,0 +1,26 @@
+-- Append-only audit trail of changes to calendar muxes, sources and household membership
+
+CREATE TABLE `audit_logs` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime NOT NULL,
+    `actor_id` integer NOT NULL,
+    `action` text NOT NULL,
+    `entity_type` text NOT NULL,
+    `entity_id` integer NOT NULL,
+    `household_id` integer,
+    `changes` text NOT NULL,
+    `request_id` text
+);
+CREATE INDEX `idx_audit_logs_actor_id` ON `audit_logs`(`actor_id`);
+CREATE INDEX `idx_audit_logs_entity` ON `audit_logs`(`entity_type`,`entity_id`);
+CREATE INDEX `idx_audit_logs_household_id` ON `audit_logs`(`household_id`);
+
+CREATE TRIGGER `audit_logs_no_update` BEFORE UPDATE ON `audit_logs`
+BEGIN
+    SELECT RAISE(ABORT, 'audit_logs is append-only');
+END;
+
+CREATE TRIGGER `audit_logs_no_delete` BEFORE DELETE ON `audit_logs`
+BEGIN
+    SELECT RAISE(ABORT, 'audit_logs is append-only');
+END;
@@ -0,0 +1,2 @@
+ALTER TABLE `identity_links` DROP COLUMN `merge_user_id`;
+ALTER TABLE `identity_links` DROP COLUMN `session_id`;
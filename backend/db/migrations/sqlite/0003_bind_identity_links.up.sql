@@ -0,0 +1,4 @@
+-- Bind identity links to the session that requested them, and hold merges for confirmation
+
+ALTER TABLE `identity_links` ADD `session_id` integer CONSTRAINT `fk_identity_links_session` REFERENCES `sessions`(`id`) ON DELETE CASCADE;
+ALTER TABLE `identity_links` ADD `merge_user_id` integer CONSTRAINT `fk_identity_links_merge_user` REFERENCES `users`(`id`) ON DELETE SET NULL;
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Types of the entities whose changes are recorded in the audit log
+const (
+	AuditEntityCalendarMux     = "calendar_mux"
+	AuditEntityCalendarSource  = "calendar_source"
+	AuditEntityHousehold       = "household"
+	AuditEntityHouseholdMember = "household_member"
+	AuditEntityHouseholdInvite = "household_invite"
+	AuditEntityRewriteRule     = "rewrite_rule"
+)
+
+// Actions recorded in the audit log
+const (
+	AuditActionCreate  = "create"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionRestore = "restore"
+	// AuditActionPurge permanently deletes an entity from the trash
+	AuditActionPurge = "purge"
+)
+
+// AuditActorServer is the actor of changes the server makes on its own, such as purging the trash
+const AuditActorServer uint = 0
+
+// AuditLog records who changed an entity, how, and in which request. Entries are never updated
+// or deleted, which the database enforces.
+type AuditLog struct {
+	ID         uint      `gorm:"primarykey"`
+	CreatedAt  time.Time `gorm:"not null"`
+	ActorID    uint      `gorm:"not null;index"`
+	Action     string    `gorm:"not null;size:20"`
+	EntityType string    `gorm:"not null;size:50;index:idx_audit_logs_entity"`
+	EntityID   uint      `gorm:"not null;index:idx_audit_logs_entity"`
+	// HouseholdID is the household the entity belonged to, whose owners may read the entry
+	HouseholdID *uint `gorm:"index"`
+	// Changes maps each changed field to its values before and after the change, as JSON
+	Changes   string `gorm:"type:text;not null"`
+	RequestID string `gorm:"size:100"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// AuthorizationCode is handed to the frontend in the sign-in callback URL instead of tokens. The
+// frontend exchanges it once, together with the PKCE verifier whose challenge started the
+// sign-in, for a new session. Only a hash of the code is stored.
+type AuthorizationCode struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    uint   `gorm:"not null;index"`
+	User      User   `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	CodeHash  string `gorm:"not null;size:64;uniqueIndex"`
+	// CodeChallenge is the S256 PKCE challenge the code is bound to
+	CodeChallenge string `gorm:"not null;size:128"`
+	// RedirectURI is the callback URL the code was sent to
+	RedirectURI string    `gorm:"not null;size:2000"`
+	ExpiresAt   time.Time `gorm:"not null"`
+	UsedAt      *time.Time
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// CalendarEvent is a VEVENT fetched from a calendar source. Events are replaced wholesale
+// on every successful sync, so they are hard-deleted rather than soft-deleted.
+type CalendarEvent struct {
+	ID               uint `gorm:"primarykey"`
+	CreatedAt        time.Time
+	CalendarSourceID uint           `gorm:"not null;index"`
+	CalendarSource   CalendarSource `gorm:"foreignKey:CalendarSourceID;constraint:OnDelete:CASCADE"`
+	UID              string         `gorm:"not null;size:1024"`
+	RecurrenceID     string         `gorm:"size:64"`
+	Summary          string         `gorm:"size:1000"`
+	// Data is the VEVENT component as iCalendar text
+	Data string `gorm:"type:text;not null"`
+}
@@ -1,11 +1,44 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"gorm.io/gorm"
+)
 
 type CalendarMux struct {
 	gorm.Model
-	CreatedByID uint   `gorm:"not null;index"`
-	CreatedBy   User   `gorm:"foreignKey:CreatedByID;constraint:OnDelete:CASCADE"`
-	Name        string `gorm:"not null;size:200"`
-	Description string `gorm:"size:1000"`
+	CreatedByID uint `gorm:"not null;index"`
+	CreatedBy   User `gorm:"foreignKey:CreatedByID;constraint:OnDelete:CASCADE"`
+	// HouseholdID shares the mux with the members of a household, according to their roles
+	HouseholdID *uint      `gorm:"index"`
+	Household   *Household `gorm:"foreignKey:HouseholdID;constraint:OnDelete:SET NULL"`
+	Name        string     `gorm:"not null;size:200"`
+	Description string     `gorm:"size:1000"`
+	FeedToken   string     `gorm:"size:64;uniqueIndex"`
+	// DedupDisabled turns off collapsing of duplicate events across sources (on by default)
+	DedupDisabled bool `gorm:"not null;default:false"`
+}
+
+// BeforeCreate assigns an unguessable feed token to new calendar muxes
+func (c *CalendarMux) BeforeCreate(tx *gorm.DB) error {
+	if c.FeedToken != "" {
+		return nil
+	}
+	token, err := NewFeedToken()
+	if err != nil {
+		return err
+	}
+	c.FeedToken = token
+	return nil
+}
+
+// NewFeedToken returns a random token used in public feed URLs
+func NewFeedToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
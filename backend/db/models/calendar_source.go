@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Visibility modes of a calendar source, controlling how much of its events the merged outputs reveal
+const (
+	VisibilityFull      = "full"
+	VisibilityTitleOnly = "title_only"
+	VisibilityBusyOnly  = "busy_only"
+)
+
+type CalendarSource struct {
+	gorm.Model
+	CalendarMuxID uint        `gorm:"not null;index"`
+	CalendarMux   CalendarMux `gorm:"foreignKey:CalendarMuxID;constraint:OnDelete:CASCADE"`
+	URL           string      `gorm:"not null;size:2048"`
+	Label         string      `gorm:"not null;size:200"`
+	Enabled       bool        `gorm:"not null"`
+	Visibility    string      `gorm:"not null;size:20;default:full"`
+
+	// Sync status, maintained by the background sync engine
+	LastSyncAt    *time.Time
+	LastSuccessAt *time.Time
+	LastErrorAt   *time.Time
+	LastError     string `gorm:"size:1000"`
+	// UnchangedSince is when the upstream content last changed; 304 responses leave it untouched
+	UnchangedSince *time.Time
+	// Timezones holds the VTIMEZONE definitions of the last successful fetch, as iCalendar text
+	Timezones string `gorm:"type:text"`
+
+	// HTTP validators sent with the next fetch as If-None-Match / If-Modified-Since
+	ETag         string `gorm:"column:etag;size:255"`
+	LastModified string `gorm:"size:64"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Roles of a household member, from most to least privileged
+const (
+	// HouseholdRoleOwner can do everything, including managing members and deleting muxes
+	HouseholdRoleOwner = "owner"
+	// HouseholdRoleEditor can edit the household's calendar muxes and their sources
+	HouseholdRoleEditor = "editor"
+	// HouseholdRoleViewer can see the household's calendar muxes and their events
+	HouseholdRoleViewer = "viewer"
+)
+
+// Household is a group of users sharing calendar muxes
+type Household struct {
+	gorm.Model
+	Name        string `gorm:"not null;size:200"`
+	CreatedByID uint   `gorm:"not null;index"`
+	CreatedBy   User   `gorm:"foreignKey:CreatedByID;constraint:OnDelete:CASCADE"`
+}
+
+// HouseholdMember grants a user a role in a household. Memberships are hard-deleted so that
+// a user who leaves can be added again.
+type HouseholdMember struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	HouseholdID uint      `gorm:"not null;uniqueIndex:idx_household_member"`
+	Household   Household `gorm:"foreignKey:HouseholdID;constraint:OnDelete:CASCADE"`
+	UserID      uint      `gorm:"not null;uniqueIndex:idx_household_member;index"`
+	User        User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Role        string    `gorm:"not null;size:20"`
+}
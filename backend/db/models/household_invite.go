@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// HouseholdInvite lets whoever holds its token join a household once, with the given role,
+// until it expires. Only a hash of the token is stored, so the link cannot be rebuilt from
+// the database.
+type HouseholdInvite struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	HouseholdID uint      `gorm:"not null;index"`
+	Household   Household `gorm:"foreignKey:HouseholdID;constraint:OnDelete:CASCADE"`
+	CreatedByID uint      `gorm:"not null"`
+	CreatedBy   User      `gorm:"foreignKey:CreatedByID;constraint:OnDelete:CASCADE"`
+	Role        string    `gorm:"not null;size:20"`
+	TokenHash   string    `gorm:"not null;size:64;uniqueIndex"`
+	ExpiresAt   time.Time `gorm:"not null"`
+	// AcceptedByID and AcceptedAt record who used the invite and when
+	AcceptedByID *uint
+	AcceptedBy   *User `gorm:"foreignKey:AcceptedByID;constraint:OnDelete:SET NULL"`
+	AcceptedAt   *time.Time
+	RevokedAt    *time.Time
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// PersonalAccessTokenPrefix starts every personal access token, telling them apart from JWTs and
+// making leaked ones easy to spot
+const PersonalAccessTokenPrefix = "fcm_pat_"
+
+// Scopes a personal access token can be granted
+const (
+	// ScopeEventsRead lists and reads calendar muxes and their events
+	ScopeEventsRead = "events:read"
+	// ScopeMuxesManage also creates, changes and deletes calendar muxes, their sources and rules
+	ScopeMuxesManage = "muxes:manage"
+)
+
+// PersonalAccessToken is a long-lived credential for scripts, limited to its scopes. Only a hash
+// of the token is stored.
+type PersonalAccessToken struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uint   `gorm:"not null;index"`
+	User      User   `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Name      string `gorm:"not null;size:100"`
+	TokenHash string `gorm:"not null;size:64;uniqueIndex"`
+	// Scopes are separated by spaces
+	Scopes string `gorm:"not null;size:200"`
+	// ExpiresAt is nil for tokens that do not expire
+	ExpiresAt *time.Time
+	// LastUsedAt is updated at most once a minute
+	LastUsedAt *time.Time
+}
+
+// ScopeList returns the scopes of the token
+func (t *PersonalAccessToken) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
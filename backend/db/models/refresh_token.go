@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// RefreshToken lets a client get new access tokens without signing in again. Each token is used
+// once and replaced by a successor in the same session; presenting a token that was already used
+// revokes the whole session. Only a hash of the token is stored.
+type RefreshToken struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uint      `gorm:"not null;index"`
+	User      User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	TokenHash string    `gorm:"not null;size:64;uniqueIndex"`
+	SessionID uint      `gorm:"not null;index"`
+	Session   Session   `gorm:"foreignKey:SessionID;constraint:OnDelete:CASCADE"`
+	ExpiresAt time.Time `gorm:"not null"`
+	// UsedAt is set when the token is exchanged for its successor
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
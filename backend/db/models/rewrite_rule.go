@@ -0,0 +1,30 @@
+package models
+
+import "gorm.io/gorm"
+
+// Actions of a rewrite rule
+const (
+	// RewriteActionPrefix puts Value in front of the title
+	RewriteActionPrefix = "prefix"
+	// RewriteActionReplace replaces every match of Pattern in the title with Value
+	RewriteActionReplace = "replace"
+	// RewriteActionSetCategories sets CATEGORIES to the comma-separated list in Value
+	RewriteActionSetCategories = "set_categories"
+	// RewriteActionSetColor sets COLOR to the CSS color name in Value
+	RewriteActionSetColor = "set_color"
+	// RewriteActionDrop removes the event from the merged outputs
+	RewriteActionDrop = "drop"
+)
+
+// RewriteRule changes the events of a calendar source as they are merged. The rules of a source
+// run in Position order; Pattern is a regular expression matched against the event title, and a
+// rule with an empty Pattern applies to every event.
+type RewriteRule struct {
+	gorm.Model
+	CalendarSourceID uint           `gorm:"not null;index"`
+	CalendarSource   CalendarSource `gorm:"foreignKey:CalendarSourceID;constraint:OnDelete:CASCADE"`
+	Position         int            `gorm:"not null"`
+	Action           string         `gorm:"not null;size:20"`
+	Pattern          string         `gorm:"size:500"`
+	Value            string         `gorm:"size:500"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Session is one sign-in of a user on a device. It lasts as long as its refresh tokens keep
+// being exchanged, and revoking it rejects its access tokens as well.
+type Session struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uint   `gorm:"not null;index"`
+	User      User   `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	UserAgent string `gorm:"size:500"`
+	IPAddress string `gorm:"size:45"`
+	// LastUsedAt is updated on refreshes and, at most once per cache period, on API requests
+	LastUsedAt time.Time
+	// ExpiresAt is the expiry of the newest refresh token of the session
+	ExpiresAt time.Time `gorm:"not null"`
+	RevokedAt *time.Time
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// NewHashedToken returns a random bearer token together with the hash it is stored under, for
+// tokens that must not be recoverable from the database
+func NewHashedToken() (token, hash string, err error) {
+	token, err = NewFeedToken()
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hash a bearer token is stored and looked up under
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
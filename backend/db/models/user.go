@@ -4,9 +4,9 @@ import "gorm.io/gorm"
 
 type User struct {
 	gorm.Model
-	GivenName      string `gorm:"not null;size:100"`
-	FamilyName     string `gorm:"not null;size:100"`
-	Email          string `gorm:"not null;size:255"`
-	AuthProvider   string `gorm:"not null;size:50;index:idx_auth_provider_id;check:auth_provider <> ''"`
-	AuthProviderID string `gorm:"not null;size:255;index:idx_auth_provider_id;check:auth_provider_id <> ''"`
+	GivenName  string `gorm:"not null;size:100"`
+	FamilyName string `gorm:"not null;size:100"`
+	Email      string `gorm:"not null;size:255"`
+	// Identities are the identity provider accounts the user signs in with
+	Identities []UserIdentity `gorm:"foreignKey:UserID"`
 }
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// UserIdentity is an account with an identity provider that signs in as a user. A user can link
+// several, e.g. a work and a personal Google account.
+type UserIdentity struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uint `gorm:"not null;index"`
+	User      User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	// Provider and Subject are the provider's name and its ID for the account
+	Provider string `gorm:"not null;size:50;uniqueIndex:idx_identity_provider_subject;check:provider <> ''"`
+	Subject  string `gorm:"not null;size:255;uniqueIndex:idx_identity_provider_subject;check:subject <> ''"`
+	// Email is the address the provider reported at the last sign-in
+	Email string `gorm:"not null;size:255"`
+}
+
+// IdentityLink lets the user who requested it attach the next identity they sign in with to
+// their account, once, until it expires. The token only reaches the browser of the session that
+// requested the link, in a cookie, and the link is void once that session ends. With Merge set,
+// an identity that already belongs to another account marks that account in MergeUserID, and the
+// user must confirm before it is merged in. Only a hash of the token is stored.
+type IdentityLink struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    uint      `gorm:"not null;index"`
+	User      User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	TokenHash string    `gorm:"not null;size:64;uniqueIndex"`
+	Merge     bool      `gorm:"not null;default:false"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	// SessionID is the sign-in session that requested the link
+	SessionID *uint
+	Session   *Session `gorm:"foreignKey:SessionID;constraint:OnDelete:CASCADE"`
+	// MergeUserID is the account awaiting confirmation to be merged in
+	MergeUserID *uint
+	MergeUser   *User `gorm:"foreignKey:MergeUserID;constraint:OnDelete:SET NULL"`
+}
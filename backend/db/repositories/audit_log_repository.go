@@ -0,0 +1,118 @@
+package repositories
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"family-calendar-backend/db/models"
+
+	"gorm.io/gorm"
+)
+
+// AuditLogFilter selects audit log entries
+type AuditLogFilter struct {
+	// EntityType limits the entries to one type of entity, or all types when empty
+	EntityType string
+	// EntityID limits the entries to one entity, or all entities of the type when 0
+	EntityID uint
+	// VisibleTo limits the entries to those the user made or that concern households the user owns
+	VisibleTo uint
+	// Limit caps the number of entries, or returns all when 0
+	Limit int
+}
+
+// AuditLogRepository stores the append-only audit log
+type AuditLogRepository interface {
+	// Append stores a new entry, assigning its ID and, unless set, its timestamp
+	Append(entry *models.AuditLog) error
+	// List returns the entries matching a filter, newest first
+	List(filter AuditLogFilter) ([]models.AuditLog, error)
+}
+
+// GormAuditLogRepository stores the audit log in the database
+type GormAuditLogRepository struct {
+	db *gorm.DB
+}
+
+// NewGormAuditLogRepository returns an AuditLogRepository backed by the given database, which may
+// be a transaction so that entries are stored with the changes they record
+func NewGormAuditLogRepository(db *gorm.DB) *GormAuditLogRepository {
+	return &GormAuditLogRepository{db: db}
+}
+
+func (r *GormAuditLogRepository) Append(entry *models.AuditLog) error {
+	return r.db.Create(entry).Error
+}
+
+func (r *GormAuditLogRepository) List(filter AuditLogFilter) ([]models.AuditLog, error) {
+	owned := r.db.Model(&models.HouseholdMember{}).Select("household_id").
+		Where("user_id = ? AND role = ?", filter.VisibleTo, models.HouseholdRoleOwner)
+	query := r.db.Where("actor_id = ? OR household_id IN (?)", filter.VisibleTo, owned)
+	if filter.EntityType != "" {
+		query = query.Where("entity_type = ?", filter.EntityType)
+		if filter.EntityID != 0 {
+			query = query.Where("entity_id = ?", filter.EntityID)
+		}
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	var entries []models.AuditLog
+	if err := query.Order("id DESC").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// MemoryAuditLogRepository keeps the audit log and household ownership in memory, for tests
+type MemoryAuditLogRepository struct {
+	mu      sync.Mutex
+	entries []models.AuditLog
+	owners  map[[2]uint]bool
+}
+
+// NewMemoryAuditLogRepository returns an empty in-memory AuditLogRepository
+func NewMemoryAuditLogRepository() *MemoryAuditLogRepository {
+	return &MemoryAuditLogRepository{owners: map[[2]uint]bool{}}
+}
+
+// AddHouseholdMember gives a user a role in a household
+func (r *MemoryAuditLogRepository) AddHouseholdMember(householdID, userID uint, role string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.owners[[2]uint{householdID, userID}] = role == models.HouseholdRoleOwner
+}
+
+func (r *MemoryAuditLogRepository) Append(entry *models.AuditLog) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry.ID = uint(len(r.entries) + 1)
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	r.entries = append(r.entries, *entry)
+	return nil
+}
+
+func (r *MemoryAuditLogRepository) List(filter AuditLogFilter) ([]models.AuditLog, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := []models.AuditLog{}
+	for _, entry := range r.entries {
+		owner := entry.HouseholdID != nil && r.owners[[2]uint{*entry.HouseholdID, filter.VisibleTo}]
+		if entry.ActorID != filter.VisibleTo && !owner {
+			continue
+		}
+		if filter.EntityType != "" && (entry.EntityType != filter.EntityType || filter.EntityID != 0 && entry.EntityID != filter.EntityID) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID > entries[j].ID })
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[:filter.Limit]
+	}
+	return entries, nil
+}
@@ -0,0 +1,109 @@
+package repositories
+
+import (
+	"testing"
+
+	"family-calendar-backend/db/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// auditLogRepositories returns each AuditLogRepository implementation with a function that gives
+// a user a role in a household
+func auditLogRepositories(t *testing.T) map[string]func() (AuditLogRepository, func(householdID, userID uint, role string)) {
+	return map[string]func() (AuditLogRepository, func(householdID, userID uint, role string)){
+		"gorm": func() (AuditLogRepository, func(householdID, userID uint, role string)) {
+			testDB := openTestDB(t)
+			return NewGormAuditLogRepository(testDB), func(householdID, userID uint, role string) {
+				require.NoError(t, testDB.Create(&models.HouseholdMember{HouseholdID: householdID, UserID: userID, Role: role}).Error)
+			}
+		},
+		"memory": func() (AuditLogRepository, func(householdID, userID uint, role string)) {
+			repo := NewMemoryAuditLogRepository()
+			return repo, repo.AddHouseholdMember
+		},
+	}
+}
+
+func TestAuditLogRepository_AppendAndList(t *testing.T) {
+	for name, newRepo := range auditLogRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			repo, _ := newRepo()
+			first := &models.AuditLog{ActorID: 1, Action: models.AuditActionCreate, EntityType: models.AuditEntityCalendarMux, EntityID: 5, Changes: `{"name":{"before":null,"after":"Family"}}`, RequestID: "req-1"}
+			second := &models.AuditLog{ActorID: 1, Action: models.AuditActionUpdate, EntityType: models.AuditEntityCalendarMux, EntityID: 5, Changes: `{}`}
+			require.NoError(t, repo.Append(first))
+			require.NoError(t, repo.Append(second))
+
+			assert.NotZero(t, first.ID)
+			assert.NotEqual(t, first.ID, second.ID)
+			assert.False(t, first.CreatedAt.IsZero())
+
+			entries, err := repo.List(AuditLogFilter{VisibleTo: 1})
+			require.NoError(t, err)
+			require.Len(t, entries, 2)
+			assert.Equal(t, second.ID, entries[0].ID)
+			assert.Equal(t, first.ID, entries[1].ID)
+			assert.Equal(t, `{"name":{"before":null,"after":"Family"}}`, entries[1].Changes)
+			assert.Equal(t, "req-1", entries[1].RequestID)
+
+			entries, err = repo.List(AuditLogFilter{VisibleTo: 1, Limit: 1})
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, second.ID, entries[0].ID)
+		})
+	}
+}
+
+func TestAuditLogRepository_ListFiltersEntity(t *testing.T) {
+	for name, newRepo := range auditLogRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			repo, _ := newRepo()
+			require.NoError(t, repo.Append(&models.AuditLog{ActorID: 1, Action: models.AuditActionCreate, EntityType: models.AuditEntityCalendarMux, EntityID: 5, Changes: `{}`}))
+			require.NoError(t, repo.Append(&models.AuditLog{ActorID: 1, Action: models.AuditActionCreate, EntityType: models.AuditEntityCalendarMux, EntityID: 6, Changes: `{}`}))
+			require.NoError(t, repo.Append(&models.AuditLog{ActorID: 1, Action: models.AuditActionCreate, EntityType: models.AuditEntityCalendarSource, EntityID: 5, Changes: `{}`}))
+
+			entries, err := repo.List(AuditLogFilter{VisibleTo: 1, EntityType: models.AuditEntityCalendarMux})
+			require.NoError(t, err)
+			assert.Len(t, entries, 2)
+
+			entries, err = repo.List(AuditLogFilter{VisibleTo: 1, EntityType: models.AuditEntityCalendarMux, EntityID: 6})
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, uint(6), entries[0].EntityID)
+		})
+	}
+}
+
+func TestAuditLogRepository_ListVisibility(t *testing.T) {
+	for name, newRepo := range auditLogRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			repo, addMember := newRepo()
+			householdID := uint(7)
+			addMember(householdID, 2, models.HouseholdRoleOwner)
+			addMember(householdID, 3, models.HouseholdRoleEditor)
+			require.NoError(t, repo.Append(&models.AuditLog{ActorID: 1, Action: models.AuditActionCreate, EntityType: models.AuditEntityCalendarMux, EntityID: 5, Changes: `{}`}))
+			require.NoError(t, repo.Append(&models.AuditLog{ActorID: 3, Action: models.AuditActionUpdate, EntityType: models.AuditEntityCalendarMux, EntityID: 6, HouseholdID: &householdID, Changes: `{}`}))
+
+			// Owners see the changes in their household, and everyone sees their own changes
+			entries, err := repo.List(AuditLogFilter{VisibleTo: 2})
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, uint(6), entries[0].EntityID)
+
+			entries, err = repo.List(AuditLogFilter{VisibleTo: 3})
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, uint(6), entries[0].EntityID)
+
+			entries, err = repo.List(AuditLogFilter{VisibleTo: 1})
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, uint(5), entries[0].EntityID)
+
+			entries, err = repo.List(AuditLogFilter{VisibleTo: 4})
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+}
@@ -0,0 +1,438 @@
+package repositories
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"family-calendar-backend/db/models"
+
+	"gorm.io/gorm"
+)
+
+// CalendarMuxChanges are the fields of a calendar mux to change; nil fields are left unchanged
+type CalendarMuxChanges struct {
+	Name          *string
+	Description   *string
+	DedupDisabled *bool
+	// HouseholdID moves the mux into a household, or out of its household when 0
+	HouseholdID *uint
+}
+
+// empty reports whether the changes change nothing
+func (c CalendarMuxChanges) empty() bool {
+	return c.Name == nil && c.Description == nil && c.DedupDisabled == nil && c.HouseholdID == nil
+}
+
+// CalendarMuxRepository stores calendar muxes and looks up the household roles that grant access to them.
+// It covers the muxes themselves, their trash and the audit log of their changes, but not their
+// sources, rewrite rules or synced events, which the services still query through db.DB.
+type CalendarMuxRepository interface {
+	// Create stores a new calendar mux, assigning its ID, timestamps and feed token
+	Create(calendarMux *models.CalendarMux) error
+	// Get returns the calendar mux with the given ID, or ErrNotFound
+	Get(id uint) (*models.CalendarMux, error)
+	// GetByFeedToken returns the calendar mux published under a feed token, or ErrNotFound
+	GetByFeedToken(token string) (*models.CalendarMux, error)
+	// ListByUser returns the personal calendar muxes a user created and those shared with a household
+	// they belong to, by ID
+	ListByUser(userID uint) ([]models.CalendarMux, error)
+	// Update applies changes to a calendar mux if it was last updated at updatedAt, and returns
+	// ErrModified otherwise
+	Update(id uint, updatedAt time.Time, changes CalendarMuxChanges) error
+	// Delete moves a calendar mux to the trash, or returns ErrNotFound
+	Delete(id uint) error
+	// GetDeleted returns the calendar mux with the given ID if it is in the trash, or ErrNotFound
+	GetDeleted(id uint) (*models.CalendarMux, error)
+	// ListDeletedByUser returns the calendar muxes in the trash a user created or shares through a
+	// household, by ID
+	ListDeletedByUser(userID uint) ([]models.CalendarMux, error)
+	// Restore takes a calendar mux out of the trash, or returns ErrNotFound
+	Restore(id uint) error
+	// Purge permanently deletes the calendar muxes moved to the trash before the given time, with
+	// their sources, events and rewrite rules, and returns the muxes it deleted, by ID
+	Purge(deletedBefore time.Time) ([]models.CalendarMux, error)
+	// HouseholdRole returns the role of a user in a household, or "" for non-members
+	HouseholdRole(householdID, userID uint) (string, error)
+	// Transaction runs fn with calendar muxes and an audit log whose changes are stored together,
+	// or not at all when fn returns an error
+	Transaction(fn func(muxes CalendarMuxRepository, audit AuditLogRepository) error) error
+}
+
+// GormCalendarMuxRepository stores calendar muxes in the database
+type GormCalendarMuxRepository struct {
+	db *gorm.DB
+}
+
+// NewGormCalendarMuxRepository returns a CalendarMuxRepository backed by the given database
+func NewGormCalendarMuxRepository(db *gorm.DB) *GormCalendarMuxRepository {
+	return &GormCalendarMuxRepository{db: db}
+}
+
+func (r *GormCalendarMuxRepository) Create(calendarMux *models.CalendarMux) error {
+	return r.db.Create(calendarMux).Error
+}
+
+func (r *GormCalendarMuxRepository) Get(id uint) (*models.CalendarMux, error) {
+	return r.first(r.db.Where("id = ?", id))
+}
+
+func (r *GormCalendarMuxRepository) GetByFeedToken(token string) (*models.CalendarMux, error) {
+	if token == "" {
+		return nil, ErrNotFound
+	}
+	return r.first(r.db.Where("feed_token = ?", token))
+}
+
+func (r *GormCalendarMuxRepository) first(query *gorm.DB) (*models.CalendarMux, error) {
+	var calendarMux models.CalendarMux
+	if err := query.First(&calendarMux).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &calendarMux, nil
+}
+
+func (r *GormCalendarMuxRepository) ListByUser(userID uint) ([]models.CalendarMux, error) {
+	return r.listByUser(r.db, userID)
+}
+
+func (r *GormCalendarMuxRepository) listByUser(query *gorm.DB, userID uint) ([]models.CalendarMux, error) {
+	var calendarMuxes []models.CalendarMux
+	memberships := r.db.Model(&models.HouseholdMember{}).Select("household_id").Where("user_id = ?", userID)
+	result := query.Where("(created_by_id = ? AND household_id IS NULL) OR household_id IN (?)", userID, memberships).Order("id").Find(&calendarMuxes)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return calendarMuxes, nil
+}
+
+func (r *GormCalendarMuxRepository) Update(id uint, updatedAt time.Time, changes CalendarMuxChanges) error {
+	if changes.empty() {
+		return nil
+	}
+	columns := map[string]interface{}{}
+	if changes.Name != nil {
+		columns["name"] = *changes.Name
+	}
+	if changes.Description != nil {
+		columns["description"] = *changes.Description
+	}
+	if changes.DedupDisabled != nil {
+		columns["dedup_disabled"] = *changes.DedupDisabled
+	}
+	if changes.HouseholdID != nil {
+		if *changes.HouseholdID == 0 {
+			columns["household_id"] = nil
+		} else {
+			columns["household_id"] = *changes.HouseholdID
+		}
+	}
+
+	// Compare-and-swap on the version the caller read, so concurrent updates cannot both succeed
+	result := r.db.Model(&models.CalendarMux{}).
+		Where("id = ? AND updated_at = ?", id, updatedAt).
+		Updates(columns)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrModified
+	}
+	return nil
+}
+
+func (r *GormCalendarMuxRepository) Delete(id uint) error {
+	result := r.db.Delete(&models.CalendarMux{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *GormCalendarMuxRepository) GetDeleted(id uint) (*models.CalendarMux, error) {
+	return r.first(r.db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id))
+}
+
+func (r *GormCalendarMuxRepository) ListDeletedByUser(userID uint) ([]models.CalendarMux, error) {
+	return r.listByUser(r.db.Unscoped().Where("deleted_at IS NOT NULL"), userID)
+}
+
+func (r *GormCalendarMuxRepository) Restore(id uint) error {
+	result := r.db.Unscoped().Model(&models.CalendarMux{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *GormCalendarMuxRepository) Purge(deletedBefore time.Time) ([]models.CalendarMux, error) {
+	var purged []models.CalendarMux
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("deleted_at < ?", deletedBefore).Order("id").Find(&purged).Error; err != nil {
+			return err
+		}
+		if len(purged) == 0 {
+			return nil
+		}
+
+		// Delete the dependent rows explicitly, since SQLite does not enforce the cascades
+		muxIDs := make([]uint, 0, len(purged))
+		for _, calendarMux := range purged {
+			muxIDs = append(muxIDs, calendarMux.ID)
+		}
+		sourceIDs := tx.Unscoped().Model(&models.CalendarSource{}).Select("id").Where("calendar_mux_id IN (?)", muxIDs)
+		if err := tx.Where("calendar_source_id IN (?)", sourceIDs).Delete(&models.CalendarEvent{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("calendar_source_id IN (?)", sourceIDs).Delete(&models.RewriteRule{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("calendar_mux_id IN (?)", muxIDs).Delete(&models.CalendarSource{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("id IN ?", muxIDs).Delete(&models.CalendarMux{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return purged, nil
+}
+
+func (r *GormCalendarMuxRepository) HouseholdRole(householdID, userID uint) (string, error) {
+	var member models.HouseholdMember
+	result := r.db.Where("household_id = ? AND user_id = ?", householdID, userID).Limit(1).Find(&member)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	return member.Role, nil
+}
+
+func (r *GormCalendarMuxRepository) Transaction(fn func(muxes CalendarMuxRepository, audit AuditLogRepository) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return fn(NewGormCalendarMuxRepository(tx), NewGormAuditLogRepository(tx))
+	})
+}
+
+// MemoryCalendarMuxRepository keeps calendar muxes, household memberships and the audit log of
+// their transactions in memory, for tests. It only stands in for the database where calendar
+// muxes are concerned: calls that reach sources, rewrite rules or events still need db.DB.
+type MemoryCalendarMuxRepository struct {
+	mu            sync.Mutex
+	calendarMuxes map[uint]models.CalendarMux
+	roles         map[[2]uint]string
+	nextID        uint
+	audit         *MemoryAuditLogRepository
+}
+
+// NewMemoryCalendarMuxRepository returns an empty in-memory CalendarMuxRepository
+func NewMemoryCalendarMuxRepository() *MemoryCalendarMuxRepository {
+	return &MemoryCalendarMuxRepository{
+		calendarMuxes: map[uint]models.CalendarMux{},
+		roles:         map[[2]uint]string{},
+		nextID:        1,
+		audit:         NewMemoryAuditLogRepository(),
+	}
+}
+
+// AuditLog returns the audit log that transactions append to
+func (r *MemoryCalendarMuxRepository) AuditLog() *MemoryAuditLogRepository {
+	return r.audit
+}
+
+// AddHouseholdMember gives a user a role in a household
+func (r *MemoryCalendarMuxRepository) AddHouseholdMember(householdID, userID uint, role string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.roles[[2]uint{householdID, userID}] = role
+}
+
+func (r *MemoryCalendarMuxRepository) Create(calendarMux *models.CalendarMux) error {
+	if calendarMux.FeedToken == "" {
+		token, err := models.NewFeedToken()
+		if err != nil {
+			return err
+		}
+		calendarMux.FeedToken = token
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calendarMux.ID = r.nextID
+	r.nextID++
+	now := time.Now()
+	calendarMux.CreatedAt = now
+	calendarMux.UpdatedAt = now
+	r.calendarMuxes[calendarMux.ID] = *calendarMux
+	return nil
+}
+
+func (r *MemoryCalendarMuxRepository) Get(id uint) (*models.CalendarMux, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calendarMux, ok := r.calendarMuxes[id]
+	if !ok || calendarMux.DeletedAt.Valid {
+		return nil, ErrNotFound
+	}
+	return &calendarMux, nil
+}
+
+func (r *MemoryCalendarMuxRepository) GetByFeedToken(token string) (*models.CalendarMux, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, calendarMux := range r.calendarMuxes {
+		if token != "" && calendarMux.FeedToken == token && !calendarMux.DeletedAt.Valid {
+			return &calendarMux, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryCalendarMuxRepository) ListByUser(userID uint) ([]models.CalendarMux, error) {
+	return r.listByUser(userID, false)
+}
+
+func (r *MemoryCalendarMuxRepository) listByUser(userID uint, deleted bool) ([]models.CalendarMux, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calendarMuxes := []models.CalendarMux{}
+	for _, calendarMux := range r.calendarMuxes {
+		if calendarMux.DeletedAt.Valid != deleted {
+			continue
+		}
+		shared := calendarMux.HouseholdID != nil && r.roles[[2]uint{*calendarMux.HouseholdID, userID}] != ""
+		if (calendarMux.CreatedByID == userID && calendarMux.HouseholdID == nil) || shared {
+			calendarMuxes = append(calendarMuxes, calendarMux)
+		}
+	}
+	sort.Slice(calendarMuxes, func(i, j int) bool { return calendarMuxes[i].ID < calendarMuxes[j].ID })
+	return calendarMuxes, nil
+}
+
+func (r *MemoryCalendarMuxRepository) Update(id uint, updatedAt time.Time, changes CalendarMuxChanges) error {
+	if changes.empty() {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calendarMux, ok := r.calendarMuxes[id]
+	if !ok || calendarMux.DeletedAt.Valid || !calendarMux.UpdatedAt.Equal(updatedAt) {
+		return ErrModified
+	}
+	if changes.Name != nil {
+		calendarMux.Name = *changes.Name
+	}
+	if changes.Description != nil {
+		calendarMux.Description = *changes.Description
+	}
+	if changes.DedupDisabled != nil {
+		calendarMux.DedupDisabled = *changes.DedupDisabled
+	}
+	if changes.HouseholdID != nil {
+		if *changes.HouseholdID == 0 {
+			calendarMux.HouseholdID = nil
+		} else {
+			householdID := *changes.HouseholdID
+			calendarMux.HouseholdID = &householdID
+		}
+	}
+	calendarMux.UpdatedAt = time.Now()
+	r.calendarMuxes[id] = calendarMux
+	return nil
+}
+
+func (r *MemoryCalendarMuxRepository) Delete(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calendarMux, ok := r.calendarMuxes[id]
+	if !ok || calendarMux.DeletedAt.Valid {
+		return ErrNotFound
+	}
+	calendarMux.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	r.calendarMuxes[id] = calendarMux
+	return nil
+}
+
+func (r *MemoryCalendarMuxRepository) GetDeleted(id uint) (*models.CalendarMux, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calendarMux, ok := r.calendarMuxes[id]
+	if !ok || !calendarMux.DeletedAt.Valid {
+		return nil, ErrNotFound
+	}
+	return &calendarMux, nil
+}
+
+func (r *MemoryCalendarMuxRepository) ListDeletedByUser(userID uint) ([]models.CalendarMux, error) {
+	return r.listByUser(userID, true)
+}
+
+func (r *MemoryCalendarMuxRepository) Restore(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calendarMux, ok := r.calendarMuxes[id]
+	if !ok || !calendarMux.DeletedAt.Valid {
+		return ErrNotFound
+	}
+	calendarMux.DeletedAt = gorm.DeletedAt{}
+	r.calendarMuxes[id] = calendarMux
+	return nil
+}
+
+func (r *MemoryCalendarMuxRepository) Purge(deletedBefore time.Time) ([]models.CalendarMux, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	purged := []models.CalendarMux{}
+	for id, calendarMux := range r.calendarMuxes {
+		if calendarMux.DeletedAt.Valid && calendarMux.DeletedAt.Time.Before(deletedBefore) {
+			delete(r.calendarMuxes, id)
+			purged = append(purged, calendarMux)
+		}
+	}
+	sort.Slice(purged, func(i, j int) bool { return purged[i].ID < purged[j].ID })
+	return purged, nil
+}
+
+func (r *MemoryCalendarMuxRepository) HouseholdRole(householdID, userID uint) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.roles[[2]uint{householdID, userID}], nil
+}
+
+// Transaction restores the calendar muxes and the audit log when fn fails. Unlike a database
+// transaction, it does not hide the changes from concurrent callers while fn runs.
+func (r *MemoryCalendarMuxRepository) Transaction(fn func(muxes CalendarMuxRepository, audit AuditLogRepository) error) error {
+	r.mu.Lock()
+	calendarMuxes := make(map[uint]models.CalendarMux, len(r.calendarMuxes))
+	for id, calendarMux := range r.calendarMuxes {
+		calendarMuxes[id] = calendarMux
+	}
+	nextID := r.nextID
+	r.mu.Unlock()
+	r.audit.mu.Lock()
+	entries := len(r.audit.entries)
+	r.audit.mu.Unlock()
+
+	if err := fn(r, r.audit); err != nil {
+		r.mu.Lock()
+		r.calendarMuxes, r.nextID = calendarMuxes, nextID
+		r.mu.Unlock()
+		r.audit.mu.Lock()
+		r.audit.entries = r.audit.entries[:entries]
+		r.audit.mu.Unlock()
+		return err
+	}
+	return nil
+}
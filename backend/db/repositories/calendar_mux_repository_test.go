@@ -0,0 +1,322 @@
+package repositories
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"family-calendar-backend/db/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// calendarMuxRepositories returns each CalendarMuxRepository implementation with a function that
+// gives a user a role in a household
+func calendarMuxRepositories(t *testing.T) map[string]func() (CalendarMuxRepository, func(householdID, userID uint, role string)) {
+	return map[string]func() (CalendarMuxRepository, func(householdID, userID uint, role string)){
+		"gorm": func() (CalendarMuxRepository, func(householdID, userID uint, role string)) {
+			testDB := openTestDB(t)
+			return NewGormCalendarMuxRepository(testDB), func(householdID, userID uint, role string) {
+				require.NoError(t, testDB.Create(&models.HouseholdMember{HouseholdID: householdID, UserID: userID, Role: role}).Error)
+			}
+		},
+		"memory": func() (CalendarMuxRepository, func(householdID, userID uint, role string)) {
+			repo := NewMemoryCalendarMuxRepository()
+			return repo, repo.AddHouseholdMember
+		},
+	}
+}
+
+func TestCalendarMuxRepository_CreateAndGet(t *testing.T) {
+	for name, newRepo := range calendarMuxRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			repo, _ := newRepo()
+			first := &models.CalendarMux{CreatedByID: 1, Name: "Family", Description: "Everyone"}
+			second := &models.CalendarMux{CreatedByID: 1, Name: "Work"}
+			require.NoError(t, repo.Create(first))
+			require.NoError(t, repo.Create(second))
+
+			assert.NotZero(t, first.ID)
+			assert.NotEqual(t, first.ID, second.ID)
+			assert.False(t, first.UpdatedAt.IsZero())
+			assert.Len(t, first.FeedToken, 64)
+			assert.NotEqual(t, first.FeedToken, second.FeedToken)
+
+			found, err := repo.Get(first.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "Family", found.Name)
+			assert.Equal(t, "Everyone", found.Description)
+
+			found, err = repo.GetByFeedToken(second.FeedToken)
+			require.NoError(t, err)
+			assert.Equal(t, second.ID, found.ID)
+
+			_, err = repo.Get(9999)
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = repo.GetByFeedToken("does-not-exist")
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = repo.GetByFeedToken("")
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+func TestCalendarMuxRepository_ListByUser(t *testing.T) {
+	for name, newRepo := range calendarMuxRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			repo, addMember := newRepo()
+			householdID := uint(7)
+			addMember(householdID, 2, models.HouseholdRoleViewer)
+			require.NoError(t, repo.Create(&models.CalendarMux{CreatedByID: 1, Name: "Mine"}))
+			require.NoError(t, repo.Create(&models.CalendarMux{CreatedByID: 1, Name: "Shared", HouseholdID: &householdID}))
+			require.NoError(t, repo.Create(&models.CalendarMux{CreatedByID: 2, Name: "Theirs"}))
+
+			// Household muxes are listed by membership, not by creator
+			muxes, err := repo.ListByUser(1)
+			require.NoError(t, err)
+			require.Len(t, muxes, 1)
+			assert.Equal(t, "Mine", muxes[0].Name)
+
+			addMember(householdID, 1, models.HouseholdRoleEditor)
+			muxes, err = repo.ListByUser(1)
+			require.NoError(t, err)
+			require.Len(t, muxes, 2)
+			assert.Equal(t, "Mine", muxes[0].Name)
+			assert.Equal(t, "Shared", muxes[1].Name)
+
+			muxes, err = repo.ListByUser(2)
+			require.NoError(t, err)
+			require.Len(t, muxes, 2)
+			assert.Equal(t, "Shared", muxes[0].Name)
+			assert.Equal(t, "Theirs", muxes[1].Name)
+
+			muxes, err = repo.ListByUser(3)
+			require.NoError(t, err)
+			assert.Empty(t, muxes)
+		})
+	}
+}
+
+func TestCalendarMuxRepository_Update(t *testing.T) {
+	for name, newRepo := range calendarMuxRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			repo, _ := newRepo()
+			householdID := uint(7)
+			calendarMux := &models.CalendarMux{CreatedByID: 1, Name: "Family", Description: "Everyone", HouseholdID: &householdID}
+			require.NoError(t, repo.Create(calendarMux))
+
+			name := "Household"
+			dedupDisabled := true
+			none := uint(0)
+			err := repo.Update(calendarMux.ID, calendarMux.UpdatedAt, CalendarMuxChanges{Name: &name, DedupDisabled: &dedupDisabled, HouseholdID: &none})
+			require.NoError(t, err)
+
+			updated, err := repo.Get(calendarMux.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "Household", updated.Name)
+			assert.Equal(t, "Everyone", updated.Description)
+			assert.True(t, updated.DedupDisabled)
+			assert.Nil(t, updated.HouseholdID)
+			assert.False(t, updated.UpdatedAt.Equal(calendarMux.UpdatedAt))
+
+			// An update based on the previous version is refused
+			other := "Other"
+			err = repo.Update(calendarMux.ID, calendarMux.UpdatedAt, CalendarMuxChanges{Name: &other})
+			assert.ErrorIs(t, err, ErrModified)
+			err = repo.Update(9999, time.Now(), CalendarMuxChanges{Name: &other})
+			assert.ErrorIs(t, err, ErrModified)
+
+			// Changing nothing succeeds without touching the mux
+			require.NoError(t, repo.Update(calendarMux.ID, calendarMux.UpdatedAt, CalendarMuxChanges{}))
+			unchanged, err := repo.Get(calendarMux.ID)
+			require.NoError(t, err)
+			assert.True(t, unchanged.UpdatedAt.Equal(updated.UpdatedAt))
+		})
+	}
+}
+
+func TestCalendarMuxRepository_Delete(t *testing.T) {
+	for name, newRepo := range calendarMuxRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			repo, _ := newRepo()
+			calendarMux := &models.CalendarMux{CreatedByID: 1, Name: "Family"}
+			require.NoError(t, repo.Create(calendarMux))
+
+			require.NoError(t, repo.Delete(calendarMux.ID))
+
+			_, err := repo.Get(calendarMux.ID)
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = repo.GetByFeedToken(calendarMux.FeedToken)
+			assert.ErrorIs(t, err, ErrNotFound)
+			muxes, err := repo.ListByUser(1)
+			require.NoError(t, err)
+			assert.Empty(t, muxes)
+			assert.ErrorIs(t, repo.Delete(calendarMux.ID), ErrNotFound)
+		})
+	}
+}
+
+func TestCalendarMuxRepository_HouseholdRole(t *testing.T) {
+	for name, newRepo := range calendarMuxRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			repo, addMember := newRepo()
+			addMember(7, 2, models.HouseholdRoleEditor)
+
+			role, err := repo.HouseholdRole(7, 2)
+			require.NoError(t, err)
+			assert.Equal(t, models.HouseholdRoleEditor, role)
+
+			role, err = repo.HouseholdRole(7, 3)
+			require.NoError(t, err)
+			assert.Empty(t, role)
+		})
+	}
+}
+
+func TestCalendarMuxRepository_Trash(t *testing.T) {
+	for name, newRepo := range calendarMuxRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			repo, addMember := newRepo()
+			householdID := uint(7)
+			addMember(householdID, 1, models.HouseholdRoleEditor)
+			addMember(householdID, 2, models.HouseholdRoleOwner)
+			kept := &models.CalendarMux{CreatedByID: 1, Name: "Kept"}
+			trashed := &models.CalendarMux{CreatedByID: 1, Name: "Trashed", HouseholdID: &householdID}
+			require.NoError(t, repo.Create(kept))
+			require.NoError(t, repo.Create(trashed))
+			require.NoError(t, repo.Delete(trashed.ID))
+
+			found, err := repo.GetDeleted(trashed.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "Trashed", found.Name)
+			assert.True(t, found.DeletedAt.Valid)
+			_, err = repo.GetDeleted(kept.ID)
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			for _, userID := range []uint{1, 2} {
+				deleted, err := repo.ListDeletedByUser(userID)
+				require.NoError(t, err)
+				require.Len(t, deleted, 1)
+				assert.Equal(t, trashed.ID, deleted[0].ID)
+			}
+			deleted, err := repo.ListDeletedByUser(3)
+			require.NoError(t, err)
+			assert.Empty(t, deleted)
+
+			require.NoError(t, repo.Restore(trashed.ID))
+			restored, err := repo.Get(trashed.ID)
+			require.NoError(t, err)
+			assert.Equal(t, trashed.FeedToken, restored.FeedToken)
+			assert.ErrorIs(t, repo.Restore(trashed.ID), ErrNotFound)
+			assert.ErrorIs(t, repo.Restore(9999), ErrNotFound)
+		})
+	}
+}
+
+func TestCalendarMuxRepository_Purge(t *testing.T) {
+	for name, newRepo := range calendarMuxRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			repo, _ := newRepo()
+			kept := &models.CalendarMux{CreatedByID: 1, Name: "Kept"}
+			trashed := &models.CalendarMux{CreatedByID: 1, Name: "Trashed"}
+			require.NoError(t, repo.Create(kept))
+			require.NoError(t, repo.Create(trashed))
+			before := time.Now().Add(-time.Second)
+			require.NoError(t, repo.Delete(trashed.ID))
+
+			// Muxes deleted after the cutoff stay in the trash
+			purged, err := repo.Purge(before)
+			require.NoError(t, err)
+			assert.Empty(t, purged)
+			_, err = repo.GetDeleted(trashed.ID)
+			require.NoError(t, err)
+
+			purged, err = repo.Purge(time.Now().Add(time.Second))
+			require.NoError(t, err)
+			require.Len(t, purged, 1)
+			assert.Equal(t, trashed.ID, purged[0].ID)
+			assert.Equal(t, "Trashed", purged[0].Name)
+			_, err = repo.GetDeleted(trashed.ID)
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.ErrorIs(t, repo.Restore(trashed.ID), ErrNotFound)
+			_, err = repo.Get(kept.ID)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+// auditLogOf returns the audit log the transactions of a calendar mux repository append to
+func auditLogOf(repo CalendarMuxRepository) AuditLogRepository {
+	if memory, ok := repo.(*MemoryCalendarMuxRepository); ok {
+		return memory.AuditLog()
+	}
+	return NewGormAuditLogRepository(repo.(*GormCalendarMuxRepository).db)
+}
+
+func TestCalendarMuxRepository_Transaction(t *testing.T) {
+	for name, newRepo := range calendarMuxRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			repo, _ := newRepo()
+			create := func(name string) func(muxes CalendarMuxRepository, audit AuditLogRepository) error {
+				return func(muxes CalendarMuxRepository, audit AuditLogRepository) error {
+					calendarMux := &models.CalendarMux{CreatedByID: 1, Name: name}
+					if err := muxes.Create(calendarMux); err != nil {
+						return err
+					}
+					return audit.Append(&models.AuditLog{ActorID: 1, Action: models.AuditActionCreate,
+						EntityType: models.AuditEntityCalendarMux, EntityID: calendarMux.ID, Changes: `{}`})
+				}
+			}
+
+			// A failed transaction leaves neither the mux nor its entry behind
+			failed := errors.New("failed")
+			err := repo.Transaction(func(muxes CalendarMuxRepository, audit AuditLogRepository) error {
+				require.NoError(t, create("Discarded")(muxes, audit))
+				return failed
+			})
+			assert.ErrorIs(t, err, failed)
+			calendarMuxes, err := repo.ListByUser(1)
+			require.NoError(t, err)
+			assert.Empty(t, calendarMuxes)
+			entries, err := auditLogOf(repo).List(AuditLogFilter{VisibleTo: 1})
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+
+			require.NoError(t, repo.Transaction(create("Kept")))
+			calendarMuxes, err = repo.ListByUser(1)
+			require.NoError(t, err)
+			require.Len(t, calendarMuxes, 1)
+			entries, err = auditLogOf(repo).List(AuditLogFilter{VisibleTo: 1})
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, calendarMuxes[0].ID, entries[0].EntityID)
+		})
+	}
+}
+
+func TestGormCalendarMuxRepository_PurgeDeletesDependents(t *testing.T) {
+	t.Parallel()
+	testDB := openTestDB(t)
+	repo := NewGormCalendarMuxRepository(testDB)
+	kept := &models.CalendarMux{CreatedByID: 1, Name: "Kept"}
+	trashed := &models.CalendarMux{CreatedByID: 1, Name: "Trashed"}
+	require.NoError(t, repo.Create(kept))
+	require.NoError(t, repo.Create(trashed))
+	for _, calendarMux := range []*models.CalendarMux{kept, trashed} {
+		source := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/a.ics", Label: "A", Enabled: true}
+		require.NoError(t, testDB.Create(source).Error)
+		require.NoError(t, testDB.Create(&models.CalendarEvent{CalendarSourceID: source.ID, UID: "event", Data: "BEGIN:VEVENT"}).Error)
+		require.NoError(t, testDB.Create(&models.RewriteRule{CalendarSourceID: source.ID, Action: "hide"}).Error)
+	}
+	require.NoError(t, repo.Delete(trashed.ID))
+
+	_, err := repo.Purge(time.Now().Add(time.Second))
+	require.NoError(t, err)
+
+	for _, model := range []interface{}{&models.CalendarMux{}, &models.CalendarSource{}, &models.CalendarEvent{}, &models.RewriteRule{}} {
+		var count int64
+		require.NoError(t, testDB.Unscoped().Model(model).Count(&count).Error)
+		assert.Equal(t, int64(1), count, "%T", model)
+	}
+}
@@ -0,0 +1,11 @@
+// Package repositories holds part of the data access the handlers depend on, behind interfaces
+// with a GORM implementation for the server and an in-memory one for tests
+package repositories
+
+import "errors"
+
+// ErrNotFound is returned when a record does not exist
+var ErrNotFound = errors.New("record not found")
+
+// ErrModified is returned when a record no longer is the version an update was based on
+var ErrModified = errors.New("record has been modified")
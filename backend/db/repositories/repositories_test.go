@@ -0,0 +1,25 @@
+package repositories
+
+import (
+	"testing"
+
+	"family-calendar-backend/db/models"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// openTestDB opens a fresh in-memory database, so that tests can run in parallel
+func openTestDB(t *testing.T) *gorm.DB {
+	testDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	// Keep the in-memory database on one connection
+	sqlDB, err := testDB.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	require.NoError(t, testDB.AutoMigrate(&models.User{}, &models.Household{}, &models.HouseholdMember{}, &models.CalendarMux{}, &models.CalendarSource{}, &models.CalendarEvent{}, &models.RewriteRule{}, &models.AuditLog{}))
+	return testDB
+}
@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"errors"
+	"sync"
+
+	"family-calendar-backend/db/models"
+
+	"gorm.io/gorm"
+)
+
+// UserRepository reads users
+type UserRepository interface {
+	// Get returns the user with the given ID, or ErrNotFound
+	Get(id uint) (*models.User, error)
+}
+
+// GormUserRepository stores users in the database
+type GormUserRepository struct {
+	db *gorm.DB
+}
+
+// NewGormUserRepository returns a UserRepository backed by the given database
+func NewGormUserRepository(db *gorm.DB) *GormUserRepository {
+	return &GormUserRepository{db: db}
+}
+
+func (r *GormUserRepository) Get(id uint) (*models.User, error) {
+	var user models.User
+	if err := r.db.First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// MemoryUserRepository keeps users in memory, for tests
+type MemoryUserRepository struct {
+	mu     sync.Mutex
+	users  map[uint]models.User
+	nextID uint
+}
+
+// NewMemoryUserRepository returns an empty in-memory UserRepository
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{users: map[uint]models.User{}, nextID: 1}
+}
+
+// Add stores a user, assigning it an ID unless it has one
+func (r *MemoryUserRepository) Add(user *models.User) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if user.ID == 0 {
+		user.ID = r.nextID
+	}
+	if user.ID >= r.nextID {
+		r.nextID = user.ID + 1
+	}
+	r.users[user.ID] = *user
+}
+
+func (r *MemoryUserRepository) Get(id uint) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
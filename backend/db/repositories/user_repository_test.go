@@ -0,0 +1,45 @@
+package repositories
+
+import (
+	"testing"
+
+	"family-calendar-backend/db/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// userRepositories returns each UserRepository implementation with a function that stores a user in it
+func userRepositories(t *testing.T) map[string]func() (UserRepository, func(*models.User)) {
+	return map[string]func() (UserRepository, func(*models.User)){
+		"gorm": func() (UserRepository, func(*models.User)) {
+			testDB := openTestDB(t)
+			return NewGormUserRepository(testDB), func(user *models.User) {
+				require.NoError(t, testDB.Create(user).Error)
+			}
+		},
+		"memory": func() (UserRepository, func(*models.User)) {
+			repo := NewMemoryUserRepository()
+			return repo, repo.Add
+		},
+	}
+}
+
+func TestUserRepository_Get(t *testing.T) {
+	for name, newRepo := range userRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			repo, add := newRepo()
+			user := &models.User{GivenName: "John", FamilyName: "Doe", Email: "john@example.com"}
+			add(user)
+
+			found, err := repo.Get(user.ID)
+			require.NoError(t, err)
+			assert.Equal(t, user.ID, found.ID)
+			assert.Equal(t, "John", found.GivenName)
+			assert.Equal(t, "john@example.com", found.Email)
+
+			_, err = repo.Get(user.ID + 1)
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/repositories"
+
+	"gorm.io/gorm"
+)
+
+// importEntityProfile is the type of the imported profile, which has no audit log entity type
+const importEntityProfile = "profile"
+
+// AccountHousehold is a household membership of an account
+type AccountHousehold struct {
+	Household models.Household
+	Role      string
+	// Members are the other members of a household the account owns, with their users loaded
+	Members []models.HouseholdMember
+}
+
+// AccountData is what moves with a user account between instances: the profile, the household
+// memberships, and the calendar muxes the user created and may still edit, with their sources and
+// rewrite rules. IDs are those of the instance the data comes from, and the entities reference
+// each other by them.
+type AccountData struct {
+	User            models.User
+	Households      []AccountHousehold
+	CalendarMuxes   []models.CalendarMux
+	CalendarSources []models.CalendarSource
+	RewriteRules    []models.RewriteRule
+}
+
+// ImportConflict is a part of imported account data that could not be imported as it was
+type ImportConflict struct {
+	EntityType string
+	// ID is the ID of the entity in the imported data, or 0 for the profile
+	ID     uint
+	Reason string
+}
+
+// AccountImport is the outcome of an import. Its maps take the IDs in the imported data to the IDs
+// of the entities they were imported as.
+type AccountImport struct {
+	Households      map[uint]uint
+	CalendarMuxes   map[uint]uint
+	CalendarSources map[uint]uint
+	RewriteRules    map[uint]uint
+	Conflicts       []ImportConflict
+}
+
+// conflict records a part of the imported data that could not be imported as it was
+func (i *AccountImport) conflict(entityType string, id uint, format string, args ...interface{}) {
+	i.Conflicts = append(i.Conflicts, ImportConflict{EntityType: entityType, ID: id, Reason: fmt.Sprintf(format, args...)})
+}
+
+// ExportAccount returns the data of a user account. Muxes in the trash are left out, and so are
+// the feed tokens and sync state, which belong to the instance.
+func ExportAccount(userID uint) (*AccountData, error) {
+	data := &AccountData{}
+	if err := db.DB.First(&data.User, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	memberships, err := GetHouseholdMembershipsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	roles := map[uint]string{}
+	for _, membership := range memberships {
+		roles[membership.HouseholdID] = membership.Role
+		// Preloading skips soft-deleted households
+		if membership.Household.ID == 0 {
+			continue
+		}
+		household := AccountHousehold{Household: membership.Household, Role: membership.Role}
+		if membership.Role == models.HouseholdRoleOwner {
+			result := db.DB.Preload("User").Where("household_id = ? AND user_id <> ?", membership.HouseholdID, userID).Order("id").Find(&household.Members)
+			if result.Error != nil {
+				return nil, result.Error
+			}
+		}
+		data.Households = append(data.Households, household)
+	}
+
+	// Of the muxes the user can access, export those they created and still may edit, which
+	// leaves out household muxes of households they left or were demoted to viewer in
+	calendarMuxes, err := repositories.NewGormCalendarMuxRepository(db.DB).ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	muxIDs := []uint{}
+	for _, calendarMux := range calendarMuxes {
+		if calendarMux.CreatedByID != userID {
+			continue
+		}
+		if calendarMux.HouseholdID != nil && !roleAtLeast(roles[*calendarMux.HouseholdID], models.HouseholdRoleEditor) {
+			continue
+		}
+		data.CalendarMuxes = append(data.CalendarMuxes, calendarMux)
+		muxIDs = append(muxIDs, calendarMux.ID)
+	}
+	if err := db.DB.Where("calendar_mux_id IN ?", muxIDs).Order("id").Find(&data.CalendarSources).Error; err != nil {
+		return nil, err
+	}
+	sourceIDs := db.DB.Model(&models.CalendarSource{}).Select("id").Where("calendar_mux_id IN ?", muxIDs)
+	if err := db.DB.Where("calendar_source_id IN (?)", sourceIDs).Order("calendar_source_id, position").Find(&data.RewriteRules).Error; err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ImportAccount recreates exported account data in the account of a user, with new IDs. The
+// profile of the account is kept. Households the user owned are matched by name with households
+// the user is a member of, and created when there is none; other households are only matched.
+// Members are added to the households the user owns when they have an account with their email
+// address. Calendar muxes whose name the user already uses are skipped, so that an import can be
+// repeated. Whatever cannot be imported as it was is reported as a conflict, and everything else
+// is imported in one transaction.
+func ImportAccount(userID uint, data *AccountData, requestID string) (*AccountImport, error) {
+	result := &AccountImport{
+		Households:      map[uint]uint{},
+		CalendarMuxes:   map[uint]uint{},
+		CalendarSources: map[uint]uint{},
+		RewriteRules:    map[uint]uint{},
+	}
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.First(&user, userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+		if data.User.Email != "" && !strings.EqualFold(data.User.Email, user.Email) {
+			result.conflict(importEntityProfile, 0, "The data was exported by %s; the profile of this account was kept", data.User.Email)
+		}
+
+		for i := range data.Households {
+			if err := importHousehold(tx, userID, &data.Households[i], result, requestID); err != nil {
+				return err
+			}
+		}
+		for i := range data.CalendarMuxes {
+			if err := importCalendarMux(tx, userID, &data.CalendarMuxes[i], result, requestID); err != nil {
+				return err
+			}
+		}
+		for i := range data.CalendarSources {
+			if err := importCalendarSource(tx, userID, &data.CalendarSources[i], result, requestID); err != nil {
+				return err
+			}
+		}
+		for i := range data.RewriteRules {
+			if err := importRewriteRule(tx, userID, &data.RewriteRules[i], result, requestID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// importHousehold matches an imported household with one the user is a member of, or creates it
+// when the user owned it, and adds its members to it when the user owns it
+func importHousehold(tx *gorm.DB, userID uint, imported *AccountHousehold, result *AccountImport, requestID string) error {
+	memberships := tx.Model(&models.HouseholdMember{}).Select("household_id").Where("user_id = ?", userID)
+	var household models.Household
+	found := tx.Where("name = ? AND id IN (?)", imported.Household.Name, memberships).Order("id").Limit(1).Find(&household)
+	if found.Error != nil {
+		return found.Error
+	}
+
+	role := models.HouseholdRoleOwner
+	switch {
+	case found.RowsAffected > 0:
+		var err error
+		if role, err = getHouseholdRole(tx, household.ID, userID); err != nil {
+			return err
+		}
+		result.conflict(models.AuditEntityHousehold, imported.Household.ID, "You already are a member of a household named %q, which was used instead", household.Name)
+	case imported.Role != models.HouseholdRoleOwner:
+		result.conflict(models.AuditEntityHousehold, imported.Household.ID, "You are not a member of a household named %q; only its owners can add you", imported.Household.Name)
+		return nil
+	default:
+		household = models.Household{Name: imported.Household.Name, CreatedByID: userID}
+		if err := tx.Create(&household).Error; err != nil {
+			return err
+		}
+		if err := recordAuditLog(tx, userID, models.AuditActionCreate, models.AuditEntityHousehold, household.ID,
+			&household.ID, nil, householdAuditFields(&household), requestID); err != nil {
+			return err
+		}
+		owner := &models.HouseholdMember{HouseholdID: household.ID, UserID: userID, Role: models.HouseholdRoleOwner}
+		if err := createHouseholdMember(tx, userID, owner, requestID); err != nil {
+			return err
+		}
+	}
+	result.Households[imported.Household.ID] = household.ID
+
+	if len(imported.Members) > 0 && role != models.HouseholdRoleOwner {
+		result.conflict(models.AuditEntityHousehold, imported.Household.ID, "You are not an owner of the household named %q, so its members were not added", household.Name)
+		return nil
+	}
+	for _, importedMember := range imported.Members {
+		// Users without a verified email address cannot be found by one
+		if importedMember.User.Email == "" {
+			result.conflict(models.AuditEntityHouseholdMember, importedMember.ID, "The member has no email address to find them by")
+			continue
+		}
+		var user models.User
+		found := tx.Where("LOWER(email) = ?", strings.ToLower(importedMember.User.Email)).Limit(1).Find(&user)
+		if found.Error != nil {
+			return found.Error
+		}
+		if found.RowsAffected == 0 {
+			result.conflict(models.AuditEntityHouseholdMember, importedMember.ID, "No user has the email address %s; they need to sign in once before they can be added", importedMember.User.Email)
+			continue
+		}
+		existing, err := getHouseholdRole(tx, household.ID, user.ID)
+		if err != nil {
+			return err
+		}
+		if existing != "" {
+			continue
+		}
+		member := &models.HouseholdMember{HouseholdID: household.ID, UserID: user.ID, Role: importedMember.Role}
+		if err := createHouseholdMember(tx, userID, member, requestID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importCalendarMux creates an imported calendar mux for the user, shared with the household it
+// was shared with when that was imported and the user may share with it
+func importCalendarMux(tx *gorm.DB, userID uint, imported *models.CalendarMux, result *AccountImport, requestID string) error {
+	var existing int64
+	if err := tx.Model(&models.CalendarMux{}).Where("created_by_id = ? AND name = ?", userID, imported.Name).Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		result.conflict(models.AuditEntityCalendarMux, imported.ID, "You already have a calendar mux named %q, so it was skipped", imported.Name)
+		return nil
+	}
+
+	var householdID *uint
+	if imported.HouseholdID != nil {
+		if id, ok := result.Households[*imported.HouseholdID]; !ok {
+			result.conflict(models.AuditEntityCalendarMux, imported.ID, "Its household was not imported, so it is not shared")
+		} else if role, err := getHouseholdRole(tx, id, userID); err != nil {
+			return err
+		} else if !roleAtLeast(role, models.HouseholdRoleEditor) {
+			result.conflict(models.AuditEntityCalendarMux, imported.ID, "You are not an editor of its household, so it is not shared")
+		} else {
+			householdID = &id
+		}
+	}
+
+	calendarMux := &models.CalendarMux{
+		CreatedByID:   userID,
+		HouseholdID:   householdID,
+		Name:          imported.Name,
+		Description:   imported.Description,
+		DedupDisabled: imported.DedupDisabled,
+	}
+	if err := tx.Create(calendarMux).Error; err != nil {
+		return err
+	}
+	if err := recordAuditLog(tx, userID, models.AuditActionCreate, models.AuditEntityCalendarMux, calendarMux.ID,
+		calendarMux.HouseholdID, nil, calendarMuxAuditFields(calendarMux), requestID); err != nil {
+		return err
+	}
+	result.CalendarMuxes[imported.ID] = calendarMux.ID
+	return nil
+}
+
+// importCalendarSource attaches an imported calendar source to the mux it was imported as
+func importCalendarSource(tx *gorm.DB, userID uint, imported *models.CalendarSource, result *AccountImport, requestID string) error {
+	calendarMuxID, ok := result.CalendarMuxes[imported.CalendarMuxID]
+	if !ok {
+		result.conflict(models.AuditEntityCalendarSource, imported.ID, "Its calendar mux was not imported")
+		return nil
+	}
+	householdID, err := calendarMuxHouseholdID(tx, calendarMuxID)
+	if err != nil {
+		return err
+	}
+
+	calendarSource := &models.CalendarSource{
+		CalendarMuxID: calendarMuxID,
+		URL:           imported.URL,
+		Label:         imported.Label,
+		Enabled:       imported.Enabled,
+		Visibility:    imported.Visibility,
+	}
+	if err := tx.Create(calendarSource).Error; err != nil {
+		return err
+	}
+	if err := recordAuditLog(tx, userID, models.AuditActionCreate, models.AuditEntityCalendarSource, calendarSource.ID,
+		householdID, nil, calendarSourceAuditFields(calendarSource), requestID); err != nil {
+		return err
+	}
+	result.CalendarSources[imported.ID] = calendarSource.ID
+	return nil
+}
+
+// calendarMuxHouseholdID returns the household a calendar mux is shared with
+func calendarMuxHouseholdID(tx *gorm.DB, calendarMuxID uint) (*uint, error) {
+	var calendarMux models.CalendarMux
+	if err := tx.Select("household_id").Where("id = ?", calendarMuxID).First(&calendarMux).Error; err != nil {
+		return nil, err
+	}
+	return calendarMux.HouseholdID, nil
+}
+
+// importRewriteRule adds an imported rewrite rule to the source it was imported as
+func importRewriteRule(tx *gorm.DB, userID uint, imported *models.RewriteRule, result *AccountImport, requestID string) error {
+	calendarSourceID, ok := result.CalendarSources[imported.CalendarSourceID]
+	if !ok {
+		result.conflict(models.AuditEntityRewriteRule, imported.ID, "Its calendar source was not imported")
+		return nil
+	}
+	var calendarSource models.CalendarSource
+	if err := tx.Select("calendar_mux_id").Where("id = ?", calendarSourceID).First(&calendarSource).Error; err != nil {
+		return err
+	}
+	householdID, err := calendarMuxHouseholdID(tx, calendarSource.CalendarMuxID)
+	if err != nil {
+		return err
+	}
+
+	rule := &models.RewriteRule{
+		CalendarSourceID: calendarSourceID,
+		Position:         imported.Position,
+		Action:           imported.Action,
+		Pattern:          imported.Pattern,
+		Value:            imported.Value,
+	}
+	if err := tx.Create(rule).Error; err != nil {
+		return err
+	}
+	if err := recordAuditLog(tx, userID, models.AuditActionCreate, models.AuditEntityRewriteRule, rule.ID,
+		householdID, nil, rewriteRuleAuditFields(rule), requestID); err != nil {
+		return err
+	}
+	result.RewriteRules[imported.ID] = rule.ID
+	return nil
+}
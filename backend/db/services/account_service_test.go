@@ -0,0 +1,208 @@
+package services
+
+import (
+	"testing"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupAccountTestDB gives the owner of the household from setupHouseholdTestDB a shared mux with a
+// source and a rewrite rule, and a private mux
+func setupAccountTestDB(t *testing.T) (household *models.Household, owner, editor, viewer *models.User) {
+	household, owner, editor, viewer = setupHouseholdTestDB(t)
+	shared, err := calendarMuxService().Create(owner.ID, "Family", "Everyone", true, &household.ID, "")
+	require.NoError(t, err)
+	calendarSource, err := calendarMuxService().CreateCalendarSource(shared.ID, owner.ID, "https://example.com/school.ics", "School", true, models.VisibilityTitleOnly, "")
+	require.NoError(t, err)
+	_, err = calendarMuxService().CreateRewriteRule(calendarSource.ID, shared.ID, owner.ID, models.RewriteActionPrefix, "", "School: ", nil, "")
+	require.NoError(t, err)
+	_, err = calendarMuxService().Create(owner.ID, "Private", "", false, nil, "")
+	require.NoError(t, err)
+	return household, owner, editor, viewer
+}
+
+func TestExportAccount(t *testing.T) {
+	household, owner, editor, viewer := setupAccountTestDB(t)
+	// Muxes of other users and muxes in the trash are not exported
+	_, err := calendarMuxService().Create(editor.ID, "Editor's", "", true, &household.ID, "")
+	require.NoError(t, err)
+	trashed, err := calendarMuxService().Create(owner.ID, "Trashed", "", true, nil, "")
+	require.NoError(t, err)
+	require.NoError(t, calendarMuxService().Delete(trashed.ID, owner.ID, ""))
+
+	data, err := ExportAccount(owner.ID)
+	require.NoError(t, err)
+
+	assert.Equal(t, owner.Email, data.User.Email)
+	require.Len(t, data.Households, 1)
+	assert.Equal(t, "Family", data.Households[0].Household.Name)
+	assert.Equal(t, models.HouseholdRoleOwner, data.Households[0].Role)
+	require.Len(t, data.Households[0].Members, 2)
+	assert.Equal(t, editor.Email, data.Households[0].Members[0].User.Email)
+	assert.Equal(t, viewer.Email, data.Households[0].Members[1].User.Email)
+	require.Len(t, data.CalendarMuxes, 2)
+	assert.Equal(t, "Family", data.CalendarMuxes[0].Name)
+	assert.Equal(t, &household.ID, data.CalendarMuxes[0].HouseholdID)
+	assert.Equal(t, "Private", data.CalendarMuxes[1].Name)
+	require.Len(t, data.CalendarSources, 1)
+	assert.Equal(t, data.CalendarMuxes[0].ID, data.CalendarSources[0].CalendarMuxID)
+	require.Len(t, data.RewriteRules, 1)
+	assert.Equal(t, data.CalendarSources[0].ID, data.RewriteRules[0].CalendarSourceID)
+
+	// Members only see their own membership
+	data, err = ExportAccount(editor.ID)
+	require.NoError(t, err)
+	require.Len(t, data.Households, 1)
+	assert.Empty(t, data.Households[0].Members)
+
+	_, err = ExportAccount(9999)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestExportAccount_NeedsEditorRoleForHouseholdMuxes(t *testing.T) {
+	household, owner, editor, _ := setupAccountTestDB(t)
+	calendarMux, err := calendarMuxService().Create(editor.ID, "Editor's", "", true, &household.ID, "")
+	require.NoError(t, err)
+	_, err = calendarMuxService().CreateCalendarSource(calendarMux.ID, editor.ID, "https://example.com/private.ics", "Private", true, models.VisibilityFull, "")
+	require.NoError(t, err)
+	_, err = calendarMuxService().Create(editor.ID, "Personal", "", true, nil, "")
+	require.NoError(t, err)
+
+	data, err := ExportAccount(editor.ID)
+	require.NoError(t, err)
+	require.Len(t, data.CalendarMuxes, 2)
+	require.Len(t, data.CalendarSources, 1)
+
+	// Demoted or removed creators keep only their personal muxes
+	_, err = UpdateHouseholdMemberRole(household.ID, owner.ID, editor.ID, models.HouseholdRoleViewer, "")
+	require.NoError(t, err)
+	data, err = ExportAccount(editor.ID)
+	require.NoError(t, err)
+	require.Len(t, data.CalendarMuxes, 1)
+	assert.Equal(t, "Personal", data.CalendarMuxes[0].Name)
+	assert.Empty(t, data.CalendarSources)
+
+	require.NoError(t, RemoveHouseholdMember(household.ID, owner.ID, editor.ID, ""))
+	data, err = ExportAccount(editor.ID)
+	require.NoError(t, err)
+	require.Len(t, data.CalendarMuxes, 1)
+	assert.Empty(t, data.CalendarSources)
+	assert.Empty(t, data.RewriteRules)
+}
+
+func TestImportAccount_RecreatesWithNewIDs(t *testing.T) {
+	_, owner, _, _ := setupAccountTestDB(t)
+	data, err := ExportAccount(owner.ID)
+	require.NoError(t, err)
+
+	// Another instance, where the editor has an account but the viewer does not, and where IDs
+	// are taken by other data
+	setupTestDB(t)
+	createHouseholdUser(t, "someone")
+	target := createHouseholdUser(t, "owner")
+	editor := createHouseholdUser(t, "editor")
+	_, err = CreateHousehold(editor.ID, "Other", "")
+	require.NoError(t, err)
+	_, err = calendarMuxService().Create(editor.ID, "Other", "", true, nil, "")
+	require.NoError(t, err)
+
+	result, err := ImportAccount(target.ID, data, "req-import")
+	require.NoError(t, err)
+
+	require.Len(t, result.Conflicts, 1)
+	assert.Equal(t, models.AuditEntityHouseholdMember, result.Conflicts[0].EntityType)
+	assert.Equal(t, data.Households[0].Members[1].ID, result.Conflicts[0].ID)
+	assert.Contains(t, result.Conflicts[0].Reason, "viewer@example.com")
+
+	householdID := result.Households[data.Households[0].Household.ID]
+	require.NotZero(t, householdID)
+	household, members, err := GetHousehold(householdID, target.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Family", household.Name)
+	require.Len(t, members, 2)
+	assert.Equal(t, target.ID, members[0].UserID)
+	assert.Equal(t, models.HouseholdRoleOwner, members[0].Role)
+	assert.Equal(t, editor.ID, members[1].UserID)
+	assert.Equal(t, models.HouseholdRoleEditor, members[1].Role)
+
+	require.Len(t, result.CalendarMuxes, 2)
+	shared, err := calendarMuxService().Get(result.CalendarMuxes[data.CalendarMuxes[0].ID], target.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Family", shared.Name)
+	assert.Equal(t, "Everyone", shared.Description)
+	assert.Equal(t, &householdID, shared.HouseholdID)
+	assert.NotEqual(t, data.CalendarMuxes[0].FeedToken, shared.FeedToken)
+	private, err := calendarMuxService().Get(result.CalendarMuxes[data.CalendarMuxes[1].ID], target.ID)
+	require.NoError(t, err)
+	assert.True(t, private.DedupDisabled)
+	assert.Nil(t, private.HouseholdID)
+
+	sources, err := calendarMuxService().GetCalendarSourcesByMux(shared.ID, target.ID)
+	require.NoError(t, err)
+	require.Len(t, sources, 1)
+	assert.Equal(t, result.CalendarSources[data.CalendarSources[0].ID], sources[0].ID)
+	assert.Equal(t, models.VisibilityTitleOnly, sources[0].Visibility)
+	rules, err := calendarMuxService().GetRewriteRules(sources[0].ID, shared.ID, target.ID)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	assert.Equal(t, "School: ", rules[0].Value)
+
+	var audited int64
+	db.DB.Model(&models.AuditLog{}).Where("request_id = ?", "req-import").Count(&audited)
+	assert.Equal(t, int64(7), audited, "household, two members, two muxes, a source and a rule")
+}
+
+func TestImportAccount_ReportsConflicts(t *testing.T) {
+	household, owner, editor, _ := setupAccountTestDB(t)
+	data, err := ExportAccount(owner.ID)
+	require.NoError(t, err)
+
+	// Importing again into the same account reuses the household and skips what exists
+	result, err := ImportAccount(owner.ID, data, "")
+	require.NoError(t, err)
+	assert.Equal(t, household.ID, result.Households[household.ID])
+	assert.Empty(t, result.CalendarMuxes)
+	assert.Empty(t, result.CalendarSources)
+	assert.Empty(t, result.RewriteRules)
+	entityTypes := []string{}
+	for _, conflict := range result.Conflicts {
+		entityTypes = append(entityTypes, conflict.EntityType)
+	}
+	assert.Equal(t, []string{
+		models.AuditEntityHousehold,
+		models.AuditEntityCalendarMux,
+		models.AuditEntityCalendarMux,
+		models.AuditEntityCalendarSource,
+		models.AuditEntityRewriteRule,
+	}, entityTypes)
+	_, members, err := GetHousehold(household.ID, owner.ID)
+	require.NoError(t, err)
+	assert.Len(t, members, 3)
+
+	// Households the user did not own are not created, and their muxes are imported unshared
+	for i := range data.Households {
+		data.Households[i].Role = models.HouseholdRoleEditor
+		data.Households[i].Household.Name = "Elsewhere"
+	}
+	result, err = ImportAccount(editor.ID, data, "")
+	require.NoError(t, err)
+	assert.Empty(t, result.Households)
+	require.Len(t, result.CalendarMuxes, 2)
+	reasons := []string{}
+	for _, conflict := range result.Conflicts {
+		reasons = append(reasons, conflict.Reason)
+	}
+	assert.Contains(t, reasons, "The data was exported by owner@example.com; the profile of this account was kept")
+	assert.Contains(t, reasons, `You are not a member of a household named "Elsewhere"; only its owners can add you`)
+	assert.Contains(t, reasons, "Its household was not imported, so it is not shared")
+	imported, err := calendarMuxService().Get(result.CalendarMuxes[data.CalendarMuxes[0].ID], editor.ID)
+	require.NoError(t, err)
+	assert.Nil(t, imported.HouseholdID)
+
+	_, err = ImportAccount(9999, data, "")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
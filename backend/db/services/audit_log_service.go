@@ -0,0 +1,141 @@
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/repositories"
+
+	"gorm.io/gorm"
+)
+
+// auditFields are the fields of an entity the audit log records, by their API name
+type auditFields map[string]interface{}
+
+// auditChange is the value of a field before and after a change
+type auditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// calendarMuxAuditFields returns the audited fields of a calendar mux. The feed token is left out,
+// since the audit log must not hand out access to the feed.
+func calendarMuxAuditFields(calendarMux *models.CalendarMux) auditFields {
+	return auditFields{
+		"name":          calendarMux.Name,
+		"description":   calendarMux.Description,
+		"dedup_enabled": !calendarMux.DedupDisabled,
+		"household_id":  optionalID(calendarMux.HouseholdID),
+	}
+}
+
+// calendarSourceAuditFields returns the audited fields of a calendar source
+func calendarSourceAuditFields(calendarSource *models.CalendarSource) auditFields {
+	return auditFields{
+		"calendar_mux_id": calendarSource.CalendarMuxID,
+		"url":             calendarSource.URL,
+		"label":           calendarSource.Label,
+		"enabled":         calendarSource.Enabled,
+		"visibility":      calendarSource.Visibility,
+	}
+}
+
+// householdAuditFields returns the audited fields of a household
+func householdAuditFields(household *models.Household) auditFields {
+	return auditFields{"name": household.Name}
+}
+
+// householdMemberAuditFields returns the audited fields of a household membership
+func householdMemberAuditFields(member *models.HouseholdMember) auditFields {
+	return auditFields{
+		"household_id": member.HouseholdID,
+		"user_id":      member.UserID,
+		"role":         member.Role,
+	}
+}
+
+// householdInviteAuditFields returns the audited fields of a household invite. The token hash is
+// left out, like the token itself.
+func householdInviteAuditFields(invite *models.HouseholdInvite) auditFields {
+	return auditFields{
+		"household_id": invite.HouseholdID,
+		"role":         invite.Role,
+		"expires_at":   invite.ExpiresAt.UTC().Format(time.RFC3339),
+		"revoked_at":   optionalTime(invite.RevokedAt),
+	}
+}
+
+// rewriteRuleAuditFields returns the audited fields of a rewrite rule
+func rewriteRuleAuditFields(rule *models.RewriteRule) auditFields {
+	return auditFields{
+		"calendar_source_id": rule.CalendarSourceID,
+		"position":           rule.Position,
+		"action":             rule.Action,
+		"pattern":            rule.Pattern,
+		"value":              rule.Value,
+	}
+}
+
+// optionalID returns the value of an optional ID, or nil when it is unset
+func optionalID(id *uint) interface{} {
+	if id == nil {
+		return nil
+	}
+	return *id
+}
+
+// optionalTime returns the value of an optional time in RFC 3339, or nil when it is unset
+func optionalTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// newAuditLog builds the audit log entry for a change of an entity from before to after, where
+// before is nil for created entities and after is nil for deleted ones. Only the fields that
+// changed are recorded.
+func newAuditLog(actorID uint, action, entityType string, entityID uint, householdID *uint, before, after auditFields, requestID string) (*models.AuditLog, error) {
+	changes := map[string]auditChange{}
+	for field, value := range before {
+		if !reflect.DeepEqual(value, after[field]) {
+			changes[field] = auditChange{Before: value, After: after[field]}
+		}
+	}
+	for field, value := range after {
+		if _, ok := before[field]; !ok {
+			changes[field] = auditChange{After: value}
+		}
+	}
+	encoded, err := json.Marshal(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuditLog{
+		ActorID:     actorID,
+		Action:      action,
+		EntityType:  entityType,
+		EntityID:    entityID,
+		HouseholdID: householdID,
+		Changes:     string(encoded),
+		RequestID:   requestID,
+	}, nil
+}
+
+// appendAuditLog records a change in the audit log; see newAuditLog
+func appendAuditLog(audit repositories.AuditLogRepository, actorID uint, action, entityType string, entityID uint, householdID *uint, before, after auditFields, requestID string) error {
+	entry, err := newAuditLog(actorID, action, entityType, entityID, householdID, before, after, requestID)
+	if err != nil {
+		return err
+	}
+	return audit.Append(entry)
+}
+
+// recordAuditLog records a change in the audit log within the transaction that makes it, so that
+// the change and its entry are stored together or not at all
+func recordAuditLog(tx *gorm.DB, actorID uint, action, entityType string, entityID uint, householdID *uint, before, after auditFields, requestID string) error {
+	return appendAuditLog(repositories.NewGormAuditLogRepository(tx), actorID, action, entityType, entityID, householdID, before, after, requestID)
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/repositories"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// auditLogEntries returns the audit log entries the user may read, oldest first
+func auditLogEntries(t *testing.T, audit repositories.AuditLogRepository, userID uint) []models.AuditLog {
+	entries, err := audit.List(repositories.AuditLogFilter{VisibleTo: userID})
+	require.NoError(t, err)
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries
+}
+
+func TestNewAuditLog_RecordsChangedFields(t *testing.T) {
+	householdID := uint(7)
+	before := &models.CalendarMux{Name: "Family", Description: "Everyone", HouseholdID: &householdID}
+	after := &models.CalendarMux{Name: "Household", Description: "Everyone"}
+
+	entry, err := newAuditLog(1, models.AuditActionUpdate, models.AuditEntityCalendarMux, 5, &householdID,
+		calendarMuxAuditFields(before), calendarMuxAuditFields(after), "req-1")
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), entry.ActorID)
+	assert.Equal(t, uint(5), entry.EntityID)
+	assert.Equal(t, "req-1", entry.RequestID)
+	assert.JSONEq(t, `{"name":{"before":"Family","after":"Household"},"household_id":{"before":7,"after":null}}`, entry.Changes)
+
+	// Created entities have every field, with no values before
+	entry, err = newAuditLog(1, models.AuditActionCreate, models.AuditEntityHousehold, 7, &householdID,
+		nil, householdAuditFields(&models.Household{Name: "Family"}), "")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":{"before":null,"after":"Family"}}`, entry.Changes)
+
+	entry, err = newAuditLog(1, models.AuditActionDelete, models.AuditEntityHousehold, 7, &householdID,
+		householdAuditFields(&models.Household{Name: "Family"}), nil, "")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":{"before":"Family","after":null}}`, entry.Changes)
+}
+
+func TestCalendarMuxService_RecordsAuditLog(t *testing.T) {
+	t.Parallel()
+	muxes := repositories.NewMemoryCalendarMuxRepository()
+	audit := muxes.AuditLog()
+	service := NewCalendarMuxService(muxes)
+	householdID := uint(7)
+	muxes.AddHouseholdMember(householdID, 1, models.HouseholdRoleOwner)
+	audit.AddHouseholdMember(householdID, 2, models.HouseholdRoleOwner)
+
+	calendarMux, err := service.Create(1, "Family", "", true, &householdID, "req-create")
+	require.NoError(t, err)
+	name := "Household"
+	_, err = service.Update(calendarMux.ID, 1, CalendarMuxUpdate{Name: &name}, nil, "req-update")
+	require.NoError(t, err)
+	require.NoError(t, service.Delete(calendarMux.ID, 1, "req-delete"))
+	_, err = service.Restore(calendarMux.ID, 1, "req-restore")
+	require.NoError(t, err)
+	// Failed changes are not recorded
+	_, err = service.Update(calendarMux.ID, 3, CalendarMuxUpdate{Name: &name}, nil, "req-denied")
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+
+	// Another owner of the household reads the changes
+	entries := auditLogEntries(t, audit, 2)
+	require.Len(t, entries, 4)
+	for i, action := range []string{models.AuditActionCreate, models.AuditActionUpdate, models.AuditActionDelete, models.AuditActionRestore} {
+		assert.Equal(t, action, entries[i].Action)
+		assert.Equal(t, "req-"+action, entries[i].RequestID)
+		assert.Equal(t, uint(1), entries[i].ActorID)
+		assert.Equal(t, models.AuditEntityCalendarMux, entries[i].EntityType)
+		assert.Equal(t, calendarMux.ID, entries[i].EntityID)
+		assert.Equal(t, &householdID, entries[i].HouseholdID)
+	}
+	assert.JSONEq(t, `{"name":{"before":"Family","after":"Household"}}`, entries[1].Changes)
+	assert.NotContains(t, entries[0].Changes, calendarMux.FeedToken)
+}
+
+func TestCalendarMuxService_AuditFailureRollsBackChange(t *testing.T) {
+	setupTestDB(t)
+	calendarMux, err := calendarMuxService().Create(1, "Family", "", true, nil, "")
+	require.NoError(t, err)
+
+	// Without the audit log table no change can be recorded, so none is made
+	require.NoError(t, db.DB.Migrator().DropTable(&models.AuditLog{}))
+	_, err = calendarMuxService().Create(1, "Second", "", true, nil, "")
+	assert.Error(t, err)
+	assert.Error(t, calendarMuxService().Delete(calendarMux.ID, 1, ""))
+
+	calendarMuxes, err := calendarMuxService().List(1)
+	require.NoError(t, err)
+	require.Len(t, calendarMuxes, 1)
+	assert.Equal(t, calendarMux.ID, calendarMuxes[0].ID)
+}
+
+func TestCalendarSourceChanges_RecordAuditLog(t *testing.T) {
+	household, owner, editor, _ := setupHouseholdTestDB(t)
+	calendarMux, err := calendarMuxService().Create(editor.ID, "Family", "", true, &household.ID, "")
+	require.NoError(t, err)
+
+	calendarSource, err := calendarMuxService().CreateCalendarSource(calendarMux.ID, editor.ID, "https://example.com/school.ics", "School", true, models.VisibilityFull, "req-1")
+	require.NoError(t, err)
+	_, err = calendarMuxService().UpdateCalendarSourceVisibility(calendarSource.ID, calendarMux.ID, editor.ID, models.VisibilityBusyOnly, "req-2")
+	require.NoError(t, err)
+	require.NoError(t, calendarMuxService().DeleteCalendarSource(calendarSource.ID, calendarMux.ID, editor.ID, "req-3"))
+
+	audit := repositories.NewGormAuditLogRepository(db.DB)
+	entries, err := audit.List(repositories.AuditLogFilter{VisibleTo: owner.ID, EntityType: models.AuditEntityCalendarSource, EntityID: calendarSource.ID})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, models.AuditActionDelete, entries[0].Action)
+	assert.Equal(t, "req-3", entries[0].RequestID)
+	assert.Equal(t, models.AuditActionUpdate, entries[1].Action)
+	assert.JSONEq(t, `{"visibility":{"before":"full","after":"busy_only"}}`, entries[1].Changes)
+	assert.Equal(t, models.AuditActionCreate, entries[2].Action)
+	for _, entry := range entries {
+		assert.Equal(t, editor.ID, entry.ActorID)
+		assert.Equal(t, &household.ID, entry.HouseholdID)
+	}
+}
+
+func TestRewriteRuleChanges_RecordAuditLog(t *testing.T) {
+	household, owner, editor, _ := setupHouseholdTestDB(t)
+	calendarMux, err := calendarMuxService().Create(editor.ID, "Family", "", true, &household.ID, "")
+	require.NoError(t, err)
+	calendarSource, err := calendarMuxService().CreateCalendarSource(calendarMux.ID, editor.ID, "https://example.com/grandma.ics", "Grandma", true, models.VisibilityFull, "")
+	require.NoError(t, err)
+
+	rule, err := calendarMuxService().CreateRewriteRule(calendarSource.ID, calendarMux.ID, editor.ID, models.RewriteActionPrefix, "", "Grandma: ", nil, "req-1")
+	require.NoError(t, err)
+	_, err = calendarMuxService().UpdateRewriteRule(rule.ID, calendarSource.ID, calendarMux.ID, editor.ID, models.RewriteActionDrop, ".*", "", nil, "req-2")
+	require.NoError(t, err)
+	require.NoError(t, calendarMuxService().DeleteRewriteRule(rule.ID, calendarSource.ID, calendarMux.ID, editor.ID, "req-3"))
+
+	// The household owner finds out who made the rule drop every event
+	audit := repositories.NewGormAuditLogRepository(db.DB)
+	entries, err := audit.List(repositories.AuditLogFilter{VisibleTo: owner.ID, EntityType: models.AuditEntityRewriteRule, EntityID: rule.ID})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, models.AuditActionDelete, entries[0].Action)
+	assert.Equal(t, "req-3", entries[0].RequestID)
+	assert.Equal(t, models.AuditActionUpdate, entries[1].Action)
+	assert.JSONEq(t, `{"action":{"before":"prefix","after":"drop"},"pattern":{"before":"","after":".*"},"value":{"before":"Grandma: ","after":""}}`, entries[1].Changes)
+	assert.Equal(t, models.AuditActionCreate, entries[2].Action)
+	for _, entry := range entries {
+		assert.Equal(t, editor.ID, entry.ActorID)
+		assert.Equal(t, &household.ID, entry.HouseholdID)
+	}
+}
+
+func TestHouseholdInviteChanges_RecordAuditLog(t *testing.T) {
+	household, owner, _, _ := setupHouseholdTestDB(t)
+	now := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+
+	invite, token, err := CreateHouseholdInvite(household.ID, owner.ID, models.HouseholdRoleEditor, now.Add(time.Hour), "req-invite")
+	require.NoError(t, err)
+	_, err = RevokeHouseholdInvite(invite.ID, household.ID, owner.ID, now, "req-revoke")
+	require.NoError(t, err)
+
+	audit := repositories.NewGormAuditLogRepository(db.DB)
+	entries, err := audit.List(repositories.AuditLogFilter{VisibleTo: owner.ID, EntityType: models.AuditEntityHouseholdInvite, EntityID: invite.ID})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, models.AuditActionUpdate, entries[0].Action)
+	assert.Equal(t, "req-revoke", entries[0].RequestID)
+	assert.JSONEq(t, `{"revoked_at":{"before":null,"after":"2025-01-06T09:00:00Z"}}`, entries[0].Changes)
+	assert.Equal(t, models.AuditActionCreate, entries[1].Action)
+	assert.Equal(t, &household.ID, entries[1].HouseholdID)
+	assert.JSONEq(t, `{"household_id":{"before":null,"after":`+fmt.Sprint(household.ID)+`},"role":{"before":null,"after":"editor"},"expires_at":{"before":null,"after":"2025-01-06T10:00:00Z"},"revoked_at":{"before":null,"after":null}}`, entries[1].Changes)
+	assert.NotContains(t, entries[1].Changes, token)
+	assert.NotContains(t, entries[1].Changes, invite.TokenHash)
+}
+
+func TestHouseholdChanges_RecordAuditLog(t *testing.T) {
+	household, owner, editor, viewer := setupHouseholdTestDB(t)
+	audit := repositories.NewGormAuditLogRepository(db.DB)
+
+	// Creating the household records it, its first owner and the members added afterwards
+	entries := auditLogEntries(t, audit, owner.ID)
+	require.Len(t, entries, 4)
+	assert.Equal(t, models.AuditEntityHousehold, entries[0].EntityType)
+	assert.Equal(t, household.ID, entries[0].EntityID)
+	for _, entry := range entries[1:] {
+		assert.Equal(t, models.AuditEntityHouseholdMember, entry.EntityType)
+		assert.Equal(t, models.AuditActionCreate, entry.Action)
+	}
+
+	member, err := UpdateHouseholdMemberRole(household.ID, owner.ID, viewer.ID, models.HouseholdRoleEditor, "req-role")
+	require.NoError(t, err)
+	require.NoError(t, RemoveHouseholdMember(household.ID, editor.ID, editor.ID, "req-leave"))
+
+	entries = auditLogEntries(t, audit, owner.ID)
+	require.Len(t, entries, 6)
+	assert.Equal(t, models.AuditActionUpdate, entries[4].Action)
+	assert.Equal(t, member.ID, entries[4].EntityID)
+	assert.JSONEq(t, `{"role":{"before":"viewer","after":"editor"}}`, entries[4].Changes)
+	assert.Equal(t, models.AuditActionDelete, entries[5].Action)
+	assert.Equal(t, editor.ID, entries[5].ActorID)
+	assert.Equal(t, "req-leave", entries[5].RequestID)
+
+	// Deleting the household records the muxes that stop being shared and the memberships that end
+	calendarMux, err := calendarMuxService().Create(owner.ID, "Family", "", true, &household.ID, "")
+	require.NoError(t, err)
+	require.NoError(t, DeleteHousehold(household.ID, owner.ID, "req-delete"))
+
+	var deletion []models.AuditLog
+	require.NoError(t, db.DB.Where("request_id = ?", "req-delete").Order("id").Find(&deletion).Error)
+	require.Len(t, deletion, 4)
+	assert.Equal(t, models.AuditEntityCalendarMux, deletion[0].EntityType)
+	assert.Equal(t, calendarMux.ID, deletion[0].EntityID)
+	assert.JSONEq(t, fmt.Sprintf(`{"household_id":{"before":%d,"after":null}}`, household.ID), deletion[0].Changes)
+	assert.Equal(t, models.AuditEntityHouseholdMember, deletion[1].EntityType)
+	assert.Equal(t, models.AuditEntityHouseholdMember, deletion[2].EntityType)
+	assert.Equal(t, models.AuditEntityHousehold, deletion[3].EntityType)
+	assert.Equal(t, models.AuditActionDelete, deletion[3].Action)
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrAuthorizationCodeInvalid is returned for unknown, expired and used authorization codes, and
+// when the PKCE verifier or redirect URI do not match
+var ErrAuthorizationCodeInvalid = errors.New("authorization code is invalid or expired")
+
+// CreateAuthorizationCode issues a one-time code for a user who signed in, bound to the PKCE
+// challenge and the callback URL it is sent to. The code is returned only here; the database
+// keeps its hash.
+func CreateAuthorizationCode(userID uint, codeChallenge, redirectURI string, expiresAt time.Time) (string, error) {
+	code, hash, err := models.NewHashedToken()
+	if err != nil {
+		return "", err
+	}
+
+	authorizationCode := &models.AuthorizationCode{
+		UserID:        userID,
+		CodeHash:      hash,
+		CodeChallenge: codeChallenge,
+		RedirectURI:   redirectURI,
+		ExpiresAt:     expiresAt,
+	}
+	if err := db.DB.Create(authorizationCode).Error; err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// RedeemAuthorizationCode uses up an authorization code and returns it. The code must be
+// presented with the PKCE verifier of its challenge and the redirect URI it was sent to. Any
+// attempt uses the code up, so a wrong verifier cannot be retried.
+func RedeemAuthorizationCode(code, codeVerifier, redirectURI string, now time.Time) (*models.AuthorizationCode, error) {
+	var authorizationCode models.AuthorizationCode
+	result := db.DB.Where("code_hash = ?", models.HashToken(code)).First(&authorizationCode)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrAuthorizationCodeInvalid
+		}
+		return nil, result.Error
+	}
+	if authorizationCode.UsedAt != nil || !now.Before(authorizationCode.ExpiresAt) {
+		return nil, ErrAuthorizationCodeInvalid
+	}
+
+	// Claim the code, so that of two concurrent exchanges only one succeeds
+	result = db.DB.Model(&authorizationCode).Where("used_at IS NULL").Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrAuthorizationCodeInvalid
+	}
+
+	sum := sha256.Sum256([]byte(codeVerifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(challenge), []byte(authorizationCode.CodeChallenge)) != 1 {
+		return nil, ErrAuthorizationCodeInvalid
+	}
+	if authorizationCode.RedirectURI != redirectURI {
+		return nil, ErrAuthorizationCodeInvalid
+	}
+	return &authorizationCode, nil
+}
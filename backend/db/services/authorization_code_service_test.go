@@ -0,0 +1,83 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testRedirectURI  = "http://localhost:3000/auth/callback"
+)
+
+func testCodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestRedeemAuthorizationCode(t *testing.T) {
+	setupTestDB(t)
+	user := createHouseholdUser(t, "owner")
+	now := time.Now()
+	code, err := CreateAuthorizationCode(user.ID, testCodeChallenge(testCodeVerifier), testRedirectURI, now.Add(time.Minute))
+	require.NoError(t, err)
+
+	redeemed, err := RedeemAuthorizationCode(code, testCodeVerifier, testRedirectURI, now)
+
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, redeemed.UserID)
+
+	// A code works once
+	_, err = RedeemAuthorizationCode(code, testCodeVerifier, testRedirectURI, now)
+	assert.ErrorIs(t, err, ErrAuthorizationCodeInvalid)
+}
+
+func TestRedeemAuthorizationCode_Invalid(t *testing.T) {
+	setupTestDB(t)
+	user := createHouseholdUser(t, "owner")
+	now := time.Now()
+	challenge := testCodeChallenge(testCodeVerifier)
+
+	tests := []struct {
+		name        string
+		verifier    string
+		redirectURI string
+		at          time.Time
+	}{
+		{"wrong verifier", "another-verifier-another-verifier-another-ve", testRedirectURI, now},
+		{"verifier sent as challenge", challenge, testRedirectURI, now},
+		{"wrong redirect URI", testCodeVerifier, "http://localhost:3001/callback", now},
+		{"expired", testCodeVerifier, testRedirectURI, now.Add(time.Minute)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := CreateAuthorizationCode(user.ID, challenge, testRedirectURI, now.Add(time.Minute))
+			require.NoError(t, err)
+
+			_, err = RedeemAuthorizationCode(code, tt.verifier, tt.redirectURI, tt.at)
+			assert.ErrorIs(t, err, ErrAuthorizationCodeInvalid)
+		})
+	}
+
+	_, err := RedeemAuthorizationCode("unknown", testCodeVerifier, testRedirectURI, now)
+	assert.ErrorIs(t, err, ErrAuthorizationCodeInvalid)
+}
+
+func TestRedeemAuthorizationCode_FailedAttemptUsesCode(t *testing.T) {
+	setupTestDB(t)
+	user := createHouseholdUser(t, "owner")
+	now := time.Now()
+	code, err := CreateAuthorizationCode(user.ID, testCodeChallenge(testCodeVerifier), testRedirectURI, now.Add(time.Minute))
+	require.NoError(t, err)
+
+	_, err = RedeemAuthorizationCode(code, "guessed-verifier", testRedirectURI, now)
+	assert.ErrorIs(t, err, ErrAuthorizationCodeInvalid)
+	_, err = RedeemAuthorizationCode(code, testCodeVerifier, testRedirectURI, now)
+	assert.ErrorIs(t, err, ErrAuthorizationCodeInvalid)
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+
+	"gorm.io/gorm"
+)
+
+// eventInsertBatchSize bounds the number of rows per INSERT when storing synced events
+const eventInsertBatchSize = 500
+
+// maxSyncErrorLength matches the size of CalendarSource.LastError
+const maxSyncErrorLength = 1000
+
+// GetCalendarSourcesDueForSync returns enabled sources of live calendar muxes that have not been synced since the cutoff
+func GetCalendarSourcesDueForSync(cutoff time.Time) ([]models.CalendarSource, error) {
+	var calendarSources []models.CalendarSource
+	result := db.DB.
+		Joins("JOIN calendar_muxes ON calendar_muxes.id = calendar_sources.calendar_mux_id AND calendar_muxes.deleted_at IS NULL").
+		Where("calendar_sources.enabled = ?", true).
+		Where("calendar_sources.last_sync_at IS NULL OR calendar_sources.last_sync_at < ?", cutoff).
+		Order("calendar_sources.id").
+		Find(&calendarSources)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return calendarSources, nil
+}
+
+// CalendarSourceSyncData is the content fetched from a calendar source during a sync
+type CalendarSourceSyncData struct {
+	Events []models.CalendarEvent
+	// Timezones holds the source's VTIMEZONE definitions as iCalendar text
+	Timezones string
+	// ETag and LastModified are the HTTP validators returned by the upstream server
+	ETag         string
+	LastModified string
+}
+
+// RecordCalendarSourceSyncSuccess replaces the stored events of a source and marks the sync as successful
+func RecordCalendarSourceSyncSuccess(sourceID uint, syncedAt time.Time, data CalendarSourceSyncData) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("calendar_source_id = ?", sourceID).Delete(&models.CalendarEvent{}).Error; err != nil {
+			return err
+		}
+
+		events := data.Events
+		for i := range events {
+			events[i].CalendarSourceID = sourceID
+		}
+		if len(events) > 0 {
+			if err := tx.CreateInBatches(events, eventInsertBatchSize).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&models.CalendarSource{}).Where("id = ?", sourceID).Updates(map[string]interface{}{
+			"last_sync_at":    syncedAt,
+			"last_success_at": syncedAt,
+			"last_error_at":   nil,
+			"last_error":      "",
+			"unchanged_since": syncedAt,
+			"timezones":       data.Timezones,
+			"etag":            data.ETag,
+			"last_modified":   data.LastModified,
+		}).Error
+	})
+}
+
+// RecordCalendarSourceNotModified marks a sync as successful when the upstream calendar
+// answered 304 Not Modified; stored events and UnchangedSince are kept as they are
+func RecordCalendarSourceNotModified(sourceID uint, syncedAt time.Time, etag, lastModified string) error {
+	return db.DB.Model(&models.CalendarSource{}).Where("id = ?", sourceID).Updates(map[string]interface{}{
+		"last_sync_at":    syncedAt,
+		"last_success_at": syncedAt,
+		"last_error_at":   nil,
+		"last_error":      "",
+		"etag":            etag,
+		"last_modified":   lastModified,
+	}).Error
+}
+
+// RecordCalendarSourceSyncFailure records a failed sync, keeping the previously stored events
+func RecordCalendarSourceSyncFailure(sourceID uint, syncedAt time.Time, message string) error {
+	if len(message) > maxSyncErrorLength {
+		message = strings.ToValidUTF8(message[:maxSyncErrorLength], "")
+	}
+	return db.DB.Model(&models.CalendarSource{}).Where("id = ?", sourceID).Updates(map[string]interface{}{
+		"last_sync_at":  syncedAt,
+		"last_error_at": syncedAt,
+		"last_error":    message,
+	}).Error
+}
+
+// GetCalendarEventsBySources returns the stored events of the given sources
+func GetCalendarEventsBySources(sourceIDs []uint) ([]models.CalendarEvent, error) {
+	var events []models.CalendarEvent
+	if len(sourceIDs) == 0 {
+		return events, nil
+	}
+	result := db.DB.Where("calendar_source_id IN ?", sourceIDs).Order("calendar_source_id, id").Find(&events)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return events, nil
+}
+
+// CountCalendarEventsBySources returns the number of stored events of each of the given sources.
+// Sources without events are absent from the result.
+func CountCalendarEventsBySources(sourceIDs []uint) (map[uint]int64, error) {
+	counts := make(map[uint]int64, len(sourceIDs))
+	if len(sourceIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		CalendarSourceID uint
+		Count            int64
+	}
+	result := db.DB.Model(&models.CalendarEvent{}).
+		Select("calendar_source_id, COUNT(*) AS count").
+		Where("calendar_source_id IN ?", sourceIDs).
+		Group("calendar_source_id").
+		Scan(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	for _, row := range rows {
+		counts[row.CalendarSourceID] = row.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCalendarSourcesDueForSync(t *testing.T) {
+	_, calendarMux := setupCalendarSourceTestDB(t)
+
+	now := time.Now()
+	recent := now.Add(-time.Minute)
+	stale := now.Add(-time.Hour)
+
+	neverSynced := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/a.ics", Label: "Never", Enabled: true}
+	db.DB.Create(neverSynced)
+	staleSource := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/b.ics", Label: "Stale", Enabled: true, LastSyncAt: &stale}
+	db.DB.Create(staleSource)
+	db.DB.Create(&models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/c.ics", Label: "Recent", Enabled: true, LastSyncAt: &recent})
+
+	calendarSources, err := GetCalendarSourcesDueForSync(now.Add(-15 * time.Minute))
+
+	assert.NoError(t, err)
+	assert.Len(t, calendarSources, 2)
+	assert.Equal(t, neverSynced.ID, calendarSources[0].ID)
+	assert.Equal(t, staleSource.ID, calendarSources[1].ID)
+	assert.Equal(t, "https://example.com/a.ics", calendarSources[0].URL)
+}
+
+func TestRecordCalendarSourceSyncSuccess_ReplacesEvents(t *testing.T) {
+	_, calendarMux := setupCalendarSourceTestDB(t)
+
+	source := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/a.ics", Label: "A", Enabled: true}
+	db.DB.Create(source)
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: source.ID, UID: "old", Data: "old"})
+
+	syncedAt := time.Now()
+	err := RecordCalendarSourceSyncSuccess(source.ID, syncedAt, CalendarSourceSyncData{
+		Events: []models.CalendarEvent{
+			{UID: "new-1", Data: "one"},
+			{UID: "new-2", Data: "two"},
+		},
+		Timezones:    "timezones",
+		ETag:         `"v1"`,
+		LastModified: "Wed, 01 Jan 2025 10:00:00 GMT",
+	})
+	assert.NoError(t, err)
+
+	events, err := GetCalendarEventsBySources([]uint{source.ID})
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "new-1", events[0].UID)
+	assert.Equal(t, source.ID, events[0].CalendarSourceID)
+
+	var synced models.CalendarSource
+	db.DB.First(&synced, source.ID)
+	assert.NotNil(t, synced.LastSuccessAt)
+	assert.Equal(t, "timezones", synced.Timezones)
+	assert.Equal(t, `"v1"`, synced.ETag)
+	assert.Equal(t, "Wed, 01 Jan 2025 10:00:00 GMT", synced.LastModified)
+	assert.NotNil(t, synced.UnchangedSince)
+}
+
+func TestRecordCalendarSourceSyncSuccess_NoEvents(t *testing.T) {
+	_, calendarMux := setupCalendarSourceTestDB(t)
+
+	source := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/a.ics", Label: "A", Enabled: true}
+	db.DB.Create(source)
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: source.ID, UID: "old", Data: "old"})
+
+	assert.NoError(t, RecordCalendarSourceSyncSuccess(source.ID, time.Now(), CalendarSourceSyncData{}))
+
+	events, err := GetCalendarEventsBySources([]uint{source.ID})
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestRecordCalendarSourceSyncFailure_TruncatesMessage(t *testing.T) {
+	_, calendarMux := setupCalendarSourceTestDB(t)
+
+	source := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/a.ics", Label: "A", Enabled: true}
+	db.DB.Create(source)
+
+	err := RecordCalendarSourceSyncFailure(source.ID, time.Now(), strings.Repeat("é", 600))
+	assert.NoError(t, err)
+
+	var synced models.CalendarSource
+	db.DB.First(&synced, source.ID)
+	assert.NotNil(t, synced.LastErrorAt)
+	assert.Equal(t, strings.Repeat("é", 500), synced.LastError)
+}
+
+func TestGetCalendarEventsBySources_NoSources(t *testing.T) {
+	events, err := GetCalendarEventsBySources(nil)
+
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestRecordCalendarSourceNotModified_KeepsEvents(t *testing.T) {
+	_, calendarMux := setupCalendarSourceTestDB(t)
+
+	changedAt := time.Now().Add(-24 * time.Hour)
+	failedAt := time.Now().Add(-time.Hour)
+	source := &models.CalendarSource{
+		CalendarMuxID:  calendarMux.ID,
+		URL:            "https://example.com/a.ics",
+		Label:          "A",
+		Enabled:        true,
+		UnchangedSince: &changedAt,
+		LastErrorAt:    &failedAt,
+		LastError:      "timeout",
+		ETag:           `"v1"`,
+	}
+	db.DB.Create(source)
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: source.ID, UID: "kept", Data: "kept"})
+
+	err := RecordCalendarSourceNotModified(source.ID, time.Now(), `"v2"`, "")
+	assert.NoError(t, err)
+
+	var synced models.CalendarSource
+	db.DB.First(&synced, source.ID)
+	assert.NotNil(t, synced.LastSuccessAt)
+	assert.Nil(t, synced.LastErrorAt)
+	assert.Equal(t, "", synced.LastError)
+	assert.Equal(t, `"v2"`, synced.ETag)
+	assert.WithinDuration(t, changedAt, *synced.UnchangedSince, time.Second)
+
+	events, err := GetCalendarEventsBySources([]uint{source.ID})
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func TestCountCalendarEventsBySources(t *testing.T) {
+	_, calendarMux := setupCalendarSourceTestDB(t)
+
+	busy := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/a.ics", Label: "A", Enabled: true}
+	db.DB.Create(busy)
+	empty := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/b.ics", Label: "B", Enabled: true}
+	db.DB.Create(empty)
+	for _, uid := range []string{"1", "2", "3"} {
+		db.DB.Create(&models.CalendarEvent{CalendarSourceID: busy.ID, UID: uid, Data: uid})
+	}
+
+	counts, err := CountCalendarEventsBySources([]uint{busy.ID, empty.ID})
+	assert.NoError(t, err)
+	assert.Equal(t, map[uint]int64{busy.ID: 3}, counts)
+
+	counts, err = CountCalendarEventsBySources(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, counts)
+}
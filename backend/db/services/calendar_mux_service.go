@@ -2,47 +2,299 @@ package services
 
 import (
 	"errors"
-	"family-calendar-backend/db"
+	"time"
+
 	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/repositories"
 )
 
-// CreateCalendarMux creates a new calendar mux for a user
-func CreateCalendarMux(userID uint, name, description string) (*models.CalendarMux, error) {
-	calendarMux := &models.CalendarMux{
-		CreatedByID: userID,
-		Name:        name,
-		Description: description,
+// ErrCalendarMuxNotFound is returned when a calendar mux does not exist or the user has no access to it
+var ErrCalendarMuxNotFound = errors.New("calendar mux not found or access denied")
+
+// ErrCalendarMuxModified is returned when a calendar mux no longer is the version an update was based on
+var ErrCalendarMuxModified = errors.New("calendar mux has been modified")
+
+// CalendarMuxUpdate is a partial update of a calendar mux; nil fields are left unchanged
+type CalendarMuxUpdate struct {
+	Name         *string
+	Description  *string
+	DedupEnabled *bool
+	// HouseholdID moves the mux into a household, or out of its household when 0
+	HouseholdID *uint
+}
+
+// CalendarMuxService manages calendar muxes, their sources and rewrite rules on behalf of users,
+// enforcing their household roles and recording their changes in the audit log
+type CalendarMuxService struct {
+	muxes repositories.CalendarMuxRepository
+}
+
+// NewCalendarMuxService returns a CalendarMuxService storing calendar muxes in the given
+// repository, which records their changes in its audit log. Sources, rewrite rules and events
+// are read and written through db.DB whatever the repository.
+func NewCalendarMuxService(muxes repositories.CalendarMuxRepository) *CalendarMuxService {
+	return &CalendarMuxService{muxes: muxes}
+}
+
+// recordCalendarMuxChange records a change of a calendar mux by the user in the audit log. The
+// entry belongs to the household the mux was in before the change, or else the one it is in after it.
+func recordCalendarMuxChange(audit repositories.AuditLogRepository, userID uint, action string, before, after *models.CalendarMux, requestID string) error {
+	var beforeFields, afterFields auditFields
+	var householdID *uint
+	id := uint(0)
+	if after != nil {
+		afterFields = calendarMuxAuditFields(after)
+		householdID = after.HouseholdID
+		id = after.ID
+	}
+	if before != nil {
+		beforeFields = calendarMuxAuditFields(before)
+		if before.HouseholdID != nil {
+			householdID = before.HouseholdID
+		}
+		id = before.ID
+	}
+	return appendAuditLog(audit, userID, action, models.AuditEntityCalendarMux, id, householdID, beforeFields, afterFields, requestID)
+}
+
+// authorize loads a calendar mux on which the user has at least the given household role.
+// The creator of a mux outside any household has every right on it. A household mux is authorized by
+// household membership alone, so a creator who left the household or was demoted loses their rights. Users who cannot see the mux get ErrCalendarMuxNotFound, so that the existence of
+// other users' muxes is not revealed, and users who can see it without the role ErrInsufficientRole.
+func (s *CalendarMuxService) authorize(id, userID uint, minimum string) (*models.CalendarMux, error) {
+	calendarMux, err := s.muxes.Get(id)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrCalendarMuxNotFound
+		}
+		return nil, err
+	}
+	return s.checkRole(calendarMux, userID, minimum)
+}
+
+// checkRole returns a loaded calendar mux if the user has at least the given role on it; see authorize
+func (s *CalendarMuxService) checkRole(calendarMux *models.CalendarMux, userID uint, minimum string) (*models.CalendarMux, error) {
+	if calendarMux.HouseholdID == nil {
+		if calendarMux.CreatedByID == userID {
+			return calendarMux, nil
+		}
+		return nil, ErrCalendarMuxNotFound
+	}
+
+	role, err := s.muxes.HouseholdRole(*calendarMux.HouseholdID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, ErrCalendarMuxNotFound
+	}
+	if !roleAtLeast(role, minimum) {
+		return nil, ErrInsufficientRole
+	}
+	return calendarMux, nil
+}
+
+// authorizeHousehold checks that the user may share calendar muxes with a household, which takes
+// at least an editor. Deleting a household removes its members, so only existing households pass.
+func (s *CalendarMuxService) authorizeHousehold(householdID, userID uint) error {
+	role, err := s.muxes.HouseholdRole(householdID, userID)
+	if err != nil {
+		return err
+	}
+	if role == "" {
+		return ErrHouseholdNotFound
+	}
+	if !roleAtLeast(role, models.HouseholdRoleEditor) {
+		return ErrInsufficientRole
+	}
+	return nil
+}
+
+// Create creates a new calendar mux for a user, shared with a household when householdID is set.
+// Sharing requires the user to be at least an editor of that household.
+func (s *CalendarMuxService) Create(userID uint, name, description string, dedupEnabled bool, householdID *uint, requestID string) (*models.CalendarMux, error) {
+	if householdID != nil {
+		if err := s.authorizeHousehold(*householdID, userID); err != nil {
+			return nil, err
+		}
 	}
 
-	result := db.DB.Create(calendarMux)
-	if result.Error != nil {
-		return nil, result.Error
+	calendarMux := &models.CalendarMux{
+		CreatedByID:   userID,
+		HouseholdID:   householdID,
+		Name:          name,
+		Description:   description,
+		DedupDisabled: !dedupEnabled,
+	}
+	err := s.muxes.Transaction(func(muxes repositories.CalendarMuxRepository, audit repositories.AuditLogRepository) error {
+		if err := muxes.Create(calendarMux); err != nil {
+			return err
+		}
+		return recordCalendarMuxChange(audit, userID, models.AuditActionCreate, nil, calendarMux, requestID)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return calendarMux, nil
 }
 
-// GetCalendarMuxesByUser returns all calendar muxes created by a specific user
-func GetCalendarMuxesByUser(userID uint) ([]models.CalendarMux, error) {
-	var calendarMuxes []models.CalendarMux
-	result := db.DB.Where("created_by_id = ?", userID).Find(&calendarMuxes)
-	if result.Error != nil {
-		return nil, result.Error
+// Get returns a calendar mux the user may see
+func (s *CalendarMuxService) Get(id, userID uint) (*models.CalendarMux, error) {
+	return s.authorize(id, userID, models.HouseholdRoleViewer)
+}
+
+// Update applies a partial update to a calendar mux the user may edit. Moving it between
+// households takes an owner of the mux who is at least an editor of the household it moves into.
+// When matches is set, the update only happens if it accepts the UpdatedAt of the stored mux, and only
+// if no other update lands in between; otherwise ErrCalendarMuxModified is returned.
+func (s *CalendarMuxService) Update(id, userID uint, update CalendarMuxUpdate, matches func(updatedAt time.Time) bool, requestID string) (*models.CalendarMux, error) {
+	minimum := models.HouseholdRoleEditor
+	if update.HouseholdID != nil {
+		minimum = models.HouseholdRoleOwner
+	}
+	calendarMux, err := s.authorize(id, userID, minimum)
+	if err != nil {
+		return nil, err
+	}
+	if matches != nil && !matches(calendarMux.UpdatedAt) {
+		return nil, ErrCalendarMuxModified
+	}
+
+	changes := repositories.CalendarMuxChanges{
+		Name:        update.Name,
+		Description: update.Description,
+		HouseholdID: update.HouseholdID,
+	}
+	if update.DedupEnabled != nil {
+		dedupDisabled := !*update.DedupEnabled
+		changes.DedupDisabled = &dedupDisabled
+	}
+	if update.HouseholdID != nil && *update.HouseholdID != 0 {
+		if err := s.authorizeHousehold(*update.HouseholdID, userID); err != nil {
+			return nil, err
+		}
+	}
+	if changes == (repositories.CalendarMuxChanges{}) {
+		return calendarMux, nil
+	}
+
+	var updated *models.CalendarMux
+	err = s.muxes.Transaction(func(muxes repositories.CalendarMuxRepository, audit repositories.AuditLogRepository) error {
+		if err := muxes.Update(calendarMux.ID, calendarMux.UpdatedAt, changes); err != nil {
+			return err
+		}
+		var err error
+		updated, err = muxes.Get(id)
+		if err != nil {
+			return err
+		}
+		return recordCalendarMuxChange(audit, userID, models.AuditActionUpdate, calendarMux, updated, requestID)
+	})
+	if err != nil {
+		if errors.Is(err, repositories.ErrModified) {
+			return nil, ErrCalendarMuxModified
+		}
+		return nil, err
+	}
+	return updated, nil
+}
+
+// List returns the calendar muxes a user created or shares through a household
+func (s *CalendarMuxService) List(userID uint) ([]models.CalendarMux, error) {
+	return s.muxes.ListByUser(userID)
+}
+
+// Delete deletes a calendar mux the user created or owns through its household
+func (s *CalendarMuxService) Delete(id, userID uint, requestID string) error {
+	calendarMux, err := s.authorize(id, userID, models.HouseholdRoleOwner)
+	if err != nil {
+		return err
 	}
 
-	return calendarMuxes, nil
+	err = s.muxes.Transaction(func(muxes repositories.CalendarMuxRepository, audit repositories.AuditLogRepository) error {
+		if err := muxes.Delete(calendarMux.ID); err != nil {
+			return err
+		}
+		return recordCalendarMuxChange(audit, userID, models.AuditActionDelete, calendarMux, nil, requestID)
+	})
+	if errors.Is(err, repositories.ErrNotFound) {
+		return ErrCalendarMuxNotFound
+	}
+	return err
+}
+
+// ListDeleted returns the calendar muxes in the trash that the user created or shares through a household
+func (s *CalendarMuxService) ListDeleted(userID uint) ([]models.CalendarMux, error) {
+	return s.muxes.ListDeletedByUser(userID)
 }
 
-// DeleteCalendarMux deletes a calendar mux if it belongs to the specified user
-func DeleteCalendarMux(id, userID uint) error {
-	result := db.DB.Where("id = ? AND created_by_id = ?", id, userID).Delete(&models.CalendarMux{})
-	if result.Error != nil {
-		return result.Error
+// Restore takes a calendar mux out of the trash, which takes the same role as deleting it
+func (s *CalendarMuxService) Restore(id, userID uint, requestID string) (*models.CalendarMux, error) {
+	calendarMux, err := s.muxes.GetDeleted(id)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrCalendarMuxNotFound
+		}
+		return nil, err
+	}
+	if _, err := s.checkRole(calendarMux, userID, models.HouseholdRoleOwner); err != nil {
+		return nil, err
 	}
 
-	if result.RowsAffected == 0 {
-		return errors.New("calendar mux not found or access denied")
+	var restored *models.CalendarMux
+	err = s.muxes.Transaction(func(muxes repositories.CalendarMuxRepository, audit repositories.AuditLogRepository) error {
+		if err := muxes.Restore(id); err != nil {
+			return err
+		}
+		var err error
+		restored, err = muxes.Get(id)
+		if err != nil {
+			return err
+		}
+		return recordCalendarMuxChange(audit, userID, models.AuditActionRestore, nil, restored, requestID)
+	})
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrCalendarMuxNotFound
+		}
+		return nil, err
 	}
+	return restored, nil
+}
 
-	return nil
+// Purge permanently deletes the calendar muxes moved to the trash before the given time, and
+// records each deletion in the audit log as made by the server. It returns how many it deleted.
+func (s *CalendarMuxService) Purge(deletedBefore time.Time) (int, error) {
+	var purged []models.CalendarMux
+	err := s.muxes.Transaction(func(muxes repositories.CalendarMuxRepository, audit repositories.AuditLogRepository) error {
+		var err error
+		purged, err = muxes.Purge(deletedBefore)
+		if err != nil {
+			return err
+		}
+		for i := range purged {
+			err := recordCalendarMuxChange(audit, models.AuditActorServer, models.AuditActionPurge, &purged[i], nil, "")
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(purged), nil
+}
+
+// GetByFeedToken returns the calendar mux published under the given feed token
+func (s *CalendarMuxService) GetByFeedToken(token string) (*models.CalendarMux, error) {
+	calendarMux, err := s.muxes.GetByFeedToken(token)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrCalendarMuxNotFound
+		}
+		return nil, err
+	}
+	return calendarMux, nil
 }
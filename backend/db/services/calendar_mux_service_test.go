@@ -4,12 +4,15 @@ import (
 	"errors"
 	"regexp"
 	"testing"
+	"time"
 
 	"family-calendar-backend/db"
 	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/repositories"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -20,25 +23,28 @@ func setupTestDB(t *testing.T) {
 	db.DB, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	assert.NoError(t, err)
 
-	err = db.DB.AutoMigrate(&models.User{}, &models.CalendarMux{})
+	err = db.DB.AutoMigrate(&models.User{}, &models.Household{}, &models.HouseholdMember{}, &models.HouseholdInvite{}, &models.CalendarMux{}, &models.CalendarSource{}, &models.CalendarEvent{}, &models.RewriteRule{}, &models.Session{}, &models.RefreshToken{}, &models.UserIdentity{}, &models.IdentityLink{}, &models.PersonalAccessToken{}, &models.AuthorizationCode{}, &models.AuditLog{})
 	assert.NoError(t, err)
 }
 
+// calendarMuxService returns a CalendarMuxService over the test database
+func calendarMuxService() *CalendarMuxService {
+	return NewCalendarMuxService(repositories.NewGormCalendarMuxRepository(db.DB))
+}
+
 func TestCreateCalendarMux(t *testing.T) {
 	setupTestDB(t)
 
 	// Create a test user first
 	user := models.User{
-		GivenName:      "Test",
-		FamilyName:     "User",
-		Email:          "test@example.com",
-		AuthProvider:   "google",
-		AuthProviderID: "test-123",
+		GivenName:  "Test",
+		FamilyName: "User",
+		Email:      "test@example.com",
 	}
 	db.DB.Create(&user)
 
 	// Test creating a calendar mux
-	calendarMux, err := CreateCalendarMux(user.ID, "Test Calendar", "Test Description")
+	calendarMux, err := calendarMuxService().Create(user.ID, "Test Calendar", "Test Description", true, nil, "")
 
 	assert.NoError(t, err)
 	assert.NotNil(t, calendarMux)
@@ -53,20 +59,16 @@ func TestGetCalendarMuxesByUser(t *testing.T) {
 
 	// Create test users
 	user1 := models.User{
-		GivenName:      "User",
-		FamilyName:     "One",
-		Email:          "user1@example.com",
-		AuthProvider:   "google",
-		AuthProviderID: "user1-123",
+		GivenName:  "User",
+		FamilyName: "One",
+		Email:      "user1@example.com",
 	}
 	db.DB.Create(&user1)
 
 	user2 := models.User{
-		GivenName:      "User",
-		FamilyName:     "Two",
-		Email:          "user2@example.com",
-		AuthProvider:   "google",
-		AuthProviderID: "user2-123",
+		GivenName:  "User",
+		FamilyName: "Two",
+		Email:      "user2@example.com",
 	}
 	db.DB.Create(&user2)
 
@@ -90,7 +92,7 @@ func TestGetCalendarMuxesByUser(t *testing.T) {
 	})
 
 	// Test getting calendar muxes for user1
-	calendarMuxes, err := GetCalendarMuxesByUser(user1.ID)
+	calendarMuxes, err := calendarMuxService().List(user1.ID)
 
 	assert.NoError(t, err)
 	assert.Len(t, calendarMuxes, 2)
@@ -98,7 +100,7 @@ func TestGetCalendarMuxesByUser(t *testing.T) {
 	assert.Equal(t, "User 1 Calendar 2", calendarMuxes[1].Name)
 
 	// Test getting calendar muxes for user2
-	calendarMuxes, err = GetCalendarMuxesByUser(user2.ID)
+	calendarMuxes, err = calendarMuxService().List(user2.ID)
 
 	assert.NoError(t, err)
 	assert.Len(t, calendarMuxes, 1)
@@ -110,16 +112,14 @@ func TestGetCalendarMuxesByUser_EmptyList(t *testing.T) {
 
 	// Create a user with no calendar muxes
 	user := models.User{
-		GivenName:      "Test",
-		FamilyName:     "User",
-		Email:          "test@example.com",
-		AuthProvider:   "google",
-		AuthProviderID: "test-123",
+		GivenName:  "Test",
+		FamilyName: "User",
+		Email:      "test@example.com",
 	}
 	db.DB.Create(&user)
 
 	// Test getting calendar muxes
-	calendarMuxes, err := GetCalendarMuxesByUser(user.ID)
+	calendarMuxes, err := calendarMuxService().List(user.ID)
 
 	assert.NoError(t, err)
 	assert.Len(t, calendarMuxes, 0)
@@ -130,11 +130,9 @@ func TestDeleteCalendarMux_Success(t *testing.T) {
 
 	// Create a test user
 	user := models.User{
-		GivenName:      "Test",
-		FamilyName:     "User",
-		Email:          "test@example.com",
-		AuthProvider:   "google",
-		AuthProviderID: "test-123",
+		GivenName:  "Test",
+		FamilyName: "User",
+		Email:      "test@example.com",
 	}
 	db.DB.Create(&user)
 
@@ -147,7 +145,7 @@ func TestDeleteCalendarMux_Success(t *testing.T) {
 	db.DB.Create(&calendarMux)
 
 	// Test deleting the calendar mux
-	err := DeleteCalendarMux(calendarMux.ID, user.ID)
+	err := calendarMuxService().Delete(calendarMux.ID, user.ID, "")
 
 	assert.NoError(t, err)
 
@@ -162,20 +160,16 @@ func TestDeleteCalendarMux_WrongUser(t *testing.T) {
 
 	// Create two users
 	user1 := models.User{
-		GivenName:      "User",
-		FamilyName:     "One",
-		Email:          "user1@example.com",
-		AuthProvider:   "google",
-		AuthProviderID: "user1-123",
+		GivenName:  "User",
+		FamilyName: "One",
+		Email:      "user1@example.com",
 	}
 	db.DB.Create(&user1)
 
 	user2 := models.User{
-		GivenName:      "User",
-		FamilyName:     "Two",
-		Email:          "user2@example.com",
-		AuthProvider:   "google",
-		AuthProviderID: "user2-123",
+		GivenName:  "User",
+		FamilyName: "Two",
+		Email:      "user2@example.com",
 	}
 	db.DB.Create(&user2)
 
@@ -188,7 +182,7 @@ func TestDeleteCalendarMux_WrongUser(t *testing.T) {
 	db.DB.Create(&calendarMux)
 
 	// Try to delete with user2 (should fail)
-	err := DeleteCalendarMux(calendarMux.ID, user2.ID)
+	err := calendarMuxService().Delete(calendarMux.ID, user2.ID, "")
 
 	assert.Error(t, err)
 
@@ -203,16 +197,14 @@ func TestDeleteCalendarMux_NotFound(t *testing.T) {
 
 	// Create a test user
 	user := models.User{
-		GivenName:      "Test",
-		FamilyName:     "User",
-		Email:          "test@example.com",
-		AuthProvider:   "google",
-		AuthProviderID: "test-123",
+		GivenName:  "Test",
+		FamilyName: "User",
+		Email:      "test@example.com",
 	}
 	db.DB.Create(&user)
 
 	// Try to delete a non-existent calendar mux
-	err := DeleteCalendarMux(9999, user.ID)
+	err := calendarMuxService().Delete(9999, user.ID, "")
 
 	assert.Error(t, err)
 }
@@ -229,11 +221,6 @@ func TestCreateCalendarMux_DatabaseError(t *testing.T) {
 	}), &gorm.Config{})
 	assert.NoError(t, err)
 
-	// Set up the global DB
-	originalDB := db.DB
-	db.DB = gormDB
-	defer func() { db.DB = originalDB }()
-
 	// Expect the INSERT to fail
 	mock.ExpectBegin()
 	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "calendar_muxes"`)).
@@ -241,7 +228,7 @@ func TestCreateCalendarMux_DatabaseError(t *testing.T) {
 	mock.ExpectRollback()
 
 	// Test creating a calendar mux
-	_, err = CreateCalendarMux(1, "Test", "Description")
+	_, err = NewCalendarMuxService(repositories.NewGormCalendarMuxRepository(gormDB)).Create(1, "Test", "Description", true, nil, "")
 
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "database error")
@@ -258,17 +245,12 @@ func TestGetCalendarMuxesByUser_DatabaseError(t *testing.T) {
 	}), &gorm.Config{})
 	assert.NoError(t, err)
 
-	// Set up the global DB
-	originalDB := db.DB
-	db.DB = gormDB
-	defer func() { db.DB = originalDB }()
-
 	// Expect the SELECT to fail
 	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "calendar_muxes"`)).
 		WillReturnError(errors.New("database error"))
 
 	// Test getting calendar muxes
-	_, err = GetCalendarMuxesByUser(1)
+	_, err = NewCalendarMuxService(repositories.NewGormCalendarMuxRepository(gormDB)).List(1)
 
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "database error")
@@ -285,20 +267,261 @@ func TestDeleteCalendarMux_DatabaseError(t *testing.T) {
 	}), &gorm.Config{})
 	assert.NoError(t, err)
 
-	// Set up the global DB
-	originalDB := db.DB
-	db.DB = gormDB
-	defer func() { db.DB = originalDB }()
-
-	// Expect the DELETE to fail
+	// Expect the lookup to find the mux and moving it to the trash to fail
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "calendar_muxes"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_by_id"}).AddRow(1, 1))
 	mock.ExpectBegin()
-	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "calendar_muxes"`)).
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "calendar_muxes" SET "deleted_at"`)).
 		WillReturnError(errors.New("database error"))
 	mock.ExpectRollback()
 
 	// Test deleting a calendar mux
-	err = DeleteCalendarMux(1, 1)
+	err = NewCalendarMuxService(repositories.NewGormCalendarMuxRepository(gormDB)).Delete(1, 1, "")
 
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "database error")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateCalendarMux_AssignsUniqueFeedTokens(t *testing.T) {
+	setupTestDB(t)
+
+	first, err := calendarMuxService().Create(1, "First", "", true, nil, "")
+	assert.NoError(t, err)
+	second, err := calendarMuxService().Create(1, "Second", "", true, nil, "")
+	assert.NoError(t, err)
+
+	assert.Len(t, first.FeedToken, 64)
+	assert.NotEqual(t, first.FeedToken, second.FeedToken)
+}
+
+func TestGetCalendarMuxByFeedToken(t *testing.T) {
+	setupTestDB(t)
+
+	calendarMux, err := calendarMuxService().Create(1, "Family", "", true, nil, "")
+	assert.NoError(t, err)
+
+	found, err := calendarMuxService().GetByFeedToken(calendarMux.FeedToken)
+	assert.NoError(t, err)
+	assert.Equal(t, calendarMux.ID, found.ID)
+
+	_, err = calendarMuxService().GetByFeedToken("does-not-exist")
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+
+	_, err = calendarMuxService().GetByFeedToken("")
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+}
+
+func TestCreateCalendarMux_DedupSetting(t *testing.T) {
+	setupTestDB(t)
+
+	enabled, err := calendarMuxService().Create(1, "Enabled", "", true, nil, "")
+	assert.NoError(t, err)
+	disabled, err := calendarMuxService().Create(1, "Disabled", "", false, nil, "")
+	assert.NoError(t, err)
+
+	var storedEnabled, storedDisabled models.CalendarMux
+	db.DB.First(&storedEnabled, enabled.ID)
+	db.DB.First(&storedDisabled, disabled.ID)
+	assert.False(t, storedEnabled.DedupDisabled)
+	assert.True(t, storedDisabled.DedupDisabled)
+}
+
+func TestGetCalendarMux(t *testing.T) {
+	setupTestDB(t)
+
+	calendarMux, err := calendarMuxService().Create(1, "Family", "", true, nil, "")
+	assert.NoError(t, err)
+
+	found, err := calendarMuxService().Get(calendarMux.ID, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "Family", found.Name)
+
+	_, err = calendarMuxService().Get(calendarMux.ID, 2)
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+
+	_, err = calendarMuxService().Get(9999, 1)
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+}
+
+func TestUpdateCalendarMux(t *testing.T) {
+	setupTestDB(t)
+
+	calendarMux, err := calendarMuxService().Create(1, "Family", "Everyone", true, nil, "")
+	assert.NoError(t, err)
+
+	name := "Household"
+	dedupEnabled := false
+	updated, err := calendarMuxService().Update(calendarMux.ID, 1, CalendarMuxUpdate{Name: &name, DedupEnabled: &dedupEnabled}, nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "Household", updated.Name)
+	assert.Equal(t, "Everyone", updated.Description)
+	assert.True(t, updated.DedupDisabled)
+	assert.False(t, updated.UpdatedAt.Before(calendarMux.UpdatedAt))
+
+	// Fields can be cleared
+	description := ""
+	updated, err = calendarMuxService().Update(calendarMux.ID, 1, CalendarMuxUpdate{Description: &description}, nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "", updated.Description)
+	assert.Equal(t, "Household", updated.Name)
+}
+
+func TestUpdateCalendarMux_Errors(t *testing.T) {
+	setupTestDB(t)
+
+	calendarMux, err := calendarMuxService().Create(1, "Family", "", true, nil, "")
+	assert.NoError(t, err)
+	name := "Household"
+
+	_, err = calendarMuxService().Update(calendarMux.ID, 2, CalendarMuxUpdate{Name: &name}, nil, "")
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+
+	_, err = calendarMuxService().Update(9999, 1, CalendarMuxUpdate{Name: &name}, nil, "")
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+
+	var seen time.Time
+	_, err = calendarMuxService().Update(calendarMux.ID, 1, CalendarMuxUpdate{Name: &name}, func(updatedAt time.Time) bool {
+		seen = updatedAt
+		return false
+	}, "")
+	assert.ErrorIs(t, err, ErrCalendarMuxModified)
+	assert.True(t, seen.Equal(calendarMux.UpdatedAt))
+
+	var found models.CalendarMux
+	db.DB.First(&found, calendarMux.ID)
+	assert.Equal(t, "Family", found.Name)
+}
+
+func TestUpdateCalendarMux_ConcurrentUpdate(t *testing.T) {
+	setupTestDB(t)
+
+	calendarMux, err := calendarMuxService().Create(1, "Family", "", true, nil, "")
+	assert.NoError(t, err)
+
+	// Another update lands after the precondition was checked against the version it read
+	other := "Other"
+	name := "Household"
+	_, err = calendarMuxService().Update(calendarMux.ID, 1, CalendarMuxUpdate{Name: &name}, func(updatedAt time.Time) bool {
+		db.DB.Model(&models.CalendarMux{}).Where("id = ?", calendarMux.ID).Updates(map[string]interface{}{
+			"name":       other,
+			"updated_at": updatedAt.Add(time.Second),
+		})
+		return true
+	}, "")
+	assert.ErrorIs(t, err, ErrCalendarMuxModified)
+
+	var found models.CalendarMux
+	db.DB.First(&found, calendarMux.ID)
+	assert.Equal(t, "Other", found.Name)
+}
+
+func TestUpdateCalendarMux_NoChanges(t *testing.T) {
+	setupTestDB(t)
+
+	calendarMux, err := calendarMuxService().Create(1, "Family", "", true, nil, "")
+	assert.NoError(t, err)
+
+	updated, err := calendarMuxService().Update(calendarMux.ID, 1, CalendarMuxUpdate{}, nil, "")
+	assert.NoError(t, err)
+	assert.True(t, updated.UpdatedAt.Equal(calendarMux.UpdatedAt))
+}
+
+func TestCalendarMuxService_HouseholdRoles(t *testing.T) {
+	t.Parallel()
+	muxes := repositories.NewMemoryCalendarMuxRepository()
+	service := NewCalendarMuxService(muxes)
+	householdID := uint(7)
+	muxes.AddHouseholdMember(householdID, 1, models.HouseholdRoleOwner)
+	muxes.AddHouseholdMember(householdID, 2, models.HouseholdRoleEditor)
+	muxes.AddHouseholdMember(householdID, 3, models.HouseholdRoleViewer)
+
+	// Sharing takes an editor of the household
+	_, err := service.Create(3, "Mine", "", true, &householdID, "")
+	assert.ErrorIs(t, err, ErrInsufficientRole)
+	_, err = service.Create(4, "Mine", "", true, &householdID, "")
+	assert.ErrorIs(t, err, ErrHouseholdNotFound)
+	calendarMux, err := service.Create(2, "Family", "", true, &householdID, "")
+	require.NoError(t, err)
+
+	// Members see the mux according to their role, outsiders do not
+	_, err = service.Get(calendarMux.ID, 3)
+	assert.NoError(t, err)
+	_, err = service.Get(calendarMux.ID, 4)
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+	name := "Household"
+	_, err = service.Update(calendarMux.ID, 3, CalendarMuxUpdate{Name: &name}, nil, "")
+	assert.ErrorIs(t, err, ErrInsufficientRole)
+	updated, err := service.Update(calendarMux.ID, 2, CalendarMuxUpdate{Name: &name}, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, "Household", updated.Name)
+
+	// Owners of the household may delete what the editor created
+	assert.ErrorIs(t, service.Delete(calendarMux.ID, 3, ""), ErrInsufficientRole)
+	require.NoError(t, service.Delete(calendarMux.ID, 1, ""))
+	muxList, err := service.List(2)
+	require.NoError(t, err)
+	assert.Empty(t, muxList)
+}
+
+func TestCalendarMuxService_Update(t *testing.T) {
+	t.Parallel()
+	service := NewCalendarMuxService(repositories.NewMemoryCalendarMuxRepository())
+	calendarMux, err := service.Create(1, "Family", "Everyone", true, nil, "")
+	require.NoError(t, err)
+
+	name := "Household"
+	dedupEnabled := false
+	_, err = service.Update(calendarMux.ID, 1, CalendarMuxUpdate{Name: &name}, func(time.Time) bool { return false }, "")
+	assert.ErrorIs(t, err, ErrCalendarMuxModified)
+
+	updated, err := service.Update(calendarMux.ID, 1, CalendarMuxUpdate{Name: &name, DedupEnabled: &dedupEnabled}, func(updatedAt time.Time) bool {
+		return updatedAt.Equal(calendarMux.UpdatedAt)
+	}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "Household", updated.Name)
+	assert.Equal(t, "Everyone", updated.Description)
+	assert.True(t, updated.DedupDisabled)
+
+	found, err := service.GetByFeedToken(calendarMux.FeedToken)
+	require.NoError(t, err)
+	assert.Equal(t, "Household", found.Name)
+	_, err = service.GetByFeedToken("")
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+}
+
+func TestCalendarMuxService_Restore(t *testing.T) {
+	t.Parallel()
+	muxes := repositories.NewMemoryCalendarMuxRepository()
+	service := NewCalendarMuxService(muxes)
+	householdID := uint(7)
+	muxes.AddHouseholdMember(householdID, 1, models.HouseholdRoleOwner)
+	muxes.AddHouseholdMember(householdID, 2, models.HouseholdRoleEditor)
+	calendarMux, err := service.Create(1, "Family", "", true, &householdID, "")
+	require.NoError(t, err)
+	require.NoError(t, service.Delete(calendarMux.ID, 1, ""))
+
+	// Household members see the trash, outsiders do not
+	trash, err := service.ListDeleted(2)
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	assert.Equal(t, calendarMux.ID, trash[0].ID)
+	trash, err = service.ListDeleted(3)
+	require.NoError(t, err)
+	assert.Empty(t, trash)
+
+	_, err = service.Restore(calendarMux.ID, 2, "")
+	assert.ErrorIs(t, err, ErrInsufficientRole)
+	_, err = service.Restore(calendarMux.ID, 3, "")
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+
+	restored, err := service.Restore(calendarMux.ID, 1, "")
+	require.NoError(t, err)
+	assert.Equal(t, "Family", restored.Name)
+	_, err = service.Get(calendarMux.ID, 2)
+	assert.NoError(t, err)
+
+	// Muxes that are not in the trash cannot be restored
+	_, err = service.Restore(calendarMux.ID, 1, "")
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
 }
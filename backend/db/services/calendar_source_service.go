@@ -0,0 +1,129 @@
+package services
+
+import (
+	"errors"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrCalendarSourceNotFound is returned when a calendar source does not exist in the given calendar mux
+var ErrCalendarSourceNotFound = errors.New("calendar source not found")
+
+// authorizeCalendarSource loads a source of a calendar mux the user may access with at least the
+// given role, together with the mux
+func (s *CalendarMuxService) authorizeCalendarSource(id, calendarMuxID, userID uint, minimum string) (*models.CalendarSource, *models.CalendarMux, error) {
+	calendarMux, err := s.authorize(calendarMuxID, userID, minimum)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var calendarSource models.CalendarSource
+	result := db.DB.Where("id = ? AND calendar_mux_id = ?", id, calendarMuxID).First(&calendarSource)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrCalendarSourceNotFound
+		}
+		return nil, nil, result.Error
+	}
+	return &calendarSource, calendarMux, nil
+}
+
+// CreateCalendarSource attaches a new calendar source to a calendar mux the user may edit
+func (s *CalendarMuxService) CreateCalendarSource(calendarMuxID, userID uint, url, label string, enabled bool, visibility, requestID string) (*models.CalendarSource, error) {
+	calendarMux, err := s.authorize(calendarMuxID, userID, models.HouseholdRoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	calendarSource := &models.CalendarSource{
+		CalendarMuxID: calendarMuxID,
+		URL:           url,
+		Label:         label,
+		Enabled:       enabled,
+		Visibility:    visibility,
+	}
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(calendarSource).Error; err != nil {
+			return err
+		}
+		return recordAuditLog(tx, userID, models.AuditActionCreate, models.AuditEntityCalendarSource, calendarSource.ID,
+			calendarMux.HouseholdID, nil, calendarSourceAuditFields(calendarSource), requestID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return calendarSource, nil
+}
+
+// GetCalendarSourcesByMux returns all sources of a calendar mux the user may see
+func (s *CalendarMuxService) GetCalendarSourcesByMux(calendarMuxID, userID uint) ([]models.CalendarSource, error) {
+	if _, err := s.authorize(calendarMuxID, userID, models.HouseholdRoleViewer); err != nil {
+		return nil, err
+	}
+
+	var calendarSources []models.CalendarSource
+	result := db.DB.Where("calendar_mux_id = ?", calendarMuxID).Order("id").Find(&calendarSources)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return calendarSources, nil
+}
+
+// DeleteCalendarSource removes a source from a calendar mux the user may edit. The source is only
+// soft-deleted, so the events synced from it are deleted with it.
+func (s *CalendarMuxService) DeleteCalendarSource(id, calendarMuxID, userID uint, requestID string) error {
+	calendarSource, calendarMux, err := s.authorizeCalendarSource(id, calendarMuxID, userID, models.HouseholdRoleEditor)
+	if err != nil {
+		return err
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND calendar_mux_id = ?", id, calendarMuxID).Delete(&models.CalendarSource{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrCalendarSourceNotFound
+		}
+		if err := tx.Where("calendar_source_id = ?", id).Delete(&models.CalendarEvent{}).Error; err != nil {
+			return err
+		}
+		return recordAuditLog(tx, userID, models.AuditActionDelete, models.AuditEntityCalendarSource, calendarSource.ID,
+			calendarMux.HouseholdID, calendarSourceAuditFields(calendarSource), nil, requestID)
+	})
+}
+
+// UpdateCalendarSourceVisibility changes the visibility mode of a source in a calendar mux the user may edit
+func (s *CalendarMuxService) UpdateCalendarSourceVisibility(id, calendarMuxID, userID uint, visibility, requestID string) (*models.CalendarSource, error) {
+	calendarSource, calendarMux, err := s.authorizeCalendarSource(id, calendarMuxID, userID, models.HouseholdRoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	before := calendarSourceAuditFields(calendarSource)
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(calendarSource).Update("visibility", visibility).Error; err != nil {
+			return err
+		}
+		return recordAuditLog(tx, userID, models.AuditActionUpdate, models.AuditEntityCalendarSource, calendarSource.ID,
+			calendarMux.HouseholdID, before, calendarSourceAuditFields(calendarSource), requestID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return calendarSource, nil
+}
+
+// GetEnabledCalendarSources returns the enabled sources of a calendar mux without an ownership check.
+// It is used by the public feed, which is authorized by the mux's feed token instead.
+func GetEnabledCalendarSources(calendarMuxID uint) ([]models.CalendarSource, error) {
+	var calendarSources []models.CalendarSource
+	result := db.DB.Where("calendar_mux_id = ? AND enabled = ?", calendarMuxID, true).Find(&calendarSources)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return calendarSources, nil
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/repositories"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupCalendarSourceTestDB(t *testing.T) (*models.User, *models.CalendarMux) {
+	var err error
+	db.DB, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+
+	err = db.DB.AutoMigrate(&models.User{}, &models.Household{}, &models.HouseholdMember{}, &models.HouseholdInvite{}, &models.CalendarMux{}, &models.CalendarSource{}, &models.CalendarEvent{}, &models.RewriteRule{}, &models.Session{}, &models.RefreshToken{}, &models.UserIdentity{}, &models.IdentityLink{}, &models.PersonalAccessToken{}, &models.AuthorizationCode{}, &models.AuditLog{})
+	assert.NoError(t, err)
+
+	user := &models.User{
+		GivenName:  "Test",
+		FamilyName: "User",
+		Email:      "test@example.com",
+	}
+	db.DB.Create(user)
+
+	calendarMux := &models.CalendarMux{
+		CreatedByID: user.ID,
+		Name:        "Family",
+	}
+	db.DB.Create(calendarMux)
+
+	return user, calendarMux
+}
+
+func createOtherUser(t *testing.T) *models.User {
+	otherUser := &models.User{
+		GivenName:  "Other",
+		FamilyName: "User",
+		Email:      "other@example.com",
+	}
+	assert.NoError(t, db.DB.Create(otherUser).Error)
+	return otherUser
+}
+
+func TestCreateCalendarSource(t *testing.T) {
+	user, calendarMux := setupCalendarSourceTestDB(t)
+
+	calendarSource, err := calendarMuxService().CreateCalendarSource(calendarMux.ID, user.ID, "https://example.com/school.ics", "School", true, models.VisibilityFull, "")
+
+	assert.NoError(t, err)
+	assert.NotZero(t, calendarSource.ID)
+	assert.Equal(t, calendarMux.ID, calendarSource.CalendarMuxID)
+	assert.Equal(t, "https://example.com/school.ics", calendarSource.URL)
+	assert.Equal(t, "School", calendarSource.Label)
+	assert.True(t, calendarSource.Enabled)
+	assert.Equal(t, models.VisibilityFull, calendarSource.Visibility)
+}
+
+func TestCreateCalendarSource_DefaultVisibility(t *testing.T) {
+	_, calendarMux := setupCalendarSourceTestDB(t)
+
+	// Rows created without a visibility, like those that predate the column, are fully visible
+	calendarSource := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/a.ics", Label: "A"}
+	db.DB.Create(calendarSource)
+
+	var found models.CalendarSource
+	db.DB.First(&found, calendarSource.ID)
+	assert.Equal(t, models.VisibilityFull, found.Visibility)
+}
+
+func TestCalendarSources_AuthorizedByInjectedRepository(t *testing.T) {
+	user, calendarMux := setupCalendarSourceTestDB(t)
+
+	// The mux is in the database, but not in the repository the service was given
+	service := NewCalendarMuxService(repositories.NewMemoryCalendarMuxRepository())
+	_, err := service.CreateCalendarSource(calendarMux.ID, user.ID, "https://example.com/school.ics", "School", true, models.VisibilityFull, "")
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+	_, err = service.GetCalendarSourcesByMux(calendarMux.ID, user.ID)
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+	_, err = service.GetRewriteRules(1, calendarMux.ID, user.ID)
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+}
+
+func TestUpdateCalendarSourceVisibility(t *testing.T) {
+	user, calendarMux := setupCalendarSourceTestDB(t)
+
+	calendarSource := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/a.ics", Label: "A", Enabled: true}
+	db.DB.Create(calendarSource)
+
+	updated, err := calendarMuxService().UpdateCalendarSourceVisibility(calendarSource.ID, calendarMux.ID, user.ID, models.VisibilityBusyOnly, "")
+	assert.NoError(t, err)
+	assert.Equal(t, models.VisibilityBusyOnly, updated.Visibility)
+
+	var found models.CalendarSource
+	db.DB.First(&found, calendarSource.ID)
+	assert.Equal(t, models.VisibilityBusyOnly, found.Visibility)
+}
+
+func TestUpdateCalendarSourceVisibility_Errors(t *testing.T) {
+	user, calendarMux := setupCalendarSourceTestDB(t)
+	otherUser := createOtherUser(t)
+
+	calendarSource := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/a.ics", Label: "A", Enabled: true}
+	db.DB.Create(calendarSource)
+
+	_, err := calendarMuxService().UpdateCalendarSourceVisibility(calendarSource.ID, calendarMux.ID, otherUser.ID, models.VisibilityBusyOnly, "")
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+
+	_, err = calendarMuxService().UpdateCalendarSourceVisibility(9999, calendarMux.ID, user.ID, models.VisibilityBusyOnly, "")
+	assert.ErrorIs(t, err, ErrCalendarSourceNotFound)
+
+	var found models.CalendarSource
+	db.DB.First(&found, calendarSource.ID)
+	assert.Equal(t, models.VisibilityFull, found.Visibility)
+}
+
+func TestCreateCalendarSource_WrongUser(t *testing.T) {
+	_, calendarMux := setupCalendarSourceTestDB(t)
+	otherUser := createOtherUser(t)
+
+	calendarSource, err := calendarMuxService().CreateCalendarSource(calendarMux.ID, otherUser.ID, "https://example.com/school.ics", "School", true, models.VisibilityFull, "")
+
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+	assert.Nil(t, calendarSource)
+
+	var count int64
+	db.DB.Model(&models.CalendarSource{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestGetCalendarSourcesByMux(t *testing.T) {
+	user, calendarMux := setupCalendarSourceTestDB(t)
+
+	otherMux := &models.CalendarMux{CreatedByID: user.ID, Name: "Other"}
+	db.DB.Create(otherMux)
+
+	db.DB.Create(&models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/a.ics", Label: "A", Enabled: true})
+	db.DB.Create(&models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/b.ics", Label: "B"})
+	db.DB.Create(&models.CalendarSource{CalendarMuxID: otherMux.ID, URL: "https://example.com/c.ics", Label: "C", Enabled: true})
+
+	calendarSources, err := calendarMuxService().GetCalendarSourcesByMux(calendarMux.ID, user.ID)
+
+	assert.NoError(t, err)
+	assert.Len(t, calendarSources, 2)
+	assert.Equal(t, "A", calendarSources[0].Label)
+	assert.Equal(t, "B", calendarSources[1].Label)
+}
+
+func TestGetCalendarSourcesByMux_WrongUser(t *testing.T) {
+	_, calendarMux := setupCalendarSourceTestDB(t)
+	otherUser := createOtherUser(t)
+
+	_, err := calendarMuxService().GetCalendarSourcesByMux(calendarMux.ID, otherUser.ID)
+
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+}
+
+func TestDeleteCalendarSource_Success(t *testing.T) {
+	user, calendarMux := setupCalendarSourceTestDB(t)
+
+	calendarSource := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/a.ics", Label: "A", Enabled: true}
+	db.DB.Create(calendarSource)
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: calendarSource.ID, UID: "a", Data: "BEGIN:VEVENT\r\nEND:VEVENT\r\n"})
+
+	err := calendarMuxService().DeleteCalendarSource(calendarSource.ID, calendarMux.ID, user.ID, "")
+	assert.NoError(t, err)
+
+	var found models.CalendarSource
+	assert.Error(t, db.DB.First(&found, calendarSource.ID).Error)
+	var events int64
+	db.DB.Model(&models.CalendarEvent{}).Where("calendar_source_id = ?", calendarSource.ID).Count(&events)
+	assert.Zero(t, events)
+}
+
+func TestDeleteCalendarSource_WrongUser(t *testing.T) {
+	_, calendarMux := setupCalendarSourceTestDB(t)
+	otherUser := createOtherUser(t)
+
+	calendarSource := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/a.ics", Label: "A", Enabled: true}
+	db.DB.Create(calendarSource)
+
+	err := calendarMuxService().DeleteCalendarSource(calendarSource.ID, calendarMux.ID, otherUser.ID, "")
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+
+	var found models.CalendarSource
+	assert.NoError(t, db.DB.First(&found, calendarSource.ID).Error)
+}
+
+func TestDeleteCalendarSource_SourceInOtherMux(t *testing.T) {
+	user, calendarMux := setupCalendarSourceTestDB(t)
+
+	otherMux := &models.CalendarMux{CreatedByID: user.ID, Name: "Other"}
+	db.DB.Create(otherMux)
+	calendarSource := &models.CalendarSource{CalendarMuxID: otherMux.ID, URL: "https://example.com/a.ics", Label: "A", Enabled: true}
+	db.DB.Create(calendarSource)
+
+	err := calendarMuxService().DeleteCalendarSource(calendarSource.ID, calendarMux.ID, user.ID, "")
+	assert.ErrorIs(t, err, ErrCalendarSourceNotFound)
+}
+
+func TestGetCalendarSourcesByMux_DatabaseError(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer sqlDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: sqlDB,
+	}), &gorm.Config{})
+	assert.NoError(t, err)
+
+	// Expect the ownership lookup to fail
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "calendar_muxes"`)).
+		WillReturnError(errors.New("database error"))
+
+	_, err = NewCalendarMuxService(repositories.NewGormCalendarMuxRepository(gormDB)).GetCalendarSourcesByMux(1, 1)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrCalendarMuxNotFound)
+	assert.Contains(t, err.Error(), "database error")
+}
+
+func TestGetEnabledCalendarSources(t *testing.T) {
+	_, calendarMux := setupCalendarSourceTestDB(t)
+
+	db.DB.Create(&models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/a.ics", Label: "A", Enabled: true})
+	db.DB.Create(&models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/b.ics", Label: "B", Enabled: false})
+
+	calendarSources, err := GetEnabledCalendarSources(calendarMux.ID)
+
+	assert.NoError(t, err)
+	assert.Len(t, calendarSources, 1)
+	assert.Equal(t, "A", calendarSources[0].Label)
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInviteNotFound is returned when no invite has the given token or ID
+	ErrInviteNotFound = errors.New("invite not found")
+	// ErrInviteExpired is returned when accepting an invite past its expiry
+	ErrInviteExpired = errors.New("invite has expired")
+	// ErrInviteRevoked is returned when accepting an invite an owner has revoked
+	ErrInviteRevoked = errors.New("invite has been revoked")
+	// ErrInviteUsed is returned when an invite has already been accepted
+	ErrInviteUsed = errors.New("invite has already been used")
+)
+
+// CreateHouseholdInvite creates an invite to a household owned by the user, valid until expiresAt.
+// The token is returned only here; the invite just keeps its hash.
+func CreateHouseholdInvite(householdID, userID uint, role string, expiresAt time.Time, requestID string) (*models.HouseholdInvite, string, error) {
+	if _, err := getAuthorizedHousehold(householdID, userID, models.HouseholdRoleOwner); err != nil {
+		return nil, "", err
+	}
+
+	token, hash, err := models.NewHashedToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	invite := &models.HouseholdInvite{
+		HouseholdID: householdID,
+		CreatedByID: userID,
+		Role:        role,
+		TokenHash:   hash,
+		ExpiresAt:   expiresAt,
+	}
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(invite).Error; err != nil {
+			return err
+		}
+		return recordAuditLog(tx, userID, models.AuditActionCreate, models.AuditEntityHouseholdInvite, invite.ID,
+			&invite.HouseholdID, nil, householdInviteAuditFields(invite), requestID)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return invite, token, nil
+}
+
+// GetHouseholdInvites returns the invites of a household owned by the user, newest first, with
+// the users who accepted them
+func GetHouseholdInvites(householdID, userID uint) ([]models.HouseholdInvite, error) {
+	if _, err := getAuthorizedHousehold(householdID, userID, models.HouseholdRoleOwner); err != nil {
+		return nil, err
+	}
+
+	var invites []models.HouseholdInvite
+	result := db.DB.Preload("AcceptedBy").Where("household_id = ?", householdID).Order("id DESC").Find(&invites)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return invites, nil
+}
+
+// RevokeHouseholdInvite stops an invite to a household owned by the user from being accepted.
+// Revoking twice is harmless; accepted invites cannot be revoked.
+func RevokeHouseholdInvite(id, householdID, userID uint, now time.Time, requestID string) (*models.HouseholdInvite, error) {
+	if _, err := getAuthorizedHousehold(householdID, userID, models.HouseholdRoleOwner); err != nil {
+		return nil, err
+	}
+
+	var invite models.HouseholdInvite
+	result := db.DB.Preload("AcceptedBy").Where("id = ? AND household_id = ?", id, householdID).First(&invite)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrInviteNotFound
+		}
+		return nil, result.Error
+	}
+	if invite.AcceptedAt != nil {
+		return nil, ErrInviteUsed
+	}
+	if invite.RevokedAt != nil {
+		return &invite, nil
+	}
+
+	before := householdInviteAuditFields(&invite)
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&invite).Where("accepted_at IS NULL").Update("revoked_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInviteUsed
+		}
+		return recordAuditLog(tx, userID, models.AuditActionUpdate, models.AuditEntityHouseholdInvite, invite.ID,
+			&invite.HouseholdID, before, householdInviteAuditFields(&invite), requestID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// AcceptHouseholdInvite makes the user a member of the household an invite token is for, with the
+// invite's role, and records the user and time on the invite. Users who already are members get
+// ErrHouseholdMemberExists and leave the invite unused.
+func AcceptHouseholdInvite(token string, userID uint, now time.Time, requestID string) (*models.HouseholdMember, error) {
+	if token == "" {
+		return nil, ErrInviteNotFound
+	}
+
+	var member models.HouseholdMember
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var invite models.HouseholdInvite
+		result := tx.Preload("Household").Where("token_hash = ?", models.HashToken(token)).First(&invite)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return ErrInviteNotFound
+			}
+			return result.Error
+		}
+		// Preloading skips soft-deleted households
+		if invite.Household.ID == 0 {
+			return ErrInviteNotFound
+		}
+		switch {
+		case invite.AcceptedAt != nil:
+			return ErrInviteUsed
+		case invite.RevokedAt != nil:
+			return ErrInviteRevoked
+		case !now.Before(invite.ExpiresAt):
+			return ErrInviteExpired
+		}
+
+		role, err := getHouseholdRole(tx, invite.HouseholdID, userID)
+		if err != nil {
+			return err
+		}
+		if role != "" {
+			return ErrHouseholdMemberExists
+		}
+
+		// Claim the invite only if nobody else claimed or revoked it in the meantime
+		result = tx.Model(&invite).
+			Where("accepted_at IS NULL AND revoked_at IS NULL").
+			Updates(map[string]interface{}{"accepted_by_id": userID, "accepted_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInviteUsed
+		}
+
+		member = models.HouseholdMember{
+			HouseholdID: invite.HouseholdID,
+			Household:   invite.Household,
+			UserID:      userID,
+			Role:        invite.Role,
+		}
+		return createHouseholdMember(tx, userID, &member, requestID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
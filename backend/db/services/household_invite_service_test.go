@@ -0,0 +1,139 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateHouseholdInvite_StoresTokenHash(t *testing.T) {
+	household, owner, _, _ := setupHouseholdTestDB(t)
+	expiresAt := time.Now().Add(time.Hour)
+
+	invite, token, err := CreateHouseholdInvite(household.ID, owner.ID, models.HouseholdRoleEditor, expiresAt, "")
+	require.NoError(t, err)
+	assert.Len(t, token, 64)
+	assert.Equal(t, models.HashToken(token), invite.TokenHash)
+	assert.NotEqual(t, token, invite.TokenHash)
+	assert.Equal(t, models.HouseholdRoleEditor, invite.Role)
+
+	_, other, err := CreateHouseholdInvite(household.ID, owner.ID, models.HouseholdRoleEditor, expiresAt, "")
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func TestCreateHouseholdInvite_OwnersOnly(t *testing.T) {
+	household, _, editor, _ := setupHouseholdTestDB(t)
+
+	_, _, err := CreateHouseholdInvite(household.ID, editor.ID, models.HouseholdRoleViewer, time.Now().Add(time.Hour), "")
+	assert.ErrorIs(t, err, ErrInsufficientRole)
+
+	_, err = GetHouseholdInvites(household.ID, editor.ID)
+	assert.ErrorIs(t, err, ErrInsufficientRole)
+}
+
+func TestAcceptHouseholdInvite(t *testing.T) {
+	household, owner, _, _ := setupHouseholdTestDB(t)
+	invitee := createHouseholdUser(t, "invitee")
+	now := time.Now()
+	invite, token, err := CreateHouseholdInvite(household.ID, owner.ID, models.HouseholdRoleEditor, now.Add(time.Hour), "")
+	require.NoError(t, err)
+
+	member, err := AcceptHouseholdInvite(token, invitee.ID, now, "")
+	require.NoError(t, err)
+	assert.Equal(t, household.ID, member.HouseholdID)
+	assert.Equal(t, "Family", member.Household.Name)
+	assert.Equal(t, invitee.ID, member.UserID)
+	assert.Equal(t, models.HouseholdRoleEditor, member.Role)
+
+	// The invite records who accepted it and when
+	invites, err := GetHouseholdInvites(household.ID, owner.ID)
+	require.NoError(t, err)
+	require.Len(t, invites, 1)
+	assert.Equal(t, invite.ID, invites[0].ID)
+	require.NotNil(t, invites[0].AcceptedByID)
+	assert.Equal(t, invitee.ID, *invites[0].AcceptedByID)
+	require.NotNil(t, invites[0].AcceptedBy)
+	assert.Equal(t, "invitee@example.com", invites[0].AcceptedBy.Email)
+	require.NotNil(t, invites[0].AcceptedAt)
+	assert.WithinDuration(t, now, *invites[0].AcceptedAt, time.Second)
+
+	// Invites are single-use
+	someoneElse := createHouseholdUser(t, "someone")
+	_, err = AcceptHouseholdInvite(token, someoneElse.ID, now, "")
+	assert.ErrorIs(t, err, ErrInviteUsed)
+}
+
+func TestAcceptHouseholdInvite_Errors(t *testing.T) {
+	household, owner, editor, _ := setupHouseholdTestDB(t)
+	invitee := createHouseholdUser(t, "invitee")
+	now := time.Now()
+
+	_, err := AcceptHouseholdInvite("does-not-exist", invitee.ID, now, "")
+	assert.ErrorIs(t, err, ErrInviteNotFound)
+	_, err = AcceptHouseholdInvite("", invitee.ID, now, "")
+	assert.ErrorIs(t, err, ErrInviteNotFound)
+
+	_, expired, err := CreateHouseholdInvite(household.ID, owner.ID, models.HouseholdRoleViewer, now.Add(time.Hour), "")
+	require.NoError(t, err)
+	_, err = AcceptHouseholdInvite(expired, invitee.ID, now.Add(time.Hour), "")
+	assert.ErrorIs(t, err, ErrInviteExpired)
+
+	// Members cannot use up an invite meant for someone else
+	_, token, err := CreateHouseholdInvite(household.ID, owner.ID, models.HouseholdRoleViewer, now.Add(time.Hour), "")
+	require.NoError(t, err)
+	_, err = AcceptHouseholdInvite(token, editor.ID, now, "")
+	assert.ErrorIs(t, err, ErrHouseholdMemberExists)
+	_, err = AcceptHouseholdInvite(token, invitee.ID, now, "")
+	assert.NoError(t, err)
+}
+
+func TestRevokeHouseholdInvite(t *testing.T) {
+	household, owner, editor, _ := setupHouseholdTestDB(t)
+	invitee := createHouseholdUser(t, "invitee")
+	now := time.Now()
+	invite, token, err := CreateHouseholdInvite(household.ID, owner.ID, models.HouseholdRoleViewer, now.Add(time.Hour), "")
+	require.NoError(t, err)
+
+	_, err = RevokeHouseholdInvite(invite.ID, household.ID, editor.ID, now, "")
+	assert.ErrorIs(t, err, ErrInsufficientRole)
+	_, err = RevokeHouseholdInvite(9999, household.ID, owner.ID, now, "")
+	assert.ErrorIs(t, err, ErrInviteNotFound)
+
+	revoked, err := RevokeHouseholdInvite(invite.ID, household.ID, owner.ID, now, "")
+	require.NoError(t, err)
+	require.NotNil(t, revoked.RevokedAt)
+	_, err = RevokeHouseholdInvite(invite.ID, household.ID, owner.ID, now, "")
+	assert.NoError(t, err)
+
+	_, err = AcceptHouseholdInvite(token, invitee.ID, now, "")
+	assert.ErrorIs(t, err, ErrInviteRevoked)
+
+	// Accepted invites stay accepted
+	accepted, token, err := CreateHouseholdInvite(household.ID, owner.ID, models.HouseholdRoleViewer, now.Add(time.Hour), "")
+	require.NoError(t, err)
+	_, err = AcceptHouseholdInvite(token, invitee.ID, now, "")
+	require.NoError(t, err)
+	_, err = RevokeHouseholdInvite(accepted.ID, household.ID, owner.ID, now, "")
+	assert.ErrorIs(t, err, ErrInviteUsed)
+}
+
+func TestDeleteHousehold_DeletesInvites(t *testing.T) {
+	household, owner, _, _ := setupHouseholdTestDB(t)
+	invitee := createHouseholdUser(t, "invitee")
+	_, token, err := CreateHouseholdInvite(household.ID, owner.ID, models.HouseholdRoleViewer, time.Now().Add(time.Hour), "")
+	require.NoError(t, err)
+
+	require.NoError(t, DeleteHousehold(household.ID, owner.ID, ""))
+
+	var count int64
+	db.DB.Model(&models.HouseholdInvite{}).Count(&count)
+	assert.Zero(t, count)
+	_, err = AcceptHouseholdInvite(token, invitee.ID, time.Now(), "")
+	assert.ErrorIs(t, err, ErrInviteNotFound)
+}
@@ -0,0 +1,305 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrHouseholdNotFound is returned when a household does not exist or the user is not a member
+	ErrHouseholdNotFound = errors.New("household not found or access denied")
+	// ErrInsufficientRole is returned when a user can see a household or calendar mux but their role does not allow the change
+	ErrInsufficientRole = errors.New("insufficient household role")
+	// ErrHouseholdMemberNotFound is returned when a user is not a member of the given household
+	ErrHouseholdMemberNotFound = errors.New("household member not found")
+	// ErrHouseholdMemberExists is returned when adding a user who already is a member
+	ErrHouseholdMemberExists = errors.New("user is already a household member")
+	// ErrLastHouseholdOwner is returned when a change would leave a household without an owner
+	ErrLastHouseholdOwner = errors.New("a household needs at least one owner")
+	// ErrUserNotFound is returned when no user has the given email address
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// householdRoleRanks orders the household roles; unknown roles rank below every real one
+var householdRoleRanks = map[string]int{
+	models.HouseholdRoleViewer: 1,
+	models.HouseholdRoleEditor: 2,
+	models.HouseholdRoleOwner:  3,
+}
+
+// roleAtLeast reports whether role grants at least the rights of minimum
+func roleAtLeast(role, minimum string) bool {
+	rank := householdRoleRanks[role]
+	return rank > 0 && rank >= householdRoleRanks[minimum]
+}
+
+// getHouseholdRole returns the role of a user in a household, or "" when they are not a member
+func getHouseholdRole(tx *gorm.DB, householdID, userID uint) (string, error) {
+	var member models.HouseholdMember
+	result := tx.Where("household_id = ? AND user_id = ?", householdID, userID).Limit(1).Find(&member)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	return member.Role, nil
+}
+
+// getAuthorizedHousehold loads a household in which the user has at least the given role.
+// Non-members get ErrHouseholdNotFound and members with a lesser role ErrInsufficientRole.
+func getAuthorizedHousehold(id, userID uint, minimum string) (*models.Household, error) {
+	var household models.Household
+	result := db.DB.First(&household, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrHouseholdNotFound
+		}
+		return nil, result.Error
+	}
+
+	role, err := getHouseholdRole(db.DB, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, ErrHouseholdNotFound
+	}
+	if !roleAtLeast(role, minimum) {
+		return nil, ErrInsufficientRole
+	}
+	return &household, nil
+}
+
+// countHouseholdOwners returns the number of owners of a household
+func countHouseholdOwners(tx *gorm.DB, householdID uint) (int64, error) {
+	var count int64
+	result := tx.Model(&models.HouseholdMember{}).
+		Where("household_id = ? AND role = ?", householdID, models.HouseholdRoleOwner).
+		Count(&count)
+	return count, result.Error
+}
+
+// createHouseholdMember adds a member to a household and records it in the audit log
+func createHouseholdMember(tx *gorm.DB, userID uint, member *models.HouseholdMember, requestID string) error {
+	if err := tx.Omit("User", "Household").Create(member).Error; err != nil {
+		return err
+	}
+	return recordAuditLog(tx, userID, models.AuditActionCreate, models.AuditEntityHouseholdMember, member.ID,
+		&member.HouseholdID, nil, householdMemberAuditFields(member), requestID)
+}
+
+// CreateHousehold creates a household with the user as its first owner
+func CreateHousehold(userID uint, name, requestID string) (*models.Household, error) {
+	household := &models.Household{Name: name, CreatedByID: userID}
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(household).Error; err != nil {
+			return err
+		}
+		if err := recordAuditLog(tx, userID, models.AuditActionCreate, models.AuditEntityHousehold, household.ID,
+			&household.ID, nil, householdAuditFields(household), requestID); err != nil {
+			return err
+		}
+		return createHouseholdMember(tx, userID, &models.HouseholdMember{
+			HouseholdID: household.ID,
+			UserID:      userID,
+			Role:        models.HouseholdRoleOwner,
+		}, requestID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return household, nil
+}
+
+// GetHouseholdMembershipsByUser returns the memberships of a user, with their households loaded
+func GetHouseholdMembershipsByUser(userID uint) ([]models.HouseholdMember, error) {
+	var memberships []models.HouseholdMember
+	result := db.DB.Preload("Household").Where("user_id = ?", userID).Order("household_id").Find(&memberships)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return memberships, nil
+}
+
+// GetHousehold returns a household the user is a member of, together with its members and their users
+func GetHousehold(id, userID uint) (*models.Household, []models.HouseholdMember, error) {
+	household, err := getAuthorizedHousehold(id, userID, models.HouseholdRoleViewer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var members []models.HouseholdMember
+	result := db.DB.Preload("User").Where("household_id = ?", id).Order("id").Find(&members)
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+	return household, members, nil
+}
+
+// DeleteHousehold deletes a household owned by the user. Its calendar muxes are kept by their
+// creators and stop being shared.
+func DeleteHousehold(id, userID uint, requestID string) error {
+	household, err := getAuthorizedHousehold(id, userID, models.HouseholdRoleOwner)
+	if err != nil {
+		return err
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		// Record the muxes that stop being shared and the memberships that end, so that the owners
+		// can still see what the household contained. Muxes in the trash are included, so that
+		// their creators can restore them without the household.
+		var calendarMuxes []models.CalendarMux
+		if err := tx.Unscoped().Where("household_id = ?", id).Order("id").Find(&calendarMuxes).Error; err != nil {
+			return err
+		}
+		for i := range calendarMuxes {
+			before := calendarMuxAuditFields(&calendarMuxes[i])
+			after := calendarMuxAuditFields(&calendarMuxes[i])
+			after["household_id"] = nil
+			if err := recordAuditLog(tx, userID, models.AuditActionUpdate, models.AuditEntityCalendarMux, calendarMuxes[i].ID,
+				&household.ID, before, after, requestID); err != nil {
+				return err
+			}
+		}
+		var members []models.HouseholdMember
+		if err := tx.Where("household_id = ?", id).Order("id").Find(&members).Error; err != nil {
+			return err
+		}
+		for i := range members {
+			if err := recordAuditLog(tx, userID, models.AuditActionDelete, models.AuditEntityHouseholdMember, members[i].ID,
+				&household.ID, householdMemberAuditFields(&members[i]), nil, requestID); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Unscoped().Model(&models.CalendarMux{}).Where("household_id = ?", id).Update("household_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("household_id = ?", id).Delete(&models.HouseholdMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("household_id = ?", id).Delete(&models.HouseholdInvite{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.Household{}, id).Error; err != nil {
+			return err
+		}
+		return recordAuditLog(tx, userID, models.AuditActionDelete, models.AuditEntityHousehold, household.ID,
+			&household.ID, householdAuditFields(household), nil, requestID)
+	})
+}
+
+// AddHouseholdMember gives the user with the given email address a role in a household owned by the user
+func AddHouseholdMember(householdID, userID uint, email, role, requestID string) (*models.HouseholdMember, error) {
+	if _, err := getAuthorizedHousehold(householdID, userID, models.HouseholdRoleOwner); err != nil {
+		return nil, err
+	}
+
+	// Users without a verified email address cannot be found by one
+	if email == "" {
+		return nil, ErrUserNotFound
+	}
+	var user models.User
+	result := db.DB.Where("LOWER(email) = ?", strings.ToLower(email)).First(&user)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, result.Error
+	}
+
+	existing, err := getHouseholdRole(db.DB, householdID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != "" {
+		return nil, ErrHouseholdMemberExists
+	}
+
+	member := &models.HouseholdMember{HouseholdID: householdID, UserID: user.ID, Role: role, User: user}
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		return createHouseholdMember(tx, userID, member, requestID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// UpdateHouseholdMemberRole changes the role of a member of a household owned by the user
+func UpdateHouseholdMemberRole(householdID, userID, memberUserID uint, role, requestID string) (*models.HouseholdMember, error) {
+	if _, err := getAuthorizedHousehold(householdID, userID, models.HouseholdRoleOwner); err != nil {
+		return nil, err
+	}
+
+	var member models.HouseholdMember
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Preload("User").Where("household_id = ? AND user_id = ?", householdID, memberUserID).First(&member)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return ErrHouseholdMemberNotFound
+			}
+			return result.Error
+		}
+
+		if member.Role == models.HouseholdRoleOwner && role != models.HouseholdRoleOwner {
+			owners, err := countHouseholdOwners(tx, householdID)
+			if err != nil {
+				return err
+			}
+			if owners <= 1 {
+				return ErrLastHouseholdOwner
+			}
+		}
+		before := householdMemberAuditFields(&member)
+		if err := tx.Model(&member).Update("role", role).Error; err != nil {
+			return err
+		}
+		return recordAuditLog(tx, userID, models.AuditActionUpdate, models.AuditEntityHouseholdMember, member.ID,
+			&member.HouseholdID, before, householdMemberAuditFields(&member), requestID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// RemoveHouseholdMember removes a member from a household. Owners can remove anyone and every
+// member can leave, as long as the household keeps an owner.
+func RemoveHouseholdMember(householdID, userID, memberUserID uint, requestID string) error {
+	minimum := models.HouseholdRoleOwner
+	if memberUserID == userID {
+		minimum = models.HouseholdRoleViewer
+	}
+	if _, err := getAuthorizedHousehold(householdID, userID, minimum); err != nil {
+		return err
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var member models.HouseholdMember
+		result := tx.Where("household_id = ? AND user_id = ?", householdID, memberUserID).Limit(1).Find(&member)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrHouseholdMemberNotFound
+		}
+		if member.Role == models.HouseholdRoleOwner {
+			owners, err := countHouseholdOwners(tx, householdID)
+			if err != nil {
+				return err
+			}
+			if owners <= 1 {
+				return ErrLastHouseholdOwner
+			}
+		}
+		if err := tx.Delete(&member).Error; err != nil {
+			return err
+		}
+		return recordAuditLog(tx, userID, models.AuditActionDelete, models.AuditEntityHouseholdMember, member.ID,
+			&member.HouseholdID, householdMemberAuditFields(&member), nil, requestID)
+	})
+}
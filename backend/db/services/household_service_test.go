@@ -0,0 +1,297 @@
+package services
+
+import (
+	"testing"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createHouseholdUser(t *testing.T, name string) *models.User {
+	user := &models.User{
+		GivenName:  name,
+		FamilyName: "User",
+		Email:      name + "@example.com",
+	}
+	require.NoError(t, db.DB.Create(user).Error)
+	return user
+}
+
+// setupHouseholdTestDB creates a household owned by "owner" with an editor and a viewer
+func setupHouseholdTestDB(t *testing.T) (household *models.Household, owner, editor, viewer *models.User) {
+	setupTestDB(t)
+	owner = createHouseholdUser(t, "owner")
+	editor = createHouseholdUser(t, "editor")
+	viewer = createHouseholdUser(t, "viewer")
+
+	household, err := CreateHousehold(owner.ID, "Family", "")
+	require.NoError(t, err)
+	_, err = AddHouseholdMember(household.ID, owner.ID, editor.Email, models.HouseholdRoleEditor, "")
+	require.NoError(t, err)
+	_, err = AddHouseholdMember(household.ID, owner.ID, viewer.Email, models.HouseholdRoleViewer, "")
+	require.NoError(t, err)
+	return household, owner, editor, viewer
+}
+
+func TestCreateHousehold_MakesCreatorOwner(t *testing.T) {
+	setupTestDB(t)
+	user := createHouseholdUser(t, "owner")
+
+	household, err := CreateHousehold(user.ID, "Family", "")
+	require.NoError(t, err)
+	assert.NotZero(t, household.ID)
+	assert.Equal(t, "Family", household.Name)
+
+	memberships, err := GetHouseholdMembershipsByUser(user.ID)
+	require.NoError(t, err)
+	require.Len(t, memberships, 1)
+	assert.Equal(t, household.ID, memberships[0].HouseholdID)
+	assert.Equal(t, "Family", memberships[0].Household.Name)
+	assert.Equal(t, models.HouseholdRoleOwner, memberships[0].Role)
+}
+
+func TestGetHousehold_ListsMembers(t *testing.T) {
+	household, owner, editor, viewer := setupHouseholdTestDB(t)
+
+	got, members, err := GetHousehold(household.ID, viewer.ID)
+	require.NoError(t, err)
+	assert.Equal(t, household.ID, got.ID)
+	require.Len(t, members, 3)
+	assert.Equal(t, owner.ID, members[0].UserID)
+	assert.Equal(t, "owner@example.com", members[0].User.Email)
+	assert.Equal(t, editor.ID, members[1].UserID)
+	assert.Equal(t, models.HouseholdRoleEditor, members[1].Role)
+	assert.Equal(t, viewer.ID, members[2].UserID)
+	assert.Equal(t, models.HouseholdRoleViewer, members[2].Role)
+}
+
+func TestGetHousehold_NonMember(t *testing.T) {
+	household, _, _, _ := setupHouseholdTestDB(t)
+	outsider := createHouseholdUser(t, "outsider")
+
+	_, _, err := GetHousehold(household.ID, outsider.ID)
+	assert.ErrorIs(t, err, ErrHouseholdNotFound)
+
+	_, _, err = GetHousehold(9999, outsider.ID)
+	assert.ErrorIs(t, err, ErrHouseholdNotFound)
+}
+
+func TestAddHouseholdMember_Errors(t *testing.T) {
+	household, owner, editor, _ := setupHouseholdTestDB(t)
+	outsider := createHouseholdUser(t, "outsider")
+
+	_, err := AddHouseholdMember(household.ID, editor.ID, outsider.Email, models.HouseholdRoleViewer, "")
+	assert.ErrorIs(t, err, ErrInsufficientRole)
+
+	_, err = AddHouseholdMember(household.ID, owner.ID, "nobody@example.com", models.HouseholdRoleViewer, "")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	// Users signed in without a verified email address are not found by an empty one
+	_, err = FindOrCreateUser("stub", "unverified-1", "No", "Email", "")
+	require.NoError(t, err)
+	_, err = AddHouseholdMember(household.ID, owner.ID, "", models.HouseholdRoleViewer, "")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	_, err = AddHouseholdMember(household.ID, owner.ID, "EDITOR@example.com", models.HouseholdRoleViewer, "")
+	assert.ErrorIs(t, err, ErrHouseholdMemberExists)
+
+	member, err := AddHouseholdMember(household.ID, owner.ID, "Outsider@Example.com", models.HouseholdRoleViewer, "")
+	require.NoError(t, err)
+	assert.Equal(t, outsider.ID, member.UserID)
+	assert.Equal(t, "outsider@example.com", member.User.Email)
+}
+
+func TestUpdateHouseholdMemberRole(t *testing.T) {
+	household, owner, editor, viewer := setupHouseholdTestDB(t)
+
+	member, err := UpdateHouseholdMemberRole(household.ID, owner.ID, viewer.ID, models.HouseholdRoleEditor, "")
+	require.NoError(t, err)
+	assert.Equal(t, models.HouseholdRoleEditor, member.Role)
+	assert.Equal(t, viewer.ID, member.User.ID)
+
+	_, err = UpdateHouseholdMemberRole(household.ID, editor.ID, viewer.ID, models.HouseholdRoleOwner, "")
+	assert.ErrorIs(t, err, ErrInsufficientRole)
+
+	_, err = UpdateHouseholdMemberRole(household.ID, owner.ID, 9999, models.HouseholdRoleViewer, "")
+	assert.ErrorIs(t, err, ErrHouseholdMemberNotFound)
+}
+
+func TestUpdateHouseholdMemberRole_KeepsAnOwner(t *testing.T) {
+	household, owner, editor, _ := setupHouseholdTestDB(t)
+
+	_, err := UpdateHouseholdMemberRole(household.ID, owner.ID, owner.ID, models.HouseholdRoleEditor, "")
+	assert.ErrorIs(t, err, ErrLastHouseholdOwner)
+
+	// With a second owner the first one can step down
+	_, err = UpdateHouseholdMemberRole(household.ID, owner.ID, editor.ID, models.HouseholdRoleOwner, "")
+	require.NoError(t, err)
+	member, err := UpdateHouseholdMemberRole(household.ID, owner.ID, owner.ID, models.HouseholdRoleEditor, "")
+	require.NoError(t, err)
+	assert.Equal(t, models.HouseholdRoleEditor, member.Role)
+}
+
+func TestRemoveHouseholdMember(t *testing.T) {
+	household, owner, editor, viewer := setupHouseholdTestDB(t)
+
+	// Members cannot remove each other but can leave
+	err := RemoveHouseholdMember(household.ID, editor.ID, viewer.ID, "")
+	assert.ErrorIs(t, err, ErrInsufficientRole)
+	require.NoError(t, RemoveHouseholdMember(household.ID, viewer.ID, viewer.ID, ""))
+
+	// Owners can remove anyone but the last owner
+	require.NoError(t, RemoveHouseholdMember(household.ID, owner.ID, editor.ID, ""))
+	err = RemoveHouseholdMember(household.ID, owner.ID, owner.ID, "")
+	assert.ErrorIs(t, err, ErrLastHouseholdOwner)
+	err = RemoveHouseholdMember(household.ID, owner.ID, editor.ID, "")
+	assert.ErrorIs(t, err, ErrHouseholdMemberNotFound)
+
+	_, members, err := GetHousehold(household.ID, owner.ID)
+	require.NoError(t, err)
+	require.Len(t, members, 1)
+	assert.Equal(t, owner.ID, members[0].UserID)
+}
+
+func TestDeleteHousehold_UnsharesCalendarMuxes(t *testing.T) {
+	household, owner, editor, _ := setupHouseholdTestDB(t)
+	calendarMux, err := calendarMuxService().Create(editor.ID, "Family", "", true, &household.ID, "")
+	require.NoError(t, err)
+
+	err = DeleteHousehold(household.ID, editor.ID, "")
+	assert.ErrorIs(t, err, ErrInsufficientRole)
+
+	require.NoError(t, DeleteHousehold(household.ID, owner.ID, ""))
+
+	_, _, err = GetHousehold(household.ID, owner.ID)
+	assert.ErrorIs(t, err, ErrHouseholdNotFound)
+	memberships, err := GetHouseholdMembershipsByUser(editor.ID)
+	require.NoError(t, err)
+	assert.Empty(t, memberships)
+
+	// The creator keeps the mux; the former owner of the household loses access
+	kept, err := calendarMuxService().Get(calendarMux.ID, editor.ID)
+	require.NoError(t, err)
+	assert.Nil(t, kept.HouseholdID)
+	_, err = calendarMuxService().Get(calendarMux.ID, owner.ID)
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+}
+
+func TestDeleteHousehold_TrashedCalendarMuxesStayRestorable(t *testing.T) {
+	household, owner, _, _ := setupHouseholdTestDB(t)
+	calendarMux, err := calendarMuxService().Create(owner.ID, "Family", "", true, &household.ID, "")
+	require.NoError(t, err)
+	require.NoError(t, calendarMuxService().Delete(calendarMux.ID, owner.ID, ""))
+
+	require.NoError(t, DeleteHousehold(household.ID, owner.ID, "req-delete"))
+
+	// The mux left the household in the trash too, so its creator can restore it
+	restored, err := calendarMuxService().Restore(calendarMux.ID, owner.ID, "")
+	require.NoError(t, err)
+	assert.Nil(t, restored.HouseholdID)
+
+	var unshared int64
+	db.DB.Model(&models.AuditLog{}).Where("request_id = ? AND entity_type = ? AND entity_id = ?",
+		"req-delete", models.AuditEntityCalendarMux, calendarMux.ID).Count(&unshared)
+	assert.Equal(t, int64(1), unshared)
+}
+
+func TestCalendarMux_HouseholdRoles(t *testing.T) {
+	household, owner, editor, viewer := setupHouseholdTestDB(t)
+	outsider := createHouseholdUser(t, "outsider")
+
+	// Sharing with a household takes at least an editor
+	_, err := calendarMuxService().Create(viewer.ID, "Mine", "", true, &household.ID, "")
+	assert.ErrorIs(t, err, ErrInsufficientRole)
+	_, err = calendarMuxService().Create(outsider.ID, "Mine", "", true, &household.ID, "")
+	assert.ErrorIs(t, err, ErrHouseholdNotFound)
+
+	calendarMux, err := calendarMuxService().Create(owner.ID, "Family", "", true, &household.ID, "")
+	require.NoError(t, err)
+
+	// Every member sees the mux, outsiders do not
+	for _, user := range []*models.User{owner, editor, viewer} {
+		muxes, err := calendarMuxService().List(user.ID)
+		require.NoError(t, err)
+		require.Len(t, muxes, 1)
+		assert.Equal(t, calendarMux.ID, muxes[0].ID)
+	}
+	muxes, err := calendarMuxService().List(outsider.ID)
+	require.NoError(t, err)
+	assert.Empty(t, muxes)
+	_, err = calendarMuxService().Get(calendarMux.ID, outsider.ID)
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+
+	// Viewers read, editors edit, owners delete
+	name := "Renamed"
+	_, err = calendarMuxService().Update(calendarMux.ID, viewer.ID, CalendarMuxUpdate{Name: &name}, nil, "")
+	assert.ErrorIs(t, err, ErrInsufficientRole)
+	updated, err := calendarMuxService().Update(calendarMux.ID, editor.ID, CalendarMuxUpdate{Name: &name}, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", updated.Name)
+
+	_, err = calendarMuxService().CreateCalendarSource(calendarMux.ID, viewer.ID, "https://example.com/a.ics", "A", true, models.VisibilityFull, "")
+	assert.ErrorIs(t, err, ErrInsufficientRole)
+	source, err := calendarMuxService().CreateCalendarSource(calendarMux.ID, editor.ID, "https://example.com/a.ics", "A", true, models.VisibilityFull, "")
+	require.NoError(t, err)
+	sources, err := calendarMuxService().GetCalendarSourcesByMux(calendarMux.ID, viewer.ID)
+	require.NoError(t, err)
+	require.Len(t, sources, 1)
+	assert.Equal(t, source.ID, sources[0].ID)
+
+	assert.ErrorIs(t, calendarMuxService().Delete(calendarMux.ID, editor.ID, ""), ErrInsufficientRole)
+	require.NoError(t, calendarMuxService().Delete(calendarMux.ID, owner.ID, ""))
+}
+
+func TestCalendarMux_CreatorLosesRightsWithMembership(t *testing.T) {
+	household, owner, editor, _ := setupHouseholdTestDB(t)
+	calendarMux, err := calendarMuxService().Create(editor.ID, "Family", "", true, &household.ID, "")
+	require.NoError(t, err)
+
+	// A creator demoted to viewer can no longer edit or delete the mux
+	_, err = UpdateHouseholdMemberRole(household.ID, owner.ID, editor.ID, models.HouseholdRoleViewer, "")
+	require.NoError(t, err)
+	name := "Renamed"
+	_, err = calendarMuxService().Update(calendarMux.ID, editor.ID, CalendarMuxUpdate{Name: &name}, nil, "")
+	assert.ErrorIs(t, err, ErrInsufficientRole)
+	assert.ErrorIs(t, calendarMuxService().Delete(calendarMux.ID, editor.ID, ""), ErrInsufficientRole)
+
+	// A removed creator no longer sees it at all
+	require.NoError(t, RemoveHouseholdMember(household.ID, owner.ID, editor.ID, ""))
+	_, err = calendarMuxService().Get(calendarMux.ID, editor.ID)
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+	_, err = calendarMuxService().CreateCalendarSource(calendarMux.ID, editor.ID, "https://example.com/a.ics", "A", true, models.VisibilityFull, "")
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+	assert.ErrorIs(t, calendarMuxService().Delete(calendarMux.ID, editor.ID, ""), ErrCalendarMuxNotFound)
+	muxes, err := calendarMuxService().List(editor.ID)
+	require.NoError(t, err)
+	assert.Empty(t, muxes)
+
+	// The household keeps the mux
+	_, err = calendarMuxService().Get(calendarMux.ID, owner.ID)
+	assert.NoError(t, err)
+}
+
+func TestUpdateCalendarMux_MovesBetweenHouseholds(t *testing.T) {
+	household, owner, editor, _ := setupHouseholdTestDB(t)
+	calendarMux, err := calendarMuxService().Create(owner.ID, "Family", "", true, &household.ID, "")
+	require.NoError(t, err)
+
+	// Moving takes an owner of the mux
+	none := uint(0)
+	_, err = calendarMuxService().Update(calendarMux.ID, editor.ID, CalendarMuxUpdate{HouseholdID: &none}, nil, "")
+	assert.ErrorIs(t, err, ErrInsufficientRole)
+
+	// ... who is at least an editor of the household it moves into
+	other, err := CreateHousehold(editor.ID, "Other", "")
+	require.NoError(t, err)
+	_, err = calendarMuxService().Update(calendarMux.ID, owner.ID, CalendarMuxUpdate{HouseholdID: &other.ID}, nil, "")
+	assert.ErrorIs(t, err, ErrHouseholdNotFound)
+
+	updated, err := calendarMuxService().Update(calendarMux.ID, owner.ID, CalendarMuxUpdate{HouseholdID: &none}, nil, "")
+	require.NoError(t, err)
+	assert.Nil(t, updated.HouseholdID)
+	_, err = calendarMuxService().Get(calendarMux.ID, editor.ID)
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+}
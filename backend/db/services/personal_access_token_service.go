@@ -0,0 +1,91 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrPersonalAccessTokenNotFound is returned when a token does not exist or belongs to another user
+	ErrPersonalAccessTokenNotFound = errors.New("personal access token not found")
+	// ErrPersonalAccessTokenInvalid is returned when authenticating with an unknown or expired token
+	ErrPersonalAccessTokenInvalid = errors.New("personal access token is invalid or expired")
+)
+
+// personalAccessTokenTouchInterval limits how often using a token writes its last use
+const personalAccessTokenTouchInterval = time.Minute
+
+// CreatePersonalAccessToken mints a token for a user with the given scopes, valid until expiresAt
+// or forever when it is nil. The token is returned only here; the database keeps its hash.
+func CreatePersonalAccessToken(userID uint, name string, scopes []string, expiresAt *time.Time) (*models.PersonalAccessToken, string, error) {
+	secret, err := models.NewFeedToken()
+	if err != nil {
+		return nil, "", err
+	}
+	token := models.PersonalAccessTokenPrefix + secret
+
+	accessToken := &models.PersonalAccessToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: models.HashToken(token),
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: expiresAt,
+	}
+	if err := db.DB.Create(accessToken).Error; err != nil {
+		return nil, "", err
+	}
+	return accessToken, token, nil
+}
+
+// GetPersonalAccessTokensByUser returns the personal access tokens of a user, newest first
+func GetPersonalAccessTokensByUser(userID uint) ([]models.PersonalAccessToken, error) {
+	var tokens []models.PersonalAccessToken
+	result := db.DB.Where("user_id = ?", userID).Order("id DESC").Find(&tokens)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return tokens, nil
+}
+
+// DeletePersonalAccessToken revokes one of a user's personal access tokens
+func DeletePersonalAccessToken(id, userID uint) error {
+	result := db.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&models.PersonalAccessToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPersonalAccessTokenNotFound
+	}
+	return nil
+}
+
+// AuthenticatePersonalAccessToken returns the personal access token a request presents and
+// records its use
+func AuthenticatePersonalAccessToken(token string, now time.Time) (*models.PersonalAccessToken, error) {
+	var accessToken models.PersonalAccessToken
+	result := db.DB.Where("token_hash = ?", models.HashToken(token)).First(&accessToken)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrPersonalAccessTokenInvalid
+		}
+		return nil, result.Error
+	}
+	if accessToken.ExpiresAt != nil && !now.Before(*accessToken.ExpiresAt) {
+		return nil, ErrPersonalAccessTokenInvalid
+	}
+
+	if accessToken.LastUsedAt == nil || now.Sub(*accessToken.LastUsedAt) >= personalAccessTokenTouchInterval {
+		err := db.DB.Model(&accessToken).UpdateColumn("last_used_at", now).Error
+		if err != nil {
+			return nil, err
+		}
+		accessToken.LastUsedAt = &now
+	}
+	return &accessToken, nil
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreatePersonalAccessToken(t *testing.T) {
+	setupTestDB(t)
+	user := createHouseholdUser(t, "owner")
+
+	accessToken, token, err := CreatePersonalAccessToken(user.ID, "Home Assistant", []string{models.ScopeEventsRead, models.ScopeMuxesManage}, nil)
+
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, models.PersonalAccessTokenPrefix))
+	assert.Equal(t, []string{models.ScopeEventsRead, models.ScopeMuxesManage}, accessToken.ScopeList())
+	// Only the hash is stored
+	assert.NotContains(t, accessToken.TokenHash, token)
+	assert.Equal(t, models.HashToken(token), accessToken.TokenHash)
+
+	tokens, err := GetPersonalAccessTokensByUser(user.ID)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.Equal(t, "Home Assistant", tokens[0].Name)
+}
+
+func TestAuthenticatePersonalAccessToken(t *testing.T) {
+	setupTestDB(t)
+	user := createHouseholdUser(t, "owner")
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+	accessToken, token, err := CreatePersonalAccessToken(user.ID, "Display", []string{models.ScopeEventsRead}, &expiresAt)
+	require.NoError(t, err)
+
+	authenticated, err := AuthenticatePersonalAccessToken(token, now)
+	require.NoError(t, err)
+	assert.Equal(t, accessToken.ID, authenticated.ID)
+	assert.Equal(t, user.ID, authenticated.UserID)
+	require.NotNil(t, authenticated.LastUsedAt)
+
+	// Uses within a minute are not written
+	_, err = AuthenticatePersonalAccessToken(token, now.Add(30*time.Second))
+	require.NoError(t, err)
+	require.NoError(t, db.DB.First(accessToken, accessToken.ID).Error)
+	assert.WithinDuration(t, now, *accessToken.LastUsedAt, time.Second)
+
+	_, err = AuthenticatePersonalAccessToken(token, now.Add(2*time.Minute))
+	require.NoError(t, err)
+	require.NoError(t, db.DB.First(accessToken, accessToken.ID).Error)
+	assert.WithinDuration(t, now.Add(2*time.Minute), *accessToken.LastUsedAt, time.Second)
+
+	_, err = AuthenticatePersonalAccessToken(token, expiresAt)
+	assert.ErrorIs(t, err, ErrPersonalAccessTokenInvalid)
+	_, err = AuthenticatePersonalAccessToken(models.PersonalAccessTokenPrefix+"unknown", now)
+	assert.ErrorIs(t, err, ErrPersonalAccessTokenInvalid)
+}
+
+func TestDeletePersonalAccessToken(t *testing.T) {
+	setupTestDB(t)
+	user := createHouseholdUser(t, "owner")
+	accessToken, token, err := CreatePersonalAccessToken(user.ID, "Display", []string{models.ScopeEventsRead}, nil)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, DeletePersonalAccessToken(accessToken.ID, user.ID+1), ErrPersonalAccessTokenNotFound)
+	require.NoError(t, DeletePersonalAccessToken(accessToken.ID, user.ID))
+	assert.ErrorIs(t, DeletePersonalAccessToken(accessToken.ID, user.ID), ErrPersonalAccessTokenNotFound)
+
+	_, err = AuthenticatePersonalAccessToken(token, time.Now())
+	assert.ErrorIs(t, err, ErrPersonalAccessTokenInvalid)
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrRefreshTokenInvalid is returned for unknown, expired and revoked refresh tokens
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	// ErrRefreshTokenReused is returned when a refresh token is presented after it was rotated.
+	// Its whole session has been revoked by then.
+	ErrRefreshTokenReused = errors.New("refresh token has already been used")
+)
+
+// newRefreshToken stores a new refresh token of a session and returns it with its plain value
+func newRefreshToken(tx *gorm.DB, userID, sessionID uint, expiresAt time.Time) (*models.RefreshToken, string, error) {
+	token, hash, err := models.NewHashedToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	refreshToken := &models.RefreshToken{
+		UserID:    userID,
+		TokenHash: hash,
+		SessionID: sessionID,
+		ExpiresAt: expiresAt,
+	}
+	if err := tx.Create(refreshToken).Error; err != nil {
+		return nil, "", err
+	}
+	return refreshToken, token, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for its successor in the same session, valid until
+// expiresAt, and extends the session accordingly. A token can be exchanged once; presenting it
+// again means it leaked, so the whole session is revoked and ErrRefreshTokenReused returned along
+// with the presented token.
+func RotateRefreshToken(token string, now, expiresAt time.Time) (*models.RefreshToken, string, error) {
+	var current models.RefreshToken
+	result := db.DB.Where("token_hash = ?", models.HashToken(token)).First(&current)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, "", ErrRefreshTokenInvalid
+		}
+		return nil, "", result.Error
+	}
+	if current.RevokedAt != nil || !now.Before(current.ExpiresAt) {
+		return nil, "", ErrRefreshTokenInvalid
+	}
+
+	var next *models.RefreshToken
+	var nextToken string
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// Claim the token, so that of two concurrent exchanges only one succeeds
+		result := tx.Model(&current).
+			Where("used_at IS NULL AND revoked_at IS NULL").
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		var err error
+		next, nextToken, err = newRefreshToken(tx, current.UserID, current.SessionID, expiresAt)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.Session{}).
+			Where("id = ?", current.SessionID).
+			Updates(map[string]interface{}{"last_used_at": now, "expires_at": expiresAt}).Error
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			return revokeSession(tx, current.SessionID, now)
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		return &current, "", ErrRefreshTokenReused
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return next, nextToken, nil
+}
+
+// RevokeRefreshToken signs out the session a refresh token belongs to and returns its ID
+func RevokeRefreshToken(token string, now time.Time) (uint, error) {
+	var refreshToken models.RefreshToken
+	result := db.DB.Where("token_hash = ?", models.HashToken(token)).First(&refreshToken)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return 0, ErrRefreshTokenInvalid
+		}
+		return 0, result.Error
+	}
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		return revokeSession(tx, refreshToken.SessionID, now)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return refreshToken.SessionID, nil
+}
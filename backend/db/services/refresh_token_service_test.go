@@ -0,0 +1,120 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateSession_StoresTokenHash(t *testing.T) {
+	setupTestDB(t)
+	user := createHouseholdUser(t, "user")
+	now := time.Now()
+
+	session, token, err := CreateSession(user.ID, "Firefox", "192.0.2.1", now, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, token, 64)
+	assert.Equal(t, user.ID, session.UserID)
+
+	var refreshToken models.RefreshToken
+	require.NoError(t, db.DB.Where("session_id = ?", session.ID).First(&refreshToken).Error)
+	assert.Equal(t, models.HashToken(token), refreshToken.TokenHash)
+	assert.Equal(t, user.ID, refreshToken.UserID)
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	setupTestDB(t)
+	user := createHouseholdUser(t, "user")
+	now := time.Now()
+	session, token, err := CreateSession(user.ID, "Firefox", "192.0.2.1", now, now.Add(time.Hour))
+	require.NoError(t, err)
+
+	later := now.Add(time.Minute)
+	next, nextToken, err := RotateRefreshToken(token, later, later.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.NotEqual(t, token, nextToken)
+	assert.Equal(t, user.ID, next.UserID)
+	assert.Equal(t, session.ID, next.SessionID)
+	assert.WithinDuration(t, later.Add(2*time.Hour), next.ExpiresAt, time.Second)
+
+	// The session is extended along with it
+	session, err = GetSession(session.ID)
+	require.NoError(t, err)
+	assert.WithinDuration(t, later, session.LastUsedAt, time.Second)
+	assert.WithinDuration(t, later.Add(2*time.Hour), session.ExpiresAt, time.Second)
+
+	// The successor can be rotated in turn
+	_, _, err = RotateRefreshToken(nextToken, now, now.Add(2*time.Hour))
+	assert.NoError(t, err)
+}
+
+func TestRotateRefreshToken_ReuseRevokesSession(t *testing.T) {
+	setupTestDB(t)
+	user := createHouseholdUser(t, "user")
+	now := time.Now()
+	session, token, err := CreateSession(user.ID, "Firefox", "192.0.2.1", now, now.Add(time.Hour))
+	require.NoError(t, err)
+	_, otherSignIn, err := CreateSession(user.ID, "Safari", "192.0.2.2", now, now.Add(time.Hour))
+	require.NoError(t, err)
+
+	_, nextToken, err := RotateRefreshToken(token, now, now.Add(time.Hour))
+	require.NoError(t, err)
+
+	// Replaying the rotated token revokes its successor too
+	reused, _, err := RotateRefreshToken(token, now, now.Add(time.Hour))
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	require.NotNil(t, reused)
+	assert.Equal(t, session.ID, reused.SessionID)
+	_, _, err = RotateRefreshToken(nextToken, now, now.Add(time.Hour))
+	assert.ErrorIs(t, err, ErrRefreshTokenInvalid)
+	session, err = GetSession(session.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, session.RevokedAt)
+
+	// Other sign-ins of the same user are not affected
+	_, _, err = RotateRefreshToken(otherSignIn, now, now.Add(time.Hour))
+	assert.NoError(t, err)
+}
+
+func TestRotateRefreshToken_Invalid(t *testing.T) {
+	setupTestDB(t)
+	user := createHouseholdUser(t, "user")
+	now := time.Now()
+	_, token, err := CreateSession(user.ID, "", "", now, now.Add(time.Hour))
+	require.NoError(t, err)
+
+	_, _, err = RotateRefreshToken("does-not-exist", now, now.Add(time.Hour))
+	assert.ErrorIs(t, err, ErrRefreshTokenInvalid)
+
+	_, _, err = RotateRefreshToken(token, now.Add(time.Hour), now.Add(2*time.Hour))
+	assert.ErrorIs(t, err, ErrRefreshTokenInvalid)
+
+	var count int64
+	db.DB.Model(&models.RefreshToken{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestRevokeRefreshToken(t *testing.T) {
+	setupTestDB(t)
+	user := createHouseholdUser(t, "user")
+	now := time.Now()
+	_, token, err := CreateSession(user.ID, "", "", now, now.Add(time.Hour))
+	require.NoError(t, err)
+	_, nextToken, err := RotateRefreshToken(token, now, now.Add(time.Hour))
+	require.NoError(t, err)
+
+	// Signing out with an old token of the session also ends the current one
+	sessionID, err := RevokeRefreshToken(token, now)
+	require.NoError(t, err)
+	assert.NotZero(t, sessionID)
+	_, _, err = RotateRefreshToken(nextToken, now, now.Add(time.Hour))
+	assert.ErrorIs(t, err, ErrRefreshTokenInvalid)
+
+	_, err = RevokeRefreshToken("does-not-exist", now)
+	assert.ErrorIs(t, err, ErrRefreshTokenInvalid)
+}
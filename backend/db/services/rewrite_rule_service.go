@@ -0,0 +1,200 @@
+package services
+
+import (
+	"errors"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrRewriteRuleNotFound is returned when a rewrite rule does not exist on the given calendar source
+var ErrRewriteRuleNotFound = errors.New("rewrite rule not found")
+
+// loadRewriteRules returns the rules of a calendar source in the order they run
+func loadRewriteRules(tx *gorm.DB, calendarSourceID uint) ([]models.RewriteRule, error) {
+	var rules []models.RewriteRule
+	result := tx.Where("calendar_source_id = ?", calendarSourceID).Order("position, id").Find(&rules)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return rules, nil
+}
+
+// clampPosition turns a requested position into an index of a list of n rules, defaulting to the end
+func clampPosition(position *int, n int) int {
+	if position == nil || *position > n {
+		return n
+	}
+	if *position < 0 {
+		return 0
+	}
+	return *position
+}
+
+// insertRewriteRule returns rules with rule inserted at index
+func insertRewriteRule(rules []models.RewriteRule, rule models.RewriteRule, index int) []models.RewriteRule {
+	ordered := make([]models.RewriteRule, 0, len(rules)+1)
+	ordered = append(ordered, rules[:index]...)
+	ordered = append(ordered, rule)
+	return append(ordered, rules[index:]...)
+}
+
+// saveRewriteRuleOrder renumbers rules so their positions follow the slice order without gaps
+func saveRewriteRuleOrder(tx *gorm.DB, rules []models.RewriteRule) error {
+	for i := range rules {
+		if rules[i].Position == i {
+			continue
+		}
+		if err := tx.Model(&rules[i]).Update("position", i).Error; err != nil {
+			return err
+		}
+		rules[i].Position = i
+	}
+	return nil
+}
+
+// GetRewriteRules returns the rules of a source in a calendar mux the user may see, in the order they run
+func (s *CalendarMuxService) GetRewriteRules(calendarSourceID, calendarMuxID, userID uint) ([]models.RewriteRule, error) {
+	if _, _, err := s.authorizeCalendarSource(calendarSourceID, calendarMuxID, userID, models.HouseholdRoleViewer); err != nil {
+		return nil, err
+	}
+	return loadRewriteRules(db.DB, calendarSourceID)
+}
+
+// CreateRewriteRule adds a rule to a source in a calendar mux the user may edit. The rule is inserted
+// at position, moving later rules down, or appended when position is nil or past the end.
+func (s *CalendarMuxService) CreateRewriteRule(calendarSourceID, calendarMuxID, userID uint, action, pattern, value string, position *int, requestID string) (*models.RewriteRule, error) {
+	_, calendarMux, err := s.authorizeCalendarSource(calendarSourceID, calendarMuxID, userID, models.HouseholdRoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	rule := &models.RewriteRule{
+		CalendarSourceID: calendarSourceID,
+		Action:           action,
+		Pattern:          pattern,
+		Value:            value,
+	}
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		rules, err := loadRewriteRules(tx, calendarSourceID)
+		if err != nil {
+			return err
+		}
+		rule.Position = clampPosition(position, len(rules))
+		if err := tx.Create(rule).Error; err != nil {
+			return err
+		}
+		if err := saveRewriteRuleOrder(tx, insertRewriteRule(rules, *rule, rule.Position)); err != nil {
+			return err
+		}
+		return recordAuditLog(tx, userID, models.AuditActionCreate, models.AuditEntityRewriteRule, rule.ID,
+			calendarMux.HouseholdID, nil, rewriteRuleAuditFields(rule), requestID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// UpdateRewriteRule replaces a rule of a source in a calendar mux the user may edit. A non-nil
+// position moves the rule there; otherwise it keeps its place.
+func (s *CalendarMuxService) UpdateRewriteRule(id, calendarSourceID, calendarMuxID, userID uint, action, pattern, value string, position *int, requestID string) (*models.RewriteRule, error) {
+	_, calendarMux, err := s.authorizeCalendarSource(calendarSourceID, calendarMuxID, userID, models.HouseholdRoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	var rule models.RewriteRule
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		rules, err := loadRewriteRules(tx, calendarSourceID)
+		if err != nil {
+			return err
+		}
+		current := -1
+		for i := range rules {
+			if rules[i].ID == id {
+				current = i
+				break
+			}
+		}
+		if current < 0 {
+			return ErrRewriteRuleNotFound
+		}
+
+		rule = rules[current]
+		before := rewriteRuleAuditFields(&rule)
+		others := append(rules[:current:current], rules[current+1:]...)
+		index := current
+		if position != nil {
+			index = clampPosition(position, len(others))
+		}
+
+		err = tx.Model(&rule).Updates(map[string]interface{}{
+			"action":   action,
+			"pattern":  pattern,
+			"value":    value,
+			"position": index,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := saveRewriteRuleOrder(tx, insertRewriteRule(others, rule, index)); err != nil {
+			return err
+		}
+		if err := tx.First(&rule, rule.ID).Error; err != nil {
+			return err
+		}
+		return recordAuditLog(tx, userID, models.AuditActionUpdate, models.AuditEntityRewriteRule, rule.ID,
+			calendarMux.HouseholdID, before, rewriteRuleAuditFields(&rule), requestID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// DeleteRewriteRule removes a rule from a source in a calendar mux the user may edit
+func (s *CalendarMuxService) DeleteRewriteRule(id, calendarSourceID, calendarMuxID, userID uint, requestID string) error {
+	_, calendarMux, err := s.authorizeCalendarSource(calendarSourceID, calendarMuxID, userID, models.HouseholdRoleEditor)
+	if err != nil {
+		return err
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		rules, err := loadRewriteRules(tx, calendarSourceID)
+		if err != nil {
+			return err
+		}
+		for i := range rules {
+			if rules[i].ID != id {
+				continue
+			}
+			rule := rules[i]
+			if err := tx.Delete(&rule).Error; err != nil {
+				return err
+			}
+			if err := saveRewriteRuleOrder(tx, append(rules[:i:i], rules[i+1:]...)); err != nil {
+				return err
+			}
+			return recordAuditLog(tx, userID, models.AuditActionDelete, models.AuditEntityRewriteRule, rule.ID,
+				calendarMux.HouseholdID, rewriteRuleAuditFields(&rule), nil, requestID)
+		}
+		return ErrRewriteRuleNotFound
+	})
+}
+
+// GetRewriteRulesBySources returns the rules of the given sources without an ownership check,
+// grouped by source and in the order they run. It is used when building the merged outputs.
+func GetRewriteRulesBySources(sourceIDs []uint) ([]models.RewriteRule, error) {
+	var rules []models.RewriteRule
+	if len(sourceIDs) == 0 {
+		return rules, nil
+	}
+	result := db.DB.Where("calendar_source_id IN ?", sourceIDs).Order("calendar_source_id, position, id").Find(&rules)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return rules, nil
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"testing"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupRewriteRuleTestDB(t *testing.T) (*models.User, *models.CalendarMux, *models.CalendarSource) {
+	user, calendarMux := setupCalendarSourceTestDB(t)
+
+	calendarSource := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/a.ics", Label: "A", Enabled: true}
+	require.NoError(t, db.DB.Create(calendarSource).Error)
+
+	return user, calendarMux, calendarSource
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+// ruleValues lists the values of the rules of a source in the order they run
+func ruleValues(t *testing.T, calendarSourceID uint) []string {
+	rules, err := GetRewriteRulesBySources([]uint{calendarSourceID})
+	require.NoError(t, err)
+	values := make([]string, 0, len(rules))
+	for i, rule := range rules {
+		assert.Equal(t, i, rule.Position)
+		values = append(values, rule.Value)
+	}
+	return values
+}
+
+func TestCreateRewriteRule(t *testing.T) {
+	user, calendarMux, calendarSource := setupRewriteRuleTestDB(t)
+
+	rule, err := calendarMuxService().CreateRewriteRule(calendarSource.ID, calendarMux.ID, user.ID, models.RewriteActionPrefix, "", "a", nil, "")
+	require.NoError(t, err)
+	assert.NotZero(t, rule.ID)
+	assert.Equal(t, 0, rule.Position)
+
+	_, err = calendarMuxService().CreateRewriteRule(calendarSource.ID, calendarMux.ID, user.ID, models.RewriteActionPrefix, "", "c", intPtr(10), "")
+	require.NoError(t, err)
+	rule, err = calendarMuxService().CreateRewriteRule(calendarSource.ID, calendarMux.ID, user.ID, models.RewriteActionPrefix, "", "b", intPtr(1), "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, rule.Position)
+
+	assert.Equal(t, []string{"a", "b", "c"}, ruleValues(t, calendarSource.ID))
+}
+
+func TestCreateRewriteRule_Errors(t *testing.T) {
+	user, calendarMux, calendarSource := setupRewriteRuleTestDB(t)
+	otherUser := createOtherUser(t)
+
+	_, err := calendarMuxService().CreateRewriteRule(calendarSource.ID, calendarMux.ID, otherUser.ID, models.RewriteActionDrop, "x", "", nil, "")
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+
+	_, err = calendarMuxService().CreateRewriteRule(9999, calendarMux.ID, user.ID, models.RewriteActionDrop, "x", "", nil, "")
+	assert.ErrorIs(t, err, ErrCalendarSourceNotFound)
+
+	assert.Empty(t, ruleValues(t, calendarSource.ID))
+}
+
+func TestGetRewriteRules(t *testing.T) {
+	user, calendarMux, calendarSource := setupRewriteRuleTestDB(t)
+	otherUser := createOtherUser(t)
+
+	_, err := calendarMuxService().CreateRewriteRule(calendarSource.ID, calendarMux.ID, user.ID, models.RewriteActionDrop, "Lunch menu", "", nil, "")
+	require.NoError(t, err)
+
+	rules, err := calendarMuxService().GetRewriteRules(calendarSource.ID, calendarMux.ID, user.ID)
+	assert.NoError(t, err)
+	require.Len(t, rules, 1)
+	assert.Equal(t, models.RewriteActionDrop, rules[0].Action)
+	assert.Equal(t, "Lunch menu", rules[0].Pattern)
+
+	_, err = calendarMuxService().GetRewriteRules(calendarSource.ID, calendarMux.ID, otherUser.ID)
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+}
+
+func TestUpdateRewriteRule(t *testing.T) {
+	user, calendarMux, calendarSource := setupRewriteRuleTestDB(t)
+
+	var ids []uint
+	for _, value := range []string{"a", "b", "c"} {
+		rule, err := calendarMuxService().CreateRewriteRule(calendarSource.ID, calendarMux.ID, user.ID, models.RewriteActionPrefix, "", value, nil, "")
+		require.NoError(t, err)
+		ids = append(ids, rule.ID)
+	}
+
+	// Without a position the rule keeps its place
+	rule, err := calendarMuxService().UpdateRewriteRule(ids[1], calendarSource.ID, calendarMux.ID, user.ID, models.RewriteActionReplace, "^Practice$", "B", nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, models.RewriteActionReplace, rule.Action)
+	assert.Equal(t, "^Practice$", rule.Pattern)
+	assert.Equal(t, 1, rule.Position)
+	assert.Equal(t, []string{"a", "B", "c"}, ruleValues(t, calendarSource.ID))
+
+	rule, err = calendarMuxService().UpdateRewriteRule(ids[0], calendarSource.ID, calendarMux.ID, user.ID, models.RewriteActionPrefix, "", "A", intPtr(2), "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, rule.Position)
+	assert.Equal(t, []string{"B", "c", "A"}, ruleValues(t, calendarSource.ID))
+
+	_, err = calendarMuxService().UpdateRewriteRule(ids[2], calendarSource.ID, calendarMux.ID, user.ID, models.RewriteActionPrefix, "", "C", intPtr(0), "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"C", "B", "A"}, ruleValues(t, calendarSource.ID))
+}
+
+func TestUpdateRewriteRule_Errors(t *testing.T) {
+	user, calendarMux, calendarSource := setupRewriteRuleTestDB(t)
+	otherUser := createOtherUser(t)
+
+	rule, err := calendarMuxService().CreateRewriteRule(calendarSource.ID, calendarMux.ID, user.ID, models.RewriteActionPrefix, "", "a", nil, "")
+	require.NoError(t, err)
+
+	_, err = calendarMuxService().UpdateRewriteRule(rule.ID, calendarSource.ID, calendarMux.ID, otherUser.ID, models.RewriteActionPrefix, "", "b", nil, "")
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+
+	_, err = calendarMuxService().UpdateRewriteRule(9999, calendarSource.ID, calendarMux.ID, user.ID, models.RewriteActionPrefix, "", "b", nil, "")
+	assert.ErrorIs(t, err, ErrRewriteRuleNotFound)
+
+	// A rule of another source is not found through this one
+	other := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/b.ics", Label: "B", Enabled: true}
+	require.NoError(t, db.DB.Create(other).Error)
+	_, err = calendarMuxService().UpdateRewriteRule(rule.ID, other.ID, calendarMux.ID, user.ID, models.RewriteActionPrefix, "", "b", nil, "")
+	assert.ErrorIs(t, err, ErrRewriteRuleNotFound)
+
+	assert.Equal(t, []string{"a"}, ruleValues(t, calendarSource.ID))
+}
+
+func TestDeleteRewriteRule(t *testing.T) {
+	user, calendarMux, calendarSource := setupRewriteRuleTestDB(t)
+	otherUser := createOtherUser(t)
+
+	var ids []uint
+	for _, value := range []string{"a", "b", "c"} {
+		rule, err := calendarMuxService().CreateRewriteRule(calendarSource.ID, calendarMux.ID, user.ID, models.RewriteActionPrefix, "", value, nil, "")
+		require.NoError(t, err)
+		ids = append(ids, rule.ID)
+	}
+
+	err := calendarMuxService().DeleteRewriteRule(ids[1], calendarSource.ID, calendarMux.ID, otherUser.ID, "")
+	assert.ErrorIs(t, err, ErrCalendarMuxNotFound)
+
+	err = calendarMuxService().DeleteRewriteRule(ids[1], calendarSource.ID, calendarMux.ID, user.ID, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "c"}, ruleValues(t, calendarSource.ID))
+
+	err = calendarMuxService().DeleteRewriteRule(ids[1], calendarSource.ID, calendarMux.ID, user.ID, "")
+	assert.ErrorIs(t, err, ErrRewriteRuleNotFound)
+}
+
+func TestGetRewriteRulesBySources(t *testing.T) {
+	user, calendarMux, calendarSource := setupRewriteRuleTestDB(t)
+
+	other := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/b.ics", Label: "B", Enabled: true}
+	require.NoError(t, db.DB.Create(other).Error)
+
+	_, err := calendarMuxService().CreateRewriteRule(other.ID, calendarMux.ID, user.ID, models.RewriteActionPrefix, "", "b", nil, "")
+	require.NoError(t, err)
+	_, err = calendarMuxService().CreateRewriteRule(calendarSource.ID, calendarMux.ID, user.ID, models.RewriteActionPrefix, "", "a2", nil, "")
+	require.NoError(t, err)
+	_, err = calendarMuxService().CreateRewriteRule(calendarSource.ID, calendarMux.ID, user.ID, models.RewriteActionPrefix, "", "a1", intPtr(0), "")
+	require.NoError(t, err)
+
+	rules, err := GetRewriteRulesBySources([]uint{calendarSource.ID, other.ID})
+	assert.NoError(t, err)
+	values := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		values = append(values, rule.Value)
+	}
+	assert.Equal(t, []string{"a1", "a2", "b"}, values)
+
+	rules, err = GetRewriteRulesBySources(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, rules)
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrSessionNotFound is returned when a session does not exist or belongs to another user
+var ErrSessionNotFound = errors.New("session not found")
+
+// maxUserAgentLength is the size of the user_agent column
+const maxUserAgentLength = 500
+
+// revokeSession revokes a session together with its refresh tokens
+func revokeSession(tx *gorm.DB, sessionID uint, now time.Time) error {
+	err := tx.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", now).Error
+	if err != nil {
+		return err
+	}
+	return tx.Model(&models.RefreshToken{}).
+		Where("session_id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", now).Error
+}
+
+// CreateSession records a sign-in of a user and issues its first refresh token, valid until
+// expiresAt. The plain token is returned only here; the database keeps its hash.
+func CreateSession(userID uint, userAgent, ipAddress string, now, expiresAt time.Time) (*models.Session, string, error) {
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	session := &models.Session{
+		UserID:     userID,
+		UserAgent:  userAgent,
+		IPAddress:  ipAddress,
+		LastUsedAt: now,
+		ExpiresAt:  expiresAt,
+	}
+	var token string
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(session).Error; err != nil {
+			return err
+		}
+		var err error
+		_, token, err = newRefreshToken(tx, userID, session.ID, expiresAt)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return session, token, nil
+}
+
+// GetSession returns a session without an ownership check. It is used when authenticating requests.
+func GetSession(id uint) (*models.Session, error) {
+	var session models.Session
+	result := db.DB.First(&session, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, result.Error
+	}
+	return &session, nil
+}
+
+// GetActiveSessionsByUser returns the sessions of a user that are neither revoked nor expired,
+// most recently used first
+func GetActiveSessionsByUser(userID uint, now time.Time) ([]models.Session, error) {
+	var sessions []models.Session
+	result := db.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_used_at DESC, id DESC").
+		Find(&sessions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return sessions, nil
+}
+
+// TouchSession records that a session was used
+func TouchSession(id uint, now time.Time) error {
+	return db.DB.Model(&models.Session{}).Where("id = ?", id).Update("last_used_at", now).Error
+}
+
+// RevokeSession signs a user out of one of their sessions. Revoking twice is harmless.
+func RevokeSession(id, userID uint, now time.Time) error {
+	var session models.Session
+	result := db.DB.Where("id = ? AND user_id = ?", id, userID).First(&session)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		return result.Error
+	}
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		return revokeSession(tx, session.ID, now)
+	})
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateSession_TruncatesUserAgent(t *testing.T) {
+	setupTestDB(t)
+	user := createHouseholdUser(t, "user")
+	now := time.Now()
+
+	session, _, err := CreateSession(user.ID, strings.Repeat("a", 600), "192.0.2.1", now, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, session.UserAgent, maxUserAgentLength)
+}
+
+func TestGetActiveSessionsByUser(t *testing.T) {
+	setupTestDB(t)
+	user := createHouseholdUser(t, "user")
+	other := createHouseholdUser(t, "other")
+	now := time.Now()
+
+	older, _, err := CreateSession(user.ID, "Firefox", "192.0.2.1", now.Add(-time.Hour), now.Add(time.Hour))
+	require.NoError(t, err)
+	newer, _, err := CreateSession(user.ID, "Safari", "192.0.2.2", now, now.Add(time.Hour))
+	require.NoError(t, err)
+	_, _, err = CreateSession(user.ID, "Expired", "192.0.2.3", now.Add(-2*time.Hour), now.Add(-time.Hour))
+	require.NoError(t, err)
+	revoked, _, err := CreateSession(user.ID, "Revoked", "192.0.2.4", now, now.Add(time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, RevokeSession(revoked.ID, user.ID, now))
+	_, _, err = CreateSession(other.ID, "Other", "192.0.2.5", now, now.Add(time.Hour))
+	require.NoError(t, err)
+
+	sessions, err := GetActiveSessionsByUser(user.ID, now)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal(t, newer.ID, sessions[0].ID)
+	assert.Equal(t, older.ID, sessions[1].ID)
+	assert.Equal(t, "Firefox", sessions[1].UserAgent)
+	assert.Equal(t, "192.0.2.1", sessions[1].IPAddress)
+}
+
+func TestRevokeSession(t *testing.T) {
+	setupTestDB(t)
+	user := createHouseholdUser(t, "user")
+	other := createHouseholdUser(t, "other")
+	now := time.Now()
+	session, token, err := CreateSession(user.ID, "Firefox", "192.0.2.1", now, now.Add(time.Hour))
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, RevokeSession(session.ID, other.ID, now), ErrSessionNotFound)
+	assert.ErrorIs(t, RevokeSession(9999, user.ID, now), ErrSessionNotFound)
+
+	require.NoError(t, RevokeSession(session.ID, user.ID, now))
+	require.NoError(t, RevokeSession(session.ID, user.ID, now))
+
+	// The session's refresh tokens stop working
+	_, _, err = RotateRefreshToken(token, now, now.Add(time.Hour))
+	assert.ErrorIs(t, err, ErrRefreshTokenInvalid)
+	session, err = GetSession(session.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, session.RevokedAt)
+}
+
+func TestTouchSession(t *testing.T) {
+	setupTestDB(t)
+	user := createHouseholdUser(t, "user")
+	now := time.Now()
+	session, _, err := CreateSession(user.ID, "Firefox", "192.0.2.1", now, now.Add(time.Hour))
+	require.NoError(t, err)
+
+	require.NoError(t, TouchSession(session.ID, now.Add(time.Minute)))
+	session, err = GetSession(session.ID)
+	require.NoError(t, err)
+	assert.WithinDuration(t, now.Add(time.Minute), session.LastUsedAt, time.Second)
+
+	_, err = GetSession(9999)
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+}
@@ -0,0 +1,291 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrIdentityNotFound is returned when an identity does not exist or belongs to another user
+	ErrIdentityNotFound = errors.New("identity not found")
+	// ErrLastIdentity is returned when unlinking the only identity a user can sign in with
+	ErrLastIdentity = errors.New("cannot unlink the last identity")
+	// ErrIdentityLinkInvalid is returned for unknown, expired and used identity link tokens
+	ErrIdentityLinkInvalid = errors.New("identity link is invalid or expired")
+	// ErrIdentityLinkedElsewhere is returned when linking an identity that belongs to another
+	// account without asking to merge it
+	ErrIdentityLinkedElsewhere = errors.New("identity belongs to another account")
+	// ErrIdentityMergeNotPending is returned when confirming a merge on a link that has none
+	ErrIdentityMergeNotPending = errors.New("identity link has no merge awaiting confirmation")
+)
+
+// GetUserIdentities returns the identities a user can sign in with, oldest first
+func GetUserIdentities(userID uint) ([]models.UserIdentity, error) {
+	var identities []models.UserIdentity
+	result := db.DB.Where("user_id = ?", userID).Order("id").Find(&identities)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return identities, nil
+}
+
+// UnlinkIdentity removes one of a user's identities. The last one stays, so the user can still
+// sign in.
+func UnlinkIdentity(id, userID uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var identity models.UserIdentity
+		result := tx.Where("id = ? AND user_id = ?", id, userID).First(&identity)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return ErrIdentityNotFound
+			}
+			return result.Error
+		}
+
+		var count int64
+		if err := tx.Model(&models.UserIdentity{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count <= 1 {
+			return ErrLastIdentity
+		}
+		return tx.Delete(&identity).Error
+	})
+}
+
+// CreateIdentityLink lets a user attach the next identity they sign in with, until expiresAt, in
+// the sign-in session that asked for it. The token is returned only here; the link just keeps
+// its hash.
+func CreateIdentityLink(userID, sessionID uint, merge bool, expiresAt time.Time) (*models.IdentityLink, string, error) {
+	token, hash, err := models.NewHashedToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	link := &models.IdentityLink{
+		UserID:    userID,
+		SessionID: &sessionID,
+		TokenHash: hash,
+		Merge:     merge,
+		ExpiresAt: expiresAt,
+	}
+	if err := db.DB.Create(link).Error; err != nil {
+		return nil, "", err
+	}
+	return link, token, nil
+}
+
+// GetIdentityLink returns one of a user's identity links, with the account awaiting confirmation
+// to be merged in, if any
+func GetIdentityLink(id, userID uint) (*models.IdentityLink, error) {
+	var link models.IdentityLink
+	result := db.DB.Preload("MergeUser").Where("id = ? AND user_id = ?", id, userID).First(&link)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrIdentityLinkInvalid
+		}
+		return nil, result.Error
+	}
+	return &link, nil
+}
+
+// LinkIdentity attaches a provider identity to the user who created a link token and returns
+// that user. The link only works while the session that requested it is active. An identity of
+// another account is only taken over when the link asked for a merge; the link then records that
+// account for ConfirmIdentityMerge and nothing is merged yet. Otherwise ErrIdentityLinkedElsewhere
+// is returned and the link stays usable.
+func LinkIdentity(token, provider, subject, email string, now time.Time) (*models.User, error) {
+	if token == "" {
+		return nil, ErrIdentityLinkInvalid
+	}
+
+	var user models.User
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var link models.IdentityLink
+		result := tx.Preload("Session").Where("token_hash = ?", models.HashToken(token)).First(&link)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return ErrIdentityLinkInvalid
+			}
+			return result.Error
+		}
+		if link.UsedAt != nil || !now.Before(link.ExpiresAt) {
+			return ErrIdentityLinkInvalid
+		}
+		// The session that asked for the link must still be signed in as its creator
+		session := link.Session
+		if session == nil || session.UserID != link.UserID || session.RevokedAt != nil || !now.Before(session.ExpiresAt) {
+			return ErrIdentityLinkInvalid
+		}
+
+		// Claim the link, so that of two concurrent sign-ins only one uses it
+		result = tx.Model(&link).Where("used_at IS NULL").Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrIdentityLinkInvalid
+		}
+
+		if err := tx.First(&user, link.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrIdentityLinkInvalid
+			}
+			return err
+		}
+
+		var identity models.UserIdentity
+		result = tx.Where("provider = ? AND subject = ?", provider, subject).Limit(1).Find(&identity)
+		if result.Error != nil {
+			return result.Error
+		}
+		switch {
+		case result.RowsAffected == 0:
+			return tx.Create(&models.UserIdentity{UserID: user.ID, Provider: provider, Subject: subject, Email: email}).Error
+		case identity.UserID == user.ID:
+			return nil
+		case !link.Merge:
+			return ErrIdentityLinkedElsewhere
+		default:
+			return tx.Model(&link).Update("merge_user_id", identity.UserID).Error
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ConfirmIdentityMerge merges the account a user's identity link found into the user, before
+// the link expires. The IDs of the sessions ended by the merge are returned.
+func ConfirmIdentityMerge(id, userID uint, now time.Time, requestID string) ([]uint, error) {
+	var revokedSessionIDs []uint
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var link models.IdentityLink
+		result := tx.Where("id = ? AND user_id = ?", id, userID).First(&link)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return ErrIdentityLinkInvalid
+			}
+			return result.Error
+		}
+		if !now.Before(link.ExpiresAt) {
+			return ErrIdentityLinkInvalid
+		}
+		if link.MergeUserID == nil {
+			return ErrIdentityMergeNotPending
+		}
+
+		// Clear the pending merge first, so that a second confirmation finds nothing to merge
+		mergeUserID := *link.MergeUserID
+		result = tx.Model(&models.IdentityLink{}).Where("id = ? AND merge_user_id = ?", link.ID, mergeUserID).Update("merge_user_id", nil)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrIdentityMergeNotPending
+		}
+
+		var err error
+		revokedSessionIDs, err = mergeUsers(tx, userID, mergeUserID, now, requestID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return revokedSessionIDs, nil
+}
+
+// mergeUsers moves everything of the source user over to the target user and deletes the source.
+// Household roles keep the higher of the two, and the membership changes are audited as made by
+// the target. The source's sessions are revoked and returned.
+func mergeUsers(tx *gorm.DB, targetID, sourceID uint, now time.Time, requestID string) ([]uint, error) {
+	reassign := []struct {
+		model  interface{}
+		column string
+	}{
+		{&models.UserIdentity{}, "user_id"},
+		{&models.PersonalAccessToken{}, "user_id"},
+		{&models.CalendarMux{}, "created_by_id"},
+		{&models.Household{}, "created_by_id"},
+		{&models.HouseholdInvite{}, "created_by_id"},
+		{&models.HouseholdInvite{}, "accepted_by_id"},
+	}
+	for _, r := range reassign {
+		// Include soft-deleted rows, so restoring them later finds the right owner
+		err := tx.Unscoped().Model(r.model).Where(r.column+" = ?", sourceID).Update(r.column, targetID).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var memberships []models.HouseholdMember
+	if err := tx.Where("user_id = ?", sourceID).Find(&memberships).Error; err != nil {
+		return nil, err
+	}
+	for _, membership := range memberships {
+		before := householdMemberAuditFields(&membership)
+		var target models.HouseholdMember
+		result := tx.Where("household_id = ? AND user_id = ?", membership.HouseholdID, targetID).Limit(1).Find(&target)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			if err := tx.Model(&membership).Update("user_id", targetID).Error; err != nil {
+				return nil, err
+			}
+			err := recordAuditLog(tx, targetID, models.AuditActionUpdate, models.AuditEntityHouseholdMember, membership.ID,
+				&membership.HouseholdID, before, householdMemberAuditFields(&membership), requestID)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !roleAtLeast(target.Role, membership.Role) {
+			targetBefore := householdMemberAuditFields(&target)
+			if err := tx.Model(&target).Update("role", membership.Role).Error; err != nil {
+				return nil, err
+			}
+			err := recordAuditLog(tx, targetID, models.AuditActionUpdate, models.AuditEntityHouseholdMember, target.ID,
+				&target.HouseholdID, targetBefore, householdMemberAuditFields(&target), requestID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := tx.Delete(&membership).Error; err != nil {
+			return nil, err
+		}
+		err := recordAuditLog(tx, targetID, models.AuditActionDelete, models.AuditEntityHouseholdMember, membership.ID,
+			&membership.HouseholdID, before, nil, requestID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var sessionIDs []uint
+	err := tx.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", sourceID).Pluck("id", &sessionIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, sessionID := range sessionIDs {
+		if err := revokeSession(tx, sessionID, now); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Where("user_id = ?", sourceID).Delete(&models.IdentityLink{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("user_id = ?", sourceID).Delete(&models.AuthorizationCode{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Delete(&models.User{}, sourceID).Error; err != nil {
+		return nil, err
+	}
+	return sessionIDs, nil
+}
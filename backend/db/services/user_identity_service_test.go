@@ -0,0 +1,255 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createIdentityLink creates an identity link from a new sign-in session of the user
+func createIdentityLink(t *testing.T, userID uint, merge bool, now, expiresAt time.Time) (*models.Session, string) {
+	session, _, err := CreateSession(userID, "Laptop", "192.0.2.1", now, now.Add(time.Hour))
+	require.NoError(t, err)
+	_, token, err := CreateIdentityLink(userID, session.ID, merge, expiresAt)
+	require.NoError(t, err)
+	return session, token
+}
+
+func TestUnlinkIdentity(t *testing.T) {
+	setupTestDB(t)
+	user, err := FindOrCreateUser("google", "work-1", "Test", "User", "work@example.com")
+	require.NoError(t, err)
+	other, err := FindOrCreateUser("google", "other-1", "Other", "User", "other@example.com")
+	require.NoError(t, err)
+	now := time.Now()
+	_, token := createIdentityLink(t, user.ID, false, now, now.Add(time.Hour))
+	_, err = LinkIdentity(token, "google", "personal-1", "personal@example.com", now)
+	require.NoError(t, err)
+
+	identities, err := GetUserIdentities(user.ID)
+	require.NoError(t, err)
+	require.Len(t, identities, 2)
+
+	assert.ErrorIs(t, UnlinkIdentity(identities[0].ID, other.ID), ErrIdentityNotFound)
+	require.NoError(t, UnlinkIdentity(identities[0].ID, user.ID))
+	assert.ErrorIs(t, UnlinkIdentity(identities[1].ID, user.ID), ErrLastIdentity)
+
+	identities, err = GetUserIdentities(user.ID)
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+	assert.Equal(t, "personal-1", identities[0].Subject)
+}
+
+func TestLinkIdentity_NewIdentity(t *testing.T) {
+	setupTestDB(t)
+	user, err := FindOrCreateUser("google", "work-1", "Test", "User", "work@example.com")
+	require.NoError(t, err)
+	now := time.Now()
+	_, token := createIdentityLink(t, user.ID, false, now, now.Add(time.Hour))
+
+	linked, err := LinkIdentity(token, "microsoft", "ms-1", "test@outlook.com", now)
+
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, linked.ID)
+
+	// Signing in with the new identity reaches the same account
+	signedIn, err := FindOrCreateUser("microsoft", "ms-1", "Test", "User", "test@outlook.com")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, signedIn.ID)
+
+	// The link works once
+	_, err = LinkIdentity(token, "microsoft", "ms-2", "", now)
+	assert.ErrorIs(t, err, ErrIdentityLinkInvalid)
+}
+
+func TestLinkIdentity_InvalidLinks(t *testing.T) {
+	setupTestDB(t)
+	user, err := FindOrCreateUser("google", "work-1", "Test", "User", "work@example.com")
+	require.NoError(t, err)
+	now := time.Now()
+	_, expired := createIdentityLink(t, user.ID, false, now, now.Add(-time.Minute))
+
+	_, err = LinkIdentity(expired, "microsoft", "ms-1", "", now)
+	assert.ErrorIs(t, err, ErrIdentityLinkInvalid)
+	_, err = LinkIdentity("unknown", "microsoft", "ms-1", "", now)
+	assert.ErrorIs(t, err, ErrIdentityLinkInvalid)
+	_, err = LinkIdentity("", "microsoft", "ms-1", "", now)
+	assert.ErrorIs(t, err, ErrIdentityLinkInvalid)
+
+	// A link dies with the session that requested it
+	session, revoked := createIdentityLink(t, user.ID, false, now, now.Add(time.Hour))
+	require.NoError(t, RevokeSession(session.ID, user.ID, now))
+	_, err = LinkIdentity(revoked, "microsoft", "ms-1", "", now)
+	assert.ErrorIs(t, err, ErrIdentityLinkInvalid)
+
+	// ... and cannot borrow a session of another user
+	other, err := FindOrCreateUser("google", "other-1", "Other", "User", "other@example.com")
+	require.NoError(t, err)
+	otherSession, _, err := CreateSession(other.ID, "Phone", "192.0.2.2", now, now.Add(time.Hour))
+	require.NoError(t, err)
+	_, foreign, err := CreateIdentityLink(user.ID, otherSession.ID, false, now.Add(time.Hour))
+	require.NoError(t, err)
+	_, err = LinkIdentity(foreign, "microsoft", "ms-1", "", now)
+	assert.ErrorIs(t, err, ErrIdentityLinkInvalid)
+}
+
+func TestLinkIdentity_OwnIdentity(t *testing.T) {
+	setupTestDB(t)
+	user, err := FindOrCreateUser("google", "work-1", "Test", "User", "work@example.com")
+	require.NoError(t, err)
+	now := time.Now()
+	_, token := createIdentityLink(t, user.ID, false, now, now.Add(time.Hour))
+
+	linked, err := LinkIdentity(token, "google", "work-1", "work@example.com", now)
+
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, linked.ID)
+	identities, err := GetUserIdentities(user.ID)
+	require.NoError(t, err)
+	assert.Len(t, identities, 1)
+}
+
+func TestLinkIdentity_IdentityOfAnotherAccount(t *testing.T) {
+	setupTestDB(t)
+	user, err := FindOrCreateUser("google", "work-1", "Test", "User", "work@example.com")
+	require.NoError(t, err)
+	other, err := FindOrCreateUser("google", "personal-1", "Test", "User", "personal@example.com")
+	require.NoError(t, err)
+	now := time.Now()
+	_, token := createIdentityLink(t, user.ID, false, now, now.Add(time.Hour))
+
+	_, err = LinkIdentity(token, "google", "personal-1", "personal@example.com", now)
+	assert.ErrorIs(t, err, ErrIdentityLinkedElsewhere)
+
+	// Nothing changed, and the link was not used up
+	signedIn, err := FindOrCreateUser("google", "personal-1", "Test", "User", "personal@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, other.ID, signedIn.ID)
+	_, err = LinkIdentity(token, "microsoft", "ms-1", "", now)
+	assert.NoError(t, err)
+}
+
+func TestLinkIdentity_Merge(t *testing.T) {
+	setupTestDB(t)
+	now := time.Now()
+	user, err := FindOrCreateUser("google", "work-1", "Test", "User", "work@example.com")
+	require.NoError(t, err)
+	other, err := FindOrCreateUser("google", "personal-1", "Test", "User", "personal@example.com")
+	require.NoError(t, err)
+	owner := createHouseholdUser(t, "owner")
+
+	// The other account has a mux, a household of its own, and a higher role in a shared one
+	mux, err := calendarMuxService().Create(other.ID, "Personal", "", false, nil, "")
+	require.NoError(t, err)
+	ownHousehold, err := CreateHousehold(other.ID, "Personal household", "")
+	require.NoError(t, err)
+	shared, err := CreateHousehold(owner.ID, "Family", "")
+	require.NoError(t, err)
+	_, err = AddHouseholdMember(shared.ID, owner.ID, user.Email, models.HouseholdRoleViewer, "")
+	require.NoError(t, err)
+	_, err = AddHouseholdMember(shared.ID, owner.ID, other.Email, models.HouseholdRoleEditor, "")
+	require.NoError(t, err)
+	otherSession, _, err := CreateSession(other.ID, "Phone", "192.0.2.1", now, now.Add(time.Hour))
+	require.NoError(t, err)
+
+	_, token := createIdentityLink(t, user.ID, true, now, now.Add(time.Hour))
+	signedIn, err := LinkIdentity(token, "google", "personal-1", "personal@example.com", now)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, signedIn.ID)
+
+	// Signing in only records the account to merge; nothing moves until the user confirms
+	var link models.IdentityLink
+	require.NoError(t, db.DB.Where("user_id = ?", user.ID).First(&link).Error)
+	pending, err := GetIdentityLink(link.ID, user.ID)
+	require.NoError(t, err)
+	require.NotNil(t, pending.MergeUser)
+	assert.Equal(t, other.ID, pending.MergeUser.ID)
+	_, err = GetIdentityLink(link.ID, other.ID)
+	assert.ErrorIs(t, err, ErrIdentityLinkInvalid)
+	signedIn, err = FindOrCreateUser("google", "personal-1", "Test", "User", "personal@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, other.ID, signedIn.ID)
+
+	// Only the link's creator can confirm
+	_, err = ConfirmIdentityMerge(link.ID, other.ID, now, "")
+	assert.ErrorIs(t, err, ErrIdentityLinkInvalid)
+	revoked, err := ConfirmIdentityMerge(link.ID, user.ID, now, "req-merge")
+	require.NoError(t, err)
+	assert.Equal(t, []uint{otherSession.ID}, revoked)
+	_, err = ConfirmIdentityMerge(link.ID, user.ID, now, "")
+	assert.ErrorIs(t, err, ErrIdentityMergeNotPending)
+
+	// Both identities sign in to the merged account
+	signedIn, err = FindOrCreateUser("google", "personal-1", "Test", "User", "personal@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, signedIn.ID)
+
+	// Its muxes and households came along, keeping the higher role
+	_, err = calendarMuxService().Get(mux.ID, user.ID)
+	assert.NoError(t, err)
+	role, err := getHouseholdRole(db.DB, ownHousehold.ID, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.HouseholdRoleOwner, role)
+	role, err = getHouseholdRole(db.DB, shared.ID, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.HouseholdRoleEditor, role)
+	var memberships int64
+	db.DB.Model(&models.HouseholdMember{}).Where("user_id = ?", other.ID).Count(&memberships)
+	assert.Zero(t, memberships)
+
+	// The membership changes are audited as made by the user
+	var entries []models.AuditLog
+	require.NoError(t, db.DB.Where("request_id = ?", "req-merge").Order("id").Find(&entries).Error)
+	require.Len(t, entries, 3)
+	for _, entry := range entries {
+		assert.Equal(t, user.ID, entry.ActorID)
+		assert.Equal(t, models.AuditEntityHouseholdMember, entry.EntityType)
+	}
+	assert.Equal(t, models.AuditActionUpdate, entries[0].Action)
+	assert.Equal(t, ownHousehold.ID, *entries[0].HouseholdID)
+	assert.JSONEq(t, fmt.Sprintf(`{"user_id": {"before": %d, "after": %d}}`, other.ID, user.ID), entries[0].Changes)
+	assert.Equal(t, models.AuditActionUpdate, entries[1].Action)
+	assert.JSONEq(t, `{"role": {"before": "viewer", "after": "editor"}}`, entries[1].Changes)
+	assert.Equal(t, models.AuditActionDelete, entries[2].Action)
+	assert.Equal(t, shared.ID, *entries[2].HouseholdID)
+
+	// The other account is gone and its sessions ended
+	assert.Error(t, db.DB.First(&models.User{}, other.ID).Error)
+	session, err := GetSession(otherSession.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, session.RevokedAt)
+}
+
+func TestConfirmIdentityMerge_Errors(t *testing.T) {
+	setupTestDB(t)
+	now := time.Now()
+	user, err := FindOrCreateUser("google", "work-1", "Test", "User", "work@example.com")
+	require.NoError(t, err)
+	_, err = FindOrCreateUser("google", "personal-1", "Test", "User", "personal@example.com")
+	require.NoError(t, err)
+
+	// A link without a merge, or one that has expired, has nothing to confirm
+	_, token := createIdentityLink(t, user.ID, true, now, now.Add(time.Minute))
+	_, err = LinkIdentity(token, "microsoft", "ms-1", "", now)
+	require.NoError(t, err)
+	var link models.IdentityLink
+	require.NoError(t, db.DB.Where("user_id = ?", user.ID).First(&link).Error)
+	_, err = ConfirmIdentityMerge(link.ID, user.ID, now, "")
+	assert.ErrorIs(t, err, ErrIdentityMergeNotPending)
+
+	_, token = createIdentityLink(t, user.ID, true, now, now.Add(time.Minute))
+	_, err = LinkIdentity(token, "google", "personal-1", "", now)
+	require.NoError(t, err)
+	var expired models.IdentityLink
+	require.NoError(t, db.DB.Where("user_id = ? AND merge_user_id IS NOT NULL", user.ID).First(&expired).Error)
+	_, err = ConfirmIdentityMerge(expired.ID, user.ID, now.Add(time.Minute), "")
+	assert.ErrorIs(t, err, ErrIdentityLinkInvalid)
+	_, err = ConfirmIdentityMerge(9999, user.ID, now, "")
+	assert.ErrorIs(t, err, ErrIdentityLinkInvalid)
+}
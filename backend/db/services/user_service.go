@@ -1,8 +1,12 @@
 package services
 
 import (
+	"errors"
+
 	"family-calendar-backend/db"
 	"family-calendar-backend/db/models"
+
+	"gorm.io/gorm"
 )
 
 // FindOrCreateUserFunc is a function type for finding or creating users
@@ -13,29 +17,44 @@ var FindOrCreateUser FindOrCreateUserFunc = findOrCreateUser
 
 // findOrCreateUser is the actual implementation
 func findOrCreateUser(authProvider, authProviderID, givenName, familyName, email string) (*models.User, error) {
-	var user models.User
-
-	// Try to find existing user by auth provider and provider ID
-	result := db.DB.Where("auth_provider = ? AND auth_provider_id = ?", authProvider, authProviderID).First(&user)
-
+	// Try to find the user an identity with this provider and provider ID is linked to
+	var identity models.UserIdentity
+	result := db.DB.Where("provider = ? AND subject = ?", authProvider, authProviderID).First(&identity)
 	if result.Error == nil {
+		var user models.User
+		if err := db.DB.First(&user, identity.UserID).Error; err != nil {
+			return nil, err
+		}
+
 		// User found, update their information in case it changed
 		user.GivenName = givenName
 		user.FamilyName = familyName
 		user.Email = email
-		db.DB.Save(&user)
+		if err := db.DB.Save(&user).Error; err != nil {
+			return nil, err
+		}
+		if identity.Email != email {
+			if err := db.DB.Model(&identity).Update("email", email).Error; err != nil {
+				return nil, err
+			}
+		}
 		return &user, nil
 	}
-
-	// User not found, create new user
-	user = models.User{
-		GivenName:      givenName,
-		FamilyName:     familyName,
-		Email:          email,
-		AuthProvider:   authProvider,
-		AuthProviderID: authProviderID,
+	if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, result.Error
 	}
 
+	// Identity not found, create a new user with it
+	user := models.User{
+		GivenName:  givenName,
+		FamilyName: familyName,
+		Email:      email,
+		Identities: []models.UserIdentity{{
+			Provider: authProvider,
+			Subject:  authProviderID,
+			Email:    email,
+		}},
+	}
 	if err := db.DB.Create(&user).Error; err != nil {
 		return nil, err
 	}
@@ -4,12 +4,12 @@ import (
 	"database/sql"
 	"regexp"
 	"testing"
-	"time"
 
 	"family-calendar-backend/db"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -38,60 +38,28 @@ func setupMockDB(t *testing.T) (sqlmock.Sqlmock, func()) {
 }
 
 func TestFindOrCreateUser_UserExists(t *testing.T) {
-	mock, cleanup := setupMockDB(t)
-	defer cleanup()
-
-	now := time.Now()
-	// Mock finding existing user - GORM adds deleted_at check, ORDER BY, and LIMIT
-	rows := sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "given_name", "family_name", "email", "auth_provider", "auth_provider_id"}).
-		AddRow(1, now, now, nil, "John", "Doe", "john@example.com", "google", "google-123")
-
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE (auth_provider = $1 AND auth_provider_id = $2) AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT $3`)).
-		WithArgs("google", "google-123", 1).
-		WillReturnRows(rows)
-
-	// Mock update
-	mock.ExpectBegin()
-	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET`)).
-		WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectCommit()
+	setupTestDB(t)
+	existing, err := FindOrCreateUser("google", "google-123", "John", "Doe", "john@example.com")
+	require.NoError(t, err)
 
 	user, err := FindOrCreateUser("google", "google-123", "Jane", "Smith", "jane@example.com")
 
 	assert.NoError(t, err)
 	assert.NotNil(t, user)
-	assert.Equal(t, uint(1), user.ID)
+	assert.Equal(t, existing.ID, user.ID)
 	assert.Equal(t, "Jane", user.GivenName)
 	assert.Equal(t, "Smith", user.FamilyName)
 	assert.Equal(t, "jane@example.com", user.Email)
 
-	assert.NoError(t, mock.ExpectationsWereMet())
+	// The identity remembers the address it last reported
+	identities, err := GetUserIdentities(user.ID)
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+	assert.Equal(t, "jane@example.com", identities[0].Email)
 }
 
 func TestFindOrCreateUser_CreateNewUser(t *testing.T) {
-	mock, cleanup := setupMockDB(t)
-	defer cleanup()
-
-	// Mock user not found - GORM adds deleted_at check, ORDER BY, and LIMIT
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE (auth_provider = $1 AND auth_provider_id = $2) AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT $3`)).
-		WithArgs("google", "google-456", 1).
-		WillReturnError(gorm.ErrRecordNotFound)
-
-	// Mock create
-	mock.ExpectBegin()
-	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "users"`)).
-		WithArgs(
-			sqlmock.AnyArg(), // created_at
-			sqlmock.AnyArg(), // updated_at
-			sqlmock.AnyArg(), // deleted_at
-			"Alice",
-			"Johnson",
-			"alice@example.com",
-			"google",
-			"google-456",
-		).
-		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
-	mock.ExpectCommit()
+	setupTestDB(t)
 
 	user, err := FindOrCreateUser("google", "google-456", "Alice", "Johnson", "alice@example.com")
 
@@ -100,18 +68,25 @@ func TestFindOrCreateUser_CreateNewUser(t *testing.T) {
 	assert.Equal(t, "Alice", user.GivenName)
 	assert.Equal(t, "Johnson", user.FamilyName)
 	assert.Equal(t, "alice@example.com", user.Email)
-	assert.Equal(t, "google", user.AuthProvider)
-	assert.Equal(t, "google-456", user.AuthProviderID)
 
-	assert.NoError(t, mock.ExpectationsWereMet())
+	identities, err := GetUserIdentities(user.ID)
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+	assert.Equal(t, "google", identities[0].Provider)
+	assert.Equal(t, "google-456", identities[0].Subject)
+
+	// The same subject at another provider is another user
+	other, err := FindOrCreateUser("microsoft", "google-456", "Alice", "Johnson", "alice@example.com")
+	require.NoError(t, err)
+	assert.NotEqual(t, user.ID, other.ID)
 }
 
 func TestFindOrCreateUser_CreateError(t *testing.T) {
 	mock, cleanup := setupMockDB(t)
 	defer cleanup()
 
-	// Mock user not found - GORM adds deleted_at check, ORDER BY, and LIMIT
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE (auth_provider = $1 AND auth_provider_id = $2) AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT $3`)).
+	// Mock identity not found
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "user_identities" WHERE provider = $1 AND subject = $2 ORDER BY "user_identities"."id" LIMIT $3`)).
 		WithArgs("google", "google-789", 1).
 		WillReturnError(gorm.ErrRecordNotFound)
 
@@ -128,3 +103,17 @@ func TestFindOrCreateUser_CreateError(t *testing.T) {
 
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestFindOrCreateUser_LookupError(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "user_identities"`)).
+		WillReturnError(sql.ErrConnDone)
+
+	user, err := FindOrCreateUser("google", "google-789", "Bob", "Brown", "bob@example.com")
+
+	assert.ErrorIs(t, err, sql.ErrConnDone)
+	assert.Nil(t, user)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,191 @@
+package ical
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	// Embed the timezone database so TZIDs resolve even on minimal images
+	_ "time/tzdata"
+)
+
+// windowsZones maps the Windows timezone names used by Outlook/Exchange feeds to IANA names
+var windowsZones = map[string]string{
+	"Dateline Standard Time":          "Etc/GMT+12",
+	"Hawaiian Standard Time":          "Pacific/Honolulu",
+	"Alaskan Standard Time":           "America/Anchorage",
+	"Pacific Standard Time":           "America/Los_Angeles",
+	"Mountain Standard Time":          "America/Denver",
+	"US Mountain Standard Time":       "America/Phoenix",
+	"Central Standard Time":           "America/Chicago",
+	"Eastern Standard Time":           "America/New_York",
+	"Atlantic Standard Time":          "America/Halifax",
+	"Newfoundland Standard Time":      "America/St_Johns",
+	"E. South America Standard Time":  "America/Sao_Paulo",
+	"UTC":                             "UTC",
+	"GMT Standard Time":               "Europe/London",
+	"W. Europe Standard Time":         "Europe/Berlin",
+	"Romance Standard Time":           "Europe/Paris",
+	"Central Europe Standard Time":    "Europe/Budapest",
+	"Central European Standard Time":  "Europe/Warsaw",
+	"E. Europe Standard Time":         "Europe/Chisinau",
+	"FLE Standard Time":               "Europe/Kiev",
+	"GTB Standard Time":               "Europe/Bucharest",
+	"Russian Standard Time":           "Europe/Moscow",
+	"India Standard Time":             "Asia/Kolkata",
+	"China Standard Time":             "Asia/Shanghai",
+	"Tokyo Standard Time":             "Asia/Tokyo",
+	"AUS Eastern Standard Time":       "Australia/Sydney",
+	"New Zealand Standard Time":       "Pacific/Auckland",
+	"Singapore Standard Time":         "Asia/Singapore",
+	"South Africa Standard Time":      "Africa/Johannesburg",
+	"Arabian Standard Time":           "Asia/Dubai",
+	"Israel Standard Time":            "Asia/Jerusalem",
+	"Korea Standard Time":             "Asia/Seoul",
+	"SE Asia Standard Time":           "Asia/Bangkok",
+	"Canada Central Standard Time":    "America/Regina",
+	"Central America Standard Time":   "America/Guatemala",
+	"Mexico Standard Time":            "America/Mexico_City",
+	"Central Standard Time (Mexico)":  "America/Mexico_City",
+	"Argentina Standard Time":         "America/Buenos_Aires",
+	"W. Australia Standard Time":      "Australia/Perth",
+	"Cen. Australia Standard Time":    "Australia/Adelaide",
+	"E. Australia Standard Time":      "Australia/Brisbane",
+	"Tasmania Standard Time":          "Australia/Hobart",
+	"Turkey Standard Time":            "Europe/Istanbul",
+	"Egypt Standard Time":             "Africa/Cairo",
+	"W. Central Africa Standard Time": "Africa/Lagos",
+}
+
+// LoadLocation resolves a TZID, accepting IANA names, common Windows names and
+// the "/vendor/prefix/Area/City" form some publishers use. Unknown TZIDs resolve to UTC.
+func LoadLocation(tzid string) *time.Location {
+	tzid = strings.Trim(tzid, `"`)
+	if tzid == "" {
+		return time.UTC
+	}
+	if loc, err := time.LoadLocation(tzid); err == nil {
+		return loc
+	}
+	if iana, ok := windowsZones[tzid]; ok {
+		if loc, err := time.LoadLocation(iana); err == nil {
+			return loc
+		}
+	}
+	// e.g. "/citadel.org/20190914_1/America/New_York": try progressively shorter suffixes
+	parts := strings.Split(strings.Trim(tzid, "/"), "/")
+	for i := 1; i < len(parts); i++ {
+		if loc, err := time.LoadLocation(strings.Join(parts[i:], "/")); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// LocalTime builds a wall-clock time in loc following RFC 5545 section 3.3.5: a time that falls
+// in a DST gap is interpreted with the UTC offset in effect before the gap, and an ambiguous
+// time resolves to its first occurrence.
+func LocalTime(year int, month time.Month, day, hour, min, sec int, loc *time.Location) time.Time {
+	t := time.Date(year, month, day, hour, min, sec, 0, loc)
+	if t.Hour() == hour && t.Minute() == min && t.Second() == sec {
+		return t
+	}
+	naive := time.Date(year, month, day, hour, min, sec, 0, time.UTC)
+	_, offsetBefore := naive.Add(-24 * time.Hour).In(loc).Zone()
+	return naive.Add(-time.Duration(offsetBefore) * time.Second).In(loc)
+}
+
+// ParseDateTime parses a DATE or DATE-TIME property value. All-day dates and floating
+// times are returned in UTC; times with a TZID are returned in that location.
+func ParseDateTime(p Property) (time.Time, bool, error) {
+	return parseDateTimeValue(p.Value, p.Param("VALUE"), p.Param("TZID"))
+}
+
+// ParseDateTimeList parses a property holding a comma-separated list of dates (RDATE, EXDATE).
+// PERIOD values contribute their start.
+func ParseDateTimeList(p Property) ([]time.Time, bool, error) {
+	var times []time.Time
+	allDay := false
+	for _, value := range strings.Split(p.Value, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if i := strings.IndexByte(value, '/'); i >= 0 {
+			value = value[:i]
+		}
+		valueType := p.Param("VALUE")
+		if strings.EqualFold(valueType, "PERIOD") {
+			valueType = ""
+		}
+		t, isDate, err := parseDateTimeValue(value, valueType, p.Param("TZID"))
+		if err != nil {
+			return nil, false, err
+		}
+		allDay = isDate
+		times = append(times, t)
+	}
+	return times, allDay, nil
+}
+
+func parseDateTimeValue(value, valueType, tzid string) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(valueType, "DATE") || len(value) == 8 {
+		t, err := time.Parse("20060102", value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("ical: invalid date %q", value)
+		}
+		return t, true, nil
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("ical: invalid date-time %q", value)
+		}
+		return t, false, nil
+	}
+
+	naive, err := time.Parse("20060102T150405", value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("ical: invalid date-time %q", value)
+	}
+	loc := LoadLocation(tzid)
+	return LocalTime(naive.Year(), naive.Month(), naive.Day(), naive.Hour(), naive.Minute(), naive.Second(), loc), false, nil
+}
+
+var durationPattern = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// ParseDuration parses a DURATION value such as "PT1H30M" or "P1D"
+func ParseDuration(value string) (time.Duration, error) {
+	m := durationPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return 0, fmt.Errorf("ical: invalid duration %q", value)
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, unit := range units {
+		if m[i+2] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(m[i+2])
+		if err != nil {
+			return 0, fmt.Errorf("ical: invalid duration %q", value)
+		}
+		d += time.Duration(n) * unit
+	}
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+// FormatDateTime formats t as a DATE (all-day) or a UTC DATE-TIME value
+func FormatDateTime(t time.Time, allDay bool) string {
+	if allDay {
+		return t.Format("20060102")
+	}
+	return t.UTC().Format("20060102T150405Z")
+}
@@ -0,0 +1,168 @@
+package ical
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadLocation(t *testing.T) {
+	tests := []struct {
+		name string
+		tzid string
+		want string
+	}{
+		{name: "IANA", tzid: "America/New_York", want: "America/New_York"},
+		{name: "Quoted", tzid: `"Europe/Paris"`, want: "Europe/Paris"},
+		{name: "Windows", tzid: "W. Europe Standard Time", want: "Europe/Berlin"},
+		{name: "Vendor prefix", tzid: "/citadel.org/20190914_1/America/Chicago", want: "America/Chicago"},
+		{name: "Unknown", tzid: "Nowhere/Special", want: "UTC"},
+		{name: "Empty", tzid: "", want: "UTC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, LoadLocation(tt.tzid).String())
+		})
+	}
+}
+
+func TestLocalTime(t *testing.T) {
+	ny := LoadLocation("America/New_York")
+
+	// Regular time
+	regular := LocalTime(2025, time.June, 1, 9, 0, 0, ny)
+	assert.Equal(t, "2025-06-01T13:00:00Z", regular.UTC().Format(time.RFC3339))
+
+	// 02:30 does not exist on 2025-03-09; the pre-gap offset (EST) makes it 03:30 EDT
+	gap := LocalTime(2025, time.March, 9, 2, 30, 0, ny)
+	assert.Equal(t, "2025-03-09T07:30:00Z", gap.UTC().Format(time.RFC3339))
+	assert.Equal(t, "03:30", gap.Format("15:04"))
+
+	// 01:30 happens twice on 2025-11-02; the first occurrence (EDT) wins
+	ambiguous := LocalTime(2025, time.November, 2, 1, 30, 0, ny)
+	assert.Equal(t, "2025-11-02T05:30:00Z", ambiguous.UTC().Format(time.RFC3339))
+}
+
+func TestParseDateTime(t *testing.T) {
+	tests := []struct {
+		name       string
+		prop       Property
+		wantUTC    string
+		wantAllDay bool
+		wantLoc    string
+	}{
+		{
+			name:       "Date",
+			prop:       Property{Name: "DTSTART", Params: map[string][]string{"VALUE": {"DATE"}}, Value: "20250704"},
+			wantUTC:    "2025-07-04T00:00:00Z",
+			wantAllDay: true,
+			wantLoc:    "UTC",
+		},
+		{
+			name:    "UTC",
+			prop:    Property{Name: "DTSTART", Value: "20250704T150000Z"},
+			wantUTC: "2025-07-04T15:00:00Z",
+			wantLoc: "UTC",
+		},
+		{
+			name:    "TZID",
+			prop:    Property{Name: "DTSTART", Params: map[string][]string{"TZID": {"Europe/Paris"}}, Value: "20250704T150000"},
+			wantUTC: "2025-07-04T13:00:00Z",
+			wantLoc: "Europe/Paris",
+		},
+		{
+			name:    "Floating",
+			prop:    Property{Name: "DTSTART", Value: "20250704T150000"},
+			wantUTC: "2025-07-04T15:00:00Z",
+			wantLoc: "UTC",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, allDay, err := ParseDateTime(tt.prop)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantUTC, got.UTC().Format(time.RFC3339))
+			assert.Equal(t, tt.wantAllDay, allDay)
+			assert.Equal(t, tt.wantLoc, got.Location().String())
+		})
+	}
+}
+
+func TestParseDateTime_Invalid(t *testing.T) {
+	for _, value := range []string{"", "2025-07-04", "20251304", "20250704T25000Z", "20250704T1500"} {
+		_, _, err := ParseDateTime(Property{Name: "DTSTART", Value: value})
+		assert.Error(t, err, value)
+	}
+}
+
+func TestParseDateTimeList(t *testing.T) {
+	prop := Property{
+		Name:   "EXDATE",
+		Params: map[string][]string{"TZID": {"America/New_York"}},
+		Value:  "20250102T090000,20250103T090000",
+	}
+	times, allDay, err := ParseDateTimeList(prop)
+
+	assert.NoError(t, err)
+	assert.False(t, allDay)
+	assert.Len(t, times, 2)
+	assert.Equal(t, "2025-01-02T14:00:00Z", times[0].UTC().Format(time.RFC3339))
+	assert.Equal(t, "2025-01-03T14:00:00Z", times[1].UTC().Format(time.RFC3339))
+
+	// PERIOD values contribute their start
+	period := Property{
+		Name:   "RDATE",
+		Params: map[string][]string{"VALUE": {"PERIOD"}},
+		Value:  "20250105T100000Z/PT1H",
+	}
+	times, _, err = ParseDateTimeList(period)
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Time{time.Date(2025, 1, 5, 10, 0, 0, 0, time.UTC)}, times)
+
+	dates, allDay, err := ParseDateTimeList(Property{Name: "EXDATE", Params: map[string][]string{"VALUE": {"DATE"}}, Value: "20250101"})
+	assert.NoError(t, err)
+	assert.True(t, allDay)
+	assert.Len(t, dates, 1)
+
+	_, _, err = ParseDateTimeList(Property{Name: "EXDATE", Value: "20250101T090000,garbage"})
+	assert.Error(t, err)
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "PT1H30M", want: 90 * time.Minute},
+		{value: "P1D", want: 24 * time.Hour},
+		{value: "P2W", want: 14 * 24 * time.Hour},
+		{value: "P1DT12H", want: 36 * time.Hour},
+		{value: "-PT15M", want: -15 * time.Minute},
+		{value: "PT45S", want: 45 * time.Second},
+		{value: "P", wantErr: true},
+		{value: "PT", wantErr: true},
+		{value: "1H", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseDuration(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFormatDateTime(t *testing.T) {
+	paris := LoadLocation("Europe/Paris")
+	assert.Equal(t, "20250704", FormatDateTime(time.Date(2025, 7, 4, 0, 0, 0, 0, time.UTC), true))
+	assert.Equal(t, "20250704T130000Z", FormatDateTime(time.Date(2025, 7, 4, 15, 0, 0, 0, paris), false))
+}
@@ -0,0 +1,103 @@
+package ical
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxLineOctets is the longest content line allowed before folding (RFC 5545 section 3.1)
+const maxLineOctets = 75
+
+// ProdID identifies this application in generated calendars
+const ProdID = "-//Family Calendar Muxer//EN"
+
+// NewCalendar returns an empty VCALENDAR with the mandatory properties set
+func NewCalendar() *Component {
+	cal := NewComponent("VCALENDAR")
+	cal.AddProp("VERSION", "2.0")
+	cal.AddProp("PRODID", ProdID)
+	cal.AddProp("CALSCALE", "GREGORIAN")
+	return cal
+}
+
+// Encode writes the component and all of its sub-components as iCalendar text
+func Encode(w io.Writer, c *Component) error {
+	bw := bufio.NewWriter(w)
+	if err := encodeComponent(bw, c); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func encodeComponent(w *bufio.Writer, c *Component) error {
+	if err := writeFolded(w, "BEGIN:"+c.Name); err != nil {
+		return err
+	}
+	for _, p := range c.Properties {
+		if err := writeFolded(w, formatProperty(p)); err != nil {
+			return err
+		}
+	}
+	for _, child := range c.Components {
+		if err := encodeComponent(w, child); err != nil {
+			return err
+		}
+	}
+	return writeFolded(w, "END:"+c.Name)
+}
+
+func formatProperty(p Property) string {
+	var b strings.Builder
+	b.WriteString(p.Name)
+
+	// Sort parameter names so output is deterministic
+	names := make([]string, 0, len(p.Params))
+	for name := range p.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		b.WriteByte(';')
+		b.WriteString(name)
+		b.WriteByte('=')
+		for i, value := range p.Params[name] {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if strings.ContainsAny(value, ":;,") {
+				b.WriteByte('"')
+				b.WriteString(value)
+				b.WriteByte('"')
+			} else {
+				b.WriteString(value)
+			}
+		}
+	}
+
+	b.WriteByte(':')
+	b.WriteString(p.Value)
+	return b.String()
+}
+
+// writeFolded writes a content line, folding it at 75 octets without splitting UTF-8 sequences
+func writeFolded(w *bufio.Writer, line string) error {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		if _, err := w.WriteString(line[:cut] + "\r\n "); err != nil {
+			return err
+		}
+		line = line[cut:]
+		// Continuation lines lose one octet to the leading space
+		limit = maxLineOctets - 1
+	}
+	_, err := w.WriteString(line + "\r\n")
+	return err
+}
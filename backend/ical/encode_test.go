@@ -0,0 +1,60 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncode_RoundTrip(t *testing.T) {
+	cal, err := Parse(strings.NewReader(sampleCalendar))
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, Encode(&buf, cal))
+
+	reparsed, err := Parse(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, cal, reparsed)
+}
+
+func TestEncode_QuotesParameterValues(t *testing.T) {
+	c := NewComponent("VEVENT")
+	c.Properties = append(c.Properties, Property{
+		Name:   "ATTENDEE",
+		Params: map[string][]string{"CN": {"Doe, Jane"}, "ROLE": {"CHAIR"}},
+		Value:  "mailto:jane@example.com",
+	})
+
+	var buf bytes.Buffer
+	assert.NoError(t, Encode(&buf, c))
+
+	assert.Contains(t, buf.String(), "ATTENDEE;CN=\"Doe, Jane\";ROLE=CHAIR:mailto:jane@example.com\r\n")
+}
+
+func TestEncode_FoldsLongLines(t *testing.T) {
+	summary := strings.Repeat("Family dinner 🍝 ", 20)
+	c := NewComponent("VEVENT")
+	c.AddProp("SUMMARY", summary)
+
+	var buf bytes.Buffer
+	assert.NoError(t, Encode(&buf, c))
+
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75)
+	}
+
+	reparsed, err := Parse(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, summary, reparsed.PropValue("SUMMARY"))
+}
+
+func TestNewCalendar(t *testing.T) {
+	cal := NewCalendar()
+
+	assert.Equal(t, "VCALENDAR", cal.Name)
+	assert.Equal(t, "2.0", cal.PropValue("VERSION"))
+	assert.Equal(t, ProdID, cal.PropValue("PRODID"))
+}
@@ -0,0 +1,92 @@
+package ical
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// MaxCalendarSize limits how many bytes of an upstream calendar are read
+const MaxCalendarSize = 20 << 20
+
+// ErrCalendarTooLarge is returned when an upstream calendar is larger than MaxCalendarSize
+var ErrCalendarTooLarge = errors.New("ical: calendar too large")
+
+// FetchResult is the outcome of a conditional fetch
+type FetchResult struct {
+	// Calendar is nil when NotModified is true
+	Calendar    *Component
+	NotModified bool
+	// ETag and LastModified are the validators to send on the next fetch
+	ETag         string
+	LastModified string
+}
+
+// Fetch downloads and parses the calendar published at url
+func Fetch(ctx context.Context, client *http.Client, url string) (*Component, error) {
+	result, err := FetchConditional(ctx, client, url, "", "")
+	if err != nil {
+		return nil, err
+	}
+	return result.Calendar, nil
+}
+
+// FetchConditional downloads the calendar at url unless it is unchanged since the given validators.
+// On a 304 response the body is not parsed and the previous validators are kept. Calendars larger
+// than MaxCalendarSize fail with ErrCalendarTooLarge.
+func FetchConditional(ctx context.Context, client *http.Client, url, etag, lastModified string) (*FetchResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/calendar")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		result := &FetchResult{NotModified: true, ETag: etag, LastModified: lastModified}
+		// Servers may refresh validators on a 304
+		if value := resp.Header.Get("ETag"); value != "" {
+			result.ETag = value
+		}
+		if value := resp.Header.Get("Last-Modified"); value != "" {
+			result.LastModified = value
+		}
+		return result, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("ical: unexpected status %d fetching %s", resp.StatusCode, url)
+	}
+
+	// Read one byte past the limit, so that an oversized calendar fails instead of being truncated
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxCalendarSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > MaxCalendarSize {
+		return nil, fmt.Errorf("%w fetching %s: more than %d bytes", ErrCalendarTooLarge, url, MaxCalendarSize)
+	}
+	cal, err := Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return &FetchResult{
+		Calendar:     cal,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
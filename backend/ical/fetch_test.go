@@ -0,0 +1,124 @@
+package ical
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetch_Success(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "text/calendar", r.Header.Get("Accept"))
+		w.Header().Set("Content-Type", "text/calendar")
+		w.Write([]byte(sampleCalendar))
+	}))
+	defer server.Close()
+
+	cal, err := Fetch(context.Background(), server.Client(), server.URL)
+
+	assert.NoError(t, err)
+	assert.Len(t, cal.Children("VEVENT"), 1)
+}
+
+func TestFetch_BadStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	_, err := Fetch(context.Background(), server.Client(), server.URL)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "404")
+}
+
+func TestFetch_InvalidURL(t *testing.T) {
+	_, err := Fetch(context.Background(), http.DefaultClient, "://bad")
+	assert.Error(t, err)
+}
+
+func TestFetch_ConnectionError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	_, err := Fetch(context.Background(), http.DefaultClient, url)
+	assert.Error(t, err)
+}
+
+func TestFetchConditional_ReturnsValidators(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("If-None-Match"))
+		assert.Empty(t, r.Header.Get("If-Modified-Since"))
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Wed, 01 Jan 2025 10:00:00 GMT")
+		w.Write([]byte(sampleCalendar))
+	}))
+	defer server.Close()
+
+	result, err := FetchConditional(context.Background(), server.Client(), server.URL, "", "")
+
+	assert.NoError(t, err)
+	assert.False(t, result.NotModified)
+	assert.NotNil(t, result.Calendar)
+	assert.Equal(t, `"v1"`, result.ETag)
+	assert.Equal(t, "Wed, 01 Jan 2025 10:00:00 GMT", result.LastModified)
+}
+
+func TestFetchConditional_NotModified(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, `"v1"`, r.Header.Get("If-None-Match"))
+		assert.Equal(t, "Wed, 01 Jan 2025 10:00:00 GMT", r.Header.Get("If-Modified-Since"))
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer server.Close()
+
+	result, err := FetchConditional(context.Background(), server.Client(), server.URL, `"v1"`, "Wed, 01 Jan 2025 10:00:00 GMT")
+
+	assert.NoError(t, err)
+	assert.True(t, result.NotModified)
+	assert.Nil(t, result.Calendar)
+	assert.Equal(t, `"v1"`, result.ETag)
+	assert.Equal(t, "Wed, 01 Jan 2025 10:00:00 GMT", result.LastModified)
+}
+
+func TestFetchConditional_NotModifiedRefreshesValidators(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v2"`)
+		w.Header().Set("Last-Modified", "Thu, 02 Jan 2025 10:00:00 GMT")
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer server.Close()
+
+	result, err := FetchConditional(context.Background(), server.Client(), server.URL, `"v1"`, "")
+
+	assert.NoError(t, err)
+	assert.True(t, result.NotModified)
+	assert.Equal(t, `"v2"`, result.ETag)
+	assert.Equal(t, "Thu, 02 Jan 2025 10:00:00 GMT", result.LastModified)
+}
+
+func TestFetchConditional_ParseError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>not a calendar</html>"))
+	}))
+	defer server.Close()
+
+	_, err := FetchConditional(context.Background(), server.Client(), server.URL, "", "")
+	assert.Error(t, err)
+}
+
+func TestFetchConditional_TooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(sampleCalendar))
+		w.Write([]byte(strings.Repeat("X", MaxCalendarSize)))
+	}))
+	defer server.Close()
+
+	_, err := FetchConditional(context.Background(), server.Client(), server.URL, "", "")
+	assert.ErrorIs(t, err, ErrCalendarTooLarge)
+}
@@ -0,0 +1,275 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Property is a single content line such as "DTSTART;TZID=Europe/Paris:20250101T090000"
+type Property struct {
+	Name   string
+	Params map[string][]string
+	Value  string
+}
+
+// Param returns the first value of a property parameter, or "" if it is not set
+func (p Property) Param(name string) string {
+	values := p.Params[strings.ToUpper(name)]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// Component is a BEGIN/END block such as VCALENDAR, VEVENT or VTIMEZONE
+type Component struct {
+	Name       string
+	Properties []Property
+	Components []*Component
+}
+
+// NewComponent returns an empty component with the given name
+func NewComponent(name string) *Component {
+	return &Component{Name: strings.ToUpper(name)}
+}
+
+// Prop returns the first property with the given name
+func (c *Component) Prop(name string) (Property, bool) {
+	name = strings.ToUpper(name)
+	for _, p := range c.Properties {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Property{}, false
+}
+
+// PropValue returns the raw value of the first property with the given name, or ""
+func (c *Component) PropValue(name string) string {
+	p, _ := c.Prop(name)
+	return p.Value
+}
+
+// PropsNamed returns all properties with the given name
+func (c *Component) PropsNamed(name string) []Property {
+	name = strings.ToUpper(name)
+	var props []Property
+	for _, p := range c.Properties {
+		if p.Name == name {
+			props = append(props, p)
+		}
+	}
+	return props
+}
+
+// AddProp appends a property with the given raw value
+func (c *Component) AddProp(name, value string) {
+	c.Properties = append(c.Properties, Property{Name: strings.ToUpper(name), Value: value})
+}
+
+// SetProp replaces every property with the given name by a single property
+func (c *Component) SetProp(p Property) {
+	c.RemoveProp(p.Name)
+	p.Name = strings.ToUpper(p.Name)
+	c.Properties = append(c.Properties, p)
+}
+
+// RemoveProp removes every property with the given name
+func (c *Component) RemoveProp(name string) {
+	name = strings.ToUpper(name)
+	kept := c.Properties[:0]
+	for _, p := range c.Properties {
+		if p.Name != name {
+			kept = append(kept, p)
+		}
+	}
+	c.Properties = kept
+}
+
+// Children returns the direct sub-components with the given name
+func (c *Component) Children(name string) []*Component {
+	name = strings.ToUpper(name)
+	var children []*Component
+	for _, child := range c.Components {
+		if child.Name == name {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// Clone returns a deep copy of the component
+func (c *Component) Clone() *Component {
+	clone := &Component{Name: c.Name}
+	for _, p := range c.Properties {
+		cp := Property{Name: p.Name, Value: p.Value}
+		if p.Params != nil {
+			cp.Params = make(map[string][]string, len(p.Params))
+			for k, v := range p.Params {
+				cp.Params[k] = append([]string(nil), v...)
+			}
+		}
+		clone.Properties = append(clone.Properties, cp)
+	}
+	for _, child := range c.Components {
+		clone.Components = append(clone.Components, child.Clone())
+	}
+	return clone
+}
+
+// Parse reads an iCalendar stream and returns its first top-level component (normally VCALENDAR)
+func Parse(r io.Reader) (*Component, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var stack []*Component
+	for _, line := range lines {
+		prop, err := parseLine(line)
+		if err != nil {
+			return nil, err
+		}
+
+		switch prop.Name {
+		case "BEGIN":
+			stack = append(stack, NewComponent(prop.Value))
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(prop.Value) {
+				return nil, fmt.Errorf("ical: unexpected END:%s", prop.Value)
+			}
+			done := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return done, nil
+			}
+			parent := stack[len(stack)-1]
+			parent.Components = append(parent.Components, done)
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("ical: property %s outside of a component", prop.Name)
+			}
+			current := stack[len(stack)-1]
+			current.Properties = append(current.Properties, prop)
+		}
+	}
+
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("ical: missing END:%s", stack[len(stack)-1].Name)
+	}
+	return nil, errors.New("ical: no calendar data")
+}
+
+// unfold joins continuation lines (lines starting with a space or tab) onto the previous line
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// parseLine splits a content line into name, parameters and value, honouring quoted parameter values
+func parseLine(line string) (Property, error) {
+	prop := Property{}
+
+	i := strings.IndexAny(line, ";:")
+	if i <= 0 {
+		return prop, fmt.Errorf("ical: malformed content line %q", line)
+	}
+	prop.Name = strings.ToUpper(line[:i])
+
+	for line[i] == ';' {
+		i++
+		eq := strings.IndexByte(line[i:], '=')
+		if eq <= 0 {
+			return prop, fmt.Errorf("ical: malformed parameter in %q", line)
+		}
+		paramName := strings.ToUpper(line[i : i+eq])
+		i += eq + 1
+
+		var values []string
+		for {
+			var value string
+			if i < len(line) && line[i] == '"' {
+				end := strings.IndexByte(line[i+1:], '"')
+				if end < 0 {
+					return prop, fmt.Errorf("ical: unterminated quoted parameter in %q", line)
+				}
+				value = line[i+1 : i+1+end]
+				i += end + 2
+			} else {
+				end := strings.IndexAny(line[i:], ",;:")
+				if end < 0 {
+					return prop, fmt.Errorf("ical: missing value in %q", line)
+				}
+				value = line[i : i+end]
+				i += end
+			}
+			values = append(values, value)
+			if i >= len(line) {
+				return prop, fmt.Errorf("ical: missing value in %q", line)
+			}
+			if line[i] != ',' {
+				break
+			}
+			i++
+		}
+
+		if prop.Params == nil {
+			prop.Params = make(map[string][]string)
+		}
+		prop.Params[paramName] = append(prop.Params[paramName], values...)
+	}
+
+	if line[i] != ':' {
+		return prop, fmt.Errorf("ical: malformed content line %q", line)
+	}
+	prop.Value = line[i+1:]
+	return prop, nil
+}
+
+// UnescapeText decodes a TEXT value (RFC 5545 section 3.3.11)
+func UnescapeText(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+			switch value[i] {
+			case 'n', 'N':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(value[i])
+			}
+			continue
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// EscapeText encodes a string as a TEXT value (RFC 5545 section 3.3.11)
+func EscapeText(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return replacer.Replace(value)
+}
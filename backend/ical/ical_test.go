@@ -0,0 +1,119 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const sampleCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Example//EN\r\n" +
+	"BEGIN:VTIMEZONE\r\n" +
+	"TZID:America/Toronto\r\n" +
+	"END:VTIMEZONE\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:event-1@example.com\r\n" +
+	"DTSTART;TZID=America/Toronto:20250110T090000\r\n" +
+	"SUMMARY:Parent-teacher\r\n" +
+	"  conference\r\n" +
+	"ATTENDEE;CN=\"Doe, Jane\";ROLE=REQ-PARTICIPANT:mailto:jane@example.com\r\n" +
+	"DESCRIPTION:Room 12\\, bring notes\\nThanks\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParse(t *testing.T) {
+	cal, err := Parse(strings.NewReader(sampleCalendar))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "VCALENDAR", cal.Name)
+	assert.Equal(t, "2.0", cal.PropValue("VERSION"))
+	assert.Len(t, cal.Children("VTIMEZONE"), 1)
+
+	events := cal.Children("VEVENT")
+	assert.Len(t, events, 1)
+	event := events[0]
+
+	// Folded lines are joined after removing the single leading whitespace character
+	assert.Equal(t, "Parent-teacher conference", event.PropValue("SUMMARY"))
+
+	dtstart, ok := event.Prop("dtstart")
+	assert.True(t, ok)
+	assert.Equal(t, "America/Toronto", dtstart.Param("tzid"))
+	assert.Equal(t, "20250110T090000", dtstart.Value)
+
+	attendee, _ := event.Prop("ATTENDEE")
+	assert.Equal(t, "Doe, Jane", attendee.Param("CN"))
+	assert.Equal(t, "REQ-PARTICIPANT", attendee.Param("ROLE"))
+	assert.Equal(t, "mailto:jane@example.com", attendee.Value)
+
+	assert.Equal(t, "Room 12, bring notes\nThanks", UnescapeText(event.PropValue("DESCRIPTION")))
+}
+
+func TestParse_LFLineEndings(t *testing.T) {
+	cal, err := Parse(strings.NewReader(strings.ReplaceAll(sampleCalendar, "\r\n", "\n")))
+
+	assert.NoError(t, err)
+	assert.Len(t, cal.Children("VEVENT"), 1)
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "Empty", input: ""},
+		{name: "Missing END", input: "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"},
+		{name: "Mismatched END", input: "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nEND:VCALENDAR\r\n"},
+		{name: "Property outside component", input: "VERSION:2.0\r\n"},
+		{name: "Malformed line", input: "BEGIN:VCALENDAR\r\nNOCOLON\r\nEND:VCALENDAR\r\n"},
+		{name: "Malformed parameter", input: "BEGIN:VCALENDAR\r\nX;FOO:bar\r\nEND:VCALENDAR\r\n"},
+		{name: "Unterminated quote", input: "BEGIN:VCALENDAR\r\nX;CN=\"abc:bar\r\nEND:VCALENDAR\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.input))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestComponentPropertyHelpers(t *testing.T) {
+	c := NewComponent("vevent")
+	c.AddProp("categories", "A")
+	c.AddProp("CATEGORIES", "B")
+	c.AddProp("SUMMARY", "Old")
+
+	assert.Equal(t, "VEVENT", c.Name)
+	assert.Len(t, c.PropsNamed("CATEGORIES"), 2)
+
+	c.SetProp(Property{Name: "summary", Value: "New"})
+	assert.Equal(t, "New", c.PropValue("SUMMARY"))
+	assert.Len(t, c.PropsNamed("SUMMARY"), 1)
+
+	c.RemoveProp("CATEGORIES")
+	assert.Empty(t, c.PropsNamed("CATEGORIES"))
+	assert.Equal(t, "", c.PropValue("CATEGORIES"))
+}
+
+func TestClone(t *testing.T) {
+	cal, err := Parse(strings.NewReader(sampleCalendar))
+	assert.NoError(t, err)
+
+	clone := cal.Clone()
+	clone.Children("VEVENT")[0].Properties[0].Params = map[string][]string{"X": {"changed"}}
+	clone.Children("VEVENT")[0].SetProp(Property{Name: "SUMMARY", Value: "Changed"})
+
+	assert.Equal(t, "Parent-teacher conference", cal.Children("VEVENT")[0].PropValue("SUMMARY"))
+	assert.Nil(t, cal.Children("VEVENT")[0].Properties[0].Params)
+}
+
+func TestEscapeText(t *testing.T) {
+	original := "Line one; with, punctuation\\\nLine two"
+	escaped := EscapeText(original)
+
+	assert.Equal(t, `Line one\; with\, punctuation\\\nLine two`, escaped)
+	assert.Equal(t, original, UnescapeText(escaped))
+}
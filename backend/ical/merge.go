@@ -0,0 +1,157 @@
+package ical
+
+import (
+	"strconv"
+	"strings"
+)
+
+// SourcesProperty lists, on a merged event collapsed from duplicates, the names of the calendars it came from
+const SourcesProperty = "X-FCM-SOURCES"
+
+// SourcedEvent is a VEVENT together with the calendars it was found in
+type SourcedEvent struct {
+	Event *Component
+	// Sources are indexes into the merged calendars, in calendar order
+	Sources []int
+}
+
+// CollectEvents gathers the VEVENTs of several calendars in calendar order. With dedup, events
+// sharing a UID (and RECURRENCE-ID), or failing that a normalized title, start and end, are
+// collapsed into the first one found and record every calendar that contributed them. The title
+// and time only identify duplicates across calendars: distinct events of one calendar that happen
+// to share them are all kept.
+func CollectEvents(calendars []*Component, dedup bool) []SourcedEvent {
+	var events []SourcedEvent
+	index := make(map[string][]int)
+
+	for i, cal := range calendars {
+		for _, event := range cal.Children("VEVENT") {
+			if !dedup {
+				events = append(events, SourcedEvent{Event: event, Sources: []int{i}})
+				continue
+			}
+
+			keys := duplicateKeys(event)
+			existing := -1
+		lookup:
+			for _, key := range keys {
+				for _, n := range index[key] {
+					if strings.HasPrefix(key, contentKeyPrefix) && containsIndex(events[n].Sources, i) {
+						continue
+					}
+					existing = n
+					break lookup
+				}
+			}
+			if existing < 0 {
+				existing = len(events)
+				events = append(events, SourcedEvent{Event: event, Sources: []int{i}})
+			} else if sources := events[existing].Sources; sources[len(sources)-1] != i {
+				events[existing].Sources = append(sources, i)
+			}
+			for _, key := range keys {
+				if !containsIndex(index[key], existing) {
+					index[key] = append(index[key], existing)
+				}
+			}
+		}
+	}
+	return events
+}
+
+// containsIndex reports whether list contains n
+func containsIndex(list []int, n int) bool {
+	for _, value := range list {
+		if value == n {
+			return true
+		}
+	}
+	return false
+}
+
+// contentKeyPrefix marks the title, start and end identity returned by duplicateKeys
+const contentKeyPrefix = "content:"
+
+// duplicateKeys returns the identities under which an event is considered a duplicate:
+// its UID and, when its times can be read, its normalized title, start and end
+func duplicateKeys(event *Component) []string {
+	recurrenceID := ""
+	if rid, ok := event.Prop("RECURRENCE-ID"); ok {
+		if t, _, err := ParseDateTime(rid); err == nil {
+			recurrenceID = strconv.FormatInt(t.Unix(), 10)
+		}
+	}
+
+	var keys []string
+	if uid := event.PropValue("UID"); uid != "" {
+		keys = append(keys, "uid:"+uid+"|"+recurrenceID)
+	}
+
+	dtstart, ok := event.Prop("DTSTART")
+	if !ok {
+		return keys
+	}
+	start, allDay, err := ParseDateTime(dtstart)
+	if err != nil {
+		return keys
+	}
+	end := start
+	if dtend, ok := event.Prop("DTEND"); ok {
+		if end, _, err = ParseDateTime(dtend); err != nil {
+			return keys
+		}
+	} else if duration, ok := event.Prop("DURATION"); ok {
+		d, err := ParseDuration(duration.Value)
+		if err != nil {
+			return keys
+		}
+		end = start.Add(d)
+	}
+
+	title := strings.ToLower(strings.Join(strings.Fields(UnescapeText(event.PropValue("SUMMARY"))), " "))
+	keys = append(keys, strings.Join([]string{
+		contentKeyPrefix + title,
+		FormatDateTime(start, allDay),
+		FormatDateTime(end, allDay),
+		recurrenceID,
+		strings.ToUpper(event.PropValue("RRULE")),
+	}, "|"))
+	return keys
+}
+
+// Merge combines the VEVENTs of several calendars into a single named VCALENDAR.
+// VTIMEZONE definitions are carried over once per TZID so merged events keep resolving.
+// With dedup, duplicate events are collapsed (see CollectEvents) and list the X-WR-CALNAME
+// of each contributing calendar in SourcesProperty.
+func Merge(name string, calendars []*Component, dedup bool) *Component {
+	merged := NewCalendar()
+	if name != "" {
+		merged.AddProp("X-WR-CALNAME", EscapeText(name))
+	}
+
+	seenTZIDs := make(map[string]bool)
+	for _, cal := range calendars {
+		for _, tz := range cal.Children("VTIMEZONE") {
+			tzid := tz.PropValue("TZID")
+			if seenTZIDs[tzid] {
+				continue
+			}
+			seenTZIDs[tzid] = true
+			merged.Components = append(merged.Components, tz.Clone())
+		}
+	}
+
+	// Timezones must be defined before the events that reference them
+	for _, sourced := range CollectEvents(calendars, dedup) {
+		event := sourced.Event.Clone()
+		if len(sourced.Sources) > 1 {
+			names := make([]string, 0, len(sourced.Sources))
+			for _, i := range sourced.Sources {
+				names = append(names, calendars[i].PropValue("X-WR-CALNAME"))
+			}
+			event.SetProp(Property{Name: SourcesProperty, Value: strings.Join(names, ",")})
+		}
+		merged.Components = append(merged.Components, event)
+	}
+	return merged
+}
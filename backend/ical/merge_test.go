@@ -0,0 +1,166 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge(t *testing.T) {
+	first, err := Parse(strings.NewReader(sampleCalendar))
+	assert.NoError(t, err)
+
+	second, err := Parse(strings.NewReader("BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VTIMEZONE\r\nTZID:America/Toronto\r\nEND:VTIMEZONE\r\n" +
+		"BEGIN:VTIMEZONE\r\nTZID:Europe/Paris\r\nEND:VTIMEZONE\r\n" +
+		"BEGIN:VEVENT\r\nUID:event-2@example.com\r\nSUMMARY:Soccer\r\nEND:VEVENT\r\n" +
+		"BEGIN:VTODO\r\nUID:todo-1@example.com\r\nEND:VTODO\r\n" +
+		"END:VCALENDAR\r\n"))
+	assert.NoError(t, err)
+
+	merged := Merge("Smith, family", []*Component{first, second}, false)
+
+	assert.Equal(t, `Smith\, family`, merged.PropValue("X-WR-CALNAME"))
+	assert.Equal(t, "2.0", merged.PropValue("VERSION"))
+
+	timezones := merged.Children("VTIMEZONE")
+	assert.Len(t, timezones, 2)
+	assert.Equal(t, "America/Toronto", timezones[0].PropValue("TZID"))
+	assert.Equal(t, "Europe/Paris", timezones[1].PropValue("TZID"))
+
+	events := merged.Children("VEVENT")
+	assert.Len(t, events, 2)
+	assert.Equal(t, "event-1@example.com", events[0].PropValue("UID"))
+	assert.Equal(t, "event-2@example.com", events[1].PropValue("UID"))
+	assert.Empty(t, merged.Children("VTODO"))
+
+	// Timezones come before events
+	assert.Equal(t, "VTIMEZONE", merged.Components[0].Name)
+	assert.Equal(t, "VEVENT", merged.Components[len(merged.Components)-1].Name)
+}
+
+func TestMerge_NoCalendars(t *testing.T) {
+	merged := Merge("", nil, true)
+
+	assert.Empty(t, merged.Components)
+	assert.Equal(t, "", merged.PropValue("X-WR-CALNAME"))
+}
+
+// duplicateCalendar builds a named calendar from VEVENT bodies
+func duplicateCalendar(t *testing.T, name string, events ...string) *Component {
+	t.Helper()
+	body := "BEGIN:VCALENDAR\r\nX-WR-CALNAME:" + name + "\r\n"
+	for _, event := range events {
+		body += "BEGIN:VEVENT\r\n" + strings.ReplaceAll(event, "\n", "\r\n") + "END:VEVENT\r\n"
+	}
+	cal, err := Parse(strings.NewReader(body + "END:VCALENDAR\r\n"))
+	assert.NoError(t, err)
+	return cal
+}
+
+func TestCollectEvents_Dedup(t *testing.T) {
+	mom := duplicateCalendar(t, "Mom",
+		"UID:conference@school.example\nSUMMARY:Parent-teacher conference\nDTSTART:20250110T170000Z\nDTEND:20250110T173000Z\n",
+		"UID:dentist@example.com\nSUMMARY:Dentist\nDTSTART:20250111T090000Z\n",
+		"UID:recital@example.com\nSUMMARY:Piano  Recital\nDTSTART;TZID=America/New_York:20250112T140000\nDURATION:PT1H\n",
+	)
+	dad := duplicateCalendar(t, "Dad",
+		// Same UID, different (stale) details
+		"UID:conference@school.example\nSUMMARY:Conference\nDTSTART:20250110T170000Z\nDTEND:20250110T173000Z\n",
+		// Different UID, same normalized title and times expressed in another timezone
+		"UID:other-recital@example.org\nSUMMARY:piano recital\nDTSTART:20250112T190000Z\nDTEND:20250112T200000Z\n",
+		// Same title, different start
+		"UID:dentist-2@example.com\nSUMMARY:Dentist\nDTSTART:20250118T090000Z\n",
+	)
+	kids := duplicateCalendar(t, "Kids",
+		"UID:conference@school.example\nSUMMARY:Parent-teacher conference\nDTSTART:20250110T170000Z\nDTEND:20250110T173000Z\n",
+	)
+
+	events := CollectEvents([]*Component{mom, dad, kids}, true)
+
+	assert.Len(t, events, 4)
+	assert.Equal(t, "Parent-teacher conference", events[0].Event.PropValue("SUMMARY"))
+	assert.Equal(t, []int{0, 1, 2}, events[0].Sources)
+	assert.Equal(t, "dentist@example.com", events[1].Event.PropValue("UID"))
+	assert.Equal(t, []int{0}, events[1].Sources)
+	assert.Equal(t, "recital@example.com", events[2].Event.PropValue("UID"))
+	assert.Equal(t, []int{0, 1}, events[2].Sources)
+	assert.Equal(t, "dentist-2@example.com", events[3].Event.PropValue("UID"))
+	assert.Equal(t, []int{1}, events[3].Sources)
+}
+
+func TestCollectEvents_DedupKeepsInstances(t *testing.T) {
+	mom := duplicateCalendar(t, "Mom",
+		"UID:practice@example.com\nSUMMARY:Practice\nDTSTART:20250106T170000Z\nRRULE:FREQ=WEEKLY\n",
+		"UID:practice@example.com\nRECURRENCE-ID:20250113T170000Z\nSUMMARY:Practice\nDTSTART:20250113T180000Z\n",
+	)
+	dad := duplicateCalendar(t, "Dad",
+		"UID:practice@example.com\nSUMMARY:Practice\nDTSTART:20250106T170000Z\nRRULE:FREQ=WEEKLY\n",
+		"UID:practice@example.com\nRECURRENCE-ID:20250120T170000Z\nSUMMARY:Practice\nDTSTART:20250120T180000Z\n",
+		// A one-off event at the same time as the series is not the series
+		"UID:one-off@example.com\nSUMMARY:Practice\nDTSTART:20250106T170000Z\n",
+	)
+
+	events := CollectEvents([]*Component{mom, dad}, true)
+
+	assert.Len(t, events, 4)
+	assert.Equal(t, []int{0, 1}, events[0].Sources)
+	assert.Equal(t, []int{0}, events[1].Sources)
+	assert.Equal(t, "20250120T170000Z", events[2].Event.PropValue("RECURRENCE-ID"))
+	assert.Equal(t, "one-off@example.com", events[3].Event.PropValue("UID"))
+}
+
+func TestCollectEvents_DedupKeepsSameSourceLookalikes(t *testing.T) {
+	kids := duplicateCalendar(t, "Kids",
+		"UID:practice-anna@example.com\nSUMMARY:Practice\nDTSTART:20250106T170000Z\nDTEND:20250106T180000Z\n",
+		"UID:practice-ben@example.com\nSUMMARY:Practice\nDTSTART:20250106T170000Z\nDTEND:20250106T180000Z\n",
+	)
+	mom := duplicateCalendar(t, "Mom",
+		"UID:mom-practice@example.com\nSUMMARY:practice\nDTSTART:20250106T170000Z\nDTEND:20250106T180000Z\n",
+		"UID:mom-practice-2@example.com\nSUMMARY:practice\nDTSTART:20250106T170000Z\nDTEND:20250106T180000Z\n",
+		"UID:mom-practice-3@example.com\nSUMMARY:practice\nDTSTART:20250106T170000Z\nDTEND:20250106T180000Z\n",
+	)
+
+	events := CollectEvents([]*Component{kids, mom}, true)
+
+	assert.Len(t, events, 3)
+	assert.Equal(t, "practice-anna@example.com", events[0].Event.PropValue("UID"))
+	assert.Equal(t, []int{0, 1}, events[0].Sources)
+	assert.Equal(t, "practice-ben@example.com", events[1].Event.PropValue("UID"))
+	assert.Equal(t, []int{0, 1}, events[1].Sources)
+	assert.Equal(t, "mom-practice-3@example.com", events[2].Event.PropValue("UID"))
+	assert.Equal(t, []int{1}, events[2].Sources)
+}
+
+func TestCollectEvents_NoDedup(t *testing.T) {
+	event := "UID:conference@school.example\nSUMMARY:Conference\nDTSTART:20250110T170000Z\n"
+	mom := duplicateCalendar(t, "Mom", event)
+	dad := duplicateCalendar(t, "Dad", event)
+
+	events := CollectEvents([]*Component{mom, dad}, false)
+
+	assert.Len(t, events, 2)
+	assert.Equal(t, []int{0}, events[0].Sources)
+	assert.Equal(t, []int{1}, events[1].Sources)
+}
+
+func TestMerge_Dedup(t *testing.T) {
+	event := "UID:conference@school.example\nSUMMARY:Conference\nDTSTART:20250110T170000Z\n"
+	mom := duplicateCalendar(t, "Mom\\, work", event)
+	dad := duplicateCalendar(t, "Dad", event, "UID:solo@example.com\nSUMMARY:Solo\n")
+
+	merged := Merge("Family", []*Component{mom, dad}, true)
+
+	events := merged.Children("VEVENT")
+	assert.Len(t, events, 2)
+	assert.Equal(t, `Mom\, work,Dad`, events[0].PropValue(SourcesProperty))
+	// Events from a single calendar are left untouched
+	_, ok := events[1].Prop(SourcesProperty)
+	assert.False(t, ok)
+	// The source calendars are not modified
+	_, ok = mom.Children("VEVENT")[0].Prop(SourcesProperty)
+	assert.False(t, ok)
+
+	assert.Len(t, Merge("Family", []*Component{mom, dad}, false).Children("VEVENT"), 3)
+}
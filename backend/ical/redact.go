@@ -0,0 +1,34 @@
+package ical
+
+// schedulingProperties are the VEVENT properties that describe when an event happens, without saying what it is
+var schedulingProperties = map[string]bool{
+	"UID":           true,
+	"DTSTAMP":       true,
+	"DTSTART":       true,
+	"DTEND":         true,
+	"DURATION":      true,
+	"RRULE":         true,
+	"RDATE":         true,
+	"EXDATE":        true,
+	"RECURRENCE-ID": true,
+	"SEQUENCE":      true,
+	"STATUS":        true,
+	"TRANSP":        true,
+}
+
+// Redact returns a copy of a VEVENT reduced to its scheduling properties: times, recurrence, status
+// and transparency. Descriptions, locations, attendees, organizers, URLs, attachments, alarms and
+// extension properties are dropped. The SUMMARY is kept when keepSummary is set, without
+// parameters such as ALTREP that may point at the full details.
+func Redact(event *Component, keepSummary bool) *Component {
+	redacted := NewComponent(event.Name)
+	for _, p := range event.Properties {
+		switch {
+		case schedulingProperties[p.Name]:
+			redacted.Properties = append(redacted.Properties, p)
+		case keepSummary && p.Name == "SUMMARY":
+			redacted.Properties = append(redacted.Properties, Property{Name: p.Name, Value: p.Value})
+		}
+	}
+	return redacted.Clone()
+}
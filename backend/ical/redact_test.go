@@ -0,0 +1,63 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const detailedEvent = "BEGIN:VEVENT\r\n" +
+	"UID:review@work.example\r\n" +
+	"DTSTAMP:20250101T120000Z\r\n" +
+	"DTSTART;TZID=America/New_York:20250110T090000\r\n" +
+	"DTEND;TZID=America/New_York:20250110T100000\r\n" +
+	"RRULE:FREQ=WEEKLY\r\n" +
+	"EXDATE;TZID=America/New_York:20250117T090000\r\n" +
+	"SUMMARY;ALTREP=\"https://work.example/review\":Performance review\r\n" +
+	"DESCRIPTION:Bring the numbers\r\n" +
+	"LOCATION:Room 4\r\n" +
+	"ORGANIZER;CN=Boss:mailto:boss@work.example\r\n" +
+	"ATTENDEE;CN=Dad:mailto:dad@work.example\r\n" +
+	"URL:https://work.example/meeting\r\n" +
+	"X-MICROSOFT-CDO-BUSYSTATUS:BUSY\r\n" +
+	"STATUS:CONFIRMED\r\n" +
+	"TRANSP:OPAQUE\r\n" +
+	"BEGIN:VALARM\r\nACTION:DISPLAY\r\nDESCRIPTION:Review soon\r\nTRIGGER:-PT15M\r\nEND:VALARM\r\n" +
+	"END:VEVENT\r\n"
+
+func TestRedact(t *testing.T) {
+	event, err := Parse(strings.NewReader(detailedEvent))
+	require.NoError(t, err)
+
+	redacted := Redact(event, true)
+
+	var names []string
+	for _, p := range redacted.Properties {
+		names = append(names, p.Name)
+	}
+	assert.Equal(t, []string{"UID", "DTSTAMP", "DTSTART", "DTEND", "RRULE", "EXDATE", "SUMMARY", "STATUS", "TRANSP"}, names)
+	assert.Empty(t, redacted.Components)
+	assert.Equal(t, "America/New_York", redacted.Properties[2].Param("TZID"))
+
+	summary, ok := redacted.Prop("SUMMARY")
+	assert.True(t, ok)
+	assert.Equal(t, "Performance review", summary.Value)
+	assert.Empty(t, summary.Params)
+
+	// The original event is not modified
+	assert.Equal(t, "Room 4", event.PropValue("LOCATION"))
+	assert.Len(t, event.Children("VALARM"), 1)
+}
+
+func TestRedact_WithoutSummary(t *testing.T) {
+	event, err := Parse(strings.NewReader(detailedEvent))
+	require.NoError(t, err)
+
+	redacted := Redact(event, false)
+
+	_, ok := redacted.Prop("SUMMARY")
+	assert.False(t, ok)
+	assert.Equal(t, "review@work.example", redacted.PropValue("UID"))
+}
@@ -0,0 +1,87 @@
+package ical
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrNonPublicAddress is returned when an upstream calendar resolves to an address that must not
+// be fetched from the server, such as loopback, private or link-local ranges
+var ErrNonPublicAddress = errors.New("ical: refusing to connect to a non-public address")
+
+// nonPublicPrefixes are ranges the netip predicates do not cover: "this network", carrier-grade
+// NAT, which reaches the provider's internal hosts, and NAT64, which embeds any IPv4 address
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// IsPublicAddress reports whether addr may be contacted when fetching user-supplied calendars
+func IsPublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return addr.IsValid() &&
+		!addr.IsUnspecified() &&
+		!addr.IsLoopback() &&
+		!addr.IsPrivate() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsMulticast()
+}
+
+// IsPublicHost reports whether host can be accepted as a calendar source host without resolving it.
+// Literal IPs must be public and localhost names are rejected; other names are checked on every
+// dial by the transport returned from NewPublicTransport.
+func IsPublicHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if addr, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		return IsPublicAddress(addr)
+	}
+	return true
+}
+
+// NewPublicTransport returns an HTTP transport that refuses to connect to non-public addresses.
+// The check runs on the resolved address of every connection, so redirects and DNS rebinding
+// cannot reach internal services. Proxies are not used because they would hide the destination.
+func NewPublicTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   publicAddressControl,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// publicAddressControl is a net.Dialer Control hook rejecting connections to non-public addresses
+func publicAddressControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("ical: unexpected dial address %q: %w", address, err)
+	}
+	if !IsPublicAddress(addr) {
+		return fmt.Errorf("%w: %s", ErrNonPublicAddress, addr)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package ical
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPublicAddress(t *testing.T) {
+	tests := []struct {
+		addr     string
+		expected bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fdaa::3", false},
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"100.64.0.1", false},
+		{"100.127.255.254", false},
+		{"100.128.0.1", true},
+		{"64:ff9b::7f00:1", false},
+		{"64:ff9b::5db8:d822", false},
+		{"::ffff:127.0.0.1", false},
+		{"224.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			assert.Equal(t, tt.expected, IsPublicAddress(netip.MustParseAddr(tt.addr)))
+		})
+	}
+}
+
+func TestIsPublicHost(t *testing.T) {
+	assert.True(t, IsPublicHost("example.com"))
+	assert.True(t, IsPublicHost("93.184.216.34"))
+	assert.False(t, IsPublicHost("localhost"))
+	assert.False(t, IsPublicHost("api.localhost."))
+	assert.False(t, IsPublicHost("127.0.0.1"))
+	assert.False(t, IsPublicHost("[::1]"))
+	assert.False(t, IsPublicHost("169.254.169.254"))
+}
+
+func TestNewPublicTransport_RejectsLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request should not reach a loopback server")
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewPublicTransport()}
+	_, err := Fetch(context.Background(), client, server.URL)
+
+	assert.ErrorIs(t, err, ErrNonPublicAddress)
+}
@@ -1,12 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"family-calendar-backend/auth"
+	"family-calendar-backend/calendar_sync"
+	"family-calendar-backend/calendar_trash"
 	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/repositories"
+	"family-calendar-backend/db/services"
 	"family-calendar-backend/rest_api_handlers"
 
 	"github.com/go-chi/chi/v5"
@@ -18,8 +28,9 @@ func corsMiddleware(allowedOrigin string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match, X-CSRF-Token")
+			w.Header().Set("Access-Control-Expose-Headers", "ETag")
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
 
 			if r.Method == "OPTIONS" {
@@ -43,6 +54,11 @@ func setupRouter() (*chi.Mux, error) {
 		return nil, err
 	}
 
+	auditLogs := repositories.NewGormAuditLogRepository(db.DB)
+	userHandler := rest_api_handlers.NewUserHandler(repositories.NewGormUserRepository(db.DB))
+	calendarMuxHandler := rest_api_handlers.NewCalendarMuxHandler(repositories.NewGormCalendarMuxRepository(db.DB))
+	auditHandler := rest_api_handlers.NewAuditHandler(auditLogs)
+
 	r := chi.NewRouter()
 
 	// Get CORS allowed origin from environment
@@ -58,19 +74,78 @@ func setupRouter() (*chi.Mux, error) {
 	r.Use(corsMiddleware(corsOrigin))
 
 	// Auth routes (not part of REST API)
-	r.Get("/auth/google", auth.LoginHandler)
-	r.Get("/auth/google/callback", auth.CallbackHandler)
+	r.Get("/auth/{provider}", auth.LoginHandler)
+	r.Get("/auth/{provider}/callback", auth.CallbackHandler)
+	r.Post("/auth/token", auth.TokenHandler)
+	r.Post("/auth/refresh", auth.RefreshHandler)
+	r.Post("/auth/logout", auth.LogoutHandler)
+
+	// Public keys for verifying access tokens
+	r.Get("/.well-known/jwks.json", auth.JWKSHandler)
 
 	// Public REST API routes (no authentication required)
 	r.Get("/health", rest_api_handlers.HealthCheck)
 
-	// Protected REST API routes (authentication required)
+	// Public calendar feeds, authorized by the unguessable feed token in the URL
+	r.Get("/feeds/{token}.ics", calendarMuxHandler.ServeCalendarFeed)
+
+	// Protected REST API routes (authentication required). Personal access tokens reach only the
+	// routes their scopes grant; everything else needs a sign-in session.
 	r.Group(func(r chi.Router) {
 		r.Use(auth.RequireAuth)
-		r.Get("/api/userinfo", rest_api_handlers.UserInfo)
-		r.Post("/api/calendar-mux", rest_api_handlers.CreateCalendarMux)
-		r.Get("/api/calendar-mux", rest_api_handlers.ListCalendarMuxes)
-		r.Delete("/api/calendar-mux/{id}", rest_api_handlers.DeleteCalendarMux)
+
+		r.Group(func(r chi.Router) {
+			r.Use(auth.RequireScope(models.ScopeEventsRead, models.ScopeMuxesManage))
+			r.Get("/api/userinfo", userHandler.UserInfo)
+			r.Get("/api/calendar-mux", calendarMuxHandler.ListCalendarMuxes)
+			r.Get("/api/calendar-mux/trash", calendarMuxHandler.ListCalendarMuxTrash)
+			r.Get("/api/calendar-mux/{id}", calendarMuxHandler.GetCalendarMux)
+			r.Get("/api/calendar-mux/{id}/events", calendarMuxHandler.ListCalendarMuxEvents)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(auth.RequireScope(models.ScopeMuxesManage))
+			r.Post("/api/calendar-mux", calendarMuxHandler.CreateCalendarMux)
+			r.Patch("/api/calendar-mux/{id}", calendarMuxHandler.UpdateCalendarMux)
+			r.Delete("/api/calendar-mux/{id}", calendarMuxHandler.DeleteCalendarMux)
+			r.Post("/api/calendar-mux/{id}/restore", calendarMuxHandler.RestoreCalendarMux)
+			r.Post("/api/calendar-mux/{id}/sources", calendarMuxHandler.CreateCalendarSource)
+			r.Get("/api/calendar-mux/{id}/sources", calendarMuxHandler.ListCalendarSources)
+			r.Delete("/api/calendar-mux/{id}/sources/{sourceID}", calendarMuxHandler.DeleteCalendarSource)
+			r.Put("/api/calendar-mux/{id}/sources/{sourceID}/visibility", calendarMuxHandler.UpdateCalendarSourceVisibility)
+			r.Get("/api/calendar-mux/{id}/sources/{sourceID}/rules", calendarMuxHandler.ListRewriteRules)
+			r.Post("/api/calendar-mux/{id}/sources/{sourceID}/rules", calendarMuxHandler.CreateRewriteRule)
+			r.Put("/api/calendar-mux/{id}/sources/{sourceID}/rules/{ruleID}", calendarMuxHandler.UpdateRewriteRule)
+			r.Delete("/api/calendar-mux/{id}/sources/{sourceID}/rules/{ruleID}", calendarMuxHandler.DeleteRewriteRule)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(auth.RequireSession)
+			r.Post("/api/households", rest_api_handlers.CreateHousehold)
+			r.Get("/api/households", rest_api_handlers.ListHouseholds)
+			r.Get("/api/households/{id}", rest_api_handlers.GetHousehold)
+			r.Delete("/api/households/{id}", rest_api_handlers.DeleteHousehold)
+			r.Post("/api/households/{id}/members", rest_api_handlers.AddHouseholdMember)
+			r.Put("/api/households/{id}/members/{userID}", rest_api_handlers.UpdateHouseholdMember)
+			r.Delete("/api/households/{id}/members/{userID}", rest_api_handlers.RemoveHouseholdMember)
+			r.Post("/api/households/{id}/invites", rest_api_handlers.CreateHouseholdInvite)
+			r.Get("/api/households/{id}/invites", rest_api_handlers.ListHouseholdInvites)
+			r.Delete("/api/households/{id}/invites/{inviteID}", rest_api_handlers.RevokeHouseholdInvite)
+			r.Post("/api/invites/{token}/accept", rest_api_handlers.AcceptHouseholdInvite)
+			r.Get("/api/audit", auditHandler.ListAuditLog)
+			r.Get("/api/export", rest_api_handlers.ExportAccount)
+			r.Post("/api/import", rest_api_handlers.ImportAccount)
+			r.Get("/api/sessions", rest_api_handlers.ListSessions)
+			r.Delete("/api/sessions/{id}", rest_api_handlers.RevokeSession)
+			r.Get("/api/identities", rest_api_handlers.ListIdentities)
+			r.Post("/api/identities/link", rest_api_handlers.CreateIdentityLink)
+			r.Get("/api/identities/link/{id}", rest_api_handlers.GetIdentityLink)
+			r.Post("/api/identities/link/{id}/merge", rest_api_handlers.ConfirmIdentityMerge)
+			r.Delete("/api/identities/{id}", rest_api_handlers.UnlinkIdentity)
+			r.Post("/api/tokens", rest_api_handlers.CreatePersonalAccessToken)
+			r.Get("/api/tokens", rest_api_handlers.ListPersonalAccessTokens)
+			r.Delete("/api/tokens/{id}", rest_api_handlers.DeletePersonalAccessToken)
+		})
 	})
 
 	return r, nil
@@ -82,14 +157,48 @@ func main() {
 		log.Println("No .env file found, using environment variables")
 	}
 
+	// `server migrate ...` runs migrations instead of the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
 	r, err := setupRouter()
 	if err != nil {
 		log.Printf("Failed to setup router: %v", err)
 		return
 	}
 
-	log.Println("Server starting on 0.0.0.0:8080")
-	if err := http.ListenAndServe("0.0.0.0:8080", r); err != nil {
-		log.Printf("Server stopped: %v", err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Start the background sync engine that keeps calendar sources up to date
+	syncEngine := calendar_sync.NewEngine(calendar_sync.ConfigFromEnv())
+	syncEngine.Start(ctx)
+
+	// Start the background purge of calendar muxes that have been in the trash past the retention
+	trashPurger := calendar_trash.NewPurger(calendar_trash.ConfigFromEnv(), services.NewCalendarMuxService(repositories.NewGormCalendarMuxRepository(db.DB)))
+	trashPurger.Start(ctx)
+
+	server := &http.Server{Addr: "0.0.0.0:8080", Handler: r}
+	go func() {
+		log.Println("Server starting on 0.0.0.0:8080")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Server stopped: %v", err)
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown failed: %v", err)
 	}
+	syncEngine.Stop()
+	trashPurger.Stop()
 }
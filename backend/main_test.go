@@ -61,8 +61,9 @@ func TestCorsMiddleware(t *testing.T) {
 
 			// Assert CORS headers
 			assert.Equal(t, tt.expectedOrigin, rr.Header().Get("Access-Control-Allow-Origin"))
-			assert.Equal(t, "GET, POST, PUT, DELETE, OPTIONS", rr.Header().Get("Access-Control-Allow-Methods"))
-			assert.Equal(t, "Content-Type, Authorization", rr.Header().Get("Access-Control-Allow-Headers"))
+			assert.Equal(t, "GET, POST, PUT, PATCH, DELETE, OPTIONS", rr.Header().Get("Access-Control-Allow-Methods"))
+			assert.Equal(t, "Content-Type, Authorization, If-Match, X-CSRF-Token", rr.Header().Get("Access-Control-Allow-Headers"))
+			assert.Equal(t, "ETag", rr.Header().Get("Access-Control-Expose-Headers"))
 			assert.Equal(t, "true", rr.Header().Get("Access-Control-Allow-Credentials"))
 		})
 	}
@@ -143,6 +144,26 @@ func TestSetupRouter_WithCorsOrigin(t *testing.T) {
 	assert.Equal(t, "https://example.com", rr.Header().Get("Access-Control-Allow-Origin"))
 }
 
+func TestSetupRouter_FeedRoute(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("GOOGLE_CLIENT_ID", "test-client-id")
+	t.Setenv("GOOGLE_CLIENT_SECRET", "test-client-secret")
+	t.Setenv("GOOGLE_REDIRECT_URL", "http://localhost:8080/auth/google/callback")
+	t.Setenv("DB_TYPE", "sqlite")
+
+	router, err := setupRouter()
+	assert.NoError(t, err)
+
+	// Feeds are public, so an unknown token yields 404 rather than 401
+	req := httptest.NewRequest("GET", "/feeds/unknown-token.ics", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Feed not found")
+}
+
 func TestSetupRouter_AuthInitError(t *testing.T) {
 
 	// Explicitly set it to empty to override any existing value from environment
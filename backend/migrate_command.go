@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"family-calendar-backend/db"
+)
+
+var errMigrateUsage = errors.New("usage: server migrate [up | down [steps] | to <version> | status]")
+
+// runMigrateCommand applies or undoes migrations of the configured database as the arguments
+// say, and then lists the migrations with their state
+func runMigrateCommand(args []string, out io.Writer) error {
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	var migrate func() error
+	switch {
+	case action == "up" && len(args) <= 1:
+		migrate = func() error { return db.Migrate(db.DB) }
+	case action == "down" && len(args) <= 2:
+		steps := 1
+		if len(args) == 2 {
+			var err error
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return errMigrateUsage
+			}
+		}
+		migrate = func() error { return db.RollbackMigrations(db.DB, steps) }
+	case action == "to" && len(args) == 2:
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version < 0 {
+			return errMigrateUsage
+		}
+		migrate = func() error { return db.MigrateTo(db.DB, version) }
+	case action == "status" && len(args) == 1:
+		migrate = func() error { return nil }
+	default:
+		return errMigrateUsage
+	}
+
+	if err := db.Open(); err != nil {
+		return err
+	}
+	if sqlDB, err := db.DB.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	if err := migrate(); err != nil {
+		return err
+	}
+
+	statuses, err := db.MigrationStatuses(db.DB)
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		state := "pending"
+		if status.AppliedAt != nil {
+			state = "applied " + status.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(out, "%04d %-30s %s\n", status.Version, status.Name, state)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunMigrateCommand(t *testing.T) {
+	t.Setenv("DB_TYPE", "sqlite")
+
+	tests := []struct {
+		name     string
+		args     []string
+		contains string
+	}{
+		{"up by default", nil, "0001 initial_schema                 applied "},
+		{"up", []string{"up"}, "applied "},
+		{"status", []string{"status"}, "0001 initial_schema                 pending"},
+		{"down", []string{"down", "2"}, "pending"},
+		{"to", []string{"to", "1"}, "0001 initial_schema                 applied "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			require.NoError(t, runMigrateCommand(tt.args, &out))
+
+			assert.Contains(t, out.String(), tt.contains)
+		})
+	}
+}
+
+func TestRunMigrateCommand_Usage(t *testing.T) {
+	for _, args := range [][]string{{"sideways"}, {"down", "0"}, {"down", "x"}, {"to"}, {"to", "-1"}, {"status", "now"}, {"up", "1"}} {
+		err := runMigrateCommand(args, &bytes.Buffer{})
+		assert.ErrorIs(t, err, errMigrateUsage, "%v", args)
+	}
+}
+
+func TestRunMigrateCommand_UnknownVersion(t *testing.T) {
+	t.Setenv("DB_TYPE", "sqlite")
+
+	err := runMigrateCommand([]string{"to", "9999"}, &bytes.Buffer{})
+
+	assert.ErrorContains(t, err, "unknown migration version 9999")
+}
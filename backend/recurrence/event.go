@@ -0,0 +1,234 @@
+package recurrence
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"family-calendar-backend/ical"
+)
+
+// Event is the recurrence-relevant part of a VEVENT: a series master, a single event,
+// or an override of one instance of a series (RecurrenceID set)
+type Event struct {
+	UID      string
+	Start    time.Time
+	Duration time.Duration
+	AllDay   bool
+	// Rule is nil for events without an RRULE
+	Rule    *Rule
+	RDates  []time.Time
+	ExDates []time.Time
+	// exDateDays holds date-only EXDATEs, which exclude every instance on that day
+	exDateDays []time.Time
+	// RecurrenceID is the original start of the instance this event overrides, zero otherwise.
+	// RANGE=THISANDFUTURE is treated as a single-instance override.
+	RecurrenceID time.Time
+	Cancelled    bool
+	Component    *ical.Component
+}
+
+// Occurrence is one expanded instance of an event
+type Occurrence struct {
+	Start  time.Time
+	End    time.Time
+	AllDay bool
+	// RecurrenceID is the original start of the instance; zero for non-recurring events
+	RecurrenceID time.Time
+	// Event is the master or, for overridden instances, the override
+	Event *Event
+}
+
+// FromComponent extracts an Event from a VEVENT component
+func FromComponent(vevent *ical.Component) (*Event, error) {
+	dtstart, ok := vevent.Prop("DTSTART")
+	if !ok {
+		return nil, fmt.Errorf("recurrence: event %q has no DTSTART", vevent.PropValue("UID"))
+	}
+	start, allDay, err := ical.ParseDateTime(dtstart)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &Event{
+		UID:       vevent.PropValue("UID"),
+		Start:     start,
+		AllDay:    allDay,
+		Cancelled: strings.EqualFold(vevent.PropValue("STATUS"), "CANCELLED"),
+		Component: vevent,
+	}
+
+	dtend, hasEnd := vevent.Prop("DTEND")
+	duration, hasDuration := vevent.Prop("DURATION")
+	switch {
+	case hasEnd:
+		end, _, err := ical.ParseDateTime(dtend)
+		if err != nil {
+			return nil, err
+		}
+		event.Duration = end.Sub(start)
+	case hasDuration:
+		event.Duration, err = ical.ParseDuration(duration.Value)
+		if err != nil {
+			return nil, err
+		}
+	case allDay:
+		event.Duration = 24 * time.Hour
+	}
+	if event.Duration < 0 {
+		event.Duration = 0
+	}
+
+	if rrule, ok := vevent.Prop("RRULE"); ok {
+		event.Rule, err = ParseRule(rrule.Value, start.Location())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, p := range vevent.PropsNamed("RDATE") {
+		dates, _, err := ical.ParseDateTimeList(p)
+		if err != nil {
+			return nil, err
+		}
+		event.RDates = append(event.RDates, dates...)
+	}
+
+	for _, p := range vevent.PropsNamed("EXDATE") {
+		dates, dateOnly, err := ical.ParseDateTimeList(p)
+		if err != nil {
+			return nil, err
+		}
+		if dateOnly && !allDay {
+			event.exDateDays = append(event.exDateDays, dates...)
+		} else {
+			event.ExDates = append(event.ExDates, dates...)
+		}
+	}
+
+	if rid, ok := vevent.Prop("RECURRENCE-ID"); ok {
+		event.RecurrenceID, _, err = ical.ParseDateTime(rid)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return event, nil
+}
+
+// IsOverride reports whether the event replaces a single instance of a series
+func (e *Event) IsOverride() bool {
+	return !e.RecurrenceID.IsZero()
+}
+
+// isRecurring reports whether the event defines more than its DTSTART instance
+func (e *Event) isRecurring() bool {
+	return e.Rule != nil || len(e.RDates) > 0
+}
+
+// instanceStarts returns the sorted, de-duplicated instance starts of a master in [from, to),
+// after removing EXDATEs. DTSTART always counts as the first instance.
+func (e *Event) instanceStarts(from, to time.Time) []time.Time {
+	candidates := []time.Time{e.Start}
+	if e.Rule != nil {
+		candidates = append(candidates, e.Rule.Between(e.Start, from, to)...)
+	}
+	candidates = append(candidates, e.RDates...)
+
+	excluded := make(map[int64]bool, len(e.ExDates))
+	for _, t := range e.ExDates {
+		excluded[t.Unix()] = true
+	}
+	excludedDays := make(map[string]bool, len(e.exDateDays))
+	for _, t := range e.exDateDays {
+		excludedDays[t.Format("20060102")] = true
+	}
+
+	seen := make(map[int64]bool, len(candidates))
+	var starts []time.Time
+	for _, t := range candidates {
+		key := t.Unix()
+		if seen[key] || excluded[key] || excludedDays[t.Format("20060102")] {
+			continue
+		}
+		if t.Before(from) || !t.Before(to) {
+			continue
+		}
+		seen[key] = true
+		starts = append(starts, t)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+	return starts
+}
+
+// overlaps reports whether [start, end) intersects [from, to); zero-length instances count when they start inside it
+func overlaps(start, end, from, to time.Time) bool {
+	if !start.Before(to) {
+		return false
+	}
+	if end.After(start) {
+		return end.After(from)
+	}
+	return !start.Before(from)
+}
+
+// Expand returns the occurrences of a calendar's events that overlap [from, to), sorted by start.
+// Overrides (events with a RECURRENCE-ID) replace the matching instance of their series, and
+// cancelled events or instances are omitted.
+func Expand(events []*Event, from, to time.Time) []Occurrence {
+	overrides := make(map[string]map[int64]*Event)
+	for _, e := range events {
+		if !e.IsOverride() {
+			continue
+		}
+		if overrides[e.UID] == nil {
+			overrides[e.UID] = make(map[int64]*Event)
+		}
+		overrides[e.UID][e.RecurrenceID.Unix()] = e
+	}
+
+	var occurrences []Occurrence
+	for _, e := range events {
+		if e.IsOverride() {
+			// Overrides are emitted on their own, even when their series is missing
+			if !e.Cancelled && overlaps(e.Start, e.Start.Add(e.Duration), from, to) {
+				occurrences = append(occurrences, Occurrence{
+					Start:        e.Start,
+					End:          e.Start.Add(e.Duration),
+					AllDay:       e.AllDay,
+					RecurrenceID: e.RecurrenceID,
+					Event:        e,
+				})
+			}
+			continue
+		}
+		if e.Cancelled {
+			continue
+		}
+
+		recurring := e.isRecurring()
+		for _, start := range e.instanceStarts(from.Add(-e.Duration), to) {
+			if _, overridden := overrides[e.UID][start.Unix()]; overridden {
+				continue
+			}
+			end := start.Add(e.Duration)
+			if !overlaps(start, end, from, to) {
+				continue
+			}
+			occurrence := Occurrence{Start: start, End: end, AllDay: e.AllDay, Event: e}
+			if recurring {
+				occurrence.RecurrenceID = start
+			}
+			occurrences = append(occurrences, occurrence)
+		}
+	}
+
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		if !occurrences[i].Start.Equal(occurrences[j].Start) {
+			return occurrences[i].Start.Before(occurrences[j].Start)
+		}
+		return occurrences[i].Event.UID < occurrences[j].Event.UID
+	})
+	return occurrences
+}
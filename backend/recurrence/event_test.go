@@ -0,0 +1,267 @@
+package recurrence
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"family-calendar-backend/ical"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// parseEvents parses the VEVENTs of a calendar body (the lines between BEGIN:VCALENDAR and END:VCALENDAR)
+func parseEvents(t *testing.T, body string) []*Event {
+	t.Helper()
+	cal, err := ical.Parse(strings.NewReader("BEGIN:VCALENDAR\r\n" + strings.ReplaceAll(body, "\n", "\r\n") + "END:VCALENDAR\r\n"))
+	require.NoError(t, err)
+
+	var events []*Event
+	for _, vevent := range cal.Children("VEVENT") {
+		event, err := FromComponent(vevent)
+		require.NoError(t, err)
+		events = append(events, event)
+	}
+	return events
+}
+
+func occurrenceStarts(occurrences []Occurrence) []string {
+	starts := make([]string, 0, len(occurrences))
+	for _, o := range occurrences {
+		starts = append(starts, o.Start.In(newYork).Format("20060102T150405"))
+	}
+	return starts
+}
+
+func TestFromComponent(t *testing.T) {
+	events := parseEvents(t, `BEGIN:VEVENT
+UID:series@example.com
+DTSTART;TZID=America/New_York:20250106T090000
+DTEND;TZID=America/New_York:20250106T103000
+RRULE:FREQ=WEEKLY;COUNT=4
+RDATE;TZID=America/New_York:20250201T120000
+EXDATE;TZID=America/New_York:20250113T090000,20250120T090000
+END:VEVENT
+`)
+
+	require.Len(t, events, 1)
+	event := events[0]
+	assert.Equal(t, "series@example.com", event.UID)
+	assert.Equal(t, "America/New_York", event.Start.Location().String())
+	assert.Equal(t, 90*time.Minute, event.Duration)
+	assert.False(t, event.AllDay)
+	require.NotNil(t, event.Rule)
+	assert.Equal(t, Weekly, event.Rule.Freq)
+	assert.Len(t, event.RDates, 1)
+	assert.Len(t, event.ExDates, 2)
+	assert.False(t, event.IsOverride())
+	assert.False(t, event.Cancelled)
+}
+
+func TestFromComponent_Durations(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		want   time.Duration
+		allDay bool
+	}{
+		{name: "DURATION", body: "DTSTART:20250106T090000Z\nDURATION:PT45M\n", want: 45 * time.Minute},
+		{name: "All-day without end", body: "DTSTART;VALUE=DATE:20250106\n", want: 24 * time.Hour, allDay: true},
+		{name: "Multi-day all-day", body: "DTSTART;VALUE=DATE:20250106\nDTEND;VALUE=DATE:20250109\n", want: 72 * time.Hour, allDay: true},
+		{name: "Timed without end", body: "DTSTART:20250106T090000Z\n", want: 0},
+		{name: "End before start", body: "DTSTART:20250106T090000Z\nDTEND:20250106T080000Z\n", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := parseEvents(t, "BEGIN:VEVENT\nUID:x\n"+tt.body+"END:VEVENT\n")
+			assert.Equal(t, tt.want, events[0].Duration)
+			assert.Equal(t, tt.allDay, events[0].AllDay)
+		})
+	}
+}
+
+func TestFromComponent_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "Missing DTSTART", body: "SUMMARY:No start\n"},
+		{name: "Bad DTSTART", body: "DTSTART:yesterday\n"},
+		{name: "Bad DTEND", body: "DTSTART:20250106T090000Z\nDTEND:later\n"},
+		{name: "Bad DURATION", body: "DTSTART:20250106T090000Z\nDURATION:1h\n"},
+		{name: "Bad RRULE", body: "DTSTART:20250106T090000Z\nRRULE:COUNT=2\n"},
+		{name: "Bad EXDATE", body: "DTSTART:20250106T090000Z\nEXDATE:soon\n"},
+		{name: "Bad RECURRENCE-ID", body: "DTSTART:20250106T090000Z\nRECURRENCE-ID:first\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cal, err := ical.Parse(strings.NewReader(strings.ReplaceAll("BEGIN:VEVENT\nUID:x\n"+tt.body+"END:VEVENT\n", "\n", "\r\n")))
+			require.NoError(t, err)
+			_, err = FromComponent(cal)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestExpand_ExDatesAndRDates(t *testing.T) {
+	events := parseEvents(t, `BEGIN:VEVENT
+UID:series@example.com
+DTSTART;TZID=America/New_York:20250106T090000
+DTEND;TZID=America/New_York:20250106T100000
+RRULE:FREQ=WEEKLY;COUNT=4
+RDATE;TZID=America/New_York:20250201T120000
+EXDATE;TZID=America/New_York:20250113T090000
+END:VEVENT
+`)
+
+	occurrences := Expand(events, localStart(t, "20250101T000000"), localStart(t, "20250301T000000"))
+
+	assert.Equal(t, []string{"20250106T090000", "20250120T090000", "20250127T090000", "20250201T120000"}, occurrenceStarts(occurrences))
+	assert.Equal(t, occurrences[1].Start.Add(time.Hour), occurrences[1].End)
+	assert.True(t, occurrences[1].RecurrenceID.Equal(occurrences[1].Start))
+}
+
+// The RFC 5545 "Friday the 13th" example excludes a DTSTART that does not match the rule
+func TestExpand_ExDateRemovesUnsynchronizedStart(t *testing.T) {
+	events := parseEvents(t, `BEGIN:VEVENT
+UID:friday13@example.com
+DTSTART;TZID=America/New_York:19970902T090000
+EXDATE;TZID=America/New_York:19970902T090000
+RRULE:FREQ=MONTHLY;BYDAY=FR;BYMONTHDAY=13
+END:VEVENT
+`)
+
+	occurrences := Expand(events, localStart(t, "19970101T000000"), localStart(t, "19990101T000000"))
+
+	assert.Equal(t, []string{"19980213T090000", "19980313T090000", "19981113T090000"}, occurrenceStarts(occurrences))
+}
+
+func TestExpand_DateOnlyExDateOnTimedSeries(t *testing.T) {
+	events := parseEvents(t, `BEGIN:VEVENT
+UID:daily@example.com
+DTSTART;TZID=America/New_York:20250106T090000
+RRULE:FREQ=DAILY;COUNT=3
+EXDATE;VALUE=DATE:20250107
+END:VEVENT
+`)
+
+	occurrences := Expand(events, localStart(t, "20250101T000000"), localStart(t, "20250201T000000"))
+
+	assert.Equal(t, []string{"20250106T090000", "20250108T090000"}, occurrenceStarts(occurrences))
+}
+
+func TestExpand_Overrides(t *testing.T) {
+	events := parseEvents(t, `BEGIN:VEVENT
+UID:standup@example.com
+SUMMARY:Standup
+DTSTART;TZID=America/New_York:20250106T090000
+DTEND;TZID=America/New_York:20250106T091500
+RRULE:FREQ=DAILY;COUNT=5
+END:VEVENT
+BEGIN:VEVENT
+UID:standup@example.com
+SUMMARY:Standup (moved)
+RECURRENCE-ID;TZID=America/New_York:20250107T090000
+DTSTART;TZID=America/New_York:20250107T140000
+DTEND;TZID=America/New_York:20250107T143000
+END:VEVENT
+BEGIN:VEVENT
+UID:standup@example.com
+RECURRENCE-ID:20250108T140000Z
+DTSTART;TZID=America/New_York:20250108T090000
+STATUS:CANCELLED
+END:VEVENT
+`)
+
+	occurrences := Expand(events, localStart(t, "20250101T000000"), localStart(t, "20250201T000000"))
+
+	// The second instance moves to the afternoon and the third, identified by a UTC RECURRENCE-ID, is cancelled
+	assert.Equal(t, []string{"20250106T090000", "20250107T140000", "20250109T090000", "20250110T090000"}, occurrenceStarts(occurrences))
+
+	moved := occurrences[1]
+	assert.Equal(t, "Standup (moved)", moved.Event.Component.PropValue("SUMMARY"))
+	assert.Equal(t, 30*time.Minute, moved.End.Sub(moved.Start))
+	assert.Equal(t, "20250107T090000", moved.RecurrenceID.In(newYork).Format("20060102T150405"))
+}
+
+func TestExpand_OverrideMovedIntoWindow(t *testing.T) {
+	events := parseEvents(t, `BEGIN:VEVENT
+UID:weekly@example.com
+DTSTART;TZID=America/New_York:20250106T090000
+RRULE:FREQ=WEEKLY;COUNT=3
+END:VEVENT
+BEGIN:VEVENT
+UID:weekly@example.com
+RECURRENCE-ID;TZID=America/New_York:20250113T090000
+DTSTART;TZID=America/New_York:20250125T090000
+END:VEVENT
+`)
+
+	// Only the override falls in the window; its original slot is outside it
+	occurrences := Expand(events, localStart(t, "20250124T000000"), localStart(t, "20250126T000000"))
+
+	assert.Equal(t, []string{"20250125T090000"}, occurrenceStarts(occurrences))
+}
+
+func TestExpand_CancelledSeries(t *testing.T) {
+	events := parseEvents(t, `BEGIN:VEVENT
+UID:cancelled@example.com
+DTSTART:20250106T090000Z
+RRULE:FREQ=DAILY
+STATUS:CANCELLED
+END:VEVENT
+`)
+
+	assert.Empty(t, Expand(events, localStart(t, "20250101T000000"), localStart(t, "20250201T000000")))
+}
+
+func TestExpand_WindowOverlap(t *testing.T) {
+	events := parseEvents(t, `BEGIN:VEVENT
+UID:overnight@example.com
+DTSTART;TZID=America/New_York:20250105T220000
+DTEND;TZID=America/New_York:20250106T020000
+END:VEVENT
+BEGIN:VEVENT
+UID:holiday@example.com
+DTSTART;VALUE=DATE:20250106
+RRULE:FREQ=YEARLY
+END:VEVENT
+BEGIN:VEVENT
+UID:later@example.com
+DTSTART;TZID=America/New_York:20250107T090000
+END:VEVENT
+`)
+
+	// An event that started before the window but is still running is included
+	occurrences := Expand(events, localStart(t, "20250106T000000"), localStart(t, "20250107T000000"))
+
+	// All-day dates are kept at UTC midnight, which sorts before the overnight event
+	require.Len(t, occurrences, 2)
+	assert.Equal(t, "holiday@example.com", occurrences[0].Event.UID)
+	assert.True(t, occurrences[0].AllDay)
+	assert.Equal(t, time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC), occurrences[0].Start)
+	assert.Equal(t, time.Date(2025, 1, 7, 0, 0, 0, 0, time.UTC), occurrences[0].End)
+	assert.Equal(t, "overnight@example.com", occurrences[1].Event.UID)
+	assert.True(t, occurrences[1].RecurrenceID.IsZero())
+}
+
+func TestExpand_DSTTransition(t *testing.T) {
+	events := parseEvents(t, `BEGIN:VEVENT
+UID:fallback@example.com
+DTSTART;TZID=America/New_York:20251101T083000
+DTEND;TZID=America/New_York:20251101T093000
+RRULE:FREQ=DAILY;COUNT=3
+END:VEVENT
+`)
+
+	occurrences := Expand(events, localStart(t, "20251101T000000"), localStart(t, "20251105T000000"))
+
+	require.Len(t, occurrences, 3)
+	// Same local time on both sides of the November 2 transition, so the UTC time moves by an hour
+	assert.Equal(t, []string{"20251101T083000", "20251102T083000", "20251103T083000"}, occurrenceStarts(occurrences))
+	assert.Equal(t, "2025-11-01T12:30:00Z", occurrences[0].Start.UTC().Format(time.RFC3339))
+	assert.Equal(t, "2025-11-02T13:30:00Z", occurrences[1].Start.UTC().Format(time.RFC3339))
+}
@@ -0,0 +1,361 @@
+package recurrence
+
+import (
+	"sort"
+	"time"
+
+	"family-calendar-backend/ical"
+)
+
+// maxPeriods bounds iteration for rules that rarely or never produce an instance
+const maxPeriods = 100000
+
+// Between returns the instances generated by the rule for a series starting at dtstart that
+// fall in [from, to). Instances are computed on dtstart's wall clock in dtstart's location,
+// so a 09:00 event stays at 09:00 local time across DST transitions.
+func (r *Rule) Between(dtstart, from, to time.Time) []time.Time {
+	loc := dtstart.Location()
+	start := floating(dtstart)
+	eff := r.withDefaults(start)
+
+	k := 0
+	if r.Count == 0 {
+		k = eff.skipPeriods(start, floating(from.In(loc)))
+	}
+
+	var instances []time.Time
+	count := 0
+	for i := 0; i < maxPeriods; i, k = i+1, k+eff.Interval {
+		periodStart := eff.periodStart(start, k)
+		// Wall clock and instants can disagree by up to the DST shift, so allow a margin
+		if toInstant(periodStart, loc).After(to.Add(3 * time.Hour)) {
+			break
+		}
+		if !r.Until.IsZero() && toInstant(periodStart, loc).After(r.Until.Add(3*time.Hour)) {
+			break
+		}
+
+		for _, candidate := range eff.candidates(periodStart, start) {
+			if candidate.Before(start) {
+				continue
+			}
+			t := toInstant(candidate, loc)
+			if !r.Until.IsZero() && t.After(r.Until) {
+				return instances
+			}
+			count++
+			if r.Count > 0 && count > r.Count {
+				return instances
+			}
+			if !t.Before(to) {
+				return instances
+			}
+			if !t.Before(from) {
+				instances = append(instances, t)
+			}
+		}
+	}
+	return instances
+}
+
+// floating drops the location of t, keeping its wall clock, so calendar arithmetic ignores DST
+func floating(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
+
+func toInstant(wall time.Time, loc *time.Location) time.Time {
+	return ical.LocalTime(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), loc)
+}
+
+// withDefaults fills in the BYxxx parts implied by DTSTART (RFC 5545 section 3.3.10)
+func (r *Rule) withDefaults(start time.Time) Rule {
+	eff := *r
+	if len(eff.ByWeekNo) == 0 && len(eff.ByYearDay) == 0 && len(eff.ByMonthDay) == 0 && len(eff.ByDay) == 0 {
+		switch eff.Freq {
+		case Yearly:
+			if len(eff.ByMonth) == 0 {
+				eff.ByMonth = []int{int(start.Month())}
+			}
+			eff.ByMonthDay = []int{start.Day()}
+		case Monthly:
+			eff.ByMonthDay = []int{start.Day()}
+		case Weekly:
+			eff.ByDay = []WeekdayNum{{Weekday: start.Weekday()}}
+		}
+	}
+	if eff.Freq > Hourly && len(eff.ByHour) == 0 {
+		eff.ByHour = []int{start.Hour()}
+	}
+	if eff.Freq > Minutely && len(eff.ByMinute) == 0 {
+		eff.ByMinute = []int{start.Minute()}
+	}
+	if eff.Freq > Secondly && len(eff.BySecond) == 0 {
+		eff.BySecond = []int{start.Second()}
+	}
+	return eff
+}
+
+// skipPeriods returns how many periods can be skipped before reaching from, as a multiple of the interval
+func (r *Rule) skipPeriods(start, from time.Time) int {
+	if !from.After(start) {
+		return 0
+	}
+	var n int
+	switch r.Freq {
+	case Yearly:
+		n = from.Year() - start.Year()
+	case Monthly:
+		n = (from.Year()-start.Year())*12 + int(from.Month()) - int(start.Month())
+	case Weekly:
+		n = int(from.Sub(r.weekStartOf(start)).Hours()/24) / 7
+	case Daily:
+		n = int(from.Sub(dateOf(start)).Hours() / 24)
+	case Hourly:
+		n = int(from.Sub(start).Hours())
+	case Minutely:
+		n = int(from.Sub(start).Minutes())
+	case Secondly:
+		n = int(from.Sub(start).Seconds())
+	}
+	// Step back one interval so periods straddling from are still evaluated
+	k := (n/r.Interval - 1) * r.Interval
+	if k < 0 {
+		return 0
+	}
+	return k
+}
+
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func (r *Rule) weekStartOf(t time.Time) time.Time {
+	offset := (int(t.Weekday()) - int(r.WeekStart) + 7) % 7
+	return dateOf(t).AddDate(0, 0, -offset)
+}
+
+// periodStart returns the beginning of the k-th period after the one containing start
+func (r *Rule) periodStart(start time.Time, k int) time.Time {
+	switch r.Freq {
+	case Yearly:
+		return time.Date(start.Year()+k, 1, 1, 0, 0, 0, 0, time.UTC)
+	case Monthly:
+		return time.Date(start.Year(), start.Month()+time.Month(k), 1, 0, 0, 0, 0, time.UTC)
+	case Weekly:
+		return r.weekStartOf(start).AddDate(0, 0, 7*k)
+	case Daily:
+		return dateOf(start).AddDate(0, 0, k)
+	case Hourly:
+		return time.Date(start.Year(), start.Month(), start.Day(), start.Hour()+k, 0, 0, 0, time.UTC)
+	case Minutely:
+		return time.Date(start.Year(), start.Month(), start.Day(), start.Hour(), start.Minute()+k, 0, 0, time.UTC)
+	default:
+		return start.Add(time.Duration(k) * time.Second)
+	}
+}
+
+// candidates returns the sorted wall-clock instances of one period, after BYSETPOS
+func (r *Rule) candidates(periodStart, start time.Time) []time.Time {
+	var times []time.Time
+	for _, day := range r.periodDays(periodStart) {
+		if !r.matchesDay(day) {
+			continue
+		}
+		times = append(times, r.dayTimes(day, periodStart)...)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	if len(r.BySetPos) == 0 {
+		return times
+	}
+	var selected []time.Time
+	seen := make(map[int]bool)
+	for _, pos := range r.BySetPos {
+		i := pos - 1
+		if pos < 0 {
+			i = len(times) + pos
+		}
+		if i < 0 || i >= len(times) || seen[i] {
+			continue
+		}
+		seen[i] = true
+		selected = append(selected, times[i])
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].Before(selected[j]) })
+	return selected
+}
+
+// periodDays lists the calendar days covered by a period
+func (r *Rule) periodDays(periodStart time.Time) []time.Time {
+	var first, end time.Time
+	switch r.Freq {
+	case Yearly:
+		if len(r.ByWeekNo) > 0 {
+			// Week-numbered years may start in December and end in January
+			first = weekOneStart(periodStart.Year(), r.WeekStart)
+			end = weekOneStart(periodStart.Year()+1, r.WeekStart)
+		} else {
+			first = periodStart
+			end = periodStart.AddDate(1, 0, 0)
+		}
+	case Monthly:
+		first = periodStart
+		end = periodStart.AddDate(0, 1, 0)
+	case Weekly:
+		first = periodStart
+		end = periodStart.AddDate(0, 0, 7)
+	default:
+		first = dateOf(periodStart)
+		end = first.AddDate(0, 0, 1)
+	}
+
+	var days []time.Time
+	for d := first; d.Before(end); d = d.AddDate(0, 0, 1) {
+		days = append(days, d)
+	}
+	return days
+}
+
+// dayTimes returns the instances on a matching day, combining BYHOUR/BYMINUTE/BYSECOND
+// with the fixed fields of sub-daily periods
+func (r *Rule) dayTimes(day, periodStart time.Time) []time.Time {
+	hours, minutes, seconds := r.ByHour, r.ByMinute, r.BySecond
+	if r.Freq <= Hourly {
+		if !containsOrEmpty(hours, periodStart.Hour()) {
+			return nil
+		}
+		hours = []int{periodStart.Hour()}
+	}
+	if r.Freq <= Minutely {
+		if !containsOrEmpty(minutes, periodStart.Minute()) {
+			return nil
+		}
+		minutes = []int{periodStart.Minute()}
+	}
+	if r.Freq == Secondly {
+		if !containsOrEmpty(seconds, periodStart.Second()) {
+			return nil
+		}
+		seconds = []int{periodStart.Second()}
+	}
+
+	var times []time.Time
+	for _, h := range hours {
+		for _, m := range minutes {
+			for _, s := range seconds {
+				times = append(times, time.Date(day.Year(), day.Month(), day.Day(), h, m, s, 0, time.UTC))
+			}
+		}
+	}
+	return times
+}
+
+func containsOrEmpty(values []int, v int) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesDay applies the day-level BYxxx filters
+func (r *Rule) matchesDay(d time.Time) bool {
+	if len(r.ByMonth) > 0 && !containsOrEmpty(r.ByMonth, int(d.Month())) {
+		return false
+	}
+
+	if len(r.ByWeekNo) > 0 {
+		week, weeksInYear := weekNumber(d, r.WeekStart)
+		if !matchesSigned(r.ByWeekNo, week, weeksInYear) {
+			return false
+		}
+	}
+
+	daysInYear := time.Date(d.Year(), 12, 31, 0, 0, 0, 0, time.UTC).YearDay()
+	if len(r.ByYearDay) > 0 && !matchesSigned(r.ByYearDay, d.YearDay(), daysInYear) {
+		return false
+	}
+
+	daysInMonth := time.Date(d.Year(), d.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if len(r.ByMonthDay) > 0 && !matchesSigned(r.ByMonthDay, d.Day(), daysInMonth) {
+		return false
+	}
+
+	if len(r.ByDay) > 0 {
+		matched := false
+		for _, wd := range r.ByDay {
+			if wd.Weekday != d.Weekday() {
+				continue
+			}
+			if wd.N == 0 {
+				matched = true
+				break
+			}
+			switch {
+			case r.Freq == Monthly || (r.Freq == Yearly && len(r.ByMonth) > 0):
+				matched = ordinalMatches(wd.N, d.Day(), daysInMonth)
+			case r.Freq == Yearly:
+				matched = ordinalMatches(wd.N, d.YearDay(), daysInYear)
+			default:
+				// Ordinals are only meaningful for MONTHLY and YEARLY rules
+				matched = true
+			}
+			if matched {
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesSigned reports whether value (1-based) matches any entry, where negative entries count from total
+func matchesSigned(entries []int, value, total int) bool {
+	for _, n := range entries {
+		if n == value || (n < 0 && total+1+n == value) {
+			return true
+		}
+	}
+	return false
+}
+
+// ordinalMatches reports whether the day at position (1-based) in a span of total days is the n-th such weekday
+func ordinalMatches(n, position, total int) bool {
+	if n > 0 {
+		return (position-1)/7+1 == n
+	}
+	return -((total-position)/7 + 1) == n
+}
+
+// weekOneStart returns the first day of week 1: the first week starting on wkst with at least four days in year
+func weekOneStart(year int, wkst time.Weekday) time.Time {
+	jan1 := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+	offset := (int(jan1.Weekday()) - int(wkst) + 7) % 7
+	start := jan1.AddDate(0, 0, -offset)
+	if offset > 3 {
+		start = start.AddDate(0, 0, 7)
+	}
+	return start
+}
+
+// weekNumber returns the week number of d and the number of weeks in its week-numbering year
+func weekNumber(d time.Time, wkst time.Weekday) (int, int) {
+	year := d.Year()
+	start := weekOneStart(year, wkst)
+	if d.Before(start) {
+		year--
+		start = weekOneStart(year, wkst)
+	} else if next := weekOneStart(year+1, wkst); !d.Before(next) {
+		year++
+		start = next
+	}
+	weeks := int(weekOneStart(year+1, wkst).Sub(start).Hours()/24) / 7
+	return int(d.Sub(start).Hours()/24)/7 + 1, weeks
+}
@@ -0,0 +1,362 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+
+	"family-calendar-backend/ical"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var newYork = ical.LoadLocation("America/New_York")
+
+// localStart parses a wall-clock DTSTART such as "19970902T090000" in America/New_York
+func localStart(t *testing.T, value string) time.Time {
+	t.Helper()
+	start, _, err := ical.ParseDateTime(ical.Property{
+		Name:   "DTSTART",
+		Params: map[string][]string{"TZID": {"America/New_York"}},
+		Value:  value,
+	})
+	require.NoError(t, err)
+	return start
+}
+
+func formatLocal(times []time.Time) []string {
+	formatted := make([]string, 0, len(times))
+	for _, t := range times {
+		formatted = append(formatted, t.In(newYork).Format("20060102T150405"))
+	}
+	return formatted
+}
+
+// The examples of RFC 5545 section 3.8.5.3, all with DTSTART in America/New_York.
+// Unbounded rules are compared on their first len(want) instances.
+func TestRuleBetween_RFC5545Examples(t *testing.T) {
+	tests := []struct {
+		name    string
+		dtstart string
+		rule    string
+		want    []string
+	}{
+		{
+			name:    "Daily for 10 occurrences",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=DAILY;COUNT=10",
+			want: []string{
+				"19970902T090000", "19970903T090000", "19970904T090000", "19970905T090000", "19970906T090000",
+				"19970907T090000", "19970908T090000", "19970909T090000", "19970910T090000", "19970911T090000",
+			},
+		},
+		{
+			name:    "Every other day",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=DAILY;INTERVAL=2",
+			want:    []string{"19970902T090000", "19970904T090000", "19970906T090000", "19970908T090000"},
+		},
+		{
+			name:    "Every 10 days, 5 occurrences",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=DAILY;INTERVAL=10;COUNT=5",
+			want:    []string{"19970902T090000", "19970912T090000", "19970922T090000", "19971002T090000", "19971012T090000"},
+		},
+		{
+			name:    "Weekly for 10 occurrences across the end of DST",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=WEEKLY;COUNT=10",
+			want: []string{
+				"19970902T090000", "19970909T090000", "19970916T090000", "19970923T090000", "19970930T090000",
+				"19971007T090000", "19971014T090000", "19971021T090000", "19971028T090000", "19971104T090000",
+			},
+		},
+		{
+			name:    "Weekly on Tuesday and Thursday for five weeks",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=WEEKLY;UNTIL=19971007T000000Z;WKST=SU;BYDAY=TU,TH",
+			want: []string{
+				"19970902T090000", "19970904T090000", "19970909T090000", "19970911T090000", "19970916T090000",
+				"19970918T090000", "19970923T090000", "19970925T090000", "19970930T090000", "19971002T090000",
+			},
+		},
+		{
+			name:    "Every other week on Monday, Wednesday and Friday until December 24",
+			dtstart: "19970901T090000",
+			rule:    "FREQ=WEEKLY;INTERVAL=2;UNTIL=19971224T000000Z;WKST=SU;BYDAY=MO,WE,FR",
+			want: []string{
+				"19970901T090000", "19970903T090000", "19970905T090000", "19970915T090000", "19970917T090000",
+				"19970919T090000", "19970929T090000", "19971001T090000", "19971003T090000", "19971013T090000",
+				"19971015T090000", "19971017T090000", "19971027T090000", "19971029T090000", "19971031T090000",
+				"19971110T090000", "19971112T090000", "19971114T090000", "19971124T090000", "19971126T090000",
+				"19971128T090000", "19971208T090000", "19971210T090000", "19971212T090000", "19971222T090000",
+			},
+		},
+		{
+			name:    "Every other week on Tuesday and Thursday, for 8 occurrences",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=WEEKLY;INTERVAL=2;COUNT=8;WKST=SU;BYDAY=TU,TH",
+			want: []string{
+				"19970902T090000", "19970904T090000", "19970916T090000", "19970918T090000",
+				"19970930T090000", "19971002T090000", "19971014T090000", "19971016T090000",
+			},
+		},
+		{
+			name:    "Monthly on the first Friday for 10 occurrences",
+			dtstart: "19970905T090000",
+			rule:    "FREQ=MONTHLY;COUNT=10;BYDAY=1FR",
+			want: []string{
+				"19970905T090000", "19971003T090000", "19971107T090000", "19971205T090000", "19980102T090000",
+				"19980206T090000", "19980306T090000", "19980403T090000", "19980501T090000", "19980605T090000",
+			},
+		},
+		{
+			name:    "Monthly on the second-to-last Monday for 6 months",
+			dtstart: "19970922T090000",
+			rule:    "FREQ=MONTHLY;COUNT=6;BYDAY=-2MO",
+			want: []string{
+				"19970922T090000", "19971020T090000", "19971117T090000",
+				"19971222T090000", "19980119T090000", "19980216T090000",
+			},
+		},
+		{
+			name:    "Monthly on the third-to-the-last day of the month",
+			dtstart: "19970928T090000",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=-3",
+			want:    []string{"19970928T090000", "19971029T090000", "19971128T090000", "19971229T090000", "19980129T090000", "19980226T090000"},
+		},
+		{
+			name:    "Monthly on the 2nd and 15th for 10 occurrences",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=MONTHLY;COUNT=10;BYMONTHDAY=2,15",
+			want: []string{
+				"19970902T090000", "19970915T090000", "19971002T090000", "19971015T090000", "19971102T090000",
+				"19971115T090000", "19971202T090000", "19971215T090000", "19980102T090000", "19980115T090000",
+			},
+		},
+		{
+			name:    "Every Tuesday, every other month",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=MONTHLY;INTERVAL=2;BYDAY=TU",
+			want: []string{
+				"19970902T090000", "19970909T090000", "19970916T090000", "19970923T090000", "19970930T090000",
+				"19971104T090000", "19971111T090000", "19971118T090000", "19971125T090000", "19980106T090000",
+			},
+		},
+		{
+			name:    "Yearly in June and July for 10 occurrences",
+			dtstart: "19970610T090000",
+			rule:    "FREQ=YEARLY;COUNT=10;BYMONTH=6,7",
+			want: []string{
+				"19970610T090000", "19970710T090000", "19980610T090000", "19980710T090000", "19990610T090000",
+				"19990710T090000", "20000610T090000", "20000710T090000", "20010610T090000", "20010710T090000",
+			},
+		},
+		{
+			name:    "Every third year on the 1st, 100th and 200th day for 10 occurrences",
+			dtstart: "19970101T090000",
+			rule:    "FREQ=YEARLY;INTERVAL=3;COUNT=10;BYYEARDAY=1,100,200",
+			want: []string{
+				"19970101T090000", "19970410T090000", "19970719T090000", "20000101T090000", "20000409T090000",
+				"20000718T090000", "20030101T090000", "20030410T090000", "20030719T090000", "20060101T090000",
+			},
+		},
+		{
+			name:    "Every 20th Monday of the year",
+			dtstart: "19970519T090000",
+			rule:    "FREQ=YEARLY;BYDAY=20MO",
+			want:    []string{"19970519T090000", "19980518T090000", "19990517T090000"},
+		},
+		{
+			name:    "Monday of week number 20",
+			dtstart: "19970512T090000",
+			rule:    "FREQ=YEARLY;BYWEEKNO=20;BYDAY=MO",
+			want:    []string{"19970512T090000", "19980511T090000", "19990517T090000"},
+		},
+		{
+			name:    "Every Thursday in March",
+			dtstart: "19970313T090000",
+			rule:    "FREQ=YEARLY;BYMONTH=3;BYDAY=TH",
+			want: []string{
+				"19970313T090000", "19970320T090000", "19970327T090000", "19980305T090000", "19980312T090000",
+				"19980319T090000", "19980326T090000", "19990304T090000", "19990311T090000", "19990318T090000",
+				"19990325T090000",
+			},
+		},
+		{
+			name:    "Every Friday the 13th",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=MONTHLY;BYDAY=FR;BYMONTHDAY=13",
+			want:    []string{"19980213T090000", "19980313T090000", "19981113T090000", "19990813T090000", "20001013T090000"},
+		},
+		{
+			name:    "First Saturday that follows the first Sunday of the month",
+			dtstart: "19970913T090000",
+			rule:    "FREQ=MONTHLY;BYDAY=SA;BYMONTHDAY=7,8,9,10,11,12,13",
+			want: []string{
+				"19970913T090000", "19971011T090000", "19971108T090000", "19971213T090000", "19980110T090000",
+				"19980207T090000", "19980307T090000", "19980411T090000", "19980509T090000", "19980613T090000",
+			},
+		},
+		{
+			name:    "US Presidential Election day every four years",
+			dtstart: "19961105T090000",
+			rule:    "FREQ=YEARLY;INTERVAL=4;BYMONTH=11;BYDAY=TU;BYMONTHDAY=2,3,4,5,6,7,8",
+			want:    []string{"19961105T090000", "20001107T090000", "20041102T090000"},
+		},
+		{
+			name:    "Third instance of Tuesday, Wednesday or Thursday for the next 3 months",
+			dtstart: "19970904T090000",
+			rule:    "FREQ=MONTHLY;COUNT=3;BYDAY=TU,WE,TH;BYSETPOS=3",
+			want:    []string{"19970904T090000", "19971007T090000", "19971106T090000"},
+		},
+		{
+			name:    "Second-to-last weekday of the month",
+			dtstart: "19970929T090000",
+			rule:    "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-2",
+			want:    []string{"19970929T090000", "19971030T090000", "19971127T090000", "19971230T090000", "19980129T090000", "19980226T090000"},
+		},
+		{
+			name:    "Every 15 minutes for 6 occurrences",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=MINUTELY;INTERVAL=15;COUNT=6",
+			want:    []string{"19970902T090000", "19970902T091500", "19970902T093000", "19970902T094500", "19970902T100000", "19970902T101500"},
+		},
+		{
+			name:    "Every 20 minutes from 9:00 to 16:40",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=DAILY;BYHOUR=9,10,11,12,13,14,15,16;BYMINUTE=0,20,40",
+			want:    []string{"19970902T090000", "19970902T092000", "19970902T094000", "19970902T100000", "19970902T102000"},
+		},
+		{
+			name:    "Every 3 hours, bounded by UNTIL",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=HOURLY;INTERVAL=3;UNTIL=19970902T210000Z",
+			want:    []string{"19970902T090000", "19970902T120000", "19970902T150000"},
+		},
+		{
+			name:    "WKST=MO changes the weeks considered",
+			dtstart: "19970805T090000",
+			rule:    "FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=MO",
+			want:    []string{"19970805T090000", "19970810T090000", "19970819T090000", "19970824T090000"},
+		},
+		{
+			name:    "WKST=SU changes the weeks considered",
+			dtstart: "19970805T090000",
+			rule:    "FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=SU",
+			want:    []string{"19970805T090000", "19970817T090000", "19970819T090000", "19970831T090000"},
+		},
+		{
+			name:    "Invalid dates such as February 30 are skipped",
+			dtstart: "20070115T090000",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=15,30;COUNT=5",
+			want:    []string{"20070115T090000", "20070130T090000", "20070215T090000", "20070315T090000", "20070330T090000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dtstart := localStart(t, tt.dtstart)
+			rule, err := ParseRule(tt.rule, newYork)
+			require.NoError(t, err)
+
+			got := formatLocal(rule.Between(dtstart, dtstart, dtstart.AddDate(10, 0, 0)))
+			if len(got) > len(tt.want) {
+				got = got[:len(tt.want)]
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRuleBetween_CountAndUntilAreExhaustive(t *testing.T) {
+	tests := []struct {
+		name    string
+		dtstart string
+		rule    string
+		count   int
+		last    string
+	}{
+		{name: "Daily until December 24", dtstart: "19970902T090000", rule: "FREQ=DAILY;UNTIL=19971224T000000Z", count: 113, last: "19971223T090000"},
+		{
+			name:    "Every day in January for 3 years",
+			dtstart: "19980101T090000",
+			rule:    "FREQ=YEARLY;UNTIL=20000131T140000Z;BYMONTH=1;BYDAY=SU,MO,TU,WE,TH,FR,SA",
+			count:   93,
+			last:    "20000131T090000",
+		},
+		{name: "Weekly until a date-only UNTIL", dtstart: "19970902T090000", rule: "FREQ=WEEKLY;UNTIL=19970930", count: 5, last: "19970930T090000"},
+		{name: "Yearly for 3 occurrences", dtstart: "19970902T090000", rule: "FREQ=YEARLY;COUNT=3", count: 3, last: "19990902T090000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dtstart := localStart(t, tt.dtstart)
+			rule, err := ParseRule(tt.rule, newYork)
+			require.NoError(t, err)
+
+			got := formatLocal(rule.Between(dtstart, dtstart, dtstart.AddDate(10, 0, 0)))
+			assert.Len(t, got, tt.count)
+			assert.Equal(t, tt.last, got[len(got)-1])
+		})
+	}
+}
+
+func TestRuleBetween_KeepsWallClockAcrossDST(t *testing.T) {
+	dtstart := localStart(t, "20250301T090000")
+	rule, err := ParseRule("FREQ=WEEKLY;COUNT=3", newYork)
+	require.NoError(t, err)
+
+	got := rule.Between(dtstart, dtstart, dtstart.AddDate(1, 0, 0))
+
+	require.Len(t, got, 3)
+	// 09:00 EST, then 09:00 EDT after the March 9 transition
+	assert.Equal(t, "2025-03-01T14:00:00Z", got[0].UTC().Format(time.RFC3339))
+	assert.Equal(t, "2025-03-08T14:00:00Z", got[1].UTC().Format(time.RFC3339))
+	assert.Equal(t, "2025-03-15T13:00:00Z", got[2].UTC().Format(time.RFC3339))
+}
+
+func TestRuleBetween_NonexistentLocalTime(t *testing.T) {
+	dtstart := localStart(t, "20250307T023000")
+	rule, err := ParseRule("FREQ=DAILY;COUNT=4", newYork)
+	require.NoError(t, err)
+
+	got := formatLocal(rule.Between(dtstart, dtstart, dtstart.AddDate(0, 1, 0)))
+
+	// 02:30 does not exist on March 9 and shifts forward by the length of the gap
+	assert.Equal(t, []string{"20250307T023000", "20250308T023000", "20250309T033000", "20250310T023000"}, got)
+}
+
+func TestRuleBetween_Window(t *testing.T) {
+	dtstart := localStart(t, "20000103T090000")
+	rule, err := ParseRule("FREQ=DAILY;INTERVAL=3", newYork)
+	require.NoError(t, err)
+
+	// Far from DTSTART, the window alone bounds the work and the phase of INTERVAL is kept
+	from := localStart(t, "20250601T000000")
+	to := localStart(t, "20250610T000000")
+	got := formatLocal(rule.Between(dtstart, from, to))
+
+	assert.Equal(t, []string{"20250602T090000", "20250605T090000", "20250608T090000"}, got)
+}
+
+func TestRuleBetween_WindowHonoursCount(t *testing.T) {
+	dtstart := localStart(t, "20250101T090000")
+	rule, err := ParseRule("FREQ=DAILY;COUNT=5", newYork)
+	require.NoError(t, err)
+
+	got := formatLocal(rule.Between(dtstart, localStart(t, "20250104T000000"), localStart(t, "20250201T000000")))
+
+	assert.Equal(t, []string{"20250104T090000", "20250105T090000"}, got)
+}
+
+func TestRuleBetween_AllDay(t *testing.T) {
+	dtstart := time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)
+	rule, err := ParseRule("FREQ=YEARLY;COUNT=2", time.UTC)
+	require.NoError(t, err)
+
+	got := rule.Between(dtstart, dtstart, dtstart.AddDate(10, 0, 0))
+
+	// Leap days only recur in leap years
+	assert.Equal(t, []time.Time{dtstart, time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)}, got)
+}
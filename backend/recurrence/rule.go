@@ -0,0 +1,201 @@
+package recurrence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"family-calendar-backend/ical"
+)
+
+// Frequency is the FREQ part of an RRULE
+type Frequency int
+
+const (
+	Secondly Frequency = iota
+	Minutely
+	Hourly
+	Daily
+	Weekly
+	Monthly
+	Yearly
+)
+
+var frequencies = map[string]Frequency{
+	"SECONDLY": Secondly,
+	"MINUTELY": Minutely,
+	"HOURLY":   Hourly,
+	"DAILY":    Daily,
+	"WEEKLY":   Weekly,
+	"MONTHLY":  Monthly,
+	"YEARLY":   Yearly,
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// WeekdayNum is a BYDAY entry such as "MO", "2TU" or "-1FR"
+type WeekdayNum struct {
+	Weekday time.Weekday
+	// N is the ordinal within the month or year; 0 means every such weekday
+	N int
+}
+
+// Rule is a parsed RRULE (RFC 5545 section 3.3.10)
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	// Count is 0 when the rule is not bounded by a count
+	Count int
+	// Until is the zero time when the rule is not bounded by a date
+	Until      time.Time
+	ByMonth    []int
+	ByWeekNo   []int
+	ByYearDay  []int
+	ByMonthDay []int
+	ByDay      []WeekdayNum
+	ByHour     []int
+	ByMinute   []int
+	BySecond   []int
+	BySetPos   []int
+	WeekStart  time.Weekday
+}
+
+// ParseRule parses an RRULE value such as "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10".
+// A date-only UNTIL is interpreted as the end of that day in loc.
+func ParseRule(value string, loc *time.Location) (*Rule, error) {
+	rule := &Rule{Interval: 1, WeekStart: time.Monday}
+	hasFreq := false
+
+	for _, part := range strings.Split(value, ";") {
+		if part == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("recurrence: malformed rule part %q", part)
+		}
+
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.Freq, hasFreq = frequencies[strings.ToUpper(val)]
+			if !hasFreq {
+				return nil, fmt.Errorf("recurrence: unsupported FREQ %q", val)
+			}
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(val)
+			if err == nil && rule.Interval < 1 {
+				err = fmt.Errorf("recurrence: INTERVAL must be positive")
+			}
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(val)
+			if err == nil && rule.Count < 1 {
+				err = fmt.Errorf("recurrence: COUNT must be positive")
+			}
+		case "UNTIL":
+			rule.Until, err = parseUntil(val, loc)
+		case "BYMONTH":
+			rule.ByMonth, err = parseIntList(val, 1, 12, false)
+		case "BYWEEKNO":
+			rule.ByWeekNo, err = parseIntList(val, 1, 53, true)
+		case "BYYEARDAY":
+			rule.ByYearDay, err = parseIntList(val, 1, 366, true)
+		case "BYMONTHDAY":
+			rule.ByMonthDay, err = parseIntList(val, 1, 31, true)
+		case "BYDAY":
+			rule.ByDay, err = parseWeekdayList(val)
+		case "BYHOUR":
+			rule.ByHour, err = parseIntList(val, 0, 23, false)
+		case "BYMINUTE":
+			rule.ByMinute, err = parseIntList(val, 0, 59, false)
+		case "BYSECOND":
+			rule.BySecond, err = parseIntList(val, 0, 60, false)
+		case "BYSETPOS":
+			rule.BySetPos, err = parseIntList(val, 1, 366, true)
+		case "WKST":
+			var ok bool
+			rule.WeekStart, ok = weekdays[strings.ToUpper(val)]
+			if !ok {
+				err = fmt.Errorf("recurrence: invalid WKST %q", val)
+			}
+		default:
+			// Unknown parts (e.g. RSCALE, SKIP) are ignored rather than rejecting the event
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !hasFreq {
+		return nil, fmt.Errorf("recurrence: rule %q has no FREQ", value)
+	}
+	return rule, nil
+}
+
+func parseUntil(value string, loc *time.Location) (time.Time, error) {
+	t, allDay, err := ical.ParseDateTime(ical.Property{Value: value})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if allDay {
+		// Inclusive: the whole UNTIL day counts
+		return time.Date(t.Year(), t.Month(), t.Day(), 23, 59, 59, 0, loc), nil
+	}
+	if !strings.HasSuffix(value, "Z") {
+		// Floating UNTIL is interpreted in the DTSTART timezone
+		return ical.LocalTime(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), loc), nil
+	}
+	return t, nil
+}
+
+func parseIntList(value string, min, max int, allowNegative bool) ([]int, error) {
+	var values []int
+	for _, item := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimPrefix(item, "+"))
+		if err != nil {
+			return nil, fmt.Errorf("recurrence: invalid number %q", item)
+		}
+		abs := n
+		if n < 0 && allowNegative {
+			abs = -n
+		}
+		if abs < min || abs > max {
+			return nil, fmt.Errorf("recurrence: value %d out of range", n)
+		}
+		values = append(values, n)
+	}
+	return values, nil
+}
+
+func parseWeekdayList(value string) ([]WeekdayNum, error) {
+	var days []WeekdayNum
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToUpper(strings.TrimSpace(item))
+		if len(item) < 2 {
+			return nil, fmt.Errorf("recurrence: invalid BYDAY %q", item)
+		}
+		weekday, ok := weekdays[item[len(item)-2:]]
+		if !ok {
+			return nil, fmt.Errorf("recurrence: invalid BYDAY %q", item)
+		}
+		n := 0
+		if prefix := item[:len(item)-2]; prefix != "" {
+			var err error
+			n, err = strconv.Atoi(strings.TrimPrefix(prefix, "+"))
+			if err != nil || n == 0 || n > 53 || n < -53 {
+				return nil, fmt.Errorf("recurrence: invalid BYDAY %q", item)
+			}
+		}
+		days = append(days, WeekdayNum{Weekday: weekday, N: n})
+	}
+	return days, nil
+}
@@ -0,0 +1,89 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule("FREQ=MONTHLY;INTERVAL=2;COUNT=10;BYDAY=1FR,-1SU,TU;BYMONTHDAY=-3,15;BYSETPOS=-1;WKST=SU", newYork)
+	require.NoError(t, err)
+
+	assert.Equal(t, Monthly, rule.Freq)
+	assert.Equal(t, 2, rule.Interval)
+	assert.Equal(t, 10, rule.Count)
+	assert.True(t, rule.Until.IsZero())
+	assert.Equal(t, []WeekdayNum{{Weekday: time.Friday, N: 1}, {Weekday: time.Sunday, N: -1}, {Weekday: time.Tuesday}}, rule.ByDay)
+	assert.Equal(t, []int{-3, 15}, rule.ByMonthDay)
+	assert.Equal(t, []int{-1}, rule.BySetPos)
+	assert.Equal(t, time.Sunday, rule.WeekStart)
+}
+
+func TestParseRule_Defaults(t *testing.T) {
+	rule, err := ParseRule("FREQ=daily", newYork)
+	require.NoError(t, err)
+
+	assert.Equal(t, Daily, rule.Freq)
+	assert.Equal(t, 1, rule.Interval)
+	assert.Equal(t, 0, rule.Count)
+	assert.Equal(t, time.Monday, rule.WeekStart)
+}
+
+func TestParseRule_Until(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "UTC", value: "FREQ=DAILY;UNTIL=19971224T000000Z", want: "1997-12-24T00:00:00Z"},
+		{name: "Floating uses the DTSTART timezone", value: "FREQ=DAILY;UNTIL=19971224T090000", want: "1997-12-24T14:00:00Z"},
+		{name: "Date includes the whole day", value: "FREQ=DAILY;UNTIL=19971224", want: "1997-12-25T04:59:59Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseRule(tt.value, newYork)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, rule.Until.UTC().Format(time.RFC3339))
+		})
+	}
+}
+
+func TestParseRule_IgnoresUnknownParts(t *testing.T) {
+	rule, err := ParseRule("FREQ=YEARLY;RSCALE=GREGORIAN;SKIP=OMIT", newYork)
+
+	assert.NoError(t, err)
+	assert.Equal(t, Yearly, rule.Freq)
+}
+
+func TestParseRule_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "Empty", value: ""},
+		{name: "Missing FREQ", value: "COUNT=3"},
+		{name: "Unknown FREQ", value: "FREQ=FORTNIGHTLY"},
+		{name: "Malformed part", value: "FREQ=DAILY;COUNT"},
+		{name: "Zero interval", value: "FREQ=DAILY;INTERVAL=0"},
+		{name: "Negative count", value: "FREQ=DAILY;COUNT=-1"},
+		{name: "Bad UNTIL", value: "FREQ=DAILY;UNTIL=tomorrow"},
+		{name: "Month out of range", value: "FREQ=YEARLY;BYMONTH=13"},
+		{name: "Negative month", value: "FREQ=YEARLY;BYMONTH=-1"},
+		{name: "Month day out of range", value: "FREQ=MONTHLY;BYMONTHDAY=32"},
+		{name: "Bad weekday", value: "FREQ=WEEKLY;BYDAY=XX"},
+		{name: "Zero ordinal", value: "FREQ=MONTHLY;BYDAY=0MO"},
+		{name: "Bad WKST", value: "FREQ=WEEKLY;WKST=XY"},
+		{name: "Hour out of range", value: "FREQ=DAILY;BYHOUR=24"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRule(tt.value, newYork)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package rest_api_handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"family-calendar-backend/auth"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/services"
+	"family-calendar-backend/rest_api_handlers/utils"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+// accountArchiveVersion is the version of the account archive format. It changes when archives
+// of the previous version can no longer be imported as they are.
+const accountArchiveVersion = 1
+
+// buildAccountArchive converts exported account data into an archive
+func buildAccountArchive(data *services.AccountData, exportedAt time.Time) AccountArchive {
+	archive := AccountArchive{
+		Version:    accountArchiveVersion,
+		ExportedAt: exportedAt.UTC().Format("2006-01-02T15:04:05Z07:00"),
+		Profile: AccountArchiveProfile{
+			GivenName:  data.User.GivenName,
+			FamilyName: data.User.FamilyName,
+			Email:      data.User.Email,
+		},
+		Households:      make([]AccountArchiveHousehold, 0, len(data.Households)),
+		CalendarMuxes:   make([]AccountArchiveCalendarMux, 0, len(data.CalendarMuxes)),
+		CalendarSources: make([]AccountArchiveCalendarSource, 0, len(data.CalendarSources)),
+		RewriteRules:    make([]AccountArchiveRewriteRule, 0, len(data.RewriteRules)),
+	}
+	for _, household := range data.Households {
+		members := make([]AccountArchiveHouseholdMember, 0, len(household.Members))
+		for _, member := range household.Members {
+			members = append(members, AccountArchiveHouseholdMember{ID: member.ID, Email: member.User.Email, Role: member.Role})
+		}
+		archive.Households = append(archive.Households, AccountArchiveHousehold{
+			ID:      household.Household.ID,
+			Name:    household.Household.Name,
+			Role:    household.Role,
+			Members: members,
+		})
+	}
+	for _, calendarMux := range data.CalendarMuxes {
+		archive.CalendarMuxes = append(archive.CalendarMuxes, AccountArchiveCalendarMux{
+			ID:           calendarMux.ID,
+			Name:         calendarMux.Name,
+			Description:  calendarMux.Description,
+			DedupEnabled: !calendarMux.DedupDisabled,
+			HouseholdID:  calendarMux.HouseholdID,
+		})
+	}
+	for _, calendarSource := range data.CalendarSources {
+		archive.CalendarSources = append(archive.CalendarSources, AccountArchiveCalendarSource{
+			ID:            calendarSource.ID,
+			CalendarMuxID: calendarSource.CalendarMuxID,
+			URL:           calendarSource.URL,
+			Label:         calendarSource.Label,
+			Enabled:       calendarSource.Enabled,
+			Visibility:    calendarSource.Visibility,
+		})
+	}
+	for _, rule := range data.RewriteRules {
+		archive.RewriteRules = append(archive.RewriteRules, AccountArchiveRewriteRule{
+			ID:               rule.ID,
+			CalendarSourceID: rule.CalendarSourceID,
+			Position:         rule.Position,
+			Action:           rule.Action,
+			Pattern:          rule.Pattern,
+			Value:            rule.Value,
+		})
+	}
+	return archive
+}
+
+// accountDataFromArchive converts a validated archive into account data to import
+func accountDataFromArchive(archive AccountArchive) *services.AccountData {
+	data := &services.AccountData{
+		User: models.User{GivenName: archive.Profile.GivenName, FamilyName: archive.Profile.FamilyName, Email: archive.Profile.Email},
+	}
+	for _, household := range archive.Households {
+		imported := services.AccountHousehold{
+			Household: models.Household{Model: gorm.Model{ID: household.ID}, Name: household.Name},
+			Role:      household.Role,
+		}
+		for _, member := range household.Members {
+			imported.Members = append(imported.Members, models.HouseholdMember{
+				ID:          member.ID,
+				HouseholdID: household.ID,
+				User:        models.User{Email: member.Email},
+				Role:        member.Role,
+			})
+		}
+		data.Households = append(data.Households, imported)
+	}
+	for _, calendarMux := range archive.CalendarMuxes {
+		data.CalendarMuxes = append(data.CalendarMuxes, models.CalendarMux{
+			Model:         gorm.Model{ID: calendarMux.ID},
+			Name:          calendarMux.Name,
+			Description:   calendarMux.Description,
+			DedupDisabled: !calendarMux.DedupEnabled,
+			HouseholdID:   calendarMux.HouseholdID,
+		})
+	}
+	for _, calendarSource := range archive.CalendarSources {
+		data.CalendarSources = append(data.CalendarSources, models.CalendarSource{
+			Model:         gorm.Model{ID: calendarSource.ID},
+			CalendarMuxID: calendarSource.CalendarMuxID,
+			URL:           calendarSource.URL,
+			Label:         calendarSource.Label,
+			Enabled:       calendarSource.Enabled,
+			Visibility:    calendarSource.Visibility,
+		})
+	}
+	for _, rule := range archive.RewriteRules {
+		data.RewriteRules = append(data.RewriteRules, models.RewriteRule{
+			Model:            gorm.Model{ID: rule.ID},
+			CalendarSourceID: rule.CalendarSourceID,
+			Position:         rule.Position,
+			Action:           rule.Action,
+			Pattern:          rule.Pattern,
+			Value:            rule.Value,
+		})
+	}
+	return data
+}
+
+// jsonFieldPath turns the Go namespace of a validation error, such as
+// "AccountArchive.CalendarSources[2].URL", into the JSON path of the field, "calendar_sources[2].url"
+func jsonFieldPath(root reflect.Type, namespace string) string {
+	segments := strings.Split(namespace, ".")[1:]
+	current := root
+	for i, segment := range segments {
+		name, index, indexed := strings.Cut(segment, "[")
+		field, ok := current.FieldByName(name)
+		if !ok {
+			break
+		}
+		segments[i] = strings.Split(field.Tag.Get("json"), ",")[0]
+		if indexed {
+			segments[i] += "[" + index
+		}
+		current = field.Type
+		for current.Kind() == reflect.Slice || current.Kind() == reflect.Ptr {
+			current = current.Elem()
+		}
+	}
+	return strings.Join(segments, ".")
+}
+
+// validateAccountArchive checks an archive, returning the problems by JSON path. The URLs of its
+// sources are normalized as for new sources.
+func validateAccountArchive(archive *AccountArchive) map[string]string {
+	fields := map[string]string{}
+	if err := validate.Struct(archive); err != nil {
+		for _, fieldError := range err.(validator.ValidationErrors) {
+			fields[jsonFieldPath(reflect.TypeOf(*archive), fieldError.StructNamespace())] = utils.GetValidationErrorMsg(fieldError)
+		}
+		return fields
+	}
+
+	// IDs identify the entities within their collection, so that references are unambiguous
+	seen := map[string]bool{}
+	checkID := func(collection string, id uint, path string) {
+		key := fmt.Sprintf("%s:%d", collection, id)
+		if seen[key] {
+			fields[path+".id"] = "Duplicate ID"
+		}
+		seen[key] = true
+	}
+	for i, household := range archive.Households {
+		checkID("households", household.ID, fmt.Sprintf("households[%d]", i))
+		for j, member := range household.Members {
+			checkID("members", member.ID, fmt.Sprintf("households[%d].members[%d]", i, j))
+		}
+	}
+	for i, calendarMux := range archive.CalendarMuxes {
+		checkID("calendar_muxes", calendarMux.ID, fmt.Sprintf("calendar_muxes[%d]", i))
+	}
+	for i, calendarSource := range archive.CalendarSources {
+		checkID("calendar_sources", calendarSource.ID, fmt.Sprintf("calendar_sources[%d]", i))
+		sourceURL, ok := normalizeSourceURL(calendarSource.URL)
+		if !ok {
+			fields[fmt.Sprintf("calendar_sources[%d].url", i)] = "URL must use http, https or webcal and a public host"
+		}
+		archive.CalendarSources[i].URL = sourceURL
+	}
+	for i, rule := range archive.RewriteRules {
+		checkID("rewrite_rules", rule.ID, fmt.Sprintf("rewrite_rules[%d]", i))
+		ruleFields := validateRewriteRuleRequest(RewriteRuleRequest{Action: rule.Action, Pattern: rule.Pattern, Value: rule.Value})
+		for field, message := range ruleFields {
+			fields[fmt.Sprintf("rewrite_rules[%d].%s", i, field)] = message
+		}
+	}
+	return fields
+}
+
+// ExportAccount returns an archive of the authenticated user's profile, household memberships,
+// and the calendar muxes they created with their sources and rewrite rules
+func ExportAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	data, err := services.ExportAccount(userID)
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			utils.RespondError(w, http.StatusNotFound, "User not found", nil)
+			return
+		}
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to export account", nil)
+		return
+	}
+
+	response := buildAccountArchive(data, time.Now())
+	if err := validate.Struct(response); err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Response validation failed", nil)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="family-calendar-export.json"`)
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+// ImportAccount recreates the contents of an account archive in the authenticated user's account
+// with new IDs, and reports how the IDs were mapped and what could not be imported as it was
+func ImportAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	var archive AccountArchive
+	if err := json.NewDecoder(r.Body).Decode(&archive); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid request body", nil)
+		return
+	}
+	if archive.Version != accountArchiveVersion {
+		utils.RespondError(w, http.StatusBadRequest, "Unsupported archive version", map[string]string{
+			"version": fmt.Sprintf("Must be %d", accountArchiveVersion),
+		})
+		return
+	}
+	if fields := validateAccountArchive(&archive); len(fields) > 0 {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid archive", fields)
+		return
+	}
+
+	result, err := services.ImportAccount(userID, accountDataFromArchive(archive), middleware.GetReqID(r.Context()))
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			utils.RespondError(w, http.StatusNotFound, "User not found", nil)
+			return
+		}
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to import account", nil)
+		return
+	}
+
+	response := AccountImportAPIResponse{
+		IDs: AccountImportIDsAPIResponse{
+			Households:      result.Households,
+			CalendarMuxes:   result.CalendarMuxes,
+			CalendarSources: result.CalendarSources,
+			RewriteRules:    result.RewriteRules,
+		},
+		Conflicts: make([]AccountImportConflictAPIResponse, 0, len(result.Conflicts)),
+	}
+	for _, conflict := range result.Conflicts {
+		response.Conflicts = append(response.Conflicts, AccountImportConflictAPIResponse{
+			EntityType: conflict.EntityType,
+			ID:         conflict.ID,
+			Message:    conflict.Reason,
+		})
+	}
+
+	if err := validate.Struct(response); err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Response validation failed", nil)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, response)
+}
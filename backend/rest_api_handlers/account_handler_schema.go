@@ -0,0 +1,81 @@
+package rest_api_handlers
+
+// AccountArchive is the data of a user account as exported and imported. Entities carry the IDs
+// of the instance they were exported from, which the other entities reference them by.
+type AccountArchive struct {
+	Version         int                            `json:"version" validate:"required"`
+	ExportedAt      string                         `json:"exported_at"`
+	Profile         AccountArchiveProfile          `json:"profile"`
+	Households      []AccountArchiveHousehold      `json:"households" validate:"dive"`
+	CalendarMuxes   []AccountArchiveCalendarMux    `json:"calendar_muxes" validate:"dive"`
+	CalendarSources []AccountArchiveCalendarSource `json:"calendar_sources" validate:"dive"`
+	RewriteRules    []AccountArchiveRewriteRule    `json:"rewrite_rules" validate:"dive"`
+}
+
+type AccountArchiveProfile struct {
+	GivenName  string `json:"given_name" validate:"max=100"`
+	FamilyName string `json:"family_name" validate:"max=100"`
+	Email      string `json:"email" validate:"required,email"`
+}
+
+// AccountArchiveHousehold is a household the user is a member of. Members are listed for the
+// households the user owns.
+type AccountArchiveHousehold struct {
+	ID      uint                            `json:"id" validate:"required"`
+	Name    string                          `json:"name" validate:"required,min=1,max=200"`
+	Role    string                          `json:"role" validate:"required,oneof=owner editor viewer"`
+	Members []AccountArchiveHouseholdMember `json:"members" validate:"dive"`
+}
+
+type AccountArchiveHouseholdMember struct {
+	ID    uint   `json:"id" validate:"required"`
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required,oneof=owner editor viewer"`
+}
+
+type AccountArchiveCalendarMux struct {
+	ID           uint   `json:"id" validate:"required"`
+	Name         string `json:"name" validate:"required,min=1,max=200"`
+	Description  string `json:"description" validate:"max=1000"`
+	DedupEnabled bool   `json:"dedup_enabled"`
+	HouseholdID  *uint  `json:"household_id" validate:"omitempty,min=1"`
+}
+
+type AccountArchiveCalendarSource struct {
+	ID            uint   `json:"id" validate:"required"`
+	CalendarMuxID uint   `json:"calendar_mux_id" validate:"required"`
+	URL           string `json:"url" validate:"required,url,max=2048"`
+	Label         string `json:"label" validate:"required,min=1,max=200"`
+	Enabled       bool   `json:"enabled"`
+	Visibility    string `json:"visibility" validate:"required,oneof=full title_only busy_only"`
+}
+
+type AccountArchiveRewriteRule struct {
+	ID               uint   `json:"id" validate:"required"`
+	CalendarSourceID uint   `json:"calendar_source_id" validate:"required"`
+	Position         int    `json:"position" validate:"min=0"`
+	Action           string `json:"action" validate:"required,oneof=prefix replace set_categories set_color drop"`
+	Pattern          string `json:"pattern" validate:"max=500"`
+	Value            string `json:"value" validate:"max=500"`
+}
+
+// AccountImportAPIResponse maps the IDs in an imported archive to the IDs of what they were
+// imported as, and lists what could not be imported as it was
+type AccountImportAPIResponse struct {
+	IDs       AccountImportIDsAPIResponse        `json:"ids"`
+	Conflicts []AccountImportConflictAPIResponse `json:"conflicts" validate:"dive"`
+}
+
+type AccountImportIDsAPIResponse struct {
+	Households      map[uint]uint `json:"households"`
+	CalendarMuxes   map[uint]uint `json:"calendar_muxes"`
+	CalendarSources map[uint]uint `json:"calendar_sources"`
+	RewriteRules    map[uint]uint `json:"rewrite_rules"`
+}
+
+type AccountImportConflictAPIResponse struct {
+	EntityType string `json:"entity_type" validate:"required"`
+	// ID is the ID of the entity in the archive, or 0 for the profile
+	ID      uint   `json:"id"`
+	Message string `json:"message" validate:"required"`
+}
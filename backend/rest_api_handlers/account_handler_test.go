@@ -0,0 +1,172 @@
+package rest_api_handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupAccountTestDB gives the test user a household with a shared mux that has a source with a
+// rewrite rule
+func setupAccountTestDB(t *testing.T) *models.User {
+	user := setupCalendarMuxTestDB(t)
+	household, err := services.CreateHousehold(user.ID, "Family", "")
+	require.NoError(t, err)
+	calendarMux, err := calendarMuxHandler().muxes.Create(user.ID, "Family", "Everyone", true, &household.ID, "")
+	require.NoError(t, err)
+	calendarSource, err := calendarMuxHandler().muxes.CreateCalendarSource(calendarMux.ID, user.ID, "https://example.com/school.ics", "School", true, models.VisibilityFull, "")
+	require.NoError(t, err)
+	_, err = calendarMuxHandler().muxes.CreateRewriteRule(calendarSource.ID, calendarMux.ID, user.ID, models.RewriteActionDrop, "^Holiday", "", nil, "")
+	require.NoError(t, err)
+	return user
+}
+
+func TestExportAccount_Success(t *testing.T) {
+	user := setupAccountTestDB(t)
+	rr := httptest.NewRecorder()
+
+	ExportAccount(rr, newRouteRequest("GET", "/api/export", nil, user.ID, nil))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Header().Get("Content-Disposition"), "attachment")
+	var archive AccountArchive
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &archive))
+	assert.Equal(t, accountArchiveVersion, archive.Version)
+	assert.NotEmpty(t, archive.ExportedAt)
+	assert.Equal(t, "test@example.com", archive.Profile.Email)
+	require.Len(t, archive.Households, 1)
+	assert.Equal(t, models.HouseholdRoleOwner, archive.Households[0].Role)
+	assert.NotNil(t, archive.Households[0].Members)
+	require.Len(t, archive.CalendarMuxes, 1)
+	assert.Equal(t, &archive.Households[0].ID, archive.CalendarMuxes[0].HouseholdID)
+	require.Len(t, archive.CalendarSources, 1)
+	assert.Equal(t, archive.CalendarMuxes[0].ID, archive.CalendarSources[0].CalendarMuxID)
+	require.Len(t, archive.RewriteRules, 1)
+	assert.Equal(t, "^Holiday", archive.RewriteRules[0].Pattern)
+	assert.NotContains(t, rr.Body.String(), "feed_token")
+}
+
+func TestImportAccount_RoundTrip(t *testing.T) {
+	user := setupAccountTestDB(t)
+	rr := httptest.NewRecorder()
+	ExportAccount(rr, newRouteRequest("GET", "/api/export", nil, user.ID, nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	exported := rr.Body.Bytes()
+
+	other := &models.User{GivenName: "Other", FamilyName: "User", Email: "other@example.com"}
+	require.NoError(t, db.DB.Create(other).Error)
+	rr = httptest.NewRecorder()
+	ImportAccount(rr, newRouteRequest("POST", "/api/import", bytes.NewReader(exported), other.ID, nil))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var response AccountImportAPIResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Len(t, response.Conflicts, 1)
+	assert.Equal(t, "profile", response.Conflicts[0].EntityType)
+	assert.Len(t, response.IDs.Households, 1)
+	assert.Len(t, response.IDs.CalendarMuxes, 1)
+	assert.Len(t, response.IDs.CalendarSources, 1)
+	assert.Len(t, response.IDs.RewriteRules, 1)
+
+	rr = httptest.NewRecorder()
+	calendarMuxHandler().ListCalendarMuxes(rr, newRouteRequest("GET", "/api/calendar-mux", nil, other.ID, nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var muxes CalendarMuxListAPIResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &muxes))
+	require.Len(t, muxes.CalendarMuxes, 1)
+	for _, calendarMuxID := range response.IDs.CalendarMuxes {
+		assert.Equal(t, calendarMuxID, muxes.CalendarMuxes[0].ID)
+		assert.Equal(t, other.ID, muxes.CalendarMuxes[0].CreatedByID)
+	}
+}
+
+func TestImportAccount_InvalidArchive(t *testing.T) {
+	user := setupCalendarMuxTestDB(t)
+	tests := []struct {
+		name    string
+		body    string
+		message string
+		fields  map[string]string
+	}{
+		{
+			name:    "unsupported version",
+			body:    `{"version":2,"profile":{"email":"test@example.com"}}`,
+			message: "Unsupported archive version",
+			fields:  map[string]string{"version": "Must be 1"},
+		},
+		{
+			name: "invalid entries",
+			body: `{"version":1,"profile":{"email":"test@example.com"},
+				"households":[{"id":1,"name":"Family","role":"owner","members":[{"id":2,"email":"not-an-email","role":"viewer"}]}],
+				"calendar_sources":[{"id":3,"calendar_mux_id":4,"url":"https://example.com/a.ics","label":"A","visibility":"everything"}]}`,
+			message: "Invalid archive",
+			fields: map[string]string{
+				"households[0].members[0].email": "Invalid email format",
+				"calendar_sources[0].visibility": "Invalid value",
+			},
+		},
+		{
+			name: "invalid sources and rules",
+			body: `{"version":1,"profile":{"email":"test@example.com"},
+				"calendar_muxes":[{"id":4,"name":"A"},{"id":4,"name":"B"}],
+				"calendar_sources":[{"id":3,"calendar_mux_id":4,"url":"ftp://example.com/a.ics","label":"A","visibility":"full"}],
+				"rewrite_rules":[{"id":5,"calendar_source_id":3,"position":0,"action":"replace","pattern":"(","value":""}]}`,
+			message: "Invalid archive",
+			fields: map[string]string{
+				"calendar_muxes[1].id":     "Duplicate ID",
+				"calendar_sources[0].url":  "URL must use http, https or webcal and a public host",
+				"rewrite_rules[0].pattern": "Invalid regular expression",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			ImportAccount(rr, newRouteRequest("POST", "/api/import", strings.NewReader(tt.body), user.ID, nil))
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			var response struct {
+				Error  string            `json:"error"`
+				Fields map[string]string `json:"fields"`
+			}
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			assert.Equal(t, tt.message, response.Error)
+			assert.Equal(t, tt.fields, response.Fields)
+		})
+	}
+
+	var count int64
+	db.DB.Model(&models.CalendarMux{}).Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestImportAccount_InvalidBody(t *testing.T) {
+	user := setupCalendarMuxTestDB(t)
+	rr := httptest.NewRecorder()
+
+	ImportAccount(rr, newRouteRequest("POST", "/api/import", strings.NewReader("{"), user.ID, nil))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Invalid request body")
+}
+
+func TestAccountHandlers_Unauthenticated(t *testing.T) {
+	rr := httptest.NewRecorder()
+	ExportAccount(rr, newRouteRequest("GET", "/api/export", nil, 0, nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = httptest.NewRecorder()
+	ImportAccount(rr, newRouteRequest("POST", "/api/import", strings.NewReader("{}"), 0, nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
@@ -0,0 +1,117 @@
+package rest_api_handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"family-calendar-backend/auth"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/repositories"
+	"family-calendar-backend/rest_api_handlers/utils"
+)
+
+const (
+	defaultAuditLogLimit = 100
+	maxAuditLogLimit     = 500
+)
+
+// auditEntityTypes are the entity types the audit log can be filtered by
+var auditEntityTypes = map[string]bool{
+	models.AuditEntityCalendarMux:     true,
+	models.AuditEntityCalendarSource:  true,
+	models.AuditEntityHousehold:       true,
+	models.AuditEntityHouseholdMember: true,
+}
+
+// AuditHandler serves the audit log of changes to calendar muxes, sources and households
+type AuditHandler struct {
+	audit repositories.AuditLogRepository
+}
+
+// NewAuditHandler returns an AuditHandler reading the audit log from the given repository
+func NewAuditHandler(audit repositories.AuditLogRepository) *AuditHandler {
+	return &AuditHandler{audit: audit}
+}
+
+// parseAuditEntity parses an entity filter, which is an entity type optionally followed by a colon
+// and an entity ID, such as "calendar_mux" or "calendar_mux:12"
+func parseAuditEntity(entity string) (string, uint, bool) {
+	if entity == "" {
+		return "", 0, true
+	}
+	entityType, rawID, hasID := strings.Cut(entity, ":")
+	if !auditEntityTypes[entityType] {
+		return "", 0, false
+	}
+	if !hasID {
+		return entityType, 0, true
+	}
+	id, err := strconv.ParseUint(rawID, 10, 64)
+	if err != nil || id == 0 {
+		return "", 0, false
+	}
+	return entityType, uint(id), true
+}
+
+// ListAuditLog returns the audit log entries the authenticated user may read, newest first: the
+// changes they made and the changes in households they own
+func (h *AuditHandler) ListAuditLog(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	fields := map[string]string{}
+	entityType, entityID, ok := parseAuditEntity(r.URL.Query().Get("entity"))
+	if !ok {
+		fields["entity"] = "Must be an entity type, optionally followed by :ID"
+	}
+	limit := defaultAuditLogLimit
+	if rawLimit := r.URL.Query().Get("limit"); rawLimit != "" {
+		parsed, err := strconv.Atoi(rawLimit)
+		if err != nil || parsed < 1 || parsed > maxAuditLogLimit {
+			fields["limit"] = "Must be between 1 and 500"
+		}
+		limit = parsed
+	}
+	if len(fields) > 0 {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid audit log filter", fields)
+		return
+	}
+
+	entries, err := h.audit.List(repositories.AuditLogFilter{
+		EntityType: entityType,
+		EntityID:   entityID,
+		VisibleTo:  userID,
+		Limit:      limit,
+	})
+	if err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to retrieve audit log", nil)
+		return
+	}
+
+	response := AuditLogListAPIResponse{Entries: make([]AuditLogEntryAPIResponse, len(entries))}
+	for i, entry := range entries {
+		response.Entries[i] = AuditLogEntryAPIResponse{
+			ID:          entry.ID,
+			ActorID:     entry.ActorID,
+			Action:      entry.Action,
+			EntityType:  entry.EntityType,
+			EntityID:    entry.EntityID,
+			HouseholdID: entry.HouseholdID,
+			Changes:     json.RawMessage(entry.Changes),
+			RequestID:   entry.RequestID,
+			CreatedAt:   entry.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		}
+	}
+
+	if err := validate.Struct(response); err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Response validation failed", nil)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,22 @@
+package rest_api_handlers
+
+import "encoding/json"
+
+// AuditLogEntryAPIResponse is a change recorded in the audit log
+type AuditLogEntryAPIResponse struct {
+	ID uint `json:"id" validate:"required"`
+	// ActorID is the user who made the change, or 0 for the server
+	ActorID     uint   `json:"actor_id"`
+	Action      string `json:"action" validate:"required,oneof=create update delete restore purge"`
+	EntityType  string `json:"entity_type" validate:"required,oneof=calendar_mux calendar_source household household_member household_invite rewrite_rule"`
+	EntityID    uint   `json:"entity_id" validate:"required"`
+	HouseholdID *uint  `json:"household_id"`
+	// Changes maps each changed field to its values before and after the change
+	Changes   json.RawMessage `json:"changes" validate:"required"`
+	RequestID string          `json:"request_id"`
+	CreatedAt string          `json:"created_at" validate:"required"`
+}
+
+type AuditLogListAPIResponse struct {
+	Entries []AuditLogEntryAPIResponse `json:"entries" validate:"dive"`
+}
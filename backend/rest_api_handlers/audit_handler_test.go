@@ -0,0 +1,118 @@
+package rest_api_handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/repositories"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listAuditLog requests the audit log as the given user and decodes it
+func listAuditLog(t *testing.T, handler *AuditHandler, target string, userID uint) (int, AuditLogListAPIResponse) {
+	rr := httptest.NewRecorder()
+	handler.ListAuditLog(rr, newRouteRequest("GET", target, nil, userID, nil))
+	var response AuditLogListAPIResponse
+	if rr.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	}
+	return rr.Code, response
+}
+
+func TestListAuditLog_RecordsMuxChanges(t *testing.T) {
+	t.Parallel()
+	muxes := repositories.NewMemoryCalendarMuxRepository()
+	audit := muxes.AuditLog()
+	householdID := uint(7)
+	muxes.AddHouseholdMember(householdID, 1, models.HouseholdRoleEditor)
+	audit.AddHouseholdMember(householdID, 2, models.HouseholdRoleOwner)
+	audit.AddHouseholdMember(householdID, 3, models.HouseholdRoleViewer)
+
+	// The request ID of the change is recorded with it
+	body := strings.NewReader(`{"name":"Family","household_id":7}`)
+	req := newRouteRequest("POST", "/api/calendar-mux", body, 1, nil)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.RequestIDKey, "host/abc-000001"))
+	rr := httptest.NewRecorder()
+	NewCalendarMuxHandler(muxes).CreateCalendarMux(rr, req)
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	handler := NewAuditHandler(audit)
+	code, response := listAuditLog(t, handler, "/api/audit?entity=calendar_mux", 2)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, response.Entries, 1)
+	entry := response.Entries[0]
+	assert.Equal(t, uint(1), entry.ActorID)
+	assert.Equal(t, models.AuditActionCreate, entry.Action)
+	assert.Equal(t, models.AuditEntityCalendarMux, entry.EntityType)
+	assert.Equal(t, &householdID, entry.HouseholdID)
+	assert.Equal(t, "host/abc-000001", entry.RequestID)
+	assert.NotEmpty(t, entry.CreatedAt)
+	assert.JSONEq(t, `{
+		"name": {"before": null, "after": "Family"},
+		"description": {"before": null, "after": ""},
+		"dedup_enabled": {"before": null, "after": true},
+		"household_id": {"before": null, "after": 7}
+	}`, string(entry.Changes))
+
+	// Members who do not own the household see nothing of it
+	code, response = listAuditLog(t, handler, "/api/audit", 3)
+	require.Equal(t, http.StatusOK, code)
+	assert.Empty(t, response.Entries)
+	code, response = listAuditLog(t, handler, "/api/audit?entity=calendar_source", 2)
+	require.Equal(t, http.StatusOK, code)
+	assert.Empty(t, response.Entries)
+}
+
+func TestListAuditLog_FiltersAndLimits(t *testing.T) {
+	t.Parallel()
+	audit := repositories.NewMemoryAuditLogRepository()
+	for _, entityID := range []uint{4, 5, 5} {
+		require.NoError(t, audit.Append(&models.AuditLog{ActorID: 1, Action: models.AuditActionUpdate, EntityType: models.AuditEntityHousehold, EntityID: entityID, Changes: `{}`}))
+	}
+	handler := NewAuditHandler(audit)
+
+	code, response := listAuditLog(t, handler, "/api/audit?entity=household:5", 1)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, response.Entries, 2)
+	assert.Greater(t, response.Entries[0].ID, response.Entries[1].ID)
+
+	code, response = listAuditLog(t, handler, "/api/audit?limit=1", 1)
+	require.Equal(t, http.StatusOK, code)
+	assert.Len(t, response.Entries, 1)
+}
+
+func TestListAuditLog_InvalidFilter(t *testing.T) {
+	t.Parallel()
+	handler := NewAuditHandler(repositories.NewMemoryAuditLogRepository())
+
+	for _, target := range []string{
+		"/api/audit?entity=rewrite_rule",
+		"/api/audit?entity=household:",
+		"/api/audit?entity=household:0",
+		"/api/audit?entity=household:x",
+		"/api/audit?limit=0",
+		"/api/audit?limit=501",
+	} {
+		rr := httptest.NewRecorder()
+		handler.ListAuditLog(rr, newRouteRequest("GET", target, nil, 1, nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, target)
+		assert.Contains(t, rr.Body.String(), "Invalid audit log filter", target)
+	}
+}
+
+func TestListAuditLog_Unauthenticated(t *testing.T) {
+	t.Parallel()
+	rr := httptest.NewRecorder()
+
+	NewAuditHandler(repositories.NewMemoryAuditLogRepository()).ListAuditLog(rr, newRouteRequest("GET", "/api/audit", nil, 0, nil))
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
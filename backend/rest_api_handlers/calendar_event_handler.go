@@ -0,0 +1,210 @@
+package rest_api_handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"family-calendar-backend/auth"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/services"
+	"family-calendar-backend/ical"
+	"family-calendar-backend/recurrence"
+	"family-calendar-backend/rest_api_handlers/utils"
+)
+
+// maxEventRange bounds the window a single events request may expand
+const maxEventRange = 366 * 24 * time.Hour
+
+// sourceOccurrence is an expanded occurrence together with the sources it came from
+type sourceOccurrence struct {
+	SourceIDs []uint
+	recurrence.Occurrence
+}
+
+// expandCalendarSources expands the stored events of the sources over [from, to), ordered by start.
+// With dedup, duplicates are collapsed across sources first and all events are expanded together,
+// so an override from one source applies to the same series from another. Without it, each source
+// is expanded on its own.
+func expandCalendarSources(calendarSources []models.CalendarSource, from, to time.Time, dedup bool) ([]sourceOccurrence, error) {
+	calendars, err := loadStoredCalendars(calendarSources)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([][]*recurrence.Event, len(calendars))
+	sourceIDs := make(map[*recurrence.Event][]uint)
+	for _, sourced := range ical.CollectEvents(calendars, dedup) {
+		event, err := recurrence.FromComponent(sourced.Event)
+		if err != nil {
+			log.Printf("Ignoring event %q of calendar source %d: %v", sourced.Event.PropValue("UID"), calendarSources[sourced.Sources[0]].ID, err)
+			continue
+		}
+		for _, i := range sourced.Sources {
+			sourceIDs[event] = append(sourceIDs[event], calendarSources[i].ID)
+		}
+		group := sourced.Sources[0]
+		if dedup {
+			group = 0
+		}
+		groups[group] = append(groups[group], event)
+	}
+
+	var occurrences []sourceOccurrence
+	for _, events := range groups {
+		for _, occurrence := range recurrence.Expand(events, from, to) {
+			occurrences = append(occurrences, sourceOccurrence{SourceIDs: sourceIDs[occurrence.Event], Occurrence: occurrence})
+		}
+	}
+
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		return occurrences[i].Start.Before(occurrences[j].Start)
+	})
+	return occurrences, nil
+}
+
+// parseRangeParam parses a from/to query value given as an RFC 3339 timestamp or a YYYY-MM-DD date (UTC midnight)
+func parseRangeParam(value string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// formatEventTime formats an occurrence boundary, using plain dates for all-day events
+func formatEventTime(t time.Time, allDay bool) string {
+	if allDay {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02T15:04:05Z07:00")
+}
+
+// eventCategories lists the categories of an event, which may be spread over several CATEGORIES properties
+func eventCategories(component *ical.Component) []string {
+	categories := make([]string, 0)
+	for _, p := range component.PropsNamed("CATEGORIES") {
+		for _, category := range splitTextList(p.Value) {
+			if category != "" {
+				categories = append(categories, category)
+			}
+		}
+	}
+	return categories
+}
+
+// splitTextList splits a comma-separated TEXT list value, honouring escaped commas
+func splitTextList(value string) []string {
+	var items []string
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case ',':
+			items = append(items, ical.UnescapeText(value[start:i]))
+			start = i + 1
+		}
+	}
+	return append(items, ical.UnescapeText(value[start:]))
+}
+
+func buildCalendarEventResponse(o sourceOccurrence) CalendarEventAPIResponse {
+	component := o.Event.Component
+	return CalendarEventAPIResponse{
+		Start:      formatEventTime(o.Start, o.AllDay),
+		End:        formatEventTime(o.End, o.AllDay),
+		AllDay:     o.AllDay,
+		Title:      ical.UnescapeText(component.PropValue("SUMMARY")),
+		Location:   ical.UnescapeText(component.PropValue("LOCATION")),
+		Categories: eventCategories(component),
+		Color:      component.PropValue("COLOR"),
+		SourceID:   o.SourceIDs[0],
+		SourceIDs:  o.SourceIDs,
+		UID:        o.Event.UID,
+	}
+}
+
+// ListCalendarMuxEvents returns the merged, expanded occurrences of a calendar mux owned by the
+// authenticated user that overlap the requested time range
+func (h *CalendarMuxHandler) ListCalendarMuxEvents(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	calendarMuxID, ok := parseIDParam(r, "id")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid calendar mux ID", nil)
+		return
+	}
+
+	fields := map[string]string{}
+	from, ok := parseRangeParam(r.URL.Query().Get("from"))
+	if !ok {
+		fields["from"] = "Must be an RFC 3339 timestamp or a YYYY-MM-DD date"
+	}
+	to, ok := parseRangeParam(r.URL.Query().Get("to"))
+	if !ok {
+		fields["to"] = "Must be an RFC 3339 timestamp or a YYYY-MM-DD date"
+	}
+	if len(fields) == 0 {
+		switch {
+		case !to.After(from):
+			fields["to"] = "Must be after from"
+		case to.Sub(from) > maxEventRange:
+			fields["to"] = "Range must not exceed 366 days"
+		}
+	}
+	if len(fields) > 0 {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid time range", fields)
+		return
+	}
+
+	calendarMux, err := h.muxes.Get(calendarMuxID, userID)
+	if err != nil {
+		if errors.Is(err, services.ErrCalendarMuxNotFound) {
+			utils.RespondError(w, http.StatusNotFound, "Calendar mux not found or access denied", nil)
+			return
+		}
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to retrieve calendar events", nil)
+		return
+	}
+
+	calendarSources, err := services.GetEnabledCalendarSources(calendarMux.ID)
+	if err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to retrieve calendar events", nil)
+		return
+	}
+
+	occurrences, err := expandCalendarSources(calendarSources, from, to, !calendarMux.DedupDisabled)
+	if err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to retrieve calendar events", nil)
+		return
+	}
+
+	// Build response
+	eventResponses := make([]CalendarEventAPIResponse, 0, len(occurrences))
+	for _, o := range occurrences {
+		eventResponses = append(eventResponses, buildCalendarEventResponse(o))
+	}
+
+	response := CalendarEventListAPIResponse{
+		From:   from.Format("2006-01-02T15:04:05Z07:00"),
+		To:     to.Format("2006-01-02T15:04:05Z07:00"),
+		Events: eventResponses,
+	}
+
+	// Validate response
+	if err := validate.Struct(response); err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Response validation failed", nil)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, response)
+}
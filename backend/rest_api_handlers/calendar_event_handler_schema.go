@@ -0,0 +1,23 @@
+package rest_api_handlers
+
+type CalendarEventAPIResponse struct {
+	// Start and End are RFC 3339 timestamps, or YYYY-MM-DD dates for all-day events (End is exclusive)
+	Start    string `json:"start" validate:"required"`
+	End      string `json:"end" validate:"required"`
+	AllDay   bool   `json:"all_day"`
+	Title    string `json:"title"`
+	Location string `json:"location"`
+	// Categories and Color are usually set by the rewrite rules of the source
+	Categories []string `json:"categories"`
+	Color      string   `json:"color,omitempty"`
+	// SourceID is the first of SourceIDs, the sources a de-duplicated event was found in
+	SourceID  uint   `json:"source_id" validate:"required"`
+	SourceIDs []uint `json:"source_ids" validate:"required,min=1"`
+	UID       string `json:"uid" validate:"required"`
+}
+
+type CalendarEventListAPIResponse struct {
+	From   string                     `json:"from" validate:"required"`
+	To     string                     `json:"to" validate:"required"`
+	Events []CalendarEventAPIResponse `json:"events" validate:"dive"`
+}
@@ -0,0 +1,276 @@
+package rest_api_handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/rest_api_handlers/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func listEventsRequest(userID, calendarMuxID uint, query string) *http.Request {
+	id := strconv.FormatUint(uint64(calendarMuxID), 10)
+	return newRouteRequest(http.MethodGet, "/api/calendar-mux/"+id+"/events?"+query, nil, userID, map[string]string{"id": id})
+}
+
+func TestListCalendarMuxEvents_Success(t *testing.T) {
+	user, calendarMux := setupCalendarSourceTestDB(t)
+
+	school := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/school.ics", Label: "School", Enabled: true}
+	db.DB.Create(school)
+	soccer := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/soccer.ics", Label: "Soccer", Enabled: true}
+	db.DB.Create(soccer)
+	work := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/work.ics", Label: "Work", Enabled: true}
+	db.DB.Create(work)
+	db.DB.Model(work).Update("enabled", false)
+
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: soccer.ID, UID: "soccer-1", Data: "BEGIN:VEVENT\r\n" +
+		"UID:soccer-1\r\nSUMMARY:Practice\r\nLOCATION:Field 3\\, North park\r\n" +
+		"DTSTART;TZID=America/Toronto:20250106T170000\r\nDTEND;TZID=America/Toronto:20250106T180000\r\n" +
+		"RRULE:FREQ=WEEKLY;COUNT=3\r\nEND:VEVENT\r\n"})
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: school.ID, UID: "school-1", Data: "BEGIN:VEVENT\r\n" +
+		"UID:school-1\r\nSUMMARY:PD day\r\nDTSTART;VALUE=DATE:20250110\r\nEND:VEVENT\r\n"})
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: school.ID, UID: "no-start", Data: "BEGIN:VEVENT\r\nUID:no-start\r\nEND:VEVENT\r\n"})
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: work.ID, UID: "work-1", Data: "BEGIN:VEVENT\r\n" +
+		"UID:work-1\r\nDTSTART:20250107T140000Z\r\nEND:VEVENT\r\n"})
+
+	rr := httptest.NewRecorder()
+	calendarMuxHandler().ListCalendarMuxEvents(rr, listEventsRequest(user.ID, calendarMux.ID, "from=2025-01-06&to=2025-01-14T00:00:00-05:00"))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response CalendarEventListAPIResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Equal(t, "2025-01-06T00:00:00Z", response.From)
+	assert.Equal(t, "2025-01-14T00:00:00-05:00", response.To)
+
+	// Disabled sources and events without a start are left out; occurrences are ordered by start
+	require.Len(t, response.Events, 3)
+	assert.Equal(t, CalendarEventAPIResponse{
+		Start:      "2025-01-06T17:00:00-05:00",
+		End:        "2025-01-06T18:00:00-05:00",
+		Title:      "Practice",
+		Location:   "Field 3, North park",
+		Categories: []string{},
+		SourceID:   soccer.ID,
+		SourceIDs:  []uint{soccer.ID},
+		UID:        "soccer-1",
+	}, response.Events[0])
+	assert.Equal(t, CalendarEventAPIResponse{
+		Start:      "2025-01-10",
+		End:        "2025-01-11",
+		AllDay:     true,
+		Title:      "PD day",
+		Categories: []string{},
+		SourceID:   school.ID,
+		SourceIDs:  []uint{school.ID},
+		UID:        "school-1",
+	}, response.Events[1])
+	assert.Equal(t, "2025-01-13T17:00:00-05:00", response.Events[2].Start)
+	assert.Equal(t, "soccer-1", response.Events[2].UID)
+}
+
+// createDuplicateSources attaches two parents' calendars that were both invited to the same conference,
+// one of them also overriding a shared weekly practice
+func createDuplicateSources(t *testing.T, calendarMux *models.CalendarMux) (*models.CalendarSource, *models.CalendarSource) {
+	t.Helper()
+	mom := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/mom.ics", Label: "Mom", Enabled: true}
+	db.DB.Create(mom)
+	dad := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/dad.ics", Label: "Dad", Enabled: true}
+	db.DB.Create(dad)
+
+	conference := "BEGIN:VEVENT\r\nUID:conference@school.example\r\nSUMMARY:Parent-teacher conference\r\n" +
+		"DTSTART:20250110T170000Z\r\nDTEND:20250110T173000Z\r\nEND:VEVENT\r\n"
+	practice := "BEGIN:VEVENT\r\nUID:practice@example.com\r\nSUMMARY:Practice\r\n" +
+		"DTSTART:20250106T220000Z\r\nRRULE:FREQ=WEEKLY;COUNT=2\r\nEND:VEVENT\r\n"
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: mom.ID, UID: "conference@school.example", Data: conference})
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: mom.ID, UID: "practice@example.com", Data: practice})
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: dad.ID, UID: "conference@school.example", Data: conference})
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: dad.ID, UID: "practice@example.com", Data: practice})
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: dad.ID, UID: "practice@example.com", RecurrenceID: "20250113T220000Z", Data: "BEGIN:VEVENT\r\n" +
+		"UID:practice@example.com\r\nRECURRENCE-ID:20250113T220000Z\r\nSUMMARY:Practice (moved)\r\n" +
+		"DTSTART:20250114T220000Z\r\nEND:VEVENT\r\n"})
+	return mom, dad
+}
+
+func TestListCalendarMuxEvents_Dedup(t *testing.T) {
+	user, calendarMux := setupCalendarSourceTestDB(t)
+	mom, dad := createDuplicateSources(t, calendarMux)
+
+	rr := httptest.NewRecorder()
+	calendarMuxHandler().ListCalendarMuxEvents(rr, listEventsRequest(user.ID, calendarMux.ID, "from=2025-01-01&to=2025-02-01"))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response CalendarEventListAPIResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+
+	// Each event appears once and records both parents; the override from Dad's calendar moves the shared series
+	require.Len(t, response.Events, 3)
+	assert.Equal(t, "Practice", response.Events[0].Title)
+	assert.Equal(t, []uint{mom.ID, dad.ID}, response.Events[0].SourceIDs)
+	assert.Equal(t, "Parent-teacher conference", response.Events[1].Title)
+	assert.Equal(t, mom.ID, response.Events[1].SourceID)
+	assert.Equal(t, []uint{mom.ID, dad.ID}, response.Events[1].SourceIDs)
+	assert.Equal(t, "Practice (moved)", response.Events[2].Title)
+	assert.Equal(t, []uint{dad.ID}, response.Events[2].SourceIDs)
+}
+
+func TestListCalendarMuxEvents_DedupDisabled(t *testing.T) {
+	user, calendarMux := setupCalendarSourceTestDB(t)
+	db.DB.Model(calendarMux).Update("dedup_disabled", true)
+	createDuplicateSources(t, calendarMux)
+
+	rr := httptest.NewRecorder()
+	calendarMuxHandler().ListCalendarMuxEvents(rr, listEventsRequest(user.ID, calendarMux.ID, "from=2025-01-01&to=2025-02-01"))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response CalendarEventListAPIResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+
+	// Both copies of everything are kept, and each source's series is expanded on its own
+	titles := make([]string, 0, len(response.Events))
+	for _, event := range response.Events {
+		titles = append(titles, event.Title)
+		assert.Len(t, event.SourceIDs, 1)
+	}
+	assert.Equal(t, []string{"Practice", "Practice", "Parent-teacher conference", "Parent-teacher conference", "Practice", "Practice (moved)"}, titles)
+}
+
+func TestListCalendarMuxEvents_Empty(t *testing.T) {
+	user, calendarMux := setupCalendarSourceTestDB(t)
+
+	rr := httptest.NewRecorder()
+	calendarMuxHandler().ListCalendarMuxEvents(rr, listEventsRequest(user.ID, calendarMux.ID, "from=2025-01-01&to=2025-02-01"))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"events":[]`)
+}
+
+func TestListCalendarMuxEvents_InvalidRange(t *testing.T) {
+	user, calendarMux := setupCalendarSourceTestDB(t)
+
+	tests := []struct {
+		name   string
+		query  string
+		fields map[string]string
+	}{
+		{
+			name:   "Missing",
+			query:  "",
+			fields: map[string]string{"from": "Must be an RFC 3339 timestamp or a YYYY-MM-DD date", "to": "Must be an RFC 3339 timestamp or a YYYY-MM-DD date"},
+		},
+		{
+			name:   "Malformed",
+			query:  "from=yesterday&to=2025-01-01",
+			fields: map[string]string{"from": "Must be an RFC 3339 timestamp or a YYYY-MM-DD date"},
+		},
+		{
+			name:   "Reversed",
+			query:  "from=2025-02-01&to=2025-01-01",
+			fields: map[string]string{"to": "Must be after from"},
+		},
+		{
+			name:   "Too long",
+			query:  "from=2025-01-01&to=2026-06-01",
+			fields: map[string]string{"to": "Range must not exceed 366 days"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			calendarMuxHandler().ListCalendarMuxEvents(rr, listEventsRequest(user.ID, calendarMux.ID, tt.query))
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			var response utils.ErrorResponse
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+			assert.Equal(t, "Invalid time range", response.Error)
+			assert.Equal(t, tt.fields, response.Fields)
+		})
+	}
+}
+
+func TestListCalendarMuxEvents_NotFound(t *testing.T) {
+	_, calendarMux := setupCalendarSourceTestDB(t)
+
+	otherUser := &models.User{
+		GivenName:  "Other",
+		FamilyName: "User",
+		Email:      "other@example.com",
+	}
+	db.DB.Create(otherUser)
+
+	rr := httptest.NewRecorder()
+	calendarMuxHandler().ListCalendarMuxEvents(rr, listEventsRequest(otherUser.ID, calendarMux.ID, "from=2025-01-01&to=2025-02-01"))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestListCalendarMuxEvents_InvalidID(t *testing.T) {
+	user, _ := setupCalendarSourceTestDB(t)
+
+	req := newRouteRequest(http.MethodGet, "/api/calendar-mux/abc/events", nil, user.ID, map[string]string{"id": "abc"})
+	rr := httptest.NewRecorder()
+	calendarMuxHandler().ListCalendarMuxEvents(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestListCalendarMuxEvents_NoAuth(t *testing.T) {
+	rr := httptest.NewRecorder()
+	calendarMuxHandler().ListCalendarMuxEvents(rr, listEventsRequest(0, 1, "from=2025-01-01&to=2025-02-01"))
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestListCalendarMuxEvents_Visibility(t *testing.T) {
+	user, calendarMux := setupCalendarSourceTestDB(t)
+	createPrivateSources(t, calendarMux)
+
+	rr := httptest.NewRecorder()
+	calendarMuxHandler().ListCalendarMuxEvents(rr, listEventsRequest(user.ID, calendarMux.ID, "from=2025-01-01&to=2025-02-01"))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response CalendarEventListAPIResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+
+	require.Len(t, response.Events, 3)
+	assert.Equal(t, "Performance review", response.Events[0].Title)
+	assert.Equal(t, "Room 4", response.Events[0].Location)
+	assert.Equal(t, "Performance review", response.Events[1].Title)
+	assert.Equal(t, "", response.Events[1].Location)
+	assert.Equal(t, "Busy", response.Events[2].Title)
+	assert.Equal(t, "", response.Events[2].Location)
+	assert.Equal(t, "2025-01-12T14:00:00Z", response.Events[2].Start)
+}
+
+func TestListCalendarMuxEvents_RewriteRules(t *testing.T) {
+	user, calendarMux := setupCalendarSourceTestDB(t)
+	createRewrittenSources(t, calendarMux)
+
+	rr := httptest.NewRecorder()
+	calendarMuxHandler().ListCalendarMuxEvents(rr, listEventsRequest(user.ID, calendarMux.ID, "from=2025-01-01&to=2025-02-01"))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response CalendarEventListAPIResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+
+	require.Len(t, response.Events, 2)
+	assert.Equal(t, "[Emma] Soccer practice", response.Events[0].Title)
+	assert.Equal(t, "teal", response.Events[0].Color)
+	assert.Equal(t, []string{"Kids", "Sports"}, response.Events[0].Categories)
+	assert.Equal(t, "[Dad] Busy", response.Events[1].Title)
+	assert.Empty(t, response.Events[1].Categories)
+}
+
+func TestSplitTextList(t *testing.T) {
+	assert.Equal(t, []string{"Kids", "Rock, paper", ""}, splitTextList(`Kids,Rock\, paper,`))
+	assert.Equal(t, []string{""}, splitTextList(""))
+}
@@ -2,19 +2,93 @@ package rest_api_handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"family-calendar-backend/auth"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/repositories"
 	"family-calendar-backend/db/services"
 	"family-calendar-backend/rest_api_handlers/utils"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-playground/validator/v10"
 )
 
+// CalendarMuxHandler serves the calendar mux endpoints, including their sources, rewrite rules,
+// events and public feeds
+type CalendarMuxHandler struct {
+	muxes *services.CalendarMuxService
+}
+
+// NewCalendarMuxHandler returns a CalendarMuxHandler storing calendar muxes, and the audit log of
+// their changes, in the given repository. Their sources, rewrite rules and events stay in db.DB.
+func NewCalendarMuxHandler(muxes repositories.CalendarMuxRepository) *CalendarMuxHandler {
+	return &CalendarMuxHandler{muxes: services.NewCalendarMuxService(muxes)}
+}
+
+// buildCalendarMuxResponse builds the response for a calendar mux, with its feed token only when
+// showFeed is set
+func buildCalendarMuxResponse(cm models.CalendarMux, showFeed bool) CalendarMuxAPIResponse {
+	response := CalendarMuxAPIResponse{
+		ID:           cm.ID,
+		CreatedByID:  cm.CreatedByID,
+		Name:         cm.Name,
+		Description:  cm.Description,
+		HouseholdID:  cm.HouseholdID,
+		DedupEnabled: !cm.DedupDisabled,
+		CreatedAt:    cm.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		// Full precision, so that it identifies the version like the ETag does
+		UpdatedAt: cm.UpdatedAt.Format(time.RFC3339Nano),
+	}
+	if showFeed {
+		response.FeedToken = cm.FeedToken
+	}
+	return response
+}
+
+// canSeeFeed reports whether a request may see feed tokens and source URLs. Either gives anyone
+// the events of a mux or source, so personal access tokens need the muxes:manage scope rather
+// than just events:read.
+func canSeeFeed(r *http.Request) bool {
+	return auth.HasAnyScope(r.Context(), models.ScopeMuxesManage)
+}
+
+// calendarMuxETag is the entity tag of a calendar mux version: its full-precision UpdatedAt
+func calendarMuxETag(cm *models.CalendarMux) string {
+	return `"` + cm.UpdatedAt.UTC().Format(time.RFC3339Nano) + `"`
+}
+
+// ifMatch reports whether an If-Match header accepts a resource last updated at updatedAt. Tags
+// are the ETag or the full-precision updated_at of a response body, and must match it exactly,
+// since versions written within the same second must not pass for each other. Weak tags never
+// match.
+func ifMatch(header string, updatedAt time.Time) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, strings.Trim(tag, `"`))
+		if err != nil {
+			continue
+		}
+		if t.Equal(updatedAt) {
+			return true
+		}
+	}
+	return false
+}
+
 // CreateCalendarMux creates a new calendar mux for the authenticated user
-func CreateCalendarMux(w http.ResponseWriter, r *http.Request) {
+func (h *CalendarMuxHandler) CreateCalendarMux(w http.ResponseWriter, r *http.Request) {
 	userID, ok := auth.GetUserIDFromContext(r.Context())
 	if !ok {
 		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
@@ -37,50 +111,47 @@ func CreateCalendarMux(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	calendarMux, err := services.CreateCalendarMux(userID, req.Name, req.Description)
-	if err != nil {
-		utils.RespondError(w, http.StatusInternalServerError, "Failed to create calendar mux", nil)
-		return
+	dedupEnabled := true
+	if req.DedupEnabled != nil {
+		dedupEnabled = *req.DedupEnabled
 	}
 
-	// Build response
-	response := CalendarMuxAPIResponse{
-		ID:          calendarMux.ID,
-		CreatedByID: calendarMux.CreatedByID,
-		Name:        calendarMux.Name,
-		Description: calendarMux.Description,
-		CreatedAt:   calendarMux.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		UpdatedAt:   calendarMux.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	calendarMux, err := h.muxes.Create(userID, req.Name, req.Description, dedupEnabled, req.HouseholdID, middleware.GetReqID(r.Context()))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrHouseholdNotFound):
+			utils.RespondError(w, http.StatusNotFound, "Household not found or access denied", nil)
+		case errors.Is(err, services.ErrInsufficientRole):
+			utils.RespondError(w, http.StatusForbidden, "Insufficient household role", nil)
+		default:
+			utils.RespondError(w, http.StatusInternalServerError, "Failed to create calendar mux", nil)
+		}
+		return
 	}
 
-	utils.RespondJSON(w, http.StatusCreated, response)
+	w.Header().Set("ETag", calendarMuxETag(calendarMux))
+	utils.RespondJSON(w, http.StatusCreated, buildCalendarMuxResponse(*calendarMux, true))
 }
 
-// ListCalendarMuxes returns all calendar muxes owned by the authenticated user
-func ListCalendarMuxes(w http.ResponseWriter, r *http.Request) {
+// ListCalendarMuxes returns the calendar muxes the authenticated user created or shares through a household
+func (h *CalendarMuxHandler) ListCalendarMuxes(w http.ResponseWriter, r *http.Request) {
 	userID, ok := auth.GetUserIDFromContext(r.Context())
 	if !ok {
 		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
 		return
 	}
 
-	calendarMuxes, err := services.GetCalendarMuxesByUser(userID)
+	calendarMuxes, err := h.muxes.List(userID)
 	if err != nil {
 		utils.RespondError(w, http.StatusInternalServerError, "Failed to retrieve calendar muxes", nil)
 		return
 	}
 
 	// Build response
+	showFeed := canSeeFeed(r)
 	calendarMuxResponses := make([]CalendarMuxAPIResponse, 0)
 	for _, cm := range calendarMuxes {
-		calendarMuxResponses = append(calendarMuxResponses, CalendarMuxAPIResponse{
-			ID:          cm.ID,
-			CreatedByID: cm.CreatedByID,
-			Name:        cm.Name,
-			Description: cm.Description,
-			CreatedAt:   cm.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-			UpdatedAt:   cm.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		})
+		calendarMuxResponses = append(calendarMuxResponses, buildCalendarMuxResponse(cm, showFeed))
 	}
 
 	response := CalendarMuxListAPIResponse{
@@ -90,8 +161,146 @@ func ListCalendarMuxes(w http.ResponseWriter, r *http.Request) {
 	utils.RespondJSON(w, http.StatusOK, response)
 }
 
-// DeleteCalendarMux deletes a calendar mux owned by the authenticated user
-func DeleteCalendarMux(w http.ResponseWriter, r *http.Request) {
+// GetCalendarMux returns a calendar mux the authenticated user may see together with its sources,
+// their sync status and stored event counts, and the URL of its feed
+func (h *CalendarMuxHandler) GetCalendarMux(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	calendarMuxID, ok := parseIDParam(r, "id")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid calendar mux ID", nil)
+		return
+	}
+
+	calendarMux, err := h.muxes.Get(calendarMuxID, userID)
+	if err != nil {
+		if errors.Is(err, services.ErrCalendarMuxNotFound) {
+			utils.RespondError(w, http.StatusNotFound, "Calendar mux not found or access denied", nil)
+			return
+		}
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to retrieve calendar mux", nil)
+		return
+	}
+
+	calendarSources, err := h.muxes.GetCalendarSourcesByMux(calendarMux.ID, userID)
+	if err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to retrieve calendar mux", nil)
+		return
+	}
+
+	sourceIDs := make([]uint, 0, len(calendarSources))
+	for _, cs := range calendarSources {
+		sourceIDs = append(sourceIDs, cs.ID)
+	}
+	eventCounts, err := services.CountCalendarEventsBySources(sourceIDs)
+	if err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to retrieve calendar mux", nil)
+		return
+	}
+
+	// Build response
+	showFeed := canSeeFeed(r)
+	sourceResponses := make([]CalendarMuxSourceAPIResponse, 0, len(calendarSources))
+	for _, cs := range calendarSources {
+		sourceResponse := CalendarMuxSourceAPIResponse{
+			CalendarSourceAPIResponse: buildCalendarSourceResponse(cs),
+			EventCount:                eventCounts[cs.ID],
+		}
+		if !showFeed {
+			sourceResponse.URL = ""
+		}
+		sourceResponses = append(sourceResponses, sourceResponse)
+	}
+
+	response := CalendarMuxDetailAPIResponse{
+		CalendarMuxAPIResponse: buildCalendarMuxResponse(*calendarMux, showFeed),
+		Sources:                sourceResponses,
+	}
+	if showFeed {
+		response.FeedURL = feedURL(r, calendarMux.FeedToken)
+	}
+
+	// Validate response
+	if err := validate.Struct(response); err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Response validation failed", nil)
+		return
+	}
+
+	w.Header().Set("ETag", calendarMuxETag(calendarMux))
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+// UpdateCalendarMux applies a partial update to a calendar mux the authenticated user may edit.
+// With an If-Match header, the update only happens if the mux has not changed since that version.
+func (h *CalendarMuxHandler) UpdateCalendarMux(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	calendarMuxID, ok := parseIDParam(r, "id")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid calendar mux ID", nil)
+		return
+	}
+
+	var req UpdateCalendarMuxRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid request body", nil)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		errorMsg := "Validation failed"
+		if len(validationErrors) > 0 {
+			errorMsg = utils.GetValidationErrorMsg(validationErrors[0])
+		}
+		utils.RespondError(w, http.StatusBadRequest, errorMsg, nil)
+		return
+	}
+
+	var matches func(time.Time) bool
+	if header := r.Header.Get("If-Match"); header != "" {
+		matches = func(updatedAt time.Time) bool {
+			return ifMatch(header, updatedAt)
+		}
+	}
+
+	update := services.CalendarMuxUpdate{
+		Name:         req.Name,
+		Description:  req.Description,
+		DedupEnabled: req.DedupEnabled,
+		HouseholdID:  req.HouseholdID,
+	}
+	calendarMux, err := h.muxes.Update(calendarMuxID, userID, update, matches, middleware.GetReqID(r.Context()))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrCalendarMuxNotFound):
+			utils.RespondError(w, http.StatusNotFound, "Calendar mux not found or access denied", nil)
+		case errors.Is(err, services.ErrHouseholdNotFound):
+			utils.RespondError(w, http.StatusNotFound, "Household not found or access denied", nil)
+		case errors.Is(err, services.ErrInsufficientRole):
+			utils.RespondError(w, http.StatusForbidden, "Insufficient household role", nil)
+		case errors.Is(err, services.ErrCalendarMuxModified):
+			utils.RespondError(w, http.StatusPreconditionFailed, "Calendar mux has been modified", nil)
+		default:
+			utils.RespondError(w, http.StatusInternalServerError, "Failed to update calendar mux", nil)
+		}
+		return
+	}
+
+	w.Header().Set("ETag", calendarMuxETag(calendarMux))
+	utils.RespondJSON(w, http.StatusOK, buildCalendarMuxResponse(*calendarMux, true))
+}
+
+// DeleteCalendarMux deletes a calendar mux the authenticated user created or owns through its household
+func (h *CalendarMuxHandler) DeleteCalendarMux(w http.ResponseWriter, r *http.Request) {
 	userID, ok := auth.GetUserIDFromContext(r.Context())
 	if !ok {
 		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
@@ -105,8 +314,12 @@ func DeleteCalendarMux(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = services.DeleteCalendarMux(uint(id), userID)
+	err = h.muxes.Delete(uint(id), userID, middleware.GetReqID(r.Context()))
 	if err != nil {
+		if errors.Is(err, services.ErrInsufficientRole) {
+			utils.RespondError(w, http.StatusForbidden, "Insufficient household role", nil)
+			return
+		}
 		utils.RespondError(w, http.StatusNotFound, "Calendar mux not found or access denied", nil)
 		return
 	}
@@ -118,3 +331,71 @@ func DeleteCalendarMux(w http.ResponseWriter, r *http.Request) {
 
 	utils.RespondJSON(w, http.StatusOK, response)
 }
+
+// ListCalendarMuxTrash returns the deleted calendar muxes the authenticated user created or shares
+// through a household, which can be restored until they are purged
+func (h *CalendarMuxHandler) ListCalendarMuxTrash(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	calendarMuxes, err := h.muxes.ListDeleted(userID)
+	if err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to retrieve deleted calendar muxes", nil)
+		return
+	}
+
+	// Build response
+	response := CalendarMuxTrashAPIResponse{
+		CalendarMuxes: make([]DeletedCalendarMuxAPIResponse, 0, len(calendarMuxes)),
+	}
+	showFeed := canSeeFeed(r)
+	for _, cm := range calendarMuxes {
+		response.CalendarMuxes = append(response.CalendarMuxes, DeletedCalendarMuxAPIResponse{
+			CalendarMuxAPIResponse: buildCalendarMuxResponse(cm, showFeed),
+			DeletedAt:              cm.DeletedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
+		})
+	}
+
+	// Validate response
+	if err := validate.Struct(response); err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Response validation failed", nil)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+// RestoreCalendarMux takes a deleted calendar mux the authenticated user created or owns through its
+// household out of the trash
+func (h *CalendarMuxHandler) RestoreCalendarMux(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	calendarMuxID, ok := parseIDParam(r, "id")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid calendar mux ID", nil)
+		return
+	}
+
+	calendarMux, err := h.muxes.Restore(calendarMuxID, userID, middleware.GetReqID(r.Context()))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrCalendarMuxNotFound):
+			utils.RespondError(w, http.StatusNotFound, "Deleted calendar mux not found or access denied", nil)
+		case errors.Is(err, services.ErrInsufficientRole):
+			utils.RespondError(w, http.StatusForbidden, "Insufficient household role", nil)
+		default:
+			utils.RespondError(w, http.StatusInternalServerError, "Failed to restore calendar mux", nil)
+		}
+		return
+	}
+
+	w.Header().Set("ETag", calendarMuxETag(calendarMux))
+	utils.RespondJSON(w, http.StatusOK, buildCalendarMuxResponse(*calendarMux, true))
+}
@@ -3,6 +3,19 @@ package rest_api_handlers
 type CreateCalendarMuxRequest struct {
 	Name        string `json:"name" validate:"required,min=1,max=200"`
 	Description string `json:"description" validate:"max=1000"`
+	// DedupEnabled defaults to true when omitted
+	DedupEnabled *bool `json:"dedup_enabled"`
+	// HouseholdID shares the new mux with a household the user is at least an editor of
+	HouseholdID *uint `json:"household_id" validate:"omitempty,min=1"`
+}
+
+// UpdateCalendarMuxRequest is a partial update; omitted fields are left unchanged
+type UpdateCalendarMuxRequest struct {
+	Name         *string `json:"name" validate:"omitempty,min=1,max=200"`
+	Description  *string `json:"description" validate:"omitempty,max=1000"`
+	DedupEnabled *bool   `json:"dedup_enabled"`
+	// HouseholdID moves the mux into a household, or out of its household when 0
+	HouseholdID *uint `json:"household_id"`
 }
 
 type CalendarMuxAPIResponse struct {
@@ -10,8 +23,25 @@ type CalendarMuxAPIResponse struct {
 	CreatedByID uint   `json:"created_by_id" validate:"required"`
 	Name        string `json:"name" validate:"required,min=1,max=200"`
 	Description string `json:"description" validate:"max=1000"`
-	CreatedAt   string `json:"created_at" validate:"required"`
-	UpdatedAt   string `json:"updated_at" validate:"required"`
+	HouseholdID *uint  `json:"household_id"`
+	// FeedToken is left out for personal access tokens without the muxes:manage scope
+	FeedToken    string `json:"feed_token,omitempty"`
+	DedupEnabled bool   `json:"dedup_enabled"`
+	CreatedAt    string `json:"created_at" validate:"required"`
+	UpdatedAt    string `json:"updated_at" validate:"required"`
+}
+
+// CalendarMuxDetailAPIResponse is a calendar mux with its sources and the URL of its feed
+type CalendarMuxDetailAPIResponse struct {
+	CalendarMuxAPIResponse
+	FeedURL string                         `json:"feed_url,omitempty" validate:"omitempty,url"`
+	Sources []CalendarMuxSourceAPIResponse `json:"sources" validate:"dive"`
+}
+
+// CalendarMuxSourceAPIResponse is a source of a calendar mux with the number of events stored by its last sync
+type CalendarMuxSourceAPIResponse struct {
+	CalendarSourceAPIResponse
+	EventCount int64 `json:"event_count" validate:"min=0"`
 }
 
 type CalendarMuxListAPIResponse struct {
@@ -21,3 +51,13 @@ type CalendarMuxListAPIResponse struct {
 type DeleteCalendarMuxAPIResponse struct {
 	Message string `json:"message" validate:"required"`
 }
+
+// DeletedCalendarMuxAPIResponse is a calendar mux in the trash, with when it was deleted
+type DeletedCalendarMuxAPIResponse struct {
+	CalendarMuxAPIResponse
+	DeletedAt string `json:"deleted_at" validate:"required"`
+}
+
+type CalendarMuxTrashAPIResponse struct {
+	CalendarMuxes []DeletedCalendarMuxAPIResponse `json:"calendar_muxes" validate:"dive"`
+}
@@ -8,15 +8,20 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"regexp"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"family-calendar-backend/auth"
 	"family-calendar-backend/db"
 	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/repositories"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -27,22 +32,25 @@ func setupCalendarMuxTestDB(t *testing.T) *models.User {
 	db.DB, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	assert.NoError(t, err)
 
-	err = db.DB.AutoMigrate(&models.User{}, &models.CalendarMux{})
+	err = db.DB.AutoMigrate(&models.User{}, &models.Household{}, &models.HouseholdMember{}, &models.HouseholdInvite{}, &models.CalendarMux{}, &models.CalendarSource{}, &models.CalendarEvent{}, &models.RewriteRule{}, &models.Session{}, &models.RefreshToken{}, &models.UserIdentity{}, &models.IdentityLink{}, &models.PersonalAccessToken{}, &models.AuthorizationCode{}, &models.AuditLog{})
 	assert.NoError(t, err)
 
 	// Create a test user
 	user := &models.User{
-		GivenName:      "Test",
-		FamilyName:     "User",
-		Email:          "test@example.com",
-		AuthProvider:   "google",
-		AuthProviderID: "test-123",
+		GivenName:  "Test",
+		FamilyName: "User",
+		Email:      "test@example.com",
 	}
 	db.DB.Create(user)
 
 	return user
 }
 
+// calendarMuxHandler returns a CalendarMuxHandler over the test database
+func calendarMuxHandler() *CalendarMuxHandler {
+	return NewCalendarMuxHandler(repositories.NewGormCalendarMuxRepository(db.DB))
+}
+
 func TestCreateCalendarMux_Success(t *testing.T) {
 	user := setupCalendarMuxTestDB(t)
 
@@ -59,7 +67,7 @@ func TestCreateCalendarMux_Success(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	CreateCalendarMux(rr, req)
+	calendarMuxHandler().CreateCalendarMux(rr, req)
 
 	assert.Equal(t, http.StatusCreated, rr.Code)
 
@@ -69,6 +77,30 @@ func TestCreateCalendarMux_Success(t *testing.T) {
 	assert.Equal(t, "Test Calendar", response.Name)
 	assert.Equal(t, "Test Description", response.Description)
 	assert.Equal(t, user.ID, response.CreatedByID)
+	assert.True(t, response.DedupEnabled)
+}
+
+func TestCreateCalendarMux_DedupDisabled(t *testing.T) {
+	user := setupCalendarMuxTestDB(t)
+
+	dedupEnabled := false
+	body, _ := json.Marshal(CreateCalendarMuxRequest{Name: "Test Calendar", DedupEnabled: &dedupEnabled})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/calendar-mux", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	ctx := context.WithValue(req.Context(), auth.UserIDContextKey, user.ID)
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+
+	calendarMuxHandler().CreateCalendarMux(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	var response CalendarMuxAPIResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.False(t, response.DedupEnabled)
 }
 
 func TestCreateCalendarMux_NoAuth(t *testing.T) {
@@ -85,7 +117,7 @@ func TestCreateCalendarMux_NoAuth(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	CreateCalendarMux(rr, req)
+	calendarMuxHandler().CreateCalendarMux(rr, req)
 
 	assert.Equal(t, http.StatusUnauthorized, rr.Code)
 }
@@ -100,7 +132,7 @@ func TestCreateCalendarMux_InvalidJSON(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	CreateCalendarMux(rr, req)
+	calendarMuxHandler().CreateCalendarMux(rr, req)
 
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
@@ -122,7 +154,7 @@ func TestCreateCalendarMux_ValidationError(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	CreateCalendarMux(rr, req)
+	calendarMuxHandler().CreateCalendarMux(rr, req)
 
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
@@ -148,7 +180,7 @@ func TestListCalendarMuxes_Success(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	ListCalendarMuxes(rr, req)
+	calendarMuxHandler().ListCalendarMuxes(rr, req)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -169,7 +201,7 @@ func TestListCalendarMuxes_EmptyList(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	ListCalendarMuxes(rr, req)
+	calendarMuxHandler().ListCalendarMuxes(rr, req)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -186,7 +218,7 @@ func TestListCalendarMuxes_NoAuth(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	ListCalendarMuxes(rr, req)
+	calendarMuxHandler().ListCalendarMuxes(rr, req)
 
 	assert.Equal(t, http.StatusUnauthorized, rr.Code)
 }
@@ -213,7 +245,7 @@ func TestDeleteCalendarMux_Success(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	DeleteCalendarMux(rr, req)
+	calendarMuxHandler().DeleteCalendarMux(rr, req)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -240,7 +272,7 @@ func TestDeleteCalendarMux_NoAuth(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	DeleteCalendarMux(rr, req)
+	calendarMuxHandler().DeleteCalendarMux(rr, req)
 
 	assert.Equal(t, http.StatusUnauthorized, rr.Code)
 }
@@ -258,7 +290,7 @@ func TestDeleteCalendarMux_InvalidID(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	DeleteCalendarMux(rr, req)
+	calendarMuxHandler().DeleteCalendarMux(rr, req)
 
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
@@ -276,7 +308,7 @@ func TestDeleteCalendarMux_NotFound(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	DeleteCalendarMux(rr, req)
+	calendarMuxHandler().DeleteCalendarMux(rr, req)
 
 	assert.Equal(t, http.StatusNotFound, rr.Code)
 }
@@ -286,11 +318,9 @@ func TestDeleteCalendarMux_WrongUser(t *testing.T) {
 
 	// Create another user
 	otherUser := &models.User{
-		GivenName:      "Other",
-		FamilyName:     "User",
-		Email:          "other@example.com",
-		AuthProvider:   "google",
-		AuthProviderID: "other-123",
+		GivenName:  "Other",
+		FamilyName: "User",
+		Email:      "other@example.com",
 	}
 	db.DB.Create(otherUser)
 
@@ -313,7 +343,7 @@ func TestDeleteCalendarMux_WrongUser(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	DeleteCalendarMux(rr, req)
+	calendarMuxHandler().DeleteCalendarMux(rr, req)
 
 	assert.Equal(t, http.StatusNotFound, rr.Code)
 
@@ -335,11 +365,6 @@ func TestCreateCalendarMux_DatabaseError(t *testing.T) {
 	}), &gorm.Config{})
 	assert.NoError(t, err)
 
-	// Set up the global DB
-	originalDB := db.DB
-	db.DB = gormDB
-	defer func() { db.DB = originalDB }()
-
 	// Expect the INSERT to fail
 	mock.ExpectBegin()
 	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "calendar_muxes"`)).
@@ -359,7 +384,7 @@ func TestCreateCalendarMux_DatabaseError(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	CreateCalendarMux(rr, req)
+	NewCalendarMuxHandler(repositories.NewGormCalendarMuxRepository(gormDB)).CreateCalendarMux(rr, req)
 
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 }
@@ -375,11 +400,6 @@ func TestListCalendarMuxes_DatabaseError(t *testing.T) {
 	}), &gorm.Config{})
 	assert.NoError(t, err)
 
-	// Set up the global DB
-	originalDB := db.DB
-	db.DB = gormDB
-	defer func() { db.DB = originalDB }()
-
 	// Expect the SELECT to fail
 	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "calendar_muxes"`)).
 		WillReturnError(errors.New("database error"))
@@ -390,7 +410,448 @@ func TestListCalendarMuxes_DatabaseError(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	ListCalendarMuxes(rr, req)
+	NewCalendarMuxHandler(repositories.NewGormCalendarMuxRepository(gormDB)).ListCalendarMuxes(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
+
+// patchCalendarMuxRequest builds a PATCH request for a calendar mux, with an optional If-Match header
+func patchCalendarMuxRequest(userID, calendarMuxID uint, body string, ifMatchHeader string) *http.Request {
+	id := strconv.FormatUint(uint64(calendarMuxID), 10)
+	req := newRouteRequest(http.MethodPatch, "/api/calendar-mux/"+id, strings.NewReader(body), userID, map[string]string{"id": id})
+	if ifMatchHeader != "" {
+		req.Header.Set("If-Match", ifMatchHeader)
+	}
+	return req
+}
+
+func TestUpdateCalendarMux_Success(t *testing.T) {
+	user := setupCalendarMuxTestDB(t)
+
+	calendarMux := &models.CalendarMux{CreatedByID: user.ID, Name: "Family", Description: "Everyone"}
+	db.DB.Create(calendarMux)
+
+	rr := httptest.NewRecorder()
+	calendarMuxHandler().UpdateCalendarMux(rr, patchCalendarMuxRequest(user.ID, calendarMux.ID, `{"name":"Household","dedup_enabled":false}`, ""))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotEmpty(t, rr.Header().Get("ETag"))
+
+	var response CalendarMuxAPIResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "Household", response.Name)
+	assert.Equal(t, "Everyone", response.Description)
+	assert.False(t, response.DedupEnabled)
+	assert.Equal(t, calendarMux.FeedToken, response.FeedToken)
+
+	var found models.CalendarMux
+	db.DB.First(&found, calendarMux.ID)
+	assert.Equal(t, "Household", found.Name)
+	assert.True(t, found.DedupDisabled)
+}
+
+func TestUpdateCalendarMux_IfMatch(t *testing.T) {
+	user := setupCalendarMuxTestDB(t)
+
+	calendarMux := &models.CalendarMux{CreatedByID: user.ID, Name: "Family"}
+	db.DB.Create(calendarMux)
+
+	// The ETag of a response is accepted by the next update
+	rr := httptest.NewRecorder()
+	calendarMuxHandler().UpdateCalendarMux(rr, patchCalendarMuxRequest(user.ID, calendarMux.ID, `{"description":"First"}`, calendarMuxETag(calendarMux)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	etag := rr.Header().Get("ETag")
+
+	// The version the first update replaced is now stale
+	rr = httptest.NewRecorder()
+	calendarMuxHandler().UpdateCalendarMux(rr, patchCalendarMuxRequest(user.ID, calendarMux.ID, `{"description":"Stale"}`, calendarMuxETag(calendarMux)))
+	assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Calendar mux has been modified")
+
+	rr = httptest.NewRecorder()
+	calendarMuxHandler().UpdateCalendarMux(rr, patchCalendarMuxRequest(user.ID, calendarMux.ID, `{"description":"Second"}`, etag))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var found models.CalendarMux
+	db.DB.First(&found, calendarMux.ID)
+	assert.Equal(t, "Second", found.Description)
+}
+
+func TestUpdateCalendarMux_IfMatchWithinOneSecond(t *testing.T) {
+	user := setupCalendarMuxTestDB(t)
+
+	calendarMux := &models.CalendarMux{CreatedByID: user.ID, Name: "Family"}
+	db.DB.Create(calendarMux)
+	read := time.Date(2025, 1, 6, 9, 30, 15, 100000000, time.UTC)
+	db.DB.Model(calendarMux).UpdateColumn("updated_at", read)
+
+	rr := httptest.NewRecorder()
+	calendarMuxHandler().GetCalendarMux(rr, getCalendarMuxRequest(user.ID, calendarMux.ID))
+	require.Equal(t, http.StatusOK, rr.Code)
+	etag := rr.Header().Get("ETag")
+	var response CalendarMuxDetailAPIResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, `"`+response.UpdatedAt+`"`, etag)
+
+	// Another client writes within the same second
+	db.DB.Model(calendarMux).UpdateColumns(map[string]interface{}{
+		"description": "Concurrent",
+		"updated_at":  read.Add(100 * time.Millisecond),
+	})
+
+	// Neither the version read nor its second matches the concurrent write
+	for _, tag := range []string{etag, response.UpdatedAt, read.Format(time.RFC3339)} {
+		rr = httptest.NewRecorder()
+		calendarMuxHandler().UpdateCalendarMux(rr, patchCalendarMuxRequest(user.ID, calendarMux.ID, `{"description":"Stale"}`, tag))
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code, tag)
+	}
+
+	var found models.CalendarMux
+	db.DB.First(&found, calendarMux.ID)
+	assert.Equal(t, "Concurrent", found.Description)
+}
+
+func TestIfMatch(t *testing.T) {
+	updatedAt := time.Date(2025, 1, 6, 9, 30, 15, 123456789, time.UTC)
+
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{name: "ETag", header: `"2025-01-06T09:30:15.123456789Z"`, want: true},
+		{name: "Other timezone", header: `"2025-01-06T10:30:15.123456789+01:00"`, want: true},
+		{name: "Body updated_at", header: "2025-01-06T09:30:15.123456789Z", want: true},
+		{name: "Whole second", header: "2025-01-06T09:30:15Z", want: false},
+		{name: "Any", header: "*", want: true},
+		{name: "One of several", header: `"2024-01-01T00:00:00Z", "2025-01-06T09:30:15.123456789Z"`, want: true},
+		{name: "Older version", header: `"2025-01-06T09:30:14.123456789Z"`, want: false},
+		{name: "Other fraction", header: `"2025-01-06T09:30:15.5Z"`, want: false},
+		{name: "Weak", header: `W/"2025-01-06T09:30:15.123456789Z"`, want: false},
+		{name: "Malformed", header: `"v1"`, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ifMatch(tt.header, updatedAt))
+		})
+	}
+}
+
+func TestUpdateCalendarMux_Errors(t *testing.T) {
+	user := setupCalendarMuxTestDB(t)
+	otherUser := &models.User{GivenName: "Other", FamilyName: "User", Email: "other@example.com"}
+	db.DB.Create(otherUser)
+
+	calendarMux := &models.CalendarMux{CreatedByID: user.ID, Name: "Family"}
+	db.DB.Create(calendarMux)
+
+	tests := []struct {
+		name       string
+		userID     uint
+		id         uint
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{name: "No auth", userID: 0, id: calendarMux.ID, body: `{"name":"X"}`, wantStatus: http.StatusUnauthorized, wantError: "User not authenticated"},
+		{name: "Invalid JSON", userID: user.ID, id: calendarMux.ID, body: `{`, wantStatus: http.StatusBadRequest, wantError: "Invalid request body"},
+		{name: "Empty name", userID: user.ID, id: calendarMux.ID, body: `{"name":""}`, wantStatus: http.StatusBadRequest, wantError: "Value too small (min: 1)"},
+		{name: "Long description", userID: user.ID, id: calendarMux.ID, body: `{"description":"` + strings.Repeat("a", 1001) + `"}`, wantStatus: http.StatusBadRequest, wantError: "Value too large (max: 1000)"},
+		{name: "Wrong user", userID: otherUser.ID, id: calendarMux.ID, body: `{"name":"X"}`, wantStatus: http.StatusNotFound, wantError: "Calendar mux not found or access denied"},
+		{name: "Unknown mux", userID: user.ID, id: 9999, body: `{"name":"X"}`, wantStatus: http.StatusNotFound, wantError: "Calendar mux not found or access denied"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			calendarMuxHandler().UpdateCalendarMux(rr, patchCalendarMuxRequest(tt.userID, tt.id, tt.body, ""))
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.wantError)
+		})
+	}
+
+	var found models.CalendarMux
+	db.DB.First(&found, calendarMux.ID)
+	assert.Equal(t, "Family", found.Name)
+}
+
+func TestUpdateCalendarMux_InvalidID(t *testing.T) {
+	user := setupCalendarMuxTestDB(t)
+
+	req := newRouteRequest(http.MethodPatch, "/api/calendar-mux/abc", strings.NewReader(`{}`), user.ID, map[string]string{"id": "abc"})
+	rr := httptest.NewRecorder()
+
+	calendarMuxHandler().UpdateCalendarMux(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func getCalendarMuxRequest(userID, calendarMuxID uint) *http.Request {
+	id := strconv.FormatUint(uint64(calendarMuxID), 10)
+	return newRouteRequest(http.MethodGet, "/api/calendar-mux/"+id, nil, userID, map[string]string{"id": id})
+}
+
+func TestGetCalendarMux_Success(t *testing.T) {
+	user := setupCalendarMuxTestDB(t)
+
+	calendarMux := &models.CalendarMux{CreatedByID: user.ID, Name: "Family", Description: "Everyone"}
+	db.DB.Create(calendarMux)
+
+	syncedAt := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	school := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/school.ics", Label: "School", Enabled: true,
+		LastSyncAt: &syncedAt, LastSuccessAt: &syncedAt}
+	db.DB.Create(school)
+	work := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/work.ics", Label: "Work", Enabled: true,
+		LastSyncAt: &syncedAt, LastErrorAt: &syncedAt, LastError: "upstream returned 500"}
+	db.DB.Create(work)
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: school.ID, UID: "1", Data: "1"})
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: school.ID, UID: "2", Data: "2"})
+
+	other := &models.CalendarMux{CreatedByID: user.ID, Name: "Other"}
+	db.DB.Create(other)
+	db.DB.Create(&models.CalendarSource{CalendarMuxID: other.ID, URL: "https://example.com/other.ics", Label: "Other", Enabled: true})
+
+	req := getCalendarMuxRequest(user.ID, calendarMux.ID)
+	req.Host = "calendar.example.com"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	rr := httptest.NewRecorder()
+
+	calendarMuxHandler().GetCalendarMux(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, calendarMuxETag(calendarMux), rr.Header().Get("ETag"))
+
+	var response CalendarMuxDetailAPIResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, calendarMux.ID, response.ID)
+	assert.Equal(t, "Family", response.Name)
+	assert.Equal(t, "Everyone", response.Description)
+	assert.Equal(t, "https://calendar.example.com/feeds/"+calendarMux.FeedToken+".ics", response.FeedURL)
+
+	if assert.Len(t, response.Sources, 2) {
+		assert.Equal(t, "School", response.Sources[0].Label)
+		assert.Equal(t, int64(2), response.Sources[0].EventCount)
+		assert.Equal(t, "2025-01-06T09:00:00Z", *response.Sources[0].Status.LastSyncAt)
+		assert.Equal(t, "", response.Sources[0].Status.LastError)
+
+		assert.Equal(t, "Work", response.Sources[1].Label)
+		assert.Equal(t, int64(0), response.Sources[1].EventCount)
+		assert.Equal(t, "upstream returned 500", response.Sources[1].Status.LastError)
+		assert.Nil(t, response.Sources[1].Status.LastSuccessAt)
+	}
+}
+
+func TestGetCalendarMux_NoSources(t *testing.T) {
+	user := setupCalendarMuxTestDB(t)
+
+	calendarMux := &models.CalendarMux{CreatedByID: user.ID, Name: "Family"}
+	db.DB.Create(calendarMux)
+
+	rr := httptest.NewRecorder()
+	calendarMuxHandler().GetCalendarMux(rr, getCalendarMuxRequest(user.ID, calendarMux.ID))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"sources":[]`)
+	assert.Contains(t, rr.Body.String(), `"feed_url":"http://example.com/feeds/`)
+}
+
+func TestCalendarMux_FeedNeedsManageScope(t *testing.T) {
+	user := setupCalendarMuxTestDB(t)
+
+	calendarMux := &models.CalendarMux{CreatedByID: user.ID, Name: "Family"}
+	db.DB.Create(calendarMux)
+	withScopes := func(req *http.Request, scopes ...string) *http.Request {
+		return req.WithContext(context.WithValue(req.Context(), auth.ScopesContextKey, scopes))
+	}
+	listRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/api/calendar-mux", nil)
+		return req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, user.ID))
+	}
+
+	// A token that may only read events sees neither the feed token nor the feed URL
+	rr := httptest.NewRecorder()
+	calendarMuxHandler().ListCalendarMuxes(rr, withScopes(listRequest(), models.ScopeEventsRead))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), calendarMux.FeedToken)
+	assert.NotContains(t, rr.Body.String(), "feed_token")
+
+	rr = httptest.NewRecorder()
+	calendarMuxHandler().GetCalendarMux(rr, withScopes(getCalendarMuxRequest(user.ID, calendarMux.ID), models.ScopeEventsRead))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), calendarMux.FeedToken)
+	assert.NotContains(t, rr.Body.String(), "feed_url")
+
+	// A token that manages muxes does
+	rr = httptest.NewRecorder()
+	calendarMuxHandler().ListCalendarMuxes(rr, withScopes(listRequest(), models.ScopeEventsRead, models.ScopeMuxesManage))
+	assert.Contains(t, rr.Body.String(), `"feed_token":"`+calendarMux.FeedToken+`"`)
+
+	rr = httptest.NewRecorder()
+	calendarMuxHandler().GetCalendarMux(rr, withScopes(getCalendarMuxRequest(user.ID, calendarMux.ID), models.ScopeMuxesManage))
+	var response CalendarMuxDetailAPIResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, calendarMux.FeedToken, response.FeedToken)
+	assert.Equal(t, "http://example.com/feeds/"+calendarMux.FeedToken+".ics", response.FeedURL)
+}
+
+func TestGetCalendarMux_SourceURLsNeedManageScope(t *testing.T) {
+	user := setupCalendarMuxTestDB(t)
+
+	calendarMux := &models.CalendarMux{CreatedByID: user.ID, Name: "Family"}
+	db.DB.Create(calendarMux)
+	secretURL := "https://calendar.example.com/private/secret-address/basic.ics"
+	db.DB.Create(&models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: secretURL, Label: "School", Enabled: true, Visibility: models.VisibilityFull})
+	withScopes := func(req *http.Request, scopes ...string) *http.Request {
+		return req.WithContext(context.WithValue(req.Context(), auth.ScopesContextKey, scopes))
+	}
+
+	// A token that may only read events sees the source but not its secret address
+	rr := httptest.NewRecorder()
+	calendarMuxHandler().GetCalendarMux(rr, withScopes(getCalendarMuxRequest(user.ID, calendarMux.ID), models.ScopeEventsRead))
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), secretURL)
+	var response CalendarMuxDetailAPIResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Len(t, response.Sources, 1)
+	assert.Equal(t, "School", response.Sources[0].Label)
+	assert.Empty(t, response.Sources[0].URL)
+
+	rr = httptest.NewRecorder()
+	calendarMuxHandler().GetCalendarMux(rr, withScopes(getCalendarMuxRequest(user.ID, calendarMux.ID), models.ScopeMuxesManage))
+	require.Equal(t, http.StatusOK, rr.Code)
+	response = CalendarMuxDetailAPIResponse{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Len(t, response.Sources, 1)
+	assert.Equal(t, secretURL, response.Sources[0].URL)
+}
+
+func TestGetCalendarMux_Errors(t *testing.T) {
+	user := setupCalendarMuxTestDB(t)
+	otherUser := &models.User{GivenName: "Other", FamilyName: "User", Email: "other@example.com"}
+	db.DB.Create(otherUser)
+
+	calendarMux := &models.CalendarMux{CreatedByID: user.ID, Name: "Family"}
+	db.DB.Create(calendarMux)
+
+	tests := []struct {
+		name       string
+		req        *http.Request
+		wantStatus int
+	}{
+		{name: "No auth", req: getCalendarMuxRequest(0, calendarMux.ID), wantStatus: http.StatusUnauthorized},
+		{name: "Wrong user", req: getCalendarMuxRequest(otherUser.ID, calendarMux.ID), wantStatus: http.StatusNotFound},
+		{name: "Unknown mux", req: getCalendarMuxRequest(user.ID, 9999), wantStatus: http.StatusNotFound},
+		{name: "Invalid ID", req: newRouteRequest(http.MethodGet, "/api/calendar-mux/abc", nil, user.ID, map[string]string{"id": "abc"}), wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			calendarMuxHandler().GetCalendarMux(rr, tt.req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+		})
+	}
+}
+
+func TestGetCalendarMux_DatabaseError(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer sqlDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: sqlDB,
+	}), &gorm.Config{})
+	assert.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "calendar_muxes"`)).
+		WillReturnError(errors.New("database error"))
+
+	rr := httptest.NewRecorder()
+	NewCalendarMuxHandler(repositories.NewGormCalendarMuxRepository(gormDB)).GetCalendarMux(rr, getCalendarMuxRequest(1, 1))
 
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 }
+
+func TestCalendarMuxTrash_DeleteAndRestore(t *testing.T) {
+	t.Parallel()
+	muxes := repositories.NewMemoryCalendarMuxRepository()
+	handler := NewCalendarMuxHandler(muxes)
+	householdID := uint(7)
+	muxes.AddHouseholdMember(householdID, 1, models.HouseholdRoleOwner)
+	muxes.AddHouseholdMember(householdID, 2, models.HouseholdRoleViewer)
+	calendarMux := &models.CalendarMux{CreatedByID: 1, Name: "Family", HouseholdID: &householdID}
+	require.NoError(t, muxes.Create(calendarMux))
+	params := map[string]string{"id": strconv.Itoa(int(calendarMux.ID))}
+
+	rr := httptest.NewRecorder()
+	handler.DeleteCalendarMux(rr, newRouteRequest("DELETE", "/api/calendar-mux/1", nil, 1, params))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	// The deleted mux is in the trash of everyone who saw it
+	for _, userID := range []uint{1, 2} {
+		rr = httptest.NewRecorder()
+		handler.ListCalendarMuxTrash(rr, newRouteRequest("GET", "/api/calendar-mux/trash", nil, userID, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		var trash CalendarMuxTrashAPIResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &trash))
+		require.Len(t, trash.CalendarMuxes, 1)
+		assert.Equal(t, calendarMux.ID, trash.CalendarMuxes[0].ID)
+		assert.NotEmpty(t, trash.CalendarMuxes[0].DeletedAt)
+	}
+
+	// Restoring takes the role needed to delete
+	rr = httptest.NewRecorder()
+	handler.RestoreCalendarMux(rr, newRouteRequest("POST", "/api/calendar-mux/1/restore", nil, 2, params))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.RestoreCalendarMux(rr, newRouteRequest("POST", "/api/calendar-mux/1/restore", nil, 1, params))
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"name":"Family"`)
+	assert.NotEmpty(t, rr.Header().Get("ETag"))
+
+	rr = httptest.NewRecorder()
+	handler.ListCalendarMuxTrash(rr, newRouteRequest("GET", "/api/calendar-mux/trash", nil, 1, nil))
+	assert.JSONEq(t, `{"calendar_muxes":[]}`, rr.Body.String())
+	rr = httptest.NewRecorder()
+	handler.ListCalendarMuxes(rr, newRouteRequest("GET", "/api/calendar-mux", nil, 2, nil))
+	assert.Contains(t, rr.Body.String(), `"name":"Family"`)
+}
+
+func TestRestoreCalendarMux_Errors(t *testing.T) {
+	t.Parallel()
+	muxes := repositories.NewMemoryCalendarMuxRepository()
+	handler := NewCalendarMuxHandler(muxes)
+	calendarMux := &models.CalendarMux{CreatedByID: 1, Name: "Family"}
+	require.NoError(t, muxes.Create(calendarMux))
+	params := map[string]string{"id": strconv.Itoa(int(calendarMux.ID))}
+
+	tests := []struct {
+		name   string
+		userID uint
+		params map[string]string
+		status int
+	}{
+		{"not in the trash", 1, params, http.StatusNotFound},
+		{"unknown mux", 1, map[string]string{"id": "9999"}, http.StatusNotFound},
+		{"invalid ID", 1, map[string]string{"id": "abc"}, http.StatusBadRequest},
+		{"not authenticated", 0, params, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.RestoreCalendarMux(rr, newRouteRequest("POST", "/api/calendar-mux/1/restore", nil, tt.userID, tt.params))
+			assert.Equal(t, tt.status, rr.Code)
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ListCalendarMuxTrash(rr, newRouteRequest("GET", "/api/calendar-mux/trash", nil, 0, nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
@@ -0,0 +1,271 @@
+package rest_api_handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"family-calendar-backend/auth"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/services"
+	"family-calendar-backend/ical"
+	"family-calendar-backend/rest_api_handlers/utils"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-playground/validator/v10"
+)
+
+// parseIDParam parses a numeric chi URL parameter
+func parseIDParam(r *http.Request, name string) (uint, bool) {
+	id, err := strconv.ParseUint(chi.URLParam(r, name), 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// normalizeSourceURL accepts http, https and webcal URLs on public hosts, rewriting webcal to https.
+// Names resolving to internal addresses are rejected later by the sync transport.
+func normalizeSourceURL(rawURL string) (string, bool) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Hostname() == "" || !ical.IsPublicHost(parsed.Hostname()) {
+		return "", false
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https":
+	case "webcal":
+		parsed.Scheme = "https"
+	default:
+		return "", false
+	}
+	return parsed.String(), true
+}
+
+// formatOptionalTime formats a nullable timestamp for API responses
+func formatOptionalTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := t.Format("2006-01-02T15:04:05Z07:00")
+	return &formatted
+}
+
+func buildCalendarSourceResponse(cs models.CalendarSource) CalendarSourceAPIResponse {
+	return CalendarSourceAPIResponse{
+		ID:            cs.ID,
+		CalendarMuxID: cs.CalendarMuxID,
+		URL:           cs.URL,
+		Label:         cs.Label,
+		Enabled:       cs.Enabled,
+		Visibility:    cs.Visibility,
+		Status: CalendarSourceStatusAPIResponse{
+			LastSyncAt:     formatOptionalTime(cs.LastSyncAt),
+			LastSuccessAt:  formatOptionalTime(cs.LastSuccessAt),
+			LastErrorAt:    formatOptionalTime(cs.LastErrorAt),
+			LastError:      cs.LastError,
+			UnchangedSince: formatOptionalTime(cs.UnchangedSince),
+		},
+		CreatedAt: cs.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt: cs.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
+// CreateCalendarSource attaches an external ICS feed to a calendar mux the authenticated user may edit
+func (h *CalendarMuxHandler) CreateCalendarSource(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	calendarMuxID, ok := parseIDParam(r, "id")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid calendar mux ID", nil)
+		return
+	}
+
+	var req CreateCalendarSourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid request body", nil)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		errorMsg := "Validation failed"
+		if len(validationErrors) > 0 {
+			errorMsg = utils.GetValidationErrorMsg(validationErrors[0])
+		}
+		utils.RespondError(w, http.StatusBadRequest, errorMsg, nil)
+		return
+	}
+
+	sourceURL, ok := normalizeSourceURL(req.URL)
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "URL must use http, https or webcal and a public host", nil)
+		return
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	visibility := req.Visibility
+	if visibility == "" {
+		visibility = models.VisibilityFull
+	}
+
+	calendarSource, err := h.muxes.CreateCalendarSource(calendarMuxID, userID, sourceURL, req.Label, enabled, visibility, middleware.GetReqID(r.Context()))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrCalendarMuxNotFound):
+			utils.RespondError(w, http.StatusNotFound, "Calendar mux not found or access denied", nil)
+		case errors.Is(err, services.ErrInsufficientRole):
+			utils.RespondError(w, http.StatusForbidden, "Insufficient household role", nil)
+		default:
+			utils.RespondError(w, http.StatusInternalServerError, "Failed to create calendar source", nil)
+		}
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusCreated, buildCalendarSourceResponse(*calendarSource))
+}
+
+// ListCalendarSources returns all sources attached to a calendar mux the authenticated user may see
+func (h *CalendarMuxHandler) ListCalendarSources(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	calendarMuxID, ok := parseIDParam(r, "id")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid calendar mux ID", nil)
+		return
+	}
+
+	calendarSources, err := h.muxes.GetCalendarSourcesByMux(calendarMuxID, userID)
+	if err != nil {
+		if errors.Is(err, services.ErrCalendarMuxNotFound) {
+			utils.RespondError(w, http.StatusNotFound, "Calendar mux not found or access denied", nil)
+			return
+		}
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to retrieve calendar sources", nil)
+		return
+	}
+
+	// Build response
+	sourceResponses := make([]CalendarSourceAPIResponse, 0)
+	for _, cs := range calendarSources {
+		sourceResponses = append(sourceResponses, buildCalendarSourceResponse(cs))
+	}
+
+	response := CalendarSourceListAPIResponse{
+		Sources: sourceResponses,
+	}
+
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+// UpdateCalendarSourceVisibility changes how much of a source's events the merged outputs reveal
+func (h *CalendarMuxHandler) UpdateCalendarSourceVisibility(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	calendarMuxID, ok := parseIDParam(r, "id")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid calendar mux ID", nil)
+		return
+	}
+
+	sourceID, ok := parseIDParam(r, "sourceID")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid calendar source ID", nil)
+		return
+	}
+
+	var req UpdateCalendarSourceVisibilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid request body", nil)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		errorMsg := "Validation failed"
+		if len(validationErrors) > 0 {
+			errorMsg = utils.GetValidationErrorMsg(validationErrors[0])
+		}
+		utils.RespondError(w, http.StatusBadRequest, errorMsg, nil)
+		return
+	}
+
+	calendarSource, err := h.muxes.UpdateCalendarSourceVisibility(sourceID, calendarMuxID, userID, req.Visibility, middleware.GetReqID(r.Context()))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrCalendarMuxNotFound):
+			utils.RespondError(w, http.StatusNotFound, "Calendar mux not found or access denied", nil)
+		case errors.Is(err, services.ErrCalendarSourceNotFound):
+			utils.RespondError(w, http.StatusNotFound, "Calendar source not found", nil)
+		case errors.Is(err, services.ErrInsufficientRole):
+			utils.RespondError(w, http.StatusForbidden, "Insufficient household role", nil)
+		default:
+			utils.RespondError(w, http.StatusInternalServerError, "Failed to update calendar source", nil)
+		}
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, buildCalendarSourceResponse(*calendarSource))
+}
+
+// DeleteCalendarSource detaches a source from a calendar mux the authenticated user may edit
+func (h *CalendarMuxHandler) DeleteCalendarSource(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	calendarMuxID, ok := parseIDParam(r, "id")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid calendar mux ID", nil)
+		return
+	}
+
+	sourceID, ok := parseIDParam(r, "sourceID")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid calendar source ID", nil)
+		return
+	}
+
+	err := h.muxes.DeleteCalendarSource(sourceID, calendarMuxID, userID, middleware.GetReqID(r.Context()))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrCalendarMuxNotFound):
+			utils.RespondError(w, http.StatusNotFound, "Calendar mux not found or access denied", nil)
+		case errors.Is(err, services.ErrCalendarSourceNotFound):
+			utils.RespondError(w, http.StatusNotFound, "Calendar source not found", nil)
+		case errors.Is(err, services.ErrInsufficientRole):
+			utils.RespondError(w, http.StatusForbidden, "Insufficient household role", nil)
+		default:
+			utils.RespondError(w, http.StatusInternalServerError, "Failed to delete calendar source", nil)
+		}
+		return
+	}
+
+	response := DeleteCalendarSourceAPIResponse{
+		Message: "Calendar source deleted successfully",
+	}
+
+	utils.RespondJSON(w, http.StatusOK, response)
+}
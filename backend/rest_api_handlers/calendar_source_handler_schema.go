@@ -0,0 +1,45 @@
+package rest_api_handlers
+
+type CreateCalendarSourceRequest struct {
+	URL     string `json:"url" validate:"required,url,max=2048"`
+	Label   string `json:"label" validate:"required,min=1,max=200"`
+	Enabled *bool  `json:"enabled"`
+	// Visibility defaults to full when omitted
+	Visibility string `json:"visibility" validate:"omitempty,oneof=full title_only busy_only"`
+}
+
+type UpdateCalendarSourceVisibilityRequest struct {
+	Visibility string `json:"visibility" validate:"required,oneof=full title_only busy_only"`
+}
+
+type CalendarSourceAPIResponse struct {
+	ID            uint `json:"id" validate:"required"`
+	CalendarMuxID uint `json:"calendar_mux_id" validate:"required"`
+	// URL is left out for personal access tokens without the muxes:manage scope
+	URL        string                          `json:"url,omitempty" validate:"omitempty,url,max=2048"`
+	Label      string                          `json:"label" validate:"required,min=1,max=200"`
+	Enabled    bool                            `json:"enabled"`
+	Visibility string                          `json:"visibility" validate:"required,oneof=full title_only busy_only"`
+	Status     CalendarSourceStatusAPIResponse `json:"status"`
+	CreatedAt  string                          `json:"created_at" validate:"required"`
+	UpdatedAt  string                          `json:"updated_at" validate:"required"`
+}
+
+// CalendarSourceStatusAPIResponse reports the outcome of the background sync of a source.
+// Timestamps are null until the corresponding event has happened.
+type CalendarSourceStatusAPIResponse struct {
+	LastSyncAt    *string `json:"last_sync_at"`
+	LastSuccessAt *string `json:"last_success_at"`
+	LastErrorAt   *string `json:"last_error_at"`
+	LastError     string  `json:"last_error"`
+	// UnchangedSince is when the upstream calendar content last changed
+	UnchangedSince *string `json:"unchanged_since"`
+}
+
+type CalendarSourceListAPIResponse struct {
+	Sources []CalendarSourceAPIResponse `json:"sources" validate:"dive"`
+}
+
+type DeleteCalendarSourceAPIResponse struct {
+	Message string `json:"message" validate:"required"`
+}
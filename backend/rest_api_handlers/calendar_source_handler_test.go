@@ -0,0 +1,350 @@
+package rest_api_handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"family-calendar-backend/auth"
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// newRouteRequest builds a request carrying an authenticated user and chi URL params
+func newRouteRequest(method, target string, body io.Reader, userID uint, params map[string]string) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Content-Type", "application/json")
+	ctx := req.Context()
+	if userID != 0 {
+		ctx = context.WithValue(ctx, auth.UserIDContextKey, userID)
+	}
+	rctx := chi.NewRouteContext()
+	for key, value := range params {
+		rctx.URLParams.Add(key, value)
+	}
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+	return req.WithContext(ctx)
+}
+
+func setupCalendarSourceTestDB(t *testing.T) (*models.User, *models.CalendarMux) {
+	user := setupCalendarMuxTestDB(t)
+
+	calendarMux := &models.CalendarMux{
+		CreatedByID: user.ID,
+		Name:        "Family",
+	}
+	db.DB.Create(calendarMux)
+
+	return user, calendarMux
+}
+
+func TestCreateCalendarSource_Success(t *testing.T) {
+	user, calendarMux := setupCalendarSourceTestDB(t)
+
+	body, _ := json.Marshal(CreateCalendarSourceRequest{
+		URL:   "webcal://example.com/school.ics",
+		Label: "School",
+	})
+	req := newRouteRequest(http.MethodPost, "/api/calendar-mux/1/sources", bytes.NewReader(body), user.ID, map[string]string{"id": "1"})
+	rr := httptest.NewRecorder()
+
+	calendarMuxHandler().CreateCalendarSource(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	var response CalendarSourceAPIResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, calendarMux.ID, response.CalendarMuxID)
+	assert.Equal(t, "https://example.com/school.ics", response.URL)
+	assert.Equal(t, "School", response.Label)
+	assert.True(t, response.Enabled)
+	assert.Equal(t, "full", response.Visibility)
+}
+
+func TestCreateCalendarSource_Visibility(t *testing.T) {
+	user, _ := setupCalendarSourceTestDB(t)
+
+	body, _ := json.Marshal(CreateCalendarSourceRequest{
+		URL:        "https://example.com/work.ics",
+		Label:      "Work",
+		Visibility: "busy_only",
+	})
+	req := newRouteRequest(http.MethodPost, "/api/calendar-mux/1/sources", bytes.NewReader(body), user.ID, map[string]string{"id": "1"})
+	rr := httptest.NewRecorder()
+
+	calendarMuxHandler().CreateCalendarSource(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	var response CalendarSourceAPIResponse
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.Equal(t, "busy_only", response.Visibility)
+}
+
+func TestCreateCalendarSource_Disabled(t *testing.T) {
+	user, _ := setupCalendarSourceTestDB(t)
+
+	enabled := false
+	body, _ := json.Marshal(CreateCalendarSourceRequest{
+		URL:     "https://example.com/work.ics",
+		Label:   "Work",
+		Enabled: &enabled,
+	})
+	req := newRouteRequest(http.MethodPost, "/api/calendar-mux/1/sources", bytes.NewReader(body), user.ID, map[string]string{"id": "1"})
+	rr := httptest.NewRecorder()
+
+	calendarMuxHandler().CreateCalendarSource(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	var response CalendarSourceAPIResponse
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.False(t, response.Enabled)
+}
+
+func TestCreateCalendarSource_NoAuth(t *testing.T) {
+	setupCalendarSourceTestDB(t)
+
+	req := newRouteRequest(http.MethodPost, "/api/calendar-mux/1/sources", bytes.NewReader([]byte("{}")), 0, map[string]string{"id": "1"})
+	rr := httptest.NewRecorder()
+
+	calendarMuxHandler().CreateCalendarSource(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestCreateCalendarSource_InvalidRequests(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		body string
+	}{
+		{name: "Invalid mux ID", id: "abc", body: `{"url":"https://example.com/a.ics","label":"A"}`},
+		{name: "Invalid JSON", id: "1", body: `invalid json`},
+		{name: "Missing label", id: "1", body: `{"url":"https://example.com/a.ics"}`},
+		{name: "Invalid URL", id: "1", body: `{"url":"not a url","label":"A"}`},
+		{name: "Unsupported scheme", id: "1", body: `{"url":"ftp://example.com/a.ics","label":"A"}`},
+		{name: "Loopback host", id: "1", body: `{"url":"http://127.0.0.1:5432/a.ics","label":"A"}`},
+		{name: "Metadata host", id: "1", body: `{"url":"http://169.254.169.254/latest/meta-data","label":"A"}`},
+		{name: "Localhost name", id: "1", body: `{"url":"webcal://localhost/a.ics","label":"A"}`},
+		{name: "Unknown visibility", id: "1", body: `{"url":"https://example.com/a.ics","label":"A","visibility":"secret"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, _ := setupCalendarSourceTestDB(t)
+
+			req := newRouteRequest(http.MethodPost, "/api/calendar-mux/"+tt.id+"/sources", bytes.NewReader([]byte(tt.body)), user.ID, map[string]string{"id": tt.id})
+			rr := httptest.NewRecorder()
+
+			calendarMuxHandler().CreateCalendarSource(rr, req)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+		})
+	}
+}
+
+func TestCreateCalendarSource_WrongUser(t *testing.T) {
+	setupCalendarSourceTestDB(t)
+
+	otherUser := &models.User{
+		GivenName:  "Other",
+		FamilyName: "User",
+		Email:      "other@example.com",
+	}
+	db.DB.Create(otherUser)
+
+	body, _ := json.Marshal(CreateCalendarSourceRequest{URL: "https://example.com/a.ics", Label: "A"})
+	req := newRouteRequest(http.MethodPost, "/api/calendar-mux/1/sources", bytes.NewReader(body), otherUser.ID, map[string]string{"id": "1"})
+	rr := httptest.NewRecorder()
+
+	calendarMuxHandler().CreateCalendarSource(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestListCalendarSources_Success(t *testing.T) {
+	user, calendarMux := setupCalendarSourceTestDB(t)
+
+	db.DB.Create(&models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/a.ics", Label: "A", Enabled: true})
+	db.DB.Create(&models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/b.ics", Label: "B", Enabled: true})
+
+	req := newRouteRequest(http.MethodGet, "/api/calendar-mux/1/sources", nil, user.ID, map[string]string{"id": "1"})
+	rr := httptest.NewRecorder()
+
+	calendarMuxHandler().ListCalendarSources(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response CalendarSourceListAPIResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Len(t, response.Sources, 2)
+	assert.Equal(t, "A", response.Sources[0].Label)
+	assert.Equal(t, "B", response.Sources[1].Label)
+}
+
+func TestListCalendarSources_IncludesSyncStatus(t *testing.T) {
+	user, calendarMux := setupCalendarSourceTestDB(t)
+
+	syncedAt := time.Date(2025, 1, 2, 8, 0, 0, 0, time.UTC)
+	changedAt := time.Date(2024, 12, 20, 8, 0, 0, 0, time.UTC)
+	db.DB.Create(&models.CalendarSource{
+		CalendarMuxID:  calendarMux.ID,
+		URL:            "https://example.com/a.ics",
+		Label:          "A",
+		Enabled:        true,
+		LastSyncAt:     &syncedAt,
+		LastSuccessAt:  &syncedAt,
+		UnchangedSince: &changedAt,
+	})
+
+	req := newRouteRequest(http.MethodGet, "/api/calendar-mux/1/sources", nil, user.ID, map[string]string{"id": "1"})
+	rr := httptest.NewRecorder()
+
+	calendarMuxHandler().ListCalendarSources(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response CalendarSourceListAPIResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	status := response.Sources[0].Status
+	assert.Equal(t, "2025-01-02T08:00:00Z", *status.LastSyncAt)
+	assert.Equal(t, "2025-01-02T08:00:00Z", *status.LastSuccessAt)
+	assert.Equal(t, "2024-12-20T08:00:00Z", *status.UnchangedSince)
+	assert.Nil(t, status.LastErrorAt)
+	assert.Equal(t, "", status.LastError)
+}
+
+func TestListCalendarSources_NotFound(t *testing.T) {
+	user, _ := setupCalendarSourceTestDB(t)
+
+	req := newRouteRequest(http.MethodGet, "/api/calendar-mux/9999/sources", nil, user.ID, map[string]string{"id": "9999"})
+	rr := httptest.NewRecorder()
+
+	calendarMuxHandler().ListCalendarSources(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestListCalendarSources_NoAuth(t *testing.T) {
+	req := newRouteRequest(http.MethodGet, "/api/calendar-mux/1/sources", nil, 0, map[string]string{"id": "1"})
+	rr := httptest.NewRecorder()
+
+	calendarMuxHandler().ListCalendarSources(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestDeleteCalendarSource_Success(t *testing.T) {
+	user, calendarMux := setupCalendarSourceTestDB(t)
+
+	calendarSource := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/a.ics", Label: "A", Enabled: true}
+	db.DB.Create(calendarSource)
+
+	req := newRouteRequest(http.MethodDelete, "/api/calendar-mux/1/sources/1", nil, user.ID, map[string]string{"id": "1", "sourceID": "1"})
+	rr := httptest.NewRecorder()
+
+	calendarMuxHandler().DeleteCalendarSource(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Calendar source deleted successfully")
+
+	var found models.CalendarSource
+	assert.Error(t, db.DB.First(&found, calendarSource.ID).Error)
+}
+
+func TestDeleteCalendarSource_Errors(t *testing.T) {
+	tests := []struct {
+		name           string
+		muxID          string
+		sourceID       string
+		expectedStatus int
+	}{
+		{name: "Invalid mux ID", muxID: "abc", sourceID: "1", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid source ID", muxID: "1", sourceID: "abc", expectedStatus: http.StatusBadRequest},
+		{name: "Unknown mux", muxID: "9999", sourceID: "1", expectedStatus: http.StatusNotFound},
+		{name: "Unknown source", muxID: "1", sourceID: "9999", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, _ := setupCalendarSourceTestDB(t)
+
+			req := newRouteRequest(http.MethodDelete, "/api/calendar-mux/"+tt.muxID+"/sources/"+tt.sourceID, nil, user.ID, map[string]string{"id": tt.muxID, "sourceID": tt.sourceID})
+			rr := httptest.NewRecorder()
+
+			calendarMuxHandler().DeleteCalendarSource(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+func TestUpdateCalendarSourceVisibility_Success(t *testing.T) {
+	user, calendarMux := setupCalendarSourceTestDB(t)
+
+	calendarSource := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/work.ics", Label: "Work", Enabled: true}
+	db.DB.Create(calendarSource)
+
+	body, _ := json.Marshal(UpdateCalendarSourceVisibilityRequest{Visibility: "title_only"})
+	req := newRouteRequest(http.MethodPut, "/api/calendar-mux/1/sources/1/visibility", bytes.NewReader(body), user.ID, map[string]string{"id": "1", "sourceID": "1"})
+	rr := httptest.NewRecorder()
+
+	calendarMuxHandler().UpdateCalendarSourceVisibility(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response CalendarSourceAPIResponse
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.Equal(t, "title_only", response.Visibility)
+	assert.Equal(t, "Work", response.Label)
+
+	var found models.CalendarSource
+	db.DB.First(&found, calendarSource.ID)
+	assert.Equal(t, models.VisibilityTitleOnly, found.Visibility)
+}
+
+func TestUpdateCalendarSourceVisibility_Errors(t *testing.T) {
+	tests := []struct {
+		name           string
+		userID         uint
+		muxID          string
+		sourceID       string
+		body           string
+		expectedStatus int
+	}{
+		{name: "No auth", userID: 0, muxID: "1", sourceID: "1", body: `{"visibility":"full"}`, expectedStatus: http.StatusUnauthorized},
+		{name: "Invalid mux ID", userID: 1, muxID: "abc", sourceID: "1", body: `{"visibility":"full"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Invalid source ID", userID: 1, muxID: "1", sourceID: "abc", body: `{"visibility":"full"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Invalid JSON", userID: 1, muxID: "1", sourceID: "1", body: `invalid json`, expectedStatus: http.StatusBadRequest},
+		{name: "Missing visibility", userID: 1, muxID: "1", sourceID: "1", body: `{}`, expectedStatus: http.StatusBadRequest},
+		{name: "Unknown visibility", userID: 1, muxID: "1", sourceID: "1", body: `{"visibility":"secret"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Unknown mux", userID: 1, muxID: "9999", sourceID: "1", body: `{"visibility":"full"}`, expectedStatus: http.StatusNotFound},
+		{name: "Unknown source", userID: 1, muxID: "1", sourceID: "9999", body: `{"visibility":"full"}`, expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, calendarMux := setupCalendarSourceTestDB(t)
+			db.DB.Create(&models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/a.ics", Label: "A", Enabled: true})
+
+			target := "/api/calendar-mux/" + tt.muxID + "/sources/" + tt.sourceID + "/visibility"
+			req := newRouteRequest(http.MethodPut, target, bytes.NewReader([]byte(tt.body)), tt.userID, map[string]string{"id": tt.muxID, "sourceID": tt.sourceID})
+			rr := httptest.NewRecorder()
+
+			calendarMuxHandler().UpdateCalendarSourceVisibility(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package rest_api_handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/services"
+	"family-calendar-backend/ical"
+	"family-calendar-backend/rest_api_handlers/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// busyTitle replaces the title of events from busy-only sources
+const busyTitle = "Busy"
+
+// applyVisibility strips what a source's visibility mode hides from one of its events.
+// Unknown modes are treated as busy-only so that details are never leaked by mistake.
+func applyVisibility(vevent *ical.Component, visibility string) *ical.Component {
+	switch visibility {
+	case models.VisibilityFull:
+		return vevent
+	case models.VisibilityTitleOnly:
+		return ical.Redact(vevent, true)
+	default:
+		redacted := ical.Redact(vevent, false)
+		redacted.AddProp("SUMMARY", busyTitle)
+		return redacted
+	}
+}
+
+// loadStoredCalendars rebuilds one calendar per source from the events stored by the sync engine,
+// named after the source label. Each source's visibility mode is applied here, so every output
+// built from these calendars only sees what the mode allows, followed by its rewrite rules, which
+// therefore match against what the mode left visible.
+func loadStoredCalendars(calendarSources []models.CalendarSource) ([]*ical.Component, error) {
+	sourceIDs := make([]uint, 0, len(calendarSources))
+	calendars := make(map[uint]*ical.Component, len(calendarSources))
+	visibilities := make(map[uint]string, len(calendarSources))
+	for _, cs := range calendarSources {
+		sourceIDs = append(sourceIDs, cs.ID)
+		visibilities[cs.ID] = cs.Visibility
+		cal := ical.NewComponent("VCALENDAR")
+		if cs.Timezones != "" {
+			parsed, err := ical.Parse(strings.NewReader(cs.Timezones))
+			if err != nil {
+				log.Printf("Ignoring unreadable timezones of calendar source %d: %v", cs.ID, err)
+			} else {
+				cal = parsed
+			}
+		}
+		cal.SetProp(ical.Property{Name: "X-WR-CALNAME", Value: ical.EscapeText(cs.Label)})
+		calendars[cs.ID] = cal
+	}
+
+	rules, err := loadRewriteRules(sourceIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := services.GetCalendarEventsBySources(sourceIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		vevent, err := ical.Parse(strings.NewReader(event.Data))
+		if err != nil {
+			log.Printf("Ignoring unreadable event %d of calendar source %d: %v", event.ID, event.CalendarSourceID, err)
+			continue
+		}
+		vevent = applyRewriteRules(applyVisibility(vevent, visibilities[event.CalendarSourceID]), rules[event.CalendarSourceID])
+		if vevent == nil {
+			continue
+		}
+		cal := calendars[event.CalendarSourceID]
+		cal.Components = append(cal.Components, vevent)
+	}
+
+	ordered := make([]*ical.Component, 0, len(calendarSources))
+	for _, id := range sourceIDs {
+		ordered = append(ordered, calendars[id])
+	}
+	return ordered, nil
+}
+
+// baseURL returns the scheme and host the request was sent to. Behind a TLS-terminating proxy
+// the scheme comes from X-Forwarded-Proto.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// feedURL returns the public URL of a calendar mux feed on the host the request was sent to
+func feedURL(r *http.Request, feedToken string) string {
+	return baseURL(r) + "/feeds/" + feedToken + ".ics"
+}
+
+// ServeCalendarFeed publishes the merged ICS feed of the calendar mux identified by its feed token.
+// Calendar clients cannot send bearer tokens, so the unguessable token in the URL is the credential.
+// Events come from the database, where the background sync engine keeps them up to date.
+func (h *CalendarMuxHandler) ServeCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	calendarMux, err := h.muxes.GetByFeedToken(token)
+	if err != nil {
+		if errors.Is(err, services.ErrCalendarMuxNotFound) {
+			utils.RespondError(w, http.StatusNotFound, "Feed not found", nil)
+			return
+		}
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to load feed", nil)
+		return
+	}
+
+	calendarSources, err := services.GetEnabledCalendarSources(calendarMux.ID)
+	if err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to load feed", nil)
+		return
+	}
+
+	calendars, err := loadStoredCalendars(calendarSources)
+	if err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to load feed", nil)
+		return
+	}
+
+	merged := ical.Merge(calendarMux.Name, calendars, !calendarMux.DedupDisabled)
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := ical.Encode(w, merged); err != nil {
+		log.Printf("Failed to write calendar feed: %v", err)
+	}
+}
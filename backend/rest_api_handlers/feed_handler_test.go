@@ -0,0 +1,257 @@
+package rest_api_handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/repositories"
+	"family-calendar-backend/ical"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestServeCalendarFeed_Success(t *testing.T) {
+	_, calendarMux := setupCalendarSourceTestDB(t)
+
+	school := &models.CalendarSource{
+		CalendarMuxID: calendarMux.ID,
+		URL:           "https://example.com/school.ics",
+		Label:         "School",
+		Enabled:       true,
+		Timezones:     "BEGIN:VCALENDAR\r\nBEGIN:VTIMEZONE\r\nTZID:America/Toronto\r\nEND:VTIMEZONE\r\nEND:VCALENDAR\r\n",
+	}
+	db.DB.Create(school)
+	soccer := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/soccer.ics", Label: "Soccer", Enabled: true}
+	db.DB.Create(soccer)
+	work := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/work.ics", Label: "Work", Enabled: true}
+	db.DB.Create(work)
+	db.DB.Model(work).Update("enabled", false)
+
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: soccer.ID, UID: "soccer-1", Data: "BEGIN:VEVENT\r\nUID:soccer-1\r\nSUMMARY:Practice\r\nEND:VEVENT\r\n"})
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: school.ID, UID: "school-1", Data: "BEGIN:VEVENT\r\nUID:school-1\r\nDTSTART;TZID=America/Toronto:20250110T090000\r\nSUMMARY:Field trip\r\nEND:VEVENT\r\n"})
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: school.ID, UID: "broken", Data: "not ical"})
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: work.ID, UID: "work-1", Data: "BEGIN:VEVENT\r\nUID:work-1\r\nSUMMARY:Standup\r\nEND:VEVENT\r\n"})
+
+	req := newRouteRequest(http.MethodGet, "/feeds/"+calendarMux.FeedToken+".ics", nil, 0, map[string]string{"token": calendarMux.FeedToken})
+	rr := httptest.NewRecorder()
+
+	calendarMuxHandler().ServeCalendarFeed(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/calendar; charset=utf-8", rr.Header().Get("Content-Type"))
+
+	cal, err := ical.Parse(rr.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "Family", cal.PropValue("X-WR-CALNAME"))
+
+	timezones := cal.Children("VTIMEZONE")
+	assert.Len(t, timezones, 1)
+	assert.Equal(t, "America/Toronto", timezones[0].PropValue("TZID"))
+
+	// Events are grouped by source in source order; disabled sources and unreadable events are skipped
+	events := cal.Children("VEVENT")
+	assert.Len(t, events, 2)
+	assert.Equal(t, "school-1", events[0].PropValue("UID"))
+	assert.Equal(t, "soccer-1", events[1].PropValue("UID"))
+}
+
+func TestServeCalendarFeed_UnreadableTimezones(t *testing.T) {
+	_, calendarMux := setupCalendarSourceTestDB(t)
+
+	source := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/a.ics", Label: "A", Enabled: true, Timezones: "garbage"}
+	db.DB.Create(source)
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: source.ID, UID: "a-1", Data: "BEGIN:VEVENT\r\nUID:a-1\r\nEND:VEVENT\r\n"})
+
+	req := newRouteRequest(http.MethodGet, "/feeds/"+calendarMux.FeedToken+".ics", nil, 0, map[string]string{"token": calendarMux.FeedToken})
+	rr := httptest.NewRecorder()
+
+	calendarMuxHandler().ServeCalendarFeed(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	cal, err := ical.Parse(rr.Body)
+	assert.NoError(t, err)
+	assert.Len(t, cal.Children("VEVENT"), 1)
+}
+
+func TestServeCalendarFeed_UnknownToken(t *testing.T) {
+	setupCalendarSourceTestDB(t)
+
+	req := newRouteRequest(http.MethodGet, "/feeds/unknown.ics", nil, 0, map[string]string{"token": "unknown"})
+	rr := httptest.NewRecorder()
+
+	calendarMuxHandler().ServeCalendarFeed(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestServeCalendarFeed_DatabaseError(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer sqlDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: sqlDB,
+	}), &gorm.Config{})
+	assert.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "calendar_muxes"`)).
+		WillReturnError(errors.New("database error"))
+
+	req := newRouteRequest(http.MethodGet, "/feeds/abc.ics", nil, 0, map[string]string{"token": "abc"})
+	rr := httptest.NewRecorder()
+
+	NewCalendarMuxHandler(repositories.NewGormCalendarMuxRepository(gormDB)).ServeCalendarFeed(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
+
+func TestServeCalendarFeed_Dedup(t *testing.T) {
+	_, calendarMux := setupCalendarSourceTestDB(t)
+	createDuplicateSources(t, calendarMux)
+
+	req := newRouteRequest(http.MethodGet, "/feeds/"+calendarMux.FeedToken+".ics", nil, 0, map[string]string{"token": calendarMux.FeedToken})
+	rr := httptest.NewRecorder()
+
+	calendarMuxHandler().ServeCalendarFeed(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	cal, err := ical.Parse(rr.Body)
+	assert.NoError(t, err)
+
+	events := cal.Children("VEVENT")
+	assert.Len(t, events, 3)
+	assert.Equal(t, "conference@school.example", events[0].PropValue("UID"))
+	assert.Equal(t, "Mom,Dad", events[0].PropValue(ical.SourcesProperty))
+	assert.Equal(t, "Mom,Dad", events[1].PropValue(ical.SourcesProperty))
+	assert.Equal(t, "20250113T220000Z", events[2].PropValue("RECURRENCE-ID"))
+}
+
+func TestServeCalendarFeed_DedupDisabled(t *testing.T) {
+	_, calendarMux := setupCalendarSourceTestDB(t)
+	db.DB.Model(calendarMux).Update("dedup_disabled", true)
+	createDuplicateSources(t, calendarMux)
+
+	req := newRouteRequest(http.MethodGet, "/feeds/"+calendarMux.FeedToken+".ics", nil, 0, map[string]string{"token": calendarMux.FeedToken})
+	rr := httptest.NewRecorder()
+
+	calendarMuxHandler().ServeCalendarFeed(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	cal, err := ical.Parse(rr.Body)
+	assert.NoError(t, err)
+	assert.Len(t, cal.Children("VEVENT"), 5)
+}
+
+// createPrivateSources attaches one source per visibility mode, each with the same detailed event
+func createPrivateSources(t *testing.T, calendarMux *models.CalendarMux) {
+	t.Helper()
+	for i, visibility := range []string{models.VisibilityFull, models.VisibilityTitleOnly, models.VisibilityBusyOnly} {
+		source := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/" + visibility + ".ics", Label: visibility, Enabled: true, Visibility: visibility}
+		db.DB.Create(source)
+		uid := visibility + "@example.com"
+		day := "2025011" + strconv.Itoa(i)
+		db.DB.Create(&models.CalendarEvent{CalendarSourceID: source.ID, UID: uid, Data: "BEGIN:VEVENT\r\n" +
+			"UID:" + uid + "\r\nSUMMARY:Performance review\r\nDESCRIPTION:Bring the numbers\r\nLOCATION:Room 4\r\n" +
+			"ATTENDEE;CN=Dad:mailto:dad@work.example\r\n" +
+			"DTSTART:" + day + "T140000Z\r\nDTEND:" + day + "T150000Z\r\n" +
+			"BEGIN:VALARM\r\nACTION:DISPLAY\r\nDESCRIPTION:Review soon\r\nTRIGGER:-PT15M\r\nEND:VALARM\r\n" +
+			"END:VEVENT\r\n"})
+	}
+}
+
+func TestServeCalendarFeed_Visibility(t *testing.T) {
+	_, calendarMux := setupCalendarSourceTestDB(t)
+	createPrivateSources(t, calendarMux)
+
+	req := newRouteRequest(http.MethodGet, "/feeds/"+calendarMux.FeedToken+".ics", nil, 0, map[string]string{"token": calendarMux.FeedToken})
+	rr := httptest.NewRecorder()
+
+	calendarMuxHandler().ServeCalendarFeed(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	body := rr.Body.String()
+	cal, err := ical.Parse(strings.NewReader(body))
+	assert.NoError(t, err)
+
+	events := cal.Children("VEVENT")
+	assert.Len(t, events, 3)
+
+	full := events[0]
+	assert.Equal(t, "Performance review", full.PropValue("SUMMARY"))
+	assert.Equal(t, "Room 4", full.PropValue("LOCATION"))
+	assert.Len(t, full.Children("VALARM"), 1)
+
+	titleOnly := events[1]
+	assert.Equal(t, "Performance review", titleOnly.PropValue("SUMMARY"))
+	assert.Equal(t, "20250111T140000Z", titleOnly.PropValue("DTSTART"))
+	assert.Empty(t, titleOnly.PropsNamed("LOCATION"))
+	assert.Empty(t, titleOnly.PropsNamed("DESCRIPTION"))
+	assert.Empty(t, titleOnly.PropsNamed("ATTENDEE"))
+	assert.Empty(t, titleOnly.Components)
+
+	busyOnly := events[2]
+	assert.Equal(t, "Busy", busyOnly.PropValue("SUMMARY"))
+	assert.Equal(t, "20250112T150000Z", busyOnly.PropValue("DTEND"))
+	assert.Empty(t, busyOnly.PropsNamed("LOCATION"))
+	assert.Empty(t, busyOnly.Components)
+
+	// Private details of the restricted sources appear nowhere in the output
+	assert.Equal(t, 1, strings.Count(body, "Room 4"))
+	assert.Equal(t, 1, strings.Count(body, "dad@work.example"))
+	assert.Equal(t, 2, strings.Count(body, "Performance review"))
+}
+
+// createRewrittenSources attaches a child's calendar and a busy-only work calendar, each with rewrite rules
+func createRewrittenSources(t *testing.T, calendarMux *models.CalendarMux) {
+	t.Helper()
+	emma := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/emma.ics", Label: "Emma", Enabled: true}
+	db.DB.Create(emma)
+	work := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/work.ics", Label: "Work", Enabled: true, Visibility: models.VisibilityBusyOnly}
+	db.DB.Create(work)
+
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: emma.ID, UID: "practice", Data: "BEGIN:VEVENT\r\nUID:practice\r\nSUMMARY:Soccer practice\r\n" +
+		"DTSTART:20250106T220000Z\r\nEND:VEVENT\r\n"})
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: emma.ID, UID: "lunch", Data: "BEGIN:VEVENT\r\nUID:lunch\r\nSUMMARY:Lunch menu: pizza\r\n" +
+		"DTSTART;VALUE=DATE:20250107\r\nEND:VEVENT\r\n"})
+	db.DB.Create(&models.CalendarEvent{CalendarSourceID: work.ID, UID: "review", Data: "BEGIN:VEVENT\r\nUID:review\r\nSUMMARY:Performance review\r\n" +
+		"DTSTART:20250108T140000Z\r\nEND:VEVENT\r\n"})
+
+	db.DB.Create(&models.RewriteRule{CalendarSourceID: emma.ID, Position: 0, Action: models.RewriteActionDrop, Pattern: "^Lunch menu"})
+	db.DB.Create(&models.RewriteRule{CalendarSourceID: emma.ID, Position: 1, Action: models.RewriteActionPrefix, Value: "[Emma]"})
+	db.DB.Create(&models.RewriteRule{CalendarSourceID: emma.ID, Position: 2, Action: models.RewriteActionSetColor, Value: "teal"})
+	db.DB.Create(&models.RewriteRule{CalendarSourceID: emma.ID, Position: 3, Action: models.RewriteActionSetCategories, Value: "Kids,Sports"})
+	// Rules of restricted sources only see what the visibility mode leaves, so this one cannot match
+	db.DB.Create(&models.RewriteRule{CalendarSourceID: work.ID, Position: 0, Action: models.RewriteActionDrop, Pattern: "review"})
+	db.DB.Create(&models.RewriteRule{CalendarSourceID: work.ID, Position: 1, Action: models.RewriteActionPrefix, Value: "[Dad]"})
+}
+
+func TestServeCalendarFeed_RewriteRules(t *testing.T) {
+	_, calendarMux := setupCalendarSourceTestDB(t)
+	createRewrittenSources(t, calendarMux)
+
+	req := newRouteRequest(http.MethodGet, "/feeds/"+calendarMux.FeedToken+".ics", nil, 0, map[string]string{"token": calendarMux.FeedToken})
+	rr := httptest.NewRecorder()
+
+	calendarMuxHandler().ServeCalendarFeed(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	cal, err := ical.Parse(rr.Body)
+	assert.NoError(t, err)
+
+	events := cal.Children("VEVENT")
+	assert.Len(t, events, 2)
+	assert.Equal(t, "[Emma] Soccer practice", events[0].PropValue("SUMMARY"))
+	assert.Equal(t, "teal", events[0].PropValue("COLOR"))
+	assert.Equal(t, "Kids,Sports", events[0].PropValue("CATEGORIES"))
+	assert.Equal(t, "[Dad] Busy", events[1].PropValue("SUMMARY"))
+}
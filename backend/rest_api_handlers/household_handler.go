@@ -0,0 +1,286 @@
+package rest_api_handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"family-calendar-backend/auth"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/services"
+	"family-calendar-backend/rest_api_handlers/utils"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-playground/validator/v10"
+)
+
+func buildHouseholdResponse(household models.Household, role string) HouseholdAPIResponse {
+	return HouseholdAPIResponse{
+		ID:          household.ID,
+		Name:        household.Name,
+		CreatedByID: household.CreatedByID,
+		Role:        role,
+		CreatedAt:   household.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt:   household.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
+func buildHouseholdMemberResponse(member models.HouseholdMember) HouseholdMemberAPIResponse {
+	return HouseholdMemberAPIResponse{
+		UserID:     member.UserID,
+		GivenName:  member.User.GivenName,
+		FamilyName: member.User.FamilyName,
+		Email:      member.User.Email,
+		Role:       member.Role,
+		JoinedAt:   member.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
+// respondHouseholdError maps a household or invite service error to a response
+func respondHouseholdError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrHouseholdNotFound):
+		utils.RespondError(w, http.StatusNotFound, "Household not found or access denied", nil)
+	case errors.Is(err, services.ErrInsufficientRole):
+		utils.RespondError(w, http.StatusForbidden, "Insufficient household role", nil)
+	case errors.Is(err, services.ErrHouseholdMemberNotFound):
+		utils.RespondError(w, http.StatusNotFound, "Household member not found", nil)
+	case errors.Is(err, services.ErrUserNotFound):
+		utils.RespondError(w, http.StatusNotFound, "No user with this email address has signed in yet", nil)
+	case errors.Is(err, services.ErrHouseholdMemberExists):
+		utils.RespondError(w, http.StatusConflict, "User is already a household member", nil)
+	case errors.Is(err, services.ErrLastHouseholdOwner):
+		utils.RespondError(w, http.StatusConflict, "A household needs at least one owner", nil)
+	case errors.Is(err, services.ErrInviteNotFound):
+		utils.RespondError(w, http.StatusNotFound, "Invite not found", nil)
+	case errors.Is(err, services.ErrInviteUsed):
+		utils.RespondError(w, http.StatusConflict, "Invite has already been used", nil)
+	case errors.Is(err, services.ErrInviteRevoked):
+		utils.RespondError(w, http.StatusGone, "Invite has been revoked", nil)
+	case errors.Is(err, services.ErrInviteExpired):
+		utils.RespondError(w, http.StatusGone, "Invite has expired", nil)
+	default:
+		utils.RespondError(w, http.StatusInternalServerError, message, nil)
+	}
+}
+
+// decodeValidated reads a JSON request body into req and validates it, responding with the
+// problem when it is not acceptable
+func decodeValidated(w http.ResponseWriter, r *http.Request, req interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid request body", nil)
+		return false
+	}
+
+	if err := validate.Struct(req); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		errorMsg := "Validation failed"
+		if len(validationErrors) > 0 {
+			errorMsg = utils.GetValidationErrorMsg(validationErrors[0])
+		}
+		utils.RespondError(w, http.StatusBadRequest, errorMsg, nil)
+		return false
+	}
+	return true
+}
+
+// CreateHousehold creates a household with the authenticated user as its owner
+func CreateHousehold(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	var req CreateHouseholdRequest
+	if !decodeValidated(w, r, &req) {
+		return
+	}
+
+	household, err := services.CreateHousehold(userID, req.Name, middleware.GetReqID(r.Context()))
+	if err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to create household", nil)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusCreated, buildHouseholdResponse(*household, models.HouseholdRoleOwner))
+}
+
+// ListHouseholds returns the households the authenticated user is a member of, with their role
+func ListHouseholds(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	memberships, err := services.GetHouseholdMembershipsByUser(userID)
+	if err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to retrieve households", nil)
+		return
+	}
+
+	// Build response
+	householdResponses := make([]HouseholdAPIResponse, 0, len(memberships))
+	for _, membership := range memberships {
+		householdResponses = append(householdResponses, buildHouseholdResponse(membership.Household, membership.Role))
+	}
+
+	utils.RespondJSON(w, http.StatusOK, HouseholdListAPIResponse{Households: householdResponses})
+}
+
+// GetHousehold returns a household the authenticated user is a member of, with its members
+func GetHousehold(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	householdID, ok := parseIDParam(r, "id")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid household ID", nil)
+		return
+	}
+
+	household, members, err := services.GetHousehold(householdID, userID)
+	if err != nil {
+		respondHouseholdError(w, err, "Failed to retrieve household")
+		return
+	}
+
+	// Build response
+	role := ""
+	memberResponses := make([]HouseholdMemberAPIResponse, 0, len(members))
+	for _, member := range members {
+		if member.UserID == userID {
+			role = member.Role
+		}
+		memberResponses = append(memberResponses, buildHouseholdMemberResponse(member))
+	}
+
+	response := HouseholdDetailAPIResponse{
+		HouseholdAPIResponse: buildHouseholdResponse(*household, role),
+		Members:              memberResponses,
+	}
+
+	// Validate response
+	if err := validate.Struct(response); err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Response validation failed", nil)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+// DeleteHousehold deletes a household the authenticated user owns; its calendar muxes stop being shared
+func DeleteHousehold(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	householdID, ok := parseIDParam(r, "id")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid household ID", nil)
+		return
+	}
+
+	if err := services.DeleteHousehold(householdID, userID, middleware.GetReqID(r.Context())); err != nil {
+		respondHouseholdError(w, err, "Failed to delete household")
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, DeleteHouseholdAPIResponse{Message: "Household deleted successfully"})
+}
+
+// AddHouseholdMember gives an existing user a role in a household the authenticated user owns
+func AddHouseholdMember(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	householdID, ok := parseIDParam(r, "id")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid household ID", nil)
+		return
+	}
+
+	var req AddHouseholdMemberRequest
+	if !decodeValidated(w, r, &req) {
+		return
+	}
+
+	member, err := services.AddHouseholdMember(householdID, userID, req.Email, req.Role, middleware.GetReqID(r.Context()))
+	if err != nil {
+		respondHouseholdError(w, err, "Failed to add household member")
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusCreated, buildHouseholdMemberResponse(*member))
+}
+
+// UpdateHouseholdMember changes the role of a member of a household the authenticated user owns
+func UpdateHouseholdMember(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	householdID, ok := parseIDParam(r, "id")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid household ID", nil)
+		return
+	}
+
+	memberUserID, ok := parseIDParam(r, "userID")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	var req UpdateHouseholdMemberRequest
+	if !decodeValidated(w, r, &req) {
+		return
+	}
+
+	member, err := services.UpdateHouseholdMemberRole(householdID, userID, memberUserID, req.Role, middleware.GetReqID(r.Context()))
+	if err != nil {
+		respondHouseholdError(w, err, "Failed to update household member")
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, buildHouseholdMemberResponse(*member))
+}
+
+// RemoveHouseholdMember removes a member from a household; owners can remove anyone and members can leave
+func RemoveHouseholdMember(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	householdID, ok := parseIDParam(r, "id")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid household ID", nil)
+		return
+	}
+
+	memberUserID, ok := parseIDParam(r, "userID")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	if err := services.RemoveHouseholdMember(householdID, userID, memberUserID, middleware.GetReqID(r.Context())); err != nil {
+		respondHouseholdError(w, err, "Failed to remove household member")
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, DeleteHouseholdAPIResponse{Message: "Household member removed successfully"})
+}
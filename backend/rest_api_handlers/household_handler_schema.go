@@ -0,0 +1,79 @@
+package rest_api_handlers
+
+type CreateHouseholdRequest struct {
+	Name string `json:"name" validate:"required,min=1,max=200"`
+}
+
+type AddHouseholdMemberRequest struct {
+	// Email identifies a user who has signed in at least once
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required,oneof=owner editor viewer"`
+}
+
+type UpdateHouseholdMemberRequest struct {
+	Role string `json:"role" validate:"required,oneof=owner editor viewer"`
+}
+
+// HouseholdAPIResponse is a household with the role of the authenticated user in it
+type HouseholdAPIResponse struct {
+	ID          uint   `json:"id" validate:"required"`
+	Name        string `json:"name" validate:"required,min=1,max=200"`
+	CreatedByID uint   `json:"created_by_id" validate:"required"`
+	Role        string `json:"role" validate:"required,oneof=owner editor viewer"`
+	CreatedAt   string `json:"created_at" validate:"required"`
+	UpdatedAt   string `json:"updated_at" validate:"required"`
+}
+
+type HouseholdMemberAPIResponse struct {
+	UserID     uint   `json:"user_id" validate:"required"`
+	GivenName  string `json:"given_name"`
+	FamilyName string `json:"family_name"`
+	Email      string `json:"email"`
+	Role       string `json:"role" validate:"required,oneof=owner editor viewer"`
+	JoinedAt   string `json:"joined_at" validate:"required"`
+}
+
+type HouseholdDetailAPIResponse struct {
+	HouseholdAPIResponse
+	Members []HouseholdMemberAPIResponse `json:"members" validate:"dive"`
+}
+
+type HouseholdListAPIResponse struct {
+	Households []HouseholdAPIResponse `json:"households" validate:"dive"`
+}
+
+type DeleteHouseholdAPIResponse struct {
+	Message string `json:"message" validate:"required"`
+}
+
+type CreateHouseholdInviteRequest struct {
+	Role string `json:"role" validate:"required,oneof=owner editor viewer"`
+	// ExpiresInHours defaults to three days when omitted
+	ExpiresInHours int `json:"expires_in_hours" validate:"omitempty,min=1,max=720"`
+}
+
+type HouseholdInviteAPIResponse struct {
+	ID          uint   `json:"id" validate:"required"`
+	HouseholdID uint   `json:"household_id" validate:"required"`
+	CreatedByID uint   `json:"created_by_id" validate:"required"`
+	Role        string `json:"role" validate:"required,oneof=owner editor viewer"`
+	// Status is pending, accepted, revoked or expired
+	Status          string  `json:"status" validate:"required,oneof=pending accepted revoked expired"`
+	ExpiresAt       string  `json:"expires_at" validate:"required"`
+	AcceptedByID    *uint   `json:"accepted_by_id"`
+	AcceptedByEmail string  `json:"accepted_by_email,omitempty"`
+	AcceptedAt      *string `json:"accepted_at"`
+	RevokedAt       *string `json:"revoked_at"`
+	CreatedAt       string  `json:"created_at" validate:"required"`
+}
+
+// CreateHouseholdInviteAPIResponse is the only response that carries the invite token
+type CreateHouseholdInviteAPIResponse struct {
+	HouseholdInviteAPIResponse
+	Token     string `json:"token" validate:"required"`
+	AcceptURL string `json:"accept_url" validate:"required,url"`
+}
+
+type HouseholdInviteListAPIResponse struct {
+	Invites []HouseholdInviteAPIResponse `json:"invites" validate:"dive"`
+}
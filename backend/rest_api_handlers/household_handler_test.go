@@ -0,0 +1,256 @@
+package rest_api_handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupHouseholdTestDB creates a household owned by the test user with a viewer member
+func setupHouseholdTestDB(t *testing.T) (owner, viewer *models.User, household *models.Household) {
+	owner = setupCalendarMuxTestDB(t)
+	viewer = &models.User{
+		GivenName:  "View",
+		FamilyName: "Er",
+		Email:      "viewer@example.com",
+	}
+	require.NoError(t, db.DB.Create(viewer).Error)
+
+	household, err := services.CreateHousehold(owner.ID, "Family", "")
+	require.NoError(t, err)
+	_, err = services.AddHouseholdMember(household.ID, owner.ID, viewer.Email, models.HouseholdRoleViewer, "")
+	require.NoError(t, err)
+	return owner, viewer, household
+}
+
+func householdParams(household *models.Household) map[string]string {
+	return map[string]string{"id": strconv.FormatUint(uint64(household.ID), 10)}
+}
+
+func TestCreateHousehold_Success(t *testing.T) {
+	user := setupCalendarMuxTestDB(t)
+
+	rr := httptest.NewRecorder()
+	CreateHousehold(rr, newRouteRequest("POST", "/api/households", strings.NewReader(`{"name":"Family"}`), user.ID, nil))
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var response HouseholdAPIResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.NotZero(t, response.ID)
+	assert.Equal(t, "Family", response.Name)
+	assert.Equal(t, user.ID, response.CreatedByID)
+	assert.Equal(t, models.HouseholdRoleOwner, response.Role)
+}
+
+func TestCreateHousehold_Errors(t *testing.T) {
+	user := setupCalendarMuxTestDB(t)
+
+	tests := []struct {
+		name   string
+		body   string
+		userID uint
+		status int
+		error  string
+	}{
+		{"unauthenticated", `{"name":"Family"}`, 0, http.StatusUnauthorized, "User not authenticated"},
+		{"invalid body", `{`, user.ID, http.StatusBadRequest, "Invalid request body"},
+		{"missing name", `{}`, user.ID, http.StatusBadRequest, "This field is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			CreateHousehold(rr, newRouteRequest("POST", "/api/households", strings.NewReader(tt.body), tt.userID, nil))
+
+			assert.Equal(t, tt.status, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.error)
+		})
+	}
+}
+
+func TestListHouseholds_ReturnsRoles(t *testing.T) {
+	_, viewer, household := setupHouseholdTestDB(t)
+
+	rr := httptest.NewRecorder()
+	ListHouseholds(rr, newRouteRequest("GET", "/api/households", nil, viewer.ID, nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response HouseholdListAPIResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Len(t, response.Households, 1)
+	assert.Equal(t, household.ID, response.Households[0].ID)
+	assert.Equal(t, models.HouseholdRoleViewer, response.Households[0].Role)
+}
+
+func TestGetHousehold_ReturnsMembers(t *testing.T) {
+	owner, viewer, household := setupHouseholdTestDB(t)
+
+	rr := httptest.NewRecorder()
+	GetHousehold(rr, newRouteRequest("GET", "/api/households/1", nil, viewer.ID, householdParams(household)))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response HouseholdDetailAPIResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, models.HouseholdRoleViewer, response.Role)
+	require.Len(t, response.Members, 2)
+	assert.Equal(t, owner.ID, response.Members[0].UserID)
+	assert.Equal(t, models.HouseholdRoleOwner, response.Members[0].Role)
+	assert.Equal(t, "viewer@example.com", response.Members[1].Email)
+}
+
+func TestGetHousehold_NonMember(t *testing.T) {
+	_, _, household := setupHouseholdTestDB(t)
+
+	rr := httptest.NewRecorder()
+	GetHousehold(rr, newRouteRequest("GET", "/api/households/1", nil, 9999, householdParams(household)))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Household not found or access denied")
+}
+
+func TestAddHouseholdMember(t *testing.T) {
+	owner, viewer, household := setupHouseholdTestDB(t)
+	editor := &models.User{GivenName: "Ed", Email: "editor@example.com"}
+	require.NoError(t, db.DB.Create(editor).Error)
+
+	tests := []struct {
+		name   string
+		userID uint
+		body   AddHouseholdMemberRequest
+		status int
+		error  string
+	}{
+		{"not an owner", viewer.ID, AddHouseholdMemberRequest{Email: editor.Email, Role: "editor"}, http.StatusForbidden, "Insufficient household role"},
+		{"invalid role", owner.ID, AddHouseholdMemberRequest{Email: editor.Email, Role: "admin"}, http.StatusBadRequest, "Invalid value"},
+		{"unknown user", owner.ID, AddHouseholdMemberRequest{Email: "nobody@example.com", Role: "editor"}, http.StatusNotFound, "No user with this email address has signed in yet"},
+		{"already a member", owner.ID, AddHouseholdMemberRequest{Email: viewer.Email, Role: "editor"}, http.StatusConflict, "User is already a household member"},
+		{"success", owner.ID, AddHouseholdMemberRequest{Email: editor.Email, Role: "editor"}, http.StatusCreated, `"role":"editor"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.body)
+			rr := httptest.NewRecorder()
+			AddHouseholdMember(rr, newRouteRequest("POST", "/api/households/1/members", bytes.NewReader(body), tt.userID, householdParams(household)))
+
+			assert.Equal(t, tt.status, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.error)
+		})
+	}
+}
+
+func TestUpdateHouseholdMember(t *testing.T) {
+	owner, viewer, household := setupHouseholdTestDB(t)
+	params := householdParams(household)
+
+	params["userID"] = strconv.FormatUint(uint64(viewer.ID), 10)
+	rr := httptest.NewRecorder()
+	UpdateHouseholdMember(rr, newRouteRequest("PUT", "/api/households/1/members/2", strings.NewReader(`{"role":"editor"}`), owner.ID, params))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response HouseholdMemberAPIResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, viewer.ID, response.UserID)
+	assert.Equal(t, models.HouseholdRoleEditor, response.Role)
+
+	// The last owner cannot step down
+	params["userID"] = strconv.FormatUint(uint64(owner.ID), 10)
+	rr = httptest.NewRecorder()
+	UpdateHouseholdMember(rr, newRouteRequest("PUT", "/api/households/1/members/1", strings.NewReader(`{"role":"viewer"}`), owner.ID, params))
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Contains(t, rr.Body.String(), "A household needs at least one owner")
+
+	params["userID"] = "abc"
+	rr = httptest.NewRecorder()
+	UpdateHouseholdMember(rr, newRouteRequest("PUT", "/api/households/1/members/abc", strings.NewReader(`{"role":"viewer"}`), owner.ID, params))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Invalid user ID")
+}
+
+func TestRemoveHouseholdMember_Leave(t *testing.T) {
+	_, viewer, household := setupHouseholdTestDB(t)
+	params := householdParams(household)
+	params["userID"] = strconv.FormatUint(uint64(viewer.ID), 10)
+
+	rr := httptest.NewRecorder()
+	RemoveHouseholdMember(rr, newRouteRequest("DELETE", "/api/households/1/members/2", nil, viewer.ID, params))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	RemoveHouseholdMember(rr, newRouteRequest("DELETE", "/api/households/1/members/2", nil, viewer.ID, params))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestDeleteHousehold(t *testing.T) {
+	owner, viewer, household := setupHouseholdTestDB(t)
+
+	rr := httptest.NewRecorder()
+	DeleteHousehold(rr, newRouteRequest("DELETE", "/api/households/1", nil, viewer.ID, householdParams(household)))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = httptest.NewRecorder()
+	DeleteHousehold(rr, newRouteRequest("DELETE", "/api/households/1", nil, owner.ID, householdParams(household)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Household deleted successfully")
+}
+
+func TestCalendarMuxHandlers_HouseholdViewer(t *testing.T) {
+	owner, viewer, household := setupHouseholdTestDB(t)
+	calendarMux, err := calendarMuxHandler().muxes.Create(owner.ID, "Family", "", true, &household.ID, "")
+	require.NoError(t, err)
+	params := map[string]string{"id": strconv.FormatUint(uint64(calendarMux.ID), 10)}
+
+	// The viewer sees the shared mux
+	rr := httptest.NewRecorder()
+	calendarMuxHandler().ListCalendarMuxes(rr, newRouteRequest("GET", "/api/calendar-mux", nil, viewer.ID, nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"household_id":`+params["id"])
+
+	rr = httptest.NewRecorder()
+	calendarMuxHandler().GetCalendarMux(rr, newRouteRequest("GET", "/api/calendar-mux/1", nil, viewer.ID, params))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// ... but cannot change it
+	rr = httptest.NewRecorder()
+	calendarMuxHandler().UpdateCalendarMux(rr, newRouteRequest("PATCH", "/api/calendar-mux/1", strings.NewReader(`{"name":"Mine"}`), viewer.ID, params))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Insufficient household role")
+
+	rr = httptest.NewRecorder()
+	calendarMuxHandler().CreateCalendarSource(rr, newRouteRequest("POST", "/api/calendar-mux/1/sources", strings.NewReader(`{"url":"https://example.com/a.ics","label":"A"}`), viewer.ID, params))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = httptest.NewRecorder()
+	calendarMuxHandler().DeleteCalendarMux(rr, newRouteRequest("DELETE", "/api/calendar-mux/1", nil, viewer.ID, params))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestCreateCalendarMux_InHousehold(t *testing.T) {
+	owner, viewer, household := setupHouseholdTestDB(t)
+	body := `{"name":"Family","household_id":` + strconv.FormatUint(uint64(household.ID), 10) + `}`
+
+	rr := httptest.NewRecorder()
+	calendarMuxHandler().CreateCalendarMux(rr, newRouteRequest("POST", "/api/calendar-mux", strings.NewReader(body), viewer.ID, nil))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = httptest.NewRecorder()
+	calendarMuxHandler().CreateCalendarMux(rr, newRouteRequest("POST", "/api/calendar-mux", strings.NewReader(`{"name":"Family","household_id":9999}`), owner.ID, nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Household not found or access denied")
+
+	rr = httptest.NewRecorder()
+	calendarMuxHandler().CreateCalendarMux(rr, newRouteRequest("POST", "/api/calendar-mux", strings.NewReader(body), owner.ID, nil))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var response CalendarMuxAPIResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.NotNil(t, response.HouseholdID)
+	assert.Equal(t, household.ID, *response.HouseholdID)
+}
@@ -0,0 +1,174 @@
+package rest_api_handlers
+
+import (
+	"net/http"
+	"time"
+
+	"family-calendar-backend/auth"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/services"
+	"family-calendar-backend/rest_api_handlers/utils"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// defaultInviteExpiry is how long an invite stays valid when the request does not say
+const defaultInviteExpiry = 72 * time.Hour
+
+// inviteStatus tells whether an invite can still be accepted
+func inviteStatus(invite models.HouseholdInvite, now time.Time) string {
+	switch {
+	case invite.AcceptedAt != nil:
+		return "accepted"
+	case invite.RevokedAt != nil:
+		return "revoked"
+	case !now.Before(invite.ExpiresAt):
+		return "expired"
+	default:
+		return "pending"
+	}
+}
+
+func buildHouseholdInviteResponse(invite models.HouseholdInvite, now time.Time) HouseholdInviteAPIResponse {
+	response := HouseholdInviteAPIResponse{
+		ID:           invite.ID,
+		HouseholdID:  invite.HouseholdID,
+		CreatedByID:  invite.CreatedByID,
+		Role:         invite.Role,
+		Status:       inviteStatus(invite, now),
+		ExpiresAt:    invite.ExpiresAt.Format("2006-01-02T15:04:05Z07:00"),
+		AcceptedByID: invite.AcceptedByID,
+		AcceptedAt:   formatOptionalTime(invite.AcceptedAt),
+		RevokedAt:    formatOptionalTime(invite.RevokedAt),
+		CreatedAt:    invite.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if invite.AcceptedBy != nil {
+		response.AcceptedByEmail = invite.AcceptedBy.Email
+	}
+	return response
+}
+
+// CreateHouseholdInvite creates a single-use invite to a household the authenticated user owns.
+// The token in the response is shown only once.
+func CreateHouseholdInvite(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	householdID, ok := parseIDParam(r, "id")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid household ID", nil)
+		return
+	}
+
+	var req CreateHouseholdInviteRequest
+	if !decodeValidated(w, r, &req) {
+		return
+	}
+
+	expiry := defaultInviteExpiry
+	if req.ExpiresInHours > 0 {
+		expiry = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+	now := time.Now()
+
+	invite, token, err := services.CreateHouseholdInvite(householdID, userID, req.Role, now.Add(expiry), middleware.GetReqID(r.Context()))
+	if err != nil {
+		respondHouseholdError(w, err, "Failed to create invite")
+		return
+	}
+
+	response := CreateHouseholdInviteAPIResponse{
+		HouseholdInviteAPIResponse: buildHouseholdInviteResponse(*invite, now),
+		Token:                      token,
+		AcceptURL:                  baseURL(r) + "/api/invites/" + token + "/accept",
+	}
+
+	// Validate response
+	if err := validate.Struct(response); err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Response validation failed", nil)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusCreated, response)
+}
+
+// ListHouseholdInvites returns the invites of a household the authenticated user owns, newest first
+func ListHouseholdInvites(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	householdID, ok := parseIDParam(r, "id")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid household ID", nil)
+		return
+	}
+
+	invites, err := services.GetHouseholdInvites(householdID, userID)
+	if err != nil {
+		respondHouseholdError(w, err, "Failed to retrieve invites")
+		return
+	}
+
+	// Build response
+	now := time.Now()
+	inviteResponses := make([]HouseholdInviteAPIResponse, 0, len(invites))
+	for _, invite := range invites {
+		inviteResponses = append(inviteResponses, buildHouseholdInviteResponse(invite, now))
+	}
+
+	utils.RespondJSON(w, http.StatusOK, HouseholdInviteListAPIResponse{Invites: inviteResponses})
+}
+
+// RevokeHouseholdInvite stops an unused invite to a household the authenticated user owns from being accepted
+func RevokeHouseholdInvite(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	householdID, ok := parseIDParam(r, "id")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid household ID", nil)
+		return
+	}
+
+	inviteID, ok := parseIDParam(r, "inviteID")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid invite ID", nil)
+		return
+	}
+
+	now := time.Now()
+	invite, err := services.RevokeHouseholdInvite(inviteID, householdID, userID, now, middleware.GetReqID(r.Context()))
+	if err != nil {
+		respondHouseholdError(w, err, "Failed to revoke invite")
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, buildHouseholdInviteResponse(*invite, now))
+}
+
+// AcceptHouseholdInvite makes the authenticated user a member of the household an invite token is for
+func AcceptHouseholdInvite(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	member, err := services.AcceptHouseholdInvite(chi.URLParam(r, "token"), userID, time.Now(), middleware.GetReqID(r.Context()))
+	if err != nil {
+		respondHouseholdError(w, err, "Failed to accept invite")
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, buildHouseholdResponse(member.Household, member.Role))
+}
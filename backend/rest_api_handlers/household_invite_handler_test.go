@@ -0,0 +1,147 @@
+package rest_api_handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createInvitee(t *testing.T) *models.User {
+	invitee := &models.User{GivenName: "New", Email: "new@example.com"}
+	require.NoError(t, db.DB.Create(invitee).Error)
+	return invitee
+}
+
+func TestCreateHouseholdInvite_Success(t *testing.T) {
+	owner, _, household := setupHouseholdTestDB(t)
+
+	req := newRouteRequest("POST", "/api/households/1/invites", strings.NewReader(`{"role":"editor","expires_in_hours":24}`), owner.ID, householdParams(household))
+	req.Host = "calendar.example.com"
+	rr := httptest.NewRecorder()
+	CreateHouseholdInvite(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var response CreateHouseholdInviteAPIResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.NotEmpty(t, response.Token)
+	assert.Equal(t, "http://calendar.example.com/api/invites/"+response.Token+"/accept", response.AcceptURL)
+	assert.Equal(t, models.HouseholdRoleEditor, response.Role)
+	assert.Equal(t, "pending", response.Status)
+	expiresAt, err := time.Parse(time.RFC3339, response.ExpiresAt)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), expiresAt, time.Minute)
+}
+
+func TestCreateHouseholdInvite_Errors(t *testing.T) {
+	owner, viewer, household := setupHouseholdTestDB(t)
+
+	tests := []struct {
+		name   string
+		userID uint
+		body   string
+		status int
+		error  string
+	}{
+		{"not an owner", viewer.ID, `{"role":"viewer"}`, http.StatusForbidden, "Insufficient household role"},
+		{"missing role", owner.ID, `{}`, http.StatusBadRequest, "This field is required"},
+		{"expiry too long", owner.ID, `{"role":"viewer","expires_in_hours":1000}`, http.StatusBadRequest, "Value too large (max: 720)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			CreateHouseholdInvite(rr, newRouteRequest("POST", "/api/households/1/invites", strings.NewReader(tt.body), tt.userID, householdParams(household)))
+
+			assert.Equal(t, tt.status, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.error)
+		})
+	}
+}
+
+func TestAcceptHouseholdInvite_Handler(t *testing.T) {
+	owner, _, household := setupHouseholdTestDB(t)
+	invitee := createInvitee(t)
+	_, token, err := services.CreateHouseholdInvite(household.ID, owner.ID, models.HouseholdRoleEditor, time.Now().Add(time.Hour), "")
+	require.NoError(t, err)
+	params := map[string]string{"token": token}
+
+	rr := httptest.NewRecorder()
+	AcceptHouseholdInvite(rr, newRouteRequest("POST", "/api/invites/"+token+"/accept", nil, invitee.ID, params))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response HouseholdAPIResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, household.ID, response.ID)
+	assert.Equal(t, "Family", response.Name)
+	assert.Equal(t, models.HouseholdRoleEditor, response.Role)
+
+	// A second use is refused
+	rr = httptest.NewRecorder()
+	AcceptHouseholdInvite(rr, newRouteRequest("POST", "/api/invites/"+token+"/accept", nil, owner.ID, params))
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Invite has already been used")
+
+	rr = httptest.NewRecorder()
+	AcceptHouseholdInvite(rr, newRouteRequest("POST", "/api/invites/nope/accept", nil, invitee.ID, map[string]string{"token": "nope"}))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	AcceptHouseholdInvite(rr, newRouteRequest("POST", "/api/invites/"+token+"/accept", nil, 0, params))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestAcceptHouseholdInvite_Expired(t *testing.T) {
+	owner, _, household := setupHouseholdTestDB(t)
+	invitee := createInvitee(t)
+	_, token, err := services.CreateHouseholdInvite(household.ID, owner.ID, models.HouseholdRoleViewer, time.Now().Add(-time.Minute), "")
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	AcceptHouseholdInvite(rr, newRouteRequest("POST", "/api/invites/"+token+"/accept", nil, invitee.ID, map[string]string{"token": token}))
+	assert.Equal(t, http.StatusGone, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Invite has expired")
+}
+
+func TestListAndRevokeHouseholdInvites(t *testing.T) {
+	owner, _, household := setupHouseholdTestDB(t)
+	invitee := createInvitee(t)
+	now := time.Now()
+	pending, _, err := services.CreateHouseholdInvite(household.ID, owner.ID, models.HouseholdRoleViewer, now.Add(time.Hour), "")
+	require.NoError(t, err)
+	_, token, err := services.CreateHouseholdInvite(household.ID, owner.ID, models.HouseholdRoleEditor, now.Add(time.Hour), "")
+	require.NoError(t, err)
+	_, err = services.AcceptHouseholdInvite(token, invitee.ID, now, "")
+	require.NoError(t, err)
+
+	params := householdParams(household)
+	params["inviteID"] = strconv.FormatUint(uint64(pending.ID), 10)
+	rr := httptest.NewRecorder()
+	RevokeHouseholdInvite(rr, newRouteRequest("DELETE", "/api/households/1/invites/1", nil, owner.ID, params))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"status":"revoked"`)
+
+	rr = httptest.NewRecorder()
+	ListHouseholdInvites(rr, newRouteRequest("GET", "/api/households/1/invites", nil, owner.ID, householdParams(household)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response HouseholdInviteListAPIResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Len(t, response.Invites, 2)
+	// Newest first
+	assert.Equal(t, "accepted", response.Invites[0].Status)
+	require.NotNil(t, response.Invites[0].AcceptedByID)
+	assert.Equal(t, invitee.ID, *response.Invites[0].AcceptedByID)
+	assert.Equal(t, "new@example.com", response.Invites[0].AcceptedByEmail)
+	assert.NotNil(t, response.Invites[0].AcceptedAt)
+	assert.Equal(t, "revoked", response.Invites[1].Status)
+	assert.NotNil(t, response.Invites[1].RevokedAt)
+	assert.NotContains(t, rr.Body.String(), token)
+}
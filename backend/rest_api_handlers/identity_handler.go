@@ -0,0 +1,205 @@
+package rest_api_handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"family-calendar-backend/auth"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/services"
+	"family-calendar-backend/rest_api_handlers/utils"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// identityLinkExpiry is how long a user has to sign in with the identity they are linking
+const identityLinkExpiry = 10 * time.Minute
+
+// ListIdentities returns the identity provider accounts the authenticated user can sign in with
+func ListIdentities(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	identities, err := services.GetUserIdentities(userID)
+	if err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to retrieve identities", nil)
+		return
+	}
+
+	// Build response
+	identityResponses := make([]IdentityAPIResponse, 0, len(identities))
+	for _, identity := range identities {
+		identityResponses = append(identityResponses, IdentityAPIResponse{
+			ID:        identity.ID,
+			Provider:  identity.Provider,
+			Email:     identity.Email,
+			CreatedAt: identity.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		})
+	}
+
+	response := IdentityListAPIResponse{Identities: identityResponses}
+	if err := validate.Struct(response); err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Response validation failed", nil)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+// buildIdentityLinkResponse describes an identity link; linkURL is only known when it is created
+func buildIdentityLinkResponse(link *models.IdentityLink, linkURL string) IdentityLinkAPIResponse {
+	response := IdentityLinkAPIResponse{
+		ID:        link.ID,
+		LinkURL:   linkURL,
+		Merge:     link.Merge,
+		ExpiresAt: link.ExpiresAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if link.MergeUser != nil {
+		response.PendingMerge = &PendingMergeAPIResponse{
+			UserID:     link.MergeUser.ID,
+			GivenName:  link.MergeUser.GivenName,
+			FamilyName: link.MergeUser.FamilyName,
+			Email:      link.MergeUser.Email,
+		}
+	}
+	return response
+}
+
+// CreateIdentityLink starts linking another identity to the authenticated user. The link token
+// goes into an HttpOnly cookie of the requesting browser only; signing in there at the returned
+// URL within ten minutes, while this session lasts, attaches the identity used.
+func CreateIdentityLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+	sessionID, ok := auth.GetSessionIDFromContext(r.Context())
+	if !ok || sessionID == 0 {
+		utils.RespondError(w, http.StatusForbidden, "Linking identities requires a sign-in session", nil)
+		return
+	}
+
+	var req CreateIdentityLinkRequest
+	if !decodeValidated(w, r, &req) {
+		return
+	}
+	if _, ok := auth.GetProvider(req.Provider); !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Unknown identity provider", nil)
+		return
+	}
+
+	link, token, err := services.CreateIdentityLink(userID, sessionID, req.Merge, time.Now().Add(identityLinkExpiry))
+	if err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to create identity link", nil)
+		return
+	}
+
+	response := buildIdentityLinkResponse(link, baseURL(r)+"/auth/"+url.PathEscape(req.Provider)+"?link=1")
+
+	// Validate response
+	if err := validate.Struct(response); err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Response validation failed", nil)
+		return
+	}
+
+	auth.SetIdentityLinkCookie(w, token, identityLinkExpiry)
+	utils.RespondJSON(w, http.StatusCreated, response)
+}
+
+// GetIdentityLink returns one of the authenticated user's identity links, showing the account a
+// merge link found so the user can confirm merging it
+func GetIdentityLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	linkID, ok := parseIDParam(r, "id")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid identity link ID", nil)
+		return
+	}
+
+	link, err := services.GetIdentityLink(linkID, userID)
+	if err != nil {
+		if errors.Is(err, services.ErrIdentityLinkInvalid) {
+			utils.RespondError(w, http.StatusNotFound, "Identity link not found", nil)
+			return
+		}
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to retrieve identity link", nil)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, buildIdentityLinkResponse(link, ""))
+}
+
+// ConfirmIdentityMerge merges the account found by one of the authenticated user's merge links
+// into the user. Merging moves that account's calendar muxes, households and tokens over and
+// deletes it, so it only happens on this explicit request.
+func ConfirmIdentityMerge(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	linkID, ok := parseIDParam(r, "id")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid identity link ID", nil)
+		return
+	}
+
+	revokedSessionIDs, err := services.ConfirmIdentityMerge(linkID, userID, time.Now(), middleware.GetReqID(r.Context()))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrIdentityLinkInvalid):
+			utils.RespondError(w, http.StatusNotFound, "Identity link not found or expired", nil)
+		case errors.Is(err, services.ErrIdentityMergeNotPending):
+			utils.RespondError(w, http.StatusConflict, "Identity link has no merge to confirm", nil)
+		default:
+			utils.RespondError(w, http.StatusInternalServerError, "Failed to merge accounts", nil)
+		}
+		return
+	}
+	for _, sessionID := range revokedSessionIDs {
+		auth.InvalidateSession(sessionID)
+	}
+
+	utils.RespondJSON(w, http.StatusOK, ConfirmIdentityMergeAPIResponse{Message: "Accounts merged successfully"})
+}
+
+// UnlinkIdentity stops one of the authenticated user's identities from signing in as them
+func UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	identityID, ok := parseIDParam(r, "id")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid identity ID", nil)
+		return
+	}
+
+	if err := services.UnlinkIdentity(identityID, userID); err != nil {
+		switch {
+		case errors.Is(err, services.ErrIdentityNotFound):
+			utils.RespondError(w, http.StatusNotFound, "Identity not found", nil)
+		case errors.Is(err, services.ErrLastIdentity):
+			utils.RespondError(w, http.StatusConflict, "Cannot unlink the last identity", nil)
+		default:
+			utils.RespondError(w, http.StatusInternalServerError, "Failed to unlink identity", nil)
+		}
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, UnlinkIdentityAPIResponse{Message: "Identity unlinked successfully"})
+}
@@ -0,0 +1,47 @@
+package rest_api_handlers
+
+// IdentityAPIResponse is an identity provider account the authenticated user signs in with
+type IdentityAPIResponse struct {
+	ID        uint   `json:"id" validate:"required"`
+	Provider  string `json:"provider" validate:"required"`
+	Email     string `json:"email"`
+	CreatedAt string `json:"created_at" validate:"required"`
+}
+
+type IdentityListAPIResponse struct {
+	Identities []IdentityAPIResponse `json:"identities" validate:"dive"`
+}
+
+type CreateIdentityLinkRequest struct {
+	Provider string `json:"provider" validate:"required"`
+	// Merge takes over the account the identity already belongs to, with its calendar muxes
+	// and household memberships
+	Merge bool `json:"merge"`
+}
+
+// IdentityLinkAPIResponse describes an identity link. LinkURL, the URL to sign in at with the
+// identity to link, is only returned when the link is created.
+type IdentityLinkAPIResponse struct {
+	ID        uint   `json:"id" validate:"required"`
+	LinkURL   string `json:"link_url,omitempty" validate:"omitempty,url"`
+	Merge     bool   `json:"merge"`
+	ExpiresAt string `json:"expires_at" validate:"required"`
+	// PendingMerge is the account a merge link found, until the user confirms merging it
+	PendingMerge *PendingMergeAPIResponse `json:"pending_merge,omitempty"`
+}
+
+// PendingMergeAPIResponse is an account awaiting confirmation to be merged into the user's
+type PendingMergeAPIResponse struct {
+	UserID     uint   `json:"user_id" validate:"required"`
+	GivenName  string `json:"given_name"`
+	FamilyName string `json:"family_name"`
+	Email      string `json:"email"`
+}
+
+type ConfirmIdentityMergeAPIResponse struct {
+	Message string `json:"message" validate:"required"`
+}
+
+type UnlinkIdentityAPIResponse struct {
+	Message string `json:"message" validate:"required"`
+}
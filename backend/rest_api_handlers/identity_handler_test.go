@@ -0,0 +1,207 @@
+package rest_api_handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"family-calendar-backend/auth"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// stubProvider is an identity provider that is only ever linked to, never signed in with
+type stubProvider struct{}
+
+func (stubProvider) Name() string                           { return "stub" }
+func (stubProvider) AuthCodeURL(state, nonce string) string { return "" }
+func (stubProvider) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	return nil, nil
+}
+func (stubProvider) Identify(ctx context.Context, token *oauth2.Token, nonce string) (*auth.Identity, error) {
+	return nil, nil
+}
+
+func TestListIdentities(t *testing.T) {
+	setupCalendarMuxTestDB(t)
+	user, err := services.FindOrCreateUser("google", "google-1", "Test", "User", "work@example.com")
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	ListIdentities(rr, newRouteRequest("GET", "/api/identities", nil, user.ID, nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response IdentityListAPIResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Len(t, response.Identities, 1)
+	assert.Equal(t, "google", response.Identities[0].Provider)
+	assert.Equal(t, "work@example.com", response.Identities[0].Email)
+
+	rr = httptest.NewRecorder()
+	ListIdentities(rr, newRouteRequest("GET", "/api/identities", nil, 0, nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+// withSession marks a request as made in a sign-in session of its user
+func withSession(t *testing.T, req *http.Request, userID uint) (*http.Request, *models.Session) {
+	now := time.Now()
+	session, _, err := services.CreateSession(userID, "Laptop", "192.0.2.1", now, now.Add(time.Hour))
+	require.NoError(t, err)
+	return req.WithContext(context.WithValue(req.Context(), auth.SessionIDContextKey, session.ID)), session
+}
+
+func TestCreateIdentityLink_Handler(t *testing.T) {
+	user := setupCalendarMuxTestDB(t)
+	auth.RegisterProvider(stubProvider{})
+
+	body := strings.NewReader(`{"provider": "stub", "merge": true}`)
+	req, _ := withSession(t, newRouteRequest("POST", "http://calendar.example.com/api/identities/link", body, user.ID, nil), user.ID)
+	rr := httptest.NewRecorder()
+	CreateIdentityLink(rr, req)
+
+	require.Equal(t, http.StatusCreated, rr.Code)
+	var response IdentityLinkAPIResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.NotZero(t, response.ID)
+	assert.True(t, response.Merge)
+	linkURL, err := url.Parse(response.LinkURL)
+	require.NoError(t, err)
+	assert.Equal(t, "/auth/stub", linkURL.Path)
+
+	// The token is not in the URL but in an HttpOnly cookie for the sign-in pages of this browser
+	assert.Equal(t, "1", linkURL.Query().Get("link"))
+	var linkCookie *http.Cookie
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == "oauth_link" {
+			linkCookie = cookie
+		}
+	}
+	require.NotNil(t, linkCookie)
+	assert.True(t, linkCookie.HttpOnly)
+	assert.Equal(t, "/auth", linkCookie.Path)
+	linked, err := services.LinkIdentity(linkCookie.Value, "stub", "stub-1", "", time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, linked.ID)
+}
+
+func TestCreateIdentityLink_Errors(t *testing.T) {
+	user := setupCalendarMuxTestDB(t)
+
+	tests := []struct {
+		name    string
+		body    string
+		userID  uint
+		session bool
+		status  int
+	}{
+		{"unauthenticated", `{"provider": "stub"}`, 0, false, http.StatusUnauthorized},
+		{"without a session", `{"provider": "stub"}`, user.ID, false, http.StatusForbidden},
+		{"missing provider", `{}`, user.ID, true, http.StatusBadRequest},
+		{"unknown provider", `{"provider": "unknown"}`, user.ID, true, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newRouteRequest("POST", "/api/identities/link", strings.NewReader(tt.body), tt.userID, nil)
+			if tt.session {
+				req, _ = withSession(t, req, tt.userID)
+			}
+			rr := httptest.NewRecorder()
+			CreateIdentityLink(rr, req)
+
+			assert.Equal(t, tt.status, rr.Code)
+		})
+	}
+}
+
+func TestConfirmIdentityMerge_Handler(t *testing.T) {
+	setupCalendarMuxTestDB(t)
+	user, err := services.FindOrCreateUser("google", "google-1", "Test", "User", "work@example.com")
+	require.NoError(t, err)
+	other, err := services.FindOrCreateUser("stub", "stub-1", "Other", "User", "other@example.com")
+	require.NoError(t, err)
+	_, session := withSession(t, httptest.NewRequest("GET", "/", nil), user.ID)
+	link, token, err := services.CreateIdentityLink(user.ID, session.ID, true, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	_, err = services.LinkIdentity(token, "stub", "stub-1", "", time.Now())
+	require.NoError(t, err)
+	params := map[string]string{"id": strconv.FormatUint(uint64(link.ID), 10)}
+
+	// The link shows the account it found
+	rr := httptest.NewRecorder()
+	GetIdentityLink(rr, newRouteRequest("GET", "/api/identities/link/1", nil, user.ID, params))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var response IdentityLinkAPIResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.NotNil(t, response.PendingMerge)
+	assert.Equal(t, other.ID, response.PendingMerge.UserID)
+	assert.Equal(t, "other@example.com", response.PendingMerge.Email)
+	assert.Empty(t, response.LinkURL)
+
+	// Other users cannot see or confirm it
+	rr = httptest.NewRecorder()
+	GetIdentityLink(rr, newRouteRequest("GET", "/api/identities/link/1", nil, other.ID, params))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = httptest.NewRecorder()
+	ConfirmIdentityMerge(rr, newRouteRequest("POST", "/api/identities/link/1/merge", nil, other.ID, params))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	ConfirmIdentityMerge(rr, newRouteRequest("POST", "/api/identities/link/1/merge", nil, user.ID, params))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	identities, err := services.GetUserIdentities(user.ID)
+	require.NoError(t, err)
+	assert.Len(t, identities, 2)
+
+	rr = httptest.NewRecorder()
+	ConfirmIdentityMerge(rr, newRouteRequest("POST", "/api/identities/link/1/merge", nil, user.ID, params))
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	rr = httptest.NewRecorder()
+	ConfirmIdentityMerge(rr, newRouteRequest("POST", "/api/identities/link/abc/merge", nil, user.ID, map[string]string{"id": "abc"}))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestUnlinkIdentity_Handler(t *testing.T) {
+	setupCalendarMuxTestDB(t)
+	user, err := services.FindOrCreateUser("google", "google-1", "Test", "User", "work@example.com")
+	require.NoError(t, err)
+	_, session := withSession(t, httptest.NewRequest("GET", "/", nil), user.ID)
+	_, token, err := services.CreateIdentityLink(user.ID, session.ID, false, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	_, err = services.LinkIdentity(token, "stub", "stub-1", "", time.Now())
+	require.NoError(t, err)
+	identities, err := services.GetUserIdentities(user.ID)
+	require.NoError(t, err)
+	require.Len(t, identities, 2)
+	params := func(id uint) map[string]string {
+		return map[string]string{"id": strconv.FormatUint(uint64(id), 10)}
+	}
+
+	// Other users cannot see the identity
+	rr := httptest.NewRecorder()
+	UnlinkIdentity(rr, newRouteRequest("DELETE", "/api/identities/1", nil, user.ID+1, params(identities[0].ID)))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	UnlinkIdentity(rr, newRouteRequest("DELETE", "/api/identities/1", nil, user.ID, params(identities[0].ID)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// The last identity stays
+	rr = httptest.NewRecorder()
+	UnlinkIdentity(rr, newRouteRequest("DELETE", "/api/identities/2", nil, user.ID, params(identities[1].ID)))
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	rr = httptest.NewRecorder()
+	UnlinkIdentity(rr, newRouteRequest("DELETE", "/api/identities/abc", nil, user.ID, map[string]string{"id": "abc"}))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
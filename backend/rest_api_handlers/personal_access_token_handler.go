@@ -0,0 +1,119 @@
+package rest_api_handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"family-calendar-backend/auth"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/services"
+	"family-calendar-backend/rest_api_handlers/utils"
+)
+
+func buildPersonalAccessTokenResponse(accessToken models.PersonalAccessToken) PersonalAccessTokenAPIResponse {
+	return PersonalAccessTokenAPIResponse{
+		ID:         accessToken.ID,
+		Name:       accessToken.Name,
+		Scopes:     accessToken.ScopeList(),
+		CreatedAt:  accessToken.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		LastUsedAt: formatOptionalTime(accessToken.LastUsedAt),
+		ExpiresAt:  formatOptionalTime(accessToken.ExpiresAt),
+	}
+}
+
+// CreatePersonalAccessToken mints a named, scoped token for scripts of the authenticated user.
+// The token is only shown in this response.
+func CreatePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	var req CreatePersonalAccessTokenRequest
+	if !decodeValidated(w, r, &req) {
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		expiry := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &expiry
+	}
+
+	accessToken, token, err := services.CreatePersonalAccessToken(userID, req.Name, req.Scopes, expiresAt)
+	if err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to create personal access token", nil)
+		return
+	}
+
+	response := CreatePersonalAccessTokenAPIResponse{
+		PersonalAccessTokenAPIResponse: buildPersonalAccessTokenResponse(*accessToken),
+		Token:                          token,
+	}
+
+	// Validate response
+	if err := validate.Struct(response); err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Response validation failed", nil)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusCreated, response)
+}
+
+// ListPersonalAccessTokens returns the personal access tokens of the authenticated user, newest first
+func ListPersonalAccessTokens(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	tokens, err := services.GetPersonalAccessTokensByUser(userID)
+	if err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to retrieve personal access tokens", nil)
+		return
+	}
+
+	// Build response
+	tokenResponses := make([]PersonalAccessTokenAPIResponse, 0, len(tokens))
+	for _, accessToken := range tokens {
+		tokenResponses = append(tokenResponses, buildPersonalAccessTokenResponse(accessToken))
+	}
+
+	response := PersonalAccessTokenListAPIResponse{Tokens: tokenResponses}
+	if err := validate.Struct(response); err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Response validation failed", nil)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+// DeletePersonalAccessToken revokes a personal access token of the authenticated user. It stops
+// working immediately.
+func DeletePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	tokenID, ok := parseIDParam(r, "id")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid token ID", nil)
+		return
+	}
+
+	if err := services.DeletePersonalAccessToken(tokenID, userID); err != nil {
+		if errors.Is(err, services.ErrPersonalAccessTokenNotFound) {
+			utils.RespondError(w, http.StatusNotFound, "Personal access token not found", nil)
+			return
+		}
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to delete personal access token", nil)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, DeletePersonalAccessTokenAPIResponse{Message: "Personal access token deleted successfully"})
+}
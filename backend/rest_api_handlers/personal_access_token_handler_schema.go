@@ -0,0 +1,32 @@
+package rest_api_handlers
+
+type CreatePersonalAccessTokenRequest struct {
+	Name   string   `json:"name" validate:"required,max=100"`
+	Scopes []string `json:"scopes" validate:"required,min=1,unique,dive,oneof=events:read muxes:manage"`
+	// ExpiresInDays makes the token expire; it never does when omitted
+	ExpiresInDays int `json:"expires_in_days" validate:"omitempty,min=1,max=3650"`
+}
+
+// PersonalAccessTokenAPIResponse describes a personal access token without its secret
+type PersonalAccessTokenAPIResponse struct {
+	ID         uint     `json:"id" validate:"required"`
+	Name       string   `json:"name" validate:"required"`
+	Scopes     []string `json:"scopes" validate:"required,min=1"`
+	CreatedAt  string   `json:"created_at" validate:"required"`
+	LastUsedAt *string  `json:"last_used_at"`
+	ExpiresAt  *string  `json:"expires_at"`
+}
+
+type PersonalAccessTokenListAPIResponse struct {
+	Tokens []PersonalAccessTokenAPIResponse `json:"tokens" validate:"dive"`
+}
+
+// CreatePersonalAccessTokenAPIResponse is the only response that carries the token
+type CreatePersonalAccessTokenAPIResponse struct {
+	PersonalAccessTokenAPIResponse
+	Token string `json:"token" validate:"required"`
+}
+
+type DeletePersonalAccessTokenAPIResponse struct {
+	Message string `json:"message" validate:"required"`
+}
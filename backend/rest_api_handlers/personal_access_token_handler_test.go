@@ -0,0 +1,113 @@
+package rest_api_handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreatePersonalAccessToken_Handler(t *testing.T) {
+	user := setupCalendarMuxTestDB(t)
+
+	body := strings.NewReader(`{"name": "Kitchen display", "scopes": ["events:read"], "expires_in_days": 30}`)
+	rr := httptest.NewRecorder()
+	CreatePersonalAccessToken(rr, newRouteRequest("POST", "/api/tokens", body, user.ID, nil))
+
+	require.Equal(t, http.StatusCreated, rr.Code)
+	var response CreatePersonalAccessTokenAPIResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.True(t, strings.HasPrefix(response.Token, models.PersonalAccessTokenPrefix))
+	assert.Equal(t, "Kitchen display", response.Name)
+	assert.Equal(t, []string{models.ScopeEventsRead}, response.Scopes)
+	require.NotNil(t, response.ExpiresAt)
+	assert.Nil(t, response.LastUsedAt)
+
+	accessToken, err := services.AuthenticatePersonalAccessToken(response.Token, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, response.ID, accessToken.ID)
+}
+
+func TestCreatePersonalAccessToken_Errors(t *testing.T) {
+	user := setupCalendarMuxTestDB(t)
+
+	tests := []struct {
+		name   string
+		body   string
+		userID uint
+		status int
+	}{
+		{"unauthenticated", `{"name": "Script", "scopes": ["events:read"]}`, 0, http.StatusUnauthorized},
+		{"missing name", `{"scopes": ["events:read"]}`, user.ID, http.StatusBadRequest},
+		{"missing scopes", `{"name": "Script", "scopes": []}`, user.ID, http.StatusBadRequest},
+		{"unknown scope", `{"name": "Script", "scopes": ["admin"]}`, user.ID, http.StatusBadRequest},
+		{"duplicate scope", `{"name": "Script", "scopes": ["events:read", "events:read"]}`, user.ID, http.StatusBadRequest},
+		{"expiry too long", `{"name": "Script", "scopes": ["events:read"], "expires_in_days": 10000}`, user.ID, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			CreatePersonalAccessToken(rr, newRouteRequest("POST", "/api/tokens", strings.NewReader(tt.body), tt.userID, nil))
+
+			assert.Equal(t, tt.status, rr.Code)
+		})
+	}
+}
+
+func TestListPersonalAccessTokens(t *testing.T) {
+	user := setupCalendarMuxTestDB(t)
+	_, token, err := services.CreatePersonalAccessToken(user.ID, "Home Assistant", []string{models.ScopeMuxesManage}, nil)
+	require.NoError(t, err)
+	_, err = services.AuthenticatePersonalAccessToken(token, time.Now())
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	ListPersonalAccessTokens(rr, newRouteRequest("GET", "/api/tokens", nil, user.ID, nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), token)
+	var response PersonalAccessTokenListAPIResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Len(t, response.Tokens, 1)
+	assert.Equal(t, "Home Assistant", response.Tokens[0].Name)
+	assert.NotNil(t, response.Tokens[0].LastUsedAt)
+	assert.Nil(t, response.Tokens[0].ExpiresAt)
+
+	rr = httptest.NewRecorder()
+	ListPersonalAccessTokens(rr, newRouteRequest("GET", "/api/tokens", nil, 0, nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestDeletePersonalAccessToken_Handler(t *testing.T) {
+	user := setupCalendarMuxTestDB(t)
+	accessToken, _, err := services.CreatePersonalAccessToken(user.ID, "Script", []string{models.ScopeEventsRead}, nil)
+	require.NoError(t, err)
+	params := map[string]string{"id": strconv.FormatUint(uint64(accessToken.ID), 10)}
+
+	// Other users cannot see the token
+	rr := httptest.NewRecorder()
+	DeletePersonalAccessToken(rr, newRouteRequest("DELETE", "/api/tokens/1", nil, user.ID+1, params))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	DeletePersonalAccessToken(rr, newRouteRequest("DELETE", "/api/tokens/1", nil, user.ID, params))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	tokens, err := services.GetPersonalAccessTokensByUser(user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, tokens)
+
+	rr = httptest.NewRecorder()
+	DeletePersonalAccessToken(rr, newRouteRequest("DELETE", "/api/tokens/abc", nil, user.ID, map[string]string{"id": "abc"}))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -0,0 +1,304 @@
+package rest_api_handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"family-calendar-backend/auth"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/services"
+	"family-calendar-backend/ical"
+	"family-calendar-backend/rest_api_handlers/utils"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-playground/validator/v10"
+)
+
+// colorNamePattern matches the CSS color names the COLOR property (RFC 7986) takes
+var colorNamePattern = regexp.MustCompile(`^[A-Za-z]+$`)
+
+// rewriteRule is a stored rewrite rule ready to run
+type rewriteRule struct {
+	action string
+	// pattern is nil for rules that apply to every event
+	pattern *regexp.Regexp
+	value   string
+}
+
+// compileRewriteRule compiles the pattern of a stored rule
+func compileRewriteRule(rule models.RewriteRule) (rewriteRule, error) {
+	compiled := rewriteRule{action: rule.Action, value: rule.Value}
+	if rule.Pattern != "" {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return rewriteRule{}, err
+		}
+		compiled.pattern = pattern
+	}
+	return compiled, nil
+}
+
+// loadRewriteRules returns the compiled rules of each source, in the order they run.
+// Rules that no longer compile are logged and skipped rather than failing the whole output.
+func loadRewriteRules(sourceIDs []uint) (map[uint][]rewriteRule, error) {
+	rules, err := services.GetRewriteRulesBySources(sourceIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	compiled := make(map[uint][]rewriteRule)
+	for _, rule := range rules {
+		c, err := compileRewriteRule(rule)
+		if err != nil {
+			log.Printf("Ignoring rewrite rule %d of calendar source %d: %v", rule.ID, rule.CalendarSourceID, err)
+			continue
+		}
+		compiled[rule.CalendarSourceID] = append(compiled[rule.CalendarSourceID], c)
+	}
+	return compiled, nil
+}
+
+// splitCategories turns a comma-separated list into trimmed, non-empty category names
+func splitCategories(value string) []string {
+	var categories []string
+	for _, category := range strings.Split(value, ",") {
+		if category = strings.TrimSpace(category); category != "" {
+			categories = append(categories, category)
+		}
+	}
+	return categories
+}
+
+// applyRewriteRules runs rules in order over an event, matching each rule's pattern against the
+// title as rewritten by the rules before it. It returns nil when a rule drops the event.
+func applyRewriteRules(vevent *ical.Component, rules []rewriteRule) *ical.Component {
+	for _, rule := range rules {
+		title := ical.UnescapeText(vevent.PropValue("SUMMARY"))
+		if rule.pattern != nil && !rule.pattern.MatchString(title) {
+			continue
+		}
+
+		switch rule.action {
+		case models.RewriteActionDrop:
+			return nil
+		case models.RewriteActionPrefix:
+			if title != "" {
+				title = rule.value + " " + title
+			} else {
+				title = rule.value
+			}
+			vevent.SetProp(ical.Property{Name: "SUMMARY", Value: ical.EscapeText(title)})
+		case models.RewriteActionReplace:
+			title = rule.pattern.ReplaceAllString(title, rule.value)
+			vevent.SetProp(ical.Property{Name: "SUMMARY", Value: ical.EscapeText(title)})
+		case models.RewriteActionSetCategories:
+			categories := splitCategories(rule.value)
+			for i := range categories {
+				categories[i] = ical.EscapeText(categories[i])
+			}
+			vevent.SetProp(ical.Property{Name: "CATEGORIES", Value: strings.Join(categories, ",")})
+		case models.RewriteActionSetColor:
+			vevent.SetProp(ical.Property{Name: "COLOR", Value: strings.ToLower(rule.value)})
+		}
+	}
+	return vevent
+}
+
+// validateRewriteRuleRequest checks a rule request, returning the problems by JSON field name
+func validateRewriteRuleRequest(req RewriteRuleRequest) map[string]string {
+	fields := map[string]string{}
+	if err := validate.Struct(req); err != nil {
+		for _, fieldError := range err.(validator.ValidationErrors) {
+			fields[strings.ToLower(fieldError.Field())] = utils.GetValidationErrorMsg(fieldError)
+		}
+		return fields
+	}
+
+	if req.Pattern != "" {
+		if _, err := regexp.Compile(req.Pattern); err != nil {
+			fields["pattern"] = "Invalid regular expression"
+		}
+	}
+
+	switch req.Action {
+	case models.RewriteActionReplace, models.RewriteActionDrop:
+		if req.Pattern == "" {
+			fields["pattern"] = "This field is required"
+		}
+	case models.RewriteActionPrefix:
+		if strings.TrimSpace(req.Value) == "" {
+			fields["value"] = "This field is required"
+		}
+	case models.RewriteActionSetCategories:
+		if len(splitCategories(req.Value)) == 0 {
+			fields["value"] = "This field is required"
+		}
+	case models.RewriteActionSetColor:
+		if !colorNamePattern.MatchString(req.Value) {
+			fields["value"] = "Must be a CSS color name"
+		}
+	}
+	return fields
+}
+
+// decodeRewriteRuleRequest reads and validates the body of a create or update request,
+// responding with the problem when it is not acceptable
+func decodeRewriteRuleRequest(w http.ResponseWriter, r *http.Request) (RewriteRuleRequest, bool) {
+	var req RewriteRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid request body", nil)
+		return req, false
+	}
+
+	if fields := validateRewriteRuleRequest(req); len(fields) > 0 {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid rewrite rule", fields)
+		return req, false
+	}
+	return req, true
+}
+
+// respondRewriteRuleError maps a rewrite rule service error to a response
+func respondRewriteRuleError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrCalendarMuxNotFound):
+		utils.RespondError(w, http.StatusNotFound, "Calendar mux not found or access denied", nil)
+	case errors.Is(err, services.ErrCalendarSourceNotFound):
+		utils.RespondError(w, http.StatusNotFound, "Calendar source not found", nil)
+	case errors.Is(err, services.ErrRewriteRuleNotFound):
+		utils.RespondError(w, http.StatusNotFound, "Rewrite rule not found", nil)
+	case errors.Is(err, services.ErrInsufficientRole):
+		utils.RespondError(w, http.StatusForbidden, "Insufficient household role", nil)
+	default:
+		utils.RespondError(w, http.StatusInternalServerError, message, nil)
+	}
+}
+
+// parseRewriteRuleRoute reads the authenticated user and the mux and source IDs of a rewrite rule route
+func parseRewriteRuleRoute(w http.ResponseWriter, r *http.Request) (userID, calendarMuxID, sourceID uint, ok bool) {
+	userID, ok = auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return 0, 0, 0, false
+	}
+
+	calendarMuxID, ok = parseIDParam(r, "id")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid calendar mux ID", nil)
+		return 0, 0, 0, false
+	}
+
+	sourceID, ok = parseIDParam(r, "sourceID")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid calendar source ID", nil)
+		return 0, 0, 0, false
+	}
+	return userID, calendarMuxID, sourceID, true
+}
+
+func buildRewriteRuleResponse(rule models.RewriteRule) RewriteRuleAPIResponse {
+	return RewriteRuleAPIResponse{
+		ID:               rule.ID,
+		CalendarSourceID: rule.CalendarSourceID,
+		Position:         rule.Position,
+		Action:           rule.Action,
+		Pattern:          rule.Pattern,
+		Value:            rule.Value,
+		CreatedAt:        rule.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt:        rule.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
+// ListRewriteRules returns the rewrite rules of a source, in the order they run
+func (h *CalendarMuxHandler) ListRewriteRules(w http.ResponseWriter, r *http.Request) {
+	userID, calendarMuxID, sourceID, ok := parseRewriteRuleRoute(w, r)
+	if !ok {
+		return
+	}
+
+	rules, err := h.muxes.GetRewriteRules(sourceID, calendarMuxID, userID)
+	if err != nil {
+		respondRewriteRuleError(w, err, "Failed to retrieve rewrite rules")
+		return
+	}
+
+	// Build response
+	ruleResponses := make([]RewriteRuleAPIResponse, 0, len(rules))
+	for _, rule := range rules {
+		ruleResponses = append(ruleResponses, buildRewriteRuleResponse(rule))
+	}
+
+	utils.RespondJSON(w, http.StatusOK, RewriteRuleListAPIResponse{Rules: ruleResponses})
+}
+
+// CreateRewriteRule adds a rewrite rule to a source, at the given position or at the end
+func (h *CalendarMuxHandler) CreateRewriteRule(w http.ResponseWriter, r *http.Request) {
+	userID, calendarMuxID, sourceID, ok := parseRewriteRuleRoute(w, r)
+	if !ok {
+		return
+	}
+
+	req, ok := decodeRewriteRuleRequest(w, r)
+	if !ok {
+		return
+	}
+
+	rule, err := h.muxes.CreateRewriteRule(sourceID, calendarMuxID, userID, req.Action, req.Pattern, req.Value, req.Position, middleware.GetReqID(r.Context()))
+	if err != nil {
+		respondRewriteRuleError(w, err, "Failed to create rewrite rule")
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusCreated, buildRewriteRuleResponse(*rule))
+}
+
+// UpdateRewriteRule replaces a rewrite rule of a source, moving it when a position is given
+func (h *CalendarMuxHandler) UpdateRewriteRule(w http.ResponseWriter, r *http.Request) {
+	userID, calendarMuxID, sourceID, ok := parseRewriteRuleRoute(w, r)
+	if !ok {
+		return
+	}
+
+	ruleID, ok := parseIDParam(r, "ruleID")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid rewrite rule ID", nil)
+		return
+	}
+
+	req, ok := decodeRewriteRuleRequest(w, r)
+	if !ok {
+		return
+	}
+
+	rule, err := h.muxes.UpdateRewriteRule(ruleID, sourceID, calendarMuxID, userID, req.Action, req.Pattern, req.Value, req.Position, middleware.GetReqID(r.Context()))
+	if err != nil {
+		respondRewriteRuleError(w, err, "Failed to update rewrite rule")
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, buildRewriteRuleResponse(*rule))
+}
+
+// DeleteRewriteRule removes a rewrite rule from a source
+func (h *CalendarMuxHandler) DeleteRewriteRule(w http.ResponseWriter, r *http.Request) {
+	userID, calendarMuxID, sourceID, ok := parseRewriteRuleRoute(w, r)
+	if !ok {
+		return
+	}
+
+	ruleID, ok := parseIDParam(r, "ruleID")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid rewrite rule ID", nil)
+		return
+	}
+
+	if err := h.muxes.DeleteRewriteRule(ruleID, sourceID, calendarMuxID, userID, middleware.GetReqID(r.Context())); err != nil {
+		respondRewriteRuleError(w, err, "Failed to delete rewrite rule")
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, DeleteRewriteRuleAPIResponse{Message: "Rewrite rule deleted successfully"})
+}
@@ -0,0 +1,29 @@
+package rest_api_handlers
+
+// RewriteRuleRequest creates or replaces a rewrite rule. Pattern is a regular expression matched
+// against event titles; Position is the 0-based place in the source's rule list.
+type RewriteRuleRequest struct {
+	Action   string `json:"action" validate:"required,oneof=prefix replace set_categories set_color drop"`
+	Pattern  string `json:"pattern" validate:"max=500"`
+	Value    string `json:"value" validate:"max=500"`
+	Position *int   `json:"position" validate:"omitempty,min=0"`
+}
+
+type RewriteRuleAPIResponse struct {
+	ID               uint   `json:"id" validate:"required"`
+	CalendarSourceID uint   `json:"calendar_source_id" validate:"required"`
+	Position         int    `json:"position" validate:"min=0"`
+	Action           string `json:"action" validate:"required"`
+	Pattern          string `json:"pattern"`
+	Value            string `json:"value"`
+	CreatedAt        string `json:"created_at" validate:"required"`
+	UpdatedAt        string `json:"updated_at" validate:"required"`
+}
+
+type RewriteRuleListAPIResponse struct {
+	Rules []RewriteRuleAPIResponse `json:"rules" validate:"dive"`
+}
+
+type DeleteRewriteRuleAPIResponse struct {
+	Message string `json:"message" validate:"required"`
+}
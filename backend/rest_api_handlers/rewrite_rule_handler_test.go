@@ -0,0 +1,386 @@
+package rest_api_handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"family-calendar-backend/db"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/ical"
+	"family-calendar-backend/rest_api_handlers/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupRewriteRuleTestDB(t *testing.T) (*models.User, *models.CalendarMux, *models.CalendarSource) {
+	user, calendarMux := setupCalendarSourceTestDB(t)
+
+	calendarSource := &models.CalendarSource{CalendarMuxID: calendarMux.ID, URL: "https://example.com/emma.ics", Label: "Emma", Enabled: true}
+	require.NoError(t, db.DB.Create(calendarSource).Error)
+
+	return user, calendarMux, calendarSource
+}
+
+// rewriteRuleRequest builds a request to a rewrite rule route; ruleID 0 targets the rule list
+func rewriteRuleRequest(method string, userID uint, calendarMux *models.CalendarMux, calendarSource *models.CalendarSource, ruleID uint, body interface{}) *http.Request {
+	muxID := strconv.FormatUint(uint64(calendarMux.ID), 10)
+	sourceID := strconv.FormatUint(uint64(calendarSource.ID), 10)
+	params := map[string]string{"id": muxID, "sourceID": sourceID}
+	target := "/api/calendar-mux/" + muxID + "/sources/" + sourceID + "/rules"
+	if ruleID != 0 {
+		params["ruleID"] = strconv.FormatUint(uint64(ruleID), 10)
+		target += "/" + params["ruleID"]
+	}
+
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	return newRouteRequest(method, target, reader, userID, params)
+}
+
+func TestApplyRewriteRules(t *testing.T) {
+	compile := func(t *testing.T, rules ...models.RewriteRule) []rewriteRule {
+		compiled := make([]rewriteRule, 0, len(rules))
+		for _, rule := range rules {
+			c, err := compileRewriteRule(rule)
+			require.NoError(t, err)
+			compiled = append(compiled, c)
+		}
+		return compiled
+	}
+
+	tests := []struct {
+		name        string
+		rules       []models.RewriteRule
+		title       string
+		wantTitle   string
+		wantProp    string
+		wantValue   string
+		wantDropped bool
+	}{
+		{
+			name:      "Prefix",
+			rules:     []models.RewriteRule{{Action: models.RewriteActionPrefix, Value: "[Emma]"}},
+			title:     "Soccer practice",
+			wantTitle: "[Emma] Soccer practice",
+		},
+		{
+			name:      "Prefix only when matching",
+			rules:     []models.RewriteRule{{Action: models.RewriteActionPrefix, Pattern: "(?i)soccer", Value: "⚽"}},
+			title:     "Soccer practice",
+			wantTitle: "⚽ Soccer practice",
+		},
+		{
+			name:      "Prefix skipped when not matching",
+			rules:     []models.RewriteRule{{Action: models.RewriteActionPrefix, Pattern: "^Piano", Value: "🎹"}},
+			title:     "Soccer practice",
+			wantTitle: "Soccer practice",
+		},
+		{
+			name:      "Replace with groups",
+			rules:     []models.RewriteRule{{Action: models.RewriteActionReplace, Pattern: `^U(\d+) (.*)$`, Value: "$2 (under $1)"}},
+			title:     "U10 Soccer, away game",
+			wantTitle: "Soccer, away game (under 10)",
+		},
+		{
+			name:        "Drop",
+			rules:       []models.RewriteRule{{Action: models.RewriteActionDrop, Pattern: "Lunch menu"}},
+			title:       "Lunch menu: pizza",
+			wantDropped: true,
+		},
+		{
+			name: "Rules see earlier rewrites",
+			rules: []models.RewriteRule{
+				{Action: models.RewriteActionReplace, Pattern: "Lunch", Value: "Meal"},
+				{Action: models.RewriteActionDrop, Pattern: "Lunch"},
+			},
+			title:     "Lunch menu",
+			wantTitle: "Meal menu",
+		},
+		{
+			name:      "Set categories",
+			rules:     []models.RewriteRule{{Action: models.RewriteActionSetCategories, Value: " School, Kids ,,"}},
+			title:     "Field trip",
+			wantTitle: "Field trip",
+			wantProp:  "CATEGORIES",
+			wantValue: "School,Kids",
+		},
+		{
+			name:      "Set color",
+			rules:     []models.RewriteRule{{Action: models.RewriteActionSetColor, Value: "Teal"}},
+			title:     "Field trip",
+			wantTitle: "Field trip",
+			wantProp:  "COLOR",
+			wantValue: "teal",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vevent := ical.NewComponent("VEVENT")
+			vevent.AddProp("UID", "x")
+			vevent.AddProp("SUMMARY", ical.EscapeText(tt.title))
+			vevent.AddProp("CATEGORIES", "Upstream")
+
+			result := applyRewriteRules(vevent, compile(t, tt.rules...))
+
+			if tt.wantDropped {
+				assert.Nil(t, result)
+				return
+			}
+			require.NotNil(t, result)
+			assert.Equal(t, tt.wantTitle, ical.UnescapeText(result.PropValue("SUMMARY")))
+			if tt.wantProp != "" {
+				require.Len(t, result.PropsNamed(tt.wantProp), 1)
+				assert.Equal(t, tt.wantValue, result.PropValue(tt.wantProp))
+			}
+		})
+	}
+}
+
+func TestCreateRewriteRule_Success(t *testing.T) {
+	user, calendarMux, calendarSource := setupRewriteRuleTestDB(t)
+
+	rr := httptest.NewRecorder()
+	calendarMuxHandler().CreateRewriteRule(rr, rewriteRuleRequest(http.MethodPost, user.ID, calendarMux, calendarSource, 0, RewriteRuleRequest{
+		Action: "prefix",
+		Value:  "[Emma]",
+	}))
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var response RewriteRuleAPIResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.NotZero(t, response.ID)
+	assert.Equal(t, calendarSource.ID, response.CalendarSourceID)
+	assert.Equal(t, 0, response.Position)
+	assert.Equal(t, "prefix", response.Action)
+	assert.Equal(t, "[Emma]", response.Value)
+
+	// A position inserts the rule ahead of existing ones
+	position := 0
+	rr = httptest.NewRecorder()
+	calendarMuxHandler().CreateRewriteRule(rr, rewriteRuleRequest(http.MethodPost, user.ID, calendarMux, calendarSource, 0, RewriteRuleRequest{
+		Action:   "drop",
+		Pattern:  "Lunch menu",
+		Position: &position,
+	}))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	rr = httptest.NewRecorder()
+	calendarMuxHandler().ListRewriteRules(rr, rewriteRuleRequest(http.MethodGet, user.ID, calendarMux, calendarSource, 0, nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var list RewriteRuleListAPIResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+	require.Len(t, list.Rules, 2)
+	assert.Equal(t, "drop", list.Rules[0].Action)
+	assert.Equal(t, "prefix", list.Rules[1].Action)
+	assert.Equal(t, 1, list.Rules[1].Position)
+}
+
+func TestCreateRewriteRule_ValidationErrors(t *testing.T) {
+	user, calendarMux, calendarSource := setupRewriteRuleTestDB(t)
+	negative := -1
+
+	tests := []struct {
+		name       string
+		body       RewriteRuleRequest
+		wantFields map[string]string
+	}{
+		{
+			name:       "Missing action",
+			body:       RewriteRuleRequest{Value: "x"},
+			wantFields: map[string]string{"action": "This field is required"},
+		},
+		{
+			name:       "Unknown action",
+			body:       RewriteRuleRequest{Action: "shout"},
+			wantFields: map[string]string{"action": "Invalid value"},
+		},
+		{
+			name:       "Negative position",
+			body:       RewriteRuleRequest{Action: "prefix", Value: "x", Position: &negative},
+			wantFields: map[string]string{"position": "Value too small (min: 0)"},
+		},
+		{
+			name:       "Pattern too long",
+			body:       RewriteRuleRequest{Action: "drop", Pattern: strings.Repeat("a", 501)},
+			wantFields: map[string]string{"pattern": "Value too large (max: 500)"},
+		},
+		{
+			name:       "Invalid pattern",
+			body:       RewriteRuleRequest{Action: "prefix", Pattern: "(unclosed", Value: "x"},
+			wantFields: map[string]string{"pattern": "Invalid regular expression"},
+		},
+		{
+			name:       "Replace without pattern",
+			body:       RewriteRuleRequest{Action: "replace", Value: "x"},
+			wantFields: map[string]string{"pattern": "This field is required"},
+		},
+		{
+			name:       "Drop without pattern",
+			body:       RewriteRuleRequest{Action: "drop"},
+			wantFields: map[string]string{"pattern": "This field is required"},
+		},
+		{
+			name:       "Prefix without value",
+			body:       RewriteRuleRequest{Action: "prefix", Value: "  "},
+			wantFields: map[string]string{"value": "This field is required"},
+		},
+		{
+			name:       "Categories without names",
+			body:       RewriteRuleRequest{Action: "set_categories", Value: " , "},
+			wantFields: map[string]string{"value": "This field is required"},
+		},
+		{
+			name:       "Color that is not a name",
+			body:       RewriteRuleRequest{Action: "set_color", Value: "#ff0000"},
+			wantFields: map[string]string{"value": "Must be a CSS color name"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			calendarMuxHandler().CreateRewriteRule(rr, rewriteRuleRequest(http.MethodPost, user.ID, calendarMux, calendarSource, 0, tt.body))
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			var response utils.ErrorResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			assert.Equal(t, "Invalid rewrite rule", response.Error)
+			assert.Equal(t, tt.wantFields, response.Fields)
+		})
+	}
+
+	var count int64
+	db.DB.Model(&models.RewriteRule{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestCreateRewriteRule_InvalidBody(t *testing.T) {
+	user, calendarMux, calendarSource := setupRewriteRuleTestDB(t)
+
+	req := rewriteRuleRequest(http.MethodPost, user.ID, calendarMux, calendarSource, 0, nil)
+	rr := httptest.NewRecorder()
+	calendarMuxHandler().CreateRewriteRule(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Invalid request body")
+}
+
+func TestUpdateRewriteRule_Success(t *testing.T) {
+	user, calendarMux, calendarSource := setupRewriteRuleTestDB(t)
+
+	first := &models.RewriteRule{CalendarSourceID: calendarSource.ID, Position: 0, Action: models.RewriteActionPrefix, Value: "[Emma]"}
+	second := &models.RewriteRule{CalendarSourceID: calendarSource.ID, Position: 1, Action: models.RewriteActionDrop, Pattern: "Lunch"}
+	db.DB.Create(first)
+	db.DB.Create(second)
+
+	position := 0
+	rr := httptest.NewRecorder()
+	calendarMuxHandler().UpdateRewriteRule(rr, rewriteRuleRequest(http.MethodPut, user.ID, calendarMux, calendarSource, second.ID, RewriteRuleRequest{
+		Action:   "drop",
+		Pattern:  "Lunch menu",
+		Position: &position,
+	}))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response RewriteRuleAPIResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, second.ID, response.ID)
+	assert.Equal(t, "Lunch menu", response.Pattern)
+	assert.Equal(t, 0, response.Position)
+
+	var found models.RewriteRule
+	db.DB.First(&found, first.ID)
+	assert.Equal(t, 1, found.Position)
+}
+
+func TestUpdateRewriteRule_Errors(t *testing.T) {
+	user, calendarMux, calendarSource := setupRewriteRuleTestDB(t)
+	otherUser := &models.User{GivenName: "Other", FamilyName: "User", Email: "other@example.com"}
+	db.DB.Create(otherUser)
+
+	rule := &models.RewriteRule{CalendarSourceID: calendarSource.ID, Action: models.RewriteActionPrefix, Value: "[Emma]"}
+	db.DB.Create(rule)
+	valid := RewriteRuleRequest{Action: "prefix", Value: "[E]"}
+
+	tests := []struct {
+		name       string
+		userID     uint
+		ruleID     uint
+		body       interface{}
+		wantStatus int
+		wantError  string
+	}{
+		{name: "Not owner", userID: otherUser.ID, ruleID: rule.ID, body: valid, wantStatus: http.StatusNotFound, wantError: "Calendar mux not found or access denied"},
+		{name: "Unknown rule", userID: user.ID, ruleID: 9999, body: valid, wantStatus: http.StatusNotFound, wantError: "Rewrite rule not found"},
+		{name: "Invalid rule", userID: user.ID, ruleID: rule.ID, body: RewriteRuleRequest{Action: "set_color", Value: "dark red"}, wantStatus: http.StatusBadRequest, wantError: "Invalid rewrite rule"},
+		{name: "No auth", userID: 0, ruleID: rule.ID, body: valid, wantStatus: http.StatusUnauthorized, wantError: "User not authenticated"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			calendarMuxHandler().UpdateRewriteRule(rr, rewriteRuleRequest(http.MethodPut, tt.userID, calendarMux, calendarSource, tt.ruleID, tt.body))
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.wantError)
+		})
+	}
+
+	var found models.RewriteRule
+	db.DB.First(&found, rule.ID)
+	assert.Equal(t, "[Emma]", found.Value)
+}
+
+func TestUpdateRewriteRule_InvalidID(t *testing.T) {
+	user, calendarMux, calendarSource := setupRewriteRuleTestDB(t)
+
+	req := newRouteRequest(http.MethodPut, "/api/calendar-mux/1/sources/1/rules/abc", bytes.NewReader([]byte(`{}`)), user.ID,
+		map[string]string{"id": strconv.FormatUint(uint64(calendarMux.ID), 10), "sourceID": strconv.FormatUint(uint64(calendarSource.ID), 10), "ruleID": "abc"})
+	rr := httptest.NewRecorder()
+	calendarMuxHandler().UpdateRewriteRule(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Invalid rewrite rule ID")
+}
+
+func TestDeleteRewriteRule(t *testing.T) {
+	user, calendarMux, calendarSource := setupRewriteRuleTestDB(t)
+
+	rule := &models.RewriteRule{CalendarSourceID: calendarSource.ID, Action: models.RewriteActionPrefix, Value: "[Emma]"}
+	db.DB.Create(rule)
+
+	rr := httptest.NewRecorder()
+	calendarMuxHandler().DeleteRewriteRule(rr, rewriteRuleRequest(http.MethodDelete, user.ID, calendarMux, calendarSource, rule.ID, nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Rewrite rule deleted successfully")
+
+	rr = httptest.NewRecorder()
+	calendarMuxHandler().DeleteRewriteRule(rr, rewriteRuleRequest(http.MethodDelete, user.ID, calendarMux, calendarSource, rule.ID, nil))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestListRewriteRules_UnknownSource(t *testing.T) {
+	user, calendarMux, _ := setupRewriteRuleTestDB(t)
+
+	rr := httptest.NewRecorder()
+	calendarMuxHandler().ListRewriteRules(rr, rewriteRuleRequest(http.MethodGet, user.ID, calendarMux, &models.CalendarSource{Model: gorm.Model{ID: 9999}}, 0, nil))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Calendar source not found")
+}
@@ -0,0 +1,82 @@
+package rest_api_handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"family-calendar-backend/auth"
+	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/services"
+	"family-calendar-backend/rest_api_handlers/utils"
+)
+
+func buildSessionResponse(session models.Session, currentSessionID uint) SessionAPIResponse {
+	return SessionAPIResponse{
+		ID:         session.ID,
+		UserAgent:  session.UserAgent,
+		IPAddress:  session.IPAddress,
+		Current:    session.ID == currentSessionID,
+		CreatedAt:  session.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		LastUsedAt: session.LastUsedAt.Format("2006-01-02T15:04:05Z07:00"),
+		ExpiresAt:  session.ExpiresAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
+// ListSessions returns the active sessions of the authenticated user, most recently used first
+func ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+	currentSessionID, _ := auth.GetSessionIDFromContext(r.Context())
+
+	sessions, err := services.GetActiveSessionsByUser(userID, time.Now())
+	if err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to retrieve sessions", nil)
+		return
+	}
+
+	// Build response
+	sessionResponses := make([]SessionAPIResponse, 0, len(sessions))
+	for _, session := range sessions {
+		sessionResponses = append(sessionResponses, buildSessionResponse(session, currentSessionID))
+	}
+
+	response := SessionListAPIResponse{Sessions: sessionResponses}
+	if err := validate.Struct(response); err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, "Response validation failed", nil)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+// RevokeSession signs the authenticated user out of one of their sessions. Its refresh tokens stop
+// working and its access tokens are rejected from then on.
+func RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondError(w, http.StatusUnauthorized, "User not authenticated", nil)
+		return
+	}
+
+	sessionID, ok := parseIDParam(r, "id")
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid session ID", nil)
+		return
+	}
+
+	if err := services.RevokeSession(sessionID, userID, time.Now()); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			utils.RespondError(w, http.StatusNotFound, "Session not found", nil)
+			return
+		}
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to revoke session", nil)
+		return
+	}
+	auth.InvalidateSession(sessionID)
+
+	utils.RespondJSON(w, http.StatusOK, RevokeSessionAPIResponse{Message: "Session revoked successfully"})
+}
@@ -0,0 +1,21 @@
+package rest_api_handlers
+
+// SessionAPIResponse is a sign-in of the authenticated user
+type SessionAPIResponse struct {
+	ID        uint   `json:"id" validate:"required"`
+	UserAgent string `json:"user_agent"`
+	IPAddress string `json:"ip_address"`
+	// Current marks the session the request was made in
+	Current    bool   `json:"current"`
+	CreatedAt  string `json:"created_at" validate:"required"`
+	LastUsedAt string `json:"last_used_at" validate:"required"`
+	ExpiresAt  string `json:"expires_at" validate:"required"`
+}
+
+type SessionListAPIResponse struct {
+	Sessions []SessionAPIResponse `json:"sessions" validate:"dive"`
+}
+
+type RevokeSessionAPIResponse struct {
+	Message string `json:"message" validate:"required"`
+}
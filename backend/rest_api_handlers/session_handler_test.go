@@ -0,0 +1,76 @@
+package rest_api_handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"family-calendar-backend/auth"
+	"family-calendar-backend/db/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListSessions(t *testing.T) {
+	user := setupCalendarMuxTestDB(t)
+	now := time.Now()
+	older, _, err := services.CreateSession(user.ID, "Firefox", "192.0.2.1", now.Add(-time.Hour), now.Add(time.Hour))
+	require.NoError(t, err)
+	current, _, err := services.CreateSession(user.ID, "Safari", "192.0.2.2", now, now.Add(time.Hour))
+	require.NoError(t, err)
+
+	req := newRouteRequest("GET", "/api/sessions", nil, user.ID, nil)
+	req = req.WithContext(context.WithValue(req.Context(), auth.SessionIDContextKey, current.ID))
+	rr := httptest.NewRecorder()
+	ListSessions(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response SessionListAPIResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Len(t, response.Sessions, 2)
+	assert.Equal(t, current.ID, response.Sessions[0].ID)
+	assert.True(t, response.Sessions[0].Current)
+	assert.Equal(t, "Safari", response.Sessions[0].UserAgent)
+	assert.Equal(t, older.ID, response.Sessions[1].ID)
+	assert.False(t, response.Sessions[1].Current)
+	assert.Equal(t, "192.0.2.1", response.Sessions[1].IPAddress)
+}
+
+func TestListSessions_Unauthenticated(t *testing.T) {
+	setupCalendarMuxTestDB(t)
+
+	rr := httptest.NewRecorder()
+	ListSessions(rr, newRouteRequest("GET", "/api/sessions", nil, 0, nil))
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestRevokeSession_Handler(t *testing.T) {
+	user := setupCalendarMuxTestDB(t)
+	now := time.Now()
+	session, _, err := services.CreateSession(user.ID, "Firefox", "192.0.2.1", now, now.Add(time.Hour))
+	require.NoError(t, err)
+	params := map[string]string{"id": strconv.FormatUint(uint64(session.ID), 10)}
+
+	// Other users cannot see the session
+	rr := httptest.NewRecorder()
+	RevokeSession(rr, newRouteRequest("DELETE", "/api/sessions/1", nil, user.ID+1, params))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	RevokeSession(rr, newRouteRequest("DELETE", "/api/sessions/1", nil, user.ID, params))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	sessions, err := services.GetActiveSessionsByUser(user.ID, now)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	rr = httptest.NewRecorder()
+	RevokeSession(rr, newRouteRequest("DELETE", "/api/sessions/abc", nil, user.ID, map[string]string{"id": "abc"}))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -1,15 +1,26 @@
 package rest_api_handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"family-calendar-backend/auth"
-	"family-calendar-backend/db"
-	"family-calendar-backend/db/models"
+	"family-calendar-backend/db/repositories"
 	"family-calendar-backend/rest_api_handlers/utils"
 )
 
-func UserInfo(w http.ResponseWriter, r *http.Request) {
+// UserHandler serves the profile of the authenticated user
+type UserHandler struct {
+	users repositories.UserRepository
+}
+
+// NewUserHandler returns a UserHandler reading users from the given repository
+func NewUserHandler(users repositories.UserRepository) *UserHandler {
+	return &UserHandler{users: users}
+}
+
+// UserInfo returns the profile of the authenticated user
+func (h *UserHandler) UserInfo(w http.ResponseWriter, r *http.Request) {
 	// Get authenticated user ID from context
 	userID, ok := auth.GetUserIDFromContext(r.Context())
 	if !ok {
@@ -17,10 +28,13 @@ func UserInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Query user from database
-	var dbUser models.User
-	if err := db.DB.First(&dbUser, userID).Error; err != nil {
-		utils.RespondError(w, http.StatusNotFound, "User not found", nil)
+	dbUser, err := h.users.Get(userID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.RespondError(w, http.StatusNotFound, "User not found", nil)
+			return
+		}
+		utils.RespondError(w, http.StatusInternalServerError, "Failed to retrieve user", nil)
 		return
 	}
 
@@ -0,0 +1,41 @@
+import { describe, it, expect, vi, beforeEach } from 'vitest';
+import { authApi } from './authApi';
+import { apiClient } from '../utils/apiClient';
+
+vi.mock('../utils/apiClient', () => ({
+  apiClient: {
+    post: vi.fn(),
+  },
+}));
+
+describe('authApi', () => {
+  beforeEach(() => {
+    vi.clearAllMocks();
+  });
+
+  describe('exchangeCode', () => {
+    it('should exchange the code and verifier at /auth/token', async () => {
+      const mockTokens = {
+        access_token: 'access-token',
+        token_type: 'Bearer',
+        expires_in: 900,
+        refresh_token: 'refresh-token',
+      };
+
+      vi.mocked(apiClient.post).mockResolvedValueOnce(mockTokens);
+
+      const result = await authApi.exchangeCode(
+        'test-code',
+        'test-verifier',
+        'http://localhost:3000/auth/callback'
+      );
+
+      expect(apiClient.post).toHaveBeenCalledWith('/auth/token', {
+        code: 'test-code',
+        code_verifier: 'test-verifier',
+        redirect_uri: 'http://localhost:3000/auth/callback',
+      });
+      expect(result).toEqual(mockTokens);
+    });
+  });
+});
@@ -0,0 +1,22 @@
+import { apiClient } from '../utils/apiClient';
+
+export interface TokenResponse {
+  access_token: string;
+  token_type: string;
+  expires_in: number;
+  refresh_token: string;
+}
+
+export const authApi = {
+  exchangeCode: async (
+    code: string,
+    codeVerifier: string,
+    redirectUri: string
+  ): Promise<TokenResponse> => {
+    return apiClient.post<TokenResponse>('/auth/token', {
+      code,
+      code_verifier: codeVerifier,
+      redirect_uri: redirectUri,
+    });
+  },
+};
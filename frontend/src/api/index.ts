@@ -1,5 +1,6 @@
 // Re-export all APIs and types
 export { userApi, type User } from './userApi';
+export { authApi, type TokenResponse } from './authApi';
 export { healthApi, type HealthCheckResponse } from './healthApi';
 export {
   calendarMuxApi,
@@ -1,9 +1,14 @@
 import { describe, it, expect, vi, beforeEach } from 'vitest';
-import { render, screen, fireEvent } from '@testing-library/react';
+import { render, screen, fireEvent, waitFor } from '@testing-library/react';
 import AppHeader from './AppHeader';
 import { useAuth } from '../hooks/useAuth';
 
 vi.mock('../hooks/useAuth');
+vi.mock('../utils/pkce', () => ({
+  pkce: {
+    createChallenge: vi.fn().mockResolvedValue('test-challenge'),
+  },
+}));
 
 describe('AppHeader', () => {
   const mockUser = {
@@ -62,7 +67,7 @@ describe('AppHeader', () => {
     expect(mockLogout).toHaveBeenCalled();
   });
 
-  it('should redirect to auth URL when sign in button is clicked', () => {
+  it('should redirect to auth URL when sign in button is clicked', async () => {
     vi.mocked(useAuth).mockReturnValue({
       user: null,
       loading: false,
@@ -74,7 +79,11 @@ describe('AppHeader', () => {
     render(<AppHeader />);
     fireEvent.click(screen.getByText('Sign In'));
 
-    expect(window.location.href).toContain('/auth/google');
+    await waitFor(() => {
+      expect(window.location.href).toContain('/auth/google');
+    });
     expect(window.location.href).toContain('callback=');
+    expect(window.location.href).toContain('code_challenge=test-challenge');
+    expect(window.location.href).toContain('code_challenge_method=S256');
   });
 });
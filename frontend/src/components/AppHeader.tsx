@@ -1,6 +1,7 @@
 import React from 'react';
 import { Layout, Button, Space, Typography } from 'antd';
 import { useAuth } from '../hooks/useAuth';
+import { pkce } from '../utils/pkce';
 
 const { Header } = Layout;
 const { Text } = Typography;
@@ -8,13 +9,15 @@ const { Text } = Typography;
 const AppHeader: React.FC = () => {
   const { user, isAuthenticated, logout } = useAuth();
 
-  const handleSignIn = () => {
+  const handleSignIn = async () => {
     // Use runtime config if available, fallback to build-time env, then default
     const authUrl = (window as any).ENV?.AUTH_LOGIN_URL ||
                     import.meta.env.PUBLIC_AUTH_LOGIN_URL ||
                     'http://localhost:8080/auth/google';
     const callbackUrl = `${window.location.origin}/auth/callback`;
-    window.location.href = `${authUrl}?callback=${encodeURIComponent(callbackUrl)}`;
+    const codeChallenge = await pkce.createChallenge();
+    window.location.href = `${authUrl}?callback=${encodeURIComponent(callbackUrl)}` +
+      `&code_challenge=${codeChallenge}&code_challenge_method=S256`;
   };
 
   return (
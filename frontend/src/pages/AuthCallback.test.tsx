@@ -1,8 +1,10 @@
 import { describe, it, expect, vi, beforeEach } from 'vitest';
-import { render, screen, waitFor } from '@testing-library/react';
+import { render, waitFor } from '@testing-library/react';
 import { MemoryRouter, Route, Routes } from 'react-router-dom';
 import AuthCallback from './AuthCallback';
 import { authService } from '../utils/auth';
+import { pkce } from '../utils/pkce';
+import { authApi } from '../api/authApi';
 
 vi.mock('../utils/auth', () => ({
   authService: {
@@ -10,6 +12,18 @@ vi.mock('../utils/auth', () => ({
   },
 }));
 
+vi.mock('../utils/pkce', () => ({
+  pkce: {
+    takeVerifier: vi.fn(),
+  },
+}));
+
+vi.mock('../api/authApi', () => ({
+  authApi: {
+    exchangeCode: vi.fn(),
+  },
+}));
+
 const mockNavigate = vi.fn();
 vi.mock('react-router-dom', async () => {
   const actual = await vi.importActual('react-router-dom');
@@ -19,51 +33,79 @@ vi.mock('react-router-dom', async () => {
   };
 });
 
+const renderAt = (url: string) =>
+  render(
+    <MemoryRouter initialEntries={[url]}>
+      <Routes>
+        <Route path="/auth/callback" element={<AuthCallback />} />
+      </Routes>
+    </MemoryRouter>
+  );
+
 describe('AuthCallback', () => {
   beforeEach(() => {
     vi.clearAllMocks();
+    vi.mocked(pkce.takeVerifier).mockReturnValue('test-verifier');
   });
 
   it('should render loading spinner', () => {
-    const { container } = render(
-      <MemoryRouter initialEntries={['/auth/callback']}>
-        <Routes>
-          <Route path="/auth/callback" element={<AuthCallback />} />
-        </Routes>
-      </MemoryRouter>
-    );
+    const { container } = renderAt('/auth/callback');
     // Check for the spinner by its aria-busy attribute
     const spinner = container.querySelector('[aria-busy="true"]');
     expect(spinner).toBeInTheDocument();
   });
 
-  it('should set token and navigate when token is present', async () => {
-    render(
-      <MemoryRouter initialEntries={['/auth/callback?token=test-token-123']}>
-        <Routes>
-          <Route path="/auth/callback" element={<AuthCallback />} />
-        </Routes>
-      </MemoryRouter>
-    );
+  it('should exchange the code, set the token and navigate when a code is present', async () => {
+    vi.mocked(authApi.exchangeCode).mockResolvedValueOnce({
+      access_token: 'test-token-123',
+      token_type: 'Bearer',
+      expires_in: 900,
+      refresh_token: 'refresh-token',
+    });
+
+    renderAt('/auth/callback?code=test-code');
 
     await waitFor(() => {
+      expect(authApi.exchangeCode).toHaveBeenCalledWith(
+        'test-code',
+        'test-verifier',
+        `${window.location.origin}/auth/callback`
+      );
       expect(authService.setToken).toHaveBeenCalledWith('test-token-123');
       expect(mockNavigate).toHaveBeenCalledWith('/', { replace: true });
     });
   });
 
-  it('should navigate without setting token when no token is present', async () => {
-    render(
-      <MemoryRouter initialEntries={['/auth/callback']}>
-        <Routes>
-          <Route path="/auth/callback" element={<AuthCallback />} />
-        </Routes>
-      </MemoryRouter>
-    );
+  it('should navigate without setting token when the exchange fails', async () => {
+    vi.spyOn(console, 'error').mockImplementation(() => {});
+    vi.mocked(authApi.exchangeCode).mockRejectedValueOnce(new Error('API error: 400'));
+
+    renderAt('/auth/callback?code=test-code');
+
+    await waitFor(() => {
+      expect(mockNavigate).toHaveBeenCalledWith('/', { replace: true });
+    });
+    expect(authService.setToken).not.toHaveBeenCalled();
+  });
+
+  it('should navigate without setting token when no code is present', async () => {
+    renderAt('/auth/callback');
 
     await waitFor(() => {
       expect(authService.setToken).not.toHaveBeenCalled();
+      expect(authApi.exchangeCode).not.toHaveBeenCalled();
+      expect(mockNavigate).toHaveBeenCalledWith('/', { replace: true });
+    });
+  });
+
+  it('should ignore a code without a verifier from this tab', async () => {
+    vi.mocked(pkce.takeVerifier).mockReturnValue(null);
+
+    renderAt('/auth/callback?code=test-code');
+
+    await waitFor(() => {
       expect(mockNavigate).toHaveBeenCalledWith('/', { replace: true });
     });
+    expect(authApi.exchangeCode).not.toHaveBeenCalled();
   });
 });
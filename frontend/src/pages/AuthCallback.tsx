@@ -1,18 +1,31 @@
-import React, { useEffect } from 'react';
+import React, { useEffect, useRef } from 'react';
 import { useNavigate, useSearchParams } from 'react-router-dom';
 import { Spin } from 'antd';
 import { authService } from '../utils/auth';
+import { pkce } from '../utils/pkce';
+import { authApi } from '../api/authApi';
 
 const AuthCallback: React.FC = () => {
   const [searchParams] = useSearchParams();
   const navigate = useNavigate();
+  // A code can be exchanged once, even when StrictMode runs the effect twice
+  const exchanged = useRef(false);
 
   useEffect(() => {
-    const token = searchParams.get('token');
+    if (exchanged.current) {
+      return;
+    }
+    exchanged.current = true;
 
-    if (token) {
-      authService.setToken(token);
-      navigate('/', { replace: true });
+    const code = searchParams.get('code');
+    const codeVerifier = pkce.takeVerifier();
+
+    if (code && codeVerifier) {
+      const redirectUri = `${window.location.origin}/auth/callback`;
+      authApi.exchangeCode(code, codeVerifier, redirectUri)
+        .then((tokens) => authService.setToken(tokens.access_token))
+        .catch((error) => console.error('Failed to sign in:', error))
+        .finally(() => navigate('/', { replace: true }));
     } else {
       navigate('/', { replace: true });
     }
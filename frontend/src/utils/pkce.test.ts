@@ -0,0 +1,40 @@
+import { describe, it, expect, beforeEach } from 'vitest';
+import { pkce } from './pkce';
+
+const base64Url = (bytes: Uint8Array): string =>
+  btoa(String.fromCharCode(...bytes))
+    .replace(/\+/g, '-')
+    .replace(/\//g, '_')
+    .replace(/=+$/, '');
+
+describe('pkce', () => {
+  beforeEach(() => {
+    sessionStorage.clear();
+  });
+
+  describe('createChallenge', () => {
+    it('should return the S256 challenge of the stored verifier', async () => {
+      const challenge = await pkce.createChallenge();
+      const verifier = sessionStorage.getItem('pkce_code_verifier');
+
+      expect(verifier).toMatch(/^[A-Za-z0-9_-]{43}$/);
+      expect(challenge).toMatch(/^[A-Za-z0-9_-]{43}$/);
+      const digest = await crypto.subtle.digest('SHA-256', new TextEncoder().encode(verifier!));
+      expect(challenge).toBe(base64Url(new Uint8Array(digest)));
+    });
+
+    it('should create a new verifier every time', async () => {
+      const first = await pkce.createChallenge();
+      const second = await pkce.createChallenge();
+      expect(first).not.toBe(second);
+    });
+  });
+
+  describe('takeVerifier', () => {
+    it('should return the verifier only once', () => {
+      sessionStorage.setItem('pkce_code_verifier', 'test-verifier');
+      expect(pkce.takeVerifier()).toBe('test-verifier');
+      expect(pkce.takeVerifier()).toBeNull();
+    });
+  });
+});
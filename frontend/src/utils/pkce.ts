@@ -0,0 +1,24 @@
+const VERIFIER_KEY = 'pkce_code_verifier';
+
+const base64Url = (bytes: Uint8Array): string =>
+  btoa(String.fromCharCode(...bytes))
+    .replace(/\+/g, '-')
+    .replace(/\//g, '_')
+    .replace(/=+$/, '');
+
+// PKCE keeps the one-time code of the sign-in callback useless to anyone but this tab
+export const pkce = {
+  async createChallenge(): Promise<string> {
+    const verifier = base64Url(crypto.getRandomValues(new Uint8Array(32)));
+    sessionStorage.setItem(VERIFIER_KEY, verifier);
+
+    const digest = await crypto.subtle.digest('SHA-256', new TextEncoder().encode(verifier));
+    return base64Url(new Uint8Array(digest));
+  },
+
+  takeVerifier(): string | null {
+    const verifier = sessionStorage.getItem(VERIFIER_KEY);
+    sessionStorage.removeItem(VERIFIER_KEY);
+    return verifier;
+  },
+};